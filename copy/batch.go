@@ -0,0 +1,61 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+
+	internalblobinfocache "github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/internal/session"
+	"github.com/containers/image/v5/pkg/blobinfocache"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+)
+
+// BatchImage is a single image copied by Images.
+type BatchImage struct {
+	Source      types.ImageReference
+	Destination types.ImageReference
+}
+
+// BatchResult is the outcome of copying a single BatchImage.
+type BatchResult struct {
+	Manifest []byte // The manifest written to the destination, as returned by Image; may be set even if Err != nil (see Options.BestEffortInstances)
+	Err      error  // The error copying the image, or nil
+}
+
+// Images copies each of images, as Image would with the same policyContext and options,
+// but shares state across the copies instead of setting it up for each image separately:
+// a single blob info cache is used for all images, and destinations which support it (notably docker://)
+// reuse connections, the detected registry properties, and authentication tokens, for all images on the same registry.
+//
+// Images returns one BatchResult for every image it attempted to copy, in the order of images.
+// A failure to copy an image does not stop the batch, unless options.StopBatchOnError is set;
+// in that case, the results end with the failed image, and the error is also returned as the second return value.
+// The second return value is also used for errors which affect the batch as a whole, e.g. invalid options.
+func Images(ctx context.Context, policyContext *signature.PolicyContext, images []BatchImage, options *Options) ([]BatchResult, error) {
+	if options == nil {
+		options = &Options{}
+	}
+	if err := validateOptions(options); err != nil {
+		return nil, err
+	}
+
+	// See the FIXME in Image about the choice of DestinationCtx.
+	blobInfoCache := internalblobinfocache.FromBlobInfoCache(blobinfocache.DefaultCache(options.DestinationCtx))
+	s := session.New()
+	defer s.Close()
+	sessionCtx := session.WithSession(ctx, s)
+
+	res := make([]BatchResult, 0, len(images))
+	for _, img := range images {
+		manifest, err := retryImageCopy(sessionCtx, options, func() ([]byte, error) {
+			return copyImageOnce(sessionCtx, policyContext, img.Destination, img.Source, options, blobInfoCache)
+		})
+		res = append(res, BatchResult{Manifest: manifest, Err: err})
+		if err != nil && options.StopBatchOnError {
+			return res, fmt.Errorf("copying %s to %s: %w", transports.ImageName(img.Source), transports.ImageName(img.Destination), err)
+		}
+	}
+	return res, nil
+}
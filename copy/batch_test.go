@@ -0,0 +1,73 @@
+package copy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImages(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// Three source images; the second one can not be read.
+	images := []BatchImage{}
+	manifests := [][]byte{}
+	destDirs := []string{}
+	for i := 1; i <= 3; i++ {
+		srcDir := t.TempDir()
+		manifests = append(manifests, writeTestImage(t, srcDir, testImage{layers: numberedLayers(i)}))
+		srcRef, err := directory.NewReference(srcDir)
+		require.NoError(t, err)
+		destDir := t.TempDir()
+		destRef, err := directory.NewReference(destDir)
+		require.NoError(t, err)
+		images = append(images, BatchImage{Source: srcRef, Destination: destRef})
+		destDirs = append(destDirs, destDir)
+		if i == 2 {
+			err = os.Remove(filepath.Join(srcDir, "manifest.json"))
+			require.NoError(t, err)
+		}
+	}
+
+	// By default, failures are reported per image
+	res, err := Images(context.Background(), policyContext, images, nil)
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+	for i, r := range res {
+		if i == 1 {
+			assert.Error(t, r.Err)
+			assert.Nil(t, r.Manifest)
+			_, err := os.Stat(filepath.Join(destDirs[i], "manifest.json"))
+			assert.ErrorIs(t, err, os.ErrNotExist)
+			continue
+		}
+		require.NoError(t, r.Err, i)
+		assert.Equal(t, manifests[i], r.Manifest, i)
+		written, err := os.ReadFile(filepath.Join(destDirs[i], "manifest.json"))
+		require.NoError(t, err, i)
+		assert.Equal(t, manifests[i], written, i)
+	}
+
+	// StopBatchOnError stops after the first failure
+	for _, dir := range destDirs {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}
+	res, err = Images(context.Background(), policyContext, images, &Options{StopBatchOnError: true})
+	require.Error(t, err)
+	require.Len(t, res, 2)
+	assert.NoError(t, res[0].Err)
+	assert.ErrorIs(t, err, res[1].Err)
+	_, err = os.Stat(filepath.Join(destDirs[2], "manifest.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Invalid options are rejected before copying anything
+	res, err = Images(context.Background(), policyContext, images, &Options{ImageRetries: -1})
+	assert.Error(t, err)
+	assert.Nil(t, res)
+}
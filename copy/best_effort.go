@@ -0,0 +1,83 @@
+package copy
+
+import (
+	"fmt"
+	"strings"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+const (
+	// RemoveFailedInstances is the default value which, when set in
+	// Options.FailedInstances, indicates that instances which could not be
+	// copied with Options.BestEffortInstances are omitted from the manifest
+	// list written to the destination.
+	RemoveFailedInstances FailedInstanceHandling = iota
+	// KeepFailedInstances is a value which, when set in
+	// Options.FailedInstances, indicates that instances which could not be
+	// copied with Options.BestEffortInstances are recorded in the manifest
+	// list written to the destination using their original descriptors,
+	// although the destination does not contain them.
+	KeepFailedInstances
+)
+
+// FailedInstanceHandling is one of RemoveFailedInstances or
+// KeepFailedInstances, to control how copy.Image() records instances of a
+// manifest list which could not be copied with Options.BestEffortInstances.
+type FailedInstanceHandling int
+
+func validateFailedInstanceHandling(handling FailedInstanceHandling) error {
+	switch handling {
+	case RemoveFailedInstances, KeepFailedInstances:
+		return nil
+	default:
+		return fmt.Errorf("Invalid value for options.FailedInstances: %d", handling)
+	}
+}
+
+// InstanceCopyError describes a failure to copy a single instance of a manifest list.
+type InstanceCopyError struct {
+	Digest digest.Digest // The digest of the instance in the source manifest list
+	Err    error
+}
+
+func (e InstanceCopyError) Error() string {
+	return fmt.Sprintf("instance %s: %v", e.Digest, e.Err)
+}
+
+// Unwrap returns the underlying error, for errors.Is and errors.As.
+func (e InstanceCopyError) Unwrap() error {
+	return e.Err
+}
+
+// PartialListCopyError is returned by copy.Image with Options.BestEffortInstances if some instances of a manifest list
+// could not be copied, but the other instances and the manifest list itself have been written to the destination.
+// In that case, copy.Image also returns the manifest list which was written.
+type PartialListCopyError struct {
+	Failures []InstanceCopyError
+	// InstancesRemoved is true if the failed instances were omitted from the manifest list written to the destination
+	// (RemoveFailedInstances), so that it contains fewer instances than the source; it is false if the failed instances
+	// are recorded using their original descriptors (KeepFailedInstances).
+	InstancesRemoved bool
+}
+
+func (e PartialListCopyError) Error() string {
+	msgs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		msgs = append(msgs, f.Error())
+	}
+	handling := "kept in the manifest list, but not copied"
+	if e.InstancesRemoved {
+		handling = "removed from the manifest list"
+	}
+	return fmt.Sprintf("copying %d instances failed, they were %s: %s", len(e.Failures), handling, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the individual failures, for errors.Is and errors.As.
+func (e PartialListCopyError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		errs = append(errs, f)
+	}
+	return errs
+}
@@ -0,0 +1,122 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	internalManifest "github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/manifest"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartialListCopyError(t *testing.T) {
+	cause := errors.New("instance error")
+	err := PartialListCopyError{
+		Failures: []InstanceCopyError{
+			{Digest: digest.FromString("1"), Err: cause},
+			{Digest: digest.FromString("2"), Err: errors.New("other error")},
+		},
+		InstancesRemoved: true,
+	}
+	assert.ErrorIs(t, err, cause)
+	assert.Contains(t, err.Error(), "copying 2 instances failed, they were removed from the manifest list")
+	assert.Contains(t, err.Error(), digest.FromString("1").String()+": instance error")
+	err.InstancesRemoved = false
+	assert.Contains(t, err.Error(), "kept in the manifest list, but not copied")
+}
+
+func TestImageBestEffortInstances(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// A manifest list with one valid instance, and one instance with a missing layer
+	srcDir := t.TempDir()
+	goodInstance := writeTestImage(t, srcDir, testImage{layers: numberedLayers(1), asInstance: true})
+	badInstance := writeTestImage(t, srcDir, testImage{layers: numberedLayers(2), asInstance: true})
+	badManifest, err := manifest.Schema2FromManifest(badInstance)
+	require.NoError(t, err)
+	err = os.Remove(filepath.Join(srcDir, badManifest.LayersDescriptors[1].Digest.Encoded()))
+	require.NoError(t, err)
+	list := writeTestList(t, srcDir, manifest.DockerV2ListMediaType, [][]byte{badInstance, goodInstance},
+		[]imgspecv1.Platform{{OS: "linux", Architecture: "arm64"}, {OS: "linux", Architecture: "amd64"}})
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+
+	copyTo := func(t *testing.T, options *Options) (string, []byte, error) {
+		destDir := t.TempDir()
+		destRef, err := directory.NewReference(destDir)
+		require.NoError(t, err)
+		res, err := Image(context.Background(), policyContext, destRef, srcRef, options)
+		return destDir, res, err
+	}
+	assertNoManifest := func(t *testing.T, destDir string) {
+		_, err := os.Stat(filepath.Join(destDir, "manifest.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+
+	// By default, the failure is fatal
+	destDir, res, err := copyTo(t, &Options{ImageListSelection: CopyAllImages})
+	assert.Error(t, err)
+	assert.Nil(t, res)
+	assertNoManifest(t, destDir)
+
+	// RemoveFailedInstances
+	destDir, res, err = copyTo(t, &Options{ImageListSelection: CopyAllImages, BestEffortInstances: true})
+	var partialErr PartialListCopyError
+	require.ErrorAs(t, err, &partialErr)
+	assert.True(t, partialErr.InstancesRemoved)
+	require.Len(t, partialErr.Failures, 1)
+	assert.Equal(t, digest.FromBytes(badInstance), partialErr.Failures[0].Digest)
+	written, err := os.ReadFile(filepath.Join(destDir, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, written, res)
+	writtenList, err := internalManifest.ListFromBlob(written, manifest.DockerV2ListMediaType)
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{digest.FromBytes(goodInstance)}, writtenList.Instances())
+	_, err = os.Stat(filepath.Join(destDir, digest.FromBytes(goodInstance).Encoded()+".manifest.json"))
+	assert.NoError(t, err)
+
+	// KeepFailedInstances
+	destDir, res, err = copyTo(t, &Options{
+		ImageListSelection:  CopyAllImages,
+		BestEffortInstances: true,
+		FailedInstances:     KeepFailedInstances,
+	})
+	require.ErrorAs(t, err, &partialErr)
+	assert.False(t, partialErr.InstancesRemoved)
+	require.Len(t, partialErr.Failures, 1)
+	assert.Equal(t, digest.FromBytes(badInstance), partialErr.Failures[0].Digest)
+	assert.Equal(t, list, res)
+	written, err = os.ReadFile(filepath.Join(destDir, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, list, written)
+
+	// If only failing instances are copied, the copy fails
+	destDir, res, err = copyTo(t, &Options{
+		ImageListSelection:  CopySpecificImages,
+		Instances:           []digest.Digest{digest.FromBytes(badInstance)},
+		BestEffortInstances: true,
+	})
+	assert.Error(t, err)
+	assert.Nil(t, res)
+	assertNoManifest(t, destDir)
+
+	// If all selected instances succeed, there is no error
+	_, res, err = copyTo(t, &Options{
+		ImageListSelection:  CopySpecificImages,
+		Instances:           []digest.Digest{digest.FromBytes(goodInstance)},
+		BestEffortInstances: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, list, res)
+
+	// Invalid values
+	_, _, err = copyTo(t, &Options{ImageListSelection: CopyAllImages, BestEffortInstances: true, FailedInstances: -1})
+	assert.Error(t, err)
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 
+	internalblobinfocache "github.com/containers/image/v5/internal/blobinfocache"
 	"github.com/containers/image/v5/internal/private"
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	"github.com/containers/image/v5/pkg/digestverify"
 	"github.com/containers/image/v5/types"
 	"github.com/sirupsen/logrus"
 )
@@ -15,10 +17,11 @@ import (
 // copyBlobFromStream copies a blob with srcInfo (with known Digest and Annotations and possibly known Size) from srcReader to dest,
 // perhaps sending a copy to an io.Writer if getOriginalLayerCopyWriter != nil,
 // perhaps (de/re/)compressing it if canModifyBlob,
-// and returns a complete blobInfo of the copied blob.
+// and returns a complete blobInfo of the copied blob, and the compressor name of the copied blob
+// (the Name() of a pkg/compression.Algorithm, or internalblobinfocache.Uncompressed or internalblobinfocache.UnknownCompression).
 func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Reader, srcInfo types.BlobInfo,
 	getOriginalLayerCopyWriter func(decompressor compressiontypes.DecompressorFunc) io.Writer,
-	isConfig bool, toEncrypt bool, bar *progressBar, layerIndex int, emptyLayer bool) (types.BlobInfo, error) {
+	isConfig bool, toEncrypt bool, bar *progressBar, layerIndex int, emptyLayer bool) (_ types.BlobInfo, _ string, retErr error) {
 	// The copying happens through a pipeline of connected io.Readers;
 	// that pipeline is built by updating stream.
 	// === Input: srcReader
@@ -26,18 +29,39 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 		reader: srcReader,
 		info:   srcInfo,
 	}
+	reportingProgress := ic.c.progressHandler != nil
+	var pipelineStats *blobPipelineStats
+	if reportingProgress {
+		pipelineStats = &blobPipelineStats{}
+		stream.reader = &sourceStatsReader{source: stream.reader, stats: pipelineStats}
+	}
 
-	// === Process input through digestingReader to validate against the expected digest.
-	// Be paranoid; in case PutBlob somehow managed to ignore an error from digestingReader,
+	// === Process input through digestverify.Reader to validate against the expected digest.
+	// Be paranoid; in case PutBlob somehow managed to ignore an error from verifyingReader,
 	// use a separate validation failure indicator.
-	// Note that for this check we don't use the stronger "validationSucceeded" indicator, because
+	// Note that for this check we don't use the stronger verifyingReader.Verified() indicator, because
 	// dest.PutBlob may detect that the layer already exists, in which case we don't
 	// read stream to the end, and validation does not happen.
-	digestingReader, err := newDigestingReader(stream.reader, srcInfo.Digest)
-	if err != nil {
-		return types.BlobInfo{}, fmt.Errorf("preparing to verify blob %s: %w", srcInfo.Digest, err)
+	// With Options.DeferredVerification, the data is instead verified in the background, and the result
+	// is only checked by c.deferredVerifications.verify() at the end of the copy.
+	var verifyingReader *digestverify.Reader
+	var deferredVerification *deferredBlobVerification
+	var err error
+	if ic.c.deferredVerifications != nil {
+		deferredVerification, err = ic.c.deferredVerifications.newBlobVerification(stream.reader, srcInfo)
+		if err != nil {
+			return types.BlobInfo{}, "", fmt.Errorf("preparing to verify blob %s: %w", srcInfo.Digest, err)
+		}
+		defer deferredVerification.stopFeeding()
+		stream.reader = deferredVerification
+	} else {
+		// The size is not verified: sources with slightly incorrect sizes in manifests have historically been accepted.
+		verifyingReader, err = digestverify.NewReader(stream.reader, srcInfo.Digest, -1)
+		if err != nil {
+			return types.BlobInfo{}, "", fmt.Errorf("preparing to verify blob %s: %w", srcInfo.Digest, err)
+		}
+		stream.reader = verifyingReader
 	}
-	stream.reader = digestingReader
 
 	// === Update progress bars
 	stream.reader = bar.ProxyReader(stream.reader)
@@ -45,14 +69,14 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 	// === Decrypt the stream, if required.
 	decryptionStep, err := ic.c.blobPipelineDecryptionStep(&stream, srcInfo)
 	if err != nil {
-		return types.BlobInfo{}, err
+		return types.BlobInfo{}, "", err
 	}
 
 	// === Detect compression of the input stream.
 	// This requires us to “peek ahead” into the stream to read the initial part, which requires us to chain through another io.Reader returned by DetectCompression.
 	detectedCompression, err := blobPipelineDetectCompressionStep(&stream, srcInfo)
 	if err != nil {
-		return types.BlobInfo{}, err
+		return types.BlobInfo{}, "", err
 	}
 
 	// === Send a copy of the original, uncompressed, stream, to a separate path if necessary.
@@ -68,7 +92,7 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 	// === Deal with layer compression/decompression if necessary
 	compressionStep, err := ic.blobPipelineCompressionStep(&stream, canModifyBlob, srcInfo, detectedCompression)
 	if err != nil {
-		return types.BlobInfo{}, err
+		return types.BlobInfo{}, "", err
 	}
 	defer compressionStep.close()
 
@@ -76,22 +100,35 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 	if decryptionStep.decrypting && toEncrypt {
 		// If nothing else, we can only set uploadedInfo.CryptoOperation to a single value.
 		// Before relaxing this, see the original pull request’s review if there are other reasons to reject this.
-		return types.BlobInfo{}, errors.New("Unable to support both decryption and encryption in the same copy")
+		return types.BlobInfo{}, "", errors.New("Unable to support both decryption and encryption in the same copy")
 	}
 	encryptionStep, err := ic.c.blobPipelineEncryptionStep(&stream, toEncrypt, srcInfo, decryptionStep)
 	if err != nil {
-		return types.BlobInfo{}, err
+		return types.BlobInfo{}, "", err
 	}
 
-	// === Report progress using the ic.c.progress channel, if required.
-	if ic.c.progress != nil && ic.c.progressInterval > 0 {
+	// === Report progress using ic.c.progressHandler, if required.
+	if reportingProgress {
+		window := ic.c.progressRateWindow
+		if window == 0 {
+			window = defaultProgressRateWindowIntervals * ic.c.progressInterval
+		}
+		progressLayerIndex := layerIndex
+		if isConfig {
+			progressLayerIndex = -1
+		}
 		progressReader := newProgressReader(
+			ctx,
 			stream.reader,
-			ic.c.progress,
+			ic.c.progressHandler,
 			ic.c.progressInterval,
+			window,
 			srcInfo,
+			progressLayerIndex,
+			pipelineStats,
+			ic.c.progressAggregate,
 		)
-		defer progressReader.reportDone()
+		defer func() { progressReader.reportDone(retErr) }()
 		stream.reader = progressReader
 	}
 
@@ -104,16 +141,22 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 	if !isConfig {
 		options.LayerIndex = &layerIndex
 	}
+	if ic.c.uploadSemaphore != nil {
+		if err := ic.c.uploadSemaphore.Acquire(ctx, 1); err != nil {
+			return types.BlobInfo{}, "", fmt.Errorf("acquiring semaphore for concurrent uploads: %w", err)
+		}
+		defer ic.c.uploadSemaphore.Release(1)
+	}
 	destBlob, err := ic.c.dest.PutBlobWithOptions(ctx, &errorAnnotationReader{stream.reader}, stream.info, options)
 	if err != nil {
-		return types.BlobInfo{}, fmt.Errorf("writing blob: %w", err)
+		return types.BlobInfo{}, "", fmt.Errorf("writing blob: %w", err)
 	}
 	uploadedInfo := updatedBlobInfoFromUpload(stream.info, destBlob)
 
 	compressionStep.updateCompressionEdits(&uploadedInfo.CompressionOperation, &uploadedInfo.CompressionAlgorithm, &uploadedInfo.Annotations)
 	decryptionStep.updateCryptoOperation(&uploadedInfo.CryptoOperation)
 	if err := encryptionStep.updateCryptoOperationAndAnnotations(&uploadedInfo.CryptoOperation, &uploadedInfo.Annotations); err != nil {
-		return types.BlobInfo{}, err
+		return types.BlobInfo{}, "", err
 	}
 
 	// This is fairly horrible: the writer from getOriginalLayerCopyWriter wants to consume
@@ -124,23 +167,38 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 		logrus.Debugf("Consuming rest of the original blob to satisfy getOriginalLayerCopyWriter")
 		_, err := io.Copy(io.Discard, originalLayerReader)
 		if err != nil {
-			return types.BlobInfo{}, fmt.Errorf("reading input blob %s: %w", srcInfo.Digest, err)
+			return types.BlobInfo{}, "", fmt.Errorf("reading input blob %s: %w", srcInfo.Digest, err)
 		}
 	}
 
-	if digestingReader.validationFailed { // Coverage: This should never happen.
-		return types.BlobInfo{}, fmt.Errorf("Internal error writing blob %s, digest verification failed but was ignored", srcInfo.Digest)
+	if verifyingReader != nil && verifyingReader.Failed() { // Coverage: This should never happen.
+		return types.BlobInfo{}, "", fmt.Errorf("Internal error writing blob %s, digest verification failed but was ignored", srcInfo.Digest)
 	}
 	if stream.info.Digest != "" && uploadedInfo.Digest != stream.info.Digest {
-		return types.BlobInfo{}, fmt.Errorf("Internal error writing blob %s, blob with digest %s saved with digest %s", srcInfo.Digest, stream.info.Digest, uploadedInfo.Digest)
+		if deferredVerification != nil {
+			// The destination has computed the digest of unverified data; if it does not match, the source data is the likely culprit.
+			deferredVerification.stopFeeding()
+			if err := deferredVerification.wait(); err != nil {
+				return types.BlobInfo{}, "", fmt.Errorf("verifying blob %s: %w", srcInfo.Digest, err)
+			}
+		}
+		return types.BlobInfo{}, "", fmt.Errorf("Internal error writing blob %s, blob with digest %s saved with digest %s", srcInfo.Digest, stream.info.Digest, uploadedInfo.Digest)
 	}
-	if digestingReader.validationSucceeded {
+	if deferredVerification != nil {
+		deferredVerification.onSuccess = func() error {
+			return compressionStep.recordValidatedDigestData(ic.c, uploadedInfo, srcInfo, encryptionStep, decryptionStep)
+		}
+	} else if verifyingReader.Verified() {
 		if err := compressionStep.recordValidatedDigestData(ic.c, uploadedInfo, srcInfo, encryptionStep, decryptionStep); err != nil {
-			return types.BlobInfo{}, err
+			return types.BlobInfo{}, "", err
 		}
 	}
 
-	return uploadedInfo, nil
+	uploadedCompressorName := compressionStep.uploadedCompressorName
+	if encryptionStep.encrypting {
+		uploadedCompressorName = internalblobinfocache.UnknownCompression
+	}
+	return uploadedInfo, uploadedCompressorName, nil
 }
 
 // sourceStream encapsulates an input consumed by copyBlobFromStream, in progress of being built.
@@ -1,14 +1,22 @@
 package copy
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/containers/image/v5/directory"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUpdatedBlobInfoFromUpload(t *testing.T) {
@@ -74,3 +82,145 @@ func TestUpdatedBlobInfoFromUpload(t *testing.T) {
 		assert.Equal(t, c.expected, res, fmt.Sprintf("%#v", c.uploaded))
 	}
 }
+
+// countingReference is a types.ImageReference whose sources allow concurrent GetBlob calls,
+// and whose destinations record the maximum number of concurrent PutBlob calls in maxUploads.
+type countingReference struct {
+	types.ImageReference
+	mutex      *sync.Mutex
+	uploads    *int
+	maxUploads *int
+}
+
+func (ref countingReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return threadSafeSource{ImageSource: src}, nil
+}
+
+func (ref countingReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return countingDestination{ImageDestination: dest, ref: ref}, nil
+}
+
+type threadSafeSource struct {
+	types.ImageSource
+}
+
+func (s threadSafeSource) HasThreadSafeGetBlob() bool {
+	return true // This is true for the dir: transport, which only reads separate files.
+}
+
+type countingDestination struct {
+	types.ImageDestination
+	ref countingReference
+}
+
+func (d countingDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	d.ref.mutex.Lock()
+	*d.ref.uploads++
+	if *d.ref.uploads > *d.ref.maxUploads {
+		*d.ref.maxUploads = *d.ref.uploads
+	}
+	d.ref.mutex.Unlock()
+	defer func() {
+		d.ref.mutex.Lock()
+		*d.ref.uploads--
+		d.ref.mutex.Unlock()
+	}()
+	time.Sleep(50 * time.Millisecond) // Give other uploads a chance to start.
+	return d.ImageDestination.PutBlob(ctx, stream, inputInfo, cache, isConfig)
+}
+
+func TestImageMaxParallelUploads(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	srcDir := t.TempDir()
+	manifestBlob := writeTestImage(t, srcDir, testImage{layers: numberedLayers(8)})
+	srcDirRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+
+	for _, limit := range []uint{1, 2, 3} {
+		destDirRef, err := directory.NewReference(t.TempDir())
+		require.NoError(t, err)
+		uploads, maxUploads := 0, 0
+		mutex := sync.Mutex{}
+		srcRef := countingReference{ImageReference: srcDirRef, mutex: &mutex, uploads: &uploads, maxUploads: &maxUploads}
+		destRef := countingReference{ImageReference: destDirRef, mutex: &mutex, uploads: &uploads, maxUploads: &maxUploads}
+		res, err := Image(context.Background(), policyContext, destRef, srcRef, &Options{MaxParallelUploads: limit})
+		require.NoError(t, err, limit)
+		assert.Equal(t, manifestBlob, res, limit)
+		assert.LessOrEqual(t, maxUploads, int(limit), limit)
+		assert.Positive(t, maxUploads, limit)
+	}
+}
+
+// incorrectSizeReference is a types.ImageReference whose sources report blob sizes which differ from the actual data,
+// and whose destinations don't verify blob sizes.
+type incorrectSizeReference struct {
+	types.ImageReference
+}
+
+func (ref incorrectSizeReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return incorrectSizeSource{ImageSource: src}, nil
+}
+
+func (ref incorrectSizeReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return sizeIgnoringDestination{ImageDestination: dest}, nil
+}
+
+type incorrectSizeSource struct {
+	types.ImageSource
+}
+
+func (s incorrectSizeSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	stream, size, err := s.ImageSource.GetBlob(ctx, info, cache)
+	if err != nil {
+		return nil, -1, err
+	}
+	return stream, size + 1, nil
+}
+
+type sizeIgnoringDestination struct {
+	types.ImageDestination
+}
+
+func (d sizeIgnoringDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	inputInfo.Size = -1
+	return d.ImageDestination.PutBlob(ctx, stream, inputInfo, cache, isConfig)
+}
+
+func TestImageIncorrectBlobSize(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	srcDir := t.TempDir()
+	writeTestImage(t, srcDir, testImage{layers: numberedLayers(2)})
+	srcDirRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	srcRef := incorrectSizeReference{ImageReference: srcDirRef}
+	manifestBlob, err := os.ReadFile(filepath.Join(srcDir, "manifest.json"))
+	require.NoError(t, err)
+
+	// Only the digests of blobs are verified, as they always have been; reported sizes are not enforced.
+	for _, deferred := range []bool{false, true} {
+		destDirRef, err := directory.NewReference(t.TempDir())
+		require.NoError(t, err)
+		destRef := incorrectSizeReference{ImageReference: destDirRef}
+		res, err := Image(context.Background(), policyContext, destRef, srcRef, &Options{DeferredVerification: deferred})
+		require.NoError(t, err, deferred)
+		assert.Equal(t, manifestBlob, res, deferred)
+	}
+}
@@ -0,0 +1,346 @@
+package copy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/private"
+	internalsig "github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/compression"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/containers/storage/pkg/ioutils"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/vbauerster/mpb/v8"
+)
+
+// Checkpoint records, in a file, which layers, and which instances of manifest lists (with their signatures),
+// have already been copied to which destinations, so that an interrupted copy, or an interrupted batch of copies
+// sharing a single Checkpoint, can be resumed without reading the completed layers and instances from the source again.
+//
+// A recorded layer is only used if the destination confirms that it still contains the recorded blob;
+// a recorded instance is only used if the destination still contains all blobs it refers to, and the source
+// is still allowed by the signature policy; the manifest and signatures of the instance are then written again.
+// Otherwise, the layer or instance is copied as usual. Top-level manifests and configs of single images are always copied again.
+// A Checkpoint should only be used to resume copies with the same options (notably, the same compression choices).
+// The checkpoint file is trusted to have been written by this package, and should be protected accordingly;
+// a file which can’t be parsed, or which uses an unknown format version, is ignored, resulting in a full copy.
+//
+// A Checkpoint may be shared by concurrent copy operations.
+type Checkpoint struct {
+	path  string
+	mutex sync.Mutex // Protects state and writes to path.
+	state checkpointState
+}
+
+// checkpointFormatVersion is the version of the checkpoint file format written by this code.
+// Files without a version were written before instances were recorded; their layer records are compatible.
+const checkpointFormatVersion = 1
+
+// checkpointState is the on-disk format of a Checkpoint.
+type checkpointState struct {
+	// Version is the format version, at most checkpointFormatVersion.
+	Version int `json:"version"`
+	// Destinations maps transports.ImageName() of a destination to the completed layers, indexed by their source digests.
+	Destinations map[string]map[digest.Digest]checkpointLayer `json:"destinations"`
+	// Instances maps transports.ImageName() of a destination to the completed instances of manifest lists,
+	// indexed by their source digests.
+	Instances map[string]map[digest.Digest]checkpointInstance `json:"instances,omitempty"`
+}
+
+// checkpointLayer records a layer which was copied to a destination.
+type checkpointLayer struct {
+	Digest               digest.Digest          `json:"digest"`
+	Size                 int64                  `json:"size"`
+	CompressionOperation types.LayerCompression `json:"compressionOperation,omitempty"`
+	CompressionAlgorithm string                 `json:"compressionAlgorithm,omitempty"`
+	DiffID               digest.Digest          `json:"diffID,omitempty"`
+}
+
+// checkpointInstance records an instance of a manifest list which was copied to a destination.
+type checkpointInstance struct {
+	Manifest []byte `json:"manifest"` // As written to the destination
+	MIMEType string `json:"mimeType"`
+	// Signatures, in the format of internal/signature.Blob, were written for SignaturesInstance.
+	Signatures         [][]byte      `json:"signatures,omitempty"`
+	SignaturesInstance digest.Digest `json:"signaturesInstance"`
+}
+
+// OpenCheckpoint returns a Checkpoint stored at path.
+// If path exists, the previously recorded progress is loaded; otherwise, path is created when the first layer or instance is recorded.
+// If path exists but is corrupted, or uses an unsupported format version, it is ignored (and eventually overwritten).
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	res := &Checkpoint{
+		path: path,
+		state: checkpointState{
+			Version:      checkpointFormatVersion,
+			Destinations: map[string]map[digest.Digest]checkpointLayer{},
+			Instances:    map[string]map[digest.Digest]checkpointInstance{},
+		},
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return res, nil
+		}
+		return nil, fmt.Errorf("reading checkpoint: %w", err)
+	}
+	var state checkpointState
+	if err := json.Unmarshal(contents, &state); err != nil {
+		logrus.Warnf("Ignoring corrupted checkpoint %q: %v", path, err)
+		return res, nil
+	}
+	if state.Version > checkpointFormatVersion {
+		logrus.Warnf("Ignoring checkpoint %q with unsupported format version %d", path, state.Version)
+		return res, nil
+	}
+	if state.Destinations != nil {
+		res.state.Destinations = state.Destinations
+	}
+	if state.Instances != nil {
+		res.state.Instances = state.Instances
+	}
+	return res, nil
+}
+
+// lookupLayer returns the layer with srcDigest recorded for dest, if any.
+func (c *Checkpoint) lookupLayer(dest types.ImageReference, srcDigest digest.Digest) (checkpointLayer, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	layer, ok := c.state.Destinations[transports.ImageName(dest)][srcDigest]
+	if ok {
+		if err := layer.Digest.Validate(); err != nil {
+			logrus.Debugf("Ignoring checkpoint entry for blob %s: %v", srcDigest, err)
+			return checkpointLayer{}, false
+		}
+	}
+	return layer, ok
+}
+
+// lookupInstance returns the instance with srcDigest recorded for dest, if any.
+func (c *Checkpoint) lookupInstance(dest types.ImageReference, srcDigest digest.Digest) (checkpointInstance, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	instance, ok := c.state.Instances[transports.ImageName(dest)][srcDigest]
+	return instance, ok
+}
+
+// recordLayer records that a layer with srcDigest was copied to dest as destInfo, with diffID (which may be ""),
+// and writes the updated state to the checkpoint file.
+func (c *Checkpoint) recordLayer(dest types.ImageReference, srcDigest digest.Digest, destInfo types.BlobInfo, diffID digest.Digest) error {
+	layer := checkpointLayer{
+		Digest:               destInfo.Digest,
+		Size:                 destInfo.Size,
+		CompressionOperation: destInfo.CompressionOperation,
+		DiffID:               diffID,
+	}
+	if destInfo.CompressionAlgorithm != nil {
+		layer.CompressionAlgorithm = destInfo.CompressionAlgorithm.Name()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	destName := transports.ImageName(dest)
+	layers := c.state.Destinations[destName]
+	if layers == nil {
+		layers = map[digest.Digest]checkpointLayer{}
+		c.state.Destinations[destName] = layers
+	}
+	if existing, ok := layers[srcDigest]; ok && existing == layer {
+		return nil
+	}
+	layers[srcDigest] = layer
+	return c.writeLocked()
+}
+
+// recordInstance records that an instance with srcDigest was copied to dest as manifest with mimeType,
+// and that sigs were written for sigsInstance; and writes the updated state to the checkpoint file.
+func (c *Checkpoint) recordInstance(dest types.ImageReference, srcDigest digest.Digest, manifest []byte, mimeType string,
+	sigs []internalsig.Signature, sigsInstance digest.Digest) error {
+	instance := checkpointInstance{
+		Manifest:           manifest,
+		MIMEType:           mimeType,
+		SignaturesInstance: sigsInstance,
+	}
+	for _, sig := range sigs {
+		blob, err := internalsig.Blob(sig)
+		if err != nil {
+			return fmt.Errorf("encoding signature for checkpoint: %w", err)
+		}
+		instance.Signatures = append(instance.Signatures, blob)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	destName := transports.ImageName(dest)
+	instances := c.state.Instances[destName]
+	if instances == nil {
+		instances = map[digest.Digest]checkpointInstance{}
+		c.state.Instances[destName] = instances
+	}
+	instances[srcDigest] = instance
+	return c.writeLocked()
+}
+
+// writeLocked writes the current state to the checkpoint file.
+// The caller must hold c.mutex.
+func (c *Checkpoint) writeLocked() error {
+	contents, err := json.Marshal(c.state)
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint: %w", err)
+	}
+	if err := ioutils.AtomicWriteFile(c.path, contents, 0o600); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// layerUsesCheckpoint returns true if a layer with srcInfo may be recorded in, and reused from, options.Checkpoint.
+// Layers which are encrypted or decrypted during the copy are never recorded; recording the outcome
+// would also require recording the encryption metadata.
+func (ic *imageCopier) layerUsesCheckpoint(srcInfo types.BlobInfo, toEncrypt bool) bool {
+	return ic.c.checkpoint != nil && !toEncrypt && !(isOciEncrypted(srcInfo.MediaType) && ic.c.ociDecryptConfig != nil)
+}
+
+// tryReusingCheckpointedLayer returns the blob info and DiffID of a layer with srcInfo, if it is recorded in the checkpoint
+// and the destination still contains the recorded blob.
+// diffIDIsNeeded is true if the caller requires the returned DiffID to be set.
+func (ic *imageCopier) tryReusingCheckpointedLayer(ctx context.Context, srcInfo types.BlobInfo, diffIDIsNeeded bool, pool *mpb.Progress, layerIndex int, emptyLayer bool) (bool, types.BlobInfo, digest.Digest, error) {
+	layer, ok := ic.c.checkpoint.lookupLayer(ic.c.dest.Reference(), srcInfo.Digest)
+	if !ok || (diffIDIsNeeded && layer.DiffID == "") {
+		return false, types.BlobInfo{}, "", nil
+	}
+	var algorithm *compressiontypes.Algorithm
+	if layer.CompressionAlgorithm != "" {
+		a, err := compression.AlgorithmByName(layer.CompressionAlgorithm)
+		if err != nil {
+			logrus.Debugf("Ignoring checkpoint entry for blob %s: %v", srcInfo.Digest, err)
+			return false, types.BlobInfo{}, "", nil
+		}
+		algorithm = &a
+	}
+	if required := ic.requiredLayerCompression(srcInfo, false); required != nil && (algorithm == nil || algorithm.Name() != required.Name()) {
+		logrus.Debugf("Ignoring checkpoint entry for blob %s, it is not compressed with the required %s", srcInfo.Digest, required.Name())
+		return false, types.BlobInfo{}, "", nil
+	}
+	reused, reusedBlob, err := ic.c.dest.TryReusingBlobWithOptions(ctx, types.BlobInfo{Digest: layer.Digest, Size: layer.Size}, private.TryReusingBlobOptions{
+		Cache:         ic.c.blobInfoCache,
+		CanSubstitute: false,
+		EmptyLayer:    emptyLayer,
+		LayerIndex:    &layerIndex,
+	})
+	if err != nil {
+		return false, types.BlobInfo{}, "", fmt.Errorf("trying to reuse checkpointed blob %s at destination: %w", layer.Digest, err)
+	}
+	if !reused || reusedBlob.Digest != layer.Digest {
+		logrus.Debugf("Checkpointed blob %s for %s is no longer present at the destination", layer.Digest, srcInfo.Digest)
+		return false, types.BlobInfo{}, "", nil
+	}
+	logrus.Debugf("Skipping blob %s (recorded in checkpoint as %s)", srcInfo.Digest, layer.Digest)
+	func() { // A scope for defer
+		bar := ic.c.createProgressBar(pool, false, types.BlobInfo{Digest: layer.Digest, Size: 0}, "blob", "skipped: already copied")
+		defer bar.Abort(false)
+		bar.mark100PercentComplete()
+	}()
+	ic.c.reportLayerSkipped(srcInfo, layerIndex, LayerSkippedCheckpointed)
+	return true, types.BlobInfo{
+		Digest:               layer.Digest,
+		Size:                 reusedBlob.Size,
+		Annotations:          srcInfo.Annotations,
+		MediaType:            srcInfo.MediaType,
+		CompressionOperation: layer.CompressionOperation,
+		CompressionAlgorithm: algorithm,
+	}, layer.DiffID, nil
+}
+
+// tryReusingCheckpointedInstance returns a manifest list update for the instance with instanceDigest, read from unparsedInstance,
+// if it is recorded in the checkpoint and the destination still contains all blobs the recorded manifest refers to.
+// In that case, the recorded manifest and signatures are written to the destination again, as copySingleImage would have done.
+func (c *copier) tryReusingCheckpointedInstance(ctx context.Context, policyContext *signature.PolicyContext, unparsedInstance *image.UnparsedImage,
+	instanceDigest digest.Digest) (bool, manifest.ListUpdate, error) {
+	instance, ok := c.checkpoint.lookupInstance(c.dest.Reference(), instanceDigest)
+	if !ok {
+		return false, manifest.ListUpdate{}, nil
+	}
+	m, err := manifest.FromBlob(instance.Manifest, instance.MIMEType)
+	if err != nil {
+		logrus.Debugf("Ignoring checkpoint entry for instance %s: %v", instanceDigest, err)
+		return false, manifest.ListUpdate{}, nil
+	}
+	destDigest, err := manifest.Digest(instance.Manifest)
+	if err != nil {
+		logrus.Debugf("Ignoring checkpoint entry for instance %s: %v", instanceDigest, err)
+		return false, manifest.ListUpdate{}, nil
+	}
+	if err := instance.SignaturesInstance.Validate(); err != nil {
+		logrus.Debugf("Ignoring checkpoint entry for instance %s: %v", instanceDigest, err)
+		return false, manifest.ListUpdate{}, nil
+	}
+	sigs := make([]internalsig.Signature, 0, len(instance.Signatures))
+	for _, blob := range instance.Signatures {
+		sig, err := internalsig.FromBlob(blob)
+		if err != nil {
+			logrus.Debugf("Ignoring checkpoint entry for instance %s: %v", instanceDigest, err)
+			return false, manifest.ListUpdate{}, nil
+		}
+		sigs = append(sigs, sig)
+	}
+
+	// Skipping the copy must not bypass the policy checks which the copy would have done.
+	if allowed, err := policyContext.IsRunningImageAllowed(ctx, unparsedInstance); !allowed || err != nil { // Be paranoid and fail if either return value indicates so.
+		return false, manifest.ListUpdate{}, fmt.Errorf("Source image rejected: %w", err)
+	}
+
+	// isPresent returns true if the destination contains blobInfo.
+	isPresent := func(blobInfo types.BlobInfo, options private.TryReusingBlobOptions) (bool, error) {
+		if err := blobInfo.Digest.Validate(); err != nil {
+			logrus.Debugf("Ignoring checkpoint entry for instance %s: %v", instanceDigest, err)
+			return false, nil
+		}
+		options.Cache = c.blobInfoCache
+		options.CanSubstitute = false
+		reused, reusedBlob, err := c.dest.TryReusingBlobWithOptions(ctx, types.BlobInfo{Digest: blobInfo.Digest, Size: blobInfo.Size}, options)
+		if err != nil {
+			return false, fmt.Errorf("trying to reuse blob %s of checkpointed instance %s at destination: %w", blobInfo.Digest, instanceDigest, err)
+		}
+		if !reused || reusedBlob.Digest != blobInfo.Digest {
+			logrus.Debugf("Blob %s of checkpointed instance %s is no longer present at the destination", blobInfo.Digest, instanceDigest)
+			return false, nil
+		}
+		return true, nil
+	}
+	if config := m.ConfigInfo(); config.Digest != "" {
+		if present, err := isPresent(config, private.TryReusingBlobOptions{}); !present || err != nil {
+			return false, manifest.ListUpdate{}, err
+		}
+	}
+	for i, layer := range m.LayerInfos() {
+		layerIndex := i
+		if present, err := isPresent(layer.BlobInfo, private.TryReusingBlobOptions{EmptyLayer: layer.EmptyLayer, LayerIndex: &layerIndex}); !present || err != nil {
+			return false, manifest.ListUpdate{}, err
+		}
+	}
+
+	logrus.Debugf("Skipping instance %s (recorded in checkpoint as %s)", instanceDigest, destDigest)
+	if err := c.dest.PutManifest(ctx, instance.Manifest, &destDigest); err != nil {
+		return false, manifest.ListUpdate{}, fmt.Errorf("writing checkpointed manifest %s: %w", destDigest, err)
+	}
+	if err := c.putSignatures(ctx, sigs, &instance.SignaturesInstance); err != nil {
+		return false, manifest.ListUpdate{}, fmt.Errorf("writing signatures: %w", err)
+	}
+	return true, manifest.ListUpdate{
+		Digest:    destDigest,
+		Size:      int64(len(instance.Manifest)),
+		MediaType: instance.MIMEType,
+	}, nil
+}
@@ -0,0 +1,238 @@
+package copy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	internalManifest "github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyCheckpoint(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// Create a source image with two uncompressed layers; the destination compresses them,
+	// so the destination digests differ from the source ones and the blob info cache is the only other way to find them.
+	srcDir := t.TempDir()
+	layers := [][]byte{[]byte("layer 1 contents"), []byte("layer 2 contents")}
+	writeTestImage(t, srcDir, testImage{manifestType: imgspecv1.MediaTypeImageManifest, layers: layers})
+	// setSourceLayer makes layer i available, or not, in the source.
+	setSourceLayer := func(i int, present bool) {
+		path := filepath.Join(srcDir, digest.FromBytes(layers[i]).Encoded())
+		if present {
+			err := os.WriteFile(path, layers[i], 0o644)
+			require.NoError(t, err)
+		} else {
+			err := os.Remove(path)
+			if !os.IsNotExist(err) {
+				require.NoError(t, err)
+			}
+		}
+	}
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	destDir := t.TempDir()
+	destRef, err := layout.NewReference(destDir, "latest")
+	require.NoError(t, err)
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	// copyWithCheckpoint runs a copy as a separate process would, with a freshly loaded checkpoint and an empty blob info cache.
+	copyWithCheckpoint := func() (*Checkpoint, error) {
+		checkpoint, err := OpenCheckpoint(checkpointPath)
+		require.NoError(t, err)
+		_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+			DestinationCtx: &types.SystemContext{BlobInfoCacheDir: t.TempDir()},
+			Checkpoint:     checkpoint,
+		})
+		return checkpoint, err
+	}
+
+	// The first copy is interrupted because the second layer is not available; the first layer is recorded.
+	setSourceLayer(0, true)
+	setSourceLayer(1, false)
+	_, err = copyWithCheckpoint()
+	require.Error(t, err)
+	checkpoint, err := OpenCheckpoint(checkpointPath)
+	require.NoError(t, err)
+	layer0, ok := checkpoint.lookupLayer(destRef, digest.FromBytes(layers[0]))
+	require.True(t, ok)
+	assert.NotEqual(t, digest.FromBytes(layers[0]), layer0.Digest)
+	assert.Equal(t, "gzip", layer0.CompressionAlgorithm)
+	_, ok = checkpoint.lookupLayer(destRef, digest.FromBytes(layers[1]))
+	assert.False(t, ok)
+
+	// Resuming does not read the completed layer from the source; without the checkpoint, that fails.
+	setSourceLayer(0, false)
+	setSourceLayer(1, true)
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		DestinationCtx: &types.SystemContext{BlobInfoCacheDir: t.TempDir()},
+	})
+	assert.Error(t, err)
+	checkpoint, err = copyWithCheckpoint()
+	require.NoError(t, err)
+	for _, layer := range layers {
+		_, ok := checkpoint.lookupLayer(destRef, digest.FromBytes(layer))
+		assert.True(t, ok)
+	}
+
+	// A recorded layer which is missing in the destination is copied again.
+	err = os.Remove(filepath.Join(destDir, "blobs", "sha256", layer0.Digest.Encoded()))
+	require.NoError(t, err)
+	_, err = copyWithCheckpoint()
+	assert.Error(t, err)
+	setSourceLayer(0, true)
+	_, err = copyWithCheckpoint()
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(destDir, "blobs", "sha256", layer0.Digest.Encoded()))
+	assert.NoError(t, err)
+
+	// A checkpoint without any recorded progress
+	checkpoint, err = OpenCheckpoint(filepath.Join(t.TempDir(), "this-does-not-exist"))
+	require.NoError(t, err)
+	_, ok = checkpoint.lookupLayer(destRef, digest.FromBytes(layers[0]))
+	assert.False(t, ok)
+
+	// Corrupted checkpoint files, or files in an unsupported format, are ignored.
+	for _, contents := range []string{
+		"this is invalid",
+		`{"version":999,"destinations":{}}`,
+	} {
+		invalidPath := filepath.Join(t.TempDir(), "invalid.json")
+		err = os.WriteFile(invalidPath, []byte(contents), 0o600)
+		require.NoError(t, err)
+		checkpoint, err = OpenCheckpoint(invalidPath)
+		require.NoError(t, err, contents)
+		_, ok = checkpoint.lookupLayer(destRef, digest.FromBytes(layers[0]))
+		assert.False(t, ok, contents)
+	}
+
+	// A checkpoint written before the format was versioned is still used.
+	legacyPath := filepath.Join(t.TempDir(), "legacy.json")
+	legacy, err := json.Marshal(map[string]any{
+		"destinations": map[string]any{
+			transports.ImageName(destRef): map[digest.Digest]checkpointLayer{digest.FromBytes(layers[0]): layer0},
+		},
+	})
+	require.NoError(t, err)
+	err = os.WriteFile(legacyPath, legacy, 0o600)
+	require.NoError(t, err)
+	checkpoint, err = OpenCheckpoint(legacyPath)
+	require.NoError(t, err)
+	legacyLayer0, ok := checkpoint.lookupLayer(destRef, digest.FromBytes(layers[0]))
+	require.True(t, ok)
+	assert.Equal(t, layer0, legacyLayer0)
+}
+
+func TestCopyCheckpointInstances(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// An OCI index with two instances
+	srcDir := t.TempDir()
+	instances := make([][]byte, 2)
+	for i := range instances {
+		instances[i] = writeTestImage(t, srcDir, testImage{layers: numberedLayers(i + 1), asInstance: true})
+	}
+	writeTestList(t, srcDir, imgspecv1.MediaTypeImageIndex, instances,
+		[]imgspecv1.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64"}})
+	// Remember the blobs of each instance, so that they can be made available, or not, in the source.
+	blobs := make([]map[string][]byte, len(instances))
+	for i := range instances {
+		m, err := manifest.Schema2FromManifest(instances[i])
+		require.NoError(t, err)
+		blobs[i] = map[string][]byte{}
+		for _, d := range append([]manifest.Schema2Descriptor{m.ConfigDescriptor}, m.LayersDescriptors...) {
+			path := filepath.Join(srcDir, d.Digest.Encoded())
+			contents, err := os.ReadFile(path)
+			require.NoError(t, err)
+			blobs[i][path] = contents
+		}
+	}
+	// setSourceBlobs makes all blobs of instance i available, or not, in the source.
+	setSourceBlobs := func(i int, present bool) {
+		for path, contents := range blobs[i] {
+			if present {
+				err := os.WriteFile(path, contents, 0o644)
+				require.NoError(t, err)
+			} else {
+				err := os.Remove(path)
+				if !os.IsNotExist(err) {
+					require.NoError(t, err)
+				}
+			}
+		}
+	}
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	destDir := t.TempDir()
+	destRef, err := layout.NewReference(destDir, "latest")
+	require.NoError(t, err)
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	// copyWithCheckpoint runs a copy as a separate process would, with a freshly loaded checkpoint and an empty blob info cache.
+	copyWithCheckpoint := func() (*Checkpoint, []byte, error) {
+		checkpoint, err := OpenCheckpoint(checkpointPath)
+		require.NoError(t, err)
+		res, err := Image(context.Background(), policyContext, destRef, srcRef, &Options{
+			ImageListSelection: CopyAllImages,
+			DestinationCtx:     &types.SystemContext{BlobInfoCacheDir: t.TempDir()},
+			Checkpoint:         checkpoint,
+		})
+		return checkpoint, res, err
+	}
+
+	// The first copy is interrupted because the second instance is not available; the first instance is recorded.
+	setSourceBlobs(1, false)
+	_, _, err = copyWithCheckpoint()
+	require.Error(t, err)
+	checkpoint, err := OpenCheckpoint(checkpointPath)
+	require.NoError(t, err)
+	instance0, ok := checkpoint.lookupInstance(destRef, digest.FromBytes(instances[0]))
+	require.True(t, ok)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, instance0.MIMEType) // Converted for the OCI destination
+	assert.Equal(t, digest.FromBytes(instance0.Manifest), instance0.SignaturesInstance)
+	_, ok = checkpoint.lookupInstance(destRef, digest.FromBytes(instances[1]))
+	assert.False(t, ok)
+
+	// Resuming does not read the completed instance from the source at all, not even its config.
+	setSourceBlobs(0, false)
+	setSourceBlobs(1, true)
+	checkpoint, res, err := copyWithCheckpoint()
+	require.NoError(t, err)
+	for _, instance := range instances {
+		_, ok := checkpoint.lookupInstance(destRef, digest.FromBytes(instance))
+		assert.True(t, ok)
+	}
+	writtenList, err := internalManifest.ListFromBlob(res, imgspecv1.MediaTypeImageIndex)
+	require.NoError(t, err)
+	writtenInstances := writtenList.Instances()
+	require.Len(t, writtenInstances, 2)
+	assert.Equal(t, digest.FromBytes(instance0.Manifest), writtenInstances[0])
+	for _, d := range writtenInstances {
+		_, err := os.Stat(filepath.Join(destDir, "blobs", "sha256", d.Encoded()))
+		assert.NoError(t, err)
+	}
+
+	// A recorded instance with a blob missing in the destination is copied again.
+	ociManifest, err := manifest.OCI1FromManifest(instance0.Manifest)
+	require.NoError(t, err)
+	err = os.Remove(filepath.Join(destDir, "blobs", "sha256", ociManifest.Config.Digest.Encoded()))
+	require.NoError(t, err)
+	_, _, err = copyWithCheckpoint()
+	assert.Error(t, err)
+	setSourceBlobs(0, true)
+	_, _, err = copyWithCheckpoint()
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(destDir, "blobs", "sha256", ociManifest.Config.Digest.Encoded()))
+	assert.NoError(t, err)
+}
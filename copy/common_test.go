@@ -0,0 +1,177 @@
+package copy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPolicyContext returns a PolicyContext enforcing requirements, or accepting anything if there are none.
+// The PolicyContext is destroyed when the test ends.
+func newTestPolicyContext(tb testing.TB, requirements ...signature.PolicyRequirement) *signature.PolicyContext {
+	if len(requirements) == 0 {
+		requirements = []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}
+	}
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{Default: requirements})
+	require.NoError(tb, err)
+	tb.Cleanup(func() {
+		err := policyContext.Destroy()
+		require.NoError(tb, err)
+	})
+	return policyContext
+}
+
+// testImage describes an image written by writeTestImage.
+type testImage struct {
+	manifestType     string              // manifest.DockerV2Schema2MediaType (the default) or imgspecv1.MediaTypeImageManifest
+	config           []byte              // If nil, a minimal config which differs for every number of layers
+	layers           [][]byte            // Contents of the layers
+	layerMediaTypes  []string            // If nil, the usual layer media type of manifestType; otherwise indexed like layers
+	layerAnnotations []map[string]string // OCI only; if set, indexed like layers
+	asInstance       bool                // Write the manifest as an instance of a manifest list, instead of as the top-level manifest
+}
+
+// numberedLayers returns numLayers distinct layers; layer i contains "layer i of numLayers".
+func numberedLayers(numLayers int) [][]byte {
+	res := make([][]byte, numLayers)
+	for i := range res {
+		res[i] = []byte(fmt.Sprintf("layer %d of %d", i, numLayers))
+	}
+	return res
+}
+
+// gzipCompressed returns contents compressed using gzip.
+func gzipCompressed(tb testing.TB, contents []byte) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	_, err := gzipWriter.Write(contents)
+	require.NoError(tb, err)
+	err = gzipWriter.Close()
+	require.NoError(tb, err)
+	return buf.Bytes()
+}
+
+// writeTestImage writes img to dir, which is used by the dir: transport, and returns its manifest.
+func writeTestImage(tb testing.TB, dir string, img testImage) []byte {
+	config := img.config
+	if config == nil {
+		config = []byte(fmt.Sprintf(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]},"comment":"%d layers"}`, len(img.layers)))
+	}
+	files := map[string][]byte{digest.FromBytes(config).Encoded(): config}
+	for _, layer := range img.layers {
+		files[digest.FromBytes(layer).Encoded()] = layer
+	}
+
+	var manifestBlob []byte
+	var err error
+	switch img.manifestType {
+	case "", manifest.DockerV2Schema2MediaType:
+		require.Nil(tb, img.layerAnnotations, "Layer annotations are not supported by docker schema2")
+		layers := []manifest.Schema2Descriptor{}
+		for i, layer := range img.layers {
+			layerMediaType := manifest.DockerV2Schema2LayerMediaType
+			if img.layerMediaTypes != nil {
+				layerMediaType = img.layerMediaTypes[i]
+			}
+			layers = append(layers, manifest.Schema2Descriptor{
+				MediaType: layerMediaType,
+				Digest:    digest.FromBytes(layer),
+				Size:      int64(len(layer)),
+			})
+		}
+		manifestBlob, err = manifest.Schema2FromComponents(manifest.Schema2Descriptor{
+			MediaType: manifest.DockerV2Schema2ConfigMediaType,
+			Digest:    digest.FromBytes(config),
+			Size:      int64(len(config)),
+		}, layers).Serialize()
+	case imgspecv1.MediaTypeImageManifest:
+		layers := []imgspecv1.Descriptor{}
+		for i, layer := range img.layers {
+			layerMediaType := imgspecv1.MediaTypeImageLayer
+			if img.layerMediaTypes != nil {
+				layerMediaType = img.layerMediaTypes[i]
+			}
+			d := imgspecv1.Descriptor{
+				MediaType: layerMediaType,
+				Digest:    digest.FromBytes(layer),
+				Size:      int64(len(layer)),
+			}
+			if img.layerAnnotations != nil {
+				d.Annotations = img.layerAnnotations[i]
+			}
+			layers = append(layers, d)
+		}
+		manifestBlob, err = manifest.OCI1FromComponents(imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageConfig,
+			Digest:    digest.FromBytes(config),
+			Size:      int64(len(config)),
+		}, layers).Serialize()
+	default:
+		require.FailNow(tb, "Unexpected manifest type", img.manifestType)
+	}
+	require.NoError(tb, err)
+	if img.asInstance {
+		files[digest.FromBytes(manifestBlob).Encoded()+".manifest.json"] = manifestBlob
+	} else {
+		files["manifest.json"] = manifestBlob
+	}
+	for path, contents := range files {
+		err := os.WriteFile(filepath.Join(dir, path), contents, 0o644)
+		require.NoError(tb, err)
+	}
+	return manifestBlob
+}
+
+// writeTestList writes a manifest list of listType (manifest.DockerV2ListMediaType or imgspecv1.MediaTypeImageIndex)
+// to dir, which is used by the dir: transport, and returns it. instances must have been written by writeTestImage
+// with asInstance set; instance i is used for platforms[i].
+func writeTestList(tb testing.TB, dir string, listType string, instances [][]byte, platforms []imgspecv1.Platform) []byte {
+	require.Len(tb, platforms, len(instances))
+	var list []byte
+	var err error
+	switch listType {
+	case manifest.DockerV2ListMediaType:
+		descriptors := []manifest.Schema2ManifestDescriptor{}
+		for i, instance := range instances {
+			descriptors = append(descriptors, manifest.Schema2ManifestDescriptor{
+				Schema2Descriptor: manifest.Schema2Descriptor{
+					MediaType: manifest.GuessMIMEType(instance),
+					Digest:    digest.FromBytes(instance),
+					Size:      int64(len(instance)),
+				},
+				Platform: manifest.Schema2PlatformSpec{
+					Architecture: platforms[i].Architecture,
+					OS:           platforms[i].OS,
+					Variant:      platforms[i].Variant,
+				},
+			})
+		}
+		list, err = manifest.Schema2ListFromComponents(descriptors).Serialize()
+	case imgspecv1.MediaTypeImageIndex:
+		descriptors := []imgspecv1.Descriptor{}
+		for i, instance := range instances {
+			descriptors = append(descriptors, imgspecv1.Descriptor{
+				MediaType: manifest.GuessMIMEType(instance),
+				Digest:    digest.FromBytes(instance),
+				Size:      int64(len(instance)),
+				Platform:  &platforms[i],
+			})
+		}
+		list, err = manifest.OCI1IndexFromComponents(descriptors, nil).Serialize()
+	default:
+		require.FailNow(tb, "Unexpected list type", listType)
+	}
+	require.NoError(tb, err)
+	err = os.WriteFile(filepath.Join(dir, "manifest.json"), list, 0o644)
+	require.NoError(tb, err)
+	return list
+}
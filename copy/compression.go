@@ -10,6 +10,7 @@ import (
 	"github.com/containers/image/v5/pkg/compression"
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/maps"
@@ -22,16 +23,30 @@ var (
 
 	// compressionBufferSize is the buffer size used to compress a blob
 	compressionBufferSize = 1048576
-
-	// expectedCompressionFormats is used to check if a blob with a specified media type is compressed
-	// using the algorithm that the media type says it should be compressed with
-	expectedCompressionFormats = map[string]*compressiontypes.Algorithm{
-		imgspecv1.MediaTypeImageLayerGzip:      &compression.Gzip,
-		imgspecv1.MediaTypeImageLayerZstd:      &compression.Zstd,
-		manifest.DockerV2Schema2LayerMediaType: &compression.Gzip,
-	}
 )
 
+// DestinationCompressionCapabilities describes the destination of a layer to a CompressionPolicy.
+type DestinationCompressionCapabilities struct {
+	// DesiredLayerCompression is the layer compression requested by the destination transport.
+	// The compression policy only affects layers compressed (or re-compressed) when this is types.Compress.
+	DesiredLayerCompression types.LayerCompression
+	// ManifestMIMEType is the manifest MIME type the copy is going to try first.
+	// Note that if the chosen algorithm is not supported by this manifest format (e.g. zstd and Docker schema2),
+	// the copy may convert the manifest to other formats supported by the destination.
+	ManifestMIMEType string
+	// SupportedManifestMIMETypes is the list of manifest MIME types supported by the destination, or nil if any type is supported.
+	SupportedManifestMIMETypes []string
+	// DefaultAlgorithm is the algorithm used if the policy does not choose one:
+	// Options.CompressionFormat or types.SystemContext.CompressionFormat from Options.DestinationCtx, or nil to use the default (gzip).
+	DefaultAlgorithm *compressiontypes.Algorithm
+}
+
+// CompressionPolicy chooses the compression algorithm for a layer with info (as described by the source),
+// which is going to be compressed for a destination described by dest.
+// It returns an algorithm and true to use that algorithm, or false to use dest.DefaultAlgorithm.
+// It may be called concurrently for different layers, and more than once for a single layer.
+type CompressionPolicy func(info types.BlobInfo, dest DestinationCompressionCapabilities) (compressiontypes.Algorithm, bool)
+
 // bpDetectCompressionStepData contains data that the copy pipeline needs about the “detect compression” step.
 type bpDetectCompressionStepData struct {
 	isCompressed      bool
@@ -62,7 +77,7 @@ func blobPipelineDetectCompressionStep(stream *sourceStream, srcInfo types.BlobI
 		res.srcCompressorName = internalblobinfocache.Uncompressed
 	}
 
-	if expectedFormat, known := expectedCompressionFormats[stream.info.MediaType]; known && res.isCompressed && format.Name() != expectedFormat.Name() {
+	if expectedFormat, known := manifest.CompressionFromMediaType(stream.info.MediaType); known && expectedFormat != nil && res.isCompressed && format.Name() != expectedFormat.Name() {
 		logrus.Debugf("blob %s with type %s should be compressed with %s, but compressor appears to be %s", srcInfo.Digest.String(), srcInfo.MediaType, expectedFormat.Name(), format.Name())
 	}
 	return res, nil
@@ -76,6 +91,8 @@ type bpCompressionStepData struct {
 	srcCompressorName      string                      // Compressor name to record in the blob info cache for the source blob.
 	uploadedCompressorName string                      // Compressor name to record in the blob info cache for the uploaded blob.
 	closers                []io.Closer                 // Objects to close after the upload is done, if any.
+	// If the blob is being recompressed, digester of the uncompressed data. WARNING: This is only valid after the srcStream.reader is fully consumed.
+	recompressedUncompressedDigester digest.Digester
 }
 
 // blobPipelineCompressionStep updates *stream to compress and/or decompress it.
@@ -91,13 +108,14 @@ func (ic *imageCopier) blobPipelineCompressionStep(stream *sourceStream, canModi
 		logrus.Debugf("Compression change for blob %s (%q) not supported", srcInfo.Digest, stream.info.MediaType)
 	}
 	if canModifyBlob && layerCompressionChangeSupported {
-		for _, fn := range []func(*sourceStream, bpDetectCompressionStepData) (*bpCompressionStepData, error){
+		compressionFormat := ic.layerCompressionFormat(srcInfo)
+		for _, fn := range []func(*sourceStream, bpDetectCompressionStepData, *compressiontypes.Algorithm) (*bpCompressionStepData, error){
 			ic.bpcPreserveEncrypted,
 			ic.bpcCompressUncompressed,
 			ic.bpcRecompressCompressed,
 			ic.bpcDecompressCompressed,
 		} {
-			res, err := fn(stream, detected)
+			res, err := fn(stream, detected, compressionFormat)
 			if err != nil {
 				return nil, err
 			}
@@ -109,8 +127,91 @@ func (ic *imageCopier) blobPipelineCompressionStep(stream *sourceStream, canModi
 	return ic.bpcPreserveOriginal(stream, detected, layerCompressionChangeSupported), nil
 }
 
+// layerCompressionFormat returns the compression algorithm to use if a layer with srcInfo is compressed, or nil to use defaultCompressionFormat.
+func (ic *imageCopier) layerCompressionFormat(srcInfo types.BlobInfo) *compressiontypes.Algorithm {
+	if ic.compressionPolicy == nil {
+		return ic.compressionFormat
+	}
+	algorithm, ok := ic.compressionPolicy(srcInfo, DestinationCompressionCapabilities{
+		DesiredLayerCompression:    ic.c.dest.DesiredLayerCompression(),
+		ManifestMIMEType:           ic.destManifestMIMEType(),
+		SupportedManifestMIMETypes: ic.c.dest.SupportedManifestMIMETypes(),
+		DefaultAlgorithm:           ic.compressionFormat,
+	})
+	if !ok {
+		return ic.compressionFormat
+	}
+	logrus.Debugf("Compression policy chose %s for blob %s", algorithm.Name(), srcInfo.Digest)
+	return &algorithm
+}
+
+// requiredCompression returns the compression algorithm that layers the destination wants compressed must use,
+// or nil if the compression is not forced.
+func (ic *imageCopier) requiredCompression() *compressiontypes.Algorithm {
+	if !ic.forceCompressionFormat || ic.c.dest.DesiredLayerCompression() != types.Compress {
+		return nil
+	}
+	return ic.compressionFormat
+}
+
+// requiredLayerCompression returns the compression algorithm that a layer with srcInfo must end up compressed with,
+// or nil if any compression is acceptable.
+// toEncrypt should be true if the layer is going to be encrypted; encrypted layers are exempt.
+func (ic *imageCopier) requiredLayerCompression(srcInfo types.BlobInfo, toEncrypt bool) *compressiontypes.Algorithm {
+	if toEncrypt || isOciEncrypted(srcInfo.MediaType) || !ic.src.CanChangeLayerCompression(srcInfo.MediaType) {
+		return nil
+	}
+	return ic.requiredCompression()
+}
+
+// destManifestMIMEType returns the manifest MIME type the copy is going to try first.
+func (ic *imageCopier) destManifestMIMEType() string {
+	if ic.manifestUpdates.ManifestMIMEType != "" {
+		return ic.manifestUpdates.ManifestMIMEType
+	}
+	return ic.src.ManifestMIMEType
+}
+
+// manifestMIMETypeSupportsCompression returns true if a manifest of manifestMIMEType can refer to layers compressed with algorithm.
+func manifestMIMETypeSupportsCompression(manifestMIMEType string, algorithm compressiontypes.Algorithm) bool {
+	if manifestMIMEType == imgspecv1.MediaTypeImageManifest {
+		return true
+	}
+	// Docker schema1 and schema2 only support gzip-compressed layers.
+	return algorithm.Name() == compressiontypes.GzipAlgorithmName
+}
+
+// preferredCompressionVariant returns a variant of the layer with srcInfo which is compressed with the algorithm
+// the layer would be compressed with, if the blob info cache knows about one which differs from srcInfo.
+func (ic *imageCopier) preferredCompressionVariant(srcInfo types.BlobInfo) (internalblobinfocache.BICCompressionVariant, bool) {
+	if ic.c.dest.DesiredLayerCompression() != types.Compress {
+		return internalblobinfocache.BICCompressionVariant{}, false
+	}
+	uncompressedDigest := ic.c.blobInfoCache.UncompressedDigest(srcInfo.Digest)
+	if uncompressedDigest == "" {
+		return internalblobinfocache.BICCompressionVariant{}, false
+	}
+	variants := ic.c.blobInfoCache.CompressionVariants(uncompressedDigest)
+	if len(variants) == 0 || (len(variants) == 1 && variants[0].Digest == srcInfo.Digest) {
+		return internalblobinfocache.BICCompressionVariant{}, false // Don’t bother consulting ic.compressionPolicy.
+	}
+	algorithm := ic.layerCompressionFormat(srcInfo)
+	if algorithm == nil || !manifestMIMETypeSupportsCompression(ic.destManifestMIMEType(), *algorithm) {
+		return internalblobinfocache.BICCompressionVariant{}, false
+	}
+	for _, variant := range variants {
+		if variant.CompressorName == algorithm.Name() {
+			if variant.Digest == srcInfo.Digest {
+				break // The source already uses the preferred compression.
+			}
+			return variant, true
+		}
+	}
+	return internalblobinfocache.BICCompressionVariant{}, false
+}
+
 // bpcPreserveEncrypted checks if the input is encrypted, and returns a *bpCompressionStepData if so.
-func (ic *imageCopier) bpcPreserveEncrypted(stream *sourceStream, _ bpDetectCompressionStepData) (*bpCompressionStepData, error) {
+func (ic *imageCopier) bpcPreserveEncrypted(stream *sourceStream, _ bpDetectCompressionStepData, _ *compressiontypes.Algorithm) (*bpCompressionStepData, error) {
 	if isOciEncrypted(stream.info.MediaType) {
 		logrus.Debugf("Using original blob without modification for encrypted blob")
 		// PreserveOriginal due to any compression not being able to be done on an encrypted blob unless decrypted
@@ -125,12 +226,13 @@ func (ic *imageCopier) bpcPreserveEncrypted(stream *sourceStream, _ bpDetectComp
 }
 
 // bpcCompressUncompressed checks if we should be compressing an uncompressed input, and returns a *bpCompressionStepData if so.
-func (ic *imageCopier) bpcCompressUncompressed(stream *sourceStream, detected bpDetectCompressionStepData) (*bpCompressionStepData, error) {
+// compressionFormat is the algorithm to use, or nil to use defaultCompressionFormat.
+func (ic *imageCopier) bpcCompressUncompressed(stream *sourceStream, detected bpDetectCompressionStepData, compressionFormat *compressiontypes.Algorithm) (*bpCompressionStepData, error) {
 	if ic.c.dest.DesiredLayerCompression() == types.Compress && !detected.isCompressed {
 		logrus.Debugf("Compressing blob on the fly")
 		var uploadedAlgorithm *compressiontypes.Algorithm
-		if ic.compressionFormat != nil {
-			uploadedAlgorithm = ic.compressionFormat
+		if compressionFormat != nil {
+			uploadedAlgorithm = compressionFormat
 		} else {
 			uploadedAlgorithm = defaultCompressionFormat
 		}
@@ -155,9 +257,10 @@ func (ic *imageCopier) bpcCompressUncompressed(stream *sourceStream, detected bp
 }
 
 // bpcRecompressCompressed checks if we should be recompressing a compressed input to another format, and returns a *bpCompressionStepData if so.
-func (ic *imageCopier) bpcRecompressCompressed(stream *sourceStream, detected bpDetectCompressionStepData) (*bpCompressionStepData, error) {
+// compressionFormat is the desired algorithm, or nil if any algorithm is acceptable.
+func (ic *imageCopier) bpcRecompressCompressed(stream *sourceStream, detected bpDetectCompressionStepData, compressionFormat *compressiontypes.Algorithm) (*bpCompressionStepData, error) {
 	if ic.c.dest.DesiredLayerCompression() == types.Compress && detected.isCompressed &&
-		ic.compressionFormat != nil && ic.compressionFormat.Name() != detected.format.Name() {
+		compressionFormat != nil && compressionFormat.Name() != detected.format.Name() {
 		// When the blob is compressed, but the desired format is different, it first needs to be decompressed and finally
 		// re-compressed using the desired format.
 		logrus.Debugf("Blob will be converted")
@@ -173,7 +276,8 @@ func (ic *imageCopier) bpcRecompressCompressed(stream *sourceStream, detected bp
 			}
 		}()
 
-		recompressed, annotations := ic.compressedStream(decompressed, *ic.compressionFormat)
+		uncompressedDigester := digest.Canonical.Digester()
+		recompressed, annotations := ic.compressedStream(io.TeeReader(decompressed, uncompressedDigester.Hash()), *compressionFormat)
 		// Note: recompressed must be closed on all return paths.
 		stream.reader = recompressed
 		stream.info = types.BlobInfo{ // FIXME? Should we preserve more data in src.info? Notably the current approach correctly removes zstd:chunked metadata annotations.
@@ -183,18 +287,20 @@ func (ic *imageCopier) bpcRecompressCompressed(stream *sourceStream, detected bp
 		succeeded = true
 		return &bpCompressionStepData{
 			operation:              types.PreserveOriginal,
-			uploadedAlgorithm:      ic.compressionFormat,
+			uploadedAlgorithm:      compressionFormat,
 			uploadedAnnotations:    annotations,
 			srcCompressorName:      detected.srcCompressorName,
-			uploadedCompressorName: ic.compressionFormat.Name(),
-			closers:                []io.Closer{decompressed, recompressed},
+			uploadedCompressorName: compressionFormat.Name(),
+			closers:                []io.Closer{recompressed, decompressed}, // recompressed first, so that the compression goroutine no longer reads from decompressed
+
+			recompressedUncompressedDigester: uncompressedDigester,
 		}, nil
 	}
 	return nil, nil
 }
 
 // bpcDecompressCompressed checks if we should be decompressing a compressed input, and returns a *bpCompressionStepData if so.
-func (ic *imageCopier) bpcDecompressCompressed(stream *sourceStream, detected bpDetectCompressionStepData) (*bpCompressionStepData, error) {
+func (ic *imageCopier) bpcDecompressCompressed(stream *sourceStream, detected bpDetectCompressionStepData, _ *compressiontypes.Algorithm) (*bpCompressionStepData, error) {
 	if ic.c.dest.DesiredLayerCompression() == types.Decompress && detected.isCompressed {
 		logrus.Debugf("Blob will be decompressed")
 		s, err := detected.decompressor(stream.reader)
@@ -269,12 +375,18 @@ func (d *bpCompressionStepData) recordValidatedDigestData(c *copier, uploadedInf
 	// and the simplicity is attractive.
 	if !encryptionStep.encrypting && !decryptionStep.decrypting {
 		// If d.operation != types.PreserveOriginal, we now have two reliable digest values:
-		// srcinfo.Digest describes the pre-d.operation input, verified by digestingReader
+		// srcinfo.Digest describes the pre-d.operation input, verified by digestverify.Reader
 		// uploadedInfo.Digest describes the post-d.operation output, computed by PutBlob
 		// (because stream.info.Digest == "", this must have been computed afresh).
 		switch d.operation {
 		case types.PreserveOriginal:
-			break // Do nothing, we have only one digest and we might not have even verified it.
+			// If the blob was recompressed, we have computed the uncompressed digest while decompressing the verified input;
+			// otherwise, we have only one digest and we might not have even verified it.
+			if d.recompressedUncompressedDigester != nil {
+				uncompressedDigest := d.recompressedUncompressedDigester.Digest()
+				c.blobInfoCache.RecordDigestUncompressedPair(srcInfo.Digest, uncompressedDigest)
+				c.blobInfoCache.RecordDigestUncompressedPair(uploadedInfo.Digest, uncompressedDigest)
+			}
 		case types.Compress:
 			c.blobInfoCache.RecordDigestUncompressedPair(uploadedInfo.Digest, srcInfo.Digest)
 		case types.Decompress:
@@ -318,7 +430,9 @@ func doCompression(dest io.Writer, src io.Reader, metadata map[string]string, co
 }
 
 // compressGoroutine reads all input from src and writes its compressed equivalent to dest.
-func (ic *imageCopier) compressGoroutine(dest *io.PipeWriter, src io.Reader, metadata map[string]string, compressionFormat compressiontypes.Algorithm) {
+// It closes finished when it exits.
+func (ic *imageCopier) compressGoroutine(dest *io.PipeWriter, src io.Reader, metadata map[string]string, compressionFormat compressiontypes.Algorithm, finished chan<- struct{}) {
+	defer close(finished)
 	err := errors.New("Internal error: unexpected panic in compressGoroutine")
 	defer func() { // Note that this is not the same as {defer dest.CloseWithError(err)}; we need err to be evaluated lazily.
 		_ = dest.CloseWithError(err) // CloseWithError(nil) is equivalent to Close(), always returns nil
@@ -327,15 +441,30 @@ func (ic *imageCopier) compressGoroutine(dest *io.PipeWriter, src io.Reader, met
 	err = doCompression(dest, src, metadata, compressionFormat, ic.compressionLevel)
 }
 
+// compressedStreamReader is the stream returned by compressedStream.
+type compressedStreamReader struct {
+	*io.PipeReader
+	finished <-chan struct{} // Closed when the compression goroutine exits
+}
+
+// Close closes the stream, and waits for the compression goroutine to exit.
+// After this returns, the goroutine no longer reads from the input reader, so the caller can close it.
+func (r compressedStreamReader) Close() error {
+	err := r.PipeReader.Close()
+	<-r.finished
+	return err
+}
+
 // compressedStream returns a stream the input reader compressed using format, and a metadata map.
 // The caller must close the returned reader.
 // AFTER the stream is consumed, metadata will be updated with annotations to use on the data.
 func (ic *imageCopier) compressedStream(reader io.Reader, algorithm compressiontypes.Algorithm) (io.ReadCloser, map[string]string) {
 	pipeReader, pipeWriter := io.Pipe()
 	annotations := map[string]string{}
+	finished := make(chan struct{})
 	// If this fails while writing data, it will do pipeWriter.CloseWithError(); if it fails otherwise,
-	// e.g. because we have exited and due to pipeReader.Close() above further writing to the pipe has failed,
-	// we don’t care.
-	go ic.compressGoroutine(pipeWriter, reader, annotations, algorithm) // Closes pipeWriter
-	return pipeReader, annotations
+	// e.g. because we have exited and due to pipeReader.Close() in compressedStreamReader.Close further writing
+	// to the pipe has failed, we don’t care.
+	go ic.compressGoroutine(pipeWriter, reader, annotations, algorithm, finished) // Closes pipeWriter and finished
+	return compressedStreamReader{PipeReader: pipeReader, finished: finished}, annotations
 }
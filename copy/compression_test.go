@@ -0,0 +1,109 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/compression"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionPolicy(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// A source image with a small and a large uncompressed layer.
+	smallLayer := []byte("small layer contents")
+	largeLayer := make([]byte, 1024*1024)
+	_, err := rand.New(rand.NewSource(0)).Read(largeLayer)
+	require.NoError(t, err)
+	diffIDs := []digest.Digest{digest.FromBytes(smallLayer), digest.FromBytes(largeLayer)}
+	config, err := json.Marshal(imgspecv1.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       imgspecv1.RootFS{Type: "layers", DiffIDs: diffIDs},
+	})
+	require.NoError(t, err)
+	srcDir := t.TempDir()
+	writeTestImage(t, srcDir, testImage{
+		manifestType: imgspecv1.MediaTypeImageManifest,
+		config:       config,
+		layers:       [][]byte{smallLayer, largeLayer},
+	})
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+
+	// A policy which uses zstd only for large layers.
+	var mutex sync.Mutex
+	var seenDests []DestinationCompressionCapabilities
+	policy := func(info types.BlobInfo, dest DestinationCompressionCapabilities) (compressiontypes.Algorithm, bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		seenDests = append(seenDests, dest)
+		if info.Size >= 512*1024 {
+			return compression.Zstd, true
+		}
+		return compressiontypes.Algorithm{}, false
+	}
+
+	destDir := t.TempDir()
+	destRef, err := layout.NewReference(destDir, "latest")
+	require.NoError(t, err)
+	report := &LayerReport{}
+	copiedManifest, err := Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		DestinationCtx:    &types.SystemContext{BlobInfoCacheDir: t.TempDir()},
+		CompressionPolicy: policy,
+		LayerReport:       report,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, seenDests, 2)
+	for _, dest := range seenDests {
+		assert.Equal(t, types.Compress, dest.DesiredLayerCompression)
+		assert.Equal(t, imgspecv1.MediaTypeImageManifest, dest.ManifestMIMEType)
+		assert.Nil(t, dest.DefaultAlgorithm)
+	}
+
+	images := report.Images()
+	require.Len(t, images, 1)
+	require.Len(t, images[0].Layers, 2)
+	assert.Equal(t, "gzip", algorithmName(images[0].Layers[0].CompressionAlgorithm))
+	assert.Equal(t, "zstd", algorithmName(images[0].Layers[1].CompressionAlgorithm))
+	copied, err := manifest.OCI1FromManifest(copiedManifest)
+	require.NoError(t, err)
+	require.Len(t, copied.Layers, 2)
+	assert.Equal(t, imgspecv1.MediaTypeImageLayerGzip, copied.Layers[0].MediaType)
+	assert.Equal(t, imgspecv1.MediaTypeImageLayerZstd, copied.Layers[1].MediaType)
+
+	// The diffIDs are the same regardless of the chosen algorithm.
+	for i, layer := range copied.Layers {
+		blob, err := os.ReadFile(filepath.Join(destDir, "blobs", layer.Digest.Algorithm().String(), layer.Digest.Encoded()))
+		require.NoError(t, err)
+		_, decompressor, _, err := compression.DetectCompressionFormat(bytes.NewReader(blob))
+		require.NoError(t, err)
+		require.NotNil(t, decompressor)
+		uncompressed, err := decompressor(bytes.NewReader(blob))
+		require.NoError(t, err)
+		contents, err := io.ReadAll(uncompressed)
+		require.NoError(t, err)
+		uncompressed.Close()
+		assert.Equal(t, diffIDs[i], digest.FromBytes(contents), i)
+	}
+	copiedConfig, err := os.ReadFile(filepath.Join(destDir, "blobs", copied.Config.Digest.Algorithm().String(), copied.Config.Digest.Encoded()))
+	require.NoError(t, err)
+	assert.Equal(t, config, copiedConfig)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/containers/image/v5/docker/reference"
@@ -15,14 +16,18 @@ import (
 	"github.com/containers/image/v5/internal/imagesource"
 	internalManifest "github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/set"
+	internalsig "github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/signature/signer"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	encconfig "github.com/containers/ocicrypt/config"
 	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/slices"
 	"golang.org/x/sync/semaphore"
@@ -60,18 +65,34 @@ const (
 	// only accept one image (i.e., it cannot accept lists), an error
 	// should be returned.
 	CopySpecificImages
+	// CopyMatchingImages is a value which, when set in
+	// Options.ImageListSelection, indicates that the caller expects the
+	// source reference to be either a single image or a list of images,
+	// and if the source reference is a list, wants only the instances
+	// matching at least one of Options.Platforms copied, along with the
+	// list itself, modified to contain only those instances.  If no
+	// instance matches, or the target reference can only accept one image
+	// (i.e., it cannot accept lists), an error should be returned.
+	CopyMatchingImages
 )
 
-// ImageListSelection is one of CopySystemImage, CopyAllImages, or
-// CopySpecificImages, to control whether, when the source reference is a list,
-// copy.Image() copies only an image which matches the current runtime
-// environment, or all images which match the supplied reference, or only
-// specific images from the source reference.
+// ImageListSelection is one of CopySystemImage, CopyAllImages,
+// CopySpecificImages, or CopyMatchingImages, to control whether, when the
+// source reference is a list, copy.Image() copies only an image which matches
+// the current runtime environment, or all images which match the supplied
+// reference, or only specific images from the source reference, or only
+// images for specific platforms.
 type ImageListSelection int
 
 // Options allows supplying non-default configuration modifying the behavior of CopyImage.
 type Options struct {
 	RemoveSignatures bool // Remove any pre-existing signatures. Signers and SignBy… will still add a new signature.
+	// If VerifySourceSignatures is set, every pre-existing signature is evaluated against the policy requirements of policyContext,
+	// and only signatures accepted by at least one of them are copied; the other ones are dropped, and recorded in DroppedSignatures.
+	// Note that this drops all signatures if no applicable policy requirement deals with signatures (e.g. with insecureAcceptAnything).
+	VerifySourceSignatures bool
+	// If DroppedSignatures is set, signatures dropped because of VerifySourceSignatures are recorded in it; see DroppedSignatureReport.
+	DroppedSignatures *DroppedSignatureReport
 	// Signers to use to add signatures during the copy.
 	// Callers are still responsible for closing these Signer objects; they can be reused for multiple copy.Image operations in a row.
 	Signers                          []*signer.Signer
@@ -80,25 +101,57 @@ type Options struct {
 	SignBySigstorePrivateKeyFile     string          // If non-empty, asks for a signature to be added during the copy, using a sigstore private key file at the provided path.
 	SignSigstorePrivateKeyPassphrase []byte          // Passphrase to use when signing with `SignBySigstorePrivateKeyFile`.
 	SignIdentity                     reference.Named // Identify to use when signing, defaults to the docker reference of the destination
+	// If SignatureStorageMethod is set, signatures are stored in the destination using only that method, and the copy fails
+	// if the destination does not support it, or if it can not store signatures of some format being copied.
+	// By default, destinations which support several methods store each signature format using the most preferred method
+	// the destination supports.
+	SignatureStorageMethod types.SignatureStorageMethod
 
 	ReportWriter     io.Writer
 	SourceCtx        *types.SystemContext
 	DestinationCtx   *types.SystemContext
 	ProgressInterval time.Duration                 // time to wait between reports to signal the progress channel
 	Progress         chan types.ProgressProperties // Reported to when ProgressInterval has arrived for a single artifact+offset.
+	// ProgressRateWindow is the window of the exponentially weighted moving average used to smooth rates reported to Progress.
+	// Defaults to 5 × ProgressInterval if not set.
+	ProgressRateWindow time.Duration
+	// ProgressHandler, if set, receives detailed progress events (per-layer byte counts, skipped layers, and the config
+	// and manifests being written), in addition to any events sent to Progress.
+	// LayerBytesTransferred events are sent every ProgressInterval, or every second if ProgressInterval is not set.
+	ProgressHandler ProgressHandler
 
 	// Preserve digests, and fail if we cannot.
 	PreserveDigests bool
 	// manifest MIME type of image set by user. "" is default and means use the autodetection to the manifest MIME type
 	ForceManifestMIMEType string
-	ImageListSelection    ImageListSelection // set to either CopySystemImage (the default), CopyAllImages, or CopySpecificImages to control which instances we copy when the source reference is a list; ignored if the source reference is not a list
+	ImageListSelection    ImageListSelection // set to either CopySystemImage (the default), CopyAllImages, CopySpecificImages, or CopyMatchingImages to control which instances we copy when the source reference is a list; ignored if the source reference is not a list
 	Instances             []digest.Digest    // if ImageListSelection is CopySpecificImages, copy only these instances and the list itself
+	// If ImageListSelection is CopyMatchingImages, copy only the instances matching at least one of Platforms, and the list
+	// with only those instances. Each platform must specify at least an OS and an architecture; variants and OS versions match
+	// using the same compatibility rules as choosing an image with CopySystemImage (e.g. arm/v7 matches instances with
+	// variants v7, v6 or v5, or without a variant), and a platform without a variant matches any variant.
+	Platforms []imgspecv1.Platform
+	// If BestEffortInstances is set, a failure to copy an instance of a list (with CopyAllImages, CopySpecificImages or CopyMatchingImages)
+	// does not stop the copy: the remaining instances are copied, the list is written as specified by FailedInstances,
+	// and copy.Image returns the written list together with a PartialListCopyError describing the failures.
+	// If no instance could be copied, or if the copy is canceled, copy.Image fails without writing the list.
+	// By default, the first failure to copy an instance fails the whole copy.
+	BestEffortInstances bool
+	FailedInstances     FailedInstanceHandling // set to either RemoveFailedInstances (the default) or KeepFailedInstances; only used with BestEffortInstances
 	// Give priority to pulling gzip images if multiple images are present when configured to OptionalBoolTrue,
 	// prefers the best compression if this is configured as OptionalBoolFalse. Choose automatically (and the choice may change over time)
 	// if this is set to OptionalBoolUndefined (which is the default behavior, and recommended for most callers).
 	// This only affects CopySystemImage.
 	PreferGzipInstances types.OptionalBool
 
+	// If ForceIndex is set, a single image (either a non-list source, or the instance chosen from a list with CopySystemImage)
+	// is written as the only instance of a newly created OCI index, and the index becomes the top-level manifest of the destination.
+	// Lists copied with CopyAllImages, CopySpecificImages or CopyMatchingImages are not affected, so copying such an index again does not nest indexes.
+	ForceIndex bool
+	// If ForceIndex is set, signatures created during the copy are, by default, created both for the index
+	// and (consistently with copying lists) for the image manifest. With ForceIndexSignInstanceOnly, only the image manifest is signed.
+	ForceIndexSignInstanceOnly bool
+
 	// If OciEncryptConfig is non-nil, it indicates that an image should be encrypted.
 	// The encryption options is derived from the construction of EncryptConfig object.
 	OciEncryptConfig *encconfig.EncryptConfig
@@ -117,6 +170,19 @@ type Options struct {
 
 	// MaxParallelDownloads indicates the maximum layers to pull at the same time. Applies to a single copy operation. A reasonable default is used if this is left as 0. Ignored if ConcurrentBlobCopiesSemaphore is set.
 	MaxParallelDownloads uint
+	// MaxParallelUploads indicates the maximum number of blobs written to the destination at the same time. Applies to a single copy operation.
+	// If 0, only the limits on concurrent blob copies (MaxParallelDownloads or ConcurrentBlobCopiesSemaphore) apply.
+	// See also types.SystemContext.DockerRegistryMaxParallelUploads for a limit shared by all copies in the process.
+	MaxParallelUploads uint
+
+	// If PrecheckBlobReuse is set, before copying the layers of an image, the destination is asked whether it can reuse
+	// each of the layers, for all layers concurrently (at most MaxParallelReuseChecks at a time), instead of asking just before
+	// copying each layer; the layer copies then use the results. This reduces latency on high-latency links, notably
+	// if there are many more layers than MaxParallelDownloads. Rate-limited requests are retried as usual by the destination.
+	PrecheckBlobReuse bool
+	// MaxParallelReuseChecks is the maximum number of concurrent checks with PrecheckBlobReuse, within a single image.
+	// A reasonable default is used if this is left as 0.
+	MaxParallelReuseChecks uint
 
 	// When OptimizeDestinationImageAlreadyExists is set, optimize the copy assuming that the destination image already
 	// exists (and is equivalent). Making the eventual (no-op) copy more performant for this case. Enabling the option
@@ -126,6 +192,99 @@ type Options struct {
 	// Download layer contents with "nondistributable" media types ("foreign" layers) and translate the layer media type
 	// to not indicate "nondistributable".
 	DownloadForeignLayers bool
+
+	// If EnablePartialPull is set, layers which support it (e.g. zstd:chunked) may be pulled partially, if both the source
+	// and the destination support it: only the parts of the layer not already present at the destination are fetched.
+	// With containers-storage destinations, partial pulls must also be enabled using the enable_partial_images
+	// pull option in containers-storage.conf(5). If a partial pull fails, the complete layer is copied.
+	// The default is to always copy complete layers.
+	EnablePartialPull bool
+
+	// If Checkpoint is set, layers copied to the destination are recorded in it, and layers previously recorded there
+	// (and still present at the destination) are not copied again. Completed instances of manifest lists, with their
+	// signatures, are recorded as well, and are not copied (nor signed) again. This allows resuming interrupted copies;
+	// the same Checkpoint can be shared by all copies in a batch.
+	Checkpoint *Checkpoint
+
+	// ExistingTagPolicy controls what happens if the destination reference already refers to an image;
+	// set to either ExistingTagOverwrite (the default), ExistingTagFailIfExists, or ExistingTagSkipIfSameDigest.
+	ExistingTagPolicy ExistingTagPolicy
+
+	// OversizedManifests controls what happens if the destination refuses a manifest because it is too large;
+	// set to either OversizedManifestFail (the default), or OversizedManifestExternalizeAnnotations.
+	OversizedManifests OversizedManifestPolicy
+
+	// ImageRetries is the number of times the whole copy is retried after a failure which seems to be transient
+	// (e.g. a network error, or the registry being temporarily unavailable). The default, 0, means no retries.
+	// Blobs copied by a failed attempt can be reused by later attempts; the blob info cache is shared by all attempts.
+	ImageRetries int
+	// ImageRetryDelay is the delay before the first retry; it doubles after each further attempt.
+	// A reasonable default is used if this is left as 0.
+	ImageRetryDelay time.Duration
+
+	// SignatureDigestSelection controls which manifest digest the signatures of a single image are stored for;
+	// set to either SignatureDigestDestination (the default), SignatureDigestSource, or SignatureDigestExplicit.
+	// With SignatureDigestSource or SignatureDigestExplicit, pre-existing signatures do not prevent modifying the manifest
+	// (e.g. converting it to a different format), but they are not valid for the modified manifest; see SignatureDigestSelection.
+	// Values other than SignatureDigestDestination can not be combined with creating signatures, with ForceIndex,
+	// or with copying multiple images (CopyAllImages, CopySpecificImages or CopyMatchingImages on a list).
+	SignatureDigestSelection SignatureDigestSelection
+	// SignatureDigest is the digest signatures are stored for, if SignatureDigestSelection is SignatureDigestExplicit.
+	SignatureDigest digest.Digest
+
+	// If SBOM is non-empty, the SBOM document is attached to the destination image as an OCI referrer artifact:
+	// an OCI manifest containing SBOM, with a subject referring to the top-level manifest of the destination image.
+	// SBOM is not attached if the copy is skipped because of ExistingTagSkipIfSameDigest.
+	SBOM []byte
+	// SBOMMediaType is the media type of SBOM; it must be one of the SBOMMediaType… values, unless SBOMAllowArbitraryMediaType is set.
+	SBOMMediaType string
+	// If SBOMAllowArbitraryMediaType is set, any non-empty SBOMMediaType is accepted.
+	SBOMAllowArbitraryMediaType bool
+
+	// If MaxLayers is not 0, images with more than MaxLayers layers in the source manifest are rejected,
+	// before copying any of their layers. With multiple images, each instance is checked separately,
+	// when it is about to be copied; instances copied before a rejected one remain at the destination.
+	MaxLayers int
+
+	// If LayerReport is set, the layers of every image written to the destination are recorded in it,
+	// notably including the compression algorithm each layer ended up with; see LayerReport.
+	LayerReport *LayerReport
+	// If CompressionPolicy is set, it is called for every layer the destination wants compressed, and can choose
+	// the compression algorithm of that layer, e.g. based on the layer size or media type, instead of
+	// DestinationCtx.CompressionFormat. It does not affect layers which are reused at the destination without copying.
+	// DiffIDs of the layers do not depend on the chosen algorithm.
+	CompressionPolicy CompressionPolicy
+	// If AnnotateLayerCompression is set, layers of the destination manifests with a known compression are annotated
+	// with LayerCompressionAnnotation (if the manifest format supports layer annotations).
+	// This changes the manifests and their digests, so it can not be combined with PreserveDigests, a digested
+	// destination reference, or with copying signatures.
+	AnnotateLayerCompression bool
+	// If CompressionFormat is set, it is used instead of DestinationCtx.CompressionFormat as the compression algorithm
+	// for layers the destination wants compressed.
+	CompressionFormat *compressiontypes.Algorithm
+	// If CompressionLevel is set, it is used instead of DestinationCtx.CompressionLevel.
+	CompressionLevel *int
+	// If ForceCompressionFormat is set, every layer the destination wants compressed is written compressed with
+	// CompressionFormat (or DestinationCtx.CompressionFormat): layers present at the destination only with a different
+	// compression are not reused, other layers are recompressed, and the manifest is converted to a format which
+	// can represent that compression, if necessary. Encrypted layers are not affected.
+	// It requires a compression format to be set, and can not be combined with CompressionPolicy.
+	ForceCompressionFormat bool
+
+	// If DeferredVerification is set, blobs are streamed to the destination without waiting for verification
+	// of their digests; the digests are computed in the background, and verified only after all blobs and manifests
+	// of the copy have been written, just before committing the destination. If any blob does not match its digest,
+	// the copy fails at that point.
+	// WARNING: Until then, the destination may contain unverified (possibly corrupted or malicious) blobs, and manifests
+	// referring to them. Destinations which make written data visible before the copy is committed (notably registries)
+	// expose it to other users during that window, and the data is not removed if the verification fails.
+	// Blobs the destination does not read entirely (e.g. because it already contains them) are not verified,
+	// the same as without DeferredVerification.
+	DeferredVerification bool
+
+	// If StopBatchOnError is set, Images stops after the first image which fails to be copied.
+	// By default, Images attempts to copy all images, and reports failures for each image separately.
+	StopBatchOnError bool
 }
 
 // copier allows us to keep track of diffID values for blobs, and other
@@ -137,65 +296,149 @@ type copier struct {
 	reportWriter                  io.Writer
 	progressOutput                io.Writer
 	progressInterval              time.Duration
-	progress                      chan types.ProgressProperties
+	progressHandler               ProgressHandler // Reports to options.ProgressHandler and options.Progress, or nil
+	progressRateWindow            time.Duration
+	progressAggregate             *progressAggregate // State of all blob copies reporting to progressHandler
 	blobInfoCache                 internalblobinfocache.BlobInfoCache2
 	ociDecryptConfig              *encconfig.DecryptConfig
 	ociEncryptConfig              *encconfig.EncryptConfig
 	concurrentBlobCopiesSemaphore *semaphore.Weighted // Limits the amount of concurrently copied blobs
+	uploadSemaphore               *semaphore.Weighted // Limits the amount of concurrent PutBlob calls, or nil
 	downloadForeignLayers         bool
-	signers                       []*signer.Signer // Signers to use to create new signatures for the image
-	signersToClose                []*signer.Signer // Signers that should be closed when this copier is destroyed.
+	enablePartialPull             bool
+	checkpoint                    *Checkpoint                                           // Records copied layers, or nil
+	signers                       []*signer.Signer                                      // Signers to use to create new signatures for the image
+	signersToClose                []*signer.Signer                                      // Signers that should be closed when this copier is destroyed.
+	signatureStorageMethod        types.SignatureStorageMethod                          // options.SignatureStorageMethod
+	signatureStorage              map[internalsig.FormatID]types.SignatureStorageMethod // Signature storage methods chosen so far, by format
+	oversizedManifests            OversizedManifestPolicy                               // options.OversizedManifests
+	deferredVerifications         *deferredVerifications                                // Verifications postponed by options.DeferredVerification, or nil
+
+	copiedConfigsLock sync.Mutex
+	copiedConfigs     *set.Set[digest.Digest] // Configs already written to dest, so that instances sharing a config write it only once. Protected by copiedConfigsLock.
 }
 
 // Image copies image from srcRef to destRef, using policyContext to validate
 // source image admissibility.  It returns the manifest which was written to
 // the new copy of the image.
-func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef, srcRef types.ImageReference, options *Options) (copiedManifest []byte, retErr error) {
-	// NOTE this function uses an output parameter for the error return value.
-	// Setting this and returning is the ideal way to return an error.
-	//
-	// the defers in this routine will wrap the error return with its own errors
-	// which can be valuable context in the middle of a multi-streamed copy.
+// Before copying any blobs, it performs cheap checks whether the copy can succeed;
+// if they fail, it returns a PreflightError listing all detected problems.
+// With Options.BestEffortInstances, it may return both the written manifest list and a PartialListCopyError.
+// Signatures are written to the destination in a canonical order which does not depend on the source transport,
+// so they may be stored in a different order than in the source.
+func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef, srcRef types.ImageReference, options *Options) ([]byte, error) {
 	if options == nil {
 		options = &Options{}
 	}
+	if err := validateOptions(options); err != nil {
+		return nil, err
+	}
+
+	// FIXME? The cache is used for sources and destinations equally, but we only have a SourceCtx and DestinationCtx.
+	// For now, use DestinationCtx (because blob reuse changes the behavior of the destination side more); eventually
+	// we might want to add a separate CommonCtx — or would that be too confusing?
+	// The cache is shared by all attempts, so that retries can reuse blobs copied by a failed attempt.
+	blobInfoCache := internalblobinfocache.FromBlobInfoCache(blobinfocache.DefaultCache(options.DestinationCtx))
+	return retryImageCopy(ctx, options, func() ([]byte, error) {
+		return copyImageOnce(ctx, policyContext, destRef, srcRef, options, blobInfoCache)
+	})
+}
 
+// validateOptions returns an error if options are invalid, irrespective of the images being copied.
+func validateOptions(options *Options) error {
 	if err := validateImageListSelection(options.ImageListSelection); err != nil {
-		return nil, err
+		return err
+	}
+	if err := validatePlatformFilter(options); err != nil {
+		return err
+	}
+	if err := validateExistingTagPolicy(options.ExistingTagPolicy); err != nil {
+		return err
+	}
+	if err := validateFailedInstanceHandling(options.FailedInstances); err != nil {
+		return err
+	}
+	if err := validateOversizedManifestPolicy(options.OversizedManifests); err != nil {
+		return err
+	}
+	if options.ImageRetries < 0 {
+		return fmt.Errorf("Invalid value for options.ImageRetries: %d", options.ImageRetries)
+	}
+	if options.MaxLayers < 0 {
+		return fmt.Errorf("Invalid value for options.MaxLayers: %d", options.MaxLayers)
 	}
+	if err := validateSignatureDigestOptions(options); err != nil {
+		return err
+	}
+	if err := validateSBOMOptions(options); err != nil {
+		return err
+	}
+	if err := validateSignatureStorageMethod(options.SignatureStorageMethod); err != nil {
+		return err
+	}
+	if options.AnnotateLayerCompression && options.PreserveDigests {
+		return errors.New("options.AnnotateLayerCompression can not be used with options.PreserveDigests")
+	}
+	if options.ForceCompressionFormat {
+		if options.CompressionFormat == nil && (options.DestinationCtx == nil || options.DestinationCtx.CompressionFormat == nil) {
+			return errors.New("options.ForceCompressionFormat requires options.CompressionFormat or options.DestinationCtx.CompressionFormat to be set")
+		}
+		if options.CompressionPolicy != nil {
+			return errors.New("options.ForceCompressionFormat can not be used with options.CompressionPolicy")
+		}
+	}
+	return nil
+}
 
+// copyImageOnce is Image, except that it makes only a single attempt, using the provided blobInfoCache.
+func copyImageOnce(ctx context.Context, policyContext *signature.PolicyContext, destRef, srcRef types.ImageReference, options *Options,
+	blobInfoCache internalblobinfocache.BlobInfoCache2) (copiedManifest []byte, retErr error) {
+	// NOTE this function uses an output parameter for the error return value.
+	// Setting this and returning is the ideal way to return an error.
+	//
+	// the defers in this routine will wrap the error return with its own errors
+	// which can be valuable context in the middle of a multi-streamed copy.
 	reportWriter := io.Discard
 
 	if options.ReportWriter != nil {
 		reportWriter = options.ReportWriter
 	}
 
-	publicDest, err := destRef.NewImageDestination(ctx, options.DestinationCtx)
+	publicRawSource, err := srcRef.NewImageSource(ctx, options.SourceCtx)
 	if err != nil {
-		return nil, fmt.Errorf("initializing destination %s: %w", transports.ImageName(destRef), err)
+		return nil, fmt.Errorf("initializing source %s: %w", transports.ImageName(srcRef), err)
 	}
-	dest := imagedestination.FromPublic(publicDest)
+	rawSource := imagesource.FromPublic(publicRawSource)
 	defer func() {
-		if err := dest.Close(); err != nil {
+		if err := rawSource.Close(); err != nil {
 			if retErr != nil {
-				retErr = fmt.Errorf(" (dest: %v): %w", err, retErr)
+				retErr = fmt.Errorf(" (src: %v): %w", err, retErr)
 			} else {
-				retErr = fmt.Errorf(" (dest: %v)", err)
+				retErr = fmt.Errorf(" (src: %v)", err)
 			}
 		}
 	}()
 
-	publicRawSource, err := srcRef.NewImageSource(ctx, options.SourceCtx)
+	// This must happen before initializing the destination, which may remove the existing image.
+	existingManifest, err := checkExistingTag(ctx, policyContext, options, destRef, rawSource)
 	if err != nil {
-		return nil, fmt.Errorf("initializing source %s: %w", transports.ImageName(srcRef), err)
+		return nil, err
 	}
-	rawSource := imagesource.FromPublic(publicRawSource)
+	if existingManifest != nil {
+		return existingManifest, nil
+	}
+
+	publicDest, err := destRef.NewImageDestination(ctx, options.DestinationCtx)
+	if err != nil {
+		return nil, fmt.Errorf("initializing destination %s: %w", transports.ImageName(destRef), err)
+	}
+	dest := imagedestination.FromPublic(publicDest)
 	defer func() {
-		if err := rawSource.Close(); err != nil {
+		if err := dest.Close(); err != nil {
 			if retErr != nil {
-				retErr = fmt.Errorf(" (src: %v): %w", err, retErr)
+				retErr = fmt.Errorf(" (dest: %v): %w", err, retErr)
 			} else {
-				retErr = fmt.Errorf(" (src: %v)", err)
+				retErr = fmt.Errorf(" (dest: %v)", err)
 			}
 		}
 	}()
@@ -208,20 +451,26 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		progressOutput = io.Discard
 	}
 
+	progressHandler, progressInterval := progressHandlerForOptions(ctx, options)
 	c := &copier{
-		dest:             dest,
-		rawSource:        rawSource,
-		reportWriter:     reportWriter,
-		progressOutput:   progressOutput,
-		progressInterval: options.ProgressInterval,
-		progress:         options.Progress,
-		// FIXME? The cache is used for sources and destinations equally, but we only have a SourceCtx and DestinationCtx.
-		// For now, use DestinationCtx (because blob reuse changes the behavior of the destination side more); eventually
-		// we might want to add a separate CommonCtx — or would that be too confusing?
-		blobInfoCache:         internalblobinfocache.FromBlobInfoCache(blobinfocache.DefaultCache(options.DestinationCtx)),
-		ociDecryptConfig:      options.OciDecryptConfig,
-		ociEncryptConfig:      options.OciEncryptConfig,
-		downloadForeignLayers: options.DownloadForeignLayers,
+		dest:                   dest,
+		rawSource:              rawSource,
+		reportWriter:           reportWriter,
+		progressOutput:         progressOutput,
+		progressInterval:       progressInterval,
+		progressHandler:        progressHandler,
+		progressRateWindow:     options.ProgressRateWindow,
+		progressAggregate:      newProgressAggregate(),
+		blobInfoCache:          blobInfoCache,
+		ociDecryptConfig:       options.OciDecryptConfig,
+		ociEncryptConfig:       options.OciEncryptConfig,
+		downloadForeignLayers:  options.DownloadForeignLayers,
+		enablePartialPull:      options.EnablePartialPull,
+		checkpoint:             options.Checkpoint,
+		signatureStorageMethod: options.SignatureStorageMethod,
+		signatureStorage:       map[internalsig.FormatID]types.SignatureStorageMethod{},
+		oversizedManifests:     options.OversizedManifests,
+		copiedConfigs:          set.New[digest.Digest](),
 	}
 	defer c.close()
 
@@ -245,6 +494,14 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		}
 	}
 
+	if options.DeferredVerification {
+		c.deferredVerifications = &deferredVerifications{}
+	}
+
+	if options.MaxParallelUploads != 0 {
+		c.uploadSemaphore = semaphore.NewWeighted(int64(options.MaxParallelUploads))
+	}
+
 	if err := c.setupSigners(options); err != nil {
 		return nil, err
 	}
@@ -255,9 +512,14 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		return nil, fmt.Errorf("determining manifest MIME type for %s: %w", transports.ImageName(srcRef), err)
 	}
 
+	if err := preflight(ctx, options, publicRawSource, publicDest, unparsedToplevel); err != nil {
+		return nil, err
+	}
+
+	var partialErr error // Set only if copyMultipleImages reports a PartialListCopyError
 	if !multiImage {
 		// The simple case: just copy a single image.
-		if copiedManifest, _, _, err = c.copySingleImage(ctx, policyContext, options, unparsedToplevel, unparsedToplevel, nil); err != nil {
+		if copiedManifest, err = c.copyToplevelSingleImage(ctx, policyContext, options, unparsedToplevel, unparsedToplevel); err != nil {
 			return nil, err
 		}
 	} else if options.ImageListSelection == CopySystemImage {
@@ -278,22 +540,43 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		logrus.Debugf("Source is a manifest list; copying (only) instance %s for current system", instanceDigest)
 		unparsedInstance := image.UnparsedInstance(rawSource, &instanceDigest)
 
-		if copiedManifest, _, _, err = c.copySingleImage(ctx, policyContext, options, unparsedToplevel, unparsedInstance, nil); err != nil {
+		if copiedManifest, err = c.copyToplevelSingleImage(ctx, policyContext, options, unparsedToplevel, unparsedInstance); err != nil {
 			return nil, fmt.Errorf("copying system image from manifest list: %w", err)
 		}
-	} else { /* options.ImageListSelection == CopyAllImages or options.ImageListSelection == CopySpecificImages, */
+	} else { /* options.ImageListSelection == CopyAllImages, CopySpecificImages or CopyMatchingImages */
 		// If we were asked to copy multiple images and can't, that's an error.
 		if !supportsMultipleImages(c.dest) {
 			return nil, fmt.Errorf("copying multiple images: destination transport %q does not support copying multiple images as a group", destRef.Transport().Name())
 		}
+		if options.SignatureDigestSelection != SignatureDigestDestination {
+			return nil, errors.New("copying multiple images: options.SignatureDigestSelection other than SignatureDigestDestination is not supported")
+		}
 		// Copy some or all of the images.
 		switch options.ImageListSelection {
 		case CopyAllImages:
 			logrus.Debugf("Source is a manifest list; copying all instances")
 		case CopySpecificImages:
 			logrus.Debugf("Source is a manifest list; copying some instances")
+		case CopyMatchingImages:
+			logrus.Debugf("Source is a manifest list; copying instances matching platforms %s", platformsDescription(options.Platforms))
+		}
+		var failures *PartialListCopyError
+		if copiedManifest, failures, err = c.copyMultipleImages(ctx, policyContext, options, unparsedToplevel); err != nil {
+			return nil, err
 		}
-		if copiedManifest, err = c.copyMultipleImages(ctx, policyContext, options, unparsedToplevel); err != nil {
+		if failures != nil {
+			partialErr = *failures
+		}
+	}
+
+	if len(options.SBOM) != 0 {
+		if err := c.putSBOMReferrer(ctx, options, copiedManifest); err != nil {
+			return nil, fmt.Errorf("attaching SBOM: %w", err)
+		}
+	}
+
+	if c.deferredVerifications != nil {
+		if err := c.deferredVerifications.verify(); err != nil {
 			return nil, err
 		}
 	}
@@ -302,7 +585,7 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		return nil, fmt.Errorf("committing the finished image: %w", err)
 	}
 
-	return copiedManifest, nil
+	return copiedManifest, partialErr
 }
 
 // Printf writes a formatted string to c.reportWriter.
@@ -326,7 +609,7 @@ func (c *copier) close() {
 // validateImageListSelection returns an error if the passed-in value is not one that we recognize as a valid ImageListSelection value
 func validateImageListSelection(selection ImageListSelection) error {
 	switch selection {
-	case CopySystemImage, CopyAllImages, CopySpecificImages:
+	case CopySystemImage, CopyAllImages, CopySpecificImages, CopyMatchingImages:
 		return nil
 	default:
 		return fmt.Errorf("Invalid value for options.ImageListSelection: %d", selection)
@@ -341,7 +624,7 @@ func supportsMultipleImages(dest types.ImageDestination) bool {
 		// Anything goes!
 		return true
 	}
-	return slices.ContainsFunc(mtypes, manifest.MIMETypeIsMultiImage)
+	return slices.ContainsFunc(mtypes, manifest.IsIndex)
 }
 
 // isTTY returns true if the io.Writer is a file and a tty.
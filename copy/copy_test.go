@@ -0,0 +1,238 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+// faultInjection describes a failure to inject into a copy.
+type faultInjection struct {
+	// getBlob, if set, returns the stream to return from GetBlob instead of stream, which contains the real data.
+	// cancel cancels the context of the copy.
+	getBlob func(stream io.ReadCloser, cancel context.CancelFunc) io.ReadCloser
+	// putBlobErr, if set, is returned by PutBlob of layers after reading part of the input.
+	putBlobErr error
+	// threadSafeGetBlob, if set, makes the source claim to support concurrent GetBlob calls.
+	threadSafeGetBlob bool
+}
+
+// faultInjectionReference is a types.ImageReference whose sources and destinations inject faults.
+type faultInjectionReference struct {
+	types.ImageReference
+	faults faultInjection
+	cancel context.CancelFunc
+}
+
+func (ref faultInjectionReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return faultInjectionSource{ImageSource: src, ref: ref}, nil
+}
+
+func (ref faultInjectionReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return faultInjectionDestination{ImageDestination: dest, ref: ref}, nil
+}
+
+type faultInjectionSource struct {
+	types.ImageSource
+	ref faultInjectionReference
+}
+
+func (s faultInjectionSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	stream, size, err := s.ImageSource.GetBlob(ctx, info, cache)
+	if err != nil || s.ref.faults.getBlob == nil {
+		return stream, size, err
+	}
+	return s.ref.faults.getBlob(stream, s.ref.cancel), size, nil
+}
+
+func (s faultInjectionSource) HasThreadSafeGetBlob() bool {
+	return s.ref.faults.threadSafeGetBlob || s.ImageSource.HasThreadSafeGetBlob()
+}
+
+type faultInjectionDestination struct {
+	types.ImageDestination
+	ref faultInjectionReference
+}
+
+func (d faultInjectionDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	if !isConfig && d.ref.faults.putBlobErr != nil {
+		if _, err := io.CopyN(io.Discard, stream, 1024); err != nil {
+			return types.BlobInfo{}, err
+		}
+		return types.BlobInfo{}, d.ref.faults.putBlobErr
+	}
+	return d.ImageDestination.PutBlob(ctx, stream, inputInfo, cache, isConfig)
+}
+
+// faultyReader returns the first n bytes of source, and then calls fail and returns its result.
+type faultyReader struct {
+	source io.ReadCloser
+	n      int
+	fail   func() error
+}
+
+func (r *faultyReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, r.fail()
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.source.Read(p)
+	r.n -= n
+	return n, err
+}
+
+func (r *faultyReader) Close() error {
+	return r.source.Close()
+}
+
+// corruptingReader flips a bit in every byte read from source.
+type corruptingReader struct {
+	source io.ReadCloser
+}
+
+func (r corruptingReader) Read(p []byte) (int, error) {
+	n, err := r.source.Read(p)
+	for i := 0; i < n; i++ {
+		p[i] ^= 1
+	}
+	return n, err
+}
+
+func (r corruptingReader) Close() error {
+	return r.source.Close()
+}
+
+func TestImageGoroutineLeaks(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// Create an OCI source image with several large, uncompressed, layers, so that the copy compresses them
+	// in the background, and failures happen mid-blob.
+	srcDir := t.TempDir()
+	layers := [][]byte{}
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 3; i++ {
+		layer := make([]byte, 1024*1024)
+		_, err := random.Read(layer)
+		require.NoError(t, err)
+		layers = append(layers, layer)
+	}
+	writeTestImage(t, srcDir, testImage{manifestType: imgspecv1.MediaTypeImageManifest, layers: layers})
+	srcDirRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+
+	readErr := errors.New("injected read error")
+	writeErr := errors.New("injected write error")
+	for _, c := range []struct {
+		name        string
+		faults      faultInjection
+		expectedErr error // nil for any error
+	}{
+		{"success", faultInjection{}, nil},
+		{
+			"source read error",
+			faultInjection{getBlob: func(stream io.ReadCloser, _ context.CancelFunc) io.ReadCloser {
+				return &faultyReader{source: stream, n: 100 * 1024, fail: func() error { return readErr }}
+			}},
+			readErr,
+		},
+		{
+			"digest mismatch",
+			faultInjection{getBlob: func(stream io.ReadCloser, _ context.CancelFunc) io.ReadCloser {
+				return corruptingReader{source: stream}
+			}},
+			nil,
+		},
+		{"destination write error", faultInjection{putBlobErr: writeErr}, writeErr},
+		{
+			"context cancellation",
+			faultInjection{getBlob: func(stream io.ReadCloser, cancel context.CancelFunc) io.ReadCloser {
+				return &faultyReader{source: stream, n: 100 * 1024, fail: func() error {
+					cancel()
+					return context.Canceled
+				}}
+			}},
+			context.Canceled,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			destDirRef, err := directory.NewReference(t.TempDir())
+			require.NoError(t, err)
+			srcRef := faultInjectionReference{ImageReference: srcDirRef, faults: c.faults, cancel: cancel}
+			destRef := faultInjectionReference{ImageReference: destDirRef, faults: c.faults, cancel: cancel}
+
+			// Consume progress events until the context is canceled, like a caller that stops listening
+			// when it is no longer interested in the copy.
+			progress := make(chan types.ProgressProperties)
+			consumerDone := sync.WaitGroup{}
+			consumerDone.Add(1)
+			go func() {
+				defer consumerDone.Done()
+				for {
+					select {
+					case <-progress:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+
+			_, err = Image(ctx, policyContext, destRef, srcRef, &Options{
+				DestinationCtx:   &types.SystemContext{DirForceCompress: true},
+				ReportWriter:     io.Discard,
+				Progress:         progress,
+				ProgressInterval: time.Millisecond,
+			})
+			cancel()
+			consumerDone.Wait()
+			if c.name == "success" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			if c.expectedErr != nil {
+				assert.ErrorIs(t, err, c.expectedErr)
+			}
+		})
+	}
+}
+
+func TestCompressedStreamClose(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	// Closing the stream early, with the compression goroutine blocked writing to it,
+	// waits for the goroutine to exit.
+	ic := &imageCopier{}
+	input := bytes.Repeat([]byte{'a'}, 10*1024*1024)
+	stream, _ := ic.compressedStream(bytes.NewReader(input), compression.Gzip)
+	_, err := stream.Read(make([]byte, 10))
+	require.NoError(t, err)
+	err = stream.Close()
+	assert.NoError(t, err)
+}
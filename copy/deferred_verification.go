@@ -0,0 +1,171 @@
+package copy
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/containers/image/v5/pkg/digestverify"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// deferredVerificationQueueLength is the number of chunks of a blob which can be waiting to be digested
+// by the background verification of that blob, before reading the blob blocks.
+const deferredVerificationQueueLength = 64
+
+// deferredVerifications tracks verification of blobs postponed by Options.DeferredVerification,
+// and actions which must only happen after all blobs have been verified.
+type deferredVerifications struct {
+	lock    sync.Mutex
+	blobs   []*deferredBlobVerification // Protected by lock
+	actions []func() error              // Protected by lock
+}
+
+// newBlobVerification starts a background verification of the data read from the returned reader against srcInfo,
+// and records it to be checked by verify.
+// The caller must call stopFeeding on the returned value when it stops using the reader.
+func (d *deferredVerifications) newBlobVerification(source io.Reader, srcInfo types.BlobInfo) (*deferredBlobVerification, error) {
+	// As with immediate verification, only the digest is verified, not the size.
+	writer, err := digestverify.NewWriter(io.Discard, srcInfo.Digest, -1)
+	if err != nil {
+		return nil, err
+	}
+	v := &deferredBlobVerification{
+		source: source,
+		digest: srcInfo.Digest,
+		chunks: make(chan []byte, deferredVerificationQueueLength),
+		done:   make(chan struct{}),
+	}
+	go v.digestingGoroutine(writer)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.blobs = append(d.blobs, v)
+	return v, nil
+}
+
+// afterVerification arranges for action to be called after all blobs have been successfully verified by verify.
+func (d *deferredVerifications) afterVerification(action func() error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.actions = append(d.actions, action)
+}
+
+// verify waits for verification of all blobs read so far, and fails if any of them did not match its digest.
+// If all of them matched, it runs the onSuccess hooks of the blobs and the actions recorded by afterVerification.
+func (d *deferredVerifications) verify() error {
+	d.lock.Lock()
+	blobs, actions := d.blobs, d.actions
+	d.blobs, d.actions = nil, nil
+	d.lock.Unlock()
+
+	failures := 0
+	var firstFailure error
+	for _, v := range blobs {
+		if err := v.wait(); err != nil {
+			if firstFailure == nil {
+				firstFailure = fmt.Errorf("verifying blob %s: %w", v.digest, err)
+			}
+			failures++
+		}
+	}
+	switch {
+	case failures == 1:
+		return firstFailure
+	case failures > 1:
+		return fmt.Errorf("%d blobs failed verification, the first one: %w", failures, firstFailure)
+	}
+
+	for _, v := range blobs {
+		if v.onSuccess != nil && v.verified {
+			if err := v.onSuccess(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, action := range actions {
+		if err := action(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runAfterVerification calls action immediately, or, with Options.DeferredVerification, after all blobs have been verified.
+func (c *copier) runAfterVerification(action func() error) error {
+	if c.deferredVerifications == nil {
+		return action()
+	}
+	c.deferredVerifications.afterVerification(action)
+	return nil
+}
+
+// deferredBlobVerification is a verification of a single blob, computed in the background.
+// It is also an io.Reader which returns the data to be verified.
+type deferredBlobVerification struct {
+	source    io.Reader
+	digest    digest.Digest
+	onSuccess func() error // May be set by the user before calling deferredVerifications.verify.
+
+	lock   sync.Mutex
+	chunks chan []byte // Sent to, and closed, only while holding lock
+	closed bool        // chunks has been closed; protected by lock
+	sawEOF bool        // source has returned io.EOF; protected by lock
+
+	done     chan struct{} // Closed when the verification has finished
+	err      error         // Set before done is closed
+	verified bool          // Set before done is closed
+}
+
+// Read implements io.Reader, passing the data read from v.source to the verification.
+func (v *deferredBlobVerification) Read(p []byte) (int, error) {
+	n, err := v.source.Read(p)
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if !v.closed {
+		if n > 0 {
+			v.chunks <- append([]byte(nil), p[:n]...)
+		}
+		if err == io.EOF {
+			v.sawEOF = true
+			v.closed = true
+			close(v.chunks)
+		}
+	}
+	return n, err
+}
+
+// stopFeeding ends the verification; no more data read from v is verified.
+// If the blob was not read to the end (e.g. because the destination already contained it), it is not verified at all,
+// consistently with verification without Options.DeferredVerification.
+func (v *deferredBlobVerification) stopFeeding() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if !v.closed {
+		v.closed = true
+		close(v.chunks)
+	}
+}
+
+// digestingGoroutine verifies all chunks using writer, and sets v.err and v.verified when done.
+func (v *deferredBlobVerification) digestingGoroutine(writer *digestverify.Writer) {
+	defer close(v.done)
+	for chunk := range v.chunks {
+		_, _ = writer.Write(chunk) // A failure is reported by writer.Verify below; keep draining v.chunks.
+	}
+	v.lock.Lock()
+	complete := v.sawEOF
+	v.lock.Unlock()
+	if complete {
+		v.err = writer.Verify()
+		v.verified = v.err == nil
+	}
+}
+
+// wait waits for the verification to finish, and returns an error if the data read to the end did not match the digest.
+// It must only be called after stopFeeding.
+func (v *deferredBlobVerification) wait() error {
+	<-v.done
+	return v.err
+}
@@ -0,0 +1,106 @@
+package copy
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/digestverify"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+// corruptingBlobReference is a types.ImageReference whose sources corrupt the blob with a specific digest.
+type corruptingBlobReference struct {
+	types.ImageReference
+	digest digest.Digest
+}
+
+func (ref corruptingBlobReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return corruptingBlobSource{ImageSource: src, digest: ref.digest}, nil
+}
+
+type corruptingBlobSource struct {
+	types.ImageSource
+	digest digest.Digest
+}
+
+func (s corruptingBlobSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	stream, size, err := s.ImageSource.GetBlob(ctx, info, cache)
+	if err != nil || info.Digest != s.digest {
+		return stream, size, err
+	}
+	return corruptingReader{source: stream}, size, nil
+}
+
+func TestCopyDeferredVerification(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	srcDir := t.TempDir()
+	manifestBlob := writeTestImage(t, srcDir, testImage{layers: [][]byte{[]byte("deferred verification layer")}})
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	m, err := manifest.FromBlob(manifestBlob, manifest.GuessMIMEType(manifestBlob))
+	require.NoError(t, err)
+	layerDigest := m.LayerInfos()[0].Digest
+
+	for _, c := range []struct {
+		name                 string
+		deferred, corrupt    bool
+		manifestWrittenFirst bool
+	}{
+		{"success", true, false, true},
+		{"immediate failure", false, true, false},
+		{"deferred failure", true, true, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+			destDirRef, err := directory.NewReference(t.TempDir())
+			require.NoError(t, err)
+			src := srcRef
+			if c.corrupt {
+				src = corruptingBlobReference{ImageReference: srcRef, digest: layerDigest}
+			}
+			checkpoint, err := OpenCheckpoint(filepath.Join(t.TempDir(), "checkpoint.json"))
+			require.NoError(t, err)
+			recorder := &progressRecorder{}
+
+			_, err = Image(context.Background(), policyContext, destDirRef, src, &Options{
+				// Compress the layer, so that the destination can't detect the corruption by itself.
+				DestinationCtx:       &types.SystemContext{DirForceCompress: true},
+				ReportWriter:         io.Discard,
+				DeferredVerification: c.deferred,
+				Checkpoint:           checkpoint,
+				ProgressHandler:      recorder,
+			})
+			manifestWritten := false
+			for _, e := range recorder.events {
+				if e.Kind == ManifestWritten {
+					manifestWritten = true
+				}
+			}
+			assert.Equal(t, c.manifestWrittenFirst, manifestWritten)
+			_, checkpointed := checkpoint.lookupLayer(destDirRef, layerDigest)
+			if !c.corrupt {
+				require.NoError(t, err)
+				assert.True(t, checkpointed)
+				return
+			}
+			require.Error(t, err)
+			assert.ErrorIs(t, err, digestverify.ErrDigestMismatch)
+			// A corrupted layer is never recorded as copied.
+			assert.False(t, checkpointed)
+		})
+	}
+}
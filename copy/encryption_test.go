@@ -0,0 +1,146 @@
+package copy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
+	encconfig "github.com/containers/ocicrypt/config"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsOciEncrypted(t *testing.T) {
+	for _, c := range []struct {
+		mediaType string
+		expected  bool
+	}{
+		{"application/vnd.oci.image.layer.v1.tar+encrypted", true},
+		{"application/vnd.oci.image.layer.v1.tar+gzip+encrypted", true},
+		{"application/vnd.oci.image.layer.v1.tar+zstd+encrypted", true},
+		{"application/vnd.oci.image.layer.v1.tar+gzip", false},
+		{manifest.DockerV2Schema2LayerMediaType, false},
+		{"application/vnd.oci.image.config.v1+json", false},
+	} {
+		assert.Equal(t, c.expected, isOciEncrypted(c.mediaType), c.mediaType)
+	}
+}
+
+// newEncryptionKeyPair returns a PEM-encoded RSA key pair usable with ocicrypt’s JWE key wrapping.
+func newEncryptionKeyPair(t *testing.T) (publicKey, privateKey []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	publicKey = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	privateKey = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return publicKey, privateKey
+}
+
+// uncompressedLayerDigests returns the digests of uncompressed contents of all layers of the image at ref.
+func uncompressedLayerDigests(t *testing.T, ref types.ImageReference) []digest.Digest {
+	img, err := ref.NewImage(context.Background(), nil)
+	require.NoError(t, err)
+	defer img.Close()
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	res := []digest.Digest{}
+	for _, layer := range img.LayerInfos() {
+		assert.False(t, isOciEncrypted(layer.MediaType), layer.MediaType)
+		rc, _, err := src.GetBlob(context.Background(), layer, nil)
+		require.NoError(t, err)
+		uncompressed, _, err := compression.AutoDecompress(rc)
+		require.NoError(t, err)
+		d, err := digest.Canonical.FromReader(uncompressed)
+		require.NoError(t, err)
+		uncompressed.Close()
+		rc.Close()
+		res = append(res, d)
+	}
+	return res
+}
+
+func TestImageEncryptionRoundTrip(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	publicKey, privateKey := newEncryptionKeyPair(t)
+	encryptConfig, err := encconfig.EncryptWithJwe([][]byte{publicKey})
+	require.NoError(t, err)
+	decryptConfig, err := encconfig.DecryptWithPrivKeys([][]byte{privateKey}, [][]byte{nil})
+	require.NoError(t, err)
+	_, otherPrivateKey := newEncryptionKeyPair(t)
+	otherDecryptConfig, err := encconfig.DecryptWithPrivKeys([][]byte{otherPrivateKey}, [][]byte{nil})
+	require.NoError(t, err)
+
+	srcDir := t.TempDir()
+	layers := numberedLayers(3)
+	writeTestImage(t, srcDir, testImage{layers: layers})
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	originalDigests := []digest.Digest{}
+	for _, layer := range layers {
+		originalDigests = append(originalDigests, digest.FromBytes(layer))
+	}
+
+	// Encrypt only the first and the last layer
+	encryptedRef, err := layout.NewReference(filepath.Join(t.TempDir(), "encrypted"), "")
+	require.NoError(t, err)
+	_, err = Image(context.Background(), policyContext, encryptedRef, srcRef, &Options{
+		OciEncryptConfig: encryptConfig.EncryptConfig,
+		OciEncryptLayers: &[]int{0, -1},
+	})
+	require.NoError(t, err)
+	encryptedImg, err := encryptedRef.NewImage(context.Background(), nil)
+	require.NoError(t, err)
+	defer encryptedImg.Close()
+	encryptedLayers := encryptedImg.LayerInfos()
+	require.Len(t, encryptedLayers, 3)
+	for i, expected := range []bool{true, false, true} {
+		layer := encryptedLayers[i]
+		assert.Equal(t, expected, isOciEncrypted(layer.MediaType), "layer %d: %s", i, layer.MediaType)
+		_, hasKeys := layer.Annotations["org.opencontainers.image.enc.keys.jwe"]
+		assert.Equal(t, expected, hasKeys, "layer %d", i)
+	}
+
+	// Copying an encrypted image without keys passes the layers through unmodified
+	passThroughRef, err := layout.NewReference(filepath.Join(t.TempDir(), "pass-through"), "")
+	require.NoError(t, err)
+	_, err = Image(context.Background(), policyContext, passThroughRef, encryptedRef, &Options{})
+	require.NoError(t, err)
+	passThroughImg, err := passThroughRef.NewImage(context.Background(), nil)
+	require.NoError(t, err)
+	defer passThroughImg.Close()
+	assert.Equal(t, encryptedLayers, passThroughImg.LayerInfos())
+
+	// Decryption with the wrong key fails
+	_, err = Image(context.Background(), policyContext, directoryRefToTempDir(t), passThroughRef, &Options{
+		OciDecryptConfig: otherDecryptConfig.DecryptConfig,
+	})
+	assert.Error(t, err)
+
+	// Decryption restores the original layer contents
+	decryptedRef := directoryRefToTempDir(t)
+	_, err = Image(context.Background(), policyContext, decryptedRef, passThroughRef, &Options{
+		OciDecryptConfig: decryptConfig.DecryptConfig,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, originalDigests, uncompressedLayerDigests(t, decryptedRef))
+}
+
+// directoryRefToTempDir returns a reference to a new temporary directory.
+func directoryRefToTempDir(t *testing.T) types.ImageReference {
+	ref, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	return ref
+}
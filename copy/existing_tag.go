@@ -0,0 +1,252 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/image"
+	internalManifest "github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// ExistingTagOverwrite is the default value which, when set in
+	// Options.ExistingTagPolicy, indicates that an image the destination
+	// reference already refers to is overwritten.
+	ExistingTagOverwrite ExistingTagPolicy = iota
+	// ExistingTagFailIfExists is a value which, when set in
+	// Options.ExistingTagPolicy, indicates that copy.Image() should fail with
+	// ErrDestinationExists, without modifying the destination, if the
+	// destination reference already refers to an image.
+	ExistingTagFailIfExists
+	// ExistingTagSkipIfSameDigest is a value which, when set in
+	// Options.ExistingTagPolicy, indicates that copy.Image() should not copy
+	// anything if the destination reference already refers to the manifest
+	// the copy would write: the source manifest, or the instance chosen from
+	// a manifest list with CopySystemImage, when the copy does not need to
+	// modify it (e.g. to convert it or compress layers as requested in
+	// Options). The source image must still be allowed by the signature
+	// policy. Otherwise, the destination is overwritten.
+	ExistingTagSkipIfSameDigest
+)
+
+// ExistingTagPolicy is one of ExistingTagOverwrite, ExistingTagFailIfExists,
+// or ExistingTagSkipIfSameDigest, to control what copy.Image() does if the
+// destination reference already refers to an image.
+type ExistingTagPolicy int
+
+// ErrDestinationExists is returned by copy.Image() with ExistingTagFailIfExists if the destination reference already refers to an image.
+var ErrDestinationExists = errors.New("destination image already exists")
+
+func validateExistingTagPolicy(policy ExistingTagPolicy) error {
+	switch policy {
+	case ExistingTagOverwrite, ExistingTagFailIfExists, ExistingTagSkipIfSameDigest:
+		return nil
+	default:
+		return fmt.Errorf("Invalid value for options.ExistingTagPolicy: %d", policy)
+	}
+}
+
+// existingDestinationManifest returns the manifest destRef currently refers to, or nil if there is none.
+// This must be called before creating an ImageDestination for destRef; some transports remove the existing image at that point.
+func existingDestinationManifest(ctx context.Context, destRef types.ImageReference, sys *types.SystemContext) []byte {
+	// Transports don’t consistently report a missing image as a specific error, so treat any failure as a missing image;
+	// if the destination is not accessible at all, writing to it will fail later anyway.
+	src, err := destRef.NewImageSource(ctx, sys)
+	if err != nil {
+		logrus.Debugf("Assuming destination %s does not exist: %v", transports.ImageName(destRef), err)
+		return nil
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			logrus.Debugf("Error closing existing image %s: %v", transports.ImageName(destRef), err)
+		}
+	}()
+	m, _, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		logrus.Debugf("Assuming destination %s does not exist: %v", transports.ImageName(destRef), err)
+		return nil
+	}
+	return m
+}
+
+// checkExistingTag implements options.ExistingTagPolicy for copying from rawSource to destRef.
+// It returns the existing destination manifest if the copy should be skipped, or nil if the copy should continue.
+func checkExistingTag(ctx context.Context, policyContext *signature.PolicyContext, options *Options, destRef types.ImageReference, rawSource private.ImageSource) ([]byte, error) {
+	if options.ExistingTagPolicy == ExistingTagOverwrite {
+		return nil, nil
+	}
+	existing := existingDestinationManifest(ctx, destRef, options.DestinationCtx)
+	if existing == nil {
+		return nil, nil
+	}
+
+	switch options.ExistingTagPolicy {
+	case ExistingTagFailIfExists:
+		return nil, fmt.Errorf("copying to %s: %w", transports.ImageName(destRef), ErrDestinationExists)
+
+	case ExistingTagSkipIfSameDigest:
+		existingDigest, err := manifest.Digest(existing)
+		if err != nil {
+			return nil, fmt.Errorf("computing digest of existing destination manifest: %w", err)
+		}
+		target, err := resolveUneditedCopyTarget(ctx, options, rawSource)
+		if err != nil {
+			return nil, err
+		}
+		if target.editReason != "" {
+			logrus.Debugf("Copying to %s would modify the manifest (%s); overwriting", transports.ImageName(destRef), target.editReason)
+			return nil, nil
+		}
+		if target.digest != existingDigest {
+			logrus.Debugf("Destination %s refers to %s, not %s; overwriting", transports.ImageName(destRef), existingDigest, target.digest)
+			return nil, nil
+		}
+
+		// Skipping the copy must not bypass the policy checks which the copy would have done.
+		for _, instanceDigest := range target.instances {
+			unparsedInstance := image.UnparsedInstance(rawSource, instanceDigest)
+			if allowed, err := policyContext.IsRunningImageAllowed(ctx, unparsedInstance); !allowed || err != nil { // Be paranoid and fail if either return value indicates so.
+				return nil, fmt.Errorf("Source image rejected: %w", err)
+			}
+		}
+		logrus.Debugf("Destination %s already refers to %s, skipping copy", transports.ImageName(destRef), target.digest)
+		return existing, nil
+
+	default: // Coverage: This should never happen, validateExistingTagPolicy has been called.
+		return nil, fmt.Errorf("Invalid value for options.ExistingTagPolicy: %d", options.ExistingTagPolicy)
+	}
+}
+
+// uneditedCopyTarget describes what copy.Image() would write to the destination, as determined by resolveUneditedCopyTarget.
+type uneditedCopyTarget struct {
+	digest     digest.Digest    // The digest of the top-level manifest written to the destination, if editReason == ""
+	editReason string           // If not "", the reason why the copy would modify the manifest
+	instances  []*digest.Digest // The source instances the copy would copy; nil for the top-level image
+}
+
+// resolveUneditedCopyTarget determines the manifest copy.Image() would write to the destination if it does not need
+// to modify the source manifests: the instance chosen from a manifest list with CopySystemImage, or the top-level manifest
+// otherwise. It also reports whether options require modifying that manifest; edits which depend on the capabilities
+// of the destination are not detected, but those would not be necessary if the destination already contains the same manifest.
+func resolveUneditedCopyTarget(ctx context.Context, options *Options, rawSource private.ImageSource) (uneditedCopyTarget, error) {
+	unparsedToplevel := image.UnparsedInstance(rawSource, nil)
+	srcManifest, srcMIMEType, err := unparsedToplevel.Manifest(ctx)
+	if err != nil {
+		return uneditedCopyTarget{}, fmt.Errorf("reading manifest for %s: %w", transports.ImageName(rawSource.Reference()), err)
+	}
+	if !manifest.IsIndex(srcMIMEType) {
+		srcDigest, err := manifest.Digest(srcManifest)
+		if err != nil {
+			return uneditedCopyTarget{}, fmt.Errorf("computing digest of source manifest: %w", err)
+		}
+		return uneditedCopyTarget{
+			digest:     srcDigest,
+			editReason: singleImageEditReason(options, srcManifest, srcMIMEType),
+			instances:  []*digest.Digest{nil},
+		}, nil
+	}
+
+	list, err := internalManifest.ListFromBlob(srcManifest, srcMIMEType)
+	if err != nil {
+		return uneditedCopyTarget{}, fmt.Errorf("parsing primary manifest as list for %s: %w", transports.ImageName(rawSource.Reference()), err)
+	}
+	instances, err := instancesToCheckForSkippedCopy(options, list)
+	if err != nil {
+		return uneditedCopyTarget{}, err
+	}
+	if options.ImageListSelection == CopySystemImage {
+		instanceDigest := *instances[0]
+		instanceManifest, instanceMIMEType, err := image.UnparsedInstance(rawSource, &instanceDigest).Manifest(ctx)
+		if err != nil {
+			return uneditedCopyTarget{}, fmt.Errorf("reading manifest for instance %s: %w", instanceDigest, err)
+		}
+		return uneditedCopyTarget{
+			digest:     instanceDigest, // UnparsedInstance.Manifest has verified that instanceManifest matches instanceDigest.
+			editReason: singleImageEditReason(options, instanceManifest, instanceMIMEType),
+			instances:  instances,
+		}, nil
+	}
+
+	srcDigest, err := manifest.Digest(srcManifest)
+	if err != nil {
+		return uneditedCopyTarget{}, fmt.Errorf("computing digest of source manifest: %w", err)
+	}
+	editReason := ""
+	switch {
+	case options.ForceManifestMIMEType != "" && options.ForceManifestMIMEType != srcMIMEType:
+		editReason = fmt.Sprintf("conversion to %s", options.ForceManifestMIMEType)
+	case options.ImageListSelection == CopyMatchingImages && len(instances) != len(list.Instances()):
+		editReason = "removing instances not matching platforms"
+	}
+	return uneditedCopyTarget{digest: srcDigest, editReason: editReason, instances: instances}, nil
+}
+
+// singleImageEditReason returns the reason why copying the single image with srcManifest and srcMIMEType using options
+// would modify its manifest, or "" if options don't require any modifications.
+func singleImageEditReason(options *Options, srcManifest []byte, srcMIMEType string) string {
+	switch {
+	case options.ForceIndex:
+		return "wrapping in an index"
+	case options.ForceManifestMIMEType != "" && options.ForceManifestMIMEType != srcMIMEType:
+		return fmt.Sprintf("conversion to %s", options.ForceManifestMIMEType)
+	case options.OciEncryptLayers != nil:
+		return "encrypting layers"
+	case options.ForceCompressionFormat:
+		return "forcing a compression format"
+	}
+	m, err := manifest.FromBlob(srcManifest, srcMIMEType)
+	if err != nil {
+		return fmt.Sprintf("parsing manifest: %v", err) // The copy will fail, don’t skip it.
+	}
+	for _, layer := range m.LayerInfos() {
+		if options.OciDecryptConfig != nil && isOciEncrypted(layer.MediaType) {
+			return "decrypting layers"
+		}
+		if options.DownloadForeignLayers && len(layer.URLs) != 0 {
+			return "downloading foreign layers"
+		}
+	}
+	return ""
+}
+
+// instancesToCheckForSkippedCopy returns the instances of list which copy.Image() would have copied, based on options.ImageListSelection.
+func instancesToCheckForSkippedCopy(options *Options, list internalManifest.List) ([]*digest.Digest, error) {
+	res := []*digest.Digest{}
+	switch options.ImageListSelection {
+	case CopySystemImage:
+		instanceDigest, err := list.ChooseInstanceByCompression(options.SourceCtx, options.PreferGzipInstances)
+		if err != nil {
+			return nil, fmt.Errorf("choosing an image from manifest list: %w", err)
+		}
+		res = append(res, &instanceDigest)
+	case CopyAllImages, CopySpecificImages, CopyMatchingImages:
+		var platformMatches []bool // Only set with CopyMatchingImages
+		if options.ImageListSelection == CopyMatchingImages {
+			var err error
+			platformMatches, err = instancesMatchingPlatforms(list, options.Platforms)
+			if err != nil {
+				return nil, fmt.Errorf("matching manifest list instances against platforms: %w", err)
+			}
+		}
+		for i, instanceDigest := range list.Instances() {
+			if options.ImageListSelection == CopySpecificImages && !slices.Contains(options.Instances, instanceDigest) {
+				continue
+			}
+			if platformMatches != nil && !platformMatches[i] {
+				continue
+			}
+			d := instanceDigest
+			res = append(res, &d)
+		}
+	}
+	return res, nil
+}
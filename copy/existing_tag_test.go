@@ -0,0 +1,184 @@
+package copy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyExistingTagPolicy(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// newSrc creates an image with a single layer containing layerContents in a new directory,
+	// and returns a reference to it and its manifest.
+	newSrc := func(layerContents string) (types.ImageReference, []byte) {
+		dir := t.TempDir()
+		manifestBlob := writeTestImage(t, dir, testImage{layers: [][]byte{[]byte(layerContents)}})
+		ref, err := directory.NewReference(dir)
+		require.NoError(t, err)
+		return ref, manifestBlob
+	}
+	src1, manifest1 := newSrc("layer 1 contents")
+	src2, manifest2 := newSrc("layer 2 contents")
+	// newDest returns a reference to a fresh destination, which already contains a copy of src1.
+	newDest := func() types.ImageReference {
+		destRef, err := directory.NewReference(t.TempDir())
+		require.NoError(t, err)
+		_, err = Image(context.Background(), policyContext, destRef, src1, nil)
+		require.NoError(t, err)
+		return destRef
+	}
+	// destManifest returns the manifest in destRef.
+	destManifest := func(destRef types.ImageReference) []byte {
+		m, err := os.ReadFile(filepath.Join(destRef.StringWithinTransport(), "manifest.json"))
+		require.NoError(t, err)
+		return m
+	}
+
+	// ExistingTagOverwrite, the default
+	for _, options := range []*Options{nil, {ExistingTagPolicy: ExistingTagOverwrite}} {
+		destRef := newDest()
+		_, err := Image(context.Background(), policyContext, destRef, src2, options)
+		require.NoError(t, err)
+		assert.Equal(t, manifest2, destManifest(destRef))
+	}
+
+	// ExistingTagFailIfExists
+	destRef := newDest()
+	_, err := Image(context.Background(), policyContext, destRef, src2, &Options{ExistingTagPolicy: ExistingTagFailIfExists})
+	assert.ErrorIs(t, err, ErrDestinationExists)
+	assert.Equal(t, manifest1, destManifest(destRef))
+	// … even if the existing image is the same
+	_, err = Image(context.Background(), policyContext, destRef, src1, &Options{ExistingTagPolicy: ExistingTagFailIfExists})
+	assert.ErrorIs(t, err, ErrDestinationExists)
+	// … but a missing destination is fine
+	emptyDestRef, err := directory.NewReference(filepath.Join(t.TempDir(), "this-does-not-exist"))
+	require.NoError(t, err)
+	copied, err := Image(context.Background(), policyContext, emptyDestRef, src2, &Options{ExistingTagPolicy: ExistingTagFailIfExists})
+	require.NoError(t, err)
+	assert.Equal(t, manifest2, copied)
+	assert.Equal(t, manifest2, destManifest(emptyDestRef))
+
+	// ExistingTagSkipIfSameDigest, with the same image: nothing is copied, so this succeeds even if the source layer is missing.
+	destRef = newDest()
+	sameDigestSrc, _ := newSrc("layer 1 contents")
+	err = os.Remove(filepath.Join(sameDigestSrc.StringWithinTransport(), digest.FromString("layer 1 contents").Encoded()))
+	require.NoError(t, err)
+	copied, err = Image(context.Background(), policyContext, destRef, sameDigestSrc, &Options{ExistingTagPolicy: ExistingTagSkipIfSameDigest})
+	require.NoError(t, err)
+	assert.Equal(t, manifest1, copied)
+	assert.Equal(t, manifest1, destManifest(destRef))
+	// The signature policy is still enforced.
+	_, err = Image(context.Background(), newTestPolicyContext(t, signature.NewPRReject()), destRef, sameDigestSrc, &Options{ExistingTagPolicy: ExistingTagSkipIfSameDigest})
+	assert.Error(t, err)
+	assert.Equal(t, manifest1, destManifest(destRef))
+	// A different image is copied.
+	copied, err = Image(context.Background(), policyContext, destRef, src2, &Options{ExistingTagPolicy: ExistingTagSkipIfSameDigest})
+	require.NoError(t, err)
+	assert.Equal(t, manifest2, copied)
+	assert.Equal(t, manifest2, destManifest(destRef))
+	// The same image is copied if the copy would modify the manifest.
+	destRef = newDest()
+	copied, err = Image(context.Background(), policyContext, destRef, src1, &Options{
+		ExistingTagPolicy:     ExistingTagSkipIfSameDigest,
+		ForceManifestMIMEType: imgspecv1.MediaTypeImageManifest,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, manifest.GuessMIMEType(copied))
+	assert.Equal(t, copied, destManifest(destRef))
+
+	// An invalid value
+	_, err = Image(context.Background(), policyContext, newDest(), src2, &Options{ExistingTagPolicy: ExistingTagPolicy(-1)})
+	assert.Error(t, err)
+}
+
+func TestCopyExistingTagPolicyList(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// A manifest list with an amd64 and an arm64 instance
+	srcDir := t.TempDir()
+	instances := [][]byte{
+		writeTestImage(t, srcDir, testImage{layers: numberedLayers(1), asInstance: true}),
+		writeTestImage(t, srcDir, testImage{layers: numberedLayers(2), asInstance: true}),
+	}
+	list := writeTestList(t, srcDir, manifest.DockerV2ListMediaType, instances,
+		[]imgspecv1.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64"}})
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	// removeLayers removes all layers of instance i from the source, so that copying that instance fails.
+	removeLayers := func(i int) {
+		m, err := manifest.Schema2FromManifest(instances[i])
+		require.NoError(t, err)
+		for _, layer := range m.LayersDescriptors {
+			err := os.Remove(filepath.Join(srcDir, layer.Digest.Encoded()))
+			require.NoError(t, err)
+		}
+	}
+	sourceCtx := &types.SystemContext{OSChoice: "linux", ArchitectureChoice: "arm64"}
+	// copyTo copies srcRef to destRef using options, with sourceCtx, and returns the manifest written to destRef.
+	copyTo := func(destRef types.ImageReference, options Options) ([]byte, error) {
+		options.SourceCtx = sourceCtx
+		copied, err := Image(context.Background(), policyContext, destRef, srcRef, &options)
+		if err != nil {
+			return nil, err
+		}
+		m, err := os.ReadFile(filepath.Join(destRef.StringWithinTransport(), "manifest.json"))
+		require.NoError(t, err)
+		assert.Equal(t, m, copied)
+		return m, nil
+	}
+
+	// With CopySystemImage, the destination contains only the chosen instance, and that is compared.
+	systemDest, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	copied, err := copyTo(systemDest, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, instances[1], copied)
+	// With CopyAllImages, the list is compared.
+	allDest, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	copied, err = copyTo(allDest, Options{ImageListSelection: CopyAllImages})
+	require.NoError(t, err)
+	assert.Equal(t, list, copied)
+
+	// Nothing is copied, so this succeeds even if the layers are missing.
+	removeLayers(1)
+	copied, err = copyTo(systemDest, Options{ExistingTagPolicy: ExistingTagSkipIfSameDigest})
+	require.NoError(t, err)
+	assert.Equal(t, instances[1], copied)
+	copied, err = copyTo(allDest, Options{ExistingTagPolicy: ExistingTagSkipIfSameDigest, ImageListSelection: CopyAllImages})
+	require.NoError(t, err)
+	assert.Equal(t, list, copied)
+	// The signature policy is still enforced.
+	_, err = Image(context.Background(), newTestPolicyContext(t, signature.NewPRReject()), systemDest, srcRef, &Options{
+		ExistingTagPolicy: ExistingTagSkipIfSameDigest,
+		SourceCtx:         sourceCtx,
+	})
+	assert.Error(t, err)
+
+	// If the chosen instance, or the list, differs from the destination, it is copied;
+	// that fails because the layers are missing.
+	_, err = copyTo(allDest, Options{ExistingTagPolicy: ExistingTagSkipIfSameDigest})
+	assert.Error(t, err)
+	_, err = copyTo(systemDest, Options{ExistingTagPolicy: ExistingTagSkipIfSameDigest, ImageListSelection: CopyAllImages})
+	assert.Error(t, err)
+	// The same is true if the copy would modify the manifest.
+	_, err = copyTo(systemDest, Options{ExistingTagPolicy: ExistingTagSkipIfSameDigest, ForceManifestMIMEType: imgspecv1.MediaTypeImageManifest})
+	assert.Error(t, err)
+	_, err = copyTo(allDest, Options{
+		ExistingTagPolicy:  ExistingTagSkipIfSameDigest,
+		ImageListSelection: CopyMatchingImages,
+		Platforms:          []imgspecv1.Platform{{OS: "linux", Architecture: "arm64"}},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	internalsig "github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/slices"
+)
+
+// copyToplevelSingleImage copies unparsedImage, which is either unparsedToplevel or an instance chosen from it,
+// as the top-level image of the destination, wrapping it in a newly created index if options.ForceIndex.
+// It returns the top-level manifest which was written to the destination.
+func (c *copier) copyToplevelSingleImage(ctx context.Context, policyContext *signature.PolicyContext, options *Options, unparsedToplevel, unparsedImage *image.UnparsedImage) ([]byte, error) {
+	if !options.ForceIndex {
+		copiedManifest, _, _, err := c.copySingleImage(ctx, policyContext, options, unparsedToplevel, unparsedImage, nil)
+		return copiedManifest, err
+	}
+	return c.copySingleImageAsIndex(ctx, policyContext, options, unparsedToplevel, unparsedImage)
+}
+
+// copySingleImageAsIndex copies unparsedImage as an instance, and writes a newly created one-entry OCI index
+// referring to it as the top-level manifest of the destination.
+// It returns the index which was written to the destination.
+func (c *copier) copySingleImageAsIndex(ctx context.Context, policyContext *signature.PolicyContext, options *Options, unparsedToplevel, unparsedImage *image.UnparsedImage) ([]byte, error) {
+	if !supportsMultipleImages(c.dest) {
+		return nil, fmt.Errorf("creating an index: destination transport %q does not support copying multiple images as a group", c.dest.Reference().Transport().Name())
+	}
+	if supportedTypes := c.dest.SupportedManifestMIMETypes(); len(supportedTypes) != 0 && !slices.Contains(supportedTypes, imgspecv1.MediaTypeImageIndex) {
+		return nil, fmt.Errorf("creating an index: destination does not support %s", imgspecv1.MediaTypeImageIndex)
+	}
+	if named := c.dest.Reference().DockerReference(); named != nil {
+		if _, ok := named.(reference.Digested); ok {
+			return nil, errors.New("creating an index: destination specifies a digest")
+		}
+	}
+
+	srcManifest, _, err := unparsedImage.Manifest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	srcManifestDigest, err := manifest.Digest(srcManifest)
+	if err != nil {
+		return nil, fmt.Errorf("computing digest of source image's manifest: %w", err)
+	}
+	instanceManifest, instanceManifestType, instanceDigest, err := c.copySingleImage(ctx, policyContext, options, unparsedToplevel, unparsedImage, &srcManifestDigest)
+	if err != nil {
+		return nil, err
+	}
+	switch instanceManifestType {
+	case manifest.DockerV2Schema1MediaType, manifest.DockerV2Schema1SignedMediaType:
+		return nil, fmt.Errorf("creating an index: an index cannot refer to a manifest of type %q", instanceManifestType)
+	}
+	platform, err := singleImagePlatform(ctx, options, unparsedImage)
+	if err != nil {
+		return nil, err
+	}
+
+	index := manifest.OCI1IndexFromComponents([]imgspecv1.Descriptor{{
+		MediaType: instanceManifestType,
+		Digest:    instanceDigest,
+		Size:      int64(len(instanceManifest)),
+		Platform:  platform,
+	}}, nil)
+	indexBlob, err := index.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("encoding index: %w", err)
+	}
+	c.Printf("Writing index to image destination\n")
+	if err := c.dest.PutManifest(ctx, indexBlob, nil); err != nil {
+		return nil, fmt.Errorf("writing index: %w", err)
+	}
+
+	var sigs []internalsig.Signature
+	if !options.ForceIndexSignInstanceOnly {
+		sigs, err = c.createSignatures(ctx, indexBlob, options.SignIdentity)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.Printf("Storing index signatures\n")
+	if err := c.putSignatures(ctx, sigs, nil); err != nil {
+		return nil, fmt.Errorf("writing signatures: %w", err)
+	}
+	return indexBlob, nil
+}
+
+// singleImagePlatform returns the platform of unparsedImage, for use in an index, or nil if it is not known.
+func singleImagePlatform(ctx context.Context, options *Options, unparsedImage *image.UnparsedImage) (*imgspecv1.Platform, error) {
+	src, err := image.FromUnparsedImage(ctx, options.SourceCtx, unparsedImage)
+	if err != nil {
+		return nil, fmt.Errorf("initializing image from source: %w", err)
+	}
+	info, err := src.Inspect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading the platform of the image: %w", err)
+	}
+	if info.Os == "" && info.Architecture == "" {
+		return nil, nil
+	}
+	return &imgspecv1.Platform{
+		Architecture: info.Architecture,
+		OS:           info.Os,
+		Variant:      info.Variant,
+	}, nil
+}
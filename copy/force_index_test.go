@@ -0,0 +1,145 @@
+package copy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker/reference"
+	internalsig "github.com/containers/image/v5/internal/signature"
+	internalSigner "github.com/containers/image/v5/internal/signer"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature/signer"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyForceIndex(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+	signIdentity, err := reference.ParseNormalizedNamed("example.com/force-index:tag")
+	require.NoError(t, err)
+	stubSigner := internalSigner.NewSigner(&stubSignerImpl{})
+	defer stubSigner.Close()
+
+	srcDir := t.TempDir()
+	layer, err := os.ReadFile("fixtures/Hello.gz")
+	require.NoError(t, err)
+	config, err := json.Marshal(imgspecv1.Image{
+		Architecture: "arm64",
+		OS:           "linux",
+		Variant:      "v8",
+		RootFS: imgspecv1.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{digest.FromString("Hello")},
+		},
+	})
+	require.NoError(t, err)
+	srcManifest := writeTestImage(t, srcDir, testImage{
+		manifestType:    imgspecv1.MediaTypeImageManifest,
+		config:          config,
+		layers:          [][]byte{layer},
+		layerMediaTypes: []string{imgspecv1.MediaTypeImageLayerGzip},
+	})
+	srcManifestDigest, err := manifest.Digest(srcManifest)
+	require.NoError(t, err)
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+
+	// readSignatures returns the stub signatures created for instanceDigest in dir, as the signed manifests.
+	readSignatures := func(dir string, instanceDigest *digest.Digest) [][]byte {
+		prefix := ""
+		if instanceDigest != nil {
+			prefix = instanceDigest.Encoded() + "."
+		}
+		res := [][]byte{}
+		for i := 1; ; i++ {
+			blob, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("%ssignature-%d", prefix, i)))
+			if os.IsNotExist(err) {
+				break
+			}
+			require.NoError(t, err)
+			sig, err := internalsig.FromBlob(blob)
+			require.NoError(t, err)
+			sigstoreSig, ok := sig.(internalsig.Sigstore)
+			require.True(t, ok)
+			res = append(res, sigstoreSig.UntrustedPayload())
+		}
+		return res
+	}
+
+	for _, c := range []struct {
+		name              string
+		signInstanceOnly  bool
+		expectIndexSigned bool
+	}{
+		{"sign index", false, true},
+		{"sign instance only", true, false},
+	} {
+		destDir := t.TempDir()
+		destRef, err := directory.NewReference(destDir)
+		require.NoError(t, err)
+		copiedManifest, err := Image(context.Background(), policyContext, destRef, srcRef, &Options{
+			ForceIndex:                 true,
+			ForceIndexSignInstanceOnly: c.signInstanceOnly,
+			Signers:                    []*signer.Signer{stubSigner},
+			SignIdentity:               signIdentity,
+		})
+		require.NoError(t, err, c.name)
+
+		assert.Equal(t, imgspecv1.MediaTypeImageIndex, manifest.GuessMIMEType(copiedManifest), c.name)
+		index, err := manifest.OCI1IndexFromManifest(copiedManifest)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, []imgspecv1.Descriptor{{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Digest:    srcManifestDigest,
+			Size:      int64(len(srcManifest)),
+			Platform: &imgspecv1.Platform{
+				Architecture: "arm64",
+				OS:           "linux",
+				Variant:      "v8",
+			},
+		}}, index.Manifests, c.name)
+
+		// The index is the top-level manifest, the image is stored as an instance.
+		topLevel, err := os.ReadFile(filepath.Join(destDir, "manifest.json"))
+		require.NoError(t, err, c.name)
+		assert.Equal(t, copiedManifest, topLevel, c.name)
+		instance, err := os.ReadFile(filepath.Join(destDir, srcManifestDigest.Encoded()+".manifest.json"))
+		require.NoError(t, err, c.name)
+		assert.Equal(t, srcManifest, instance, c.name)
+
+		if c.expectIndexSigned {
+			assert.Equal(t, [][]byte{copiedManifest}, readSignatures(destDir, nil), c.name)
+		} else {
+			assert.Empty(t, readSignatures(destDir, nil), c.name)
+		}
+		assert.Equal(t, [][]byte{srcManifest}, readSignatures(destDir, &srcManifestDigest), c.name)
+
+		// Copying the index again does not nest indexes, whether we copy the whole list or only the single instance.
+		for _, c2 := range []struct {
+			name    string
+			options *Options
+		}{
+			{"all images", &Options{ForceIndex: true, ImageListSelection: CopyAllImages}},
+			{"system image", &Options{ForceIndex: true, SourceCtx: &types.SystemContext{
+				ArchitectureChoice: "arm64",
+				OSChoice:           "linux",
+				VariantChoice:      "v8",
+			}}},
+		} {
+			dest2Dir := t.TempDir()
+			dest2Ref, err := directory.NewReference(dest2Dir)
+			require.NoError(t, err, c2.name)
+			recopiedManifest, err := Image(context.Background(), policyContext, dest2Ref, destRef, c2.options)
+			require.NoError(t, err, c2.name)
+			assert.Equal(t, copiedManifest, recopiedManifest, c2.name)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package copy
+
+import (
+	"sync"
+
+	internalblobinfocache "github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/compression"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"golang.org/x/exp/slices"
+)
+
+// LayerCompressionAnnotation is the annotation set on layers of the destination manifest with Options.AnnotateLayerCompression.
+// Its value is the name of the compression algorithm the layer is compressed with (e.g. "gzip", "zstd" or "zstd:chunked"),
+// or LayerCompressionAnnotationUncompressed.
+const LayerCompressionAnnotation = "io.github.containers.image.compression"
+
+// LayerCompressionAnnotationUncompressed is the value of LayerCompressionAnnotation for layers which are not compressed.
+const LayerCompressionAnnotationUncompressed = internalblobinfocache.Uncompressed
+
+// CopiedLayer describes a layer written to the destination by copy.Image.
+type CopiedLayer struct {
+	SourceDigest digest.Digest // The digest of the layer in the source
+	Digest       digest.Digest // The digest of the layer at the destination
+	// CompressionOperation is the operation recorded for the layer when updating the manifest;
+	// notably, types.PreserveOriginal is also used if a compressed layer was recompressed using a different algorithm.
+	CompressionOperation types.LayerCompression
+	// CompressionKnown is false if the compression of the layer at the destination is not known,
+	// e.g. because the layer is encrypted.
+	CompressionKnown bool
+	// CompressionAlgorithm is the compression algorithm of the layer at the destination, or nil
+	// if the layer is not compressed (or if !CompressionKnown).
+	CompressionAlgorithm *compressiontypes.Algorithm
+}
+
+// CopiedImage describes the layers of a single image written to the destination by copy.Image.
+type CopiedImage struct {
+	ManifestDigest digest.Digest // The digest of the manifest written to the destination
+	Layers         []CopiedLayer // In the order of the destination manifest
+}
+
+// LayerReport records the layers written by copy.Image, notably the compression they ended up with
+// (which may differ between layers if some were reused and others were compressed during the copy).
+// Set a *LayerReport in Options.LayerReport, and call Images after copy.Image returns.
+// The zero value is ready to use; a LayerReport can be shared by several copy.Image operations.
+type LayerReport struct {
+	mutex  sync.Mutex
+	images []CopiedImage
+}
+
+// Images returns the images recorded in r, in the order in which they were written.
+// Images skipped because they are already present at the destination are not included.
+func (r *LayerReport) Images() []CopiedImage {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return slices.Clone(r.images)
+}
+
+// recordImage adds image to r.
+func (r *LayerReport) recordImage(image CopiedImage) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.images = append(r.images, image)
+}
+
+// copiedLayer returns a CopiedLayer for a layer with srcInfo copied as destInfo, with compressorName.
+func copiedLayer(srcInfo, destInfo types.BlobInfo, compressorName string) CopiedLayer {
+	res := CopiedLayer{
+		SourceDigest:         srcInfo.Digest,
+		Digest:               destInfo.Digest,
+		CompressionOperation: destInfo.CompressionOperation,
+	}
+	switch compressorName {
+	case internalblobinfocache.UnknownCompression, "":
+	case internalblobinfocache.Uncompressed:
+		res.CompressionKnown = true
+	default:
+		algorithm, err := compression.AlgorithmByName(compressorName)
+		if err == nil {
+			res.CompressionKnown = true
+			res.CompressionAlgorithm = &algorithm
+		}
+	}
+	return res
+}
+
+// compressorNameFromBlobInfo returns the compressor name (the Name() of a pkg/compression.Algorithm,
+// or internalblobinfocache.Uncompressed or internalblobinfocache.UnknownCompression) of a layer described by info,
+// which was not processed by copyBlobFromStream; this relies on the info provided by the source or the destination.
+func compressorNameFromBlobInfo(info types.BlobInfo) string {
+	if isOciEncrypted(info.MediaType) {
+		return internalblobinfocache.UnknownCompression
+	}
+	if info.CompressionOperation == types.Decompress {
+		return internalblobinfocache.Uncompressed
+	}
+	if info.CompressionAlgorithm != nil {
+		return info.CompressionAlgorithm.Name()
+	}
+	algorithm, known := manifest.CompressionFromMediaType(info.MediaType)
+	switch {
+	case !known:
+		return internalblobinfocache.UnknownCompression
+	case algorithm == nil:
+		return internalblobinfocache.Uncompressed
+	default:
+		return algorithm.Name()
+	}
+}
+
+// layerCompressionAnnotationValue returns the value of LayerCompressionAnnotation for layer, and true, or "", false if that is not known.
+func layerCompressionAnnotationValue(layer CopiedLayer) (string, bool) {
+	switch {
+	case !layer.CompressionKnown:
+		return "", false
+	case layer.CompressionAlgorithm == nil:
+		return LayerCompressionAnnotationUncompressed, true
+	default:
+		return layer.CompressionAlgorithm.Name(), true
+	}
+}
@@ -0,0 +1,146 @@
+package copy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	internalblobinfocache "github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/compression"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayerReport(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// A source image with a gzip-compressed layer and an uncompressed layer.
+	gzipLayer := gzipCompressed(t, []byte("layer 1 contents"))
+	uncompressedLayer := []byte("layer 2 contents")
+	srcDir := t.TempDir()
+	writeTestImage(t, srcDir, testImage{
+		manifestType:    imgspecv1.MediaTypeImageManifest,
+		layers:          [][]byte{gzipLayer, uncompressedLayer},
+		layerMediaTypes: []string{imgspecv1.MediaTypeImageLayerGzip, imgspecv1.MediaTypeImageLayer},
+	})
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	destDir := t.TempDir()
+	destRef, err := layout.NewReference(destDir, "latest")
+	require.NoError(t, err)
+
+	// The first copy populates the destination, compressing the uncompressed layer with the default algorithm.
+	report := &LayerReport{}
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		DestinationCtx: &types.SystemContext{BlobInfoCacheDir: t.TempDir()},
+		LayerReport:    report,
+	})
+	require.NoError(t, err)
+	images := report.Images()
+	require.Len(t, images, 1)
+	require.Len(t, images[0].Layers, 2)
+	assert.Equal(t, digest.FromBytes(gzipLayer), images[0].Layers[0].SourceDigest)
+	assert.Equal(t, digest.FromBytes(gzipLayer), images[0].Layers[0].Digest)
+	assert.Equal(t, types.PreserveOriginal, images[0].Layers[0].CompressionOperation)
+	assert.True(t, images[0].Layers[0].CompressionKnown)
+	assert.Equal(t, "gzip", algorithmName(images[0].Layers[0].CompressionAlgorithm))
+	assert.Equal(t, digest.FromBytes(uncompressedLayer), images[0].Layers[1].SourceDigest)
+	assert.NotEqual(t, digest.FromBytes(uncompressedLayer), images[0].Layers[1].Digest)
+	assert.Equal(t, types.Compress, images[0].Layers[1].CompressionOperation)
+	assert.True(t, images[0].Layers[1].CompressionKnown)
+	assert.Equal(t, "gzip", algorithmName(images[0].Layers[1].CompressionAlgorithm))
+
+	// The second copy, requesting zstd, reuses the gzip layer, and compresses the other one with zstd;
+	// the destination manifest is annotated.
+	report = &LayerReport{}
+	copiedManifest, err := Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		DestinationCtx: &types.SystemContext{
+			BlobInfoCacheDir:  t.TempDir(),
+			CompressionFormat: &compression.Zstd,
+		},
+		LayerReport:              report,
+		AnnotateLayerCompression: true,
+	})
+	require.NoError(t, err)
+	images = report.Images()
+	require.Len(t, images, 1)
+	assert.Equal(t, digest.FromBytes(copiedManifest), images[0].ManifestDigest)
+	require.Len(t, images[0].Layers, 2)
+	assert.Equal(t, digest.FromBytes(gzipLayer), images[0].Layers[0].Digest)
+	assert.Equal(t, "gzip", algorithmName(images[0].Layers[0].CompressionAlgorithm))
+	assert.Equal(t, types.Compress, images[0].Layers[1].CompressionOperation)
+	assert.Equal(t, "zstd", algorithmName(images[0].Layers[1].CompressionAlgorithm))
+	copied, err := manifest.OCI1FromManifest(copiedManifest)
+	require.NoError(t, err)
+	require.Len(t, copied.Layers, 2)
+	assert.Equal(t, imgspecv1.MediaTypeImageLayerGzip, copied.Layers[0].MediaType)
+	assert.Equal(t, "gzip", copied.Layers[0].Annotations[LayerCompressionAnnotation])
+	assert.Equal(t, imgspecv1.MediaTypeImageLayerZstd, copied.Layers[1].MediaType)
+	assert.Equal(t, "zstd", copied.Layers[1].Annotations[LayerCompressionAnnotation])
+
+	// AnnotateLayerCompression can’t be used if the manifest must not be modified.
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		AnnotateLayerCompression: true,
+		PreserveDigests:          true,
+	})
+	assert.Error(t, err)
+}
+
+// algorithmName returns the name of algorithm, or "" if it is nil.
+func algorithmName(algorithm *compressiontypes.Algorithm) string {
+	if algorithm == nil {
+		return ""
+	}
+	return algorithm.Name()
+}
+
+func TestCopiedLayer(t *testing.T) {
+	srcInfo := types.BlobInfo{Digest: digest.FromString("source")}
+	destInfo := types.BlobInfo{Digest: digest.FromString("destination"), CompressionOperation: types.Compress}
+	for _, c := range []struct {
+		compressorName string
+		known          bool
+		algorithm      string
+		annotation     string
+	}{
+		{internalblobinfocache.UnknownCompression, false, "", ""},
+		{"", false, "", ""},
+		{"this is not a known algorithm", false, "", ""},
+		{internalblobinfocache.Uncompressed, true, "", LayerCompressionAnnotationUncompressed},
+		{compressiontypes.ZstdChunkedAlgorithmName, true, "zstd:chunked", "zstd:chunked"},
+	} {
+		layer := copiedLayer(srcInfo, destInfo, c.compressorName)
+		assert.Equal(t, srcInfo.Digest, layer.SourceDigest, c.compressorName)
+		assert.Equal(t, destInfo.Digest, layer.Digest, c.compressorName)
+		assert.Equal(t, types.Compress, layer.CompressionOperation, c.compressorName)
+		assert.Equal(t, c.known, layer.CompressionKnown, c.compressorName)
+		assert.Equal(t, c.algorithm, algorithmName(layer.CompressionAlgorithm), c.compressorName)
+		annotation, ok := layerCompressionAnnotationValue(layer)
+		assert.Equal(t, c.known, ok, c.compressorName)
+		assert.Equal(t, c.annotation, annotation, c.compressorName)
+	}
+}
+
+func TestCompressorNameFromBlobInfo(t *testing.T) {
+	for _, c := range []struct {
+		info     types.BlobInfo
+		expected string
+	}{
+		{types.BlobInfo{MediaType: imgspecv1.MediaTypeImageLayer, CompressionAlgorithm: &compression.Zstd}, compression.Zstd.Name()},
+		{types.BlobInfo{MediaType: imgspecv1.MediaTypeImageLayerGzip, CompressionOperation: types.Decompress}, internalblobinfocache.Uncompressed},
+		{types.BlobInfo{MediaType: imgspecv1.MediaTypeImageLayer}, internalblobinfocache.Uncompressed},
+		{types.BlobInfo{MediaType: manifest.DockerV2Schema2ForeignLayerMediaType}, internalblobinfocache.Uncompressed},
+		{types.BlobInfo{MediaType: manifest.DockerV2Schema2LayerMediaType}, compression.Gzip.Name()},
+		{types.BlobInfo{MediaType: imgspecv1.MediaTypeImageLayerZstd}, compression.Zstd.Name()},
+		{types.BlobInfo{MediaType: imgspecv1.MediaTypeImageLayerGzip + "+encrypted", CompressionAlgorithm: &compression.Gzip}, internalblobinfocache.UnknownCompression},
+		{types.BlobInfo{MediaType: ""}, internalblobinfocache.UnknownCompression},
+	} {
+		assert.Equal(t, c.expected, compressorNameFromBlobInfo(c.info), c.info.MediaType)
+	}
+}
@@ -8,7 +8,9 @@ import (
 
 	"github.com/containers/image/v5/internal/set"
 	"github.com/containers/image/v5/manifest"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/slices"
 )
@@ -47,9 +49,10 @@ type determineManifestConversionInputs struct {
 
 	destSupportedManifestMIMETypes []string // MIME types supported by the destination, per types.ImageDestination.SupportedManifestMIMETypes()
 
-	forceManifestMIMEType      string // User’s choice of forced manifest MIME type
-	requiresOCIEncryption      bool   // Restrict to manifest formats that can support OCI encryption
-	cannotModifyManifestReason string // The reason the manifest cannot be modified, or an empty string if it can
+	forceManifestMIMEType      string                      // User’s choice of forced manifest MIME type
+	requiresOCIEncryption      bool                        // Restrict to manifest formats that can support OCI encryption
+	requiredCompression        *compressiontypes.Algorithm // If not nil, restrict to manifest formats that can refer to layers compressed with this algorithm
+	cannotModifyManifestReason string                      // The reason the manifest cannot be modified, or an empty string if it can
 }
 
 // manifestConversionPlan contains the decisions made by determineManifestConversion.
@@ -76,18 +79,31 @@ func determineManifestConversion(in determineManifestConversionInputs) (manifest
 		destSupportedManifestMIMETypes = []string{in.forceManifestMIMEType}
 	}
 
-	if len(destSupportedManifestMIMETypes) == 0 && (!in.requiresOCIEncryption || manifest.MIMETypeSupportsEncryption(srcType)) {
-		return manifestConversionPlan{ // Anything goes; just use the original as is, do not try any conversions.
-			preferredMIMEType:       srcType,
-			otherMIMETypeCandidates: []string{},
-		}, nil
+	compressionSupported := func(mimeType string) bool {
+		return in.requiredCompression == nil || manifestMIMETypeSupportsCompression(mimeType, *in.requiredCompression)
+	}
+	if len(destSupportedManifestMIMETypes) == 0 {
+		if (!in.requiresOCIEncryption || manifest.MIMETypeSupportsEncryption(srcType)) && compressionSupported(srcType) {
+			return manifestConversionPlan{ // Anything goes; just use the original as is, do not try any conversions.
+				preferredMIMEType:       srcType,
+				otherMIMETypeCandidates: []string{},
+			}, nil
+		}
+		if !compressionSupported(srcType) {
+			// The destination accepts any format, so convert to the one that can represent any compression.
+			destSupportedManifestMIMETypes = []string{imgspecv1.MediaTypeImageManifest}
+		}
 	}
 	supportedByDest := set.New[string]()
 	for _, t := range destSupportedManifestMIMETypes {
-		if !in.requiresOCIEncryption || manifest.MIMETypeSupportsEncryption(t) {
+		if (!in.requiresOCIEncryption || manifest.MIMETypeSupportsEncryption(t)) && compressionSupported(t) {
 			supportedByDest.Add(t)
 		}
 	}
+	if in.requiredCompression != nil && supportedByDest.Empty() {
+		return manifestConversionPlan{}, fmt.Errorf("Layers are required to be compressed with %s, which none of the manifest formats supported by the destination (%s) can represent",
+			in.requiredCompression.Name(), strings.Join(destSupportedManifestMIMETypes, ", "))
+	}
 
 	// destSupportedManifestMIMETypes is a static guess; a particular registry may still only support a subset of the types.
 	// So, build a list of types to try in order of decreasing preference.
@@ -146,7 +162,7 @@ func isMultiImage(ctx context.Context, img types.UnparsedImage) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	return manifest.MIMETypeIsMultiImage(mt), nil
+	return manifest.IsIndex(mt), nil
 }
 
 // determineListConversion takes the current MIME type of a list of manifests,
@@ -173,7 +189,7 @@ func (c *copier) determineListConversion(currentListMIMEType string, destSupport
 	}
 	// Pick out the other list types that we support.
 	for _, t := range destSupportedMIMETypes {
-		if manifest.MIMETypeIsMultiImage(t) {
+		if manifest.IsIndex(t) {
 			prioritizedTypes.append(t)
 		}
 	}
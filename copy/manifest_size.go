@@ -0,0 +1,194 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// OversizedManifestFail is the default value which, when set in Options.OversizedManifests,
+	// indicates that copy.Image() should fail with a types.ErrManifestTooLarge if the destination
+	// refuses a manifest because it is too large.
+	OversizedManifestFail OversizedManifestPolicy = iota
+	// OversizedManifestExternalizeAnnotations is a value which, when set in Options.OversizedManifests,
+	// indicates that if the destination refuses an OCI manifest or index because it is too large,
+	// copy.Image() should move large annotation values into separate blobs, following the convention
+	// described in the manifest package (see manifest.ExternalizeAnnotations), and write the modified manifest instead,
+	// along with an OCI artifact of type manifest.ExternalizedAnnotationsArtifactType which refers to the modified manifest
+	// as its subject, and to the blobs as its layers, so that registries don’t garbage-collect the blobs.
+	// That changes the manifest digest, so it is not possible if the manifest must not be modified; it also requires
+	// a destination which can store the artifact.
+	OversizedManifestExternalizeAnnotations
+)
+
+// OversizedManifestPolicy is one of OversizedManifestFail or OversizedManifestExternalizeAnnotations, to control
+// what copy.Image() does if the destination refuses a manifest because it is too large.
+type OversizedManifestPolicy int
+
+// externalizedAnnotationMinSize is the size of the smallest annotation value externalized with OversizedManifestExternalizeAnnotations.
+// Much smaller values don’t noticeably contribute to the manifest size, and externalizing them would only make the manifest harder to use.
+const externalizedAnnotationMinSize = 1024
+
+func validateOversizedManifestPolicy(policy OversizedManifestPolicy) error {
+	switch policy {
+	case OversizedManifestFail, OversizedManifestExternalizeAnnotations:
+		return nil
+	default:
+		return fmt.Errorf("Invalid value for options.OversizedManifests: %d", policy)
+	}
+}
+
+// putManifest writes man to c.dest, as an instance of a manifest list if isInstance, and returns the manifest
+// actually written, and its digest.
+// If c.dest refuses man as too large and c.oversizedManifests allows it, large annotation values are externalized
+// and the modified manifest is written instead, along with an artifact referring to the blobs, unless cannotModifyManifestReason is set.
+func (c *copier) putManifest(ctx context.Context, man []byte, isInstance bool, cannotModifyManifestReason string) ([]byte, digest.Digest, error) {
+	manifestDigest, err := manifest.Digest(man)
+	if err != nil {
+		return nil, "", err
+	}
+	var instanceDigest *digest.Digest
+	if isInstance {
+		instanceDigest = &manifestDigest
+	}
+	err = c.dest.PutManifest(ctx, man, instanceDigest)
+	if err == nil {
+		c.reportProgress(ProgressEvent{Kind: ManifestWritten, Digest: manifestDigest, LayerIndex: -1, Total: int64(len(man))})
+		return man, manifestDigest, nil
+	}
+	var tooLarge types.ErrManifestTooLarge
+	if !errors.As(err, &tooLarge) || c.oversizedManifests != OversizedManifestExternalizeAnnotations {
+		return man, manifestDigest, err
+	}
+	if cannotModifyManifestReason != "" {
+		return nil, "", fmt.Errorf("%w; annotations can not be externalized: %q", err, cannotModifyManifestReason)
+	}
+	if supportedErr := checkReferrerArtifactsSupported(c.dest); supportedErr != nil {
+		return nil, "", fmt.Errorf("%w; annotations can not be externalized: %v", err, supportedErr)
+	}
+
+	logrus.Debugf("Manifest is too large (%v), externalizing large annotation values", err)
+	updated, blobs, extErr := c.externalizeManifestAnnotations(ctx, man)
+	if extErr != nil {
+		return nil, "", fmt.Errorf("%w; externalizing annotations failed: %v", err, extErr)
+	}
+	if len(blobs) == 0 {
+		return nil, "", fmt.Errorf("%w; there are no large annotations to externalize", err)
+	}
+	updatedDigest, err := manifest.Digest(updated)
+	if err != nil {
+		return nil, "", err
+	}
+	if isInstance {
+		instanceDigest = &updatedDigest
+	}
+	if err := c.dest.PutManifest(ctx, updated, instanceDigest); err != nil {
+		return nil, "", fmt.Errorf("writing manifest with externalized annotations: %w", err)
+	}
+	// Refer to the blobs from an artifact, otherwise registries would consider them unreferenced.
+	if err := c.putReferrerArtifact(ctx, updated, manifest.ExternalizedAnnotationsArtifactType, blobs); err != nil {
+		return nil, "", fmt.Errorf("referring to externalized annotations: %w", err)
+	}
+	c.reportProgress(ProgressEvent{Kind: ManifestWritten, Digest: updatedDigest, LayerIndex: -1, Total: int64(len(updated))})
+	return updated, updatedDigest, nil
+}
+
+// externalizeManifestAnnotations returns man with large annotation values externalized into blobs in c.dest,
+// and descriptors of the blobs, without duplicates; if nothing was externalized, the descriptors are empty.
+// Only OCI manifests and indexes are modified.
+func (c *copier) externalizeManifestAnnotations(ctx context.Context, man []byte) ([]byte, []imgspecv1.Descriptor, error) {
+	blobs := []imgspecv1.Descriptor{}
+	externalize := func(annotations *map[string]string) error {
+		res, externalized, err := manifest.ExternalizeAnnotations(*annotations, externalizedAnnotationMinSize, func(value []byte) (digest.Digest, error) {
+			blob, err := c.putExternalizedAnnotation(ctx, value)
+			if err != nil {
+				return "", err
+			}
+			if !slices.ContainsFunc(blobs, func(d imgspecv1.Descriptor) bool { return d.Digest == blob.Digest }) {
+				blobs = append(blobs, blob)
+			}
+			return blob.Digest, nil
+		})
+		if err != nil {
+			return err
+		}
+		if externalized {
+			*annotations = res
+		}
+		return nil
+	}
+
+	switch manifest.NormalizedMIMEType(manifest.GuessMIMEType(man)) {
+	case imgspecv1.MediaTypeImageManifest:
+		m, err := manifest.OCI1FromManifest(man)
+		if err != nil {
+			return nil, nil, err
+		}
+		descriptors := []*imgspecv1.Descriptor{&m.Config}
+		for i := range m.Layers {
+			descriptors = append(descriptors, &m.Layers[i])
+		}
+		if m.Subject != nil {
+			descriptors = append(descriptors, m.Subject)
+		}
+		if err := externalize(&m.Annotations); err != nil {
+			return nil, nil, err
+		}
+		for _, desc := range descriptors {
+			if err := externalize(&desc.Annotations); err != nil {
+				return nil, nil, err
+			}
+		}
+		if len(blobs) == 0 {
+			return man, nil, nil
+		}
+		res, err := m.Serialize()
+		if err != nil {
+			return nil, nil, err
+		}
+		return res, blobs, nil
+
+	case imgspecv1.MediaTypeImageIndex:
+		index, err := manifest.OCI1IndexFromManifest(man)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := externalize(&index.Annotations); err != nil {
+			return nil, nil, err
+		}
+		for i := range index.Manifests {
+			if err := externalize(&index.Manifests[i].Annotations); err != nil {
+				return nil, nil, err
+			}
+		}
+		if len(blobs) == 0 {
+			return man, nil, nil
+		}
+		res, err := index.Serialize()
+		if err != nil {
+			return nil, nil, err
+		}
+		return res, blobs, nil
+
+	default: // Other formats don’t have annotations
+		return man, nil, nil
+	}
+}
+
+// putExternalizedAnnotation writes an externalized annotation value to c.dest, and returns a descriptor of the blob.
+func (c *copier) putExternalizedAnnotation(ctx context.Context, value []byte) (imgspecv1.Descriptor, error) {
+	res, err := c.putArtifactBlob(ctx, value, false)
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	res.MediaType = manifest.ExternalizedAnnotationMediaType
+	return res, nil
+}
@@ -0,0 +1,135 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/registrytest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateOversizedManifestPolicy(t *testing.T) {
+	for _, policy := range []OversizedManifestPolicy{OversizedManifestFail, OversizedManifestExternalizeAnnotations} {
+		err := validateOversizedManifestPolicy(policy)
+		assert.NoError(t, err, policy)
+	}
+	for _, policy := range []OversizedManifestPolicy{-1, OversizedManifestExternalizeAnnotations + 1} {
+		err := validateOversizedManifestPolicy(policy)
+		assert.Error(t, err, policy)
+	}
+}
+
+// annotatedTestImage returns an OCI image with numLayers compressed layers, each with a large annotation.
+func annotatedTestImage(t *testing.T, numLayers int) testImage {
+	img := testImage{manifestType: imgspecv1.MediaTypeImageManifest}
+	for i, contents := range numberedLayers(numLayers) {
+		// Use compressed layers, so that the copy does not compress them (and drop the annotations).
+		img.layers = append(img.layers, gzipCompressed(t, contents))
+		img.layerMediaTypes = append(img.layerMediaTypes, imgspecv1.MediaTypeImageLayerGzip)
+		img.layerAnnotations = append(img.layerAnnotations, map[string]string{
+			"small":                "value",
+			"com.example.sbom":     strings.Repeat(fmt.Sprintf("%d", i), 2*externalizedAnnotationMinSize),
+			"com.example.provider": "example",
+		})
+	}
+	return img
+}
+
+func TestImageOversizedManifests(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+	srcDir := t.TempDir()
+	srcImage := annotatedTestImage(t, 3)
+	writeTestImage(t, srcDir, srcImage)
+	annotations := srcImage.layerAnnotations
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+
+	const repo = "dest"
+	server := registrytest.NewServer(&registrytest.Options{MaxManifestSize: 4096})
+	defer server.Close()
+	destRef, err := docker.ParseReference("//" + server.Host() + "/" + repo + ":latest")
+	require.NoError(t, err)
+
+	// By default, the copy fails with a typed error
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		DestinationCtx: server.SystemContext(),
+	})
+	var tooLarge types.ErrManifestTooLarge
+	assert.ErrorAs(t, err, &tooLarge)
+	assert.Empty(t, server.Tags(repo))
+
+	// Externalizing is not possible if the manifest must not be modified
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		DestinationCtx:     server.SystemContext(),
+		PreserveDigests:    true,
+		OversizedManifests: OversizedManifestExternalizeAnnotations,
+	})
+	assert.ErrorAs(t, err, &tooLarge)
+	assert.Empty(t, server.Tags(repo))
+
+	// Externalizing succeeds
+	copiedManifest, err := Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		DestinationCtx:     server.SystemContext(),
+		OversizedManifests: OversizedManifestExternalizeAnnotations,
+	})
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(copiedManifest), 4096)
+	storedManifest, _, ok := server.Manifest(repo, "latest")
+	require.True(t, ok)
+	assert.Equal(t, copiedManifest, storedManifest)
+	m, err := manifest.OCI1FromManifest(storedManifest)
+	require.NoError(t, err)
+	require.Len(t, m.Layers, len(annotations))
+	blobDigests := []digest.Digest{}
+	for i, layer := range m.Layers {
+		assert.Equal(t, "value", layer.Annotations["small"])
+		assert.NotContains(t, layer.Annotations, "com.example.sbom")
+		pointer := layer.Annotations[manifest.ExternalizedAnnotationPrefix+"com.example.sbom"]
+		d, err := digest.Parse(pointer)
+		require.NoError(t, err)
+		blob, ok := server.Blob(repo, d)
+		require.True(t, ok)
+		assert.Equal(t, annotations[i]["com.example.sbom"], string(blob))
+		blobDigests = append(blobDigests, d)
+	}
+
+	// The blobs are referenced by an artifact referring to the manifest
+	referrers := server.Referrers(repo, digest.FromBytes(storedManifest), manifest.ExternalizedAnnotationsArtifactType)
+	require.Len(t, referrers, 1)
+	referrerBlob, _, ok := server.Manifest(repo, referrers[0].Digest.String())
+	require.True(t, ok)
+	referrer, err := manifest.OCI1FromManifest(referrerBlob)
+	require.NoError(t, err)
+	require.NotNil(t, referrer.Subject)
+	assert.Equal(t, digest.FromBytes(storedManifest), referrer.Subject.Digest)
+	assert.Equal(t, manifest.ExternalizedAnnotationsArtifactType, referrer.Config.MediaType)
+	referencedDigests := []digest.Digest{}
+	for _, layer := range referrer.Layers {
+		assert.Equal(t, manifest.ExternalizedAnnotationMediaType, layer.MediaType)
+		referencedDigests = append(referencedDigests, layer.Digest)
+	}
+	assert.ElementsMatch(t, blobDigests, referencedDigests)
+
+	// Inspect shows the original values
+	src, err := destRef.NewImageSource(context.Background(), server.SystemContext())
+	require.NoError(t, err)
+	defer src.Close()
+	img, err := image.FromUnparsedImage(context.Background(), server.SystemContext(), image.UnparsedInstance(src, nil))
+	require.NoError(t, err)
+	inspectInfo, err := img.Inspect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, inspectInfo.LayersData, len(annotations))
+	for i, layer := range inspectInfo.LayersData {
+		assert.Equal(t, annotations[i], layer.Annotations)
+	}
+}
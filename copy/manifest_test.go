@@ -8,6 +8,7 @@ import (
 
 	"github.com/containers/image/v5/internal/testing/mocks"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/compression"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -215,6 +216,55 @@ func TestDetermineManifestConversion(t *testing.T) {
 			otherMIMETypeCandidates:          []string{},
 		}, res, c.description)
 	}
+
+	// With requiredCompression, only formats which can represent the compression are used
+	for _, c := range []struct {
+		description string
+		sourceType  string
+		destTypes   []string
+		expected    manifestConversionPlan
+	}{
+		{
+			"s2→anything", manifest.DockerV2Schema2MediaType, nil,
+			manifestConversionPlan{
+				preferredMIMEType:                v1.MediaTypeImageManifest,
+				preferredMIMETypeNeedsConversion: true,
+				otherMIMETypeCandidates:          []string{},
+			},
+		},
+		{
+			"OCI→anything", v1.MediaTypeImageManifest, nil,
+			manifestConversionPlan{
+				preferredMIMEType:                v1.MediaTypeImageManifest,
+				preferredMIMETypeNeedsConversion: false,
+				otherMIMETypeCandidates:          []string{},
+			},
+		},
+		{
+			"s2→s1s2OCI", manifest.DockerV2Schema2MediaType, supportS1S2OCI,
+			manifestConversionPlan{
+				preferredMIMEType:                v1.MediaTypeImageManifest,
+				preferredMIMETypeNeedsConversion: true,
+				otherMIMETypeCandidates:          []string{manifest.DockerV2Schema2MediaType, manifest.DockerV2Schema1SignedMediaType, manifest.DockerV2Schema1MediaType},
+			},
+		},
+	} {
+		res, err := determineManifestConversion(determineManifestConversionInputs{
+			srcMIMEType:                    c.sourceType,
+			destSupportedManifestMIMETypes: c.destTypes,
+			requiredCompression:            &compression.Zstd,
+		})
+		require.NoError(t, err, c.description)
+		assert.Equal(t, c.expected, res, c.description)
+	}
+	for _, destTypes := range [][]string{supportS1S2, supportOnlyS1} {
+		_, err := determineManifestConversion(determineManifestConversionInputs{
+			srcMIMEType:                    manifest.DockerV2Schema2MediaType,
+			destSupportedManifestMIMETypes: destTypes,
+			requiredCompression:            &compression.Zstd,
+		})
+		assert.Error(t, err)
+	}
 }
 
 // fakeUnparsedImage is an implementation of types.UnparsedImage which only returns itself as a MIME type in Manifest,
@@ -232,7 +282,7 @@ func (f fakeUnparsedImage) Manifest(ctx context.Context) ([]byte, string, error)
 }
 
 func TestIsMultiImage(t *testing.T) {
-	// MIME type is available; more or less a smoke test, other cases are handled in manifest.MIMETypeIsMultiImage
+	// MIME type is available; more or less a smoke test, other cases are handled in manifest.IsIndex
 	for _, c := range []struct {
 		mt       string
 		expected bool
@@ -12,6 +12,8 @@ import (
 	internalManifest "github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/slices"
@@ -19,23 +21,25 @@ import (
 
 // copyMultipleImages copies some or all of an image list's instances, using
 // policyContext to validate source image admissibility.
-func (c *copier) copyMultipleImages(ctx context.Context, policyContext *signature.PolicyContext, options *Options, unparsedToplevel *image.UnparsedImage) (copiedManifest []byte, retErr error) {
+// With options.BestEffortInstances, it returns a non-nil *PartialListCopyError if some instances failed to copy
+// but the list was written.
+func (c *copier) copyMultipleImages(ctx context.Context, policyContext *signature.PolicyContext, options *Options, unparsedToplevel *image.UnparsedImage) (copiedManifest []byte, failures *PartialListCopyError, retErr error) {
 	// Parse the list and get a copy of the original value after it's re-encoded.
 	manifestList, manifestType, err := unparsedToplevel.Manifest(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("reading manifest list: %w", err)
+		return nil, nil, fmt.Errorf("reading manifest list: %w", err)
 	}
 	originalList, err := internalManifest.ListFromBlob(manifestList, manifestType)
 	if err != nil {
-		return nil, fmt.Errorf("parsing manifest list %q: %w", string(manifestList), err)
+		return nil, nil, fmt.Errorf("parsing manifest list %q: %w", string(manifestList), err)
 	}
 	updatedList := originalList.CloneInternal()
 
-	sigs, err := c.sourceSignatures(ctx, unparsedToplevel, options,
+	sigs, err := c.sourceSignatures(ctx, policyContext, unparsedToplevel, options,
 		"Getting image list signatures",
 		"Checking if image list destination supports signatures")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// If the destination is a digested reference, make a note of that, determine what digest value we're
@@ -46,10 +50,10 @@ func (c *copier) copyMultipleImages(ctx context.Context, policyContext *signatur
 			destIsDigestedReference = true
 			matches, err := manifest.MatchesDigest(manifestList, digested.Digest())
 			if err != nil {
-				return nil, fmt.Errorf("computing digest of source image's manifest: %w", err)
+				return nil, nil, fmt.Errorf("computing digest of source image's manifest: %w", err)
 			}
 			if !matches {
-				return nil, errors.New("Digest of source image's manifest would not match destination reference")
+				return nil, nil, errors.New("Digest of source image's manifest would not match destination reference")
 			}
 		}
 	}
@@ -78,11 +82,11 @@ func (c *copier) copyMultipleImages(ctx context.Context, policyContext *signatur
 	}
 	selectedListType, otherManifestMIMETypeCandidates, err := c.determineListConversion(manifestType, c.dest.SupportedManifestMIMETypes(), forceListMIMEType)
 	if err != nil {
-		return nil, fmt.Errorf("determining manifest list type to write to destination: %w", err)
+		return nil, nil, fmt.Errorf("determining manifest list type to write to destination: %w", err)
 	}
 	if selectedListType != originalList.MIMEType() {
 		if cannotModifyManifestListReason != "" {
-			return nil, fmt.Errorf("Manifest list must be converted to type %q to be written to destination, but we cannot modify it: %q", selectedListType, cannotModifyManifestListReason)
+			return nil, nil, fmt.Errorf("Manifest list must be converted to type %q to be written to destination, but we cannot modify it: %q", selectedListType, cannotModifyManifestListReason)
 		}
 	}
 
@@ -92,15 +96,39 @@ func (c *copier) copyMultipleImages(ctx context.Context, policyContext *signatur
 	if options.ImageListSelection == CopySpecificImages {
 		imagesToCopy = len(options.Instances)
 	}
+	var platformMatches []bool // Only set with CopyMatchingImages
+	filteredIndices := []int{} // Instances removed from the list because they don’t match options.Platforms
+	if options.ImageListSelection == CopyMatchingImages {
+		platformMatches, err = instancesMatchingPlatforms(updatedList, options.Platforms)
+		if err != nil {
+			return nil, nil, fmt.Errorf("matching manifest list instances against platforms: %w", err)
+		}
+		for i, matches := range platformMatches {
+			if !matches {
+				filteredIndices = append(filteredIndices, i)
+			}
+		}
+		imagesToCopy = len(instanceDigests) - len(filteredIndices)
+		if imagesToCopy == 0 {
+			return nil, nil, fmt.Errorf("no instance of the manifest list matches platforms %s", platformsDescription(options.Platforms))
+		}
+		if len(filteredIndices) != 0 && cannotModifyManifestListReason != "" {
+			return nil, nil, fmt.Errorf("Instances not matching platforms %s can't be removed from the manifest list, because we cannot modify it: %q",
+				platformsDescription(options.Platforms), cannotModifyManifestListReason)
+		}
+	}
 	c.Printf("Copying %d of %d images in list\n", imagesToCopy, len(instanceDigests))
 	updates := make([]manifest.ListUpdate, len(instanceDigests))
 	instancesCopied := 0
+	instancesAttempted := 0
+	failedInstances := []InstanceCopyError{}
+	failedIndices := []int{}
 	for i, instanceDigest := range instanceDigests {
-		if options.ImageListSelection == CopySpecificImages &&
-			!slices.Contains(options.Instances, instanceDigest) {
+		if (options.ImageListSelection == CopySpecificImages && !slices.Contains(options.Instances, instanceDigest)) ||
+			(platformMatches != nil && !platformMatches[i]) {
 			update, err := updatedList.Instance(instanceDigest)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			logrus.Debugf("Skipping instance %s (%d/%d)", instanceDigest, i+1, len(instanceDigests))
 			// Record the digest/size/type of the manifest that we didn't copy.
@@ -108,25 +136,74 @@ func (c *copier) copyMultipleImages(ctx context.Context, policyContext *signatur
 			continue
 		}
 		logrus.Debugf("Copying instance %s (%d/%d)", instanceDigest, i+1, len(instanceDigests))
-		c.Printf("Copying image %s (%d/%d)\n", instanceDigest, instancesCopied+1, imagesToCopy)
+		instancesAttempted++
+		c.Printf("Copying image %s (%d/%d)\n", instanceDigest, instancesAttempted, imagesToCopy)
 		unparsedInstance := image.UnparsedInstance(c.rawSource, &instanceDigest)
-		updatedManifest, updatedManifestType, updatedManifestDigest, err := c.copySingleImage(ctx, policyContext, options, unparsedToplevel, unparsedInstance, &instanceDigest)
+		var update manifest.ListUpdate
+		var err error
+		reused := false
+		if c.checkpoint != nil {
+			reused, update, err = c.tryReusingCheckpointedInstance(ctx, policyContext, unparsedInstance, instanceDigest)
+			if reused {
+				c.Printf("Skipping image %s: already copied\n", instanceDigest)
+			}
+		}
+		if err == nil && !reused {
+			var updatedManifest []byte
+			var updatedManifestType string
+			var updatedManifestDigest digest.Digest
+			updatedManifest, updatedManifestType, updatedManifestDigest, err = c.copySingleImage(ctx, policyContext, options, unparsedToplevel, unparsedInstance, &instanceDigest)
+			// Record the result of a possible conversion here.
+			update = manifest.ListUpdate{
+				Digest:    updatedManifestDigest,
+				Size:      int64(len(updatedManifest)),
+				MediaType: updatedManifestType,
+			}
+		}
 		if err != nil {
-			return nil, fmt.Errorf("copying image %d/%d from manifest list: %w", instancesCopied+1, imagesToCopy, err)
+			if !options.BestEffortInstances || ctx.Err() != nil {
+				return nil, nil, fmt.Errorf("copying image %d/%d from manifest list: %w", instancesAttempted, imagesToCopy, err)
+			}
+			logrus.Debugf("Copying instance %s failed, continuing with other instances: %v", instanceDigest, err)
+			c.Printf("Copying image %s failed: %v\n", instanceDigest, err)
+			failedInstances = append(failedInstances, InstanceCopyError{Digest: instanceDigest, Err: err})
+			failedIndices = append(failedIndices, i)
+			// Record the original digest/size/type; with RemoveFailedInstances, the instance is removed below.
+			update, err := updatedList.Instance(instanceDigest)
+			if err != nil {
+				return nil, nil, err
+			}
+			updates[i] = update
+			continue
 		}
 		instancesCopied++
-		// Record the result of a possible conversion here.
-		update := manifest.ListUpdate{
-			Digest:    updatedManifestDigest,
-			Size:      int64(len(updatedManifest)),
-			MediaType: updatedManifestType,
-		}
 		updates[i] = update
 	}
 
 	// Now reset the digest/size/types of the manifests in the list to account for any conversions that we made.
 	if err = updatedList.UpdateInstances(updates); err != nil {
-		return nil, fmt.Errorf("updating manifest list: %w", err)
+		return nil, nil, fmt.Errorf("updating manifest list: %w", err)
+	}
+	removedIndices := slices.Clone(filteredIndices)
+	if len(failedInstances) != 0 {
+		failures = &PartialListCopyError{
+			Failures:         failedInstances,
+			InstancesRemoved: options.FailedInstances == RemoveFailedInstances,
+		}
+		if instancesCopied == 0 {
+			return nil, nil, fmt.Errorf("copying images from manifest list: %w", *failures)
+		}
+		if failures.InstancesRemoved {
+			if cannotModifyManifestListReason != "" {
+				return nil, nil, fmt.Errorf("Failed instances can't be removed from the manifest list, because we cannot modify it: %q: %w", cannotModifyManifestListReason, *failures)
+			}
+			removedIndices = append(removedIndices, failedIndices...)
+		}
+	}
+	if len(removedIndices) != 0 {
+		if err := updatedList.RemoveInstances(removedIndices); err != nil {
+			return nil, nil, fmt.Errorf("removing instances from manifest list: %w", err)
+		}
 	}
 
 	// Iterate through supported list types, preferred format first.
@@ -141,25 +218,25 @@ func (c *copier) copyMultipleImages(ctx context.Context, policyContext *signatur
 		if thisListType != updatedList.MIMEType() {
 			attemptedList, err = updatedList.ConvertToMIMEType(thisListType)
 			if err != nil {
-				return nil, fmt.Errorf("converting manifest list to list with MIME type %q: %w", thisListType, err)
+				return nil, nil, fmt.Errorf("converting manifest list to list with MIME type %q: %w", thisListType, err)
 			}
 		}
 
 		// Check if the updates or a type conversion meaningfully changed the list of images
-		// by serializing them both so that we can compare them.
-		attemptedManifestList, err := attemptedList.Serialize()
+		// by serializing them both in the canonical form so that we can compare them.
+		attemptedManifestList, _, err := internalManifest.CanonicalListBlob(attemptedList)
 		if err != nil {
-			return nil, fmt.Errorf("encoding updated manifest list (%q: %#v): %w", updatedList.MIMEType(), updatedList.Instances(), err)
+			return nil, nil, fmt.Errorf("encoding updated manifest list (%q: %#v): %w", updatedList.MIMEType(), updatedList.Instances(), err)
 		}
-		originalManifestList, err := originalList.Serialize()
+		originalManifestList, _, err := internalManifest.CanonicalListBlob(originalList)
 		if err != nil {
-			return nil, fmt.Errorf("encoding original manifest list for comparison (%q: %#v): %w", originalList.MIMEType(), originalList.Instances(), err)
+			return nil, nil, fmt.Errorf("encoding original manifest list for comparison (%q: %#v): %w", originalList.MIMEType(), originalList.Instances(), err)
 		}
 
 		// If we can't just use the original value, but we have to change it, flag an error.
 		if !bytes.Equal(attemptedManifestList, originalManifestList) {
 			if cannotModifyManifestListReason != "" {
-				return nil, fmt.Errorf("Manifest list must be converted to type %q to be written to destination, but we cannot modify it: %q", thisListType, cannotModifyManifestListReason)
+				return nil, nil, fmt.Errorf("Manifest list must be converted to type %q to be written to destination, but we cannot modify it: %q", thisListType, cannotModifyManifestListReason)
 			}
 			logrus.Debugf("Manifest list has been updated")
 		} else {
@@ -168,31 +245,36 @@ func (c *copier) copyMultipleImages(ctx context.Context, policyContext *signatur
 		}
 
 		// Save the manifest list.
-		err = c.dest.PutManifest(ctx, attemptedManifestList, nil)
+		writtenManifestList, _, err := c.putManifest(ctx, attemptedManifestList, false, cannotModifyManifestListReason)
 		if err != nil {
 			logrus.Debugf("Upload of manifest list type %s failed: %v", thisListType, err)
+			var tooLarge types.ErrManifestTooLarge
+			if errors.As(err, &tooLarge) {
+				// Other formats are not going to be any smaller; report the typed error.
+				return nil, nil, fmt.Errorf("Uploading manifest list failed: %w", err)
+			}
 			errs = append(errs, fmt.Sprintf("%s(%v)", thisListType, err))
 			continue
 		}
 		errs = nil
-		manifestList = attemptedManifestList
+		manifestList = writtenManifestList
 		break
 	}
 	if errs != nil {
-		return nil, fmt.Errorf("Uploading manifest list failed, attempted the following formats: %s", strings.Join(errs, ", "))
+		return nil, nil, fmt.Errorf("Uploading manifest list failed, attempted the following formats: %s", strings.Join(errs, ", "))
 	}
 
 	// Sign the manifest list.
 	newSigs, err := c.createSignatures(ctx, manifestList, options.SignIdentity)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	sigs = append(sigs, newSigs...)
 
 	c.Printf("Storing list signatures\n")
-	if err := c.dest.PutSignaturesWithFormat(ctx, sigs, nil); err != nil {
-		return nil, fmt.Errorf("writing signatures: %w", err)
+	if err := c.putSignatures(ctx, sigs, nil); err != nil {
+		return nil, nil, fmt.Errorf("writing signatures: %w", err)
 	}
 
-	return manifestList, nil
+	return manifestList, failures, nil
 }
@@ -0,0 +1,204 @@
+package copy
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/pkg/registrytest"
+	storageTransport "github.com/containers/image/v5/storage"
+	"github.com/containers/storage"
+	"github.com/containers/storage/pkg/reexec"
+	storagetypes "github.com/containers/storage/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// containers-storage destinations apply layers in re-executed child processes.
+	if reexec.Init() {
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// partialPullFileSize is the size of each file in layers created by tarLayer.
+const partialPullFileSize = 256 * 1024
+
+// tarLayer returns an uncompressed layer containing a file with random contents for each of names;
+// files with the same name in layers created with the same contents map have the same contents.
+func tarLayer(t *testing.T, contents map[string][]byte, names ...string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		data, ok := contents[name]
+		if !ok {
+			data = make([]byte, partialPullFileSize)
+			_, err := rand.Read(data)
+			require.NoError(t, err)
+			contents[name] = data
+		}
+		err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(data)),
+			Typeflag: tar.TypeReg,
+		})
+		require.NoError(t, err)
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+	err := tw.Close()
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+// newPartialPullStore returns a containers-storage store using the overlay driver, which supports partial pulls,
+// with enable_partial_images set; the test is skipped if that is not possible.
+// The store is shut down when the test ends.
+func newPartialPullStore(t *testing.T) storage.Store {
+	if os.Getuid() != 0 {
+		t.Skip("The overlay driver requires root")
+	}
+	// The partial pull code reads enable_partial_images from the default store options, which are loaded only once per process.
+	opts, err := storagetypes.DefaultStoreOptionsAutoDetectUID()
+	require.NoError(t, err)
+	if opts.PullOptions["enable_partial_images"] != "true" {
+		t.Skip("enable_partial_images is not set in the default store options")
+	}
+
+	dir := t.TempDir()
+	store, err := storage.GetStore(storagetypes.StoreOptions{
+		RunRoot:         filepath.Join(dir, "run"),
+		GraphRoot:       filepath.Join(dir, "root"),
+		GraphDriverName: "overlay",
+		PullOptions:     opts.PullOptions,
+	})
+	if err != nil {
+		t.Skipf("The overlay driver is not usable: %v", err)
+	}
+	t.Cleanup(func() {
+		_, err := store.Shutdown(true)
+		assert.NoError(t, err)
+	})
+	return store
+}
+
+func TestImagePartialPull(t *testing.T) {
+	// This must happen before the default store options are loaded; see newPartialPullStore.
+	confDir := t.TempDir()
+	storageConf := filepath.Join(confDir, "storage.conf")
+	err := os.WriteFile(storageConf, []byte(fmt.Sprintf(`[storage]
+driver = "overlay"
+runroot = %q
+graphroot = %q
+
+[storage.options]
+pull_options = {enable_partial_images = "true"}
+`, filepath.Join(confDir, "run"), filepath.Join(confDir, "root"))), 0o644)
+	require.NoError(t, err)
+	t.Setenv("CONTAINERS_STORAGE_CONF", storageConf)
+
+	policyContext := newTestPolicyContext(t)
+	server := registrytest.NewServer(nil)
+	defer server.Close()
+
+	// Two zstd:chunked images, "v2" adding a single file to the files of "v1".
+	files := map[string][]byte{}
+	layerDigests := map[string]digest.Digest{}
+	for _, v := range []struct {
+		tag   string
+		files []string
+	}{
+		{"v1", []string{"a", "b", "c", "d", "e", "f", "g", "h"}},
+		{"v2", []string{"a", "b", "c", "d", "e", "f", "g", "h", "new"}},
+	} {
+		layer := tarLayer(t, files, v.files...)
+		srcDir := t.TempDir()
+		writeTestImage(t, srcDir, testImage{
+			manifestType: imgspecv1.MediaTypeImageManifest,
+			config:       []byte(fmt.Sprintf(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[%q]}}`, digest.FromBytes(layer))),
+			layers:       [][]byte{layer},
+		})
+		srcRef, err := directory.NewReference(srcDir)
+		require.NoError(t, err)
+		destRef, err := docker.ParseReference("//" + server.Host() + "/repo:" + v.tag)
+		require.NoError(t, err)
+		destCtx := server.SystemContext()
+		destCtx.BlobInfoCacheDir = t.TempDir()
+		destCtx.CompressionFormat = &compression.ZstdChunked
+		manifestBlob, err := Image(context.Background(), policyContext, destRef, srcRef, &Options{DestinationCtx: destCtx})
+		require.NoError(t, err)
+		m, err := manifest.OCI1FromManifest(manifestBlob)
+		require.NoError(t, err)
+		require.Len(t, m.Layers, 1)
+		layerDigests[v.tag] = m.Layers[0].Digest
+	}
+	v2Layer, ok := server.Blob("repo", layerDigests["v2"])
+	require.True(t, ok)
+
+	// pull copies tag to store, and returns the number of bytes of the layer of the image served by the registry.
+	pull := func(store storage.Store, tag string, enablePartialPull bool) int64 {
+		srcRef, err := docker.ParseReference("//" + server.Host() + "/repo:" + tag)
+		require.NoError(t, err)
+		destRef, err := storageTransport.Transport.ParseStoreReference(store, "localhost/repo:"+tag)
+		require.NoError(t, err)
+		srcCtx := server.SystemContext()
+		srcCtx.BlobInfoCacheDir = t.TempDir()
+		previousRequests := len(server.Requests())
+		_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+			SourceCtx:         srcCtx,
+			EnablePartialPull: enablePartialPull,
+		})
+		require.NoError(t, err)
+		res := int64(0)
+		for _, r := range server.Requests()[previousRequests:] {
+			if r.Method == "GET" && r.Path == "/v2/repo/blobs/"+layerDigests[tag].String() {
+				res += r.BytesWritten
+			}
+		}
+		return res
+	}
+
+	// Without EnablePartialPull, the layer of v2 is pulled completely, even if v1 is present.
+	store := newPartialPullStore(t)
+	pull(store, "v1", false)
+	fullBytes := pull(store, "v2", false)
+	assert.Equal(t, int64(len(v2Layer)), fullBytes)
+
+	// With EnablePartialPull, only the new file, and the metadata necessary to find it, is pulled.
+	store = newPartialPullStore(t)
+	pull(store, "v1", true)
+	partialBytes := pull(store, "v2", true)
+	t.Logf("Pulling v2 after v1 transferred %d bytes with EnablePartialPull, %d bytes without; %.1f%% saved",
+		partialBytes, fullBytes, 100*float64(fullBytes-partialBytes)/float64(fullBytes))
+	assert.Greater(t, partialBytes, int64(0))
+	assert.Less(t, partialBytes, 2*int64(partialPullFileSize))
+	assert.Less(t, partialBytes, fullBytes/4)
+
+	// The partially pulled layer is complete.
+	img, err := store.Image("localhost/repo:v2")
+	require.NoError(t, err)
+	mountPoint, err := store.Mount(img.TopLayer, "")
+	require.NoError(t, err)
+	defer func() {
+		_, err := store.Unmount(img.TopLayer, true)
+		assert.NoError(t, err)
+	}()
+	for name, contents := range files {
+		data, err := os.ReadFile(filepath.Join(mountPoint, name))
+		require.NoError(t, err, name)
+		assert.True(t, bytes.Equal(contents, data), fmt.Sprintf("Contents of %q", name))
+	}
+}
@@ -0,0 +1,74 @@
+package copy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	internalManifest "github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/pkg/platform"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// validatePlatformFilter returns an error if options.Platforms is inconsistent with options.ImageListSelection, or invalid.
+func validatePlatformFilter(options *Options) error {
+	if options.ImageListSelection != CopyMatchingImages {
+		if len(options.Platforms) != 0 {
+			return errors.New("options.Platforms can only be used with CopyMatchingImages")
+		}
+		return nil
+	}
+	if len(options.Platforms) == 0 {
+		return errors.New("CopyMatchingImages requires options.Platforms to be set")
+	}
+	for _, p := range options.Platforms {
+		if p.OS == "" || p.Architecture == "" {
+			return fmt.Errorf("invalid platform %s in options.Platforms: both OS and architecture must be set", platformDescription(p))
+		}
+	}
+	return nil
+}
+
+// platformDescription returns a human-readable description of p, in the usual os/architecture[/variant] format.
+func platformDescription(p imgspecv1.Platform) string {
+	res := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		res += "/" + p.Variant
+	}
+	if p.OSVersion != "" {
+		res += fmt.Sprintf(" (OS version %s)", p.OSVersion)
+	}
+	return res
+}
+
+// platformsDescription returns a human-readable description of platforms.
+func platformsDescription(platforms []imgspecv1.Platform) string {
+	descriptions := make([]string, 0, len(platforms))
+	for _, p := range platforms {
+		descriptions = append(descriptions, platformDescription(p))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// instancesMatchingPlatforms returns, for each instance of list (in the order of list.Instances()), whether it matches
+// at least one of platforms. Instances which don’t specify a platform never match.
+func instancesMatchingPlatforms(list internalManifest.List, platforms []imgspecv1.Platform) ([]bool, error) {
+	instancePlatforms := list.InstancePlatforms()
+	res := make([]bool, len(instancePlatforms))
+	for i, instancePlatform := range instancePlatforms {
+		if instancePlatform == nil {
+			continue
+		}
+		for _, p := range platforms {
+			matches, err := platform.MatchesPlatformFilter(*instancePlatform, p)
+			if err != nil {
+				return nil, err
+			}
+			if matches {
+				res[i] = true
+				break
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,134 @@
+package copy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	internalManifest "github.com/containers/image/v5/internal/manifest"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePlatformFilter(t *testing.T) {
+	for _, options := range []*Options{
+		{},
+		{ImageListSelection: CopyMatchingImages, Platforms: []imgspecv1.Platform{{OS: "linux", Architecture: "amd64"}}},
+		{ImageListSelection: CopyMatchingImages, Platforms: []imgspecv1.Platform{{OS: "linux", Architecture: "arm", Variant: "v7"}}},
+	} {
+		err := validatePlatformFilter(options)
+		assert.NoError(t, err, "%#v", options)
+	}
+	for _, options := range []*Options{
+		{Platforms: []imgspecv1.Platform{{OS: "linux", Architecture: "amd64"}}},
+		{ImageListSelection: CopyAllImages, Platforms: []imgspecv1.Platform{{OS: "linux", Architecture: "amd64"}}},
+		{ImageListSelection: CopyMatchingImages},
+		{ImageListSelection: CopyMatchingImages, Platforms: []imgspecv1.Platform{{OS: "linux"}}},
+		{ImageListSelection: CopyMatchingImages, Platforms: []imgspecv1.Platform{{Architecture: "amd64"}}},
+	} {
+		err := validatePlatformFilter(options)
+		assert.Error(t, err, "%#v", options)
+	}
+}
+
+func TestImageCopyMatchingImages(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// An OCI index with four instances
+	srcDir := t.TempDir()
+	platforms := []imgspecv1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		{OS: "linux", Architecture: "arm", Variant: "v7"},
+		{OS: "linux", Architecture: "s390x"},
+	}
+	instances := make([][]byte, len(platforms))
+	for i := range platforms {
+		instances[i] = writeTestImage(t, srcDir, testImage{layers: numberedLayers(i + 1), asInstance: true})
+	}
+	index := writeTestList(t, srcDir, imgspecv1.MediaTypeImageIndex, instances, platforms)
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+
+	copyTo := func(t *testing.T, options *Options) (string, []byte, error) {
+		destDir := t.TempDir()
+		destRef, err := directory.NewReference(destDir)
+		require.NoError(t, err)
+		res, err := Image(context.Background(), policyContext, destRef, srcRef, options)
+		return destDir, res, err
+	}
+	instanceExists := func(t *testing.T, destDir string, i int) bool {
+		_, err := os.Stat(filepath.Join(destDir, digest.FromBytes(instances[i]).Encoded()+".manifest.json"))
+		if err != nil {
+			require.ErrorIs(t, err, os.ErrNotExist)
+			return false
+		}
+		return true
+	}
+
+	// Two of the four instances are selected; a filter for arm/v7 is satisfied by the arm/v7 instance
+	destDir, res, err := copyTo(t, &Options{
+		ImageListSelection: CopyMatchingImages,
+		Platforms: []imgspecv1.Platform{
+			{OS: "linux", Architecture: "amd64"},
+			{OS: "linux", Architecture: "arm", Variant: "v7"},
+		},
+	})
+	require.NoError(t, err)
+	written, err := os.ReadFile(filepath.Join(destDir, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, written, res)
+	writtenList, err := internalManifest.ListFromBlob(written, imgspecv1.MediaTypeImageIndex)
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{digest.FromBytes(instances[0]), digest.FromBytes(instances[2])}, writtenList.Instances())
+	assert.Equal(t, []*imgspecv1.Platform{&platforms[0], &platforms[2]}, writtenList.InstancePlatforms())
+	for i, expected := range []bool{true, false, true, false} {
+		assert.Equal(t, expected, instanceExists(t, destDir, i), "instance %d", i)
+	}
+
+	// A filter without a variant matches any variant
+	_, res, err = copyTo(t, &Options{
+		ImageListSelection: CopyMatchingImages,
+		Platforms:          []imgspecv1.Platform{{OS: "linux", Architecture: "arm64"}},
+	})
+	require.NoError(t, err)
+	writtenList, err = internalManifest.ListFromBlob(res, imgspecv1.MediaTypeImageIndex)
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{digest.FromBytes(instances[1])}, writtenList.Instances())
+
+	// If all instances match, the index is not modified
+	_, res, err = copyTo(t, &Options{
+		ImageListSelection: CopyMatchingImages,
+		Platforms: []imgspecv1.Platform{
+			{OS: "linux", Architecture: "amd64"},
+			{OS: "linux", Architecture: "arm64"},
+			{OS: "linux", Architecture: "arm"},
+			{OS: "linux", Architecture: "s390x"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, index, res)
+
+	// No matching instance
+	destDir, res, err = copyTo(t, &Options{
+		ImageListSelection: CopyMatchingImages,
+		Platforms:          []imgspecv1.Platform{{OS: "linux", Architecture: "ppc64le"}},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "linux/ppc64le")
+	assert.Nil(t, res)
+	_, err = os.Stat(filepath.Join(destDir, "manifest.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Removing instances is not possible if digests must be preserved
+	_, _, err = copyTo(t, &Options{
+		ImageListSelection: CopyMatchingImages,
+		Platforms:          []imgspecv1.Platform{{OS: "linux", Architecture: "amd64"}},
+		PreserveDigests:    true,
+	})
+	assert.Error(t, err)
+}
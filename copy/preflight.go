@@ -0,0 +1,107 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"golang.org/x/exp/slices"
+)
+
+// PreflightError is returned by copy.Image if checks performed before copying any blobs fail.
+// It contains all problems detected by the checks, so that they can all be fixed at once.
+type PreflightError struct {
+	Errs []error
+}
+
+func (e PreflightError) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("preflight checks failed: %s", strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the individual errors, for errors.Is and errors.As.
+func (e PreflightError) Unwrap() []error {
+	return e.Errs
+}
+
+// preflight performs cheap checks whether copying from src to dest can succeed, before any blobs are transferred.
+// src and dest are checked if they implement private.PreflightChecker; this must be called with the objects
+// returned by the transports, because imagesource.FromPublic and imagedestination.FromPublic may hide that interface.
+// It returns a PreflightError listing all detected problems, or nil.
+func preflight(ctx context.Context, options *Options, src types.ImageSource, dest types.ImageDestination, unparsedToplevel types.UnparsedImage) error {
+	errs := []error{}
+	if checker, ok := src.(private.PreflightChecker); ok {
+		if err := checker.Preflight(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("source: %w", err))
+		}
+	}
+	if checker, ok := dest.(private.PreflightChecker); ok {
+		if err := checker.Preflight(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("destination: %w", err))
+		}
+	}
+	if err := preflightManifestFormat(ctx, options, dest, unparsedToplevel); err != nil {
+		errs = append(errs, err)
+	}
+	if err := preflightSBOM(options, dest); err != nil {
+		errs = append(errs, err)
+	}
+	if err := preflightSignatureStorage(ctx, options, dest); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) != 0 {
+		return PreflightError{Errs: errs}
+	}
+	return nil
+}
+
+// preflightManifestFormat returns an error if the destination certainly can’t accept the manifest format of a single-image source.
+func preflightManifestFormat(ctx context.Context, options *Options, dest types.ImageDestination, unparsedToplevel types.UnparsedImage) error {
+	_, srcType, err := unparsedToplevel.Manifest(ctx)
+	if err != nil {
+		return fmt.Errorf("reading source manifest: %w", err)
+	}
+	srcType = manifest.NormalizedMIMEType(srcType)
+	if manifest.IsIndex(srcType) {
+		// Which formats are needed depends on the instances we copy; leave that to the real copy.
+		return nil
+	}
+	destTypes := dest.SupportedManifestMIMETypes()
+	if len(destTypes) == 0 { // Anything goes
+		return nil
+	}
+
+	if options.ForceManifestMIMEType != "" {
+		if !slices.Contains(destTypes, options.ForceManifestMIMEType) {
+			return fmt.Errorf("destination does not accept the requested manifest type %s, only [%s]", options.ForceManifestMIMEType, strings.Join(destTypes, ", "))
+		}
+		return nil
+	}
+	if slices.Contains(destTypes, srcType) {
+		return nil
+	}
+	// Compare, and perhaps keep in sync with, the cannotModifyManifestReason computation in copySingleImage.
+	// Signatures are not considered here: reading them may be expensive, and may only happen after the policy check.
+	cannotModifyManifestReason := ""
+	if named := dest.Reference().DockerReference(); named != nil {
+		if _, ok := named.(reference.Digested); ok {
+			cannotModifyManifestReason = "Destination specifies a digest"
+		}
+	}
+	if options.PreserveDigests {
+		cannotModifyManifestReason = "Instructed to preserve digests"
+	}
+	if cannotModifyManifestReason != "" {
+		return fmt.Errorf("destination does not accept manifest type %s, only [%s], and the manifest can not be converted: %q",
+			srcType, strings.Join(destTypes, ", "), cannotModifyManifestReason)
+	}
+	return nil
+}
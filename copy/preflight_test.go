@@ -0,0 +1,118 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// preflightReference is a types.ImageReference whose sources and destinations fail Preflight with srcErr and destErr,
+// respectively, and whose destinations count PutBlob calls.
+type preflightReference struct {
+	types.ImageReference
+	srcErr       error
+	destErr      error
+	putBlobCalls *int32
+}
+
+func (ref preflightReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return preflightSource{ImageSource: src, err: ref.srcErr}, nil
+}
+
+func (ref preflightReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return preflightDestination{ImageDestination: dest, err: ref.destErr, putBlobCalls: ref.putBlobCalls}, nil
+}
+
+type preflightSource struct {
+	types.ImageSource
+	err error
+}
+
+func (s preflightSource) Preflight(ctx context.Context) error {
+	return s.err
+}
+
+type preflightDestination struct {
+	types.ImageDestination
+	err          error
+	putBlobCalls *int32
+}
+
+func (d preflightDestination) Preflight(ctx context.Context) error {
+	return d.err
+}
+
+func (d preflightDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	atomic.AddInt32(d.putBlobCalls, 1)
+	return d.ImageDestination.PutBlob(ctx, stream, inputInfo, cache, isConfig)
+}
+
+func TestImagePreflight(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// Create a docker schema2 source image with a single compressed layer.
+	srcDir := t.TempDir()
+	writeTestImage(t, srcDir, testImage{layers: [][]byte{gzipCompressed(t, []byte("layer contents"))}})
+	dirRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+
+	srcErr := errors.New("source is not accessible")
+	destErr := errors.New("destination does not allow pushing")
+	for _, c := range []struct {
+		name           string
+		srcErr         error
+		destErr        error
+		options        *Options
+		expectedErrs   []error
+		expectedFormat bool // A manifest format problem is expected to be reported
+	}{
+		{"success", nil, nil, &Options{}, nil, false},
+		// The OCI layout only accepts OCI manifests.
+		{"unaccepted forced format", nil, nil, &Options{ForceManifestMIMEType: manifest.DockerV2Schema2MediaType}, nil, true},
+		{"source fails", srcErr, nil, &Options{}, []error{srcErr}, false},
+		{"destination fails", nil, destErr, &Options{}, []error{destErr}, false},
+		{"unconvertible format", nil, nil, &Options{PreserveDigests: true}, nil, true},
+		{"everything fails", srcErr, destErr, &Options{PreserveDigests: true}, []error{srcErr, destErr}, true},
+	} {
+		layoutRef, err := layout.NewReference(t.TempDir(), "latest")
+		require.NoError(t, err, c.name)
+		destRef := preflightReference{ImageReference: layoutRef, destErr: c.destErr, putBlobCalls: new(int32)}
+		srcRef := preflightReference{ImageReference: dirRef, srcErr: c.srcErr}
+		_, err = Image(context.Background(), policyContext, destRef, srcRef, c.options)
+		if c.expectedErrs == nil && !c.expectedFormat {
+			assert.NoError(t, err, c.name)
+			continue
+		}
+		var preflightErr PreflightError
+		require.ErrorAs(t, err, &preflightErr, c.name)
+		expectedLen := len(c.expectedErrs)
+		if c.expectedFormat {
+			expectedLen++
+		}
+		assert.Len(t, preflightErr.Errs, expectedLen, c.name)
+		for _, e := range c.expectedErrs {
+			assert.ErrorIs(t, err, e, c.name)
+		}
+		if c.expectedFormat {
+			assert.ErrorContains(t, err, manifest.DockerV2Schema2MediaType, c.name)
+		}
+		assert.Equal(t, int32(0), atomic.LoadInt32(destRef.putBlobCalls), c.name)
+	}
+}
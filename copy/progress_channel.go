@@ -1,79 +1,338 @@
 package copy
 
 import (
+	"context"
 	"io"
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/containers/image/v5/types"
 )
 
-// progressReader is a reader that reports its progress to a types.ProgressProperties channel on an interval.
+// defaultProgressRateWindowIntervals is the default window of the moving average used to smooth rates, in progress intervals.
+const defaultProgressRateWindowIntervals = 5
+
+// readTimer measures the total time spent in Read calls of a single reader, including a call in progress.
+// All fields are accessed atomically.
+type readTimer struct {
+	completedNanos int64 // Time spent in completed Read calls
+	startedAt      int64 // time.UnixNano() of the start of the Read call in progress, or 0
+}
+
+// start records the start of a Read call.
+func (t *readTimer) start() {
+	atomic.StoreInt64(&t.startedAt, time.Now().UnixNano())
+}
+
+// stop records the end of a Read call.
+func (t *readTimer) stop() {
+	now := time.Now().UnixNano()
+	startedAt := atomic.SwapInt64(&t.startedAt, 0)
+	atomic.AddInt64(&t.completedNanos, now-startedAt)
+}
+
+// total returns the time spent in Read calls until now.
+func (t *readTimer) total(now time.Time) time.Duration {
+	res := atomic.LoadInt64(&t.completedNanos)
+	if startedAt := atomic.LoadInt64(&t.startedAt); startedAt != 0 && now.UnixNano() > startedAt {
+		res += now.UnixNano() - startedAt
+	}
+	return time.Duration(res)
+}
+
+// blobPipelineStats collects data about a single blob copy pipeline, for reporting to a progress channel.
+type blobPipelineStats struct {
+	sourceBytes uint64    // Bytes read from the source; accessed atomically
+	sourceRead  readTimer // Time spent in Read of the source
+	upstream    readTimer // Time spent in Read of the stream consumed by the destination, i.e. waiting for the source and processing
+}
+
+// sourceStatsReader is a reader that records data about reads from the source of a blob copy pipeline in a blobPipelineStats.
+type sourceStatsReader struct {
+	source io.Reader
+	stats  *blobPipelineStats
+}
+
+// Read reads from the source, recording the number of bytes and time spent.
+func (r *sourceStatsReader) Read(p []byte) (int, error) {
+	r.stats.sourceRead.start()
+	n, err := r.source.Read(p)
+	r.stats.sourceRead.stop()
+	atomic.AddUint64(&r.stats.sourceBytes, uint64(n))
+	return n, err
+}
+
+// progressAggregate tracks the state of all blob copies of a single copy operation which report to a progress channel.
+type progressAggregate struct {
+	mutex sync.Mutex
+	blobs map[*progressReader]progressAggregateEntry
+}
+
+// progressAggregateEntry is the state of a single blob copy in a progressAggregate.
+type progressAggregateEntry struct {
+	rate      float64 // Smoothed rate, in bytes per second
+	remaining int64   // Bytes remaining to be read from the source, or -1 if unknown
+}
+
+// newProgressAggregate returns an empty progressAggregate.
+func newProgressAggregate() *progressAggregate {
+	return &progressAggregate{blobs: map[*progressReader]progressAggregateEntry{}}
+}
+
+// update records the state of r, and returns the overall rate and ETA (0 if unknown) of all blobs.
+func (a *progressAggregate) update(r *progressReader, entry progressAggregateEntry) (float64, time.Duration) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.blobs[r] = entry
+	rate := 0.0
+	remaining := int64(0)
+	for _, e := range a.blobs {
+		rate += e.rate
+		if remaining != -1 {
+			if e.remaining == -1 {
+				remaining = -1
+			} else {
+				remaining += e.remaining
+			}
+		}
+	}
+	return rate, estimatedTime(remaining, rate)
+}
+
+// remove forgets r, and returns the overall rate of the remaining blobs.
+func (a *progressAggregate) remove(r *progressReader) float64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.blobs, r)
+	rate := 0.0
+	for _, e := range a.blobs {
+		rate += e.rate
+	}
+	return rate
+}
+
+// progressReader is a reader that reports its progress to a ProgressHandler on an interval.
+// It must be the last reader of a blob copy pipeline, read directly by the destination.
 type progressReader struct {
-	source       io.Reader
-	channel      chan<- types.ProgressProperties
-	interval     time.Duration
-	artifact     types.BlobInfo
-	lastUpdate   time.Time
-	offset       uint64
-	offsetUpdate uint64
+	ctx        context.Context
+	source     io.Reader
+	handler    ProgressHandler
+	interval   time.Duration
+	window     time.Duration
+	artifact   types.BlobInfo
+	layerIndex int
+	stats      *blobPipelineStats
+	aggregate  *progressAggregate
+	offset     uint64 // Accessed atomically
+
+	done     chan struct{} // Closed by reportDone to stop the reporting goroutine
+	finished chan struct{} // Closed by the reporting goroutine when it exits
+
+	// Only accessed by the reporting goroutine, and by reportDone after it exits.
+	lastUpdate      time.Time
+	lastOffset      uint64
+	lastSourceBytes uint64
+	lastSourceRead  time.Duration
+	lastUpstream    time.Duration
+	rate            float64
+	haveRate        bool
 }
 
 // newProgressReader creates a new progress reader for:
-// `source`:   The source when internally reading bytes
-// `channel`:  The reporter channel to which the progress will be sent
-// `interval`: The update interval to indicate how often the progress should update
-// `artifact`: The blob metadata which is currently being progressed
+// `ctx`:       The context of the copy operation; no events are sent after it is done
+// `source`:     The source when internally reading bytes
+// `handler`:    The handler to which the progress will be reported
+// `interval`:   The update interval to indicate how often the progress should update
+// `window`:     The window of the moving average used to smooth rates
+// `artifact`:   The blob metadata which is currently being progressed
+// `layerIndex`: The index of the layer in the source image, or -1 for a config
+// `stats`:      Data about the blob copy pipeline, updated by a sourceStatsReader at the start of the pipeline
+// `aggregate`:  The state of all blob copies of the copy operation
+//
+// Progress is reported on a steady tick, from a separate goroutine; the caller must call reportDone.
 func newProgressReader(
+	ctx context.Context,
 	source io.Reader,
-	channel chan<- types.ProgressProperties,
+	handler ProgressHandler,
 	interval time.Duration,
+	window time.Duration,
 	artifact types.BlobInfo,
+	layerIndex int,
+	stats *blobPipelineStats,
+	aggregate *progressAggregate,
 ) *progressReader {
-	// The progress reader constructor informs the progress channel
-	// that a new artifact will be read
-	channel <- types.ProgressProperties{
-		Event:    types.ProgressEventNewArtifact,
-		Artifact: artifact,
+	res := &progressReader{
+		ctx:        ctx,
+		source:     source,
+		handler:    handler,
+		interval:   interval,
+		window:     window,
+		artifact:   artifact,
+		layerIndex: layerIndex,
+		stats:      stats,
+		aggregate:  aggregate,
+		offset:     0,
+		done:       make(chan struct{}),
+		finished:   make(chan struct{}),
+		lastUpdate: time.Now(),
 	}
-	return &progressReader{
-		source:       source,
-		channel:      channel,
-		interval:     interval,
-		artifact:     artifact,
-		lastUpdate:   time.Now(),
-		offset:       0,
-		offsetUpdate: 0,
+	// The progress reader constructor informs the progress handler
+	// that a new artifact will be read
+	res.handler.HandleProgressEvent(ProgressEvent{
+		Kind:       LayerStarted,
+		Digest:     artifact.Digest,
+		LayerIndex: layerIndex,
+		Total:      artifact.Size,
+		legacy: &types.ProgressProperties{
+			Event:    types.ProgressEventNewArtifact,
+			Artifact: artifact,
+		},
+	})
+	go res.reportProgress()
+	return res
+}
+
+// reportProgress reports a LayerBytesTransferred event on every tick, until r.done is closed or r.ctx is done.
+func (r *progressReader) reportProgress() {
+	defer close(r.finished)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-r.ctx.Done():
+			return
+		case now := <-ticker.C:
+			properties := r.update(now)
+			// Options.Progress only receives ProgressEventRead events if data was read since the previous one.
+			var legacy *types.ProgressProperties
+			if properties.OffsetUpdate != 0 {
+				legacy = &properties
+			}
+			r.handler.HandleProgressEvent(ProgressEvent{
+				Kind:       LayerBytesTransferred,
+				Digest:     r.artifact.Digest,
+				LayerIndex: r.layerIndex,
+				Offset:     r.lastSourceBytes,
+				Total:      r.artifact.Size,
+				Rate:       properties.Rate,
+				ETA:        properties.ETA,
+				Bottleneck: properties.Bottleneck,
+				legacy:     legacy,
+			})
+		}
 	}
 }
 
-// reportDone indicates to the internal channel that the progress has been
-// finished
-func (r *progressReader) reportDone() {
-	r.channel <- types.ProgressProperties{
-		Event:        types.ProgressEventDone,
+// update updates the smoothed rate based on the progress since the last update at now, and returns a ProgressEventRead event.
+func (r *progressReader) update(now time.Time) types.ProgressProperties {
+	elapsed := now.Sub(r.lastUpdate)
+	offset := atomic.LoadUint64(&r.offset)
+	sourceBytes := atomic.LoadUint64(&r.stats.sourceBytes)
+	sourceRead := r.stats.sourceRead.total(now)
+	upstream := r.stats.upstream.total(now)
+
+	if elapsed > 0 {
+		currentRate := float64(sourceBytes-r.lastSourceBytes) / elapsed.Seconds()
+		r.rate = smoothedRate(r.rate, r.haveRate, currentRate, elapsed, r.window)
+		r.haveRate = true
+	}
+	remaining := int64(-1)
+	if r.artifact.Size >= 0 {
+		remaining = r.artifact.Size - int64(sourceBytes)
+		if remaining < 0 {
+			remaining = 0
+		}
+	}
+	overallRate, overallETA := r.aggregate.update(r, progressAggregateEntry{rate: r.rate, remaining: remaining})
+	res := types.ProgressProperties{
+		Event:        types.ProgressEventRead,
 		Artifact:     r.artifact,
-		Offset:       r.offset,
-		OffsetUpdate: r.offsetUpdate,
+		Offset:       offset,
+		OffsetUpdate: offset - r.lastOffset,
+		Rate:         r.rate,
+		ETA:          estimatedTime(remaining, r.rate),
+		OverallRate:  overallRate,
+		OverallETA:   overallETA,
+		Bottleneck:   pipelineBottleneck(elapsed, sourceRead-r.lastSourceRead, upstream-r.lastUpstream),
 	}
+	r.lastUpdate = now
+	r.lastOffset = offset
+	r.lastSourceBytes = sourceBytes
+	r.lastSourceRead = sourceRead
+	r.lastUpstream = upstream
+	return res
 }
 
-// Read continuously reads bytes into the progress reader and reports the
-// status via the internal channel
+// reportDone indicates to the progress handler that the progress has been
+// finished, with copyErr if the copy failed
+func (r *progressReader) reportDone(copyErr error) {
+	close(r.done)
+	<-r.finished
+	final := r.update(time.Now())
+	r.handler.HandleProgressEvent(ProgressEvent{
+		Kind:       LayerDone,
+		Digest:     r.artifact.Digest,
+		LayerIndex: r.layerIndex,
+		Offset:     r.lastSourceBytes,
+		Total:      r.artifact.Size,
+		Err:        copyErr,
+		legacy: &types.ProgressProperties{
+			Event:        types.ProgressEventDone,
+			Artifact:     r.artifact,
+			Offset:       final.Offset,
+			OffsetUpdate: final.OffsetUpdate,
+			Rate:         final.Rate,
+			OverallRate:  r.aggregate.remove(r),
+		},
+	})
+}
+
+// Read continuously reads bytes into the progress reader, recording the progress
+// to be reported via the internal channel
 func (r *progressReader) Read(p []byte) (int, error) {
+	r.stats.upstream.start()
 	n, err := r.source.Read(p)
-	r.offset += uint64(n)
-	r.offsetUpdate += uint64(n)
+	r.stats.upstream.stop()
+	atomic.AddUint64(&r.offset, uint64(n))
+	return n, err
+}
 
-	// Fire the progress reader in the provided interval
-	if time.Since(r.lastUpdate) > r.interval {
-		r.channel <- types.ProgressProperties{
-			Event:        types.ProgressEventRead,
-			Artifact:     r.artifact,
-			Offset:       r.offset,
-			OffsetUpdate: r.offsetUpdate,
-		}
-		r.lastUpdate = time.Now()
-		r.offsetUpdate = 0
+// smoothedRate returns an exponentially weighted moving average over window of rates,
+// updated with currentRate measured over elapsed; previousRate is only valid if havePrevious.
+func smoothedRate(previousRate float64, havePrevious bool, currentRate float64, elapsed, window time.Duration) float64 {
+	if !havePrevious || window <= 0 {
+		return currentRate
+	}
+	alpha := 1 - math.Exp(-elapsed.Seconds()/window.Seconds())
+	return previousRate + alpha*(currentRate-previousRate)
+}
+
+// estimatedTime returns the time necessary to read remaining bytes at rate, or 0 if unknown.
+func estimatedTime(remaining int64, rate float64) time.Duration {
+	if remaining < 0 || rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(remaining) / rate * float64(time.Second))
+}
+
+// pipelineBottleneck returns the stage of a blob copy pipeline which limited its throughput during elapsed,
+// given the time spent reading from the source, and the time the destination spent waiting for data (reading from the source and processing).
+// The rest of elapsed was spent by the destination writing the data.
+func pipelineBottleneck(elapsed, sourceRead, upstream time.Duration) types.ProgressBottleneck {
+	processing := upstream - sourceRead
+	destinationWrite := elapsed - upstream
+	switch {
+	case elapsed <= 0:
+		return types.ProgressBottleneckUnknown
+	case sourceRead >= processing && sourceRead >= destinationWrite:
+		return types.ProgressBottleneckSourceRead
+	case processing >= destinationWrite:
+		return types.ProgressBottleneckProcessing
+	default:
+		return types.ProgressBottleneckDestinationWrite
 	}
-	return n, err
 }
@@ -2,12 +2,18 @@ package copy
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"math"
+	"math/rand"
 	"testing"
 	"time"
 
+	"github.com/containers/image/v5/directory"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func newSUT(
@@ -23,7 +29,8 @@ func newSUT(
 		assert.Equal(t, res.Event, types.ProgressEventNewArtifact)
 		assert.Equal(t, res.Artifact, artifact)
 	}()
-	res := newProgressReader(reader, channel, duration, artifact)
+	handler := &progressChannelHandler{ctx: context.Background(), channel: channel}
+	res := newProgressReader(context.Background(), reader, handler, duration, 5*duration, artifact, 0, &blobPipelineStats{}, newProgressAggregate())
 
 	return res
 }
@@ -39,7 +46,7 @@ func TestNewProgressReader(t *testing.T) {
 		res := <-channel
 		assert.Equal(t, res.Event, types.ProgressEventDone)
 	}()
-	sut.reportDone()
+	sut.reportDone(nil)
 }
 
 func TestReadWithoutEvent(t *testing.T) {
@@ -66,15 +73,224 @@ func TestReadWithEvent(t *testing.T) {
 	assert.NotNil(t, sut)
 	b := []byte{0, 1, 2, 3, 4}
 
-	// When/Then
-	go func() {
-		res := <-channel
-		assert.Equal(t, res.Event, types.ProgressEventRead)
-		assert.Equal(t, res.Offset, uint64(5))
-		assert.Equal(t, res.OffsetUpdate, uint64(5))
-	}()
-	read, err := reader.Read(b)
+	// When
+	read, err := sut.Read(b)
 	assert.Equal(t, read, 5)
 	assert.Nil(t, err)
 
+	// Then: events are sent on a tick, independently of reads, but only if data was read since the previous event
+	res := <-channel
+	assert.Equal(t, res.Event, types.ProgressEventRead)
+	assert.Equal(t, res.Offset, uint64(5))
+	assert.Equal(t, res.OffsetUpdate, uint64(5))
+	time.Sleep(10 * time.Millisecond) // Many ticks without reads
+	read, err = sut.Read(b)
+	assert.Equal(t, read, 2)
+	assert.Nil(t, err)
+	res = <-channel
+	assert.Equal(t, res.Event, types.ProgressEventRead)
+	assert.Equal(t, res.Offset, uint64(7))
+	assert.Equal(t, res.OffsetUpdate, uint64(2))
+
+	go func() {
+		for res := range channel {
+			if res.Event == types.ProgressEventDone {
+				assert.Equal(t, res.Offset, uint64(7))
+				close(channel)
+			}
+		}
+	}()
+	sut.reportDone(nil)
+}
+
+func TestProgressReaderUpdate(t *testing.T) {
+	stats := &blobPipelineStats{}
+	aggregate := newProgressAggregate()
+	start := time.Now()
+	r := &progressReader{
+		interval:   time.Second,
+		window:     2 * time.Second,
+		artifact:   types.BlobInfo{Size: 1000},
+		stats:      stats,
+		aggregate:  aggregate,
+		lastUpdate: start,
+	}
+	other := &progressReader{}
+	aggregate.update(other, progressAggregateEntry{rate: 50, remaining: 450})
+
+	// The first update uses the current rate
+	stats.sourceBytes = 100
+	stats.sourceRead.completedNanos = int64(600 * time.Millisecond)
+	stats.upstream.completedNanos = int64(700 * time.Millisecond)
+	r.offset = 80
+	res := r.update(start.Add(time.Second))
+	assert.Equal(t, types.ProgressEventRead, res.Event)
+	assert.Equal(t, uint64(80), res.Offset)
+	assert.Equal(t, uint64(80), res.OffsetUpdate)
+	assert.Equal(t, 100.0, res.Rate)
+	assert.Equal(t, 9*time.Second, res.ETA)
+	assert.Equal(t, 150.0, res.OverallRate)
+	assert.Equal(t, 9*time.Second, res.OverallETA)
+	assert.Equal(t, types.ProgressBottleneckSourceRead, res.Bottleneck)
+
+	// Later updates are smoothed
+	stats.sourceBytes = 400
+	stats.sourceRead.completedNanos = int64(700 * time.Millisecond)
+	stats.upstream.completedNanos = int64(1000 * time.Millisecond)
+	r.offset = 300
+	res = r.update(start.Add(2 * time.Second))
+	assert.Equal(t, uint64(220), res.OffsetUpdate)
+	alpha := 1 - math.Exp(-0.5)
+	assert.InDelta(t, 100+alpha*200, res.Rate, 0.001)
+	assert.Equal(t, types.ProgressBottleneckDestinationWrite, res.Bottleneck)
+
+	// Done removes the blob from the aggregate
+	assert.Equal(t, 50.0, aggregate.remove(r))
+}
+
+func TestSmoothedRate(t *testing.T) {
+	// No previous value
+	assert.Equal(t, 10.0, smoothedRate(0, false, 10, time.Second, time.Second))
+	// No window
+	assert.Equal(t, 10.0, smoothedRate(100, true, 10, time.Second, 0))
+	// Moving towards the current rate, faster for longer intervals
+	short := smoothedRate(100, true, 10, time.Second, 10*time.Second)
+	long := smoothedRate(100, true, 10, 5*time.Second, 10*time.Second)
+	assert.True(t, short < 100 && short > long && long > 10)
+}
+
+func TestEstimatedTime(t *testing.T) {
+	assert.Equal(t, 2*time.Second, estimatedTime(200, 100))
+	assert.Equal(t, time.Duration(0), estimatedTime(0, 100))
+	assert.Equal(t, time.Duration(0), estimatedTime(-1, 100))
+	assert.Equal(t, time.Duration(0), estimatedTime(200, 0))
+}
+
+func TestPipelineBottleneck(t *testing.T) {
+	for _, c := range []struct {
+		elapsed, sourceRead, upstream time.Duration
+		expected                      types.ProgressBottleneck
+	}{
+		{0, 0, 0, types.ProgressBottleneckUnknown},
+		{time.Second, 900 * time.Millisecond, 950 * time.Millisecond, types.ProgressBottleneckSourceRead},
+		{time.Second, 100 * time.Millisecond, 900 * time.Millisecond, types.ProgressBottleneckProcessing},
+		{time.Second, 100 * time.Millisecond, 200 * time.Millisecond, types.ProgressBottleneckDestinationWrite},
+		{time.Second, 0, 0, types.ProgressBottleneckDestinationWrite},
+	} {
+		res := pipelineBottleneck(c.elapsed, c.sourceRead, c.upstream)
+		assert.Equal(t, c.expected, res, "%#v", c)
+	}
+}
+
+func TestReadTimer(t *testing.T) {
+	timer := readTimer{}
+	now := time.Now()
+	assert.Equal(t, time.Duration(0), timer.total(now))
+	timer.start()
+	timer.stop()
+	completed := timer.total(now)
+	assert.True(t, completed >= 0)
+	// A Read call in progress is included
+	timer.startedAt = now.Add(-time.Second).UnixNano()
+	assert.Equal(t, completed+time.Second, timer.total(now))
+}
+
+func TestProgressAggregate(t *testing.T) {
+	a := newProgressAggregate()
+	r1, r2 := &progressReader{}, &progressReader{}
+	rate, eta := a.update(r1, progressAggregateEntry{rate: 100, remaining: 1000})
+	assert.Equal(t, 100.0, rate)
+	assert.Equal(t, 10*time.Second, eta)
+	// An unknown size makes the overall ETA unknown
+	rate, eta = a.update(r2, progressAggregateEntry{rate: 100, remaining: -1})
+	assert.Equal(t, 200.0, rate)
+	assert.Equal(t, time.Duration(0), eta)
+	rate, eta = a.update(r2, progressAggregateEntry{rate: 100, remaining: 1000})
+	assert.Equal(t, 200.0, rate)
+	assert.Equal(t, 10*time.Second, eta)
+	assert.Equal(t, 100.0, a.remove(r1))
+	assert.Equal(t, 0.0, a.remove(r2))
+}
+
+// throttledReader reads from source in chunks of at most chunkSize, waiting for delay before each read.
+type throttledReader struct {
+	source    io.ReadCloser
+	chunkSize int
+	delay     time.Duration
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	if len(p) > r.chunkSize {
+		p = p[:r.chunkSize]
+	}
+	return r.source.Read(p)
+}
+
+func (r *throttledReader) Close() error {
+	return r.source.Close()
+}
+
+func TestImageProgressRate(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// A single multi-megabyte layer
+	srcDir := t.TempDir()
+	layer := make([]byte, 4*1024*1024)
+	_, err := rand.New(rand.NewSource(1)).Read(layer)
+	require.NoError(t, err)
+	writeTestImage(t, srcDir, testImage{layers: [][]byte{layer}})
+	srcDirRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	srcRef := faultInjectionReference{
+		ImageReference: srcDirRef,
+		faults: faultInjection{getBlob: func(stream io.ReadCloser, _ context.CancelFunc) io.ReadCloser {
+			// 4 MiB in 64 kiB chunks takes at least 64*5 ms
+			return &throttledReader{source: stream, chunkSize: 64 * 1024, delay: 5 * time.Millisecond}
+		}},
+	}
+	destRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+
+	progress := make(chan types.ProgressProperties)
+	events := make(chan []types.ProgressProperties)
+	go func() {
+		res := []types.ProgressProperties{}
+		for p := range progress {
+			if p.Artifact.Digest == digest.FromBytes(layer) {
+				res = append(res, p)
+			}
+		}
+		events <- res
+	}()
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		Progress:         progress,
+		ProgressInterval: 20 * time.Millisecond,
+	})
+	close(progress)
+	require.NoError(t, err)
+	layerEvents := <-events
+
+	sawRate, sawETA := false, false
+	var done *types.ProgressProperties
+	for i, e := range layerEvents {
+		switch e.Event {
+		case types.ProgressEventRead:
+			if e.Rate > 0 {
+				sawRate = true
+				assert.Greater(t, e.OverallRate, 0.0)
+			}
+			if e.ETA > 0 {
+				sawETA = true
+				assert.Greater(t, e.OverallETA, time.Duration(0))
+			}
+		case types.ProgressEventDone:
+			done = &layerEvents[i]
+		}
+	}
+	assert.True(t, sawRate)
+	assert.True(t, sawETA)
+	require.NotNil(t, done)
+	assert.Equal(t, uint64(len(layer)), done.Offset)
+	assert.Greater(t, done.Rate, 0.0)
 }
@@ -0,0 +1,172 @@
+package copy
+
+import (
+	"context"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// defaultProgressHandlerInterval is the interval of LayerBytesTransferred events if Options.ProgressInterval is not set.
+const defaultProgressHandlerInterval = time.Second
+
+// ProgressEventKind is the kind of a ProgressEvent.
+type ProgressEventKind int
+
+const (
+	// LayerStarted is sent when copying the data of a blob starts.
+	LayerStarted ProgressEventKind = iota
+	// LayerBytesTransferred is sent periodically while copying the data of a blob.
+	LayerBytesTransferred
+	// LayerSkipped is sent when a layer is not copied, e.g. because it already exists at the destination; see ProgressEvent.SkipReason.
+	// Neither LayerStarted nor LayerDone is sent for a skipped layer.
+	LayerSkipped
+	// LayerDone is sent when copying the data of a blob finishes, successfully or not; see ProgressEvent.Err.
+	LayerDone
+	// ConfigCopied is sent when the config of an image has been written to the destination, or was already written for another instance.
+	ConfigCopied
+	// ManifestWritten is sent when a manifest (of a single image, or a manifest list) has been written to the destination.
+	ManifestWritten
+)
+
+// LayerSkipReason is the reason why a layer was not copied, reported in LayerSkipped events.
+type LayerSkipReason string
+
+const (
+	// LayerSkippedAlreadyExists means that the layer, or an acceptable substitute, already exists at the destination.
+	LayerSkippedAlreadyExists LayerSkipReason = "already exists"
+	// LayerSkippedCheckpointed means that the layer was recorded as copied in Options.Checkpoint.
+	LayerSkippedCheckpointed LayerSkipReason = "already copied"
+	// LayerSkippedForeign means that the layer is a foreign layer, which is referenced by the destination without copying it.
+	LayerSkippedForeign LayerSkipReason = "foreign layer"
+)
+
+// ProgressEvent is a detailed progress report of a copy, sent to Options.ProgressHandler.
+//
+// Layers are identified by their digest and index in the source image; when copying several images of a manifest list,
+// the same (digest, index) pair can be reported for several images.
+// The config of an image is reported using LayerStarted, LayerBytesTransferred and LayerDone events with LayerIndex -1,
+// followed by ConfigCopied.
+// Layers which are pulled partially (e.g. zstd:chunked layers) are reported using only LayerStarted and LayerDone events.
+type ProgressEvent struct {
+	Kind       ProgressEventKind
+	Digest     digest.Digest // Digest of the blob in the source image; for ManifestWritten, the digest of the written manifest.
+	LayerIndex int           // Index of the layer in the source image, or -1 for a config or a manifest.
+
+	// Offset is the number of bytes read from the source (LayerBytesTransferred and LayerDone),
+	// out of Total (the size of the blob in the source, or -1 if unknown).
+	// Note that the data written to the destination can be larger or smaller, e.g. if the layer is being recompressed.
+	Offset uint64
+	Total  int64
+	// Rate is the smoothed rate of reading from the source, in bytes per second, and ETA is the estimated time remaining
+	// (0 if unknown); both are only set in LayerBytesTransferred events.
+	Rate float64
+	ETA  time.Duration
+	// Bottleneck is the stage of the copy which limited the throughput since the previous LayerBytesTransferred event
+	// (e.g. ProgressBottleneckProcessing when the layer is being compressed, or ProgressBottleneckDestinationWrite
+	// when the upload is the slowest part); only set in LayerBytesTransferred events.
+	Bottleneck types.ProgressBottleneck
+
+	SkipReason LayerSkipReason // Only set in LayerSkipped events.
+	Err        error           // Only set in LayerDone events, if copying the blob failed.
+
+	// legacy is the equivalent event for Options.Progress, or nil if there is none.
+	legacy *types.ProgressProperties
+}
+
+// ProgressHandler receives detailed progress reports of a copy.
+type ProgressHandler interface {
+	// HandleProgressEvent is called for every progress event.
+	// It may be called concurrently from several goroutines, and it should return quickly; the copy is blocked until it does.
+	// The event is not modified by the caller, so it can be retained, or passed to another goroutine.
+	HandleProgressEvent(event ProgressEvent)
+}
+
+// progressChannelHandler is a ProgressHandler which reports events to an Options.Progress channel.
+type progressChannelHandler struct {
+	ctx     context.Context
+	channel chan<- types.ProgressProperties
+}
+
+// HandleProgressEvent sends the equivalent of event, if any, to h.channel, unless h.ctx is done first.
+// The consumer of the channel may stop reading when the copy is canceled; we must not block forever in that case.
+func (h *progressChannelHandler) HandleProgressEvent(event ProgressEvent) {
+	if event.legacy == nil {
+		return
+	}
+	select {
+	case h.channel <- *event.legacy:
+	case <-h.ctx.Done():
+	}
+}
+
+// multiProgressHandler is a ProgressHandler which reports events to several handlers.
+type multiProgressHandler []ProgressHandler
+
+// HandleProgressEvent reports event to all handlers in h.
+func (h multiProgressHandler) HandleProgressEvent(event ProgressEvent) {
+	for _, handler := range h {
+		handler.HandleProgressEvent(event)
+	}
+}
+
+// progressHandlerForOptions returns a ProgressHandler which reports to options.ProgressHandler and options.Progress
+// (until ctx is done), or nil if neither is used, and the interval of LayerBytesTransferred events.
+func progressHandlerForOptions(ctx context.Context, options *Options) (ProgressHandler, time.Duration) {
+	handlers := multiProgressHandler{}
+	if options.Progress != nil && options.ProgressInterval > 0 {
+		handlers = append(handlers, &progressChannelHandler{ctx: ctx, channel: options.Progress})
+	}
+	if options.ProgressHandler != nil {
+		handlers = append(handlers, options.ProgressHandler)
+	}
+	interval := options.ProgressInterval
+	if interval <= 0 {
+		interval = defaultProgressHandlerInterval
+	}
+	switch len(handlers) {
+	case 0:
+		return nil, interval
+	case 1:
+		return handlers[0], interval
+	default:
+		return handlers, interval
+	}
+}
+
+// reportProgress sends event to c.progressHandler, if any.
+func (c *copier) reportProgress(event ProgressEvent) {
+	if c.progressHandler != nil {
+		c.progressHandler.HandleProgressEvent(event)
+	}
+}
+
+// reportLayerSkipped reports that a layer with srcInfo at layerIndex was not copied because of reason.
+func (c *copier) reportLayerSkipped(srcInfo types.BlobInfo, layerIndex int, reason LayerSkipReason) {
+	event := ProgressEvent{
+		Kind:       LayerSkipped,
+		Digest:     srcInfo.Digest,
+		LayerIndex: layerIndex,
+		Total:      srcInfo.Size,
+		SkipReason: reason,
+	}
+	if reason != LayerSkippedForeign { // Options.Progress has never reported foreign layers.
+		event.legacy = &types.ProgressProperties{
+			Event:    types.ProgressEventSkipped,
+			Artifact: srcInfo,
+		}
+	}
+	c.reportProgress(event)
+}
+
+// reportPartialLayerCopied reports that a layer with srcInfo at layerIndex has been pulled partially.
+// Options.Progress has never reported partial pulls, so this is only visible to Options.ProgressHandler.
+func (c *copier) reportPartialLayerCopied(srcInfo types.BlobInfo, layerIndex int) {
+	c.reportProgress(ProgressEvent{Kind: LayerStarted, Digest: srcInfo.Digest, LayerIndex: layerIndex, Total: srcInfo.Size})
+	event := ProgressEvent{Kind: LayerDone, Digest: srcInfo.Digest, LayerIndex: layerIndex, Total: srcInfo.Size}
+	if srcInfo.Size != -1 {
+		event.Offset = uint64(srcInfo.Size)
+	}
+	c.reportProgress(event)
+}
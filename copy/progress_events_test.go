@@ -0,0 +1,194 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// progressRecorder is a ProgressHandler which records all events.
+type progressRecorder struct {
+	mutex  sync.Mutex
+	events []ProgressEvent
+}
+
+func (r *progressRecorder) HandleProgressEvent(event ProgressEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+}
+
+// eventsFor returns the recorded events with digest d.
+func (r *progressRecorder) eventsFor(d digest.Digest) []ProgressEvent {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	res := []ProgressEvent{}
+	for _, e := range r.events {
+		if e.Digest == d {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func TestProgressHandlerForOptions(t *testing.T) {
+	channel := make(chan types.ProgressProperties)
+	recorder := &progressRecorder{}
+
+	handler, interval := progressHandlerForOptions(context.Background(), &Options{})
+	assert.Nil(t, handler)
+	assert.Equal(t, defaultProgressHandlerInterval, interval)
+
+	// Progress is only used with a ProgressInterval
+	handler, _ = progressHandlerForOptions(context.Background(), &Options{Progress: channel})
+	assert.Nil(t, handler)
+	handler, interval = progressHandlerForOptions(context.Background(), &Options{Progress: channel, ProgressInterval: time.Millisecond})
+	assert.IsType(t, &progressChannelHandler{}, handler)
+	assert.Equal(t, time.Millisecond, interval)
+
+	handler, interval = progressHandlerForOptions(context.Background(), &Options{ProgressHandler: recorder})
+	assert.Equal(t, recorder, handler)
+	assert.Equal(t, defaultProgressHandlerInterval, interval)
+
+	handler, _ = progressHandlerForOptions(context.Background(), &Options{ProgressHandler: recorder, Progress: channel, ProgressInterval: time.Millisecond})
+	require.IsType(t, multiProgressHandler{}, handler)
+	assert.Len(t, handler, 2)
+}
+
+func TestProgressChannelHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	channel := make(chan types.ProgressProperties, 1)
+	handler := &progressChannelHandler{ctx: ctx, channel: channel}
+
+	// Events without a legacy equivalent are not sent
+	handler.HandleProgressEvent(ProgressEvent{Kind: ManifestWritten})
+	assert.Len(t, channel, 0)
+
+	handler.HandleProgressEvent(ProgressEvent{Kind: LayerSkipped, legacy: &types.ProgressProperties{Event: types.ProgressEventSkipped}})
+	require.Len(t, channel, 1)
+	assert.Equal(t, types.ProgressEventSkipped, (<-channel).Event)
+
+	// Sending does not block after the context is canceled
+	handler.HandleProgressEvent(ProgressEvent{Kind: LayerSkipped, legacy: &types.ProgressProperties{Event: types.ProgressEventSkipped}})
+	cancel()
+	handler.HandleProgressEvent(ProgressEvent{Kind: LayerSkipped, legacy: &types.ProgressProperties{Event: types.ProgressEventSkipped}})
+}
+
+func TestImageProgressHandler(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// A single compressed layer, which is copied without modification
+	srcDir := t.TempDir()
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	uncompressed := make([]byte, 1024*1024)
+	_, err := rand.New(rand.NewSource(1)).Read(uncompressed)
+	require.NoError(t, err)
+	layerBuffer := bytes.Buffer{}
+	compressor, err := compression.CompressStream(&layerBuffer, compression.Gzip, nil)
+	require.NoError(t, err)
+	_, err = compressor.Write(uncompressed)
+	require.NoError(t, err)
+	err = compressor.Close()
+	require.NoError(t, err)
+	layer := layerBuffer.Bytes()
+	configDigest, layerDigest := digest.FromBytes(config), digest.FromBytes(layer)
+	writeTestImage(t, srcDir, testImage{
+		manifestType:    imgspecv1.MediaTypeImageManifest,
+		config:          config,
+		layers:          [][]byte{layer},
+		layerMediaTypes: []string{imgspecv1.MediaTypeImageLayerGzip},
+	})
+	srcDirRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	srcRef := faultInjectionReference{
+		ImageReference: srcDirRef,
+		faults: faultInjection{getBlob: func(stream io.ReadCloser, _ context.CancelFunc) io.ReadCloser {
+			// 1 MiB in 64 kiB chunks takes at least 16*5 ms
+			return &throttledReader{source: stream, chunkSize: 64 * 1024, delay: 5 * time.Millisecond}
+		}},
+	}
+	destRef, err := layout.NewReference(t.TempDir(), "latest")
+	require.NoError(t, err)
+
+	// The first copy copies everything; Progress keeps working alongside ProgressHandler.
+	recorder := &progressRecorder{}
+	progress := make(chan types.ProgressProperties)
+	legacyEvents := make(chan []types.ProgressEvent)
+	go func() {
+		res := []types.ProgressEvent{}
+		for p := range progress {
+			if p.Artifact.Digest == layerDigest {
+				res = append(res, p.Event)
+			}
+		}
+		legacyEvents <- res
+	}()
+	copiedManifest, err := Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		Progress:         progress,
+		ProgressInterval: 10 * time.Millisecond,
+		ProgressHandler:  recorder,
+	})
+	close(progress)
+	require.NoError(t, err)
+
+	events := recorder.eventsFor(layerDigest)
+	require.GreaterOrEqual(t, len(events), 3)
+	assert.Equal(t, LayerStarted, events[0].Kind)
+	transferred := events[1 : len(events)-1]
+	for i, e := range transferred {
+		assert.Equal(t, LayerBytesTransferred, e.Kind)
+		assert.LessOrEqual(t, e.Offset, uint64(len(layer)))
+		if i > 0 {
+			assert.GreaterOrEqual(t, e.Offset, transferred[i-1].Offset)
+		}
+	}
+	done := events[len(events)-1]
+	assert.Equal(t, LayerDone, done.Kind)
+	assert.Equal(t, uint64(len(layer)), done.Offset)
+	assert.NoError(t, done.Err)
+	for _, e := range events {
+		assert.Equal(t, 0, e.LayerIndex)
+		assert.Equal(t, int64(len(layer)), e.Total)
+	}
+
+	configEvents := recorder.eventsFor(configDigest)
+	require.NotEmpty(t, configEvents)
+	assert.Equal(t, LayerStarted, configEvents[0].Kind)
+	assert.Equal(t, ConfigCopied, configEvents[len(configEvents)-1].Kind)
+	for _, e := range configEvents {
+		assert.Equal(t, -1, e.LayerIndex)
+	}
+
+	copiedManifestDigest, err := manifest.Digest(copiedManifest)
+	require.NoError(t, err)
+	assert.Equal(t, []ProgressEvent{{Kind: ManifestWritten, Digest: copiedManifestDigest, LayerIndex: -1, Total: int64(len(copiedManifest))}},
+		recorder.eventsFor(copiedManifestDigest))
+
+	legacy := <-legacyEvents
+	require.GreaterOrEqual(t, len(legacy), 2)
+	assert.Equal(t, types.ProgressEventNewArtifact, legacy[0])
+	assert.Equal(t, types.ProgressEventDone, legacy[len(legacy)-1])
+
+	// The second copy skips the layer
+	recorder = &progressRecorder{}
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{ProgressHandler: recorder})
+	require.NoError(t, err)
+	assert.Equal(t, []ProgressEvent{{Kind: LayerSkipped, Digest: layerDigest, LayerIndex: 0, Total: int64(len(layer)), SkipReason: LayerSkippedAlreadyExists,
+		legacy: &types.ProgressProperties{Event: types.ProgressEventSkipped, Artifact: types.BlobInfo{
+			Digest: layerDigest, Size: int64(len(layer)), MediaType: imgspecv1.MediaTypeImageLayerGzip, CompressionAlgorithm: &compression.Gzip,
+		}}}}, recorder.eventsFor(layerDigest))
+}
@@ -0,0 +1,80 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/slices"
+)
+
+// emptyArtifactConfig is the config blob of referrer artifacts; artifacts have no meaningful config,
+// so this is the smallest valid JSON object.
+var emptyArtifactConfig = []byte("{}")
+
+// checkReferrerArtifactsSupported returns an error if dest can’t store referrer artifacts.
+func checkReferrerArtifactsSupported(dest types.ImageDestination) error {
+	// The artifact is stored as an OCI manifest, in addition to the manifest it refers to; that requires
+	// a destination which can store multiple manifests.
+	if !supportsMultipleImages(dest) {
+		return errors.New("destination does not support storing more than one manifest")
+	}
+	if destTypes := dest.SupportedManifestMIMETypes(); len(destTypes) != 0 && !slices.Contains(destTypes, imgspecv1.MediaTypeImageManifest) {
+		return fmt.Errorf("destination does not accept OCI manifests, only [%s]", strings.Join(destTypes, ", "))
+	}
+	return nil
+}
+
+// putReferrerArtifact stores an OCI artifact of artifactType, consisting of layers (which must already exist in c.dest),
+// with a subject referring to subjectManifest, in c.dest.
+// It must be called after subjectManifest has been written, and before c.dest.Commit.
+func (c *copier) putReferrerArtifact(ctx context.Context, subjectManifest []byte, artifactType string, layers []imgspecv1.Descriptor) error {
+	subject := imgspecv1.Descriptor{
+		MediaType: manifest.GuessMIMEType(subjectManifest),
+		Digest:    digest.FromBytes(subjectManifest),
+		Size:      int64(len(subjectManifest)),
+	}
+
+	config, err := c.putArtifactBlob(ctx, emptyArtifactConfig, true)
+	if err != nil {
+		return fmt.Errorf("writing artifact config: %w", err)
+	}
+	config.MediaType = artifactType
+
+	m := manifest.OCI1FromComponents(config, layers)
+	m.Subject = &subject
+	manifestBlob, err := m.Serialize()
+	if err != nil {
+		return fmt.Errorf("creating artifact manifest: %w", err)
+	}
+	manifestDigest := digest.FromBytes(manifestBlob)
+	if err := c.dest.PutManifest(ctx, manifestBlob, &manifestDigest); err != nil {
+		return fmt.Errorf("writing artifact manifest: %w", err)
+	}
+	return nil
+}
+
+// putArtifactBlob writes contents to c.dest, and returns a descriptor of the written blob, without a MediaType.
+func (c *copier) putArtifactBlob(ctx context.Context, contents []byte, isConfig bool) (imgspecv1.Descriptor, error) {
+	uploaded, err := c.dest.PutBlobWithOptions(ctx, bytes.NewReader(contents), types.BlobInfo{
+		Digest: digest.FromBytes(contents),
+		Size:   int64(len(contents)),
+	}, private.PutBlobOptions{
+		Cache:    c.blobInfoCache,
+		IsConfig: isConfig,
+	})
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	return imgspecv1.Descriptor{
+		Digest: uploaded.Digest,
+		Size:   uploaded.Size,
+	}, nil
+}
@@ -0,0 +1,91 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultImageRetryDelay is used if Options.ImageRetryDelay is not set.
+const defaultImageRetryDelay = 2 * time.Second
+
+// retryImageCopy calls copyOnce, and then retries it up to options.ImageRetries times, as long as it fails
+// with an error which seems to be transient. Partial results of Options.BestEffortInstances are never retried.
+func retryImageCopy(ctx context.Context, options *Options, copyOnce func() ([]byte, error)) ([]byte, error) {
+	delay := options.ImageRetryDelay
+	if delay == 0 {
+		delay = defaultImageRetryDelay
+	}
+	for attempt := 0; ; attempt++ {
+		res, err := copyOnce()
+		if err == nil || attempt >= options.ImageRetries || !isRetryableCopyError(err) {
+			return res, err
+		}
+		// A partial result of Options.BestEffortInstances has already been committed; the failures of individual
+		// instances may be transient, but retrying would copy the whole image again, and replace the committed result.
+		var partialErr PartialListCopyError
+		if errors.As(err, &partialErr) {
+			return res, err
+		}
+		logrus.Infof("Copying image failed (attempt %d of %d), retrying in %s: %v", attempt+1, options.ImageRetries+1, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting to retry image copy: %w (previous error: %v)", ctx.Err(), err)
+		}
+		delay *= 2
+	}
+}
+
+// isRetryableCopyError returns true if err seems to be a transient failure, so that retrying the copy may succeed.
+func isRetryableCopyError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var errs errcode.Errors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			if isRetryableCopyError(e) {
+				return true
+			}
+		}
+		return false
+	}
+	var ec errcode.ErrorCoder
+	if errors.As(err, &ec) {
+		switch ec.ErrorCode() {
+		case errcode.ErrorCodeUnavailable, errcode.ErrorCodeTooManyRequests:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		switch errno {
+		case syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.ECONNABORTED, syscall.ETIMEDOUT,
+			syscall.ENETDOWN, syscall.ENETUNREACH, syscall.ENETRESET, syscall.EHOSTDOWN, syscall.EHOSTUNREACH,
+			syscall.EPIPE, syscall.EINTR, syscall.EAGAIN:
+			return true
+		default:
+			return false
+		}
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return false
+}
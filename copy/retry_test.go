@@ -0,0 +1,186 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/distribution/registry/api/errcode"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingManifestReference is a types.ImageReference whose destinations count layer PutBlob calls,
+// and fail PutManifest with manifestErr for the first manifestFailures calls.
+type failingManifestReference struct {
+	types.ImageReference
+	putLayerCalls    *int32
+	manifestCalls    *int32
+	manifestFailures int32
+	manifestErr      error
+}
+
+func (ref failingManifestReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return failingManifestDestination{ImageDestination: dest, ref: ref}, nil
+}
+
+type failingManifestDestination struct {
+	types.ImageDestination
+	ref failingManifestReference
+}
+
+func (d failingManifestDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	if !isConfig {
+		atomic.AddInt32(d.ref.putLayerCalls, 1)
+	}
+	return d.ImageDestination.PutBlob(ctx, stream, inputInfo, cache, isConfig)
+}
+
+func (d failingManifestDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	if atomic.AddInt32(d.ref.manifestCalls, 1) <= d.ref.manifestFailures {
+		return d.ref.manifestErr
+	}
+	return d.ImageDestination.PutManifest(ctx, m, instanceDigest)
+}
+
+func TestImageRetries(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// Create a source image with two compressed layers, so that they are copied unmodified
+	// and the destination can find them if they were copied by a previous attempt.
+	srcDir := t.TempDir()
+	layers := [][]byte{gzipCompressed(t, []byte("layer 1 contents")), gzipCompressed(t, []byte("layer 2 contents"))}
+	writeTestImage(t, srcDir, testImage{
+		manifestType:    imgspecv1.MediaTypeImageManifest,
+		layers:          layers,
+		layerMediaTypes: []string{imgspecv1.MediaTypeImageLayerGzip, imgspecv1.MediaTypeImageLayerGzip},
+	})
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name             string
+		retries          int
+		manifestFailures int32
+		manifestErr      error
+		success          bool
+		manifestCalls    int32
+	}{
+		{"transient failure, retried", 1, 1, fmt.Errorf("writing manifest: %w", syscall.ECONNRESET), true, 2},
+		{"transient failure, no retries", 0, 1, syscall.ECONNRESET, false, 1},
+		{"transient failures, retries exhausted", 2, 3, errcode.ErrorCodeUnavailable, false, 3},
+		{"non-transient failure", 3, 1, errors.New("invalid manifest"), false, 1},
+	} {
+		destRef, err := layout.NewReference(t.TempDir(), "latest")
+		require.NoError(t, err, c.name)
+		ref := failingManifestReference{
+			ImageReference:   destRef,
+			putLayerCalls:    new(int32),
+			manifestCalls:    new(int32),
+			manifestFailures: c.manifestFailures,
+			manifestErr:      c.manifestErr,
+		}
+		_, err = Image(context.Background(), policyContext, ref, srcRef, &Options{
+			DestinationCtx:  &types.SystemContext{BlobInfoCacheDir: t.TempDir()},
+			ImageRetries:    c.retries,
+			ImageRetryDelay: time.Millisecond,
+		})
+		if c.success {
+			assert.NoError(t, err, c.name)
+		} else {
+			assert.ErrorIs(t, err, c.manifestErr, c.name)
+		}
+		assert.Equal(t, c.manifestCalls, atomic.LoadInt32(ref.manifestCalls), c.name)
+		// Layers are only uploaded by the first attempt; further attempts reuse them.
+		assert.Equal(t, int32(len(layers)), atomic.LoadInt32(ref.putLayerCalls), c.name)
+	}
+
+	// Invalid ImageRetries value
+	destRef, err := layout.NewReference(t.TempDir(), "latest")
+	require.NoError(t, err)
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{ImageRetries: -1})
+	assert.Error(t, err)
+}
+
+func TestImageRetriesBestEffortInstances(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	srcDir := t.TempDir()
+	instance1 := writeTestImage(t, srcDir, testImage{layers: numberedLayers(1), asInstance: true})
+	instance2 := writeTestImage(t, srcDir, testImage{layers: numberedLayers(2), asInstance: true})
+	writeTestList(t, srcDir, manifest.DockerV2ListMediaType, [][]byte{instance1, instance2},
+		[]imgspecv1.Platform{{OS: "linux", Architecture: "arm64"}, {OS: "linux", Architecture: "amd64"}})
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+
+	destDir := t.TempDir()
+	destRef, err := directory.NewReference(destDir)
+	require.NoError(t, err)
+	ref := failingManifestReference{
+		ImageReference:   destRef,
+		putLayerCalls:    new(int32),
+		manifestCalls:    new(int32),
+		manifestFailures: 1,
+		manifestErr:      syscall.ECONNRESET,
+	}
+	// The transient failure of an instance is reported as a partial result, which is not retried.
+	res, err := Image(context.Background(), policyContext, ref, srcRef, &Options{
+		ImageListSelection:  CopyAllImages,
+		BestEffortInstances: true,
+		ImageRetries:        2,
+		ImageRetryDelay:     time.Millisecond,
+	})
+	var partialErr PartialListCopyError
+	require.ErrorAs(t, err, &partialErr)
+	require.Len(t, partialErr.Failures, 1)
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	require.NotNil(t, res)
+	written, err := os.ReadFile(filepath.Join(destDir, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, written, res)
+	// Two instance manifests, one of which failed, and the list
+	assert.Equal(t, int32(3), atomic.LoadInt32(ref.manifestCalls))
+}
+
+func TestIsRetryableCopyError(t *testing.T) {
+	for _, c := range []struct {
+		err       error
+		retryable bool
+	}{
+		{errors.New("some error"), false},
+		{context.Canceled, false},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), false},
+		{syscall.ECONNRESET, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{syscall.ENOENT, false},
+		{fmt.Errorf("reading blob: %w", io.ErrUnexpectedEOF), true},
+		{&net.DNSError{Err: "timeout", IsTimeout: true}, true},
+		{&net.DNSError{Err: "no such host", IsNotFound: true}, false},
+		{errcode.ErrorCodeUnavailable.WithMessage("try later"), true},
+		{fmt.Errorf("wrapped: %w", errcode.ErrorCodeTooManyRequests.WithMessage("slow down")), true},
+		{errcode.ErrorCodeUnauthorized.WithMessage("no"), false},
+		{errcode.ErrorCodeDenied, false},
+		{errcode.Errors{errcode.ErrorCodeDenied, errcode.ErrorCodeUnavailable}, true},
+		{errcode.Errors{errcode.ErrorCodeDenied}, false},
+	} {
+		assert.Equal(t, c.retryable, isRetryableCopyError(c.err), c.err.Error())
+	}
+}
@@ -0,0 +1,71 @@
+package copy
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultMaxParallelReuseChecks is the default value of Options.MaxParallelReuseChecks.
+const defaultMaxParallelReuseChecks = 16
+
+// reuseCheckResult is the result of checking whether the destination can reuse a layer.
+type reuseCheckResult struct {
+	reused bool
+	blob   private.ReusedBlob
+}
+
+// precheckLayerReuse asks the destination whether it can reuse each of the layers srcInfos, concurrently, and records the
+// results in ic.precheckedReuse for use by copyLayer.
+// Layers which copyLayer would not try to reuse, or which are handled using the checkpoint, are not checked.
+func (ic *imageCopier) precheckLayerReuse(ctx context.Context, srcInfos []types.BlobInfo, layersToEncrypt *set.Set[int],
+	manifestLayerInfos []manifest.LayerInfo) error {
+	srcRef := ic.c.rawSource.Reference().DockerReference()
+	results := make([]*reuseCheckResult, len(srcInfos))
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(ic.maxParallelReuseChecks)
+	for i, srcInfo := range srcInfos {
+		toEncrypt := layersToEncrypt.Contains(i)
+		if !ic.c.downloadForeignLayers && ic.c.dest.AcceptsForeignLayerURLs() && len(srcInfo.URLs) != 0 {
+			continue // Foreign layers are not copied at all.
+		}
+		srcInfo = layerInfoWithCompression(srcInfo)
+		// Compare copyLayer.
+		if ic.layerUsesCheckpoint(srcInfo, toEncrypt) || ic.encryptingOrDecrypting(srcInfo, toEncrypt) ||
+			(ic.diffIDsAreNeeded && ic.c.blobInfoCache.UncompressedDigest(srcInfo.Digest) == "") {
+			continue
+		}
+		index, srcInfo, emptyLayer := i, srcInfo, manifestLayerInfos[i].EmptyLayer
+		group.Go(func() error {
+			reused, blob, err := ic.tryReusingLayer(groupCtx, srcInfo, index, srcRef, emptyLayer)
+			if err != nil {
+				return err
+			}
+			results[index] = &reuseCheckResult{reused: reused, blob: blob}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+
+	ic.precheckedReuse = map[int]reuseCheckResult{}
+	checked, reused := 0, 0
+	for i, res := range results {
+		if res != nil {
+			ic.precheckedReuse[i] = *res
+			checked++
+			if res.reused {
+				reused++
+			}
+		}
+	}
+	logrus.Debugf("Checked %d layers at the destination, %d can be reused", checked, reused)
+	ic.c.Printf("Found %d of %d layers already present at the destination\n", reused, len(srcInfos))
+	return nil
+}
@@ -0,0 +1,135 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/registrytest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reusePrecheckFixture is a source dir: image with numLayers layers, and a registry already containing
+// the first numPresentLayers of them, with latency added to every request.
+type reusePrecheckFixture struct {
+	policyContext *signature.PolicyContext
+	srcRef        types.ImageReference
+	layers        []manifest.LayerInfo
+	server        *registrytest.Server
+}
+
+func newReusePrecheckFixture(tb testing.TB, numLayers, numPresentLayers int, latency time.Duration) *reusePrecheckFixture {
+	policyContext := newTestPolicyContext(tb)
+
+	srcDir := tb.TempDir()
+	manifestBlob := writeTestImage(tb, srcDir, testImage{layers: numberedLayers(numLayers)})
+	m, err := manifest.Schema2FromManifest(manifestBlob)
+	require.NoError(tb, err)
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(tb, err)
+
+	server := registrytest.NewServer(nil)
+	tb.Cleanup(server.Close)
+	for i := 0; i < numPresentLayers; i++ {
+		server.PutBlob("dest", []byte(fmt.Sprintf("layer %d of %d", i, numLayers)))
+	}
+	if latency != 0 {
+		server.SetFaultInjector(func(*http.Request) *registrytest.Fault {
+			time.Sleep(latency)
+			return nil
+		})
+	}
+	return &reusePrecheckFixture{
+		policyContext: policyContext,
+		srcRef:        srcRef,
+		layers:        m.LayerInfos(),
+		server:        server,
+	}
+}
+
+// copy copies the source image to the registry, using options.
+func (f *reusePrecheckFixture) copy(tb testing.TB, options Options) {
+	destRef, err := docker.ParseReference("//" + f.server.Host() + "/dest:latest")
+	require.NoError(tb, err)
+	options.DestinationCtx = f.server.SystemContext()
+	options.DestinationCtx.BlobInfoCacheDir = tb.TempDir()
+	_, err = Image(context.Background(), f.policyContext, destRef, f.srcRef, &options)
+	require.NoError(tb, err)
+}
+
+func TestImagePrecheckBlobReuse(t *testing.T) {
+	const numLayers, numPresentLayers = 10, 4
+	f := newReusePrecheckFixture(t, numLayers, numPresentLayers, 0)
+	report := bytes.Buffer{}
+	f.copy(t, Options{
+		PrecheckBlobReuse:      true,
+		MaxParallelReuseChecks: 3,
+		MaxParallelDownloads:   1,
+		ReportWriter:           &report,
+	})
+	assert.Contains(t, report.String(), fmt.Sprintf("Found %d of %d layers already present at the destination\n", numPresentLayers, numLayers))
+
+	// Every layer was checked exactly once, before any blob data was uploaded.
+	layerPaths := map[string]bool{}
+	for _, layer := range f.layers {
+		layerPaths["/v2/dest/blobs/"+layer.Digest.String()] = true
+	}
+	checks := map[string]int{}
+	firstUpload := -1
+	lastCheck := -1
+	for i, r := range f.server.Requests() {
+		if r.Method == http.MethodHead && layerPaths[r.Path] {
+			checks[r.Path]++
+			lastCheck = i
+		}
+		if r.Method == http.MethodPatch && strings.Contains(r.Path, "/blobs/uploads/") && firstUpload == -1 {
+			firstUpload = i
+		}
+	}
+	for path := range layerPaths {
+		assert.Equal(t, 1, checks[path], path)
+	}
+	require.NotEqual(t, -1, firstUpload)
+	assert.Less(t, lastCheck, firstUpload)
+
+	// All layers are present at the destination: the present ones were reused, the others were uploaded (compressed).
+	m, _, ok := f.server.Manifest("dest", "latest")
+	require.True(t, ok)
+	destManifest, err := manifest.Schema2FromManifest(m)
+	require.NoError(t, err)
+	require.Len(t, destManifest.LayersDescriptors, numLayers)
+	for i, layer := range destManifest.LayersDescriptors {
+		_, ok := f.server.Blob("dest", layer.Digest)
+		assert.True(t, ok, layer.Digest.String())
+		if i < numPresentLayers {
+			assert.Equal(t, f.layers[i].Digest, layer.Digest)
+		} else {
+			assert.NotEqual(t, f.layers[i].Digest, layer.Digest)
+		}
+	}
+}
+
+// BenchmarkImagePrecheckBlobReuse measures copying an image with 50 layers, half of them already present,
+// to a registry with a round-trip time of 150 ms, with and without PrecheckBlobReuse.
+func BenchmarkImagePrecheckBlobReuse(b *testing.B) {
+	for _, precheck := range []bool{false, true} {
+		b.Run(fmt.Sprintf("PrecheckBlobReuse=%v", precheck), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				f := newReusePrecheckFixture(b, 50, 25, 150*time.Millisecond)
+				b.StartTimer()
+				f.copy(b, Options{PrecheckBlobReuse: precheck})
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// SBOMMediaTypeSPDXJSON is the media type of SPDX documents in the JSON format.
+	SBOMMediaTypeSPDXJSON = "application/spdx+json"
+	// SBOMMediaTypeSPDXTagValue is the media type of SPDX documents in the tag-value format.
+	SBOMMediaTypeSPDXTagValue = "text/spdx"
+	// SBOMMediaTypeCycloneDXJSON is the media type of CycloneDX documents in the JSON format.
+	SBOMMediaTypeCycloneDXJSON = "application/vnd.cyclonedx+json"
+	// SBOMMediaTypeCycloneDXXML is the media type of CycloneDX documents in the XML format.
+	SBOMMediaTypeCycloneDXXML = "application/vnd.cyclonedx+xml"
+)
+
+// knownSBOMMediaTypes are the values of Options.SBOMMediaType accepted without Options.SBOMAllowArbitraryMediaType.
+var knownSBOMMediaTypes = []string{
+	SBOMMediaTypeSPDXJSON,
+	SBOMMediaTypeSPDXTagValue,
+	SBOMMediaTypeCycloneDXJSON,
+	SBOMMediaTypeCycloneDXXML,
+}
+
+// validateSBOMOptions returns an error if options.SBOM… are inconsistent.
+func validateSBOMOptions(options *Options) error {
+	if len(options.SBOM) == 0 {
+		if options.SBOMMediaType != "" {
+			return errors.New("options.SBOMMediaType is set, but options.SBOM is empty")
+		}
+		return nil
+	}
+	if options.SBOMMediaType == "" {
+		return errors.New("options.SBOM is set, but options.SBOMMediaType is empty")
+	}
+	if !options.SBOMAllowArbitraryMediaType && !slices.Contains(knownSBOMMediaTypes, options.SBOMMediaType) {
+		return fmt.Errorf("Invalid value for options.SBOMMediaType: %q is not a known SBOM media type", options.SBOMMediaType)
+	}
+	return nil
+}
+
+// preflightSBOM returns an error if options.SBOM is set, and dest can’t store the SBOM as a referrer artifact.
+func preflightSBOM(options *Options, dest types.ImageDestination) error {
+	if len(options.SBOM) == 0 {
+		return nil
+	}
+	if err := checkReferrerArtifactsSupported(dest); err != nil {
+		return fmt.Errorf("attaching an SBOM: %w", err)
+	}
+	return nil
+}
+
+// putSBOMReferrer stores options.SBOM in c.dest as an OCI artifact, with a subject referring to toplevelManifest.
+// It must be called after the top-level manifest has been written, and before c.dest.Commit.
+func (c *copier) putSBOMReferrer(ctx context.Context, options *Options, toplevelManifest []byte) error {
+	layer, err := c.putArtifactBlob(ctx, options.SBOM, false)
+	if err != nil {
+		return fmt.Errorf("writing SBOM: %w", err)
+	}
+	layer.MediaType = options.SBOMMediaType
+	if err := c.putReferrerArtifact(ctx, toplevelManifest, options.SBOMMediaType, []imgspecv1.Descriptor{layer}); err != nil {
+		return fmt.Errorf("attaching SBOM: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package copy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker/archive"
+	"github.com/containers/image/v5/manifest"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSBOMOptions(t *testing.T) {
+	sbom := []byte(`{"spdxVersion":"SPDX-2.3"}`)
+	for _, c := range []struct {
+		options *Options
+		valid   bool
+	}{
+		{&Options{}, true},
+		{&Options{SBOM: sbom, SBOMMediaType: SBOMMediaTypeSPDXJSON}, true},
+		{&Options{SBOM: sbom, SBOMMediaType: SBOMMediaTypeCycloneDXXML}, true},
+		{&Options{SBOM: sbom, SBOMMediaType: "application/x-unknown"}, false},
+		{&Options{SBOM: sbom, SBOMMediaType: "application/x-unknown", SBOMAllowArbitraryMediaType: true}, true},
+		{&Options{SBOM: sbom}, false},
+		{&Options{SBOM: sbom, SBOMAllowArbitraryMediaType: true}, false},
+		{&Options{SBOMMediaType: SBOMMediaTypeSPDXJSON}, false},
+	} {
+		err := validateSBOMOptions(c.options)
+		if c.valid {
+			assert.NoError(t, err, "%#v", c.options)
+		} else {
+			assert.Error(t, err, "%#v", c.options)
+		}
+	}
+}
+
+// findReferrers returns the OCI manifests stored in a dir: destination at dir, which have a subject with subjectDigest.
+func findReferrers(t *testing.T, dir string, subjectDigest digest.Digest) []manifest.OCI1 {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.manifest.json"))
+	require.NoError(t, err)
+	res := []manifest.OCI1{}
+	for _, path := range paths {
+		blob, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var m manifest.OCI1
+		err = json.Unmarshal(blob, &m)
+		require.NoError(t, err)
+		if m.Subject != nil && m.Subject.Digest == subjectDigest {
+			// The manifest must be stored under its own digest.
+			assert.Equal(t, digest.FromBytes(blob).Encoded()+".manifest.json", filepath.Base(path))
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+func TestImageSBOM(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// Create a docker schema2 source image with a single layer.
+	srcDir := t.TempDir()
+	writeTestImage(t, srcDir, testImage{layers: [][]byte{[]byte("layer contents")}})
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	sbom := []byte(`{"bomFormat":"CycloneDX","specVersion":"1.4"}`)
+
+	// Success
+	destDir := t.TempDir()
+	destRef, err := directory.NewReference(destDir)
+	require.NoError(t, err)
+	copiedManifest, err := Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		SBOM:          sbom,
+		SBOMMediaType: SBOMMediaTypeCycloneDXJSON,
+	})
+	require.NoError(t, err)
+	referrers := findReferrers(t, destDir, digest.FromBytes(copiedManifest))
+	require.Len(t, referrers, 1)
+	referrer := referrers[0]
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, referrer.MediaType)
+	assert.Equal(t, &imgspecv1.Descriptor{
+		MediaType: manifest.GuessMIMEType(copiedManifest),
+		Digest:    digest.FromBytes(copiedManifest),
+		Size:      int64(len(copiedManifest)),
+	}, referrer.Subject)
+	assert.Equal(t, SBOMMediaTypeCycloneDXJSON, referrer.Config.MediaType)
+	require.Len(t, referrer.Layers, 1)
+	assert.Equal(t, imgspecv1.Descriptor{
+		MediaType: SBOMMediaTypeCycloneDXJSON,
+		Digest:    digest.FromBytes(sbom),
+		Size:      int64(len(sbom)),
+	}, referrer.Layers[0])
+	contents, err := os.ReadFile(filepath.Join(destDir, referrer.Layers[0].Digest.Encoded()))
+	require.NoError(t, err)
+	assert.Equal(t, sbom, contents)
+
+	// Without SBOM, no referrer is created
+	destDir = t.TempDir()
+	destRef, err = directory.NewReference(destDir)
+	require.NoError(t, err)
+	copiedManifest, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{})
+	require.NoError(t, err)
+	assert.Len(t, findReferrers(t, destDir, digest.FromBytes(copiedManifest)), 0)
+
+	// Unknown media type
+	destDir = t.TempDir()
+	destRef, err = directory.NewReference(destDir)
+	require.NoError(t, err)
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		SBOM:          sbom,
+		SBOMMediaType: "application/x-unknown",
+	})
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(destDir, "manifest.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Destination which can’t store the referrer
+	archiveRef, err := archive.NewReference(filepath.Join(t.TempDir(), "archive.tar"), nil)
+	require.NoError(t, err)
+	_, err = Image(context.Background(), policyContext, archiveRef, srcRef, &Options{
+		SBOM:          sbom,
+		SBOMMediaType: SBOMMediaTypeSPDXJSON,
+	})
+	var preflightErr PreflightError
+	require.ErrorAs(t, err, &preflightErr)
+	assert.ErrorContains(t, err, "SBOM")
+}
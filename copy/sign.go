@@ -3,16 +3,31 @@ package copy
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/set"
 	internalsig "github.com/containers/image/v5/internal/signature"
 	internalSigner "github.com/containers/image/v5/internal/signer"
+	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/signature/sigstore"
 	"github.com/containers/image/v5/signature/simplesigning"
 	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
+// knownSignatureStorageMethods are the accepted non-empty values of Options.SignatureStorageMethod.
+var knownSignatureStorageMethods = []types.SignatureStorageMethod{
+	types.SignatureStorageLookaside,
+	types.SignatureStorageAPIExtension,
+	types.SignatureStorageSigstoreAttachments,
+	types.SignatureStorageReferrers,
+}
+
 // setupSigners initializes c.signers based on options.
 func (c *copier) setupSigners(options *Options) error {
 	c.signers = append(c.signers, options.Signers...)
@@ -50,10 +65,10 @@ func (c *copier) setupSigners(options *Options) error {
 	return nil
 }
 
-// sourceSignatures returns signatures from unparsedSource based on options,
-// and verifies that they can be used (to avoid copying a large image when we
+// sourceSignatures returns signatures from unparsedSource based on options (verifying them using policyContext
+// with options.VerifySourceSignatures), and verifies that they can be used (to avoid copying a large image when we
 // can tell in advance that it would ultimately fail)
-func (c *copier) sourceSignatures(ctx context.Context, unparsed private.UnparsedImage, options *Options,
+func (c *copier) sourceSignatures(ctx context.Context, policyContext *signature.PolicyContext, unparsed private.UnparsedImage, options *Options,
 	gettingSignaturesMessage, checkingDestMessage string) ([]internalsig.Signature, error) {
 	var sigs []internalsig.Signature
 	if options.RemoveSignatures {
@@ -65,16 +80,137 @@ func (c *copier) sourceSignatures(ctx context.Context, unparsed private.Unparsed
 			return nil, fmt.Errorf("reading signatures: %w", err)
 		}
 		sigs = s
+		if options.VerifySourceSignatures && len(sigs) != 0 {
+			s, err := c.verifiedSourceSignatures(ctx, policyContext, unparsed, sigs, options)
+			if err != nil {
+				return nil, err
+			}
+			sigs = s
+		}
 	}
 	if len(sigs) != 0 {
 		c.Printf("%s\n", checkingDestMessage)
 		if err := c.dest.SupportsSignatures(ctx); err != nil {
 			return nil, fmt.Errorf("Can not copy signatures to %s: %w", transports.ImageName(c.dest.Reference()), err)
 		}
+		if err := c.negotiateSignatureStorage(ctx, sigs); err != nil {
+			return nil, err
+		}
 	}
 	return sigs, nil
 }
 
+// validateSignatureStorageMethod returns an error if method is not a valid value of Options.SignatureStorageMethod.
+func validateSignatureStorageMethod(method types.SignatureStorageMethod) error {
+	if method != "" && !slices.Contains(knownSignatureStorageMethods, method) {
+		return fmt.Errorf("Invalid value for options.SignatureStorageMethod: %q", method)
+	}
+	return nil
+}
+
+// preflightSignatureStorage returns an error if options.SignatureStorageMethod is set, and dest does not support it.
+func preflightSignatureStorage(ctx context.Context, options *Options, dest types.ImageDestination) error {
+	if options.SignatureStorageMethod == "" {
+		return nil
+	}
+	negotiator, ok := dest.(private.SignatureStorageNegotiator)
+	if !ok {
+		return fmt.Errorf("signature storage method %q was requested, but the destination does not support choosing a signature storage method",
+			options.SignatureStorageMethod)
+	}
+	supported, err := negotiator.SupportedSignatureStorageMethods(ctx)
+	if err != nil {
+		return fmt.Errorf("determining supported signature storage methods: %w", err)
+	}
+	for _, methods := range supported {
+		if slices.Contains(methods, options.SignatureStorageMethod) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature storage method %q is not supported by the destination, supported methods: %s",
+		options.SignatureStorageMethod, formatSignatureStorageMethods(supported))
+}
+
+// negotiateSignatureStorage chooses a signature storage method for every format of sigs for which c.dest has not been
+// configured yet, respecting c.signatureStorageMethod, and configures c.dest to use the chosen methods.
+// Destinations which don’t implement private.SignatureStorageNegotiator are left to store signatures the only way they can.
+func (c *copier) negotiateSignatureStorage(ctx context.Context, sigs []internalsig.Signature) error {
+	formats := set.New[internalsig.FormatID]()
+	for _, sig := range sigs {
+		if _, ok := c.signatureStorage[sig.FormatID()]; !ok {
+			formats.Add(sig.FormatID())
+		}
+	}
+	if formats.Empty() {
+		return nil
+	}
+
+	negotiator, ok := c.dest.(private.SignatureStorageNegotiator)
+	if !ok {
+		if c.signatureStorageMethod != "" {
+			return fmt.Errorf("Can not copy signatures to %s: signature storage method %q was requested, but the destination does not support choosing a signature storage method",
+				transports.ImageName(c.dest.Reference()), c.signatureStorageMethod)
+		}
+		return nil
+	}
+	supported, err := negotiator.SupportedSignatureStorageMethods(ctx)
+	if err != nil {
+		return fmt.Errorf("determining signature storage methods supported by %s: %w", transports.ImageName(c.dest.Reference()), err)
+	}
+	for _, format := range formats.Values() {
+		method, err := chooseSignatureStorageMethod(format, supported, c.signatureStorageMethod)
+		if err != nil {
+			return fmt.Errorf("Can not copy signatures to %s: %w", transports.ImageName(c.dest.Reference()), err)
+		}
+		c.signatureStorage[format] = method
+	}
+	return negotiator.UseSignatureStorageMethods(maps.Clone(c.signatureStorage))
+}
+
+// chooseSignatureStorageMethod returns the signature storage method to use for signatures in format, given the methods
+// supported by the destination (as returned by SignatureStorageNegotiator.SupportedSignatureStorageMethods) and a requested
+// method, or "" to choose automatically.
+func chooseSignatureStorageMethod(format internalsig.FormatID, supported map[internalsig.FormatID][]types.SignatureStorageMethod,
+	requested types.SignatureStorageMethod) (types.SignatureStorageMethod, error) {
+	methods := supported[format]
+	if requested != "" {
+		if !slices.Contains(methods, requested) {
+			return "", fmt.Errorf("signature storage method %q can not be used for %s signatures, supported methods: %s",
+				requested, format, formatSignatureStorageMethods(supported))
+		}
+		return requested, nil
+	}
+	if len(methods) == 0 {
+		return "", fmt.Errorf("none of the signature storage methods supported by the destination can store %s signatures, supported methods: %s",
+			format, formatSignatureStorageMethods(supported))
+	}
+	return methods[0], nil
+}
+
+// formatSignatureStorageMethods returns a human-readable description of supported, for use in error messages.
+func formatSignatureStorageMethods(supported map[internalsig.FormatID][]types.SignatureStorageMethod) string {
+	formats := maps.Keys(supported)
+	slices.Sort(formats)
+	parts := make([]string, 0, len(formats))
+	for _, format := range formats {
+		methods := make([]string, 0, len(supported[format]))
+		for _, method := range supported[format] {
+			methods = append(methods, string(method))
+		}
+		parts = append(parts, fmt.Sprintf("%s: [%s]", format, strings.Join(methods, ", ")))
+	}
+	return "{" + strings.Join(parts, "; ") + "}"
+}
+
+// putSignatures writes sigs to c.dest for instanceDigest, as PutSignaturesWithFormat does, using
+// signature storage methods chosen by negotiateSignatureStorage.
+func (c *copier) putSignatures(ctx context.Context, sigs []internalsig.Signature, instanceDigest *digest.Digest) error {
+	if err := c.negotiateSignatureStorage(ctx, sigs); err != nil {
+		return err
+	}
+	return c.dest.PutSignaturesWithFormat(ctx, sigs, instanceDigest)
+}
+
 // createSignatures creates signatures for manifest and an optional identity.
 func (c *copier) createSignatures(ctx context.Context, manifest []byte, identity reference.Named) ([]internalsig.Signature, error) {
 	if len(c.signers) == 0 {
@@ -3,6 +3,7 @@ package copy
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"testing"
 
@@ -10,10 +11,13 @@ import (
 	"github.com/containers/image/v5/docker"
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/imagedestination"
+	"github.com/containers/image/v5/internal/private"
 	internalsig "github.com/containers/image/v5/internal/signature"
 	internalSigner "github.com/containers/image/v5/internal/signer"
+	"github.com/containers/image/v5/pkg/registrytest"
 	"github.com/containers/image/v5/signature/signer"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -160,3 +164,224 @@ func TestCreateSignatures(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateSignatureStorageMethod(t *testing.T) {
+	for _, method := range append([]types.SignatureStorageMethod{""}, knownSignatureStorageMethods...) {
+		err := validateSignatureStorageMethod(method)
+		assert.NoError(t, err, method)
+	}
+	err := validateSignatureStorageMethod("this-is-not-a-method")
+	assert.Error(t, err)
+}
+
+// signatureStorageDestination is a private.ImageDestination which advertises a configurable set of signature storage methods.
+type signatureStorageDestination struct {
+	private.ImageDestination
+	supported      map[internalsig.FormatID][]types.SignatureStorageMethod
+	supportedCalls int
+	used           map[internalsig.FormatID]types.SignatureStorageMethod
+}
+
+func (d *signatureStorageDestination) SupportedSignatureStorageMethods(ctx context.Context) (map[internalsig.FormatID][]types.SignatureStorageMethod, error) {
+	d.supportedCalls++
+	return d.supported, nil
+}
+
+func (d *signatureStorageDestination) UseSignatureStorageMethods(methods map[internalsig.FormatID]types.SignatureStorageMethod) error {
+	d.used = methods
+	return nil
+}
+
+func TestNegotiateSignatureStorage(t *testing.T) {
+	dirRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	dirDest, err := dirRef.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dirDest.Close()
+
+	simpleSig := internalsig.SimpleSigningFromBlob([]byte("simple signature"))
+	sigstoreSig := internalsig.SigstoreFromComponents("application/vnd.dev.cosign.simplesigning.v1+json", []byte("payload"), nil)
+	allSupported := map[internalsig.FormatID][]types.SignatureStorageMethod{
+		internalsig.SimpleSigningFormat: {types.SignatureStorageAPIExtension, types.SignatureStorageLookaside},
+		internalsig.SigstoreFormat:      {types.SignatureStorageSigstoreAttachments, types.SignatureStorageReferrers},
+	}
+	referrersOnly := map[internalsig.FormatID][]types.SignatureStorageMethod{
+		internalsig.SigstoreFormat: {types.SignatureStorageReferrers},
+	}
+	lookasideOnly := map[internalsig.FormatID][]types.SignatureStorageMethod{
+		internalsig.SimpleSigningFormat: {types.SignatureStorageLookaside},
+	}
+	for _, c := range []struct {
+		name      string
+		supported map[internalsig.FormatID][]types.SignatureStorageMethod
+		requested types.SignatureStorageMethod
+		sigs      []internalsig.Signature
+		expected  map[internalsig.FormatID]types.SignatureStorageMethod // nil if failure is expected
+	}{
+		{
+			name:      "no signatures",
+			supported: allSupported,
+			sigs:      []internalsig.Signature{},
+			expected:  map[internalsig.FormatID]types.SignatureStorageMethod{},
+		},
+		{
+			name:      "automatic choice",
+			supported: allSupported,
+			sigs:      []internalsig.Signature{simpleSig, sigstoreSig},
+			expected: map[internalsig.FormatID]types.SignatureStorageMethod{
+				internalsig.SimpleSigningFormat: types.SignatureStorageAPIExtension,
+				internalsig.SigstoreFormat:      types.SignatureStorageSigstoreAttachments,
+			},
+		},
+		{
+			name:      "automatic choice, only referrers",
+			supported: referrersOnly,
+			sigs:      []internalsig.Signature{sigstoreSig},
+			expected: map[internalsig.FormatID]types.SignatureStorageMethod{
+				internalsig.SigstoreFormat: types.SignatureStorageReferrers,
+			},
+		},
+		{
+			name:      "automatic choice, only lookaside",
+			supported: lookasideOnly,
+			sigs:      []internalsig.Signature{simpleSig},
+			expected: map[internalsig.FormatID]types.SignatureStorageMethod{
+				internalsig.SimpleSigningFormat: types.SignatureStorageLookaside,
+			},
+		},
+		{
+			name:      "automatic choice, format not supported",
+			supported: referrersOnly,
+			sigs:      []internalsig.Signature{simpleSig},
+		},
+		{
+			name:      "requested method",
+			supported: allSupported,
+			requested: types.SignatureStorageReferrers,
+			sigs:      []internalsig.Signature{sigstoreSig},
+			expected: map[internalsig.FormatID]types.SignatureStorageMethod{
+				internalsig.SigstoreFormat: types.SignatureStorageReferrers,
+			},
+		},
+		{
+			name:      "requested method not supported",
+			supported: lookasideOnly,
+			requested: types.SignatureStorageAPIExtension,
+			sigs:      []internalsig.Signature{simpleSig},
+		},
+		{
+			name:      "requested method does not apply to the format",
+			supported: allSupported,
+			requested: types.SignatureStorageLookaside,
+			sigs:      []internalsig.Signature{simpleSig, sigstoreSig},
+		},
+	} {
+		dest := &signatureStorageDestination{
+			ImageDestination: imagedestination.FromPublic(dirDest),
+			supported:        c.supported,
+		}
+		c2 := &copier{
+			dest:                   dest,
+			signatureStorageMethod: c.requested,
+			signatureStorage:       map[internalsig.FormatID]types.SignatureStorageMethod{},
+		}
+		err := c2.negotiateSignatureStorage(context.Background(), c.sigs)
+		if c.expected == nil {
+			assert.Error(t, err, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+		if len(c.expected) == 0 {
+			assert.Nil(t, dest.used, c.name)
+			assert.Equal(t, 0, dest.supportedCalls, c.name)
+		} else {
+			assert.Equal(t, c.expected, dest.used, c.name)
+			assert.Equal(t, 1, dest.supportedCalls, c.name)
+		}
+		// Formats which have already been negotiated are not negotiated again.
+		err = c2.negotiateSignatureStorage(context.Background(), c.sigs)
+		require.NoError(t, err, c.name)
+		assert.LessOrEqual(t, dest.supportedCalls, 1, c.name)
+	}
+
+	// Destinations which don’t support negotiation
+	c := &copier{
+		dest:             imagedestination.FromPublic(dirDest),
+		signatureStorage: map[internalsig.FormatID]types.SignatureStorageMethod{},
+	}
+	err = c.negotiateSignatureStorage(context.Background(), []internalsig.Signature{simpleSig, sigstoreSig})
+	assert.NoError(t, err)
+	c.signatureStorageMethod = types.SignatureStorageLookaside
+	err = c.negotiateSignatureStorage(context.Background(), []internalsig.Signature{simpleSig})
+	assert.Error(t, err)
+}
+
+func TestImageSignatureStorageMethod(t *testing.T) {
+	stubSigner := internalSigner.NewSigner(&stubSignerImpl{})
+	defer stubSigner.Close()
+	policyContext := newTestPolicyContext(t)
+	srcDir := t.TempDir()
+	writeTestImage(t, srcDir, testImage{layers: numberedLayers(1)})
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+
+	const repo = "dest"
+	copyToServer := func(server *registrytest.Server, method types.SignatureStorageMethod) ([]byte, error) {
+		destRef, err := docker.ParseReference("//" + server.Host() + "/" + repo + ":latest")
+		require.NoError(t, err)
+		sys := server.SystemContext()
+		sys.RegistriesDirPath = "/this/does/not/exist"
+		sys.DockerPerHostCertDirPath = "/this/does/not/exist"
+		sys.DockerUseSigstoreAttachments = types.OptionalBoolTrue
+		return Image(context.Background(), policyContext, destRef, srcRef, &Options{
+			DestinationCtx:         sys,
+			Signers:                []*signer.Signer{stubSigner},
+			SignatureStorageMethod: method,
+		})
+	}
+	attachmentTag := func(manifestDigest digest.Digest) string {
+		return fmt.Sprintf("%s-%s.sig", manifestDigest.Algorithm(), manifestDigest.Encoded())
+	}
+
+	// A registry supporting the referrers API: sigstore attachments are used by default, referrers on request.
+	for _, c := range []struct {
+		method        types.SignatureStorageMethod
+		useReferrers  bool
+		useAttachment bool
+	}{
+		{"", false, true},
+		{types.SignatureStorageSigstoreAttachments, false, true},
+		{types.SignatureStorageReferrers, true, false},
+	} {
+		server := registrytest.NewServer(nil)
+		copiedManifest, err := copyToServer(server, c.method)
+		require.NoError(t, err, c.method)
+		manifestDigest := digest.FromBytes(copiedManifest)
+		referrers := server.Referrers(repo, manifestDigest, "application/vnd.dev.cosign.artifact.sig.v1+json")
+		if c.useReferrers {
+			assert.Len(t, referrers, 1, c.method)
+		} else {
+			assert.Empty(t, referrers, c.method)
+		}
+		_, _, ok := server.Manifest(repo, attachmentTag(manifestDigest))
+		assert.Equal(t, c.useAttachment, ok, c.method)
+		server.Close()
+	}
+
+	// A registry without the referrers API
+	server := registrytest.NewServer(&registrytest.Options{DisableReferrersAPI: true})
+	defer server.Close()
+	_, err = copyToServer(server, types.SignatureStorageReferrers)
+	var preflightErr PreflightError
+	assert.ErrorAs(t, err, &preflightErr)
+	assert.ErrorContains(t, err, `signature storage method "referrers" is not supported by the destination`)
+	assert.Empty(t, server.Tags(repo))
+	copiedManifest, err := copyToServer(server, "")
+	require.NoError(t, err)
+	_, _, ok := server.Manifest(repo, attachmentTag(digest.FromBytes(copiedManifest)))
+	assert.True(t, ok)
+
+	// A requested method which can’t store the signatures being created
+	_, err = copyToServer(server, types.SignatureStorageLookaside)
+	assert.ErrorContains(t, err, `signature storage method "lookaside" can not be used for sigstore-json signatures`)
+}
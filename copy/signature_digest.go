@@ -0,0 +1,88 @@
+package copy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/manifest"
+	digest "github.com/opencontainers/go-digest"
+)
+
+const (
+	// SignatureDigestDestination is the default value which, when set in
+	// Options.SignatureDigestSelection, indicates that signatures are stored
+	// for the manifest written to the destination.
+	SignatureDigestDestination SignatureDigestSelection = iota
+	// SignatureDigestSource is a value which, when set in
+	// Options.SignatureDigestSelection, indicates that signatures are stored
+	// for the digest of the source manifest, even if the manifest is converted
+	// (or otherwise modified) during the copy.
+	SignatureDigestSource
+	// SignatureDigestExplicit is a value which, when set in
+	// Options.SignatureDigestSelection, indicates that signatures are stored
+	// for the digest specified in Options.SignatureDigest.
+	SignatureDigestExplicit
+)
+
+// SignatureDigestSelection is one of SignatureDigestDestination, SignatureDigestSource, or
+// SignatureDigestExplicit, to control which manifest digest the copied signatures are
+// associated with (“triangulated” by) in the destination.
+//
+// Signatures are only ever verified against a manifest with the digest they are associated with;
+// with a value other than SignatureDigestDestination, signatures copied along with a converted image
+// do not apply to the manifest written to the destination.  Consumers need to look up the signatures
+// for the selected digest, and verify them against a manifest with that digest (e.g. the source manifest).
+type SignatureDigestSelection int
+
+// validateSignatureDigestOptions returns an error if options.SignatureDigestSelection and options.SignatureDigest
+// are invalid, or can not be combined with other options.
+func validateSignatureDigestOptions(options *Options) error {
+	switch options.SignatureDigestSelection {
+	case SignatureDigestDestination, SignatureDigestSource:
+		if options.SignatureDigest != "" {
+			return errors.New("options.SignatureDigest can only be used with SignatureDigestExplicit")
+		}
+	case SignatureDigestExplicit:
+		if err := options.SignatureDigest.Validate(); err != nil {
+			return fmt.Errorf("Invalid value for options.SignatureDigest %q: %w", options.SignatureDigest, err)
+		}
+	default:
+		return fmt.Errorf("Invalid value for options.SignatureDigestSelection: %d", options.SignatureDigestSelection)
+	}
+	if options.SignatureDigestSelection == SignatureDigestDestination {
+		return nil
+	}
+	// Newly created signatures are made over the destination manifest, so they can’t be stored for any other digest.
+	if len(options.Signers) != 0 || options.SignBy != "" || options.SignBySigstorePrivateKeyFile != "" {
+		return errors.New("Creating signatures is not supported with options.SignatureDigestSelection other than SignatureDigestDestination")
+	}
+	if options.ForceIndex {
+		return errors.New("options.ForceIndex is not supported with options.SignatureDigestSelection other than SignatureDigestDestination")
+	}
+	return nil
+}
+
+// signatureInstance returns the instanceDigest value to use for storing signatures of a single image,
+// copied from srcManifest to a destination manifest with destManifestDigest.
+// targetInstance is the instanceDigest used for the destination manifest, if any.
+func signatureInstance(options *Options, srcManifest []byte, destManifestDigest digest.Digest, targetInstance *digest.Digest) (*digest.Digest, error) {
+	var res digest.Digest
+	switch options.SignatureDigestSelection {
+	case SignatureDigestSource:
+		d, err := manifest.Digest(srcManifest)
+		if err != nil {
+			return nil, fmt.Errorf("computing digest of source image's manifest: %w", err)
+		}
+		res = d
+	case SignatureDigestExplicit:
+		res = options.SignatureDigest
+	default:
+		return targetInstance, nil
+	}
+	if res == destManifestDigest {
+		// Store the signatures exactly as we would with SignatureDigestDestination,
+		// so that they are found by consumers which don’t ask for a specific instance.
+		return targetInstance, nil
+	}
+	return &res, nil
+}
@@ -0,0 +1,172 @@
+package copy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/internal/private"
+	internalsig "github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/signature/sigstore"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// manifestOverrideSource is a private.ImageSource which returns manifest instead of the manifest of the underlying source,
+// and the signatures of the underlying source for sigsInstance.
+type manifestOverrideSource struct {
+	private.ImageSource
+	manifest     []byte
+	sigsInstance *digest.Digest
+}
+
+func (s manifestOverrideSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	return s.manifest, manifest.GuessMIMEType(s.manifest), nil
+}
+
+func (s manifestOverrideSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]internalsig.Signature, error) {
+	return s.ImageSource.GetSignaturesWithFormat(ctx, s.sigsInstance)
+}
+
+func TestSignatureDigestSelection(t *testing.T) {
+	acceptAnything := newTestPolicyContext(t)
+
+	// Create an unsigned OCI source image with a single compressed layer.
+	unsignedDir := t.TempDir()
+	manifestBlob := writeTestImage(t, unsignedDir, testImage{
+		manifestType:    imgspecv1.MediaTypeImageManifest,
+		layers:          [][]byte{gzipCompressed(t, []byte("layer contents"))},
+		layerMediaTypes: []string{imgspecv1.MediaTypeImageLayerGzip},
+	})
+	unsignedRef, err := directory.NewReference(unsignedDir)
+	require.NoError(t, err)
+
+	// Sign it, without modifying the manifest.
+	passphrase := []byte("some passphrase")
+	keyPair, err := sigstore.GenerateKeyPair(passphrase)
+	require.NoError(t, err)
+	privateKeyFile := filepath.Join(t.TempDir(), "private.key")
+	err = os.WriteFile(privateKeyFile, keyPair.PrivateKey, 0o600)
+	require.NoError(t, err)
+	const signedIdentity = "example.com/signed/image:latest"
+	identity, err := reference.ParseNormalizedNamed(signedIdentity)
+	require.NoError(t, err)
+	srcDir := t.TempDir()
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	_, err = Image(context.Background(), acceptAnything, srcRef, unsignedRef, &Options{
+		SignBySigstorePrivateKeyFile:     privateKeyFile,
+		SignSigstorePrivateKeyPassphrase: passphrase,
+		SignIdentity:                     identity,
+	})
+	require.NoError(t, err)
+	srcDigest := digest.FromBytes(manifestBlob)
+
+	prm, err := signature.NewPRMExactReference(signedIdentity)
+	require.NoError(t, err)
+	pr, err := signature.NewPRSigstoreSignedKeyData(keyPair.PublicKey, prm)
+	require.NoError(t, err)
+	requireSigned := newTestPolicyContext(t, pr)
+	// verify returns an error unless the signatures stored in destRef for sigsInstance match m.
+	verify := func(destRef types.ImageReference, m []byte, sigsInstance *digest.Digest) error {
+		src, err := destRef.NewImageSource(context.Background(), nil)
+		require.NoError(t, err)
+		defer src.Close()
+		unparsed := image.UnparsedInstance(manifestOverrideSource{ImageSource: imagesource.FromPublic(src), manifest: m, sigsInstance: sigsInstance}, nil)
+		_, err = requireSigned.IsRunningImageAllowed(context.Background(), unparsed)
+		return err
+	}
+	// copyWithPolicy returns an error unless the signatures of srcRef are accepted when copying it.
+	copyWithPolicy := func(srcRef types.ImageReference) error {
+		destRef, err := directory.NewReference(t.TempDir())
+		require.NoError(t, err)
+		_, err = Image(context.Background(), requireSigned, destRef, srcRef, nil)
+		return err
+	}
+	err = copyWithPolicy(srcRef)
+	require.NoError(t, err)
+	err = verify(srcRef, manifestBlob, nil)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name            string
+		convert         bool
+		selection       SignatureDigestSelection
+		explicit        digest.Digest
+		sigsForInstance bool // Signatures are expected to be stored for srcDigest, not for the destination’s primary manifest
+	}{
+		{"source, converted", true, SignatureDigestSource, "", true},
+		{"explicit, converted", true, SignatureDigestExplicit, srcDigest, true},
+		{"source, unmodified", false, SignatureDigestSource, "", false},
+		{"explicit, unmodified", false, SignatureDigestExplicit, srcDigest, false},
+		{"destination, unmodified", false, SignatureDigestDestination, "", false},
+	} {
+		destRef, err := directory.NewReference(t.TempDir())
+		require.NoError(t, err, c.name)
+		options := &Options{
+			SignatureDigestSelection: c.selection,
+			SignatureDigest:          c.explicit,
+		}
+		if c.convert {
+			options.ForceManifestMIMEType = manifest.DockerV2Schema2MediaType
+		}
+		destManifest, err := Image(context.Background(), requireSigned, destRef, srcRef, options)
+		require.NoError(t, err, c.name)
+		if c.convert {
+			assert.NotEqual(t, srcDigest, digest.FromBytes(destManifest), c.name)
+		} else {
+			assert.Equal(t, manifestBlob, destManifest, c.name)
+		}
+
+		if c.sigsForInstance {
+			// The signatures are valid at the chosen digest…
+			err = verify(destRef, manifestBlob, &srcDigest)
+			assert.NoError(t, err, c.name)
+			// … but they don’t apply to the converted image.
+			err = copyWithPolicy(destRef)
+			assert.Error(t, err, c.name)
+		} else {
+			err = verify(destRef, destManifest, nil)
+			assert.NoError(t, err, c.name)
+			err = copyWithPolicy(destRef)
+			assert.NoError(t, err, c.name)
+		}
+	}
+
+	// By default, signatures prevent converting the manifest.
+	destRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	destManifest, err := Image(context.Background(), requireSigned, destRef, srcRef, &Options{
+		ForceManifestMIMEType: manifest.DockerV2Schema2MediaType,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, manifestBlob, destManifest)
+
+	// Invalid option combinations
+	for _, options := range []*Options{
+		{SignatureDigestSelection: -1},
+		{SignatureDigestSelection: SignatureDigestExplicit + 1},
+		{SignatureDigestSelection: SignatureDigestExplicit},
+		{SignatureDigestSelection: SignatureDigestExplicit, SignatureDigest: "sha256:invalid"},
+		{SignatureDigestSelection: SignatureDigestSource, SignatureDigest: srcDigest},
+		{SignatureDigest: srcDigest},
+		{SignatureDigestSelection: SignatureDigestSource, SignBySigstorePrivateKeyFile: privateKeyFile, SignSigstorePrivateKeyPassphrase: passphrase},
+		{SignatureDigestSelection: SignatureDigestExplicit, SignatureDigest: srcDigest, SignBy: "some key"},
+		{SignatureDigestSelection: SignatureDigestSource, ForceIndex: true},
+	} {
+		destRef, err := directory.NewReference(t.TempDir())
+		require.NoError(t, err)
+		_, err = Image(context.Background(), acceptAnything, destRef, srcRef, options)
+		assert.Error(t, err, options)
+	}
+}
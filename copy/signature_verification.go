@@ -0,0 +1,103 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/containers/image/v5/internal/private"
+	internalsig "github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+// DroppedSignature describes a source signature which was not copied because of Options.VerifySourceSignatures.
+type DroppedSignature struct {
+	ManifestDigest digest.Digest // The digest of the source manifest (of a single image or of a manifest list) the signature belongs to
+	// Index is the index of the signature among all signatures of the source manifest, in the canonical order used for all transports.
+	Index int
+	// Errors are the reasons why the policy requirements which evaluated the signature rejected it;
+	// this is empty if no policy requirement applicable to the image deals with signatures of this kind.
+	Errors []string
+}
+
+// DroppedSignatureReport records source signatures dropped by copy.Image with Options.VerifySourceSignatures.
+// Set a *DroppedSignatureReport in Options.DroppedSignatures, and call Signatures after copy.Image returns.
+// The zero value is ready to use; a DroppedSignatureReport can be shared by several copy.Image operations.
+type DroppedSignatureReport struct {
+	mutex      sync.Mutex
+	signatures []DroppedSignature
+}
+
+// Signatures returns the signatures recorded in r, in the order in which they were dropped.
+func (r *DroppedSignatureReport) Signatures() []DroppedSignature {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return slices.Clone(r.signatures)
+}
+
+// recordSignature adds sig to r.
+func (r *DroppedSignatureReport) recordSignature(sig DroppedSignature) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.signatures = append(r.signatures, sig)
+}
+
+// verifiedSourceSignatures returns the subset of sigs, the signatures of unparsed, which are accepted by at least one requirement
+// of policyContext, and records the other ones in options.DroppedSignatures.
+func (c *copier) verifiedSourceSignatures(ctx context.Context, policyContext *signature.PolicyContext, unparsed private.UnparsedImage,
+	sigs []internalsig.Signature, options *Options) ([]internalsig.Signature, error) {
+	report, err := policyContext.EvaluateAllRequirements(ctx, unparsed)
+	if err != nil {
+		return nil, fmt.Errorf("verifying source signatures: %w", err)
+	}
+	if report.Error != "" {
+		return nil, fmt.Errorf("verifying source signatures: %s", report.Error)
+	}
+	accepted := make([]bool, len(sigs))
+	rejections := make([][]string, len(sigs))
+	for _, req := range report.Requirements {
+		for _, sig := range req.Signatures {
+			if sig.Index < 0 || sig.Index >= len(sigs) { // Coverage: This should never happen.
+				return nil, fmt.Errorf("Internal error: policy evaluation reported signature %d, but only %d signatures exist", sig.Index, len(sigs))
+			}
+			if sig.Accepted {
+				accepted[sig.Index] = true
+			} else {
+				rejections[sig.Index] = append(rejections[sig.Index], sig.Error)
+			}
+		}
+	}
+
+	res := []internalsig.Signature{}
+	var dropped []DroppedSignature
+	for i, sig := range sigs {
+		if accepted[i] {
+			res = append(res, sig)
+			continue
+		}
+		dropped = append(dropped, DroppedSignature{Index: i, Errors: rejections[i]})
+	}
+	if len(dropped) != 0 {
+		c.Printf("Dropping %d unverified signatures\n", len(dropped))
+		m, _, err := unparsed.Manifest(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("reading source manifest: %w", err)
+		}
+		manifestDigest, err := manifest.Digest(m)
+		if err != nil {
+			return nil, fmt.Errorf("computing digest of source manifest: %w", err)
+		}
+		for _, d := range dropped {
+			logrus.Debugf("Dropping signature %d of %s: %v", d.Index, manifestDigest, d.Errors)
+			if options.DroppedSignatures != nil {
+				d.ManifestDigest = manifestDigest
+				options.DroppedSignatures.recordSignature(d)
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,142 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	internalsig "github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/signature/sigstore"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+// imageSignatureBlobs returns the signatures of the image in dir:path, in their serialized form,
+// in the canonical order used by copy.Image.
+func imageSignatureBlobs(t *testing.T, path string) [][]byte {
+	ref, err := directory.NewReference(path)
+	require.NoError(t, err)
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	sigs, err := image.UnparsedInstance(src, nil).UntrustedSignatures(context.Background())
+	require.NoError(t, err)
+	res := [][]byte{}
+	for _, sig := range sigs {
+		blob, err := internalsig.Blob(sig)
+		require.NoError(t, err)
+		res = append(res, blob)
+	}
+	return res
+}
+
+func TestVerifySourceSignatures(t *testing.T) {
+	acceptAnything := newTestPolicyContext(t)
+
+	// Create an unsigned source image with a single compressed layer.
+	unsignedDir := t.TempDir()
+	manifestBlob := writeTestImage(t, unsignedDir, testImage{
+		manifestType:    imgspecv1.MediaTypeImageManifest,
+		layers:          [][]byte{gzipCompressed(t, []byte("layer contents"))},
+		layerMediaTypes: []string{imgspecv1.MediaTypeImageLayerGzip},
+	})
+	unsignedRef, err := directory.NewReference(unsignedDir)
+	require.NoError(t, err)
+
+	// Sign it using two different keys, without modifying the manifest.
+	const signedIdentity = "example.com/signed/image:latest"
+	identity, err := reference.ParseNormalizedNamed(signedIdentity)
+	require.NoError(t, err)
+	passphrase := []byte("some passphrase")
+	var publicKeys [][]byte
+	srcRef := unsignedRef
+	var srcDir string
+	var firstKeySigs [][]byte
+	for i := 0; i < 2; i++ {
+		keyPair, err := sigstore.GenerateKeyPair(passphrase)
+		require.NoError(t, err)
+		publicKeys = append(publicKeys, keyPair.PublicKey)
+		privateKeyFile := filepath.Join(t.TempDir(), "private.key")
+		err = os.WriteFile(privateKeyFile, keyPair.PrivateKey, 0o600)
+		require.NoError(t, err)
+		srcDir = t.TempDir()
+		signedRef, err := directory.NewReference(srcDir)
+		require.NoError(t, err)
+		_, err = Image(context.Background(), acceptAnything, signedRef, srcRef, &Options{
+			SignBySigstorePrivateKeyFile:     privateKeyFile,
+			SignSigstorePrivateKeyPassphrase: passphrase,
+			SignIdentity:                     identity,
+		})
+		require.NoError(t, err)
+		srcRef = signedRef
+		if i == 0 {
+			firstKeySigs = imageSignatureBlobs(t, srcDir)
+		}
+	}
+	srcSigs := imageSignatureBlobs(t, srcDir)
+	require.Len(t, srcSigs, 2)
+	require.Len(t, firstKeySigs, 1)
+	// The canonical order does not depend on the order of signing, so find the signatures made by each key.
+	untrustedIndex := slices.IndexFunc(srcSigs, func(sig []byte) bool { return bytes.Equal(sig, firstKeySigs[0]) })
+	require.NotEqual(t, -1, untrustedIndex)
+	trustedSig := srcSigs[1-untrustedIndex]
+
+	// A policy trusting only the second key.
+	prm, err := signature.NewPRMExactReference(signedIdentity)
+	require.NoError(t, err)
+	pr, err := signature.NewPRSigstoreSignedKeyData(publicKeys[1], prm)
+	require.NoError(t, err)
+	trustSecondKey := newTestPolicyContext(t, pr)
+
+	// Without VerifySourceSignatures, all signatures are copied.
+	destDir := t.TempDir()
+	destRef, err := directory.NewReference(destDir)
+	require.NoError(t, err)
+	_, err = Image(context.Background(), trustSecondKey, destRef, srcRef, &Options{})
+	require.NoError(t, err)
+	assert.Equal(t, srcSigs, imageSignatureBlobs(t, destDir))
+
+	// With VerifySourceSignatures, only the trusted signature is copied.
+	destDir = t.TempDir()
+	destRef, err = directory.NewReference(destDir)
+	require.NoError(t, err)
+	dropped := &DroppedSignatureReport{}
+	_, err = Image(context.Background(), trustSecondKey, destRef, srcRef, &Options{
+		VerifySourceSignatures: true,
+		DroppedSignatures:      dropped,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{trustedSig}, imageSignatureBlobs(t, destDir))
+	droppedSigs := dropped.Signatures()
+	require.Len(t, droppedSigs, 1)
+	assert.Equal(t, digest.FromBytes(manifestBlob), droppedSigs[0].ManifestDigest)
+	assert.Equal(t, untrustedIndex, droppedSigs[0].Index)
+	assert.Len(t, droppedSigs[0].Errors, 1)
+
+	// If no policy requirement verifies signatures, all signatures are dropped.
+	destDir = t.TempDir()
+	destRef, err = directory.NewReference(destDir)
+	require.NoError(t, err)
+	dropped = &DroppedSignatureReport{}
+	_, err = Image(context.Background(), acceptAnything, destRef, srcRef, &Options{
+		VerifySourceSignatures: true,
+		DroppedSignatures:      dropped,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, imageSignatureBlobs(t, destDir))
+	droppedSigs = dropped.Signatures()
+	require.Len(t, droppedSigs, 2)
+	for i, d := range droppedSigs {
+		assert.Equal(t, i, d.Index)
+		assert.Empty(t, d.Errors)
+	}
+}
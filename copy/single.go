@@ -8,24 +8,24 @@ import (
 	"io"
 	"reflect"
 	"strings"
-	"sync"
 
 	"github.com/containers/image/v5/docker/reference"
+	internalblobinfocache "github.com/containers/image/v5/internal/blobinfocache"
 	"github.com/containers/image/v5/internal/image"
 	"github.com/containers/image/v5/internal/pkg/platform"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/set"
 	"github.com/containers/image/v5/manifest"
-	"github.com/containers/image/v5/pkg/compression"
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
-	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"github.com/vbauerster/mpb/v8"
+	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
+	"golang.org/x/sync/errgroup"
 )
 
 // imageCopier tracks state specific to a single image (possibly an item of a manifest list)
@@ -38,7 +38,14 @@ type imageCopier struct {
 	canSubstituteBlobs         bool
 	compressionFormat          *compressiontypes.Algorithm // Compression algorithm to use, if the user explicitly requested one, or nil.
 	compressionLevel           *int
+	compressionPolicy          CompressionPolicy // Chooses the compression algorithm per layer, or nil to always use compressionFormat.
+	forceCompressionFormat     bool              // Layers the destination wants compressed must end up compressed with compressionFormat.
 	ociEncryptLayers           *[]int
+	annotateLayerCompression   bool
+	precheckBlobReuse          bool
+	maxParallelReuseChecks     int
+	precheckedReuse            map[int]reuseCheckResult // Results of precheckLayerReuse, by layer index; set by copyLayers
+	copiedLayers               []CopiedLayer            // Set by copyLayers
 }
 
 // copySingleImage copies a single (non-manifest-list) image unparsedImage, using policyContext to validate
@@ -96,8 +103,11 @@ func (c *copier) copySingleImage(ctx context.Context, policyContext *signature.P
 	if err := checkImageDestinationForCurrentRuntime(ctx, options.DestinationCtx, src, c.dest); err != nil {
 		return nil, "", "", err
 	}
+	if err := checkLayerCount(options, src); err != nil {
+		return nil, "", "", err
+	}
 
-	sigs, err := c.sourceSignatures(ctx, src, options,
+	sigs, err := c.sourceSignatures(ctx, policyContext, src, options,
 		"Getting image source signatures",
 		"Checking if image destination supports signatures")
 	if err != nil {
@@ -108,7 +118,7 @@ func (c *copier) copySingleImage(ctx context.Context, policyContext *signature.P
 	// If we can, set to the empty string. If we can't, set to the reason why.
 	// Compare, and perhaps keep in sync with, the version in copyMultipleImages.
 	cannotModifyManifestReason := ""
-	if len(sigs) > 0 {
+	if len(sigs) > 0 && options.SignatureDigestSelection == SignatureDigestDestination {
 		cannotModifyManifestReason = "Would invalidate signatures"
 	}
 	if destIsDigestedReference {
@@ -124,13 +134,30 @@ func (c *copier) copySingleImage(ctx context.Context, policyContext *signature.P
 		src:             src,
 		// diffIDsAreNeeded is computed later
 		cannotModifyManifestReason: cannotModifyManifestReason,
+		compressionPolicy:          options.CompressionPolicy,
 		ociEncryptLayers:           options.OciEncryptLayers,
+		annotateLayerCompression:   options.AnnotateLayerCompression,
+		precheckBlobReuse:          options.PrecheckBlobReuse,
+		maxParallelReuseChecks:     int(options.MaxParallelReuseChecks),
+	}
+	if ic.maxParallelReuseChecks == 0 {
+		ic.maxParallelReuseChecks = defaultMaxParallelReuseChecks
+	}
+	if ic.annotateLayerCompression && ic.cannotModifyManifestReason != "" {
+		return nil, "", "", fmt.Errorf("Annotating layer compression requires changing the manifest, which we cannot do: %q", ic.cannotModifyManifestReason)
 	}
 	if options.DestinationCtx != nil {
 		// Note that compressionFormat and compressionLevel can be nil.
 		ic.compressionFormat = options.DestinationCtx.CompressionFormat
 		ic.compressionLevel = options.DestinationCtx.CompressionLevel
 	}
+	if options.CompressionFormat != nil {
+		ic.compressionFormat = options.CompressionFormat
+	}
+	if options.CompressionLevel != nil {
+		ic.compressionLevel = options.CompressionLevel
+	}
+	ic.forceCompressionFormat = options.ForceCompressionFormat
 	// Decide whether we can substitute blobs with semantic equivalents:
 	// - Don’t do that if we can’t modify the manifest at all
 	// - Ensure _this_ copy sees exactly the intended data when either processing a signed image or signing it.
@@ -152,6 +179,7 @@ func (c *copier) copySingleImage(ctx context.Context, policyContext *signature.P
 		destSupportedManifestMIMETypes: ic.c.dest.SupportedManifestMIMETypes(),
 		forceManifestMIMEType:          options.ForceManifestMIMEType,
 		requiresOCIEncryption:          destRequiresOciEncryption,
+		requiredCompression:            ic.requiredCompression(),
 		cannotModifyManifestReason:     ic.cannotModifyManifestReason,
 	})
 	if err != nil {
@@ -172,9 +200,11 @@ func (c *copier) copySingleImage(ctx context.Context, policyContext *signature.P
 	if options.OptimizeDestinationImageAlreadyExists {
 		shouldUpdateSigs := len(sigs) > 0 || len(c.signers) != 0 // TODO: Consider allowing signatures updates only and skipping the image's layers/manifest copy if possible
 		noPendingManifestUpdates := ic.noPendingManifestUpdates()
+		forcesCompression := ic.requiredCompression() != nil
 
-		logrus.Debugf("Checking if we can skip copying: has signatures=%t, OCI encryption=%t, no manifest updates=%t", shouldUpdateSigs, destRequiresOciEncryption, noPendingManifestUpdates)
-		if !shouldUpdateSigs && !destRequiresOciEncryption && noPendingManifestUpdates {
+		logrus.Debugf("Checking if we can skip copying: has signatures=%t, OCI encryption=%t, no manifest updates=%t, forced compression=%t",
+			shouldUpdateSigs, destRequiresOciEncryption, noPendingManifestUpdates, forcesCompression)
+		if !shouldUpdateSigs && !destRequiresOciEncryption && noPendingManifestUpdates && !forcesCompression {
 			isSrcDestManifestEqual, retManifest, retManifestType, retManifestDigest, err := compareImageDestinationManifestEqual(ctx, options, src, targetInstance, c.dest)
 			if err != nil {
 				logrus.Warnf("Failed to compare destination image manifest: %v", err)
@@ -246,6 +276,7 @@ func (c *copier) copySingleImage(ctx context.Context, policyContext *signature.P
 			return nil, "", "", fmt.Errorf("Uploading manifest failed, attempted the following formats: %s", strings.Join(errs, ", "))
 		}
 	}
+	srcInstance := targetInstance // The digest of the instance in the source, if we are copying one
 	if targetInstance != nil {
 		targetInstance = &retManifestDigest
 	}
@@ -256,11 +287,26 @@ func (c *copier) copySingleImage(ctx context.Context, policyContext *signature.P
 	}
 	sigs = append(sigs, newSigs...)
 
+	sigsInstance, err := signatureInstance(options, src.ManifestBlob, retManifestDigest, targetInstance)
+	if err != nil {
+		return nil, "", "", err
+	}
 	c.Printf("Storing signatures\n")
-	if err := c.dest.PutSignaturesWithFormat(ctx, sigs, targetInstance); err != nil {
+	if err := c.putSignatures(ctx, sigs, sigsInstance); err != nil {
 		return nil, "", "", fmt.Errorf("writing signatures: %w", err)
 	}
+	if c.checkpoint != nil && srcInstance != nil && sigsInstance != nil {
+		if err := c.checkpoint.recordInstance(c.dest.Reference(), *srcInstance, manifestBytes, retManifestType, sigs, *sigsInstance); err != nil {
+			return nil, "", "", err
+		}
+	}
 
+	if options.LayerReport != nil {
+		options.LayerReport.recordImage(CopiedImage{
+			ManifestDigest: retManifestDigest,
+			Layers:         ic.copiedLayers,
+		})
+	}
 	return manifestBytes, retManifestType, retManifestDigest, nil
 }
 
@@ -296,6 +342,18 @@ func checkImageDestinationForCurrentRuntime(ctx context.Context, sys *types.Syst
 	return nil
 }
 
+// checkLayerCount enforces options.MaxLayers for src.
+func checkLayerCount(options *Options, src types.Image) error {
+	if options.MaxLayers == 0 {
+		return nil
+	}
+	if layers := len(src.LayerInfos()); layers > options.MaxLayers {
+		return fmt.Errorf("Image %s has %d layers, more than the maximum of %d allowed by options.MaxLayers",
+			transports.ImageName(src.Reference()), layers, options.MaxLayers)
+	}
+	return nil
+}
+
 // updateEmbeddedDockerReference handles the Docker reference embedded in Docker schema1 manifests.
 func (ic *imageCopier) updateEmbeddedDockerReference() error {
 	if ic.c.dest.IgnoresEmbeddedDockerReference() {
@@ -373,9 +431,9 @@ func (ic *imageCopier) copyLayers(ctx context.Context) error {
 	}
 
 	type copyLayerData struct {
-		destInfo types.BlobInfo
-		diffID   digest.Digest
-		err      error
+		destInfo       types.BlobInfo
+		diffID         digest.Digest
+		compressorName string
 	}
 
 	// The manifest is used to extract the information whether a given
@@ -386,28 +444,50 @@ func (ic *imageCopier) copyLayers(ctx context.Context) error {
 	}
 	manifestLayerInfos := man.LayerInfos()
 
-	// copyGroup is used to determine if all layers are copied
-	copyGroup := sync.WaitGroup{}
+	// copyGroup is used to wait for all layer copies to finish. copyCtx is canceled as soon as copying any layer fails,
+	// so that the other layer copies are aborted instead of continuing needlessly.
+	copyGroup, copyCtx := errgroup.WithContext(ctx)
 
 	data := make([]copyLayerData, numLayers)
-	copyLayerHelper := func(index int, srcLayer types.BlobInfo, toEncrypt bool, pool *mpb.Progress, srcRef reference.Named) {
+	copyLayerHelper := func(index int, srcLayer types.BlobInfo, toEncrypt bool, pool *mpb.Progress, srcRef reference.Named) error {
 		defer ic.c.concurrentBlobCopiesSemaphore.Release(1)
-		defer copyGroup.Done()
 		cld := copyLayerData{}
 		if !ic.c.downloadForeignLayers && ic.c.dest.AcceptsForeignLayerURLs() && len(srcLayer.URLs) != 0 {
 			// DiffIDs are, currently, needed only when converting from schema1.
 			// In which case src.LayerInfos will not have URLs because schema1
 			// does not support them.
 			if ic.diffIDsAreNeeded {
-				cld.err = errors.New("getting DiffID for foreign layers is unimplemented")
-			} else {
-				cld.destInfo = srcLayer
-				logrus.Debugf("Skipping foreign layer %q copy to %s", cld.destInfo.Digest, ic.c.dest.Reference().Transport().Name())
+				return errors.New("getting DiffID for foreign layers is unimplemented")
 			}
+			cld.destInfo = srcLayer
+			cld.compressorName = compressorNameFromBlobInfo(srcLayer)
+			logrus.Debugf("Skipping foreign layer %q copy to %s", cld.destInfo.Digest, ic.c.dest.Reference().Transport().Name())
+			ic.c.reportLayerSkipped(srcLayer, index, LayerSkippedForeign)
 		} else {
-			cld.destInfo, cld.diffID, cld.err = ic.copyLayer(ctx, srcLayer, toEncrypt, pool, index, srcRef, manifestLayerInfos[index].EmptyLayer)
+			var err error
+			cld.destInfo, cld.diffID, cld.compressorName, err = ic.copyLayer(copyCtx, srcLayer, toEncrypt, pool, index, srcRef, manifestLayerInfos[index].EmptyLayer)
+			if err != nil {
+				return err
+			}
+			if required := ic.requiredLayerCompression(srcLayer, toEncrypt); required != nil && cld.compressorName != required.Name() {
+				if ic.cannotModifyManifestReason != "" {
+					return fmt.Errorf("Layer %s is compressed with %s, but %s is required, and the layer can not be recompressed: %s",
+						srcLayer.Digest, cld.compressorName, required.Name(), ic.cannotModifyManifestReason)
+				}
+				return fmt.Errorf("Internal error: layer %s was copied compressed with %s, but %s is required", srcLayer.Digest, cld.compressorName, required.Name())
+			}
+			if ic.layerUsesCheckpoint(srcLayer, toEncrypt) {
+				// With Options.DeferredVerification, don’t allow later copies to rely on a layer which may still turn out to be corrupt.
+				destInfo, diffID := cld.destInfo, cld.diffID
+				if err := ic.c.runAfterVerification(func() error {
+					return ic.c.checkpoint.recordLayer(ic.c.dest.Reference(), srcLayer.Digest, destInfo, diffID)
+				}); err != nil {
+					return err
+				}
+			}
 		}
 		data[index] = cld
+		return nil
 	}
 
 	// Decide which layers to encrypt
@@ -428,37 +508,58 @@ func (ic *imageCopier) copyLayers(ctx context.Context) error {
 		}
 	}
 
+	if ic.precheckBlobReuse {
+		if err := ic.precheckLayerReuse(ctx, srcInfos, layersToEncrypt, manifestLayerInfos); err != nil {
+			return err
+		}
+	}
+
 	if err := func() error { // A scope for defer
 		progressPool := ic.c.newProgressPool()
 		defer progressPool.Wait()
 
-		// Ensure we wait for all layers to be copied. progressPool.Wait() must not be called while any of the copyLayerHelpers interact with the progressPool.
-		defer copyGroup.Wait()
-
 		for i, srcLayer := range srcInfos {
-			err = ic.c.concurrentBlobCopiesSemaphore.Acquire(ctx, 1)
+			err = ic.c.concurrentBlobCopiesSemaphore.Acquire(copyCtx, 1)
 			if err != nil {
-				// This can only fail with ctx.Err(), so no need to blame acquiring the semaphore.
+				// This can only fail with copyCtx.Err(), so no need to blame acquiring the semaphore.
+				// If copyCtx was canceled because copying a layer failed, report that failure instead.
+				// Either way, this waits for the layer copies that have already started.
+				if groupErr := copyGroup.Wait(); groupErr != nil {
+					return groupErr
+				}
 				return fmt.Errorf("copying layer: %w", err)
 			}
-			copyGroup.Add(1)
-			go copyLayerHelper(i, srcLayer, layersToEncrypt.Contains(i), progressPool, ic.c.rawSource.Reference().DockerReference())
+			index, srcLayer, toEncrypt := i, srcLayer, layersToEncrypt.Contains(i)
+			copyGroup.Go(func() error {
+				return copyLayerHelper(index, srcLayer, toEncrypt, progressPool, ic.c.rawSource.Reference().DockerReference())
+			})
 		}
 
-		// A call to copyGroup.Wait() is done at this point by the defer above.
-		return nil
+		// Ensure we wait for all layers to be copied. progressPool.Wait() must not be called while any of the copyLayerHelpers interact with the progressPool.
+		return copyGroup.Wait()
 	}(); err != nil {
 		return err
 	}
 
 	destInfos := make([]types.BlobInfo, numLayers)
 	diffIDs := make([]digest.Digest, numLayers)
+	ic.copiedLayers = make([]CopiedLayer, numLayers)
+	annotationsUpdated := false
 	for i, cld := range data {
-		if cld.err != nil {
-			return cld.err
-		}
 		destInfos[i] = cld.destInfo
 		diffIDs[i] = cld.diffID
+		ic.copiedLayers[i] = copiedLayer(srcInfos[i], cld.destInfo, cld.compressorName)
+		if ic.annotateLayerCompression {
+			if value, ok := layerCompressionAnnotationValue(ic.copiedLayers[i]); ok && destInfos[i].Annotations[LayerCompressionAnnotation] != value {
+				annotations := maps.Clone(destInfos[i].Annotations)
+				if annotations == nil {
+					annotations = map[string]string{}
+				}
+				annotations[LayerCompressionAnnotation] = value
+				destInfos[i].Annotations = annotations
+				annotationsUpdated = true
+			}
+		}
 	}
 
 	// WARNING: If you are adding new reasons to change ic.manifestUpdates, also update the
@@ -467,7 +568,7 @@ func (ic *imageCopier) copyLayers(ctx context.Context) error {
 	if ic.diffIDsAreNeeded {
 		ic.manifestUpdates.InformationOnly.LayerDiffIDs = diffIDs
 	}
-	if srcInfosUpdated || layerDigestsDiffer(srcInfos, destInfos) {
+	if srcInfosUpdated || annotationsUpdated || layerDigestsDiffer(srcInfos, destInfos) {
 		ic.manifestUpdates.LayerInfos = destInfos
 	}
 	return nil
@@ -514,18 +615,12 @@ func (ic *imageCopier) copyUpdatedConfigAndManifest(ctx context.Context, instanc
 	}
 
 	ic.c.Printf("Writing manifest to image destination\n")
-	manifestDigest, err := manifest.Digest(man)
+	writtenManifest, manifestDigest, err := ic.c.putManifest(ctx, man, instanceDigest != nil, ic.cannotModifyManifestReason)
 	if err != nil {
-		return nil, "", err
-	}
-	if instanceDigest != nil {
-		instanceDigest = &manifestDigest
-	}
-	if err := ic.c.dest.PutManifest(ctx, man, instanceDigest); err != nil {
 		logrus.Debugf("Error %v while writing manifest %q", err, string(man))
 		return nil, "", fmt.Errorf("writing manifest: %w", err)
 	}
-	return man, manifestDigest, nil
+	return writtenManifest, manifestDigest, nil
 }
 
 // copyConfig copies config.json, if any, from src to dest.
@@ -538,6 +633,26 @@ func (ic *imageCopier) copyConfig(ctx context.Context, src types.Image) error {
 		}
 		defer ic.c.concurrentBlobCopiesSemaphore.Release(1)
 
+		// Instances of a manifest list can share a config; write it only once.
+		// Holding the lock during the copy ensures that another instance sharing the config waits for the copy
+		// to finish, instead of copying the config concurrently. Configs are small, so this does not significantly
+		// limit concurrency.
+		ic.c.copiedConfigsLock.Lock()
+		defer ic.c.copiedConfigsLock.Unlock()
+		if ic.c.copiedConfigs.Contains(srcInfo.Digest) {
+			logrus.Debugf("Skipping config %s (already copied for another instance)", srcInfo.Digest)
+			ic.c.printCopyInfo("config", srcInfo)
+			func() { // A scope for defer
+				progressPool := ic.c.newProgressPool()
+				defer progressPool.Wait()
+				bar := ic.c.createProgressBar(progressPool, false, types.BlobInfo{Digest: srcInfo.Digest, Size: 0}, "config", "skipped: already exists")
+				defer bar.Abort(false)
+				bar.mark100PercentComplete()
+			}()
+			ic.c.reportProgress(ProgressEvent{Kind: ConfigCopied, Digest: srcInfo.Digest, LayerIndex: -1, Total: srcInfo.Size})
+			return nil
+		}
+
 		destInfo, err := func() (types.BlobInfo, error) { // A scope for defer
 			progressPool := ic.c.newProgressPool()
 			defer progressPool.Wait()
@@ -550,7 +665,7 @@ func (ic *imageCopier) copyConfig(ctx context.Context, src types.Image) error {
 				return types.BlobInfo{}, fmt.Errorf("reading config blob %s: %w", srcInfo.Digest, err)
 			}
 
-			destInfo, err := ic.copyBlobFromStream(ctx, bytes.NewReader(configBlob), srcInfo, nil, true, false, bar, -1, false)
+			destInfo, _, err := ic.copyBlobFromStream(ctx, bytes.NewReader(configBlob), srcInfo, nil, true, false, bar, -1, false)
 			if err != nil {
 				return types.BlobInfo{}, err
 			}
@@ -564,6 +679,8 @@ func (ic *imageCopier) copyConfig(ctx context.Context, src types.Image) error {
 		if destInfo.Digest != srcInfo.Digest {
 			return fmt.Errorf("Internal error: copying uncompressed config blob %s changed digest to %s", srcInfo.Digest, destInfo.Digest)
 		}
+		ic.c.copiedConfigs.Add(srcInfo.Digest)
+		ic.c.reportProgress(ProgressEvent{Kind: ConfigCopied, Digest: srcInfo.Digest, LayerIndex: -1, Total: srcInfo.Size})
 	}
 	return nil
 }
@@ -576,60 +693,44 @@ type diffIDResult struct {
 }
 
 // copyLayer copies a layer with srcInfo (with known Digest and Annotations and possibly known Size) in src to dest, perhaps (de/re/)compressing it,
-// and returns a complete blobInfo of the copied layer, and a value for LayerDiffIDs if diffIDIsNeeded
+// and returns a complete blobInfo of the copied layer, a value for LayerDiffIDs if diffIDIsNeeded, and the compressor name of the copied layer
+// (the Name() of a pkg/compression.Algorithm, or internalblobinfocache.Uncompressed or internalblobinfocache.UnknownCompression).
 // srcRef can be used as an additional hint to the destination during checking whether a layer can be reused but srcRef can be nil.
-func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, toEncrypt bool, pool *mpb.Progress, layerIndex int, srcRef reference.Named, emptyLayer bool) (types.BlobInfo, digest.Digest, error) {
-	// If the srcInfo doesn't contain compression information, try to compute it from the
-	// MediaType, which was either read from a manifest by way of LayerInfos() or constructed
-	// by LayerInfosForCopy(), if it was supplied at all.  If we succeed in copying the blob,
-	// the BlobInfo we return will be passed to UpdatedImage() and then to UpdateLayerInfos(),
-	// which uses the compression information to compute the updated MediaType values.
-	// (Sadly UpdatedImage() is documented to not update MediaTypes from
-	//  ManifestUpdateOptions.LayerInfos[].MediaType, so we are doing it indirectly.)
-	//
-	// This MIME type → compression mapping belongs in manifest-specific code in our manifest
-	// package (but we should preferably replace/change UpdatedImage instead of productizing
-	// this workaround).
-	if srcInfo.CompressionAlgorithm == nil {
-		switch srcInfo.MediaType {
-		case manifest.DockerV2Schema2LayerMediaType, imgspecv1.MediaTypeImageLayerGzip:
-			srcInfo.CompressionAlgorithm = &compression.Gzip
-		case imgspecv1.MediaTypeImageLayerZstd:
-			srcInfo.CompressionAlgorithm = &compression.Zstd
-		}
-	}
+func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, toEncrypt bool, pool *mpb.Progress, layerIndex int, srcRef reference.Named, emptyLayer bool) (types.BlobInfo, digest.Digest, string, error) {
+	srcInfo = layerInfoWithCompression(srcInfo)
 
 	ic.c.printCopyInfo("blob", srcInfo)
 
 	cachedDiffID := ic.c.blobInfoCache.UncompressedDigest(srcInfo.Digest) // May be ""
 	diffIDIsNeeded := ic.diffIDsAreNeeded && cachedDiffID == ""
-	// When encrypting to decrypting, only use the simple code path. We might be able to optimize more
-	// (e.g. if we know the DiffID of an encrypted compressed layer, it might not be necessary to pull, decrypt and decompress again),
-	// but it’s not trivially safe to do such things, so until someone takes the effort to make a comprehensive argument, let’s not.
-	encryptingOrDecrypting := toEncrypt || (isOciEncrypted(srcInfo.MediaType) && ic.c.ociDecryptConfig != nil)
+	encryptingOrDecrypting := ic.encryptingOrDecrypting(srcInfo, toEncrypt)
 	canAvoidProcessingCompleteLayer := !diffIDIsNeeded && !encryptingOrDecrypting
 
+	if ic.layerUsesCheckpoint(srcInfo, toEncrypt) {
+		reused, blobInfo, checkpointedDiffID, err := ic.tryReusingCheckpointedLayer(ctx, srcInfo, diffIDIsNeeded, pool, layerIndex, emptyLayer)
+		if err != nil {
+			return types.BlobInfo{}, "", "", err
+		}
+		if reused {
+			if checkpointedDiffID == "" {
+				checkpointedDiffID = cachedDiffID
+			}
+			return blobInfo, checkpointedDiffID, compressorNameFromBlobInfo(blobInfo), nil
+		}
+	}
+
 	// Don’t read the layer from the source if we already have the blob, and optimizations are acceptable.
 	if canAvoidProcessingCompleteLayer {
-		canChangeLayerCompression := ic.src.CanChangeLayerCompression(srcInfo.MediaType)
-		logrus.Debugf("Checking if we can reuse blob %s: general substitution = %v, compression for MIME type %q = %v",
-			srcInfo.Digest, ic.canSubstituteBlobs, srcInfo.MediaType, canChangeLayerCompression)
-		canSubstitute := ic.canSubstituteBlobs && ic.src.CanChangeLayerCompression(srcInfo.MediaType)
-		// TODO: at this point we don't know whether or not a blob we end up reusing is compressed using an algorithm
-		// that is acceptable for use on layers in the manifest that we'll be writing later, so if we end up reusing
-		// a blob that's compressed with e.g. zstd, but we're only allowed to write a v2s2 manifest, this will cause
-		// a failure when we eventually try to update the manifest with the digest and MIME type of the reused blob.
-		// Fixing that will probably require passing more information to TryReusingBlob() than the current version of
-		// the ImageDestination interface lets us pass in.
-		reused, reusedBlob, err := ic.c.dest.TryReusingBlobWithOptions(ctx, srcInfo, private.TryReusingBlobOptions{
-			Cache:         ic.c.blobInfoCache,
-			CanSubstitute: canSubstitute,
-			EmptyLayer:    emptyLayer,
-			LayerIndex:    &layerIndex,
-			SrcRef:        srcRef,
-		})
-		if err != nil {
-			return types.BlobInfo{}, "", fmt.Errorf("trying to reuse blob %s at destination: %w", srcInfo.Digest, err)
+		var reused bool
+		var reusedBlob private.ReusedBlob
+		if prechecked, ok := ic.precheckedReuse[layerIndex]; ok {
+			reused, reusedBlob = prechecked.reused, prechecked.blob
+		} else {
+			var err error
+			reused, reusedBlob, err = ic.tryReusingLayer(ctx, srcInfo, layerIndex, srcRef, emptyLayer)
+			if err != nil {
+				return types.BlobInfo{}, "", "", err
+			}
 		}
 		if reused {
 			logrus.Debugf("Skipping blob %s (already present):", srcInfo.Digest)
@@ -640,22 +741,18 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 			}()
 
 			// Throw an event that the layer has been skipped
-			if ic.c.progress != nil && ic.c.progressInterval > 0 {
-				ic.c.progress <- types.ProgressProperties{
-					Event:    types.ProgressEventSkipped,
-					Artifact: srcInfo,
-				}
-			}
+			ic.c.reportLayerSkipped(srcInfo, layerIndex, LayerSkippedAlreadyExists)
 
-			return updatedBlobInfoFromReuse(srcInfo, reusedBlob), cachedDiffID, nil
+			blobInfo := updatedBlobInfoFromReuse(srcInfo, reusedBlob)
+			return blobInfo, cachedDiffID, compressorNameFromBlobInfo(blobInfo), nil
 		}
 	}
 
 	// A partial pull is managed by the destination storage, that decides what portions
 	// of the source file are not known yet and must be fetched.
-	// Attempt a partial only when the source allows to retrieve a blob partially and
-	// the destination has support for it.
-	if canAvoidProcessingCompleteLayer && ic.c.rawSource.SupportsGetBlobAt() && ic.c.dest.SupportsPutBlobPartial() {
+	// Attempt a partial only when the caller asked for it, the source allows to retrieve
+	// a blob partially and the destination has support for it.
+	if ic.c.enablePartialPull && canAvoidProcessingCompleteLayer && ic.c.rawSource.SupportsGetBlobAt() && ic.c.dest.SupportsPutBlobPartial() {
 		if reused, blobInfo := func() (bool, types.BlobInfo) { // A scope for defer
 			bar := ic.c.createProgressBar(pool, true, srcInfo, "blob", "done")
 			hideProgressBar := true
@@ -675,61 +772,160 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 				bar.mark100PercentComplete()
 				hideProgressBar = false
 				logrus.Debugf("Retrieved partial blob %v", srcInfo.Digest)
+				ic.c.reportPartialLayerCopied(srcInfo, layerIndex)
 				return true, updatedBlobInfoFromUpload(srcInfo, uploadedBlob)
 			}
 			logrus.Debugf("Failed to retrieve partial blob: %v", err)
 			return false, types.BlobInfo{}
 		}(); reused {
-			return blobInfo, cachedDiffID, nil
+			return blobInfo, cachedDiffID, compressorNameFromBlobInfo(blobInfo), nil
 		}
 	}
 
 	// Fallback: copy the layer, computing the diffID if we need to do so
-	return func() (types.BlobInfo, digest.Digest, error) { // A scope for defer
+	return func() (types.BlobInfo, digest.Digest, string, error) { // A scope for defer
 		bar := ic.c.createProgressBar(pool, false, srcInfo, "blob", "done")
 		defer bar.Abort(false)
 
 		srcStream, srcBlobSize, err := ic.c.rawSource.GetBlob(ctx, srcInfo, ic.c.blobInfoCache)
 		if err != nil {
-			return types.BlobInfo{}, "", fmt.Errorf("reading blob %s: %w", srcInfo.Digest, err)
+			return types.BlobInfo{}, "", "", fmt.Errorf("reading blob %s: %w", srcInfo.Digest, err)
 		}
 		defer srcStream.Close()
 
-		blobInfo, diffIDChan, err := ic.copyLayerFromStream(ctx, srcStream, types.BlobInfo{Digest: srcInfo.Digest, Size: srcBlobSize, MediaType: srcInfo.MediaType, Annotations: srcInfo.Annotations}, diffIDIsNeeded, toEncrypt, bar, layerIndex, emptyLayer)
+		blobInfo, compressorName, diffIDChan, err := ic.copyLayerFromStream(ctx, srcStream, types.BlobInfo{Digest: srcInfo.Digest, Size: srcBlobSize, MediaType: srcInfo.MediaType, Annotations: srcInfo.Annotations}, diffIDIsNeeded, toEncrypt, bar, layerIndex, emptyLayer)
 		if err != nil {
-			return types.BlobInfo{}, "", err
+			return types.BlobInfo{}, "", "", err
 		}
 
 		diffID := cachedDiffID
 		if diffIDIsNeeded {
-			select {
-			case <-ctx.Done():
-				return types.BlobInfo{}, "", ctx.Err()
-			case diffIDResult := <-diffIDChan:
-				if diffIDResult.err != nil {
-					return types.BlobInfo{}, "", fmt.Errorf("computing layer DiffID: %w", diffIDResult.err)
-				}
-				logrus.Debugf("Computed DiffID %s for layer %s", diffIDResult.digest, srcInfo.Digest)
-				// Don’t record any associations that involve encrypted data. This is a bit crude,
-				// some blob substitutions (replacing pulls of encrypted data with local reuse of known decryption outcomes)
-				// might be safe, but it’s not trivially obvious, so let’s be conservative for now.
-				// This crude approach also means we don’t need to record whether a blob is encrypted
-				// in the blob info cache (which would probably be necessary for any more complex logic),
-				// and the simplicity is attractive.
-				if !encryptingOrDecrypting {
-					// This is safe because we have just computed diffIDResult.Digest ourselves, and in the process
-					// we have read all of the input blob, so srcInfo.Digest must have been validated by digestingReader.
-					ic.c.blobInfoCache.RecordDigestUncompressedPair(srcInfo.Digest, diffIDResult.digest)
-				}
-				diffID = diffIDResult.digest
+			// copyLayerFromStream has closed the input of the DiffID computation, so this does not block for long
+			// even if ctx is canceled; receiving from diffIDChan ensures that the goroutine has exited.
+			diffIDResult := <-diffIDChan
+			if ctx.Err() != nil {
+				return types.BlobInfo{}, "", "", ctx.Err()
+			}
+			if diffIDResult.err != nil {
+				return types.BlobInfo{}, "", "", fmt.Errorf("computing layer DiffID: %w", diffIDResult.err)
+			}
+			logrus.Debugf("Computed DiffID %s for layer %s", diffIDResult.digest, srcInfo.Digest)
+			// Don’t record any associations that involve encrypted data. This is a bit crude,
+			// some blob substitutions (replacing pulls of encrypted data with local reuse of known decryption outcomes)
+			// might be safe, but it’s not trivially obvious, so let’s be conservative for now.
+			// This crude approach also means we don’t need to record whether a blob is encrypted
+			// in the blob info cache (which would probably be necessary for any more complex logic),
+			// and the simplicity is attractive.
+			if !encryptingOrDecrypting {
+				// This is safe because we have just computed diffIDResult.Digest ourselves, and in the process
+				// we have read all of the input blob, so srcInfo.Digest must have been validated by digestverify.Reader.
+				ic.c.blobInfoCache.RecordDigestUncompressedPair(srcInfo.Digest, diffIDResult.digest)
 			}
+			diffID = diffIDResult.digest
 		}
 
 		bar.mark100PercentComplete()
-		return blobInfo, diffID, nil
+		return blobInfo, diffID, compressorName, nil
 	}()
 }
 
+// layerInfoWithCompression returns srcInfo, with CompressionAlgorithm set from the MIME type if it is not set.
+func layerInfoWithCompression(srcInfo types.BlobInfo) types.BlobInfo {
+	// If the srcInfo doesn't contain compression information, try to compute it from the
+	// MediaType, which was either read from a manifest by way of LayerInfos() or constructed
+	// by LayerInfosForCopy(), if it was supplied at all.  If we succeed in copying the blob,
+	// the BlobInfo we return will be passed to UpdatedImage() and then to UpdateLayerInfos(),
+	// which uses the compression information to compute the updated MediaType values.
+	// (Sadly UpdatedImage() is documented to not update MediaTypes from
+	//  ManifestUpdateOptions.LayerInfos[].MediaType, so we are doing it indirectly.)
+	//
+	// We should preferably replace/change UpdatedImage instead of productizing this workaround.
+	if srcInfo.CompressionAlgorithm == nil {
+		if algorithm, known := manifest.CompressionFromMediaType(srcInfo.MediaType); known && algorithm != nil {
+			srcInfo.CompressionAlgorithm = algorithm
+		}
+	}
+	return srcInfo
+}
+
+// encryptingOrDecrypting returns true if copying a layer with srcInfo encrypts or decrypts it.
+func (ic *imageCopier) encryptingOrDecrypting(srcInfo types.BlobInfo, toEncrypt bool) bool {
+	// When encrypting to decrypting, only use the simple code path. We might be able to optimize more
+	// (e.g. if we know the DiffID of an encrypted compressed layer, it might not be necessary to pull, decrypt and decompress again),
+	// but it’s not trivially safe to do such things, so until someone takes the effort to make a comprehensive argument, let’s not.
+	return toEncrypt || (isOciEncrypted(srcInfo.MediaType) && ic.c.ociDecryptConfig != nil)
+}
+
+// tryReusingLayer asks the destination whether it can reuse a layer with srcInfo instead of copying it.
+func (ic *imageCopier) tryReusingLayer(ctx context.Context, srcInfo types.BlobInfo, layerIndex int, srcRef reference.Named, emptyLayer bool) (bool, private.ReusedBlob, error) {
+	canChangeLayerCompression := ic.src.CanChangeLayerCompression(srcInfo.MediaType)
+	logrus.Debugf("Checking if we can reuse blob %s: general substitution = %v, compression for MIME type %q = %v",
+		srcInfo.Digest, ic.canSubstituteBlobs, srcInfo.MediaType, canChangeLayerCompression)
+	canSubstitute := ic.canSubstituteBlobs && canChangeLayerCompression
+	if canSubstitute {
+		// Prefer a variant which is already compressed the way we would compress the layer, over reusing the original blob.
+		if reused, reusedBlob, err := ic.tryReusingCompressionVariant(ctx, srcInfo, layerIndex, srcRef, emptyLayer); err != nil || reused {
+			return reused, reusedBlob, err
+		}
+	}
+	// TODO: at this point we don't know whether or not a blob we end up reusing is compressed using an algorithm
+	// that is acceptable for use on layers in the manifest that we'll be writing later, so if we end up reusing
+	// a blob that's compressed with e.g. zstd, but we're only allowed to write a v2s2 manifest, this will cause
+	// a failure when we eventually try to update the manifest with the digest and MIME type of the reused blob.
+	// Fixing that will probably require passing more information to TryReusingBlob() than the current version of
+	// the ImageDestination interface lets us pass in.
+	reused, reusedBlob, err := ic.c.dest.TryReusingBlobWithOptions(ctx, srcInfo, private.TryReusingBlobOptions{
+		Cache:         ic.c.blobInfoCache,
+		CanSubstitute: canSubstitute,
+		EmptyLayer:    emptyLayer,
+		LayerIndex:    &layerIndex,
+		SrcRef:        srcRef,
+	})
+	if err != nil {
+		return false, private.ReusedBlob{}, fmt.Errorf("trying to reuse blob %s at destination: %w", srcInfo.Digest, err)
+	}
+	if reused {
+		// FIXME? We could pass the required compression to the destination, and let it choose a matching substitute.
+		if required := ic.requiredLayerCompression(srcInfo, false); required != nil {
+			if compressorName := compressorNameFromBlobInfo(updatedBlobInfoFromReuse(srcInfo, reusedBlob)); compressorName != required.Name() {
+				logrus.Debugf("Not reusing blob %s compressed with %s, %s is required", reusedBlob.Digest, compressorName, required.Name())
+				return false, private.ReusedBlob{}, nil
+			}
+		}
+	}
+	return reused, reusedBlob, nil
+}
+
+// tryReusingCompressionVariant asks the destination whether it can reuse the preferredCompressionVariant of a layer with srcInfo,
+// if there is one, instead of copying the layer.
+func (ic *imageCopier) tryReusingCompressionVariant(ctx context.Context, srcInfo types.BlobInfo, layerIndex int, srcRef reference.Named, emptyLayer bool) (bool, private.ReusedBlob, error) {
+	variant, ok := ic.preferredCompressionVariant(srcInfo)
+	if !ok {
+		return false, private.ReusedBlob{}, nil
+	}
+	logrus.Debugf("Checking if we can reuse blob %s compressed with %s instead of %s", variant.Digest, variant.CompressorName, srcInfo.Digest)
+	reused, reusedBlob, err := ic.c.dest.TryReusingBlobWithOptions(ctx, types.BlobInfo{Digest: variant.Digest, Size: -1}, private.TryReusingBlobOptions{
+		Cache:         ic.c.blobInfoCache,
+		CanSubstitute: false,
+		EmptyLayer:    emptyLayer,
+		LayerIndex:    &layerIndex,
+		SrcRef:        srcRef,
+	})
+	if err != nil {
+		return false, private.ReusedBlob{}, fmt.Errorf("trying to reuse blob %s at destination: %w", variant.Digest, err)
+	}
+	if !reused || reusedBlob.Digest != variant.Digest {
+		return false, private.ReusedBlob{}, nil
+	}
+	// The destination reports the compression only when substituting blobs; we know it from the cache.
+	reusedBlob.CompressionOperation, reusedBlob.CompressionAlgorithm, err = internalblobinfocache.OperationAndAlgorithmForCompressor(variant.CompressorName)
+	if err != nil {
+		logrus.Debugf("Not reusing blob %s: %v", variant.Digest, err)
+		return false, private.ReusedBlob{}, nil
+	}
+	return true, reusedBlob, nil
+}
+
 // updatedBlobInfoFromReuse returns inputInfo updated with reusedBlob which was created based on inputInfo.
 func updatedBlobInfoFromReuse(inputInfo types.BlobInfo, reusedBlob private.ReusedBlob) types.BlobInfo {
 	// The transport is only tasked with finding the blob, determining its size if necessary, and returning the right
@@ -759,9 +955,9 @@ func updatedBlobInfoFromReuse(inputInfo types.BlobInfo, reusedBlob private.Reuse
 // copyLayerFromStream is an implementation detail of copyLayer; mostly providing a separate “defer” scope.
 // it copies a blob with srcInfo (with known Digest and Annotations and possibly known Size) from srcStream to dest,
 // perhaps (de/re/)compressing the stream,
-// and returns a complete blobInfo of the copied blob and perhaps a <-chan diffIDResult if diffIDIsNeeded, to be read by the caller.
+// and returns a complete blobInfo of the copied blob, its compressor name, and perhaps a <-chan diffIDResult if diffIDIsNeeded, to be read by the caller.
 func (ic *imageCopier) copyLayerFromStream(ctx context.Context, srcStream io.Reader, srcInfo types.BlobInfo,
-	diffIDIsNeeded bool, toEncrypt bool, bar *progressBar, layerIndex int, emptyLayer bool) (types.BlobInfo, <-chan diffIDResult, error) {
+	diffIDIsNeeded bool, toEncrypt bool, bar *progressBar, layerIndex int, emptyLayer bool) (types.BlobInfo, string, <-chan diffIDResult, error) {
 	var getDiffIDRecorder func(compressiontypes.DecompressorFunc) io.Writer // = nil
 	var diffIDChan chan diffIDResult
 
@@ -769,25 +965,32 @@ func (ic *imageCopier) copyLayerFromStream(ctx context.Context, srcStream io.Rea
 	if diffIDIsNeeded {
 		diffIDChan = make(chan diffIDResult, 1) // Buffered, so that sending a value after this or our caller has failed and exited does not block.
 		pipeReader, pipeWriter := io.Pipe()
+		goroutineStarted := false
 		defer func() { // Note that this is not the same as {defer pipeWriter.CloseWithError(err)}; we need err to be evaluated lazily.
 			_ = pipeWriter.CloseWithError(err) // CloseWithError(nil) is equivalent to Close(), always returns nil
+			// On failure, the caller does not read from diffIDChan; wait for the goroutine to exit here,
+			// which it does promptly now that the pipe is closed.
+			if err != nil && goroutineStarted {
+				<-diffIDChan
+			}
 		}()
 
 		getDiffIDRecorder = func(decompressor compressiontypes.DecompressorFunc) io.Writer {
 			// If this fails, e.g. because we have exited and due to pipeWriter.CloseWithError() above further
 			// reading from the pipe has failed, we don’t really care.
-			// We only read from diffIDChan if the rest of the flow has succeeded, and when we do read from it,
-			// the return value includes an error indication, which we do check.
+			// We only use the value from diffIDChan if the rest of the flow has succeeded, and when we do,
+			// the value includes an error indication, which we do check.
 			//
 			// If this gets never called, pipeReader will not be used anywhere, but pipeWriter will only be
 			// closed above, so we are happy enough with both pipeReader and pipeWriter to just get collected by GC.
 			go diffIDComputationGoroutine(diffIDChan, pipeReader, decompressor) // Closes pipeReader
+			goroutineStarted = true
 			return pipeWriter
 		}
 	}
 
-	blobInfo, err := ic.copyBlobFromStream(ctx, srcStream, srcInfo, getDiffIDRecorder, false, toEncrypt, bar, layerIndex, emptyLayer) // Sets err to nil on success
-	return blobInfo, diffIDChan, err
+	blobInfo, compressorName, err := ic.copyBlobFromStream(ctx, srcStream, srcInfo, getDiffIDRecorder, false, toEncrypt, bar, layerIndex, emptyLayer) // Sets err to nil on success
+	return blobInfo, compressorName, diffIDChan, err
 	// We need the defer … pipeWriter.CloseWithError() to happen HERE so that the caller can block on reading from diffIDChan
 }
 
@@ -2,16 +2,27 @@ package copy
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker"
+	internalblobinfocache "github.com/containers/image/v5/internal/blobinfocache"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/blobinfocache"
 	"github.com/containers/image/v5/pkg/compression"
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	"github.com/containers/image/v5/pkg/registrytest"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -139,3 +150,373 @@ func TestComputeDiffID(t *testing.T) {
 	_, err = computeDiffID(reader, nil)
 	assert.Error(t, err)
 }
+
+func TestImageMaxLayers(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+	copyTo := func(t *testing.T, srcDir string, options *Options) (string, error) {
+		srcRef, err := directory.NewReference(srcDir)
+		require.NoError(t, err)
+		destDir := t.TempDir()
+		destRef, err := directory.NewReference(destDir)
+		require.NoError(t, err)
+		_, err = Image(context.Background(), policyContext, destRef, srcRef, options)
+		return destDir, err
+	}
+
+	// A single image
+	srcDir := t.TempDir()
+	writeTestImage(t, srcDir, testImage{layers: numberedLayers(3)})
+	for _, maxLayers := range []int{0, 3, 4} {
+		_, err := copyTo(t, srcDir, &Options{MaxLayers: maxLayers})
+		assert.NoError(t, err, maxLayers)
+	}
+	destDir, err := copyTo(t, srcDir, &Options{MaxLayers: 2})
+	assert.ErrorContains(t, err, "has 3 layers, more than the maximum of 2")
+	_, err = os.Stat(filepath.Join(destDir, "manifest.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	entries, err := os.ReadDir(destDir)
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.Equal(t, "version", e.Name()) // No layers have been copied
+	}
+
+	// Invalid values
+	_, err = copyTo(t, srcDir, &Options{MaxLayers: -1})
+	assert.Error(t, err)
+
+	// A manifest list: each instance is checked separately
+	srcDir = t.TempDir()
+	smallInstance := writeTestImage(t, srcDir, testImage{layers: numberedLayers(1), asInstance: true})
+	largeInstance := writeTestImage(t, srcDir, testImage{layers: numberedLayers(3), asInstance: true})
+	amd64 := imgspecv1.Platform{OS: "linux", Architecture: "amd64"}
+	writeTestList(t, srcDir, manifest.DockerV2ListMediaType, [][]byte{smallInstance, largeInstance}, []imgspecv1.Platform{amd64, amd64})
+
+	_, err = copyTo(t, srcDir, &Options{ImageListSelection: CopyAllImages, MaxLayers: 3})
+	assert.NoError(t, err)
+	_, err = copyTo(t, srcDir, &Options{ImageListSelection: CopyAllImages, MaxLayers: 2})
+	assert.ErrorContains(t, err, "has 3 layers, more than the maximum of 2")
+	_, err = copyTo(t, srcDir, &Options{
+		ImageListSelection: CopySpecificImages,
+		Instances:          []digest.Digest{digest.FromBytes(smallInstance)},
+		MaxLayers:          2,
+	})
+	assert.NoError(t, err)
+}
+
+func TestImageReusesCompressionVariant(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	srcDir := t.TempDir()
+	writeTestImage(t, srcDir, testImage{layers: numberedLayers(2)})
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	uncompressedLayer := []byte("layer 0 of 2")
+	// Use a compression level different from the default, so that the variant differs from what the copy would create.
+	zstdLayer := bytes.Buffer{}
+	level := 1
+	compressor, err := compression.CompressStream(&zstdLayer, compression.Zstd, &level)
+	require.NoError(t, err)
+	_, err = compressor.Write(uncompressedLayer)
+	require.NoError(t, err)
+	err = compressor.Close()
+	require.NoError(t, err)
+	zstdDigest := digest.FromBytes(zstdLayer.Bytes())
+
+	for _, recordVariant := range []bool{false, true} {
+		server := registrytest.NewServer(nil)
+		defer server.Close()
+		server.PutBlob("dest", zstdLayer.Bytes())
+		destRef, err := docker.ParseReference("//" + server.Host() + "/dest:latest")
+		require.NoError(t, err)
+		destCtx := server.SystemContext()
+		destCtx.BlobInfoCacheDir = t.TempDir()
+		destCtx.CompressionFormat = &compression.Zstd
+		if recordVariant {
+			cache := internalblobinfocache.FromBlobInfoCache(blobinfocache.DefaultCache(destCtx))
+			cache.RecordDigestUncompressedPair(zstdDigest, digest.FromBytes(uncompressedLayer))
+			cache.RecordDigestCompressorName(zstdDigest, compressiontypes.ZstdAlgorithmName)
+		}
+
+		_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+			DestinationCtx:        destCtx,
+			ForceManifestMIMEType: imgspecv1.MediaTypeImageManifest,
+		})
+		require.NoError(t, err)
+
+		manifestBlob, _, ok := server.Manifest("dest", "latest")
+		require.True(t, ok)
+		m, err := manifest.OCI1FromManifest(manifestBlob)
+		require.NoError(t, err)
+		require.Len(t, m.Layers, 2)
+		for _, layer := range m.Layers {
+			assert.Equal(t, imgspecv1.MediaTypeImageLayerZstd, layer.MediaType)
+		}
+		if recordVariant {
+			assert.Equal(t, zstdDigest, m.Layers[0].Digest)
+			assert.Equal(t, int64(zstdLayer.Len()), m.Layers[0].Size)
+		} else {
+			assert.NotEqual(t, zstdDigest, m.Layers[0].Digest)
+		}
+		// The layer was uploaded only if the variant was not known.
+		uploads := 0
+		for _, r := range server.Requests() {
+			if r.Method == http.MethodPut && r.Query.Get("digest") == m.Layers[0].Digest.String() {
+				uploads++
+			}
+		}
+		if recordVariant {
+			assert.Equal(t, 0, uploads)
+		} else {
+			assert.Equal(t, 1, uploads)
+		}
+	}
+}
+
+func TestImageSharedConfigCopiedOnce(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// A manifest list with two instances which share a config, but differ in layers.
+	srcDir := t.TempDir()
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	configDigest := digest.FromBytes(config)
+	instances := [][]byte{}
+	for _, layer := range [][]byte{[]byte("layer of instance 1"), []byte("layer of instance 2")} {
+		instances = append(instances, writeTestImage(t, srcDir, testImage{config: config, layers: [][]byte{layer}, asInstance: true}))
+	}
+	amd64 := imgspecv1.Platform{OS: "linux", Architecture: "amd64"}
+	writeTestList(t, srcDir, manifest.DockerV2ListMediaType, instances, []imgspecv1.Platform{amd64, amd64})
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+
+	server := registrytest.NewServer(nil)
+	defer server.Close()
+	destRef, err := docker.ParseReference("//" + server.Host() + "/dest:latest")
+	require.NoError(t, err)
+	destCtx := server.SystemContext()
+	destCtx.BlobInfoCacheDir = t.TempDir()
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		DestinationCtx:     destCtx,
+		ImageListSelection: CopyAllImages,
+	})
+	require.NoError(t, err)
+
+	// The config was checked for, and uploaded, only once.
+	configChecks, configUploads := 0, 0
+	for _, r := range server.Requests() {
+		if r.Method == http.MethodHead && r.Path == "/v2/dest/blobs/"+configDigest.String() {
+			configChecks++
+		}
+		if r.Method == http.MethodPut && r.Query.Get("digest") == configDigest.String() {
+			configUploads++
+		}
+	}
+	assert.Equal(t, 1, configChecks)
+	assert.Equal(t, 1, configUploads)
+	_, ok := server.Blob("dest", configDigest)
+	assert.True(t, ok)
+	// Both instances refer to the config.
+	listBlob, _, ok := server.Manifest("dest", "latest")
+	require.True(t, ok)
+	destList, err := manifest.Schema2ListFromManifest(listBlob)
+	require.NoError(t, err)
+	require.Len(t, destList.Instances(), 2)
+	for _, instanceDigest := range destList.Instances() {
+		manifestBlob, _, ok := server.Manifest("dest", instanceDigest.String())
+		require.True(t, ok)
+		m, err := manifest.Schema2FromManifest(manifestBlob)
+		require.NoError(t, err)
+		assert.Equal(t, configDigest, m.ConfigInfo().Digest)
+	}
+}
+
+func TestImageForceCompressionFormat(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	// readOCIManifest returns the OCI manifest of ref.
+	readOCIManifest := func(ref types.ImageReference) *manifest.OCI1 {
+		src, err := ref.NewImageSource(context.Background(), nil)
+		require.NoError(t, err)
+		defer src.Close()
+		manifestBlob, mimeType, err := src.GetManifest(context.Background(), nil)
+		require.NoError(t, err)
+		require.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+		m, err := manifest.OCI1FromManifest(manifestBlob)
+		require.NoError(t, err)
+		return m
+	}
+
+	// Create a gzip-compressed OCI image.
+	dirDir := t.TempDir()
+	writeTestImage(t, dirDir, testImage{layers: numberedLayers(2)})
+	dirRef, err := directory.NewReference(dirDir)
+	require.NoError(t, err)
+	srcDir := t.TempDir()
+	srcRef, err := layout.NewReference(srcDir, "src")
+	require.NoError(t, err)
+	_, err = Image(context.Background(), policyContext, srcRef, dirRef, &Options{})
+	require.NoError(t, err)
+	srcManifest := readOCIManifest(srcRef)
+	require.Len(t, srcManifest.Layers, 2)
+	for _, layer := range srcManifest.Layers {
+		require.Equal(t, imgspecv1.MediaTypeImageLayerGzip, layer.MediaType)
+	}
+
+	for _, force := range []bool{false, true} {
+		// The destination already contains the gzip-compressed layers.
+		destDir := t.TempDir()
+		oldRef, err := layout.NewReference(destDir, "old")
+		require.NoError(t, err)
+		_, err = Image(context.Background(), policyContext, oldRef, srcRef, &Options{})
+		require.NoError(t, err)
+
+		destRef, err := layout.NewReference(destDir, "new")
+		require.NoError(t, err)
+		cacheDir := t.TempDir()
+		_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+			DestinationCtx:         &types.SystemContext{BlobInfoCacheDir: cacheDir},
+			CompressionFormat:      &compression.Zstd,
+			ForceCompressionFormat: force,
+		})
+		require.NoError(t, err)
+
+		destManifest := readOCIManifest(destRef)
+		require.Len(t, destManifest.Layers, 2)
+		if !force {
+			// The existing gzip-compressed layers were reused.
+			for i, layer := range destManifest.Layers {
+				assert.Equal(t, srcManifest.Layers[i], layer)
+			}
+			continue
+		}
+		cache := blobinfocache.DefaultCache(&types.SystemContext{BlobInfoCacheDir: cacheDir})
+		for i, layer := range destManifest.Layers {
+			assert.Equal(t, imgspecv1.MediaTypeImageLayerZstd, layer.MediaType)
+			assert.NotEqual(t, srcManifest.Layers[i].Digest, layer.Digest)
+			blob, err := os.ReadFile(filepath.Join(destDir, "blobs", layer.Digest.Algorithm().String(), layer.Digest.Encoded()))
+			require.NoError(t, err)
+			assert.Equal(t, layer.Digest, digest.FromBytes(blob))
+			assert.Equal(t, int64(len(blob)), layer.Size)
+			algorithm, _, _, err := compression.DetectCompressionFormat(bytes.NewReader(blob))
+			require.NoError(t, err)
+			assert.Equal(t, compressiontypes.ZstdAlgorithmName, algorithm.Name())
+			// The blob info cache knows that the zstd layer has the same uncompressed contents as the gzip one.
+			uncompressedDigest := digest.FromBytes([]byte(fmt.Sprintf("layer %d of 2", i)))
+			assert.Equal(t, uncompressedDigest, cache.UncompressedDigest(layer.Digest))
+			assert.Equal(t, uncompressedDigest, cache.UncompressedDigest(srcManifest.Layers[i].Digest))
+		}
+	}
+
+	// zstd can not be represented in Docker schema2 manifests.
+	server := registrytest.NewServer(nil)
+	defer server.Close()
+	destRef, err := docker.ParseReference("//" + server.Host() + "/dest:latest")
+	require.NoError(t, err)
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{
+		DestinationCtx:         server.SystemContext(),
+		CompressionFormat:      &compression.Zstd,
+		ForceCompressionFormat: true,
+		ForceManifestMIMEType:  manifest.DockerV2Schema2MediaType,
+	})
+	assert.ErrorContains(t, err, "Layers are required to be compressed with zstd")
+	assert.Empty(t, server.Tags("dest"))
+
+	// Forcing a compression format requires a format to be set.
+	_, err = Image(context.Background(), policyContext, destRef, srcRef, &Options{ForceCompressionFormat: true})
+	assert.Error(t, err)
+}
+
+// inFlightTracker records the number of concurrently open blob streams.
+type inFlightTracker struct {
+	mutex       sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+// getBlob is a faultInjection.getBlob implementation which records stream as in flight until it is closed.
+func (tracker *inFlightTracker) getBlob(stream io.ReadCloser, _ context.CancelFunc) io.ReadCloser {
+	tracker.mutex.Lock()
+	tracker.inFlight++
+	if tracker.inFlight > tracker.maxInFlight {
+		tracker.maxInFlight = tracker.inFlight
+	}
+	tracker.mutex.Unlock()
+	time.Sleep(20 * time.Millisecond) // Give other copies a chance to start.
+	return &inFlightStream{ReadCloser: stream, tracker: tracker}
+}
+
+// inFlightStream is a blob stream tracked by inFlightTracker.
+type inFlightStream struct {
+	io.ReadCloser
+	tracker *inFlightTracker
+	closed  bool
+}
+
+func (s *inFlightStream) Close() error {
+	if !s.closed {
+		s.closed = true
+		s.tracker.mutex.Lock()
+		s.tracker.inFlight--
+		s.tracker.mutex.Unlock()
+	}
+	return s.ReadCloser.Close()
+}
+
+func TestImageMaxParallelDownloads(t *testing.T) {
+	policyContext := newTestPolicyContext(t)
+
+	const numLayers = 10
+	srcDir := t.TempDir()
+	srcManifestBlob := writeTestImage(t, srcDir, testImage{layers: numberedLayers(numLayers)})
+	srcManifest, err := manifest.Schema2FromManifest(srcManifestBlob)
+	require.NoError(t, err)
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+
+	for _, limit := range []uint{1, 3, numLayers} {
+		tracker := &inFlightTracker{}
+		destDir := t.TempDir()
+		destRef, err := directory.NewReference(destDir)
+		require.NoError(t, err)
+		_, err = Image(context.Background(), policyContext, destRef, faultInjectionReference{
+			ImageReference: srcRef,
+			faults:         faultInjection{getBlob: tracker.getBlob, threadSafeGetBlob: true},
+		}, &Options{MaxParallelDownloads: limit})
+		require.NoError(t, err)
+		assert.Equal(t, int(limit), tracker.maxInFlight, limit)
+		assert.Equal(t, 0, tracker.inFlight, limit)
+
+		// The layers are in the original order, whatever order they were copied in.
+		destManifestBlob, err := os.ReadFile(filepath.Join(destDir, "manifest.json"))
+		require.NoError(t, err)
+		destManifest, err := manifest.Schema2FromManifest(destManifestBlob)
+		require.NoError(t, err)
+		assert.Equal(t, srcManifest.LayerInfos(), destManifest.LayerInfos(), limit)
+	}
+
+	// A failure to copy one layer cancels the others.
+	tracker := &inFlightTracker{}
+	getBlobCalls := 0
+	failure := errors.New("injected GetBlob failure")
+	destRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	_, err = Image(context.Background(), policyContext, destRef, faultInjectionReference{
+		ImageReference: srcRef,
+		faults: faultInjection{
+			getBlob: func(stream io.ReadCloser, cancel context.CancelFunc) io.ReadCloser {
+				tracker.mutex.Lock()
+				getBlobCalls++
+				fail := getBlobCalls == 4 // A layer, whether or not the config is read first
+				tracker.mutex.Unlock()
+				stream = tracker.getBlob(stream, cancel)
+				if fail {
+					return &faultyReader{source: stream, n: 0, fail: func() error { return failure }}
+				}
+				return stream
+			},
+			threadSafeGetBlob: true,
+		},
+	}, &Options{MaxParallelDownloads: 2})
+	assert.ErrorIs(t, err, failure)
+	assert.Less(t, getBlobCalls, numLayers+1)
+	assert.Equal(t, 0, tracker.inFlight)
+}
@@ -10,11 +10,15 @@ import (
 	"github.com/containers/image/v5/internal/imagesource/stubs"
 	"github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/rootpath"
 	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
 )
 
+// dirImageSource reads images from a directory.
+// File names are always derived from validated digests, and, as in oci/layout, reads are confined to the directory
+// even if it contains symbolic links which point elsewhere.
 type dirImageSource struct {
 	impl.Compat
 	impl.PropertyMethodsInitialize
@@ -55,7 +59,11 @@ func (s *dirImageSource) Close() error {
 // If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
 // this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
 func (s *dirImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
-	m, err := os.ReadFile(s.ref.manifestPath(instanceDigest))
+	path, err := s.ref.manifestPath(instanceDigest)
+	if err != nil {
+		return nil, "", err
+	}
+	m, err := rootpath.ReadFile(s.ref.path, path)
 	if err != nil {
 		return nil, "", err
 	}
@@ -66,12 +74,17 @@ func (s *dirImageSource) GetManifest(ctx context.Context, instanceDigest *digest
 // The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
 // May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
 func (s *dirImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
-	r, err := os.Open(s.ref.layerPath(info.Digest))
+	path, err := s.ref.layerPath(info.Digest)
+	if err != nil {
+		return nil, -1, err
+	}
+	r, err := rootpath.Open(s.ref.path, path)
 	if err != nil {
 		return nil, -1, err
 	}
 	fi, err := r.Stat()
 	if err != nil {
+		r.Close()
 		return nil, -1, err
 	}
 	return r, fi.Size(), nil
@@ -84,8 +97,11 @@ func (s *dirImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache
 func (s *dirImageSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error) {
 	signatures := []signature.Signature{}
 	for i := 0; ; i++ {
-		path := s.ref.signaturePath(i, instanceDigest)
-		sigBlob, err := os.ReadFile(path)
+		path, err := s.ref.signaturePath(i, instanceDigest)
+		if err != nil {
+			return nil, err
+		}
+		sigBlob, err := rootpath.ReadFile(s.ref.path, path)
 		if err != nil {
 			if os.IsNotExist(err) {
 				break
@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/containers/image/v5/internal/image"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache/memory"
 	"github.com/containers/image/v5/types"
@@ -64,7 +69,7 @@ func TestGetPutManifest(t *testing.T) {
 func TestGetPutBlob(t *testing.T) {
 	computedBlob := []byte("test-blob")
 	providedBlob := []byte("provided-blob")
-	providedDigest := digest.Digest("sha256:provided-test-digest")
+	providedDigest := digest.FromBytes(providedBlob)
 
 	ref, _ := refToTempDir(t)
 	cache := memory.New()
@@ -103,6 +108,108 @@ func TestGetPutBlob(t *testing.T) {
 	}
 }
 
+func TestGetBlobInvalidDigest(t *testing.T) {
+	ref, _ := refToTempDir(t)
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	for _, d := range []digest.Digest{
+		"sha256:../../../../etc/passwd",
+		"sha256:/etc/passwd",
+		"../../etc:passwd",
+	} {
+		_, _, err = src.GetBlob(context.Background(), types.BlobInfo{Digest: d, Size: -1}, memory.New())
+		assert.Error(t, err, d)
+		_, _, err = src.GetManifest(context.Background(), &d)
+		assert.Error(t, err, d)
+		_, err = src.GetSignatures(context.Background(), &d)
+		assert.Error(t, err, d)
+	}
+}
+
+func TestSourceSymlinks(t *testing.T) {
+	ref, tmpDir := refToTempDir(t)
+	outsideDir := t.TempDir()
+	blob := []byte("symlinked blob")
+	blobDigest := digest.FromBytes(blob)
+	err := os.WriteFile(filepath.Join(outsideDir, "blob"), blob, 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(tmpDir, "blob-within"), blob, 0o644)
+	require.NoError(t, err)
+
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+
+	// Symbolic links within the directory are followed
+	err = os.Symlink("blob-within", filepath.Join(tmpDir, blobDigest.Encoded()))
+	require.NoError(t, err)
+	rc, size, err := src.GetBlob(context.Background(), types.BlobInfo{Digest: blobDigest, Size: -1}, memory.New())
+	require.NoError(t, err)
+	contents, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, blob, contents)
+	assert.Equal(t, int64(len(blob)), size)
+
+	// Symbolic links to files outside of the directory are rejected
+	err = os.Remove(filepath.Join(tmpDir, blobDigest.Encoded()))
+	require.NoError(t, err)
+	for _, path := range []string{blobDigest.Encoded(), "manifest.json", "signature-1"} {
+		err = os.Symlink(filepath.Join(outsideDir, "blob"), filepath.Join(tmpDir, path))
+		require.NoError(t, err, path)
+	}
+	_, _, err = src.GetBlob(context.Background(), types.BlobInfo{Digest: blobDigest, Size: -1}, memory.New())
+	assert.Error(t, err)
+	_, _, err = src.GetManifest(context.Background(), nil)
+	assert.Error(t, err)
+	_, err = src.GetSignatures(context.Background(), nil)
+	assert.Error(t, err)
+}
+
+func TestSignaturesCanonicalOrder(t *testing.T) {
+	ctx := context.Background()
+	ref, _ := refToTempDir(t)
+	dirRef, ok := ref.(dirReference)
+	require.True(t, ok)
+	dest, err := newImageDestination(nil, dirRef)
+	require.NoError(t, err)
+	defer dest.Close()
+	err = dest.PutManifest(ctx, []byte("test-manifest"), nil)
+	require.NoError(t, err)
+
+	sigs := []signature.Signature{}
+	for i := 0; i < 4; i++ {
+		sigs = append(sigs, signature.SigstoreFromComponents(signature.SigstoreSignatureMIMEType, []byte(fmt.Sprintf("payload %d", i)), nil))
+	}
+	canonical, _, err := signature.CanonicalOrder(sigs)
+	require.NoError(t, err)
+	// Write the signatures in the reverse of the canonical order
+	written := []signature.Signature{}
+	for i := len(canonical) - 1; i >= 0; i-- {
+		written = append(written, canonical[i])
+	}
+	err = dest.PutSignaturesWithFormat(ctx, written, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+
+	src := newImageSource(dirRef)
+	defer src.Close()
+	// The transport returns the signatures in the order they were written …
+	res, err := src.GetSignaturesWithFormat(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, written, res)
+	// … but users of UnparsedImage see them in the canonical order.
+	unparsed := image.UnparsedInstance(src, nil)
+	res, err = unparsed.UntrustedSignatures(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, canonical, res)
+	indices, err := unparsed.UntrustedSignatureSourceIndices(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 2, 1, 0}, indices)
+}
+
 // readerFromFunc allows implementing Reader by any function, e.g. a closure.
 type readerFromFunc func([]byte) (int, error)
 
@@ -113,12 +220,13 @@ func (fn readerFromFunc) Read(p []byte) (int, error) {
 // TestPutBlobDigestFailure simulates behavior on digest verification failure.
 func TestPutBlobDigestFailure(t *testing.T) {
 	const digestErrorString = "Simulated digest error"
-	const blobDigest = digest.Digest("sha256:test-digest")
+	const blobDigest = digest.Digest("sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
 
 	ref, _ := refToTempDir(t)
 	dirRef, ok := ref.(dirReference)
 	require.True(t, ok)
-	blobPath := dirRef.layerPath(blobDigest)
+	blobPath, err := dirRef.layerPath(blobDigest)
+	require.NoError(t, err)
 	cache := memory.New()
 
 	firstRead := true
@@ -207,3 +315,47 @@ func TestSourceReference(t *testing.T) {
 	ref2 := src.Reference()
 	assert.Equal(t, tmpDir, ref2.StringWithinTransport())
 }
+
+func TestFileNames(t *testing.T) {
+	ref, tmpDir := refToTempDir(t)
+	cache := memory.New()
+	man := []byte("test-manifest")
+	instanceDigest := digest.FromString("instance")
+
+	dest, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	for _, blob := range []string{"blob 1", "blob 2", "blob 3"} {
+		_, err := dest.PutBlob(context.Background(), strings.NewReader(blob), types.BlobInfo{Size: -1}, cache, false)
+		require.NoError(t, err)
+	}
+	// Digests which differ only by case would collide on case-insensitive filesystems; only the canonical lowercase digests are accepted.
+	upperDigest := digest.Digest("sha256:" + strings.ToUpper(digest.FromString("blob 1").Encoded()))
+	_, _, err = dest.TryReusingBlob(context.Background(), types.BlobInfo{Digest: upperDigest, Size: -1}, cache, false)
+	assert.Error(t, err)
+	err = dest.PutManifest(context.Background(), man, &upperDigest)
+	assert.Error(t, err)
+	err = dest.PutManifest(context.Background(), man, nil)
+	require.NoError(t, err)
+	err = dest.PutManifest(context.Background(), man, &instanceDigest)
+	require.NoError(t, err)
+	err = dest.PutSignatures(context.Background(), [][]byte{[]byte("\xA3sig")}, &instanceDigest)
+	require.NoError(t, err)
+	err = dest.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+
+	// Simulate a case-insensitive filesystem: no two file names may differ only by case,
+	// and all names must be lowercase so that files created later can't collide either.
+	files, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	folded := map[string]string{}
+	for _, file := range files {
+		name := file.Name()
+		assert.Equal(t, strings.ToLower(name), name)
+		if other, ok := folded[strings.ToLower(name)]; ok {
+			t.Errorf("%q collides with %q on case-insensitive filesystems", name, other)
+		}
+		folded[strings.ToLower(name)] = name
+	}
+	assert.Len(t, files, 1+3+2+1) // version; 3 blobs; 2 manifests; a signature
+}
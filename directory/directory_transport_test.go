@@ -197,8 +197,16 @@ func TestReferenceManifestPath(t *testing.T) {
 	ref, tmpDir := refToTempDir(t)
 	dirRef, ok := ref.(dirReference)
 	require.True(t, ok)
-	assert.Equal(t, tmpDir+"/manifest.json", dirRef.manifestPath(nil))
-	assert.Equal(t, tmpDir+"/"+dhex.Encoded()+".manifest.json", dirRef.manifestPath(&dhex))
+	res, err := dirRef.manifestPath(nil)
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir+"/manifest.json", res)
+	res, err = dirRef.manifestPath(&dhex)
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir+"/"+dhex.Encoded()+".manifest.json", res)
+	for _, invalidDigest := range invalidDigests {
+		_, err = dirRef.manifestPath(&invalidDigest)
+		assert.Error(t, err, invalidDigest)
+	}
 }
 
 func TestReferenceLayerPath(t *testing.T) {
@@ -207,7 +215,13 @@ func TestReferenceLayerPath(t *testing.T) {
 	ref, tmpDir := refToTempDir(t)
 	dirRef, ok := ref.(dirReference)
 	require.True(t, ok)
-	assert.Equal(t, tmpDir+"/"+hex, dirRef.layerPath("sha256:"+hex))
+	res, err := dirRef.layerPath("sha256:" + hex)
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir+"/"+hex, res)
+	for _, invalidDigest := range invalidDigests {
+		_, err = dirRef.layerPath(invalidDigest)
+		assert.Error(t, err, invalidDigest)
+	}
 }
 
 func TestReferenceSignaturePath(t *testing.T) {
@@ -216,10 +230,33 @@ func TestReferenceSignaturePath(t *testing.T) {
 	ref, tmpDir := refToTempDir(t)
 	dirRef, ok := ref.(dirReference)
 	require.True(t, ok)
-	assert.Equal(t, tmpDir+"/signature-1", dirRef.signaturePath(0, nil))
-	assert.Equal(t, tmpDir+"/signature-10", dirRef.signaturePath(9, nil))
-	assert.Equal(t, tmpDir+"/"+dhex.Encoded()+".signature-1", dirRef.signaturePath(0, &dhex))
-	assert.Equal(t, tmpDir+"/"+dhex.Encoded()+".signature-10", dirRef.signaturePath(9, &dhex))
+	for _, c := range []struct {
+		input          int
+		instanceDigest *digest.Digest
+		expected       string
+	}{
+		{0, nil, tmpDir + "/signature-1"},
+		{9, nil, tmpDir + "/signature-10"},
+		{0, &dhex, tmpDir + "/" + dhex.Encoded() + ".signature-1"},
+		{9, &dhex, tmpDir + "/" + dhex.Encoded() + ".signature-10"},
+	} {
+		res, err := dirRef.signaturePath(c.input, c.instanceDigest)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, res)
+	}
+	for _, invalidDigest := range invalidDigests {
+		_, err := dirRef.signaturePath(0, &invalidDigest)
+		assert.Error(t, err, invalidDigest)
+	}
+}
+
+// invalidDigests are digests which must not be used to form a path.
+var invalidDigests = []digest.Digest{
+	"sha256:../hello",
+	"sha256:0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF", // Would collide with the lowercase variant on case-insensitive filesystems
+	"sha256:0123456789abcdef",
+	"unknown-algorithm:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	"",
 }
 
 func TestReferenceVersionPath(t *testing.T) {
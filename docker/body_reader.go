@@ -158,7 +158,12 @@ func (br *bodyReader) Read(p []byte) (int, error) {
 			logrus.Debugf("Error closing blob body: %v", err) // … and ignore err otherwise
 		}
 		br.body = nil
-		time.Sleep(1*time.Second + time.Duration(rand.Intn(100_000))*time.Microsecond) // Some jitter so that a failure blip doesn’t cause a deterministic stampede
+		delay := 1*time.Second + time.Duration(rand.Intn(100_000))*time.Microsecond // Some jitter so that a failure blip doesn’t cause a deterministic stampede
+		select {
+		case <-time.After(delay):
+		case <-br.ctx.Done():
+			return n, fmt.Errorf("%w (while reconnecting: %v)", originalErr, br.ctx.Err())
+		}
 
 		headers := map[string][]string{
 			"Range": {fmt.Sprintf("bytes=%d-", br.offset)},
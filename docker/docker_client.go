@@ -46,6 +46,7 @@ const (
 	blobsPath               = "/v2/%s/blobs/%s"
 	blobUploadPath          = "/v2/%s/blobs/uploads/"
 	extensionsSignaturePath = "/extensions/v2/%s/signatures/%s"
+	referrersPath           = "/v2/%s/referrers/%s"
 
 	minimumTokenLifetimeSeconds = 60
 
@@ -55,6 +56,9 @@ const (
 	backoffNumIterations = 5
 	backoffInitialDelay  = 2 * time.Second
 	backoffMaxDelay      = 60 * time.Second
+
+	defaultMaxReferrers       = 10000           // The default for SystemContext.DockerMaxReferrers
+	defaultMinUploadChunkSize = 8 * 1024 * 1024 // The default for SystemContext.DockerRegistryMinUploadChunkSize
 )
 
 type certPath struct {
@@ -107,7 +111,17 @@ type dockerClient struct {
 	registryToken          string
 	signatureBase          lookasideStorageBase
 	useSigstoreAttachments bool
-	scope                  authScope
+	useReferrersAPI        bool
+	// signatureAttachmentTagFormat is SystemContext.DockerSignatureAttachmentTagFormat; "" means the default.
+	signatureAttachmentTagFormat string
+	maxReferrers                 int   // The maximum number of referrers fetched by getReferrers
+	maxParallelUploads           int   // SystemContext.DockerRegistryMaxParallelUploads; 0 means unlimited
+	resumableUploads             bool  // SystemContext.DockerRegistryResumableUploads
+	minUploadChunkSize           int64 // The minimum size of chunks uploaded with resumableUploads
+	maxUploadRetries             int   // SystemContext.DockerMaxUploadRetries
+	lowSpeedLimit                int64 // SystemContext.DockerLowSpeedLimit; 0 if low speed detection is disabled
+	lowSpeedTime                 time.Duration
+	scope                        authScope
 
 	// The following members are detected registry properties:
 	// They are set after a successful detectProperties(), and never change afterwards.
@@ -118,6 +132,10 @@ type dockerClient struct {
 
 	// Private state for setupRequestAuth (key: string, value: bearerToken)
 	tokenCache sync.Map
+	// Private state of resumable uploads, used if shared is nil
+	uploads resumableUploadState
+	// State shared with other clients in a session, set by useSession; or nil.
+	shared *sharedRegistryState
 	// Private state for detectProperties:
 	detectPropertiesOnce  sync.Once // detectPropertiesOnce is used to execute detectProperties() at most once.
 	detectPropertiesError error     // detectPropertiesError caches the initial error.
@@ -236,6 +254,53 @@ func newDockerClientFromRef(sys *types.SystemContext, ref dockerReference, regis
 	}
 	client.signatureBase = sigBase
 	client.useSigstoreAttachments = registryConfig.useSigstoreAttachments(ref)
+	if sys != nil && sys.DockerUseSigstoreAttachments != types.OptionalBoolUndefined {
+		client.useSigstoreAttachments = sys.DockerUseSigstoreAttachments == types.OptionalBoolTrue
+	}
+	client.useReferrersAPI = registryConfig.useReferrersAPI(ref)
+	if sys != nil && sys.DockerSignatureAttachmentTagFormat != "" {
+		if err := validateSignatureAttachmentTagFormat(ref, sys.DockerSignatureAttachmentTagFormat); err != nil {
+			return nil, err
+		}
+		client.signatureAttachmentTagFormat = sys.DockerSignatureAttachmentTagFormat
+	}
+	client.maxReferrers = defaultMaxReferrers
+	if sys != nil && sys.DockerMaxReferrers != 0 {
+		if sys.DockerMaxReferrers < 0 {
+			return nil, fmt.Errorf("invalid DockerMaxReferrers value %d", sys.DockerMaxReferrers)
+		}
+		client.maxReferrers = sys.DockerMaxReferrers
+	}
+	if sys != nil && sys.DockerRegistryMaxParallelUploads != 0 {
+		if sys.DockerRegistryMaxParallelUploads < 0 {
+			return nil, fmt.Errorf("invalid DockerRegistryMaxParallelUploads value %d", sys.DockerRegistryMaxParallelUploads)
+		}
+		client.maxParallelUploads = sys.DockerRegistryMaxParallelUploads
+	}
+	client.minUploadChunkSize = defaultMinUploadChunkSize
+	if sys != nil {
+		client.resumableUploads = sys.DockerRegistryResumableUploads
+		if sys.DockerRegistryMinUploadChunkSize != 0 {
+			if sys.DockerRegistryMinUploadChunkSize < 0 {
+				return nil, fmt.Errorf("invalid DockerRegistryMinUploadChunkSize value %d", sys.DockerRegistryMinUploadChunkSize)
+			}
+			client.minUploadChunkSize = sys.DockerRegistryMinUploadChunkSize
+		}
+		if sys.DockerMaxUploadRetries < 0 {
+			return nil, fmt.Errorf("invalid DockerMaxUploadRetries value %d", sys.DockerMaxUploadRetries)
+		}
+		client.maxUploadRetries = sys.DockerMaxUploadRetries
+		if sys.DockerLowSpeedLimit < 0 {
+			return nil, fmt.Errorf("invalid DockerLowSpeedLimit value %d", sys.DockerLowSpeedLimit)
+		}
+		if sys.DockerLowSpeedTime < 0 {
+			return nil, fmt.Errorf("invalid DockerLowSpeedTime value %v", sys.DockerLowSpeedTime)
+		}
+		if sys.DockerLowSpeedLimit != 0 && sys.DockerLowSpeedTime != 0 {
+			client.lowSpeedLimit = sys.DockerLowSpeedLimit
+			client.lowSpeedTime = sys.DockerLowSpeedTime
+		}
+	}
 	client.scope.resourceType = "repository"
 	client.scope.actions = actions
 	client.scope.remoteName = reference.Path(ref.ref)
@@ -448,23 +513,14 @@ func SearchRegistry(ctx context.Context, sys *types.SystemContext, registry, ima
 			}
 		}
 
-		link := resp.Header.Get("Link")
-		if link == "" {
-			break
-		}
-		linkURLPart, _, _ := strings.Cut(link, ";")
-		linkURL, err := url.Parse(strings.Trim(linkURLPart, "<>"))
+		nextPath, err := nextPagePath(resp)
 		if err != nil {
 			return searchRes, err
 		}
-
-		// can be relative or absolute, but we only want the path (and I
-		// guess we're in trouble if it forwards to a new place...)
-		path = linkURL.Path
-		if linkURL.RawQuery != "" {
-			path += "?"
-			path += linkURL.RawQuery
+		if nextPath == "" {
+			break
 		}
+		path = nextPath
 	}
 	return searchRes, nil
 }
@@ -547,6 +603,81 @@ func parseRetryAfter(res *http.Response, fallbackDelay time.Duration) time.Durat
 	return fallbackDelay
 }
 
+// Header names used by various registries to report the rate-limit budget, in order of preference.
+var (
+	rateLimitLimitHeaders     = []string{"RateLimit-Limit", "X-RateLimit-Limit", "X-Rate-Limit-Limit"}
+	rateLimitRemainingHeaders = []string{"RateLimit-Remaining", "X-RateLimit-Remaining", "X-Rate-Limit-Remaining"}
+)
+
+// parseRateLimit returns the rate-limit budget reported in header, using -1 for values which are not reported,
+// and whether at least one value was reported. Invalid values are silently ignored.
+func parseRateLimit(header http.Header) (limit, remaining int64, ok bool) {
+	limit = parseRateLimitHeaders(header, rateLimitLimitHeaders)
+	remaining = parseRateLimitHeaders(header, rateLimitRemainingHeaders)
+	// Newer drafts of the IETF proposal use a single header, "RateLimit: limit=100, remaining=50, reset=30".
+	if combined := header.Get("RateLimit"); combined != "" && (limit == -1 || remaining == -1) {
+		for _, item := range strings.Split(combined, ",") {
+			key, value, found := strings.Cut(strings.TrimSpace(item), "=")
+			if !found {
+				continue
+			}
+			switch strings.ToLower(key) {
+			case "limit":
+				if limit == -1 {
+					limit = parseRateLimitValue(value)
+				}
+			case "remaining":
+				if remaining == -1 {
+					remaining = parseRateLimitValue(value)
+				}
+			}
+		}
+	}
+	return limit, remaining, limit != -1 || remaining != -1
+}
+
+// parseRateLimitHeaders returns the first valid value of headerNames in header, or -1 if there is none.
+func parseRateLimitHeaders(header http.Header, headerNames []string) int64 {
+	for _, name := range headerNames {
+		if value := header.Get(name); value != "" {
+			if n := parseRateLimitValue(value); n != -1 {
+				return n
+			}
+			logrus.Debugf("Ignoring invalid %s header %q", name, value)
+		}
+	}
+	return -1
+}
+
+// parseRateLimitValue parses a single rate-limit value, e.g. "100", or "100;w=21600" as used by Docker Hub, returning -1 if it is invalid.
+// If there are several comma-separated quota policies, only the first one is used.
+func parseRateLimitValue(value string) int64 {
+	value, _, _ = strings.Cut(value, ",")
+	value, _, _ = strings.Cut(value, ";")
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// reportRateLimit calls c.sys.DockerRateLimitCallback, if any, if res reports a rate-limit budget.
+func (c *dockerClient) reportRateLimit(res *http.Response) {
+	if c.sys == nil || c.sys.DockerRateLimitCallback == nil {
+		return
+	}
+	limit, remaining, ok := parseRateLimit(res.Header)
+	if !ok {
+		return
+	}
+	logrus.Debugf("Registry %s reports a rate limit of %d, %d remaining", c.registry, limit, remaining)
+	c.sys.DockerRateLimitCallback(types.DockerRateLimit{
+		Registry:  c.registry,
+		Limit:     limit,
+		Remaining: remaining,
+	})
+}
+
 // makeRequestToResolvedURL creates and executes a http.Request with the specified parameters, adding authentication and TLS options for the Docker client.
 // streamLen, if not -1, specifies the length of the data expected on stream.
 // makeRequest should generally be preferred.
@@ -633,6 +764,8 @@ func (c *dockerClient) makeRequestToResolvedURLOnce(ctx context.Context, method
 	if err != nil {
 		return nil, err
 	}
+	c.reportRateLimit(res)
+	res.Body = newWatchedBody(ctx, res.Body, c.lowSpeedLimit, c.lowSpeedTime)
 	return res, nil
 }
 
@@ -648,12 +781,25 @@ func (c *dockerClient) setupRequestAuth(req *http.Request, extraScope *authScope
 		return nil
 	}
 	schemeNames := make([]string, 0, len(c.challenges))
+	var negotiateErr error // = nil
 	for _, challenge := range c.challenges {
 		schemeNames = append(schemeNames, challenge.Scheme)
 		switch challenge.Scheme {
 		case "basic":
 			req.SetBasicAuth(c.auth.Username, c.auth.Password)
 			return nil
+		case "negotiate":
+			if setNegotiateAuth == nil {
+				logrus.Debugf("no handler for %s authentication, it requires the containers_image_spnego build tag", challenge.Scheme)
+				continue
+			}
+			// Users without a Kerberos ticket might be able to use another scheme offered by the server; try that before failing.
+			if err := setNegotiateAuth(req); err != nil {
+				logrus.Debugf("Negotiate authentication failed: %v", err)
+				negotiateErr = fmt.Errorf("setting up Negotiate authentication: %w", err)
+				continue
+			}
+			return nil
 		case "bearer":
 			registryToken := c.registryToken
 			if registryToken == "" {
@@ -674,8 +820,14 @@ func (c *dockerClient) setupRequestAuth(req *http.Request, extraScope *authScope
 					}
 					scopes = append(scopes, *extraScope)
 				}
+				tokenCache := &c.tokenCache
+				if c.shared != nil {
+					// The shared cache is used by clients with different scopes.
+					tokenCache = &c.shared.tokenCache
+					cacheKey = fmt.Sprintf("%s:%s:%s;%s", c.scope.resourceType, c.scope.remoteName, c.scope.actions, cacheKey)
+				}
 				var token bearerToken
-				t, inCache := c.tokenCache.Load(cacheKey)
+				t, inCache := tokenCache.Load(cacheKey)
 				if inCache {
 					token = t.(bearerToken)
 				}
@@ -694,7 +846,7 @@ func (c *dockerClient) setupRequestAuth(req *http.Request, extraScope *authScope
 					}
 
 					token = *t
-					c.tokenCache.Store(cacheKey, token)
+					tokenCache.Store(cacheKey, token)
 				}
 				registryToken = token.Token
 			}
@@ -704,6 +856,9 @@ func (c *dockerClient) setupRequestAuth(req *http.Request, extraScope *authScope
 			logrus.Debugf("no handler for %s authentication", challenge.Scheme)
 		}
 	}
+	if negotiateErr != nil {
+		return negotiateErr
+	}
 	logrus.Infof("None of the challenges sent by server (%s) are supported, trying an unauthenticated request anyway", strings.Join(schemeNames, ", "))
 	return nil
 }
@@ -818,7 +973,7 @@ func (c *dockerClient) detectPropertiesHelper(ctx context.Context) error {
 	}
 	tr := tlsclientconfig.NewTransport()
 	tr.TLSClientConfig = c.tlsClientConfig
-	c.client = &http.Client{Transport: tr}
+	c.client = &http.Client{Transport: tr, CheckRedirect: checkRedirect}
 
 	ping := func(scheme string) error {
 		pingURL, err := url.Parse(fmt.Sprintf(resolvedPingV2URL, scheme, c.registry))
@@ -881,7 +1036,13 @@ func (c *dockerClient) detectPropertiesHelper(ctx context.Context) error {
 // detectProperties detects various properties of the registry.
 // See the dockerClient documentation for members which are affected by this.
 func (c *dockerClient) detectProperties(ctx context.Context) error {
-	c.detectPropertiesOnce.Do(func() { c.detectPropertiesError = c.detectPropertiesHelper(ctx) })
+	c.detectPropertiesOnce.Do(func() {
+		if c.shared != nil {
+			c.detectPropertiesError = c.detectSharedProperties(ctx)
+		} else {
+			c.detectPropertiesError = c.detectPropertiesHelper(ctx)
+		}
+	})
 	return c.detectPropertiesError
 }
 
@@ -907,6 +1068,24 @@ func (c *dockerClient) fetchManifest(ctx context.Context, ref dockerReference, t
 	return manblob, simplifyContentType(res.Header.Get("Content-Type")), nil
 }
 
+// fetchManifestDigest returns the digest of the manifest tagOrDigest in ref, as reported by the registry in response to a HEAD request.
+func (c *dockerClient) fetchManifestDigest(ctx context.Context, ref dockerReference, tagOrDigest string) (digest.Digest, error) {
+	path := fmt.Sprintf(manifestPath, reference.Path(ref.ref), tagOrDigest)
+	headers := map[string][]string{
+		"Accept": manifest.DefaultRequestedManifestMIMETypes,
+	}
+	res, err := c.makeRequest(ctx, http.MethodHead, path, headers, nil, v2Auth, nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reading digest %s in %s: %w", tagOrDigest, ref.ref.Name(), registryHTTPResponseToError(res))
+	}
+
+	return digest.Parse(res.Header.Get("Docker-Content-Digest"))
+}
+
 // getExternalBlob returns the reader of the first available blob URL from urls, which must not be empty.
 // This function can return nil reader when no url is supported by this function. In this case, the caller
 // should fallback to fetch the non-external blob (i.e. pull from the registry).
@@ -1025,11 +1204,10 @@ func isManifestUnknownError(err error) bool {
 	return false
 }
 
-// getSigstoreAttachmentManifest loads and parses the manifest for sigstore attachments for
-// digest in ref.
+// getSigstoreAttachmentManifest loads and parses the manifest for sigstore attachments
+// (as tagged by sigstoreAttachmentTag or sigstoreAttestationTag) in tag in ref.
 // It returns (nil, nil) if the manifest does not exist.
-func (c *dockerClient) getSigstoreAttachmentManifest(ctx context.Context, ref dockerReference, digest digest.Digest) (*manifest.OCI1, error) {
-	tag := sigstoreAttachmentTag(digest)
+func (c *dockerClient) getSigstoreAttachmentManifest(ctx context.Context, ref dockerReference, tag string) (*manifest.OCI1, error) {
 	sigstoreRef, err := reference.WithTag(reference.TrimNamed(ref.ref), tag)
 	if err != nil {
 		return nil, err
@@ -1059,6 +1237,165 @@ func (c *dockerClient) getSigstoreAttachmentManifest(ctx context.Context, ref do
 	return res, nil
 }
 
+// getReferrers returns descriptors of the manifests in ref which refer to manifestDigest, and have artifactType
+// (or any artifact type, if artifactType is ""), using the OCI referrers API.
+// It returns (nil, false, nil) if the registry does not support the referrers API.
+// If the registry paginates the list, all pages are fetched; it fails if there are more than c.maxReferrers referrers.
+func (c *dockerClient) getReferrers(ctx context.Context, ref dockerReference, manifestDigest digest.Digest, artifactType string) ([]imgspecv1.Descriptor, bool, error) {
+	path := fmt.Sprintf(referrersPath, reference.Path(ref.ref), manifestDigest.String())
+	if artifactType != "" {
+		path += "?" + url.Values{"artifactType": {artifactType}}.Encode()
+	}
+	referrers := []imgspecv1.Descriptor{}
+	fetched := 0
+	for page := 1; ; page++ {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		pageReferrers, supported, nextPath, err := c.getReferrersPage(ctx, ref, manifestDigest, artifactType, path)
+		if err != nil {
+			return nil, false, err
+		}
+		if !supported {
+			if page == 1 {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("listing referrers of %s in %s: page %d not found", manifestDigest, ref.ref.Name(), page)
+		}
+		fetched += pageReferrers.fetched
+		if fetched > c.maxReferrers {
+			return nil, false, fmt.Errorf("listing referrers of %s in %s: more than the maximum of %d referrers", manifestDigest, ref.ref.Name(), c.maxReferrers)
+		}
+		referrers = append(referrers, pageReferrers.matching...)
+		if nextPath == "" {
+			break
+		}
+		logrus.Debugf("Fetching page %d of referrers of %s", page+1, manifestDigest)
+		path = nextPath
+	}
+	return referrers, true, nil
+}
+
+// getSigstoreReferrerManifests loads and parses the manifests of sigstore signatures in ref which refer to manifestDigest,
+// found using the OCI referrers API.
+// It returns (nil, false, nil) if the registry does not support the referrers API.
+func (c *dockerClient) getSigstoreReferrerManifests(ctx context.Context, ref dockerReference, manifestDigest digest.Digest) ([]*manifest.OCI1, bool, error) {
+	referrers, supported, err := c.getReferrers(ctx, ref, manifestDigest, sigstoreSignatureArtifactType)
+	if err != nil {
+		return nil, false, err
+	}
+	if !supported {
+		return nil, false, nil
+	}
+
+	logrus.Debugf("Found %d sigstore signature referrers", len(referrers))
+	res := []*manifest.OCI1{}
+	for _, referrer := range referrers {
+		manifestBlob, mimeType, err := c.fetchManifest(ctx, ref, referrer.Digest.String())
+		if err != nil {
+			return nil, false, err
+		}
+		matches, err := manifest.MatchesDigest(manifestBlob, referrer.Digest)
+		if err != nil {
+			return nil, false, fmt.Errorf("computing digest of sigstore signature manifest %s: %w", referrer.Digest.String(), err)
+		}
+		if !matches {
+			return nil, false, fmt.Errorf("sigstore signature manifest does not match digest %s", referrer.Digest.String())
+		}
+		if mimeType != imgspecv1.MediaTypeImageManifest {
+			return nil, false, fmt.Errorf("unexpected MIME type for sigstore signature manifest %s: %q", referrer.Digest.String(), mimeType)
+		}
+		ociManifest, err := manifest.OCI1FromManifest(manifestBlob)
+		if err != nil {
+			return nil, false, fmt.Errorf("parsing sigstore signature manifest %s: %w", referrer.Digest.String(), err)
+		}
+		res = append(res, ociManifest)
+	}
+	return res, true, nil
+}
+
+// referrersPage is a single page of results from the referrers API.
+type referrersPage struct {
+	matching []imgspecv1.Descriptor // Referrers which have the requested artifact type
+	fetched  int                    // The number of all referrers on the page, whether they match or not
+}
+
+// getReferrersPage returns the referrers on a single page at path, as a part of getReferrers, and the path of the next page, or "".
+// It returns (…, false, …) if the page was not found, i.e. if on the first page the registry does not support the referrers API.
+func (c *dockerClient) getReferrersPage(ctx context.Context, ref dockerReference, manifestDigest digest.Digest, artifactType, path string) (referrersPage, bool, string, error) {
+	headers := map[string][]string{
+		"Accept": {imgspecv1.MediaTypeImageIndex},
+	}
+	res, err := c.makeRequest(ctx, http.MethodGet, path, headers, nil, v2Auth, nil)
+	if err != nil {
+		return referrersPage{}, false, "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		// The distribution specification forbids registries which support the referrers API from returning 404.
+		logrus.Debugf("Listing referrers of %s returned status 404, assuming the referrers API is not supported", manifestDigest)
+		return referrersPage{}, false, "", nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return referrersPage{}, false, "", fmt.Errorf("listing referrers of %s in %s: %w", manifestDigest, ref.ref.Name(), registryHTTPResponseToError(res))
+	}
+
+	body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxManifestBodySize)
+	if err != nil {
+		return referrersPage{}, false, "", err
+	}
+	var index imgspecv1.Index
+	if err := json.Unmarshal(body, &index); err != nil {
+		return referrersPage{}, false, "", fmt.Errorf("decoding referrers of %s: %w", manifestDigest, err)
+	}
+	nextPath, err := nextPagePath(res)
+	if err != nil {
+		return referrersPage{}, false, "", fmt.Errorf("listing referrers of %s in %s: %w", manifestDigest, ref.ref.Name(), err)
+	}
+	page := referrersPage{fetched: len(index.Manifests)}
+	if artifactType == "" {
+		page.matching = index.Manifests
+		return page, true, nextPath, nil
+	}
+	// Registries are not required to support filtering; if the filter was not applied, do it ourselves.
+	for _, filter := range strings.Split(res.Header.Get("OCI-Filters-Applied"), ",") {
+		if strings.TrimSpace(filter) == "artifactType" {
+			page.matching = index.Manifests
+			return page, true, nextPath, nil
+		}
+	}
+	page.matching = []imgspecv1.Descriptor{}
+	for _, desc := range index.Manifests {
+		if desc.ArtifactType == artifactType {
+			page.matching = append(page.matching, desc)
+		}
+	}
+	return page, true, nextPath, nil
+}
+
+// nextPagePath returns the path of the next page of a paginated response res, as specified by its Link header,
+// in the form accepted by makeRequest, or "" if there is no next page.
+func nextPagePath(res *http.Response) (string, error) {
+	link := res.Header.Get("Link")
+	if link == "" {
+		return "", nil
+	}
+	linkURLPart, _, _ := strings.Cut(link, ";")
+	linkURL, err := url.Parse(strings.Trim(linkURLPart, "<>"))
+	if err != nil {
+		return "", err
+	}
+
+	// can be relative or absolute, but we only want the path (and I
+	// guess we're in trouble if it forwards to a new place...)
+	path := linkURL.Path
+	if linkURL.RawQuery != "" {
+		path += "?"
+		path += linkURL.RawQuery
+	}
+	return path, nil
+}
+
 // getExtensionsSignatures returns signatures from the X-Registry-Supports-Signatures API extension,
 // using the original data structures.
 func (c *dockerClient) getExtensionsSignatures(ctx context.Context, ref dockerReference, manifestDigest digest.Digest) (*extensionSignatureList, error) {
@@ -1084,14 +1421,45 @@ func (c *dockerClient) getExtensionsSignatures(ctx context.Context, ref dockerRe
 	return &parsedBody, nil
 }
 
+// sigstoreSignatureArtifactType is the artifact type of manifests of sigstore signatures, as found using the referrers API.
+const sigstoreSignatureArtifactType = "application/vnd.dev.cosign.artifact.sig.v1+json"
+
 // sigstoreAttachmentTag returns a sigstore attachment tag for the specified digest.
 func sigstoreAttachmentTag(d digest.Digest) string {
 	return strings.Replace(d.String(), ":", "-", 1) + ".sig"
 }
 
+// validateSignatureAttachmentTagFormat returns an error if format is not a valid SystemContext.DockerSignatureAttachmentTagFormat
+// for ref.
+func validateSignatureAttachmentTagFormat(ref dockerReference, format string) error {
+	if strings.Count(format, "%") != 1 || strings.Count(format, "%s") != 1 {
+		return fmt.Errorf("invalid signature attachment tag format %q: must contain exactly one %%s, and no other %% characters", format)
+	}
+	sample := fmt.Sprintf(format, digest.Canonical.FromString("").Encoded())
+	if _, err := reference.WithTag(reference.TrimNamed(ref.ref), sample); err != nil {
+		return fmt.Errorf("invalid signature attachment tag format %q: %w", format, err)
+	}
+	return nil
+}
+
+// signatureAttachmentTag returns the tag of sigstore signature attachments for the specified digest,
+// honoring c.signatureAttachmentTagFormat.
+func (c *dockerClient) signatureAttachmentTag(d digest.Digest) string {
+	if c.signatureAttachmentTagFormat == "" {
+		return sigstoreAttachmentTag(d)
+	}
+	return fmt.Sprintf(c.signatureAttachmentTagFormat, d.Encoded())
+}
+
+// sigstoreAttestationTag returns a sigstore attestation tag for the specified digest.
+func sigstoreAttestationTag(d digest.Digest) string {
+	return strings.Replace(d.String(), ":", "-", 1) + ".att"
+}
+
 // Close removes resources associated with an initialized dockerClient, if any.
 func (c *dockerClient) Close() error {
-	if c.client != nil {
+	// A shared client is closed when the session is closed.
+	if c.client != nil && c.shared == nil {
 		c.client.CloseIdleConnections()
 	}
 	return nil
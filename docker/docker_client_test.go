@@ -15,6 +15,7 @@ import (
 
 	"github.com/containers/image/v5/internal/useragent"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -192,6 +193,119 @@ func TestUserAgent(t *testing.T) {
 	}
 }
 
+func TestNegotiateAuth(t *testing.T) {
+	const token = "dG9rZW4="
+	var receivedAuthorization string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedAuthorization = r.Header.Get("Authorization")
+		if receivedAuthorization != "Negotiate "+token {
+			w.Header().Add("WWW-Authenticate", "Negotiate")
+			w.Header().Add("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+	sys := &types.SystemContext{
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue, // For this test against localhost, we don't care.
+	}
+
+	savedSetNegotiateAuth := setNegotiateAuth
+	defer func() { setNegotiateAuth = savedSetNegotiateAuth }()
+
+	// Success
+	var requestedHost string
+	setNegotiateAuth = func(req *http.Request) error {
+		requestedHost = req.URL.Hostname()
+		req.Header.Set("Authorization", "Negotiate "+token)
+		return nil
+	}
+	err := CheckAuth(context.Background(), sys, "", "", registry)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", requestedHost)
+
+	// Negotiate fails, another scheme offered by the server is used instead
+	negotiateErr := errors.New("no Kerberos ticket")
+	setNegotiateAuth = func(req *http.Request) error {
+		return negotiateErr
+	}
+	err = CheckAuth(context.Background(), sys, "user", "password", registry)
+	assert.ErrorAs(t, err, &ErrUnauthorizedForCredentials{})
+	assert.True(t, strings.HasPrefix(receivedAuthorization, "Basic "), receivedAuthorization)
+
+	// Negotiate fails, and there is no other scheme
+	onlyNegotiate := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("WWW-Authenticate", "Negotiate")
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer onlyNegotiate.Close()
+	err = CheckAuth(context.Background(), sys, "", "", strings.TrimPrefix(onlyNegotiate.URL, "http://"))
+	assert.ErrorIs(t, err, negotiateErr)
+
+	// Negotiate is not supported
+	setNegotiateAuth = nil
+	err = CheckAuth(context.Background(), sys, "", "", registry)
+	assert.ErrorAs(t, err, &ErrUnauthorizedForCredentials{})
+}
+
+func TestParseRateLimit(t *testing.T) {
+	for _, c := range []struct {
+		headers           map[string]string
+		limit, remaining  int64
+		expectedReporting bool
+	}{
+		{map[string]string{}, -1, -1, false},
+		{map[string]string{"RateLimit-Limit": "100", "RateLimit-Remaining": "76"}, 100, 76, true},
+		{map[string]string{"ratelimit-limit": "100;w=21600", "ratelimit-remaining": "76;w=21600"}, 100, 76, true}, // Docker Hub
+		{map[string]string{"X-RateLimit-Limit": "5000", "X-RateLimit-Remaining": "4999"}, 5000, 4999, true},       // GitHub
+		{map[string]string{"X-Rate-Limit-Limit": "10", "X-Rate-Limit-Remaining": "0"}, 10, 0, true},
+		{map[string]string{"RateLimit": "limit=100, remaining=50, reset=30"}, 100, 50, true},
+		{map[string]string{"RateLimit-Limit": "100, 100;w=60, 1000;w=3600"}, 100, -1, true},
+		{map[string]string{"RateLimit-Remaining": "7"}, -1, 7, true},
+		// The first valid spelling wins
+		{map[string]string{"RateLimit-Limit": "100", "X-RateLimit-Limit": "200"}, 100, -1, true},
+		{map[string]string{"RateLimit-Limit": "invalid", "X-RateLimit-Limit": "200"}, 200, -1, true},
+		// Invalid values
+		{map[string]string{"RateLimit-Limit": "invalid", "RateLimit-Remaining": "-1"}, -1, -1, false},
+		{map[string]string{"RateLimit": "limit, remaining=invalid"}, -1, -1, false},
+	} {
+		header := http.Header{}
+		for k, v := range c.headers {
+			header.Set(k, v)
+		}
+		limit, remaining, ok := parseRateLimit(header)
+		assert.Equal(t, c.limit, limit, c.headers)
+		assert.Equal(t, c.remaining, remaining, c.headers)
+		assert.Equal(t, c.expectedReporting, ok, c.headers)
+	}
+}
+
+func TestDockerRateLimitCallback(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", "76;w=21600")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+
+	var reported []types.DockerRateLimit
+	sys := &types.SystemContext{
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue, // For this test against localhost, we don't care.
+		DockerRateLimitCallback: func(rl types.DockerRateLimit) {
+			reported = append(reported, rl)
+		},
+	}
+	err := CheckAuth(context.Background(), sys, "", "", registry)
+	require.NoError(t, err)
+	require.NotEmpty(t, reported)
+	for _, rl := range reported {
+		assert.Equal(t, types.DockerRateLimit{Registry: registry, Limit: 100, Remaining: 76}, rl)
+	}
+}
+
 func TestNeedsRetryOnError(t *testing.T) {
 	needsRetry, _ := needsRetryWithUpdatedScope(errors.New("generic"), nil)
 	if needsRetry {
@@ -388,3 +502,40 @@ func TestIsManifestUnknownError(t *testing.T) {
 		assert.True(t, res, "%#v", err, c.name)
 	}
 }
+
+func TestValidateSignatureAttachmentTagFormat(t *testing.T) {
+	ref, err := ParseReference("//registry.example.com/ns/repo:tag")
+	require.NoError(t, err)
+	dockerRef, ok := ref.(dockerReference)
+	require.True(t, ok)
+
+	for _, c := range []string{
+		"sha256-%s.sig",
+		"%s",
+		"signature_%s",
+	} {
+		err := validateSignatureAttachmentTagFormat(dockerRef, c)
+		assert.NoError(t, err, c)
+	}
+	for _, c := range []string{
+		"",                              // No verb
+		"sha256-abcd.sig",               // No verb
+		"sha256-%d.sig",                 // Wrong verb
+		"sha256-%s-%s.sig",              // Two verbs
+		"sha256-%s%%.sig",               // An escaped %, which is not valid in a tag anyway
+		"sha256:%s.sig",                 // Not a valid tag
+		".%s",                           // Not a valid tag
+		strings.Repeat("x", 128) + "%s", // Too long to be a tag
+	} {
+		err := validateSignatureAttachmentTagFormat(dockerRef, c)
+		assert.Error(t, err, c)
+	}
+}
+
+func TestSignatureAttachmentTag(t *testing.T) {
+	d := digest.Digest("sha256:634a8f35b5f16dcf4aaa0822adc0b1964bb786fca12f6831de8ddc45e5986a00")
+	c := &dockerClient{}
+	assert.Equal(t, "sha256-634a8f35b5f16dcf4aaa0822adc0b1964bb786fca12f6831de8ddc45e5986a00.sig", c.signatureAttachmentTag(d))
+	c.signatureAttachmentTagFormat = "signature-%s"
+	assert.Equal(t, "signature-634a8f35b5f16dcf4aaa0822adc0b1964bb786fca12f6831de8ddc45e5986a00", c.signatureAttachmentTag(d))
+}
@@ -6,12 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
-	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/image"
-	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
 )
@@ -90,24 +87,14 @@ func GetRepositoryTags(ctx context.Context, sys *types.SystemContext, ref types.
 		}
 		tags = append(tags, tagsHolder.Tags...)
 
-		link := res.Header.Get("Link")
-		if link == "" {
-			break
-		}
-
-		linkURLPart, _, _ := strings.Cut(link, ";")
-		linkURL, err := url.Parse(strings.Trim(linkURLPart, "<>"))
+		nextPath, err := nextPagePath(res)
 		if err != nil {
 			return tags, err
 		}
-
-		// can be relative or absolute, but we only want the path (and I
-		// guess we're in trouble if it forwards to a new place...)
-		path = linkURL.Path
-		if linkURL.RawQuery != "" {
-			path += "?"
-			path += linkURL.RawQuery
+		if nextPath == "" {
+			break
 		}
+		path = nextPath
 	}
 	return tags, nil
 }
@@ -139,25 +126,5 @@ func GetDigest(ctx context.Context, sys *types.SystemContext, ref types.ImageRef
 	}
 	defer client.Close()
 
-	path := fmt.Sprintf(manifestPath, reference.Path(dr.ref), tagOrDigest)
-	headers := map[string][]string{
-		"Accept": manifest.DefaultRequestedManifestMIMETypes,
-	}
-
-	res, err := client.makeRequest(ctx, http.MethodHead, path, headers, nil, v2Auth, nil)
-	if err != nil {
-		return "", err
-	}
-
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("reading digest %s in %s: %w", tagOrDigest, dr.ref.Name(), registryHTTPResponseToError(res))
-	}
-
-	dig, err := digest.Parse(res.Header.Get("Docker-Content-Digest"))
-	if err != nil {
-		return "", err
-	}
-
-	return dig, nil
+	return client.fetchManifestDigest(ctx, dr, tagOrDigest)
 }
@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
@@ -45,11 +46,20 @@ type dockerImageDestination struct {
 	ref dockerReference
 	c   *dockerClient
 	// State
-	manifestDigest digest.Digest // or "" if not yet known.
+	manifestDigest   digest.Digest                                       // or "" if not yet known.
+	writtenManifests map[digest.Digest]imgspecv1.Descriptor              // Manifests written by PutManifest, by digest
+	signatureStorage map[signature.FormatID]types.SignatureStorageMethod // Set by UseSignatureStorageMethods
+}
+
+// signatureStorageMethods are the signature storage methods which can store each signature format.
+var signatureStorageMethods = map[signature.FormatID][]types.SignatureStorageMethod{
+	signature.SimpleSigningFormat: {types.SignatureStorageAPIExtension, types.SignatureStorageLookaside},
+	signature.SigstoreFormat:      {types.SignatureStorageReferrers, types.SignatureStorageSigstoreAttachments},
 }
 
 // newImageDestination creates a new ImageDestination for the specified image reference.
-func newImageDestination(sys *types.SystemContext, ref dockerReference) (private.ImageDestination, error) {
+// If ctx is associated with a session.Session, the registry state is shared with other sources and destinations in the session.
+func newImageDestination(ctx context.Context, sys *types.SystemContext, ref dockerReference) (private.ImageDestination, error) {
 	registryConfig, err := loadRegistryConfiguration(sys)
 	if err != nil {
 		return nil, err
@@ -58,6 +68,7 @@ func newImageDestination(sys *types.SystemContext, ref dockerReference) (private
 	if err != nil {
 		return nil, err
 	}
+	c.useSession(ctx)
 	mimeTypes := []string{
 		imgspecv1.MediaTypeImageManifest,
 		manifest.DockerV2Schema2MediaType,
@@ -78,8 +89,9 @@ func newImageDestination(sys *types.SystemContext, ref dockerReference) (private
 		}),
 		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
 
-		ref: ref,
-		c:   c,
+		ref:              ref,
+		c:                c,
+		writtenManifests: map[digest.Digest]imgspecv1.Descriptor{},
 	}
 	dest.Compat = impl.AddCompat(dest)
 	return dest, nil
@@ -112,6 +124,97 @@ func (d *dockerImageDestination) SupportsSignatures(ctx context.Context) error {
 	}
 }
 
+// SupportedSignatureStorageMethods returns the signature storage methods usable with this destination, for each signature format
+// the destination can store, most preferred first.
+// It may contact a remote (= slow) service.
+func (d *dockerImageDestination) SupportedSignatureStorageMethods(ctx context.Context) (map[signature.FormatID][]types.SignatureStorageMethod, error) {
+	if err := d.c.detectProperties(ctx); err != nil {
+		return nil, err
+	}
+	res := map[signature.FormatID][]types.SignatureStorageMethod{}
+
+	if d.c.useSigstoreAttachments {
+		// Registries which support the referrers API must not return 404 for any manifest digest,
+		// so it does not matter that referrersProbeDigest does not exist.
+		_, referrersSupported, err := d.c.getReferrers(ctx, d.ref, referrersProbeDigest, sigstoreSignatureArtifactType)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case referrersSupported && d.c.useReferrersAPI:
+			res[signature.SigstoreFormat] = []types.SignatureStorageMethod{types.SignatureStorageReferrers, types.SignatureStorageSigstoreAttachments}
+		case referrersSupported:
+			res[signature.SigstoreFormat] = []types.SignatureStorageMethod{types.SignatureStorageSigstoreAttachments, types.SignatureStorageReferrers}
+		default:
+			res[signature.SigstoreFormat] = []types.SignatureStorageMethod{types.SignatureStorageSigstoreAttachments}
+		}
+	}
+
+	simpleSigning := []types.SignatureStorageMethod{}
+	if d.c.supportsSignatures {
+		simpleSigning = append(simpleSigning, types.SignatureStorageAPIExtension)
+	}
+	// putOneSignature can only write to a local lookaside; an http(s) lookaside without lookaside-staging is read-only.
+	if d.c.signatureBase != nil && (*url.URL)(d.c.signatureBase).Scheme == "file" {
+		simpleSigning = append(simpleSigning, types.SignatureStorageLookaside)
+	}
+	if len(simpleSigning) != 0 {
+		res[signature.SimpleSigningFormat] = simpleSigning
+	}
+	return res, nil
+}
+
+// referrersProbeDigest is a digest used to detect whether a registry supports the referrers API.
+var referrersProbeDigest = digest.FromBytes([]byte{})
+
+// UseSignatureStorageMethods instructs PutSignaturesWithFormat to store signatures of each format in methods
+// using the corresponding method, which must be one of the values returned by SupportedSignatureStorageMethods.
+// Formats not present in methods are stored using the default method of the destination.
+func (d *dockerImageDestination) UseSignatureStorageMethods(methods map[signature.FormatID]types.SignatureStorageMethod) error {
+	for format, method := range methods {
+		if !slices.Contains(signatureStorageMethods[format], method) {
+			return fmt.Errorf("signature storage method %q can not store %s signatures", method, format)
+		}
+	}
+	d.signatureStorage = maps.Clone(methods)
+	return nil
+}
+
+// Preflight performs cheap checks, and returns an error (to be displayed to the user) if using the destination would certainly fail.
+// It initiates, and immediately cancels, a blob upload; that fails if the credentials don’t allow pushing to the repository,
+// or if the repository does not exist and the registry does not create repositories on push.
+func (d *dockerImageDestination) Preflight(ctx context.Context) error {
+	uploadPath := fmt.Sprintf(blobUploadPath, reference.Path(d.ref.ref))
+	logrus.Debugf("Checking whether an upload to %s can be initiated", uploadPath)
+	res, err := d.c.makeRequest(ctx, http.MethodPost, uploadPath, nil, nil, v2Auth, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		logrus.Debugf("Error initiating a test upload, response %#v", *res)
+		return fmt.Errorf("initiating a test upload to %s in %s: %w", uploadPath, d.c.registry, registryHTTPResponseToError(res))
+	}
+
+	// Failing to cancel the upload is not a reason to fail the copy; the registry eventually removes abandoned uploads.
+	// (docker/distribution servers incorrectly require the "delete" action in the token's scope for this to work.)
+	uploadLocation, err := res.Location()
+	if err != nil {
+		logrus.Debugf("Error determining the test upload URL: %v", err)
+		return nil
+	}
+	res2, err := d.c.makeRequestToResolvedURL(ctx, http.MethodDelete, uploadLocation, nil, nil, -1, v2Auth, nil)
+	if err != nil {
+		logrus.Debugf("Error canceling the test upload: %v", err)
+		return nil
+	}
+	defer res2.Body.Close()
+	if !successStatus(res2.StatusCode) {
+		logrus.Debugf("Error canceling the test upload: %v", registryHTTPResponseToError(res2))
+	}
+	return nil
+}
+
 // AcceptsForeignLayerURLs returns false iff foreign layers in manifest should be actually
 // uploaded to the image destination, true otherwise.
 func (d *dockerImageDestination) AcceptsForeignLayerURLs() bool {
@@ -159,47 +262,40 @@ func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream
 		}
 	}
 
-	// FIXME? Chunked upload, progress reporting, etc.
-	uploadPath := fmt.Sprintf(blobUploadPath, reference.Path(d.ref.ref))
-	logrus.Debugf("Uploading %s", uploadPath)
-	res, err := d.c.makeRequest(ctx, http.MethodPost, uploadPath, nil, nil, v2Auth, nil)
-	if err != nil {
-		return private.UploadedBlob{}, err
+	if d.c.maxParallelUploads != 0 {
+		sem := uploadSemaphore(d.c.registry, d.c.maxParallelUploads)
+		if err := sem.Acquire(ctx, 1); err != nil {
+			return private.UploadedBlob{}, fmt.Errorf("waiting for a parallel upload slot: %w", err)
+		}
+		defer sem.Release(1)
 	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusAccepted {
-		logrus.Debugf("Error initiating layer upload, response %#v", *res)
-		return private.UploadedBlob{}, fmt.Errorf("initiating layer upload to %s in %s: %w", uploadPath, d.c.registry, registryHTTPResponseToError(res))
+
+	if d.c.resumableUploads {
+		return d.putBlobInChunks(ctx, stream, inputInfo, options)
 	}
-	uploadLocation, err := res.Location()
+
+	// FIXME? Progress reporting, etc.
+	uploadLocation, _, err := d.startUpload(ctx)
 	if err != nil {
-		return private.UploadedBlob{}, fmt.Errorf("determining upload URL: %w", err)
+		return private.UploadedBlob{}, err
 	}
 
+	originalStream := stream
 	digester, stream := putblobdigest.DigestIfCanonicalUnknown(stream, inputInfo)
 	sizeCounter := &sizeCounter{}
 	stream = io.TeeReader(stream, sizeCounter)
 
-	uploadLocation, err = func() (*url.URL, error) { // A scope for defer
-		uploadReader := uploadreader.NewUploadReader(stream)
-		// This error text should never be user-visible, we terminate only after makeRequestToResolvedURL
-		// returns, so there isn’t a way for the error text to be provided to any of our callers.
-		defer uploadReader.Terminate(errors.New("Reading data from an already terminated upload"))
-		res, err = d.c.makeRequestToResolvedURL(ctx, http.MethodPatch, uploadLocation, map[string][]string{"Content-Type": {"application/octet-stream"}}, uploadReader, inputInfo.Size, v2Auth, nil)
+	if d.c.maxUploadRetries != 0 {
+		var replayable *replayableStream
+		replayable, err = newReplayableStream(d.c.sys, originalStream, stream)
 		if err != nil {
-			logrus.Debugf("Error uploading layer chunked %v", err)
-			return nil, err
-		}
-		defer res.Body.Close()
-		if !successStatus(res.StatusCode) {
-			return nil, fmt.Errorf("uploading layer chunked: %w", registryHTTPResponseToError(res))
-		}
-		uploadLocation, err := res.Location()
-		if err != nil {
-			return nil, fmt.Errorf("determining upload URL: %w", err)
+			return private.UploadedBlob{}, err
 		}
-		return uploadLocation, nil
-	}()
+		defer replayable.close()
+		uploadLocation, err = d.uploadStreamWithRetries(ctx, uploadLocation, replayable, inputInfo.Size)
+	} else {
+		uploadLocation, err = d.uploadStream(ctx, uploadLocation, stream, 0, inputInfo.Size)
+	}
 	if err != nil {
 		return private.UploadedBlob{}, err
 	}
@@ -207,22 +303,89 @@ func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream
 
 	// FIXME: DELETE uploadLocation on failure (does not really work in docker/distribution servers, which incorrectly require the "delete" action in the token's scope)
 
+	if err := d.finishUpload(ctx, uploadLocation, blobDigest); err != nil {
+		return private.UploadedBlob{}, err
+	}
+	options.Cache.RecordKnownLocation(d.ref.Transport(), bicTransportScope(d.ref), blobDigest, newBICLocationReference(d.ref))
+	return private.UploadedBlob{Digest: blobDigest, Size: sizeCounter.size}, nil
+}
+
+// uploadStream uploads stream, the data of a blob of size (-1 if unknown) starting at offset, to the blob upload at uploadLocation
+// in a single request, and returns the upload URL to use for the next request.
+// If the request fails without a response from the registry, the error is returned unwrapped.
+func (d *dockerImageDestination) uploadStream(ctx context.Context, uploadLocation *url.URL, stream io.Reader, offset, size int64) (*url.URL, error) {
+	headers := map[string][]string{"Content-Type": {"application/octet-stream"}}
+	streamLen := int64(-1)
+	if size != -1 {
+		streamLen = size - offset
+		if offset != 0 && offset < size {
+			headers["Content-Range"] = []string{fmt.Sprintf("%d-%d", offset, size-1)}
+		}
+	}
+	uploadReader := uploadreader.NewUploadReader(stream)
+	// This error text should never be user-visible, we terminate only after makeRequestToResolvedURL
+	// returns, so there isn’t a way for the error text to be provided to any of our callers.
+	defer uploadReader.Terminate(errors.New("Reading data from an already terminated upload"))
+	res, err := d.c.makeRequestToResolvedURL(ctx, http.MethodPatch, uploadLocation, headers, uploadReader, streamLen, v2Auth, nil)
+	if err != nil {
+		logrus.Debugf("Error uploading layer chunked %v", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	if !successStatus(res.StatusCode) {
+		return nil, fmt.Errorf("uploading layer chunked: %w", registryHTTPResponseToError(res))
+	}
+	uploadLocation, err = res.Location()
+	if err != nil {
+		return nil, fmt.Errorf("determining upload URL: %w", err)
+	}
+	return uploadLocation, nil
+}
+
+// startUpload initiates a blob upload, and returns the upload URL, and the minimum chunk size required by the registry (0 if not specified).
+func (d *dockerImageDestination) startUpload(ctx context.Context) (*url.URL, int64, error) {
+	uploadPath := fmt.Sprintf(blobUploadPath, reference.Path(d.ref.ref))
+	logrus.Debugf("Uploading %s", uploadPath)
+	res, err := d.c.makeRequest(ctx, http.MethodPost, uploadPath, nil, nil, v2Auth, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		logrus.Debugf("Error initiating layer upload, response %#v", *res)
+		return nil, 0, fmt.Errorf("initiating layer upload to %s in %s: %w", uploadPath, d.c.registry, registryHTTPResponseToError(res))
+	}
+	uploadLocation, err := res.Location()
+	if err != nil {
+		return nil, 0, fmt.Errorf("determining upload URL: %w", err)
+	}
+	var minChunkSize int64
+	if value := res.Header.Get("OCI-Chunk-Min-Length"); value != "" {
+		minChunkSize, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || minChunkSize < 0 {
+			logrus.Debugf("Ignoring invalid OCI-Chunk-Min-Length value %q", value)
+			minChunkSize = 0
+		}
+	}
+	return uploadLocation, minChunkSize, nil
+}
+
+// finishUpload completes the blob upload at uploadLocation, after all of the blob data, with blobDigest, was uploaded.
+func (d *dockerImageDestination) finishUpload(ctx context.Context, uploadLocation *url.URL, blobDigest digest.Digest) error {
 	locationQuery := uploadLocation.Query()
 	locationQuery.Set("digest", blobDigest.String())
 	uploadLocation.RawQuery = locationQuery.Encode()
-	res, err = d.c.makeRequestToResolvedURL(ctx, http.MethodPut, uploadLocation, map[string][]string{"Content-Type": {"application/octet-stream"}}, nil, -1, v2Auth, nil)
+	res, err := d.c.makeRequestToResolvedURL(ctx, http.MethodPut, uploadLocation, map[string][]string{"Content-Type": {"application/octet-stream"}}, nil, -1, v2Auth, nil)
 	if err != nil {
-		return private.UploadedBlob{}, err
+		return err
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusCreated {
 		logrus.Debugf("Error uploading layer, response %#v", *res)
-		return private.UploadedBlob{}, fmt.Errorf("uploading layer to %s: %w", uploadLocation, registryHTTPResponseToError(res))
+		return fmt.Errorf("uploading layer to %s: %w", uploadLocation, registryHTTPResponseToError(res))
 	}
-
 	logrus.Debugf("Upload of layer %s complete", blobDigest)
-	options.Cache.RecordKnownLocation(d.ref.Transport(), bicTransportScope(d.ref), blobDigest, newBICLocationReference(d.ref))
-	return private.UploadedBlob{Digest: blobDigest, Size: sizeCounter.size}, nil
+	return nil
 }
 
 // blobExists returns true iff repo contains a blob with digest, and if so, also its size.
@@ -446,11 +609,27 @@ func (d *dockerImageDestination) PutManifest(ctx context.Context, m []byte, inst
 		}
 	}
 
-	return d.uploadManifest(ctx, m, refTail)
+	if err := d.uploadManifest(ctx, m, refTail); err != nil {
+		return err
+	}
+	manifestDigest := d.manifestDigest
+	if instanceDigest != nil {
+		manifestDigest = *instanceDigest
+	}
+	d.writtenManifests[manifestDigest] = imgspecv1.Descriptor{
+		MediaType: manifest.GuessMIMEType(m),
+		Digest:    manifestDigest,
+		Size:      int64(len(m)),
+	}
+	return nil
 }
 
 // uploadManifest writes manifest to tagOrDigest.
+// If the manifest is too large, it returns a types.ErrManifestTooLarge.
 func (d *dockerImageDestination) uploadManifest(ctx context.Context, m []byte, tagOrDigest string) error {
+	if d.c.sys != nil && d.c.sys.DockerRegistryMaxManifestSize != 0 && int64(len(m)) > d.c.sys.DockerRegistryMaxManifestSize {
+		return types.ErrManifestTooLarge{Size: int64(len(m)), Limit: d.c.sys.DockerRegistryMaxManifestSize}
+	}
 	path := fmt.Sprintf(manifestPath, reference.Path(d.ref.ref), tagOrDigest)
 
 	headers := map[string][]string{}
@@ -466,6 +645,9 @@ func (d *dockerImageDestination) uploadManifest(ctx context.Context, m []byte, t
 	if !successStatus(res.StatusCode) {
 		rawErr := registryHTTPResponseToError(res)
 		err := fmt.Errorf("uploading manifest %s to %s: %w", tagOrDigest, d.ref.ref.Name(), rawErr)
+		if res.StatusCode == http.StatusRequestEntityTooLarge {
+			return types.ErrManifestTooLarge{Size: int64(len(m)), Limit: -1, Err: err}
+		}
 		if isManifestInvalidError(rawErr) {
 			err = types.ManifestTypeRejectedError{Err: err}
 		}
@@ -546,8 +728,15 @@ func (d *dockerImageDestination) PutSignaturesWithFormat(ctx context.Context, si
 	// FIXME: So should we enable sigstores in all cases? Or write in all cases, but opt-in to read?
 
 	if len(sigstoreSignatures) != 0 {
-		if err := d.putSignaturesToSigstoreAttachments(ctx, sigstoreSignatures, *instanceDigest); err != nil {
-			return err
+		switch d.signatureStorage[signature.SigstoreFormat] {
+		case types.SignatureStorageReferrers:
+			if err := d.putSignaturesToReferrers(ctx, sigstoreSignatures, *instanceDigest); err != nil {
+				return err
+			}
+		default: // types.SignatureStorageSigstoreAttachments, or no method was chosen
+			if err := d.putSignaturesToSigstoreAttachments(ctx, sigstoreSignatures, *instanceDigest); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -555,13 +744,14 @@ func (d *dockerImageDestination) PutSignaturesWithFormat(ctx context.Context, si
 		if err := d.c.detectProperties(ctx); err != nil {
 			return err
 		}
+		method := d.signatureStorage[signature.SimpleSigningFormat]
 		switch {
-		case d.c.supportsSignatures:
-			if err := d.putSignaturesToAPIExtension(ctx, signatures, *instanceDigest); err != nil {
+		case method == types.SignatureStorageAPIExtension || (method == "" && d.c.supportsSignatures):
+			if err := d.putSignaturesToAPIExtension(ctx, otherSignatures, *instanceDigest); err != nil {
 				return err
 			}
-		case d.c.signatureBase != nil:
-			if err := d.putSignaturesToLookaside(signatures, *instanceDigest); err != nil {
+		case method == types.SignatureStorageLookaside || (method == "" && d.c.signatureBase != nil):
+			if err := d.putSignaturesToLookaside(otherSignatures, *instanceDigest); err != nil {
 				return err
 			}
 		default:
@@ -642,7 +832,7 @@ func (d *dockerImageDestination) putSignaturesToSigstoreAttachments(ctx context.
 		return errors.New("writing sigstore attachments is disabled by configuration")
 	}
 
-	ociManifest, err := d.c.getSigstoreAttachmentManifest(ctx, d.ref, manifestDigest)
+	ociManifest, err := d.c.getSigstoreAttachmentManifest(ctx, d.ref, d.c.signatureAttachmentTag(manifestDigest))
 	if err != nil {
 		return err
 	}
@@ -725,7 +915,99 @@ func (d *dockerImageDestination) putSignaturesToSigstoreAttachments(ctx context.
 		return err
 	}
 	logrus.Debugf("Uploading sigstore attachment manifest")
-	return d.uploadManifest(ctx, manifestBlob, sigstoreAttachmentTag(manifestDigest))
+	return d.uploadManifest(ctx, manifestBlob, d.c.signatureAttachmentTag(manifestDigest))
+}
+
+// putSignaturesToReferrers implements PutSignaturesWithFormat() for sigstore signatures, by writing a manifest
+// with a subject referring to manifestDigest, to be found using the OCI referrers API.
+func (d *dockerImageDestination) putSignaturesToReferrers(ctx context.Context, signatures []signature.Sigstore, manifestDigest digest.Digest) error {
+	if !d.c.useSigstoreAttachments {
+		return errors.New("writing sigstore attachments is disabled by configuration")
+	}
+
+	existingManifests, supported, err := d.c.getSigstoreReferrerManifests(ctx, d.ref, manifestDigest)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return fmt.Errorf("writing sigstore signatures as referrers: %s does not support the referrers API", d.ref.ref.Name())
+	}
+	existingLayers := []imgspecv1.Descriptor{}
+	for _, m := range existingManifests {
+		existingLayers = append(existingLayers, m.Layers...)
+	}
+
+	newLayers := []imgspecv1.Descriptor{}
+	for _, sig := range signatures {
+		mimeType := sig.UntrustedMIMEType()
+		payloadBlob := sig.UntrustedPayload()
+		annotations := sig.UntrustedAnnotations()
+
+		matches := func(layer imgspecv1.Descriptor) bool {
+			return layerMatchesSigstoreSignature(layer, mimeType, payloadBlob, annotations)
+		}
+		if slices.ContainsFunc(existingLayers, matches) || slices.ContainsFunc(newLayers, matches) {
+			logrus.Debugf("Signature with digest %s already exists on the registry", digest.FromBytes(payloadBlob).String())
+			continue
+		}
+
+		// We don’t benefit from a real BlobInfoCache here because we never try to reuse/mount attachment payloads.
+		sigDesc, err := d.putBlobBytesAsOCI(ctx, payloadBlob, mimeType, private.PutBlobOptions{
+			Cache:      none.NoCache,
+			IsConfig:   false,
+			EmptyLayer: false,
+			LayerIndex: nil,
+		})
+		if err != nil {
+			return err
+		}
+		sigDesc.Annotations = annotations
+		newLayers = append(newLayers, sigDesc)
+		logrus.Debugf("Adding new signature, digest %s", sigDesc.Digest.String())
+	}
+	if len(newLayers) == 0 {
+		return nil
+	}
+
+	subject, err := d.manifestDescriptor(ctx, manifestDigest)
+	if err != nil {
+		return err
+	}
+	// Artifacts have no meaningful config; the referrers API reports the config MIME type as the artifact type.
+	configDesc, err := d.putBlobBytesAsOCI(ctx, []byte("{}"), sigstoreSignatureArtifactType, private.PutBlobOptions{
+		Cache:      none.NoCache,
+		IsConfig:   true,
+		EmptyLayer: false,
+		LayerIndex: nil,
+	})
+	if err != nil {
+		return err
+	}
+	ociManifest := manifest.OCI1FromComponents(configDesc, newLayers)
+	ociManifest.Subject = &subject
+	manifestBlob, err := ociManifest.Serialize()
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("Uploading sigstore signature referrer manifest")
+	return d.uploadManifest(ctx, manifestBlob, digest.FromBytes(manifestBlob).String())
+}
+
+// manifestDescriptor returns a descriptor of the manifest with manifestDigest in d.ref,
+// preferring the data recorded by PutManifest to contacting the registry.
+func (d *dockerImageDestination) manifestDescriptor(ctx context.Context, manifestDigest digest.Digest) (imgspecv1.Descriptor, error) {
+	if desc, ok := d.writtenManifests[manifestDigest]; ok {
+		return desc, nil
+	}
+	manifestBlob, mimeType, err := d.c.fetchManifest(ctx, d.ref, manifestDigest.String())
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	return imgspecv1.Descriptor{
+		MediaType: mimeType,
+		Digest:    manifestDigest,
+		Size:      int64(len(manifestBlob)),
+	}, nil
 }
 
 func layerMatchesSigstoreSignature(layer imgspecv1.Descriptor, mimeType string,
@@ -3,10 +3,28 @@ package docker
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/registrytest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -34,3 +52,690 @@ func TestIsManifestInvalidError(t *testing.T) {
 	res := isManifestInvalidError(err)
 	assert.True(t, res, "%#v", err)
 }
+
+func TestDockerImageDestinationPreflight(t *testing.T) {
+	const uploadPath = "/v2/repo/blobs/uploads/"
+	const uploadLocation = uploadPath + "some-uuid"
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o644)
+	require.NoError(t, err)
+	for _, c := range []struct {
+		name            string
+		status          int
+		body            string
+		success         bool
+		expectCancelled bool
+	}{
+		{"upload accepted", http.StatusAccepted, "", true, true},
+		{"repository does not exist", http.StatusNotFound, `{"errors":[{"code":"NAME_UNKNOWN","message":"repository name not known to registry"}]}`, false, false},
+		{"push denied", http.StatusForbidden, `{"errors":[{"code":"DENIED","message":"requested access to the resource is denied"}]}`, false, false},
+	} {
+		cancelled := false
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+				rw.WriteHeader(http.StatusOK)
+			case r.Method == http.MethodPost && r.URL.Path == uploadPath:
+				if c.status == http.StatusAccepted {
+					rw.Header().Set("Location", uploadLocation)
+				} else {
+					rw.Header().Set("Content-Type", "application/json")
+				}
+				rw.WriteHeader(c.status)
+				_, err := rw.Write([]byte(c.body))
+				require.NoError(t, err)
+			case r.Method == http.MethodDelete && r.URL.Path == uploadLocation:
+				cancelled = true
+				rw.WriteHeader(http.StatusNoContent)
+			default:
+				require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+			}
+		}))
+		registryURL, err := url.Parse(server.URL)
+		require.NoError(t, err, c.name)
+
+		ref, err := ParseReference("//" + registryURL.Host + "/repo:latest")
+		require.NoError(t, err, c.name)
+		dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{
+			RegistriesDirPath:           "/this/does/not/exist",
+			DockerPerHostCertDirPath:    "/this/does/not/exist",
+			SystemRegistriesConfPath:    registriesConf,
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		})
+		require.NoError(t, err, c.name)
+		checker, ok := dest.(private.PreflightChecker)
+		require.True(t, ok, c.name)
+		err = checker.Preflight(context.Background())
+		if c.success {
+			assert.NoError(t, err, c.name)
+		} else {
+			assert.Error(t, err, c.name)
+		}
+		assert.Equal(t, c.expectCancelled, cancelled, c.name)
+		dest.Close()
+		server.Close()
+	}
+}
+
+func TestUploadSemaphore(t *testing.T) {
+	s1 := uploadSemaphore("registry.example", 2)
+	assert.Same(t, s1, uploadSemaphore("registry.example", 2))
+	assert.NotSame(t, s1, uploadSemaphore("registry.example", 3))
+	assert.NotSame(t, s1, uploadSemaphore("other.example", 2))
+
+	assert.True(t, s1.TryAcquire(2))
+	assert.False(t, uploadSemaphore("registry.example", 2).TryAcquire(1))
+	s1.Release(2)
+
+	// Invalid values
+	ref, err := ParseReference("//registry.example/repo:latest")
+	require.NoError(t, err)
+	_, err = ref.NewImageDestination(context.Background(), &types.SystemContext{
+		RegistriesDirPath:                "/this/does/not/exist",
+		DockerPerHostCertDirPath:         "/this/does/not/exist",
+		SystemRegistriesConfPath:         "/this/does/not/exist",
+		DockerRegistryMaxParallelUploads: -1,
+	})
+	assert.Error(t, err)
+}
+
+func TestPutBlobInChunks(t *testing.T) {
+	const chunkSize = 1024
+	server := registrytest.NewServer(nil)
+	defer server.Close()
+	sys := registrytestSystemContext(t, server, "")
+	sys.DockerRegistryResumableUploads = true
+	sys.DockerRegistryMinUploadChunkSize = chunkSize
+	ref, err := ParseReference("//" + server.Host() + "/repo:latest")
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(context.Background(), sys)
+	require.NoError(t, err)
+	defer dest.Close()
+	privateDest, ok := dest.(private.ImageDestination)
+	require.True(t, ok)
+
+	blob := make([]byte, 10*chunkSize+100)
+	_, err = rand.New(rand.NewSource(0)).Read(blob)
+	require.NoError(t, err)
+	blobDigest := digest.FromBytes(blob)
+	put := func() (private.UploadedBlob, error) {
+		return privateDest.PutBlobWithOptions(context.Background(), bytes.NewReader(blob),
+			types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, private.PutBlobOptions{Cache: none.NoCache})
+	}
+	countPatches := func(requests []registrytest.Request) int {
+		res := 0
+		for _, r := range requests {
+			if r.Method == http.MethodPatch && r.StatusCode == http.StatusAccepted {
+				res++
+			}
+		}
+		return res
+	}
+
+	// The connection is dropped when uploading the sixth chunk.
+	var mutex sync.Mutex
+	patches := 0
+	server.SetFaultInjector(func(r *http.Request) *registrytest.Fault {
+		if r.Method != http.MethodPatch {
+			return nil
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		patches++
+		if patches != 6 {
+			return nil
+		}
+		return &registrytest.Fault{ResetConnection: true}
+	})
+	_, err = put()
+	require.Error(t, err)
+	_, ok = server.Blob("repo", blobDigest)
+	assert.False(t, ok)
+	firstAttempt := server.Requests()
+	assert.Equal(t, 5, countPatches(firstAttempt))
+
+	// The second attempt continues after the fifth chunk.
+	uploaded, err := put()
+	require.NoError(t, err)
+	assert.Equal(t, private.UploadedBlob{Digest: blobDigest, Size: int64(len(blob))}, uploaded)
+	contents, ok := server.Blob("repo", blobDigest)
+	require.True(t, ok)
+	assert.Equal(t, blob, contents)
+	secondAttempt := server.Requests()[len(firstAttempt):]
+	statusChecked := false
+	for _, r := range secondAttempt {
+		assert.False(t, r.Method == http.MethodPost && strings.HasSuffix(r.Path, "/blobs/uploads/"), "unexpected new upload")
+		if r.Method == http.MethodGet && strings.Contains(r.Path, "/blobs/uploads/") {
+			assert.Equal(t, http.StatusNoContent, r.StatusCode)
+			statusChecked = true
+		}
+	}
+	assert.True(t, statusChecked)
+	assert.Equal(t, 6, countPatches(secondAttempt)) // 5 full chunks, and the 100-byte rest
+
+	// Once completed, the upload is not resumed again.
+	_, ok = dest.(*dockerImageDestination).c.resumableUploadState().take(resumableUploadKey{repo: "repo", digest: blobDigest})
+	assert.False(t, ok)
+
+	// An interrupted upload is not resumed by other destinations.
+	patches = 0
+	server.SetFaultInjector(func(r *http.Request) *registrytest.Fault {
+		if r.Method != http.MethodPatch {
+			return nil
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		patches++
+		if patches != 2 {
+			return nil
+		}
+		return &registrytest.Fault{ResetConnection: true}
+	})
+	otherBlob := append(append([]byte{}, blob...), 1)
+	otherInfo := types.BlobInfo{Digest: digest.FromBytes(otherBlob), Size: int64(len(otherBlob))}
+	_, err = privateDest.PutBlobWithOptions(context.Background(), bytes.NewReader(otherBlob), otherInfo, private.PutBlobOptions{Cache: none.NoCache})
+	require.Error(t, err)
+	server.SetFaultInjector(nil)
+	otherDest, err := ref.NewImageDestination(context.Background(), sys)
+	require.NoError(t, err)
+	defer otherDest.Close()
+	beforeOtherDest := len(server.Requests())
+	_, err = otherDest.(private.ImageDestination).PutBlobWithOptions(context.Background(), bytes.NewReader(otherBlob), otherInfo, private.PutBlobOptions{Cache: none.NoCache})
+	require.NoError(t, err)
+	newUploads := 0
+	for _, r := range server.Requests()[beforeOtherDest:] {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.Path, "/blobs/uploads/") {
+			newUploads++
+		}
+	}
+	assert.Equal(t, 1, newUploads)
+	// … although the original destination could have resumed it.
+	_, ok = dest.(*dockerImageDestination).c.resumableUploadState().take(resumableUploadKey{repo: "repo", digest: otherInfo.Digest})
+	assert.True(t, ok)
+
+	// Invalid values
+	sys.DockerRegistryMinUploadChunkSize = -1
+	_, err = ref.NewImageDestination(context.Background(), sys)
+	assert.Error(t, err)
+}
+
+// onlyReader is an io.Reader which hides any other methods of the underlying reader.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestPutBlobWithRetries(t *testing.T) {
+	const resetAt = 3000
+	blob := make([]byte, 10000)
+	_, err := rand.New(rand.NewSource(0)).Read(blob)
+	require.NoError(t, err)
+	blobDigest := digest.FromBytes(blob)
+	isUploadRequest := func(r registrytest.Request, method string) bool {
+		return r.Method == method && strings.Contains(r.Path, "/blobs/uploads/")
+	}
+
+	for _, c := range []struct {
+		name       string
+		stream     func() io.Reader
+		inputInfo  types.BlobInfo
+		maxRetries int
+		faults     int
+		success    bool
+	}{
+		{"ReaderAt", func() io.Reader { return bytes.NewReader(blob) }, types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, 2, 1, true},
+		{"buffered", func() io.Reader { return onlyReader{bytes.NewReader(blob)} }, types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, 2, 1, true},
+		{"unknown digest and size", func() io.Reader { return onlyReader{bytes.NewReader(blob)} }, types.BlobInfo{Size: -1}, 2, 1, true},
+		{"repeated failures", func() io.Reader { return bytes.NewReader(blob) }, types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, 2, 2, true},
+		{"retries exhausted", func() io.Reader { return bytes.NewReader(blob) }, types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, 2, 3, false},
+		{"retries disabled", func() io.Reader { return bytes.NewReader(blob) }, types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, 0, 1, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			server := registrytest.NewServer(nil)
+			defer server.Close()
+			sys := registrytestSystemContext(t, server, "")
+			sys.DockerMaxUploadRetries = c.maxRetries
+			ref, err := ParseReference("//" + server.Host() + "/repo:latest")
+			require.NoError(t, err)
+			dest, err := ref.NewImageDestination(context.Background(), sys)
+			require.NoError(t, err)
+			defer dest.Close()
+			privateDest, ok := dest.(private.ImageDestination)
+			require.True(t, ok)
+
+			// The connection is dropped after receiving resetAt bytes of the request body.
+			server.SetFaultInjector(registrytest.InjectFirst(c.faults, registrytest.MatchRequest(http.MethodPatch, "/blobs/uploads/"),
+				registrytest.Fault{ResetAfterRequestBytes: resetAt}))
+			uploaded, err := privateDest.PutBlobWithOptions(context.Background(), c.stream(), c.inputInfo, private.PutBlobOptions{Cache: none.NoCache})
+			if !c.success {
+				assert.Error(t, err)
+				_, ok = server.Blob("repo", blobDigest)
+				assert.False(t, ok)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, private.UploadedBlob{Digest: blobDigest, Size: int64(len(blob))}, uploaded)
+			contents, ok := server.Blob("repo", blobDigest)
+			require.True(t, ok)
+			assert.Equal(t, blob, contents)
+
+			var patches []registrytest.Request
+			statusChecks := 0
+			for _, r := range server.Requests() {
+				if isUploadRequest(r, http.MethodPatch) {
+					patches = append(patches, r)
+				}
+				if isUploadRequest(r, http.MethodGet) {
+					assert.Equal(t, http.StatusNoContent, r.StatusCode)
+					statusChecks++
+				}
+				assert.False(t, r.Method == http.MethodPost && strings.HasSuffix(r.Path, "/blobs/uploads/") && statusChecks != 0,
+					"unexpected new upload")
+			}
+			assert.Equal(t, c.faults, statusChecks)
+			// Each retry continues after the data received so far, without sending it again.
+			// (Retries send a Content-Range, so the registry refuses truncated retries, and all retries continue at resetAt.)
+			require.Len(t, patches, c.faults+1)
+			for i, r := range patches {
+				expectedLength := int64(len(blob))
+				switch {
+				case c.inputInfo.Size == -1:
+					expectedLength = -1
+				case i > 0:
+					expectedLength -= resetAt
+				}
+				assert.Equal(t, expectedLength, r.ContentLength, i)
+				if i < c.faults {
+					assert.Equal(t, 0, r.StatusCode, i)
+				} else {
+					assert.Equal(t, http.StatusAccepted, r.StatusCode, i)
+				}
+			}
+		})
+	}
+
+	// With DockerRegistryResumableUploads, an interrupted chunk is sent again.
+	server := registrytest.NewServer(nil)
+	defer server.Close()
+	sys := registrytestSystemContext(t, server, "")
+	sys.DockerMaxUploadRetries = 1
+	sys.DockerRegistryResumableUploads = true
+	sys.DockerRegistryMinUploadChunkSize = 4096
+	ref, err := ParseReference("//" + server.Host() + "/repo:latest")
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(context.Background(), sys)
+	require.NoError(t, err)
+	defer dest.Close()
+	privateDest, ok := dest.(private.ImageDestination)
+	require.True(t, ok)
+	var mutex sync.Mutex
+	patchCount := 0
+	server.SetFaultInjector(func(r *http.Request) *registrytest.Fault {
+		if r.Method != http.MethodPatch {
+			return nil
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		patchCount++
+		if patchCount != 2 {
+			return nil
+		}
+		return &registrytest.Fault{ResetAfterRequestBytes: resetAt}
+	})
+	_, err = privateDest.PutBlobWithOptions(context.Background(), bytes.NewReader(blob),
+		types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, private.PutBlobOptions{Cache: none.NoCache})
+	require.NoError(t, err)
+	contents, ok := server.Blob("repo", blobDigest)
+	require.True(t, ok)
+	assert.Equal(t, blob, contents)
+	var patches []registrytest.Request
+	for _, r := range server.Requests() {
+		if isUploadRequest(r, http.MethodPatch) {
+			patches = append(patches, r)
+		}
+	}
+	require.Len(t, patches, 4) // The truncated second chunk was not accepted by the registry, so it was sent in full again.
+	assert.Equal(t, []int{http.StatusAccepted, 0, http.StatusAccepted, http.StatusAccepted},
+		[]int{patches[0].StatusCode, patches[1].StatusCode, patches[2].StatusCode, patches[3].StatusCode})
+	assert.Equal(t, patches[1].ContentLength, patches[2].ContentLength)
+
+	// Invalid values
+	sys = registrytestSystemContext(t, server, "")
+	sys.DockerMaxUploadRetries = -1
+	_, err = ref.NewImageDestination(context.Background(), sys)
+	assert.Error(t, err)
+}
+
+func TestPutManifestTooLarge(t *testing.T) {
+	const repo = "repo"
+	manifestBlob, err := os.ReadFile("../signature/fixtures/dir-img-cosign-multiple-keys/manifest.json")
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name              string
+		serverLimit       int
+		configuredLimit   int64
+		expectedLimit     int64
+		expectedToRequest bool
+	}{
+		{"refused by the registry", len(manifestBlob) - 1, 0, -1, true},
+		{"configured limit", 0, int64(len(manifestBlob) - 1), int64(len(manifestBlob) - 1), false},
+	} {
+		server := registrytest.NewServer(&registrytest.Options{MaxManifestSize: c.serverLimit})
+		sys := server.SystemContext()
+		sys.DockerRegistryMaxManifestSize = c.configuredLimit
+		ref, err := ParseReference("//" + server.Host() + "/" + repo + ":latest")
+		require.NoError(t, err, c.name)
+		dest, err := ref.NewImageDestination(context.Background(), sys)
+		require.NoError(t, err, c.name)
+
+		err = dest.PutManifest(context.Background(), manifestBlob, nil)
+		var tooLarge types.ErrManifestTooLarge
+		require.ErrorAs(t, err, &tooLarge, c.name)
+		assert.Equal(t, int64(len(manifestBlob)), tooLarge.Size, c.name)
+		assert.Equal(t, c.expectedLimit, tooLarge.Limit, c.name)
+		requested := false
+		for _, r := range server.Requests() {
+			if r.Method == http.MethodPut {
+				requested = true
+			}
+		}
+		assert.Equal(t, c.expectedToRequest, requested, c.name)
+		assert.Empty(t, server.Tags(repo), c.name)
+
+		dest.Close()
+		server.Close()
+	}
+
+	// A manifest within the limits is accepted
+	server := registrytest.NewServer(&registrytest.Options{MaxManifestSize: len(manifestBlob)})
+	defer server.Close()
+	sys := server.SystemContext()
+	sys.DockerRegistryMaxManifestSize = int64(len(manifestBlob))
+	ref, err := ParseReference("//" + server.Host() + "/" + repo + ":latest")
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(context.Background(), sys)
+	require.NoError(t, err)
+	defer dest.Close()
+	err = dest.PutManifest(context.Background(), manifestBlob, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"latest"}, server.Tags(repo))
+}
+
+func TestPutSignaturesToSigstoreAttachments(t *testing.T) {
+	const fixtureDir = "../signature/fixtures/dir-img-cosign-multiple-keys"
+	const repo = "cosign-signed-single-sample"
+	manifestBlob, err := os.ReadFile(filepath.Join(fixtureDir, "manifest.json"))
+	require.NoError(t, err)
+	var sigstoreSigs []signature.Signature
+	for i := 1; i <= 3; i++ {
+		sigBlob, err := os.ReadFile(filepath.Join(fixtureDir, fmt.Sprintf("signature-%d", i)))
+		require.NoError(t, err)
+		sig, err := signature.FromBlob(sigBlob)
+		require.NoError(t, err)
+		require.IsType(t, signature.Sigstore{}, sig)
+		sigstoreSigs = append(sigstoreSigs, sig)
+	}
+	simpleSigBlob, err := os.ReadFile("../signature/fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+	simpleSig := signature.SimpleSigningFromBlob(simpleSigBlob)
+
+	server := registrytest.NewServer(nil)
+	defer server.Close()
+	manifestDigest := server.PutManifest(repo, "", manifest.DockerV2Schema2MediaType, manifestBlob)
+	stagingDir := t.TempDir()
+	sys := registrytestSystemContext(t, server, "lookaside-staging: file://"+stagingDir)
+	ref, err := ParseReference("//" + server.Host() + "/" + repo + "@" + manifestDigest.String())
+	require.NoError(t, err)
+
+	putSignatures := func(sigs []signature.Signature) error {
+		publicDest, err := ref.NewImageDestination(context.Background(), sys)
+		require.NoError(t, err)
+		defer publicDest.Close()
+		dest, ok := publicDest.(*dockerImageDestination)
+		require.True(t, ok)
+		return dest.PutSignaturesWithFormat(context.Background(), sigs, &manifestDigest)
+	}
+	// assertAttachment verifies that the attachment manifest contains exactly expected, in order, and that all blobs exist.
+	attachmentTag := fmt.Sprintf("sha256-%s.sig", manifestDigest.Encoded())
+	assertAttachment := func(expected []signature.Signature) {
+		attachmentBlob, mimeType, ok := server.Manifest(repo, attachmentTag)
+		require.True(t, ok)
+		assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+		var attachment imgspecv1.Manifest
+		err := json.Unmarshal(attachmentBlob, &attachment)
+		require.NoError(t, err)
+		configBlob, ok := server.Blob(repo, attachment.Config.Digest)
+		require.True(t, ok)
+		var config imgspecv1.Image
+		err = json.Unmarshal(configBlob, &config)
+		require.NoError(t, err)
+		require.Len(t, attachment.Layers, len(expected))
+		require.Len(t, config.RootFS.DiffIDs, len(expected))
+		for i, sig := range expected {
+			sigstoreSig := sig.(signature.Sigstore)
+			layer := attachment.Layers[i]
+			assert.Equal(t, sigstoreSig.UntrustedMIMEType(), layer.MediaType)
+			assert.Equal(t, sigstoreSig.UntrustedAnnotations(), layer.Annotations)
+			assert.Equal(t, layer.Digest, config.RootFS.DiffIDs[i])
+			payload, ok := server.Blob(repo, layer.Digest)
+			require.True(t, ok)
+			assert.Equal(t, sigstoreSig.UntrustedPayload(), payload)
+		}
+	}
+	lookasidePath := filepath.Join(stagingDir, fmt.Sprintf("%s@sha256=%s", repo, manifestDigest.Encoded()))
+
+	// Sigstore signatures are written to the attachment, simple signing signatures to the lookaside.
+	err = putSignatures([]signature.Signature{sigstoreSigs[0], simpleSig})
+	require.NoError(t, err)
+	assertAttachment(sigstoreSigs[:1])
+	lookasideBlob, err := os.ReadFile(filepath.Join(lookasidePath, "signature-1"))
+	require.NoError(t, err)
+	assert.Equal(t, simpleSigBlob, lookasideBlob)
+	_, err = os.Stat(filepath.Join(lookasidePath, "signature-2"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// New signatures are appended to an existing attachment, signatures already present are not duplicated.
+	err = putSignatures([]signature.Signature{sigstoreSigs[1], sigstoreSigs[0]})
+	require.NoError(t, err)
+	assertAttachment(sigstoreSigs[:2])
+	err = putSignatures([]signature.Signature{sigstoreSigs[2]})
+	require.NoError(t, err)
+	assertAttachment(sigstoreSigs)
+	err = putSignatures(sigstoreSigs)
+	require.NoError(t, err)
+	assertAttachment(sigstoreSigs)
+	// The lookaside was not modified.
+	lookasideBlob, err = os.ReadFile(filepath.Join(lookasidePath, "signature-1"))
+	require.NoError(t, err)
+	assert.Equal(t, simpleSigBlob, lookasideBlob)
+
+	// Writing sigstore signatures fails if attachments are disabled.
+	sys.DockerUseSigstoreAttachments = types.OptionalBoolFalse
+	err = putSignatures(sigstoreSigs[:1])
+	assert.Error(t, err)
+}
+
+func TestSupportedSignatureStorageMethods(t *testing.T) {
+	const repo = "repo"
+	for _, c := range []struct {
+		name                string
+		disableReferrersAPI bool
+		namespaceConfig     string // If not "", replaces the default configuration of registrytestSystemContext
+		extraConfig         string
+		expected            map[signature.FormatID][]types.SignatureStorageMethod
+	}{
+		{
+			name: "referrers API supported",
+			expected: map[signature.FormatID][]types.SignatureStorageMethod{
+				signature.SigstoreFormat:      {types.SignatureStorageSigstoreAttachments, types.SignatureStorageReferrers},
+				signature.SimpleSigningFormat: {types.SignatureStorageLookaside},
+			},
+		},
+		{
+			name:        "referrers API supported and preferred",
+			extraConfig: "use-referrers-api: true",
+			expected: map[signature.FormatID][]types.SignatureStorageMethod{
+				signature.SigstoreFormat:      {types.SignatureStorageReferrers, types.SignatureStorageSigstoreAttachments},
+				signature.SimpleSigningFormat: {types.SignatureStorageLookaside},
+			},
+		},
+		{
+			name:                "referrers API not supported",
+			disableReferrersAPI: true,
+			extraConfig:         "use-referrers-api: true",
+			expected: map[signature.FormatID][]types.SignatureStorageMethod{
+				signature.SigstoreFormat:      {types.SignatureStorageSigstoreAttachments},
+				signature.SimpleSigningFormat: {types.SignatureStorageLookaside},
+			},
+		},
+		{
+			name:            "sigstore attachments disabled",
+			namespaceConfig: "lookaside: file:///var/lib/containers/sigstore",
+			expected: map[signature.FormatID][]types.SignatureStorageMethod{
+				signature.SimpleSigningFormat: {types.SignatureStorageLookaside},
+			},
+		},
+		{
+			name:            "read-only lookaside",
+			namespaceConfig: "lookaside: https://lookaside.example.com\n    use-sigstore-attachments: true",
+			expected: map[signature.FormatID][]types.SignatureStorageMethod{
+				signature.SigstoreFormat: {types.SignatureStorageSigstoreAttachments, types.SignatureStorageReferrers},
+			},
+		},
+		{
+			name:            "lookaside staging",
+			namespaceConfig: "lookaside: https://lookaside.example.com\n    lookaside-staging: file:///var/lib/containers/sigstore",
+			expected: map[signature.FormatID][]types.SignatureStorageMethod{
+				signature.SimpleSigningFormat: {types.SignatureStorageLookaside},
+			},
+		},
+	} {
+		server := registrytest.NewServer(&registrytest.Options{DisableReferrersAPI: c.disableReferrersAPI})
+		sys := registrytestSystemContext(t, server, c.extraConfig)
+		if c.namespaceConfig != "" {
+			err := os.WriteFile(filepath.Join(sys.RegistriesDirPath, "registries.yaml"),
+				[]byte(fmt.Sprintf("docker:\n  %s:\n    %s\n", server.Host(), c.namespaceConfig)), 0o644)
+			require.NoError(t, err, c.name)
+		}
+		ref, err := ParseReference("//" + server.Host() + "/" + repo + ":latest")
+		require.NoError(t, err, c.name)
+		dest, err := ref.NewImageDestination(context.Background(), sys)
+		require.NoError(t, err, c.name)
+		negotiator, ok := dest.(private.SignatureStorageNegotiator)
+		require.True(t, ok, c.name)
+		res, err := negotiator.SupportedSignatureStorageMethods(context.Background())
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.expected, res, c.name)
+		dest.Close()
+		server.Close()
+	}
+}
+
+func TestPutSignaturesToReferrers(t *testing.T) {
+	const fixtureDir = "../signature/fixtures/dir-img-cosign-multiple-keys"
+	const repo = "cosign-signed-single-sample"
+	manifestBlob, err := os.ReadFile(filepath.Join(fixtureDir, "manifest.json"))
+	require.NoError(t, err)
+	var sigstoreSigs []signature.Signature
+	for i := 1; i <= 3; i++ {
+		sigBlob, err := os.ReadFile(filepath.Join(fixtureDir, fmt.Sprintf("signature-%d", i)))
+		require.NoError(t, err)
+		sig, err := signature.FromBlob(sigBlob)
+		require.NoError(t, err)
+		sigstoreSigs = append(sigstoreSigs, sig)
+	}
+
+	newDest := func(server *registrytest.Server, sys *types.SystemContext) *dockerImageDestination {
+		ref, err := ParseReference("//" + server.Host() + "/" + repo + ":latest")
+		require.NoError(t, err)
+		publicDest, err := ref.NewImageDestination(context.Background(), sys)
+		require.NoError(t, err)
+		t.Cleanup(func() { publicDest.Close() })
+		dest, ok := publicDest.(*dockerImageDestination)
+		require.True(t, ok)
+		err = dest.UseSignatureStorageMethods(map[signature.FormatID]types.SignatureStorageMethod{
+			signature.SigstoreFormat: types.SignatureStorageReferrers,
+		})
+		require.NoError(t, err)
+		return dest
+	}
+	// assertReferrers verifies that the referrer manifests contain exactly expected, in any order, and that all blobs exist.
+	assertReferrers := func(server *registrytest.Server, manifestDigest digest.Digest, expected []signature.Signature) {
+		referrers := server.Referrers(repo, manifestDigest, sigstoreSignatureArtifactType)
+		layers := []imgspecv1.Descriptor{}
+		for _, referrer := range referrers {
+			referrerBlob, mimeType, ok := server.Manifest(repo, referrer.Digest.String())
+			require.True(t, ok)
+			assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+			var m imgspecv1.Manifest
+			err := json.Unmarshal(referrerBlob, &m)
+			require.NoError(t, err)
+			require.NotNil(t, m.Subject)
+			assert.Equal(t, imgspecv1.Descriptor{
+				MediaType: manifest.DockerV2Schema2MediaType,
+				Digest:    manifestDigest,
+				Size:      int64(len(manifestBlob)),
+			}, *m.Subject)
+			assert.Equal(t, sigstoreSignatureArtifactType, m.Config.MediaType)
+			layers = append(layers, m.Layers...)
+		}
+		expectedLayers := []imgspecv1.Descriptor{}
+		for _, sig := range expected {
+			sigstoreSig := sig.(signature.Sigstore)
+			payload := sigstoreSig.UntrustedPayload()
+			expectedLayers = append(expectedLayers, imgspecv1.Descriptor{
+				MediaType:   sigstoreSig.UntrustedMIMEType(),
+				Digest:      digest.FromBytes(payload),
+				Size:        int64(len(payload)),
+				Annotations: sigstoreSig.UntrustedAnnotations(),
+			})
+			blob, ok := server.Blob(repo, digest.FromBytes(payload))
+			require.True(t, ok)
+			assert.Equal(t, payload, blob)
+		}
+		assert.ElementsMatch(t, expectedLayers, layers)
+	}
+
+	server := registrytest.NewServer(nil)
+	defer server.Close()
+	sys := registrytestSystemContext(t, server, "")
+
+	// Signatures of a manifest written by the destination
+	dest := newDest(server, sys)
+	err = dest.PutManifest(context.Background(), manifestBlob, nil)
+	require.NoError(t, err)
+	manifestDigest := digest.FromBytes(manifestBlob)
+	err = dest.PutSignaturesWithFormat(context.Background(), sigstoreSigs[:1], nil)
+	require.NoError(t, err)
+	assertReferrers(server, manifestDigest, sigstoreSigs[:1])
+	// The tag convention is not used.
+	_, _, ok := server.Manifest(repo, sigstoreAttachmentTag(manifestDigest))
+	assert.False(t, ok)
+
+	// Signatures of an existing manifest; signatures already present are not duplicated.
+	dest = newDest(server, sys)
+	err = dest.PutSignaturesWithFormat(context.Background(), []signature.Signature{sigstoreSigs[1], sigstoreSigs[0], sigstoreSigs[1]}, &manifestDigest)
+	require.NoError(t, err)
+	assertReferrers(server, manifestDigest, sigstoreSigs[:2])
+	err = dest.PutSignaturesWithFormat(context.Background(), sigstoreSigs, &manifestDigest)
+	require.NoError(t, err)
+	assertReferrers(server, manifestDigest, sigstoreSigs)
+	numReferrers := len(server.Referrers(repo, manifestDigest, ""))
+	err = dest.PutSignaturesWithFormat(context.Background(), sigstoreSigs, &manifestDigest)
+	require.NoError(t, err)
+	assert.Len(t, server.Referrers(repo, manifestDigest, ""), numReferrers)
+
+	// The referrers API is not supported
+	oldServer := registrytest.NewServer(&registrytest.Options{DisableReferrersAPI: true})
+	defer oldServer.Close()
+	oldManifestDigest := oldServer.PutManifest(repo, "", manifest.DockerV2Schema2MediaType, manifestBlob)
+	dest = newDest(oldServer, registrytestSystemContext(t, oldServer, ""))
+	err = dest.PutSignaturesWithFormat(context.Background(), sigstoreSigs[:1], &oldManifestDigest)
+	assert.ErrorContains(t, err, "does not support the referrers API")
+
+	// A signature storage method inapplicable to the format is rejected
+	err = dest.UseSignatureStorageMethods(map[signature.FormatID]types.SignatureStorageMethod{
+		signature.SimpleSigningFormat: types.SignatureStorageReferrers,
+	})
+	assert.Error(t, err)
+}
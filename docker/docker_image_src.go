@@ -12,6 +12,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/imagesource/impl"
@@ -21,10 +22,12 @@ import (
 	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/docker/config"
 	"github.com/containers/image/v5/pkg/sysregistriesv2"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/regexp"
 	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 )
 
@@ -47,6 +50,7 @@ type dockerImageSource struct {
 }
 
 // newImageSource creates a new ImageSource for the specified image reference.
+// If ctx is associated with a session.Session, the registry state is shared with other sources and destinations in the session.
 // The caller must call .Close() on the returned ImageSource.
 func newImageSource(ctx context.Context, sys *types.SystemContext, ref dockerReference) (*dockerImageSource, error) {
 	registryConfig, err := loadRegistryConfiguration(sys)
@@ -73,10 +77,28 @@ func newImageSource(ctx context.Context, sys *types.SystemContext, ref dockerRef
 	// non-mirror original location last; this both transparently handles the case
 	// of no mirrors configured, and ensures we return the error encountered when
 	// accessing the upstream location if all endpoints fail.
+	// (The original location is not included at all if the configuration restricts pulls to mirrors.)
 	pullSources, err := registry.PullSourcesFromReference(ref.ref)
 	if err != nil {
 		return nil, err
 	}
+	pullSourcePolicy, err := registry.EffectivePullSourcePolicy(sys)
+	if err != nil {
+		return nil, err
+	}
+	if pullSourcePolicy == sysregistriesv2.PullSourcesByLatency {
+		pullSources = sysregistriesv2.OrderPullSourcesByLatency(ctx, pullSources, func(ctx context.Context, source sysregistriesv2.PullSource) (time.Duration, error) {
+			return cachedMirrorLatency(ctx, sys, source)
+		})
+	}
+	var mirrorVerifier *mirrorDigestVerifier // nil if mirrors are not verified
+	if _, isDigested := ref.ref.(reference.Canonical); sys != nil && sys.VerifyMirrorDigest && !isDigested {
+		primary, err := registry.PrimaryPullSource(ref.ref)
+		if err != nil {
+			return nil, err
+		}
+		mirrorVerifier = newMirrorDigestVerifier(sys, ref, primary, registryConfig)
+	}
 	type attempt struct {
 		ref reference.Named
 		err error
@@ -89,6 +111,11 @@ func newImageSource(ctx context.Context, sys *types.SystemContext, ref dockerRef
 			logrus.Debugf("Trying to access %q", pullSource.Reference)
 		}
 		s, err := newImageSourceAttempt(ctx, sys, ref, pullSource, registryConfig)
+		if err == nil && mirrorVerifier != nil && !pullSource.IsPrimary() {
+			if err = mirrorVerifier.verify(ctx, s); err != nil {
+				s.Close()
+			}
+		}
 		if err == nil {
 			return s, nil
 		}
@@ -121,25 +148,11 @@ func newImageSource(ctx context.Context, sys *types.SystemContext, ref dockerRef
 // The caller must call .Close() on the returned ImageSource.
 func newImageSourceAttempt(ctx context.Context, sys *types.SystemContext, logicalRef dockerReference, pullSource sysregistriesv2.PullSource,
 	registryConfig *registryConfiguration) (*dockerImageSource, error) {
-	physicalRef, err := newReference(pullSource.Reference)
-	if err != nil {
-		return nil, err
-	}
-
-	endpointSys := sys
-	// sys.DockerAuthConfig does not explicitly specify a registry; we must not blindly send the credentials intended for the primary endpoint to mirrors.
-	if endpointSys != nil && endpointSys.DockerAuthConfig != nil && reference.Domain(physicalRef.ref) != reference.Domain(logicalRef.ref) {
-		copy := *endpointSys
-		copy.DockerAuthConfig = nil
-		copy.DockerBearerRegistryToken = ""
-		endpointSys = &copy
-	}
-
-	client, err := newDockerClientFromRef(endpointSys, physicalRef, registryConfig, false, "pull")
+	physicalRef, client, err := newPullSourceClient(sys, logicalRef, pullSource, registryConfig)
 	if err != nil {
 		return nil, err
 	}
-	client.tlsClientConfig.InsecureSkipVerify = pullSource.Endpoint.Insecure
+	client.useSession(ctx)
 
 	s := &dockerImageSource{
 		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
@@ -159,6 +172,46 @@ func newImageSourceAttempt(ctx context.Context, sys *types.SystemContext, logica
 	return s, nil
 }
 
+// newPullSourceClient returns a reference to the image in pullSource, and a dockerClient for pulling it,
+// using credentials appropriate for pullSource, given logicalRef.
+// The caller must call .Close() on the returned client.
+func newPullSourceClient(sys *types.SystemContext, logicalRef dockerReference, pullSource sysregistriesv2.PullSource,
+	registryConfig *registryConfiguration) (dockerReference, *dockerClient, error) {
+	physicalRef, err := newReference(pullSource.Reference)
+	if err != nil {
+		return dockerReference{}, nil, err
+	}
+
+	endpointSys := sys
+	// sys.DockerAuthConfig does not explicitly specify a registry; we must not blindly send the credentials intended for the primary endpoint to mirrors.
+	if endpointSys != nil && endpointSys.DockerAuthConfig != nil && reference.Domain(physicalRef.ref) != reference.Domain(logicalRef.ref) {
+		copy := *endpointSys
+		copy.DockerAuthConfig = nil
+		copy.DockerBearerRegistryToken = ""
+		endpointSys = &copy
+	}
+	// A mirror can be configured to use credentials stored for a different key than its location.
+	if pullSource.Endpoint.Credentials != "" && (endpointSys == nil || endpointSys.DockerAuthConfig == nil) {
+		auth, err := config.GetCredentials(endpointSys, pullSource.Endpoint.Credentials)
+		if err != nil {
+			return dockerReference{}, nil, fmt.Errorf("getting credentials %q for %s: %w", pullSource.Endpoint.Credentials, reference.Domain(physicalRef.ref), err)
+		}
+		copy := types.SystemContext{}
+		if endpointSys != nil {
+			copy = *endpointSys
+		}
+		copy.DockerAuthConfig = &auth
+		endpointSys = &copy
+	}
+
+	client, err := newDockerClientFromRef(endpointSys, physicalRef, registryConfig, false, "pull")
+	if err != nil {
+		return dockerReference{}, nil, err
+	}
+	client.tlsClientConfig.InsecureSkipVerify = pullSource.Endpoint.Insecure
+	return physicalRef, client, nil
+}
+
 // Reference returns the reference used to set up this source, _as specified by the user_
 // (not as the image itself, or its underlying storage, claims).  This can be used e.g. to determine which public keys are trusted for this image.
 func (s *dockerImageSource) Reference() types.ImageReference {
@@ -562,7 +615,18 @@ func (s *dockerImageSource) getSignaturesFromSigstoreAttachments(ctx context.Con
 		return nil, err
 	}
 
-	ociManifest, err := s.c.getSigstoreAttachmentManifest(ctx, s.physicalRef, manifestDigest)
+	if s.c.useReferrersAPI {
+		sigs, supported, err := s.getSignaturesFromReferrers(ctx, manifestDigest)
+		if err != nil {
+			return nil, err
+		}
+		if supported {
+			return sigs, nil
+		}
+		logrus.Debugf("Falling back to looking for sigstore attachments using the tag convention")
+	}
+
+	ociManifest, err := s.c.getSigstoreAttachmentManifest(ctx, s.physicalRef, s.c.signatureAttachmentTag(manifestDigest))
 	if err != nil {
 		return nil, err
 	}
@@ -571,6 +635,33 @@ func (s *dockerImageSource) getSignaturesFromSigstoreAttachments(ctx context.Con
 	}
 
 	logrus.Debugf("Found a sigstore attachment manifest with %d layers", len(ociManifest.Layers))
+	return s.getSigstoreAttachmentLayers(ctx, ociManifest)
+}
+
+// getSignaturesFromReferrers returns sigstore signatures of manifestDigest, found using the OCI referrers API.
+// It returns (nil, false, nil) if the registry does not support the referrers API.
+func (s *dockerImageSource) getSignaturesFromReferrers(ctx context.Context, manifestDigest digest.Digest) ([]signature.Signature, bool, error) {
+	manifests, supported, err := s.c.getSigstoreReferrerManifests(ctx, s.physicalRef, manifestDigest)
+	if err != nil {
+		return nil, false, err
+	}
+	if !supported {
+		return nil, false, nil
+	}
+
+	res := []signature.Signature{}
+	for _, ociManifest := range manifests {
+		sigs, err := s.getSigstoreAttachmentLayers(ctx, ociManifest)
+		if err != nil {
+			return nil, false, err
+		}
+		res = append(res, sigs...)
+	}
+	return res, true, nil
+}
+
+// getSigstoreAttachmentLayers returns the layers of a sigstore attachment manifest ociManifest, as signatures.
+func (s *dockerImageSource) getSigstoreAttachmentLayers(ctx context.Context, ociManifest *manifest.OCI1) ([]signature.Signature, error) {
 	res := []signature.Signature{}
 	for layerIndex, layer := range ociManifest.Layers {
 		// Note that this copies all kinds of attachments: attestations, and whatever else is there,
@@ -589,6 +680,52 @@ func (s *dockerImageSource) getSignaturesFromSigstoreAttachments(ctx context.Con
 	return res, nil
 }
 
+// GetSigstoreAttestations returns the sigstore attestations (usually in-toto statements in DSSE envelopes) of the image.
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve attestations for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+func (s *dockerImageSource) GetSigstoreAttestations(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Sigstore, error) {
+	if !s.c.useSigstoreAttachments {
+		logrus.Debugf("Not looking for sigstore attestations: disabled by configuration")
+		return nil, nil
+	}
+
+	manifestDigest, err := s.manifestDigest(ctx, instanceDigest)
+	if err != nil {
+		return nil, err
+	}
+
+	ociManifest, err := s.c.getSigstoreAttachmentManifest(ctx, s.physicalRef, sigstoreAttestationTag(manifestDigest))
+	if err != nil {
+		return nil, err
+	}
+	if ociManifest == nil {
+		return nil, nil
+	}
+
+	logrus.Debugf("Found a sigstore attestation manifest with %d layers", len(ociManifest.Layers))
+	res := []signature.Sigstore{}
+	for layerIndex, layer := range ociManifest.Layers {
+		logrus.Debugf("Fetching sigstore attestation %d/%d: %s", layerIndex+1, len(ociManifest.Layers), layer.Digest.String())
+		payload, err := s.c.getOCIDescriptorContents(ctx, s.physicalRef, layer, iolimits.MaxSignatureBodySize,
+			none.NoCache)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, signature.SigstoreFromComponents(layer.MediaType, payload, layer.Annotations))
+	}
+	return res, nil
+}
+
+// GetReferrers returns descriptors of the manifests which refer to manifestDigest, and have artifactType
+// (or any artifact type, if artifactType is ""). The descriptors include the artifact type and annotations of the manifests.
+// It returns (nil, false, nil) if listing referrers is not supported (e.g. by the remote registry).
+// It may use a remote (= slow) service.
+func (s *dockerImageSource) GetReferrers(ctx context.Context, manifestDigest digest.Digest, artifactType string) ([]imgspecv1.Descriptor, bool, error) {
+	return s.c.getReferrers(ctx, s.physicalRef, manifestDigest, artifactType)
+}
+
 // deleteImage deletes the named image from the registry, if supported.
 func deleteImage(ctx context.Context, sys *types.SystemContext, ref dockerReference) error {
 	registryConfig, err := loadRegistryConfiguration(sys)
@@ -3,22 +3,40 @@ package docker
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/imagedestination"
+	"github.com/containers/image/v5/internal/imagesource"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/registrytest"
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
+	policy "github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 var _ private.ImageSource = (*dockerImageSource)(nil)
+var _ private.ReferrersSource = (*dockerImageSource)(nil)
 
 func TestDockerImageSourceReference(t *testing.T) {
 	manifestPathRegex := regexp.MustCompile("^/v2/.*/manifests/latest$")
@@ -83,6 +101,978 @@ location = "@REGISTRY@/with-mirror"
 	}
 }
 
+func TestDockerImageSourceMirrorCredentials(t *testing.T) {
+	const username, password = "mirror-user", "mirror-password"
+	manifestBlob, err := os.ReadFile("../signature/fixtures/dir-img-cosign-valid/manifest.json")
+	require.NoError(t, err)
+	server := registrytest.NewServer(&registrytest.Options{Auth: registrytest.BasicAuth, Username: username, Password: password})
+	defer server.Close()
+	server.PutManifest("mirror/busybox", "latest", manifest.DockerV2Schema2MediaType, manifestBlob)
+
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	err = os.WriteFile(authFile, []byte(fmt.Sprintf(`{"auths":{"mirror-credentials.example.com/ns":{"auth":%q}}}`,
+		base64.StdEncoding.EncodeToString([]byte(username+":"+password)))), 0o600)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		credentials string
+		success     bool
+	}{
+		{"", false}, // The credentials stored for the mirror location, i.e. none
+		{"mirror-credentials.example.com/ns", true},   // Exact match
+		{"mirror-credentials.example.com/ns/x", true}, // Credentials for a parent namespace
+		{"mirror-credentials.example.com/other", false},
+	} {
+		sys := registrytestSystemContext(t, server, "")
+		sys.DockerAuthConfig = nil
+		sys.AuthFilePath = authFile
+		credentialsConfig := ""
+		if c.credentials != "" {
+			credentialsConfig = fmt.Sprintf("credentials = %q\n", c.credentials)
+		}
+		// Pulls from the primary location fail, the server has no such image.
+		err = os.WriteFile(sys.SystemRegistriesConfPath, []byte(fmt.Sprintf(`[[registry]]
+prefix = "primary.example.com"
+location = "%s/primary"
+
+[[registry.mirror]]
+location = "%s/mirror"
+%s`, server.Host(), server.Host(), credentialsConfig)), 0o644)
+		require.NoError(t, err)
+
+		ref, err := ParseReference("//primary.example.com/busybox:latest")
+		require.NoError(t, err)
+		src, err := ref.NewImageSource(context.Background(), sys)
+		if !c.success {
+			assert.Error(t, err, c.credentials)
+			continue
+		}
+		require.NoError(t, err, c.credentials)
+		defer src.Close()
+		src2, ok := src.(*dockerImageSource)
+		require.True(t, ok)
+		assert.Equal(t, server.Host()+"/mirror/busybox:latest", src2.physicalRef.ref.String(), c.credentials)
+		assert.Equal(t, username, src2.c.auth.Username, c.credentials)
+	}
+}
+
+func TestDockerImageSourcePullFromMirrorsOnly(t *testing.T) {
+	manifestBlob, err := os.ReadFile("../signature/fixtures/dir-img-cosign-valid/manifest.json")
+	require.NoError(t, err)
+
+	for _, fallbackToPrimary := range []bool{false, true} {
+		// Only the primary location contains the image.
+		server := registrytest.NewServer(nil)
+		defer server.Close()
+		server.PutManifest("primary/busybox", "latest", manifest.DockerV2Schema2MediaType, manifestBlob)
+		sys := registrytestSystemContext(t, server, "")
+		err = os.WriteFile(sys.SystemRegistriesConfPath, []byte(fmt.Sprintf(`pull-from-mirrors-only = true
+
+[[registry]]
+prefix = "primary.example.com"
+location = "%s/primary"
+fallback-to-primary = %v
+
+[[registry.mirror]]
+location = "%s/mirror"
+`, server.Host(), fallbackToPrimary, server.Host())), 0o644)
+		require.NoError(t, err)
+
+		ref, err := ParseReference("//primary.example.com/busybox:latest")
+		require.NoError(t, err)
+		src, err := ref.NewImageSource(context.Background(), sys)
+		manifestPaths := []string{}
+		for _, r := range server.Requests() {
+			if strings.Contains(r.Path, "/manifests/") {
+				manifestPaths = append(manifestPaths, r.Path)
+			}
+		}
+		if !fallbackToPrimary {
+			assert.Error(t, err)
+			assert.Equal(t, []string{"/v2/mirror/busybox/manifests/latest"}, manifestPaths)
+			continue
+		}
+		require.NoError(t, err)
+		defer src.Close()
+		src2, ok := src.(*dockerImageSource)
+		require.True(t, ok)
+		assert.Equal(t, server.Host()+"/primary/busybox:latest", src2.physicalRef.ref.String())
+		// The primary location is tried after the mirror
+		assert.Equal(t, []string{"/v2/mirror/busybox/manifests/latest", "/v2/primary/busybox/manifests/latest"}, manifestPaths)
+	}
+}
+
+func TestDockerImageSourceVerifyMirrorDigest(t *testing.T) {
+	currentManifest, err := os.ReadFile("../signature/fixtures/dir-img-cosign-valid/manifest.json")
+	require.NoError(t, err)
+	staleManifest, err := os.ReadFile("../signature/fixtures/image.manifest.json")
+	require.NoError(t, err)
+	require.NotEqual(t, currentManifest, staleManifest)
+
+	newServer := func(t *testing.T, staleMirror bool) *registrytest.Server {
+		server := registrytest.NewServer(nil)
+		t.Cleanup(server.Close)
+		server.PutManifest("primary/busybox", "latest", manifest.DockerV2Schema2MediaType, currentManifest)
+		server.PutManifest("good-mirror/busybox", "latest", manifest.DockerV2Schema2MediaType, currentManifest)
+		if staleMirror {
+			server.PutManifest("stale-mirror/busybox", "latest", manifest.DockerV2Schema2MediaType, staleManifest)
+		} else {
+			server.PutManifest("stale-mirror/busybox", "latest", manifest.DockerV2Schema2MediaType, currentManifest)
+		}
+		return server
+	}
+	newSystemContext := func(t *testing.T, server *registrytest.Server, verify bool, mirrors ...string) *types.SystemContext {
+		sys := registrytestSystemContext(t, server, "")
+		sys.VerifyMirrorDigest = verify
+		config := fmt.Sprintf("[[registry]]\nprefix = \"primary.example.com\"\nlocation = \"%s/primary\"\n", server.Host())
+		for _, mirror := range mirrors {
+			config += fmt.Sprintf("\n[[registry.mirror]]\nlocation = \"%s/%s\"\n", server.Host(), mirror)
+		}
+		err := os.WriteFile(sys.SystemRegistriesConfPath, []byte(config), 0o644)
+		require.NoError(t, err)
+		return sys
+	}
+	primaryHEADs := func(server *registrytest.Server) int {
+		res := 0
+		for _, r := range server.Requests() {
+			if r.Method == http.MethodHead && r.Path == "/v2/primary/busybox/manifests/latest" {
+				res++
+			}
+		}
+		return res
+	}
+	physicalRef := func(t *testing.T, sys *types.SystemContext, refString string) string {
+		ref, err := ParseReference(refString)
+		require.NoError(t, err)
+		src, err := ref.NewImageSource(context.Background(), sys)
+		require.NoError(t, err)
+		defer src.Close()
+		src2, ok := src.(*dockerImageSource)
+		require.True(t, ok)
+		return src2.physicalRef.ref.String()
+	}
+
+	// Without verification, the stale mirror is used.
+	server := newServer(t, true)
+	sys := newSystemContext(t, server, false, "stale-mirror", "good-mirror")
+	assert.Equal(t, server.Host()+"/stale-mirror/busybox:latest", physicalRef(t, sys, "//primary.example.com/busybox:latest"))
+	assert.Equal(t, 0, primaryHEADs(server))
+
+	// With verification, the stale mirror is skipped, and the primary location is only contacted once.
+	server = newServer(t, true)
+	sys = newSystemContext(t, server, true, "stale-mirror", "good-mirror")
+	assert.Equal(t, server.Host()+"/good-mirror/busybox:latest", physicalRef(t, sys, "//primary.example.com/busybox:latest"))
+	assert.Equal(t, 1, primaryHEADs(server))
+
+	// A mirror serving the current manifest is accepted.
+	server = newServer(t, false)
+	sys = newSystemContext(t, server, true, "stale-mirror")
+	assert.Equal(t, server.Host()+"/stale-mirror/busybox:latest", physicalRef(t, sys, "//primary.example.com/busybox:latest"))
+	assert.Equal(t, 1, primaryHEADs(server))
+
+	// If no mirror matches, the primary location is used.
+	server = newServer(t, true)
+	sys = newSystemContext(t, server, true, "stale-mirror")
+	assert.Equal(t, server.Host()+"/primary/busybox:latest", physicalRef(t, sys, "//primary.example.com/busybox:latest"))
+
+	// Pulls by digest are not verified.
+	server = newServer(t, true)
+	sys = newSystemContext(t, server, true, "stale-mirror")
+	staleDigest, err := manifest.Digest(staleManifest)
+	require.NoError(t, err)
+	assert.Equal(t, server.Host()+"/stale-mirror/busybox@"+staleDigest.String(), physicalRef(t, sys, "//primary.example.com/busybox@"+staleDigest.String()))
+	assert.Equal(t, 0, primaryHEADs(server))
+}
+
+func TestDockerImageSourcePullSourcePolicy(t *testing.T) {
+	manifestBlob, err := os.ReadFile("../signature/fixtures/dir-img-cosign-valid/manifest.json")
+	require.NoError(t, err)
+	slowServer := registrytest.NewServer(nil)
+	defer slowServer.Close()
+	slowServer.SetFaultInjector(registrytest.InjectFirst(1000, registrytest.MatchRequest(http.MethodHead, "^/v2/$"),
+		registrytest.Fault{Delay: 200 * time.Millisecond}))
+	fastServer := registrytest.NewServer(nil)
+	defer fastServer.Close()
+	for _, server := range []*registrytest.Server{slowServer, fastServer} {
+		server.PutManifest("mirror/busybox", "latest", manifest.DockerV2Schema2MediaType, manifestBlob)
+	}
+	countProbes := func(server *registrytest.Server) int {
+		res := 0
+		for _, r := range server.Requests() {
+			if r.Method == http.MethodHead && r.Path == "/v2/" {
+				res++
+			}
+		}
+		return res
+	}
+
+	sys := registrytestSystemContext(t, slowServer, "")
+	err = os.WriteFile(sys.SystemRegistriesConfPath, []byte(fmt.Sprintf(`[[registry]]
+prefix = "primary.example.com"
+location = "%s/primary"
+pull-source-policy = "latency"
+
+[[registry.mirror]]
+location = "%s/mirror"
+
+[[registry.mirror]]
+location = "%s/mirror"
+`, slowServer.Host(), slowServer.Host(), fastServer.Host())), 0o644)
+	require.NoError(t, err)
+	ref, err := ParseReference("//primary.example.com/busybox:latest")
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		override, expected string
+	}{
+		{"", fastServer.Host()},
+		{"", fastServer.Host()}, // Probe results are reused
+		{sysregistriesv2.PullSourcesByPriority, slowServer.Host()},
+	} {
+		sys.PullSourcePolicy = c.override
+		src, err := ref.NewImageSource(context.Background(), sys)
+		require.NoError(t, err)
+		defer src.Close()
+		src2, ok := src.(*dockerImageSource)
+		require.True(t, ok)
+		assert.Equal(t, c.expected+"/mirror/busybox:latest", src2.physicalRef.ref.String(), c.override)
+	}
+	assert.Equal(t, 1, countProbes(slowServer))
+	assert.Equal(t, 1, countProbes(fastServer))
+
+	sys.PullSourcePolicy = "invalid"
+	_, err = ref.NewImageSource(context.Background(), sys)
+	assert.Error(t, err)
+}
+
+func TestDockerImageSourceSigstoreAttachments(t *testing.T) {
+	const fixtureDir = "../signature/fixtures/dir-img-cosign-multiple-keys"
+	manifestBlob, err := os.ReadFile(filepath.Join(fixtureDir, "manifest.json"))
+	require.NoError(t, err)
+	manifestDigest, err := manifest.Digest(manifestBlob)
+	require.NoError(t, err)
+
+	// Serve all signatures of the fixture as layers of a single attachment manifest, as (cosign sign) does when re-signing an image.
+	blobs := map[digest.Digest][]byte{}
+	var expectedSigs []signature.Signature
+	attachmentManifest := imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config: imgspecv1.Descriptor{
+			MediaType: "application/vnd.oci.image.config.v1+json",
+			Digest:    digest.FromString("{}"),
+			Size:      2,
+		},
+	}
+	blobs[digest.FromString("{}")] = []byte("{}")
+	for i := 1; i <= 3; i++ {
+		sigBlob, err := os.ReadFile(filepath.Join(fixtureDir, fmt.Sprintf("signature-%d", i)))
+		require.NoError(t, err)
+		sig, err := signature.FromBlob(sigBlob)
+		require.NoError(t, err)
+		sigstoreSig, ok := sig.(signature.Sigstore)
+		require.True(t, ok)
+		payload := sigstoreSig.UntrustedPayload()
+		blobs[digest.FromBytes(payload)] = payload
+		attachmentManifest.Layers = append(attachmentManifest.Layers, imgspecv1.Descriptor{
+			MediaType:   sigstoreSig.UntrustedMIMEType(),
+			Digest:      digest.FromBytes(payload),
+			Size:        int64(len(payload)),
+			Annotations: sigstoreSig.UntrustedAnnotations(),
+		})
+		expectedSigs = append(expectedSigs, sigstoreSig)
+	}
+	attachmentManifestBlob, err := json.Marshal(attachmentManifest)
+	require.NoError(t, err)
+
+	manifestPath := "/v2/cosign-signed-single-sample/manifests/" + manifestDigest.String()
+	attachmentManifestPath := "/v2/cosign-signed-single-sample/manifests/" + strings.Replace(manifestDigest.String(), ":", "-", 1) + ".sig"
+	const blobPathPrefix = "/v2/cosign-signed-single-sample/blobs/"
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Path == manifestPath:
+			rw.Header().Set("Content-Type", manifest.DockerV2Schema2MediaType)
+			_, err := rw.Write(manifestBlob)
+			require.NoError(t, err)
+		case r.Method == http.MethodGet && r.URL.Path == attachmentManifestPath:
+			rw.Header().Set("Content-Type", imgspecv1.MediaTypeImageManifest)
+			_, err := rw.Write(attachmentManifestBlob)
+			require.NoError(t, err)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, blobPathPrefix):
+			blob, ok := blobs[digest.Digest(strings.TrimPrefix(r.URL.Path, blobPathPrefix))]
+			if !ok {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, err := rw.Write(blob)
+			require.NoError(t, err)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	registryURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	registry := registryURL.Host
+
+	configDir := t.TempDir()
+	registriesDir := filepath.Join(configDir, "registries.d")
+	err = os.Mkdir(registriesDir, 0o755)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(registriesDir, "registries.yaml"), []byte(fmt.Sprintf(
+		"docker:\n  %s:\n    lookaside: file://%s\n    use-sigstore-attachments: true\n", registry, t.TempDir())), 0o644)
+	require.NoError(t, err)
+	registriesConf := filepath.Join(configDir, "registries.conf")
+	err = os.WriteFile(registriesConf, []byte{}, 0o644)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		RegistriesDirPath:           registriesDir,
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+	ref, err := ParseReference("//" + registry + "/cosign-signed-single-sample@" + manifestDigest.String())
+	require.NoError(t, err)
+	publicSrc, err := ref.NewImageSource(context.Background(), sys)
+	require.NoError(t, err)
+	defer publicSrc.Close()
+	src, ok := publicSrc.(*dockerImageSource)
+	require.True(t, ok)
+
+	// Every layer is returned as a separate signature, with its own annotations.
+	sigs, err := src.GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, expectedSigs, sigs)
+
+	// … so that policy evaluation can consider all of them.
+	// The signatures claim a different identity than the test server.
+	exactRepo, err := policy.NewPRMExactRepository("192.168.64.2:5000/cosign-signed-single-sample")
+	require.NoError(t, err)
+	pr, err := policy.NewPRSigstoreSigned(
+		policy.PRSigstoreSignedWithKeyPaths([]string{"../signature/fixtures/cosign.pub", "../signature/fixtures/cosign3.pub"}),
+		policy.PRSigstoreSignedWithMinimumSignatures(2),
+		policy.PRSigstoreSignedWithSignedIdentity(exactRepo),
+	)
+	require.NoError(t, err)
+	policyContext, err := policy.NewPolicyContext(&policy.Policy{Default: policy.PolicyRequirements{pr}})
+	require.NoError(t, err)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+	allowed, err := policyContext.IsRunningImageAllowed(context.Background(), image.UnparsedInstance(src, nil))
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func TestDockerImageSourceSigstoreReferrers(t *testing.T) {
+	const fixtureDir = "../signature/fixtures/dir-img-cosign-multiple-keys"
+	const repo = "cosign-signed-single-sample"
+	manifestBlob, err := os.ReadFile(filepath.Join(fixtureDir, "manifest.json"))
+	require.NoError(t, err)
+	manifestDigest, err := manifest.Digest(manifestBlob)
+	require.NoError(t, err)
+	var fixtureSigs []signature.Sigstore
+	for i := 1; i <= 3; i++ {
+		sigBlob, err := os.ReadFile(filepath.Join(fixtureDir, fmt.Sprintf("signature-%d", i)))
+		require.NoError(t, err)
+		sig, err := signature.FromBlob(sigBlob)
+		require.NoError(t, err)
+		sigstoreSig, ok := sig.(signature.Sigstore)
+		require.True(t, ok)
+		fixtureSigs = append(fixtureSigs, sigstoreSig)
+	}
+
+	// newSource returns an image source for the fixture image in a new server using options,
+	// with the first two signatures available using the referrers API, and the third one using the tag convention.
+	newSource := func(t *testing.T, options *registrytest.Options, useReferrersAPI bool) (*registrytest.Server, *dockerImageSource) {
+		server := registrytest.NewServer(options)
+		t.Cleanup(server.Close)
+		server.PutManifest(repo, "", manifest.DockerV2Schema2MediaType, manifestBlob)
+		configDigest := server.PutBlob(repo, []byte("{}"))
+		putAttachmentManifest := func(tag, artifactType string, sigs []signature.Sigstore) {
+			configMediaType := "application/vnd.oci.image.config.v1+json"
+			if artifactType != "" {
+				configMediaType = artifactType // The referrers API uses the config media type if there is no artifactType field.
+			}
+			m := imgspecv1.Manifest{
+				Versioned: imgspecs.Versioned{SchemaVersion: 2},
+				MediaType: imgspecv1.MediaTypeImageManifest,
+				Config: imgspecv1.Descriptor{
+					MediaType: configMediaType,
+					Digest:    configDigest,
+					Size:      2,
+				},
+			}
+			if tag == "" {
+				m.Subject = &imgspecv1.Descriptor{
+					MediaType: manifest.DockerV2Schema2MediaType,
+					Digest:    manifestDigest,
+					Size:      int64(len(manifestBlob)),
+				}
+			}
+			for _, sig := range sigs {
+				payload := sig.UntrustedPayload()
+				m.Layers = append(m.Layers, imgspecv1.Descriptor{
+					MediaType:   sig.UntrustedMIMEType(),
+					Digest:      server.PutBlob(repo, payload),
+					Size:        int64(len(payload)),
+					Annotations: sig.UntrustedAnnotations(),
+				})
+			}
+			blob, err := json.Marshal(m)
+			require.NoError(t, err)
+			server.PutManifest(repo, tag, imgspecv1.MediaTypeImageManifest, blob)
+		}
+		putAttachmentManifest("", sigstoreSignatureArtifactType, fixtureSigs[0:1])
+		putAttachmentManifest("", sigstoreSignatureArtifactType, fixtureSigs[1:2])
+		putAttachmentManifest("", "application/spdx+json", fixtureSigs[2:3]) // Not a signature, must be ignored
+		putAttachmentManifest(sigstoreAttachmentTag(manifestDigest), "", fixtureSigs[2:3])
+
+		sys := registrytestSystemContext(t, server, fmt.Sprintf("use-referrers-api: %v", useReferrersAPI))
+		ref, err := ParseReference("//" + server.Host() + "/" + repo + "@" + manifestDigest.String())
+		require.NoError(t, err)
+		publicSrc, err := ref.NewImageSource(context.Background(), sys)
+		require.NoError(t, err)
+		t.Cleanup(func() { publicSrc.Close() })
+		src, ok := publicSrc.(*dockerImageSource)
+		require.True(t, ok)
+		return server, src
+	}
+	tagConventionUsed := func(server *registrytest.Server) bool {
+		for _, r := range server.Requests() {
+			if strings.HasSuffix(r.Path, "/manifests/"+sigstoreAttachmentTag(manifestDigest)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// The registry supports the referrers API
+	server, src := newSource(t, nil, true)
+	sigs, err := src.GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []signature.Signature{fixtureSigs[0], fixtureSigs[1]}, sigs) // The order of referrers is unspecified
+	assert.False(t, tagConventionUsed(server))
+
+	// The registry does not support the referrers API
+	server, src = newSource(t, &registrytest.Options{DisableReferrersAPI: true}, true)
+	sigs, err = src.GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []signature.Signature{fixtureSigs[2]}, sigs)
+	assert.True(t, tagConventionUsed(server))
+
+	// The referrers API is not used unless enabled
+	server, src = newSource(t, nil, false)
+	sigs, err = src.GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []signature.Signature{fixtureSigs[2]}, sigs)
+	for _, r := range server.Requests() {
+		assert.NotContains(t, r.Path, "/referrers/")
+	}
+
+	// Failures of the referrers API, other than 404, are reported
+	server, src = newSource(t, nil, true)
+	server.SetFaultInjector(registrytest.InjectFirst(1, registrytest.MatchRequest(http.MethodGet, "/referrers/"),
+		registrytest.Fault{StatusCode: http.StatusInternalServerError}))
+	_, err = src.GetSignaturesWithFormat(context.Background(), nil)
+	assert.Error(t, err)
+}
+
+func TestDockerImageSourceGetReferrers(t *testing.T) {
+	const repo = "repo"
+	const sbomArtifactType = "application/spdx+json"
+
+	// newSource returns an image source for a new server using options, with an image, an SBOM referring to the image,
+	// and a signature referring to the SBOM.
+	newSource := func(t *testing.T, options *registrytest.Options) (*registrytest.Server, *dockerImageSource, digest.Digest, digest.Digest, digest.Digest) {
+		server := registrytest.NewServer(options)
+		t.Cleanup(server.Close)
+		configDigest := server.PutBlob(repo, []byte("{}"))
+		putManifest := func(artifactType string, annotations map[string]string, subject digest.Digest) digest.Digest {
+			m := imgspecv1.Manifest{
+				Versioned: imgspecs.Versioned{SchemaVersion: 2},
+				MediaType: imgspecv1.MediaTypeImageManifest,
+				Config: imgspecv1.Descriptor{
+					MediaType: "application/vnd.oci.image.config.v1+json",
+					Digest:    configDigest,
+					Size:      2,
+				},
+				Annotations: annotations,
+			}
+			if artifactType != "" {
+				m.Config.MediaType = artifactType // The referrers API uses the config media type if there is no artifactType field.
+			}
+			if subject != "" {
+				m.Subject = &imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, Digest: subject, Size: 1}
+			}
+			blob, err := json.Marshal(m)
+			require.NoError(t, err)
+			return server.PutManifest(repo, "", imgspecv1.MediaTypeImageManifest, blob)
+		}
+		imageDigest := putManifest("", nil, "")
+		sbomDigest := putManifest(sbomArtifactType, map[string]string{"org.example.sbom": "yes"}, imageDigest)
+		sigDigest := putManifest(sigstoreSignatureArtifactType, nil, sbomDigest)
+
+		sys := registrytestSystemContext(t, server, "")
+		ref, err := ParseReference("//" + server.Host() + "/" + repo + "@" + imageDigest.String())
+		require.NoError(t, err)
+		publicSrc, err := ref.NewImageSource(context.Background(), sys)
+		require.NoError(t, err)
+		t.Cleanup(func() { publicSrc.Close() })
+		src, ok := publicSrc.(*dockerImageSource)
+		require.True(t, ok)
+		return server, src, imageDigest, sbomDigest, sigDigest
+	}
+
+	server, src, imageDigest, sbomDigest, sigDigest := newSource(t, nil)
+	// All referrers, including artifact types and annotations
+	referrers, supported, err := src.GetReferrers(context.Background(), imageDigest, "")
+	require.NoError(t, err)
+	assert.True(t, supported)
+	require.Len(t, referrers, 1)
+	assert.Equal(t, sbomDigest, referrers[0].Digest)
+	assert.Equal(t, sbomArtifactType, referrers[0].ArtifactType)
+	assert.Equal(t, map[string]string{"org.example.sbom": "yes"}, referrers[0].Annotations)
+	for _, r := range server.Requests() {
+		if strings.Contains(r.Path, "/referrers/") {
+			assert.Empty(t, r.Query)
+		}
+	}
+	// Referrers of a referrer
+	referrers, supported, err = src.GetReferrers(context.Background(), sbomDigest, "")
+	require.NoError(t, err)
+	assert.True(t, supported)
+	require.Len(t, referrers, 1)
+	assert.Equal(t, sigDigest, referrers[0].Digest)
+	// Filtering by artifact type
+	referrers, supported, err = src.GetReferrers(context.Background(), imageDigest, sigstoreSignatureArtifactType)
+	require.NoError(t, err)
+	assert.True(t, supported)
+	assert.Empty(t, referrers)
+
+	// The registry does not support the referrers API
+	_, src, imageDigest, _, _ = newSource(t, &registrytest.Options{DisableReferrersAPI: true})
+	_, supported, err = src.GetReferrers(context.Background(), imageDigest, "")
+	require.NoError(t, err)
+	assert.False(t, supported)
+}
+
+func TestDockerImageSourceSigstoreReferrersPagination(t *testing.T) {
+	const fixtureDir = "../signature/fixtures/dir-img-cosign-multiple-keys"
+	const repo = "cosign-signed-single-sample"
+	manifestBlob, err := os.ReadFile(filepath.Join(fixtureDir, "manifest.json"))
+	require.NoError(t, err)
+	manifestDigest, err := manifest.Digest(manifestBlob)
+	require.NoError(t, err)
+	var fixtureSigs []signature.Sigstore
+	for i := 1; i <= 3; i++ {
+		sigBlob, err := os.ReadFile(filepath.Join(fixtureDir, fmt.Sprintf("signature-%d", i)))
+		require.NoError(t, err)
+		sig, err := signature.FromBlob(sigBlob)
+		require.NoError(t, err)
+		sigstoreSig, ok := sig.(signature.Sigstore)
+		require.True(t, ok)
+		fixtureSigs = append(fixtureSigs, sigstoreSig)
+	}
+
+	// Six referrers, returned in three pages
+	server := registrytest.NewServer(&registrytest.Options{ReferrersPageSize: 2})
+	defer server.Close()
+	server.PutManifest(repo, "", manifest.DockerV2Schema2MediaType, manifestBlob)
+	configDigest := server.PutBlob(repo, []byte("{}"))
+	expected := []signature.Signature{}
+	for _, sigs := range [][]signature.Sigstore{
+		fixtureSigs[0:1], fixtureSigs[1:2], fixtureSigs[2:3],
+		fixtureSigs[0:2], fixtureSigs[1:3], {fixtureSigs[0], fixtureSigs[2]},
+	} {
+		m := imgspecv1.Manifest{
+			Versioned: imgspecs.Versioned{SchemaVersion: 2},
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Config: imgspecv1.Descriptor{
+				MediaType: sigstoreSignatureArtifactType,
+				Digest:    configDigest,
+				Size:      2,
+			},
+			Subject: &imgspecv1.Descriptor{
+				MediaType: manifest.DockerV2Schema2MediaType,
+				Digest:    manifestDigest,
+				Size:      int64(len(manifestBlob)),
+			},
+		}
+		for _, sig := range sigs {
+			payload := sig.UntrustedPayload()
+			m.Layers = append(m.Layers, imgspecv1.Descriptor{
+				MediaType:   sig.UntrustedMIMEType(),
+				Digest:      server.PutBlob(repo, payload),
+				Size:        int64(len(payload)),
+				Annotations: sig.UntrustedAnnotations(),
+			})
+			expected = append(expected, sig)
+		}
+		blob, err := json.Marshal(m)
+		require.NoError(t, err)
+		server.PutManifest(repo, "", imgspecv1.MediaTypeImageManifest, blob)
+	}
+	newSource := func(t *testing.T, maxReferrers int) *dockerImageSource {
+		sys := registrytestSystemContext(t, server, "use-referrers-api: true")
+		sys.DockerMaxReferrers = maxReferrers
+		ref, err := ParseReference("//" + server.Host() + "/" + repo + "@" + manifestDigest.String())
+		require.NoError(t, err)
+		publicSrc, err := ref.NewImageSource(context.Background(), sys)
+		require.NoError(t, err)
+		t.Cleanup(func() { publicSrc.Close() })
+		src, ok := publicSrc.(*dockerImageSource)
+		require.True(t, ok)
+		return src
+	}
+	referrersRequests := func() int {
+		res := 0
+		for _, r := range server.Requests() {
+			if strings.Contains(r.Path, "/referrers/") {
+				res++
+			}
+		}
+		return res
+	}
+
+	// All pages are fetched
+	for _, maxReferrers := range []int{0, 6} {
+		requestsBefore := referrersRequests()
+		sigs, err := newSource(t, maxReferrers).GetSignaturesWithFormat(context.Background(), nil)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, expected, sigs)
+		assert.Equal(t, 3, referrersRequests()-requestsBefore)
+	}
+
+	// Too many referrers
+	_, err = newSource(t, 5).GetSignaturesWithFormat(context.Background(), nil)
+	assert.ErrorContains(t, err, "more than the maximum of 5 referrers")
+
+	// Cancellation while fetching the second page
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := newSource(t, 0)
+	server.SetFaultInjector(func(r *http.Request) *registrytest.Fault {
+		if strings.Contains(r.URL.Path, "/referrers/") && r.URL.Query().Get("last") != "" {
+			cancel()
+		}
+		return nil
+	})
+	_, err = src.GetSignaturesWithFormat(ctx, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	server.SetFaultInjector(nil)
+
+	// Invalid values
+	sys := registrytestSystemContext(t, server, "use-referrers-api: true")
+	sys.DockerMaxReferrers = -1
+	ref, err := ParseReference("//" + server.Host() + "/" + repo + "@" + manifestDigest.String())
+	require.NoError(t, err)
+	_, err = ref.NewImageSource(context.Background(), sys)
+	assert.Error(t, err)
+}
+
+// registrytestSystemContext returns a SystemContext for using server with sigstore attachments enabled,
+// and with extraNamespaceConfig, if not "", added to the registries.d configuration of the server.
+func registrytestSystemContext(t *testing.T, server *registrytest.Server, extraNamespaceConfig string) *types.SystemContext {
+	configDir := t.TempDir()
+	registriesDir := filepath.Join(configDir, "registries.d")
+	err := os.Mkdir(registriesDir, 0o755)
+	require.NoError(t, err)
+	namespaceConfig := fmt.Sprintf("docker:\n  %s:\n    lookaside: file://%s\n    use-sigstore-attachments: true\n",
+		server.Host(), t.TempDir())
+	if extraNamespaceConfig != "" {
+		namespaceConfig += "    " + extraNamespaceConfig + "\n"
+	}
+	err = os.WriteFile(filepath.Join(registriesDir, "registries.yaml"), []byte(namespaceConfig), 0o644)
+	require.NoError(t, err)
+	registriesConf := filepath.Join(configDir, "registries.conf")
+	err = os.WriteFile(registriesConf, []byte{}, 0o644)
+	require.NoError(t, err)
+	sys := server.SystemContext()
+	sys.RegistriesDirPath = registriesDir
+	sys.DockerPerHostCertDirPath = "/this/does/not/exist"
+	sys.SystemRegistriesConfPath = registriesConf
+	return sys
+}
+
+func TestDockerSignatureAttachmentTagFormat(t *testing.T) {
+	const repo = "cosign-signed-single-sample"
+	const format = "sha256-%s.cosign-signature"
+	sigBlob, err := os.ReadFile("../signature/fixtures/dir-img-cosign-valid/signature-1")
+	require.NoError(t, err)
+	sig, err := signature.FromBlob(sigBlob)
+	require.NoError(t, err)
+	manifestBlob, err := os.ReadFile("../signature/fixtures/dir-img-cosign-valid/manifest.json")
+	require.NoError(t, err)
+
+	server := registrytest.NewServer(nil)
+	defer server.Close()
+	manifestDigest := server.PutManifest(repo, "", manifest.DockerV2Schema2MediaType, manifestBlob)
+	sys := registrytestSystemContext(t, server, "")
+	sys.DockerSignatureAttachmentTagFormat = format
+	ref, err := ParseReference("//" + server.Host() + "/" + repo + "@" + manifestDigest.String())
+	require.NoError(t, err)
+
+	// Writing uses the format
+	publicDest, err := ref.NewImageDestination(context.Background(), sys)
+	require.NoError(t, err)
+	defer publicDest.Close()
+	dest, ok := publicDest.(*dockerImageDestination)
+	require.True(t, ok)
+	err = dest.PutSignaturesWithFormat(context.Background(), []signature.Signature{sig}, &manifestDigest)
+	require.NoError(t, err)
+	assert.Equal(t, []string{fmt.Sprintf(format, manifestDigest.Encoded())}, server.Tags(repo))
+
+	// Reading uses the format
+	publicSrc, err := ref.NewImageSource(context.Background(), sys)
+	require.NoError(t, err)
+	defer publicSrc.Close()
+	src, ok := publicSrc.(*dockerImageSource)
+	require.True(t, ok)
+	sigs, err := src.GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []signature.Signature{sig}, sigs)
+
+	// Without the format, the signature is not found
+	sys.DockerSignatureAttachmentTagFormat = ""
+	publicSrc2, err := ref.NewImageSource(context.Background(), sys)
+	require.NoError(t, err)
+	defer publicSrc2.Close()
+	src2, ok := publicSrc2.(*dockerImageSource)
+	require.True(t, ok)
+	sigs, err = src2.GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, sigs)
+
+	// An invalid format is rejected
+	sys.DockerSignatureAttachmentTagFormat = "%s-%s.sig"
+	_, err = ref.NewImageSource(context.Background(), sys)
+	assert.Error(t, err)
+	_, err = ref.NewImageDestination(context.Background(), sys)
+	assert.Error(t, err)
+}
+
+func TestDockerUseSigstoreAttachments(t *testing.T) {
+	const fixtureDir = "../signature/fixtures/dir-img-cosign-multiple-keys"
+	const repo = "cosign-signed-single-sample"
+	manifestBlob, err := os.ReadFile(filepath.Join(fixtureDir, "manifest.json"))
+	require.NoError(t, err)
+	unsignedManifestBlob, err := os.ReadFile("../signature/fixtures/dir-img-unsigned/manifest.json")
+	require.NoError(t, err)
+
+	server := registrytest.NewServer(nil)
+	defer server.Close()
+	manifestDigest := server.PutManifest(repo, "", manifest.DockerV2Schema2MediaType, manifestBlob)
+	unsignedManifestDigest := server.PutManifest(repo, "", manifest.DockerV2Schema2MediaType, unsignedManifestBlob)
+	// All signatures are layers of a single attachment manifest, each with its own annotations.
+	attachmentManifest := imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config: imgspecv1.Descriptor{
+			MediaType: "application/vnd.oci.image.config.v1+json",
+			Digest:    server.PutBlob(repo, []byte("{}")),
+			Size:      2,
+		},
+	}
+	var expectedSigs []signature.Signature
+	for i := 1; i <= 3; i++ {
+		sigBlob, err := os.ReadFile(filepath.Join(fixtureDir, fmt.Sprintf("signature-%d", i)))
+		require.NoError(t, err)
+		sig, err := signature.FromBlob(sigBlob)
+		require.NoError(t, err)
+		sigstoreSig, ok := sig.(signature.Sigstore)
+		require.True(t, ok)
+		require.NotEmpty(t, sigstoreSig.UntrustedAnnotations())
+		payload := sigstoreSig.UntrustedPayload()
+		attachmentManifest.Layers = append(attachmentManifest.Layers, imgspecv1.Descriptor{
+			MediaType:   sigstoreSig.UntrustedMIMEType(),
+			Digest:      server.PutBlob(repo, payload),
+			Size:        int64(len(payload)),
+			Annotations: sigstoreSig.UntrustedAnnotations(),
+		})
+		expectedSigs = append(expectedSigs, sigstoreSig)
+	}
+	attachmentManifestBlob, err := json.Marshal(attachmentManifest)
+	require.NoError(t, err)
+	server.PutManifest(repo, sigstoreAttachmentTag(manifestDigest), imgspecv1.MediaTypeImageManifest, attachmentManifestBlob)
+
+	// Don’t enable sigstore attachments in registries.d.
+	configDir := t.TempDir()
+	registriesDir := filepath.Join(configDir, "registries.d")
+	err = os.Mkdir(registriesDir, 0o755)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(registriesDir, "registries.yaml"), []byte(fmt.Sprintf(
+		"docker:\n  %s:\n    lookaside: file://%s\n", server.Host(), t.TempDir())), 0o644)
+	require.NoError(t, err)
+	registriesConf := filepath.Join(configDir, "registries.conf")
+	err = os.WriteFile(registriesConf, []byte{}, 0o644)
+	require.NoError(t, err)
+	sys := server.SystemContext()
+	sys.RegistriesDirPath = registriesDir
+	sys.DockerPerHostCertDirPath = "/this/does/not/exist"
+	sys.SystemRegistriesConfPath = registriesConf
+
+	newSource := func(sys *types.SystemContext, manifestDigest digest.Digest) *dockerImageSource {
+		ref, err := ParseReference("//" + server.Host() + "/" + repo + "@" + manifestDigest.String())
+		require.NoError(t, err)
+		publicSrc, err := ref.NewImageSource(context.Background(), sys)
+		require.NoError(t, err)
+		t.Cleanup(func() { publicSrc.Close() })
+		src, ok := publicSrc.(*dockerImageSource)
+		require.True(t, ok)
+		return src
+	}
+
+	// Attachments are not used by default …
+	sigs, err := newSource(sys, manifestDigest).GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, sigs)
+	for _, r := range server.Requests() {
+		assert.NotContains(t, r.Path, "/manifests/"+sigstoreAttachmentTag(manifestDigest))
+	}
+
+	// … but they are if enabled in SystemContext; every layer is returned as a separate signature, with its annotations …
+	sys.DockerUseSigstoreAttachments = types.OptionalBoolTrue
+	src := newSource(sys, manifestDigest)
+	sigs, err = src.GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, expectedSigs, sigs)
+
+	// … so that policy evaluation can verify them.
+	// The signatures claim a different identity than the test server.
+	exactRepo, err := policy.NewPRMExactRepository("192.168.64.2:5000/cosign-signed-single-sample")
+	require.NoError(t, err)
+	pr, err := policy.NewPRSigstoreSigned(
+		policy.PRSigstoreSignedWithKeyPaths([]string{"../signature/fixtures/cosign.pub", "../signature/fixtures/cosign3.pub"}),
+		policy.PRSigstoreSignedWithMinimumSignatures(2),
+		policy.PRSigstoreSignedWithSignedIdentity(exactRepo),
+	)
+	require.NoError(t, err)
+	policyContext, err := policy.NewPolicyContext(&policy.Policy{Default: policy.PolicyRequirements{pr}})
+	require.NoError(t, err)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+	allowed, err := policyContext.IsRunningImageAllowed(context.Background(), image.UnparsedInstance(src, nil))
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	// A missing attachment tag means there are no signatures
+	sigs, err = newSource(sys, unsignedManifestDigest).GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, sigs)
+	allowed, err = policyContext.IsRunningImageAllowed(context.Background(), image.UnparsedInstance(newSource(sys, unsignedManifestDigest), nil))
+	assert.Error(t, err)
+	assert.False(t, allowed)
+
+	// The SystemContext option also overrides registries.d enabling attachments
+	sys = registrytestSystemContext(t, server, "")
+	sys.DockerUseSigstoreAttachments = types.OptionalBoolFalse
+	sigs, err = newSource(sys, manifestDigest).GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, sigs)
+}
+
+// fixedSignaturesImageSource is a private.ImageSource which returns sigs for all GetSignaturesWithFormat calls.
+type fixedSignaturesImageSource struct {
+	private.ImageSource
+	sigs []signature.Signature
+}
+
+func (f fixedSignaturesImageSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error) {
+	return f.sigs, nil
+}
+
+func TestDockerSignatureCanonicalOrder(t *testing.T) {
+	const repo = "cosign-signed-single-sample"
+	manifestBlob, err := os.ReadFile("../signature/fixtures/dir-img-cosign-valid/manifest.json")
+	require.NoError(t, err)
+	simpleSig, err := os.ReadFile("../signature/fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+	sigs := []signature.Signature{
+		signature.SigstoreFromComponents(signature.SigstoreSignatureMIMEType, []byte("payload 1"), map[string]string{"a": "1"}),
+		signature.SimpleSigningFromBlob(simpleSig),
+		signature.SigstoreFromComponents(signature.SigstoreSignatureMIMEType, []byte("payload 2"), map[string]string{"a": "2"}),
+	}
+	reversed := []signature.Signature{sigs[2], sigs[1], sigs[0]}
+
+	// untrustedSignatures returns the signatures of the image in src, and their transport-specific indices.
+	untrustedSignatures := func(src types.ImageSource) ([]signature.Signature, []int) {
+		img := image.UnparsedInstance(src, nil)
+		res, err := img.UntrustedSignatures(context.Background())
+		require.NoError(t, err)
+		indices, err := img.UntrustedSignatureSourceIndices(context.Background())
+		require.NoError(t, err)
+		return res, indices
+	}
+
+	// dir:, with the signatures in the original order
+	dirRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	dirDest, err := dirRef.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dirDest.Close()
+	err = dirDest.PutManifest(context.Background(), manifestBlob, nil)
+	require.NoError(t, err)
+	err = imagedestination.FromPublic(dirDest).PutSignaturesWithFormat(context.Background(), sigs, nil)
+	require.NoError(t, err)
+	dirSrc, err := dirRef.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer dirSrc.Close()
+	dirSigs, dirIndices := untrustedSignatures(dirSrc)
+
+	// docker:, with the signatures in the reverse order; the simple signing signature goes to the lookaside,
+	// the others to a sigstore attachment, so the transport also reorders them on its own.
+	server := registrytest.NewServer(nil)
+	defer server.Close()
+	manifestDigest := server.PutManifest(repo, "", manifest.DockerV2Schema2MediaType, manifestBlob)
+	sys := registrytestSystemContext(t, server, "")
+	dockerRef, err := ParseReference("//" + server.Host() + "/" + repo + "@" + manifestDigest.String())
+	require.NoError(t, err)
+	dockerDest, err := dockerRef.NewImageDestination(context.Background(), sys)
+	require.NoError(t, err)
+	defer dockerDest.Close()
+	for _, sig := range reversed { // One at a time, so that the lookaside and the attachment don’t get each other’s signatures.
+		err = imagedestination.FromPublic(dockerDest).PutSignaturesWithFormat(context.Background(), []signature.Signature{sig}, &manifestDigest)
+		require.NoError(t, err)
+	}
+	dockerSrc, err := dockerRef.NewImageSource(context.Background(), sys)
+	require.NoError(t, err)
+	defer dockerSrc.Close()
+	rawDockerSigs, err := imagesource.FromPublic(dockerSrc).GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, rawDockerSigs, len(sigs))
+	dockerSigs, dockerIndices := untrustedSignatures(dockerSrc)
+
+	// A source with the signatures in yet another order
+	mockSigs := []signature.Signature{sigs[1], sigs[2], sigs[0]}
+	mockSigsResult, mockIndices := untrustedSignatures(fixedSignaturesImageSource{
+		ImageSource: imagesource.FromPublic(dirSrc),
+		sigs:        mockSigs,
+	})
+
+	for _, c := range []struct {
+		name    string
+		raw     []signature.Signature
+		ordered []signature.Signature
+		indices []int
+	}{
+		{"dir", sigs, dirSigs, dirIndices},
+		{"docker", rawDockerSigs, dockerSigs, dockerIndices},
+		{"mock", mockSigs, mockSigsResult, mockIndices},
+	} {
+		assert.Equal(t, dirSigs, c.ordered, c.name)
+		require.Len(t, c.indices, len(c.raw), c.name)
+		for i, index := range c.indices {
+			assert.Equal(t, c.raw[index], c.ordered[i], c.name)
+		}
+	}
+}
+
 func TestSimplifyContentType(t *testing.T) {
 	for _, c := range []struct{ input, expected string }{
 		{"", ""},
@@ -10,6 +10,7 @@ import (
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
+	"github.com/containers/storage/pkg/regexp"
 )
 
 func init() {
@@ -38,6 +39,33 @@ func (t dockerTransport) ValidatePolicyConfigurationScope(scope string) error {
 	// FIXME? We could be verifying the various character set and length restrictions
 	// from docker/distribution/reference.regexp.go, but other than that there
 	// are few semantically invalid strings.
+	if strings.Contains(scope, "*") {
+		return validateWildcardScope(scope)
+	}
+	return nil
+}
+
+// wildcardScopeDomainRegexp matches the part of a wildcard scope following the leading "*.".
+var wildcardScopeDomainRegexp = regexp.Delayed("^" + reference.DomainRegexp.String() + "$")
+
+// validateWildcardScope returns an error if scope, which contains a "*", is not a valid wildcard scope
+// matching all subdomains, as returned by policyconfiguration.DockerReferenceNamespaces.
+func validateWildcardScope(scope string) error {
+	if !strings.HasPrefix(scope, "*.") {
+		return fmt.Errorf("invalid scope %q: a wildcard is only allowed as the leftmost component of a host name, e.g. *.example.com", scope)
+	}
+	domain := strings.TrimPrefix(scope, "*.")
+	switch {
+	case strings.Contains(domain, "*"):
+		return fmt.Errorf("invalid scope %q: a wildcard may only be used once, as the leftmost component of a host name", scope)
+	case strings.Contains(domain, "/"):
+		return fmt.Errorf("invalid scope %q: a wildcard scope can only match a host name, not a repository or namespace", scope)
+	case strings.Contains(domain, ":"):
+		// policyconfiguration.DockerReferenceNamespaces ignores port numbers when matching wildcard scopes.
+		return fmt.Errorf("invalid scope %q: a wildcard scope can not contain a port number", scope)
+	case !wildcardScopeDomainRegexp.MatchString(domain):
+		return fmt.Errorf("invalid scope %q: %q is not a valid host name", scope, domain)
+	}
 	return nil
 }
 
@@ -147,7 +175,7 @@ func (ref dockerReference) NewImageSource(ctx context.Context, sys *types.System
 // NewImageDestination returns a types.ImageDestination for this reference.
 // The caller must call .Close() on the returned ImageDestination.
 func (ref dockerReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
-	return newImageDestination(sys, ref)
+	return newImageDestination(ctx, sys, ref)
 }
 
 // DeleteImage deletes the named image from the registry, if supported.
@@ -31,10 +31,27 @@ func TestTransportValidatePolicyConfigurationScope(t *testing.T) {
 		"docker.io/library",
 		"docker.io",
 		"*.io",
+		"*.registry.example.com",
 	} {
 		err := Transport.ValidatePolicyConfigurationScope(scope)
 		assert.NoError(t, err, scope)
 	}
+
+	for _, scope := range []string{
+		"*",
+		"*example.com",
+		"eu.*.example.com",
+		"registry.*",
+		"*.*.example.com",
+		"*.registry.example.com:5000",
+		"*.registry.example.com/ns",
+		"registry.example.com/*/repo",
+		"*.",
+		"*.-invalid.com",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.Error(t, err, scope)
+	}
 }
 
 func TestParseReference(t *testing.T) {
@@ -8,12 +8,20 @@ import (
 	"io"
 	"os"
 	"path"
+	"regexp"
+	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/set"
 	"github.com/containers/image/v5/internal/tmpdir"
+	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 // Reader is a ((docker save)-formatted) tar archive that allows random access to any component.
@@ -23,6 +31,9 @@ type Reader struct {
 	path          string         // "" if the archive has already been closed.
 	removeOnClose bool           // Remove file on close if true
 	Manifest      []ManifestItem // Guaranteed to exist after the archive is created.
+	// synthesizedComponents contains components which do not exist in the archive, but are referenced by Manifest,
+	// i.e. configs synthesized for images in the legacy format. Indexed by path; nil if there are no such components.
+	synthesizedComponents map[string][]byte
 }
 
 // NewReaderFromFile returns a Reader for the specified path.
@@ -111,19 +122,383 @@ func newReader(path string, removeOnClose bool) (*Reader, error) {
 	// removes the need to synchronize the access/creation of the data if the archive is later
 	// used from multiple goroutines to access different images.
 
-	// FIXME? Do we need to deal with the legacy format?
 	bytes, err := r.readTarComponent(manifestFileName, iolimits.MaxTarFileManifestSize)
-	if err != nil {
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(bytes, &r.Manifest); err != nil {
+			return nil, fmt.Errorf("decoding tar manifest.json: %w", err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		// Newer versions of (docker save) may produce only an OCI layout; if manifest.json is missing, read that instead.
+		if _, layoutErr := r.readTarComponent(ociLayoutFileName, iolimits.MaxTarFileManifestSize); layoutErr == nil {
+			items, err := r.manifestItemsFromOCILayout()
+			if err != nil {
+				return nil, err
+			}
+			r.Manifest = items
+			break
+		}
+		// Very old versions of (docker save) produce only the legacy format, with one directory per layer.
+		items, configs, legacyErr := r.manifestItemsFromLegacyLayout()
+		if legacyErr != nil {
+			return nil, legacyErr
+		}
+		if items == nil {
+			return nil, err // Report the missing manifest.json, not the missing oci-layout or legacy layers
+		}
+		r.Manifest = items
+		r.synthesizedComponents = configs
+	default:
 		return nil, err
 	}
-	if err := json.Unmarshal(bytes, &r.Manifest); err != nil {
-		return nil, fmt.Errorf("decoding tar manifest.json: %w", err)
-	}
 
 	succeeded = true
 	return &r, nil
 }
 
+// manifestItemsFromOCILayout synthesizes the equivalent of manifest.json from an OCI layout
+// (oci-layout, index.json and blobs/) stored in the archive.
+func (r *Reader) manifestItemsFromOCILayout() ([]ManifestItem, error) {
+	indexBytes, err := r.readTarComponent(ociIndexFileName, iolimits.MaxTarFileManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	var index imgspecv1.Index
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return nil, fmt.Errorf("decoding tar %s: %w", ociIndexFileName, err)
+	}
+
+	items := []ManifestItem{}
+	for i, desc := range index.Manifests {
+		item, err := r.manifestItemFromOCIDescriptor(desc)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s item @%d: %w", ociIndexFileName, i, err)
+		}
+		for _, annotation := range []string{ociContainerdImageNameAnnotation, imgspecv1.AnnotationRefName} {
+			name, ok := desc.Annotations[annotation]
+			if !ok {
+				continue
+			}
+			// org.opencontainers.image.ref.name is frequently only a tag, not a full reference; ignore such values.
+			if ref, err := reference.ParseNormalizedNamed(name); err == nil {
+				if tagged, ok := ref.(reference.NamedTagged); ok && !slices.Contains(item.RepoTags, tagged.String()) {
+					item.RepoTags = append(item.RepoTags, tagged.String())
+				}
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// manifestItemFromOCIDescriptor returns a ManifestItem for a manifest referenced by desc in an OCI layout in the archive.
+// If desc refers to a manifest list, the instance matching the current platform is used.
+func (r *Reader) manifestItemFromOCIDescriptor(desc imgspecv1.Descriptor) (ManifestItem, error) {
+	manifestBlob, err := r.readOCIBlob(desc.Digest, iolimits.MaxManifestBodySize)
+	if err != nil {
+		return ManifestItem{}, err
+	}
+	mimeType := desc.MediaType
+	if mimeType == "" {
+		mimeType = manifest.GuessMIMEType(manifestBlob)
+	}
+	if manifest.MIMETypeIsMultiImage(mimeType) {
+		list, err := manifest.ListFromBlob(manifestBlob, mimeType)
+		if err != nil {
+			return ManifestItem{}, err
+		}
+		instanceDigest, err := list.ChooseInstance(nil)
+		if err != nil {
+			return ManifestItem{}, err
+		}
+		instance, err := list.Instance(instanceDigest)
+		if err != nil {
+			return ManifestItem{}, err
+		}
+		// Note that this intentionally does not recurse further; nested manifest lists are not valid.
+		manifestBlob, err = r.readOCIBlob(instanceDigest, iolimits.MaxManifestBodySize)
+		if err != nil {
+			return ManifestItem{}, err
+		}
+		mimeType = instance.MediaType
+		if mimeType == "" {
+			mimeType = manifest.GuessMIMEType(manifestBlob)
+		}
+		if manifest.MIMETypeIsMultiImage(mimeType) {
+			return ManifestItem{}, fmt.Errorf("manifest list %s refers to another manifest list %s", desc.Digest, instanceDigest)
+		}
+	}
+	m, err := manifest.FromBlob(manifestBlob, mimeType)
+	if err != nil {
+		return ManifestItem{}, err
+	}
+
+	configPath, err := ociBlobPath(m.ConfigInfo().Digest)
+	if err != nil {
+		return ManifestItem{}, err
+	}
+	item := ManifestItem{
+		Config:   configPath,
+		RepoTags: []string{},
+		Layers:   []string{},
+	}
+	for _, layer := range m.LayerInfos() {
+		layerPath, err := ociBlobPath(layer.Digest)
+		if err != nil {
+			return ManifestItem{}, err
+		}
+		item.Layers = append(item.Layers, layerPath)
+	}
+	return item, nil
+}
+
+// readOCIBlob returns full contents of a blob in an OCI layout in the archive, up to limit bytes.
+func (r *Reader) readOCIBlob(d digest.Digest, limit int) ([]byte, error) {
+	blobPath, err := ociBlobPath(d)
+	if err != nil {
+		return nil, err
+	}
+	return r.readTarComponent(blobPath, limit)
+}
+
+// ociBlobPath returns a path of the blob with digest d in an OCI layout in the archive.
+func ociBlobPath(d digest.Digest) (string, error) {
+	if err := d.Validate(); err != nil {
+		return "", fmt.Errorf("invalid blob digest %q: %w", d, err)
+	}
+	return path.Join(ociBlobsDirName, d.Algorithm().String(), d.Hex()), nil
+}
+
+// legacyLayer is a single layer ("image") of an archive in the legacy format.
+type legacyLayer struct {
+	config []byte // Contents of the per-layer json file
+	parent string // ID of the parent layer, or ""
+}
+
+// legacyLayerContents describes the layer.tar file of a single layer in the legacy format.
+type legacyLayerContents struct {
+	diffID digest.Digest
+	empty  bool // The layer tarball contains no files at all
+}
+
+// legacyLayerIDRegexp matches IDs of layers in the legacy format.
+var legacyLayerIDRegexp = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// manifestItemsFromLegacyLayout synthesizes the equivalent of manifest.json from the legacy format stored in the archive,
+// i.e. one directory per layer, containing the layer's json and layer.tar, and an optional top-level repositories file.
+// It returns the manifest items and the synthesized image configs they refer to, indexed by their paths;
+// or (nil, nil, nil) if the archive does not contain any layers in the legacy format.
+func (r *Reader) manifestItemsFromLegacyLayout() ([]ManifestItem, map[string][]byte, error) {
+	layers, err := r.readLegacyLayers()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(layers) == 0 {
+		return nil, nil, nil
+	}
+
+	// Images are identified by their top layers; start with tagged images, in the order of the repositories file…
+	topLayerIDs := []string{}
+	repoTags := map[string][]string{}
+	repositoriesBytes, err := r.readTarComponent(legacyRepositoriesFileName, iolimits.MaxTarFileManifestSize)
+	switch {
+	case err == nil:
+		var repositories map[string]map[string]string
+		if err := json.Unmarshal(repositoriesBytes, &repositories); err != nil {
+			return nil, nil, fmt.Errorf("decoding tar %s: %w", legacyRepositoriesFileName, err)
+		}
+		repos := maps.Keys(repositories)
+		slices.Sort(repos)
+		for _, repo := range repos {
+			named, err := reference.ParseNormalizedNamed(repo)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid repository %q in tar %s: %w", repo, legacyRepositoriesFileName, err)
+			}
+			tags := maps.Keys(repositories[repo])
+			slices.Sort(tags)
+			for _, tag := range tags {
+				tagged, err := reference.WithTag(named, tag)
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid tag %q of %s in tar %s: %w", tag, repo, legacyRepositoriesFileName, err)
+				}
+				id := repositories[repo][tag]
+				if _, ok := layers[id]; !ok {
+					return nil, nil, fmt.Errorf("%s in tar %s refers to a missing layer %q", tagged.String(), legacyRepositoriesFileName, id)
+				}
+				if _, ok := repoTags[id]; !ok {
+					topLayerIDs = append(topLayerIDs, id)
+				}
+				repoTags[id] = append(repoTags[id], tagged.String())
+			}
+		}
+	case errors.Is(err, os.ErrNotExist):
+		// (docker save) of an image ID does not create a repositories file.
+	default:
+		return nil, nil, err
+	}
+	// … followed by untagged images, i.e. any other layers which are not a parent of another layer.
+	parents := set.New[string]()
+	for _, l := range layers {
+		if l.parent != "" {
+			parents.Add(l.parent)
+		}
+	}
+	untaggedIDs := []string{}
+	for id := range layers {
+		if _, ok := repoTags[id]; !ok && !parents.Contains(id) {
+			untaggedIDs = append(untaggedIDs, id)
+		}
+	}
+	slices.Sort(untaggedIDs)
+	topLayerIDs = append(topLayerIDs, untaggedIDs...)
+	if len(topLayerIDs) == 0 { // This can only happen if the parent chains contain a loop.
+		return nil, nil, errors.New("no top-level layers found in the legacy format")
+	}
+
+	items := []ManifestItem{}
+	configs := map[string][]byte{}
+	layerContents := map[string]legacyLayerContents{} // A cache, layers are typically shared by several images.
+	for _, topLayerID := range topLayerIDs {
+		// The legacy json files are a (docker save) version of the schema1 v1Compatibility history entries,
+		// so represent the image as a schema1 manifest (with diffIDs instead of blob sums) and let it convert the config.
+		fsLayers := []manifest.Schema1FSLayers{}
+		history := []manifest.Schema1History{}
+		for id := topLayerID; id != ""; id = layers[id].parent {
+			if _, ok := layers[id]; !ok {
+				return nil, nil, fmt.Errorf("layer %s: parent layer %q is missing", topLayerID, id)
+			}
+			if len(history) == len(layers) {
+				return nil, nil, fmt.Errorf("layer %s: parent chain contains a loop", topLayerID)
+			}
+			contents, ok := layerContents[id]
+			if !ok {
+				contents, err = r.readLegacyLayerContents(id)
+				if err != nil {
+					return nil, nil, err
+				}
+				layerContents[id] = contents
+			}
+			fsLayers = append(fsLayers, manifest.Schema1FSLayers{BlobSum: contents.diffID})
+			history = append(history, manifest.Schema1History{V1Compatibility: string(layers[id].config)})
+		}
+		s1, err := manifest.Schema1FromComponents(nil, fsLayers, history, "")
+		if err != nil {
+			return nil, nil, fmt.Errorf("layer %s: %w", topLayerID, err)
+		}
+
+		item := ManifestItem{
+			RepoTags: repoTags[topLayerID],
+			Layers:   []string{},
+		}
+		if item.RepoTags == nil {
+			item.RepoTags = []string{}
+		}
+		diffIDs := []digest.Digest{}
+		for i := len(s1.ExtractedV1Compatibility) - 1; i >= 0; i-- {
+			compat := &s1.ExtractedV1Compatibility[i]
+			contents := layerContents[compat.ID]
+			// Layers without any files, e.g. created by ENV, are recorded only in history, as in current image formats.
+			compat.ThrowAway = contents.empty
+			if !contents.empty {
+				diffIDs = append(diffIDs, contents.diffID)
+				item.Layers = append(item.Layers, path.Join(compat.ID, legacyLayerFileName))
+			}
+		}
+		config, err := s1.ToSchema2Config(diffIDs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("layer %s: %w", topLayerID, err)
+		}
+		item.Config = digest.FromBytes(config).Hex() + ".json"
+		configs[item.Config] = config
+		items = append(items, item)
+	}
+	return items, configs, nil
+}
+
+// readLegacyLayers returns all layers in the legacy format in the archive, indexed by their IDs.
+func (r *Reader) readLegacyLayers() (map[string]legacyLayer, error) {
+	file, err := os.Open(r.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	layers := map[string]legacyLayer{}
+	t := tar.NewReader(file)
+	for {
+		h, err := t.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		dir, fileName := path.Split(path.Clean(h.Name))
+		id := strings.TrimSuffix(dir, "/")
+		if fileName != legacyConfigFileName || !legacyLayerIDRegexp.MatchString(id) {
+			continue
+		}
+		if !h.FileInfo().Mode().IsRegular() {
+			return nil, fmt.Errorf("Error reading tar archive component %s: not a regular file", h.Name)
+		}
+		config, err := iolimits.ReadAtMost(t, iolimits.MaxConfigBodySize)
+		if err != nil {
+			return nil, fmt.Errorf("reading tar component %s: %w", h.Name, err)
+		}
+		var compat manifest.Schema1V1Compatibility
+		if err := json.Unmarshal(config, &compat); err != nil {
+			return nil, fmt.Errorf("decoding tar component %s: %w", h.Name, err)
+		}
+		if compat.ID != id {
+			return nil, fmt.Errorf("tar component %s contains unexpected layer ID %q", h.Name, compat.ID)
+		}
+		layers[id] = legacyLayer{
+			config: config,
+			parent: compat.Parent,
+		}
+	}
+	return layers, nil
+}
+
+// readLegacyLayerContents reads the layer.tar file of the layer with the specified ID in the legacy format.
+func (r *Reader) readLegacyLayerContents(id string) (legacyLayerContents, error) {
+	layerPath := path.Join(id, legacyLayerFileName)
+	stream, err := r.openTarComponent(layerPath)
+	if err != nil {
+		return legacyLayerContents{}, fmt.Errorf("loading tar component %s: %w", layerPath, err)
+	}
+	defer stream.Close()
+	// Source.GetBlob always decompresses layers, so do the same here.
+	uncompressedStream, _, err := compression.AutoDecompress(stream)
+	if err != nil {
+		return legacyLayerContents{}, fmt.Errorf("auto-decompressing %s: %w", layerPath, err)
+	}
+	defer uncompressedStream.Close()
+
+	digester := digest.Canonical.Digester()
+	digestedStream := io.TeeReader(uncompressedStream, digester.Hash())
+	t := tar.NewReader(digestedStream)
+	empty := true
+	for {
+		_, err := t.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return legacyLayerContents{}, fmt.Errorf("reading %s: %w", layerPath, err)
+		}
+		empty = false
+	}
+	// Include any trailing padding in the digest.
+	if _, err := io.Copy(io.Discard, digestedStream); err != nil {
+		return legacyLayerContents{}, fmt.Errorf("reading %s: %w", layerPath, err)
+	}
+	return legacyLayerContents{
+		diffID: digester.Digest(),
+		empty:  empty,
+	}, nil
+}
+
 // Close removes resources associated with an initialized Reader, if any.
 func (r *Reader) Close() error {
 	path := r.path
@@ -260,6 +635,9 @@ func findTarComponent(inputFile io.Reader, componentPath string) (*tar.Reader, *
 // readTarComponent returns full contents of componentPath.
 // It is safe to call this method from multiple goroutines simultaneously.
 func (r *Reader) readTarComponent(path string, limit int) ([]byte, error) {
+	if contents, ok := r.synthesizedComponents[path]; ok {
+		return contents, nil
+	}
 	file, err := r.openTarComponent(path)
 	if err != nil {
 		return nil, fmt.Errorf("loading tar component %s: %w", path, err)
@@ -0,0 +1,342 @@
+package tarfile
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tarEntry is a single file to be stored by writeTestArchive.
+type tarEntry struct {
+	name     string
+	contents []byte
+}
+
+// writeTestArchive returns a tar archive containing entries.
+func writeTestArchive(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     e.name,
+			Mode:     0644,
+			Size:     int64(len(e.contents)),
+		})
+		require.NoError(t, err)
+		_, err = tw.Write(e.contents)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return &buf
+}
+
+// testArchiveImage returns a layer tarball and a config referring to it.
+func testArchiveImage(t *testing.T) ([]byte, []byte) {
+	layer := writeTestArchive(t, []tarEntry{{name: "hello.txt", contents: []byte("Hello, world!\n")}}).Bytes()
+	config, err := json.Marshal(imgspecv1.Image{
+		OS:           "linux",
+		Architecture: "amd64",
+		RootFS: imgspecv1.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{digest.FromBytes(layer)},
+		},
+	})
+	require.NoError(t, err)
+	return layer, config
+}
+
+func TestReaderOCILayout(t *testing.T) {
+	ctx := context.Background()
+	layer, config := testArchiveImage(t)
+
+	var gzippedLayerBuf bytes.Buffer
+	gzw := gzip.NewWriter(&gzippedLayerBuf)
+	_, err := gzw.Write(layer)
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+	gzippedLayer := gzippedLayerBuf.Bytes()
+
+	ociBlobEntry := func(contents []byte) tarEntry {
+		d := digest.FromBytes(contents)
+		return tarEntry{name: path.Join("blobs", d.Algorithm().String(), d.Hex()), contents: contents}
+	}
+	ociManifest, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config: imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageConfig,
+			Digest:    digest.FromBytes(config),
+			Size:      int64(len(config)),
+		},
+		Layers: []imgspecv1.Descriptor{{
+			MediaType: imgspecv1.MediaTypeImageLayerGzip,
+			Digest:    digest.FromBytes(gzippedLayer),
+			Size:      int64(len(gzippedLayer)),
+		}},
+	})
+	require.NoError(t, err)
+	ociIndex, err := json.Marshal(imgspecv1.Index{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Digest:    digest.FromBytes(ociManifest),
+			Size:      int64(len(ociManifest)),
+			Annotations: map[string]string{
+				ociContainerdImageNameAnnotation: "docker.io/library/busybox:latest",
+				imgspecv1.AnnotationRefName:      "latest",
+			},
+		}},
+	})
+	require.NoError(t, err)
+	ociLayout := []byte(`{"imageLayoutVersion": "1.0.0"}`)
+
+	legacyManifest, err := json.Marshal([]ManifestItem{{
+		Config:   "config.json",
+		RepoTags: []string{"docker.io/library/busybox:latest"},
+		Layers:   []string{"layer.tar"},
+	}})
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{
+			name: "legacy",
+			entries: []tarEntry{
+				{name: "config.json", contents: config},
+				{name: "layer.tar", contents: layer},
+				{name: manifestFileName, contents: legacyManifest},
+			},
+		},
+		{
+			name: "OCI layout",
+			entries: []tarEntry{
+				ociBlobEntry(config),
+				ociBlobEntry(gzippedLayer),
+				ociBlobEntry(ociManifest),
+				{name: ociIndexFileName, contents: ociIndex},
+				{name: ociLayoutFileName, contents: ociLayout},
+			},
+		},
+	} {
+		reader, err := NewReaderFromStream(nil, writeTestArchive(t, c.entries))
+		require.NoError(t, err, c.name)
+		defer reader.Close()
+		require.Len(t, reader.Manifest, 1, c.name)
+		assert.Equal(t, []string{"docker.io/library/busybox:latest"}, reader.Manifest[0].RepoTags, c.name)
+
+		ref, err := reference.ParseNormalizedNamed("busybox:latest")
+		require.NoError(t, err)
+		src := NewSource(reader, false, "transport name", ref.(reference.NamedTagged), -1)
+		defer src.Close()
+
+		manifestBlob, _, err := src.GetManifest(ctx, nil)
+		require.NoError(t, err, c.name)
+		assert.JSONEq(t, fmt.Sprintf(`{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.v2+json",`+
+			`"config": {"mediaType": "application/vnd.docker.container.image.v1+json", "size": %d, "digest": "%s"},`+
+			`"layers": [{"mediaType": "application/vnd.docker.image.rootfs.diff.tar.gzip", "size": %d, "digest": "%s"}]}`,
+			len(config), digest.FromBytes(config), len(layer), digest.FromBytes(layer)), string(manifestBlob), c.name)
+
+		cache := memory.New()
+		configStream, _, err := src.GetBlob(ctx, types.BlobInfo{Digest: digest.FromBytes(config), Size: -1}, cache)
+		require.NoError(t, err, c.name)
+		configContents, err := io.ReadAll(configStream)
+		require.NoError(t, err, c.name)
+		configStream.Close()
+		assert.Equal(t, config, configContents, c.name)
+
+		layerStream, size, err := src.GetBlob(ctx, types.BlobInfo{Digest: digest.FromBytes(layer), Size: -1}, cache)
+		require.NoError(t, err, c.name)
+		layerContents, err := io.ReadAll(layerStream)
+		require.NoError(t, err, c.name)
+		layerStream.Close()
+		assert.Equal(t, int64(len(layer)), size, c.name)
+		assert.Equal(t, layer, layerContents, c.name)
+	}
+
+	// Neither manifest.json nor an OCI layout
+	_, err = NewReaderFromStream(nil, writeTestArchive(t, []tarEntry{{name: "config.json", contents: config}}))
+	assert.ErrorContains(t, err, manifestFileName)
+
+	// An OCI layout referring to a missing manifest
+	_, err = NewReaderFromStream(nil, writeTestArchive(t, []tarEntry{
+		{name: ociIndexFileName, contents: ociIndex},
+		{name: ociLayoutFileName, contents: ociLayout},
+	}))
+	assert.ErrorContains(t, err, digest.FromBytes(ociManifest).Hex())
+}
+
+func TestReaderLegacyLayout(t *testing.T) {
+	ctx := context.Background()
+	baseLayer := writeTestArchive(t, []tarEntry{{name: "hello.txt", contents: []byte("Hello, world!\n")}}).Bytes()
+	emptyLayer := writeTestArchive(t, nil).Bytes()
+	topLayer := writeTestArchive(t, []tarEntry{{name: "goodbye.txt", contents: []byte("Goodbye, world!\n")}}).Bytes()
+	var gzippedTopLayerBuf bytes.Buffer
+	gzw := gzip.NewWriter(&gzippedTopLayerBuf)
+	_, err := gzw.Write(topLayer)
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+
+	baseID := strings.Repeat("a", 64)
+	envID := strings.Repeat("b", 64)
+	topID := strings.Repeat("c", 64)
+	otherID := strings.Repeat("d", 64)
+	// legacyLayerEntries returns entries for a single legacy layer.
+	legacyLayerEntries := func(id, parent, createdBy string, layer []byte) []tarEntry {
+		layerConfig := map[string]any{
+			"id":               id,
+			"created":          "2015-01-01T00:00:00Z",
+			"container_config": map[string]any{"Cmd": []string{"/bin/sh", "-c", createdBy}},
+			"os":               "linux",
+			"architecture":     "amd64",
+			"Size":             len(layer),
+		}
+		if parent != "" {
+			layerConfig["parent"] = parent
+		}
+		if id == topID {
+			layerConfig["config"] = map[string]any{"Env": []string{"GREETING=hello"}}
+		}
+		configBytes, err := json.Marshal(layerConfig)
+		require.NoError(t, err)
+		return []tarEntry{
+			{name: path.Join(id, legacyVersionFileName), contents: []byte("1.0")},
+			{name: path.Join(id, legacyConfigFileName), contents: configBytes},
+			{name: path.Join(id, legacyLayerFileName), contents: layer},
+		}
+	}
+	entries := []tarEntry{}
+	entries = append(entries, legacyLayerEntries(baseID, "", "#(nop) ADD hello.txt", baseLayer)...)
+	entries = append(entries, legacyLayerEntries(envID, baseID, "#(nop) ENV GREETING=hello", emptyLayer)...)
+	entries = append(entries, legacyLayerEntries(topID, envID, "#(nop) ADD goodbye.txt", gzippedTopLayerBuf.Bytes())...)
+	entries = append(entries, legacyLayerEntries(otherID, baseID, "#(nop) LABEL foo=bar", []byte{})...)
+	repositories, err := json.Marshal(map[string]map[string]string{
+		"busybox": {"latest": topID, "1.0": topID},
+	})
+	require.NoError(t, err)
+	entries = append(entries, tarEntry{name: legacyRepositoriesFileName, contents: repositories})
+
+	reader, err := NewReaderFromStream(nil, writeTestArchive(t, entries))
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Len(t, reader.Manifest, 2)
+	// The tagged image first, then the untagged one; layers without any files are omitted.
+	assert.Equal(t, []string{"docker.io/library/busybox:1.0", "docker.io/library/busybox:latest"}, reader.Manifest[0].RepoTags)
+	assert.Equal(t, []string{path.Join(baseID, legacyLayerFileName), path.Join(topID, legacyLayerFileName)}, reader.Manifest[0].Layers)
+	assert.Equal(t, []string{}, reader.Manifest[1].RepoTags)
+	assert.Equal(t, []string{path.Join(baseID, legacyLayerFileName)}, reader.Manifest[1].Layers)
+
+	ref, err := reference.ParseNormalizedNamed("busybox:latest")
+	require.NoError(t, err)
+	src := NewSource(reader, false, "transport name", ref.(reference.NamedTagged), -1)
+	defer src.Close()
+	manifestBlob, _, err := src.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	m, err := manifest.Schema2FromManifest(manifestBlob)
+	require.NoError(t, err)
+	require.Len(t, m.LayersDescriptors, 2)
+	assert.Equal(t, digest.FromBytes(baseLayer), m.LayersDescriptors[0].Digest)
+	assert.Equal(t, digest.FromBytes(topLayer), m.LayersDescriptors[1].Digest)
+
+	cache := memory.New()
+	configStream, _, err := src.GetBlob(ctx, types.BlobInfo{Digest: m.ConfigDescriptor.Digest, Size: -1}, cache)
+	require.NoError(t, err)
+	configBytes, err := io.ReadAll(configStream)
+	require.NoError(t, err)
+	configStream.Close()
+	var config manifest.Schema2Image
+	err = json.Unmarshal(configBytes, &config)
+	require.NoError(t, err)
+	require.NotNil(t, config.RootFS)
+	assert.Equal(t, []digest.Digest{digest.FromBytes(baseLayer), digest.FromBytes(topLayer)}, config.RootFS.DiffIDs)
+	assert.Equal(t, "linux", config.OS)
+	assert.Equal(t, "amd64", config.Architecture)
+	require.NotNil(t, config.Config)
+	assert.Equal(t, []string{"GREETING=hello"}, config.Config.Env)
+	emptyLayers := []bool{}
+	for _, h := range config.History {
+		emptyLayers = append(emptyLayers, h.EmptyLayer)
+	}
+	assert.Equal(t, []bool{false, true, false}, emptyLayers)
+	assert.Equal(t, "/bin/sh -c #(nop) ENV GREETING=hello", config.History[1].CreatedBy)
+	var rawConfig map[string]any
+	err = json.Unmarshal(configBytes, &rawConfig)
+	require.NoError(t, err)
+	assert.NotContains(t, rawConfig, "id")
+	assert.NotContains(t, rawConfig, "parent")
+
+	layerStream, size, err := src.GetBlob(ctx, types.BlobInfo{Digest: digest.FromBytes(topLayer), Size: -1}, cache)
+	require.NoError(t, err)
+	layerContents, err := io.ReadAll(layerStream)
+	require.NoError(t, err)
+	layerStream.Close()
+	assert.Equal(t, int64(len(topLayer)), size)
+	assert.Equal(t, topLayer, layerContents)
+
+	// The untagged image, with a zero-length layer.tar
+	src2 := NewSource(reader, false, "transport name", nil, 1)
+	defer src2.Close()
+	manifestBlob, _, err = src2.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	m, err = manifest.Schema2FromManifest(manifestBlob)
+	require.NoError(t, err)
+	require.Len(t, m.LayersDescriptors, 1)
+	assert.Equal(t, digest.FromBytes(baseLayer), m.LayersDescriptors[0].Digest)
+
+	// Invalid archives
+	for _, c := range []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{
+			name:    "missing parent",
+			entries: legacyLayerEntries(topID, envID, "true", topLayer),
+		},
+		{
+			name: "parent loop",
+			entries: append(legacyLayerEntries(baseID, topID, "true", baseLayer),
+				legacyLayerEntries(topID, baseID, "true", topLayer)...),
+		},
+		{
+			name: "missing layer.tar",
+			entries: []tarEntry{
+				legacyLayerEntries(baseID, "", "true", baseLayer)[1],
+			},
+		},
+		{
+			name: "unexpected ID",
+			entries: []tarEntry{
+				{name: path.Join(baseID, legacyConfigFileName), contents: []byte(fmt.Sprintf(`{"id":"%s"}`, topID))},
+				{name: path.Join(baseID, legacyLayerFileName), contents: baseLayer},
+			},
+		},
+		{
+			name: "repositories refers to a missing layer",
+			entries: append(legacyLayerEntries(baseID, "", "true", baseLayer),
+				tarEntry{name: legacyRepositoriesFileName, contents: []byte(fmt.Sprintf(`{"busybox":{"latest":"%s"}}`, topID))}),
+		},
+	} {
+		_, err := NewReaderFromStream(nil, writeTestArchive(t, c.entries))
+		assert.Error(t, err, c.name)
+	}
+}
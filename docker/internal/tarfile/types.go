@@ -14,6 +14,12 @@ const (
 	legacyConfigFileName       = "json"
 	legacyVersionFileName      = "VERSION"
 	legacyRepositoriesFileName = "repositories"
+
+	// Used by newer versions of (docker save), which produce an OCI layout.
+	ociLayoutFileName                = "oci-layout"
+	ociIndexFileName                 = "index.json"
+	ociBlobsDirName                  = "blobs"
+	ociContainerdImageNameAnnotation = "io.containerd.image.name"
 )
 
 // ManifestItem is an element of the array stored in the top-level manifest.json file.
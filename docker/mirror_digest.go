@@ -0,0 +1,84 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// mirrorDigestVerifier implements SystemContext.VerifyMirrorDigest: it checks that mirrors serve the same manifest
+// as the primary location of the registry, so that a stale mirror can’t silently replace the image a tag refers to.
+type mirrorDigestVerifier struct {
+	sys            *types.SystemContext
+	logicalRef     dockerReference
+	primary        sysregistriesv2.PullSource
+	registryConfig *registryConfiguration
+
+	// The result of resolving logicalRef on the primary location; computed on first use, by primaryDigest.
+	resolved       bool
+	resolvedDigest digest.Digest
+	resolveErr     error
+}
+
+// newMirrorDigestVerifier returns a mirrorDigestVerifier for pulling logicalRef, which is available at primary
+// on the primary location of the registry.
+func newMirrorDigestVerifier(sys *types.SystemContext, logicalRef dockerReference, primary sysregistriesv2.PullSource,
+	registryConfig *registryConfiguration) *mirrorDigestVerifier {
+	return &mirrorDigestVerifier{
+		sys:            sys,
+		logicalRef:     logicalRef,
+		primary:        primary,
+		registryConfig: registryConfig,
+	}
+}
+
+// primaryDigest returns the digest of the manifest logicalRef refers to on the primary location of the registry.
+// The primary location is only contacted once; the result, including a failure, is reused afterwards.
+func (v *mirrorDigestVerifier) primaryDigest(ctx context.Context) (digest.Digest, error) {
+	if !v.resolved {
+		v.resolvedDigest, v.resolveErr = v.resolvePrimaryDigest(ctx)
+		v.resolved = ctx.Err() == nil // Don’t cache failures caused by the caller giving up.
+	}
+	return v.resolvedDigest, v.resolveErr
+}
+
+// resolvePrimaryDigest is the uncached version of primaryDigest.
+func (v *mirrorDigestVerifier) resolvePrimaryDigest(ctx context.Context) (digest.Digest, error) {
+	physicalRef, client, err := newPullSourceClient(v.sys, v.logicalRef, v.primary, v.registryConfig)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	tagOrDigest, err := physicalRef.tagOrDigest()
+	if err != nil {
+		return "", err
+	}
+	d, err := client.fetchManifestDigest(ctx, physicalRef, tagOrDigest)
+	if err != nil {
+		return "", err
+	}
+	logrus.Debugf("Primary location %q refers to %s", physicalRef.ref.String(), d)
+	return d, nil
+}
+
+// verify returns an error if s, a source using a mirror, does not serve the manifest logicalRef refers to
+// on the primary location of the registry.
+func (v *mirrorDigestVerifier) verify(ctx context.Context, s *dockerImageSource) error {
+	expected, err := v.primaryDigest(ctx)
+	if err != nil {
+		return fmt.Errorf("resolving %q on the primary location to verify the mirror: %w", v.primary.Reference.String(), err)
+	}
+	matches, err := manifest.MatchesDigest(s.cachedManifest, expected)
+	if err != nil {
+		return fmt.Errorf("computing digest of the manifest served by the mirror: %w", err)
+	}
+	if !matches {
+		return fmt.Errorf("the manifest served by the mirror does not match digest %s on the primary location", expected)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
+	"github.com/containers/image/v5/types"
+)
+
+const (
+	// mirrorProbeTimeout is the maximum time spent probing a single mirror.
+	mirrorProbeTimeout = 5 * time.Second
+	// mirrorLatencyTTL is the time for which a result of probing a mirror is reused.
+	mirrorLatencyTTL = time.Minute
+)
+
+// mirrorLatencyKey identifies a mirror probed by probeMirrorLatency.
+type mirrorLatencyKey struct {
+	registry string
+	insecure bool
+}
+
+// mirrorLatency is a cached result of probeMirrorLatency.
+type mirrorLatency struct {
+	latency time.Duration
+	err     error
+	expires time.Time
+}
+
+var (
+	mirrorLatenciesMutex sync.Mutex // Protects mirrorLatencies
+	mirrorLatencies      = map[mirrorLatencyKey]mirrorLatency{}
+)
+
+// cachedMirrorLatency is probeMirrorLatency, reusing results of previous probes for up to mirrorLatencyTTL.
+func cachedMirrorLatency(ctx context.Context, sys *types.SystemContext, source sysregistriesv2.PullSource) (time.Duration, error) {
+	key := mirrorLatencyKey{
+		registry: reference.Domain(source.Reference),
+		insecure: source.Endpoint.Insecure,
+	}
+	mirrorLatenciesMutex.Lock()
+	cached, ok := mirrorLatencies[key]
+	mirrorLatenciesMutex.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.latency, cached.err
+	}
+
+	latency, err := probeMirrorLatency(ctx, sys, source)
+	if ctx.Err() != nil { // Don’t cache failures caused by the caller giving up.
+		return latency, err
+	}
+	mirrorLatenciesMutex.Lock()
+	defer mirrorLatenciesMutex.Unlock()
+	mirrorLatencies[key] = mirrorLatency{latency: latency, err: err, expires: time.Now().Add(mirrorLatencyTTL)}
+	return latency, err
+}
+
+// probeMirrorLatency measures the latency of a quick request to the registry of source.
+func probeMirrorLatency(ctx context.Context, sys *types.SystemContext, source sysregistriesv2.PullSource) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, mirrorProbeTimeout)
+	defer cancel()
+
+	registry := reference.Domain(source.Reference)
+	client, err := newDockerClient(sys, registry, source.Reference.Name())
+	if err != nil {
+		return -1, err
+	}
+	defer client.Close()
+	client.tlsClientConfig.InsecureSkipVerify = source.Endpoint.Insecure
+	// Connect to the registry before measuring, so that the latency does not depend on the ping protocol or on connection setup.
+	if err := client.detectProperties(ctx); err != nil {
+		return -1, err
+	}
+
+	start := time.Now()
+	res, err := client.makeRequest(ctx, http.MethodHead, "/v2/", nil, nil, noAuth, nil)
+	if err != nil {
+		return -1, err
+	}
+	defer res.Body.Close()
+	latency := time.Since(start)
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusUnauthorized {
+		return -1, fmt.Errorf("probing %s: %w", registry, registryHTTPResponseToError(res))
+	}
+	return latency, nil
+}
@@ -0,0 +1,54 @@
+package docker
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxRedirects is the maximum number of redirects followed for a single request; this matches the http.Client default.
+const maxRedirects = 10
+
+// checkRedirect is an http.Client.CheckRedirect implementation which, in addition to limiting the number of redirects,
+// ensures that credentials for the registry are not sent to other hosts.
+// Registries commonly redirect blob downloads to a CDN, which authorizes the request using the (signed) URL instead.
+//
+// net/http itself only removes the Authorization header if the target is neither the same host nor a subdomain,
+// ignoring the port number and scheme; we are stricter, a different port or a downgrade to plain HTTP
+// is treated as a different host.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if !sameAuthDomain(via[0].URL, req.URL) && req.Header.Get("Authorization") != "" {
+		logrus.Debugf("Not sending credentials for %s to %s after a redirect", via[0].URL.Host, req.URL.Redacted())
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
+
+// sameAuthDomain returns true if credentials sent to original can also be sent to target.
+func sameAuthDomain(original, target *url.URL) bool {
+	if original.Scheme == "https" && target.Scheme != "https" {
+		return false
+	}
+	return strings.EqualFold(original.Hostname(), target.Hostname()) && effectivePort(original) == effectivePort(target)
+}
+
+// effectivePort returns the port u refers to, using the default port for u.Scheme if it does not contain an explicit one.
+func effectivePort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch u.Scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,164 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/pkg/registrytest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSameAuthDomain(t *testing.T) {
+	for _, c := range []struct {
+		original, target string
+		expected         bool
+	}{
+		{"https://registry.example.com/v2/", "https://registry.example.com/cdn/blob", true},
+		{"https://registry.example.com/v2/", "https://REGISTRY.example.com/cdn/blob", true},
+		{"https://registry.example.com/v2/", "https://registry.example.com:443/cdn/blob", true},
+		{"https://registry.example.com:5000/v2/", "https://registry.example.com:5000/cdn/blob", true},
+		{"http://registry.example.com/v2/", "http://registry.example.com:80/cdn/blob", true},
+		{"http://registry.example.com:5000/v2/", "https://registry.example.com:5000/cdn/blob", true},
+		{"https://registry.example.com/v2/", "https://cdn.example.com/blob", false},
+		{"https://registry.example.com/v2/", "https://cdn.registry.example.com/blob", false},
+		{"https://example.com/v2/", "https://registry.example.com/blob", false},
+		{"https://registry.example.com/v2/", "https://registry.example.com:8443/cdn/blob", false},
+		{"https://registry.example.com:5000/v2/", "http://registry.example.com:5000/cdn/blob", false},
+		{"https://registry.example.com/v2/", "http://registry.example.com/cdn/blob", false},
+		{"https://127.0.0.1:5000/v2/", "https://127.0.0.1:5001/blob", false},
+	} {
+		original, err := url.Parse(c.original)
+		require.NoError(t, err)
+		target, err := url.Parse(c.target)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, sameAuthDomain(original, target), "%s → %s", c.original, c.target)
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	original, err := http.NewRequest(http.MethodGet, "https://registry.example.com/v2/repo/blobs/sha256:0", nil)
+	require.NoError(t, err)
+	newRequest := func(target string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("User-Agent", "test")
+		return req
+	}
+
+	req := newRequest("https://registry.example.com/v2/repo/blobs/sha256:0?redirected=1")
+	err = checkRedirect(req, []*http.Request{original})
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+
+	req = newRequest("https://cdn.example.com/blob")
+	err = checkRedirect(req, []*http.Request{original})
+	require.NoError(t, err)
+	assert.Empty(t, req.Header.Values("Authorization"))
+	assert.Equal(t, "test", req.Header.Get("User-Agent"))
+
+	via := []*http.Request{}
+	for i := 0; i < maxRedirects; i++ {
+		via = append(via, original)
+	}
+	err = checkRedirect(newRequest("https://registry.example.com/v2/"), via)
+	assert.Error(t, err)
+}
+
+func TestDockerImageSourceGetBlobRedirect(t *testing.T) {
+	const repo = "redirected"
+	blob := []byte("blob served by a CDN")
+	blobDigest := digest.FromBytes(blob)
+
+	// cdn serves any blob at /$digest, and records whether requests contain an Authorization header.
+	var cdnMutex sync.Mutex
+	cdnAuthorization := []string{}
+	var server *registrytest.Server
+	cdn := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnMutex.Lock()
+		cdnAuthorization = append(cdnAuthorization, r.Header.Get("Authorization"))
+		cdnMutex.Unlock()
+		contents, ok := server.Blob(repo, digest.Digest(strings.TrimPrefix(r.URL.Path, "/")))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(contents)
+	}))
+	defer cdn.Close()
+	cdnURL, err := url.Parse(cdn.URL)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name         string
+		redirectHost string // "" to redirect to the registry itself
+	}{
+		{"different port", cdnURL.Host},
+		{"different host name", "localhost:" + cdnURL.Port()},
+		{"same host", ""},
+	} {
+		redirectHost := c.redirectHost
+		cdnAuthorization = []string{}
+		server = registrytest.NewServer(&registrytest.Options{
+			Auth:     registrytest.TokenAuth,
+			Username: "user",
+			Password: "password",
+			BlobRedirect: func(r *http.Request, repo string, d digest.Digest) string {
+				if redirectHost == "" {
+					if r.URL.Query().Get("redirected") != "" {
+						return ""
+					}
+					return r.URL.Path + "?redirected=1"
+				}
+				return "https://" + redirectHost + "/" + d.String() + "?signature=not-a-credential"
+			},
+		})
+		server.PutBlob(repo, blob)
+		manifestBlob, err := manifest.Schema2FromComponents(manifest.Schema2Descriptor{
+			MediaType: manifest.DockerV2Schema2ConfigMediaType,
+			Digest:    blobDigest,
+			Size:      int64(len(blob)),
+		}, []manifest.Schema2Descriptor{}).Serialize()
+		require.NoError(t, err, c.name)
+		server.PutManifest(repo, "latest", manifest.DockerV2Schema2MediaType, manifestBlob)
+
+		ref, err := ParseReference("//" + server.Host() + "/" + repo + ":latest")
+		require.NoError(t, err, c.name)
+		src, err := ref.NewImageSource(context.Background(), registrytestSystemContext(t, server, ""))
+		require.NoError(t, err, c.name)
+		rc, _, err := src.GetBlob(context.Background(), types.BlobInfo{Digest: blobDigest, Size: -1}, memory.New())
+		require.NoError(t, err, c.name)
+		contents, err := io.ReadAll(rc)
+		require.NoError(t, err, c.name)
+		rc.Close()
+		assert.True(t, bytes.Equal(blob, contents), c.name)
+
+		if redirectHost == "" {
+			assert.Empty(t, cdnAuthorization, c.name)
+			redirectedRequests := 0
+			for _, r := range server.Requests() {
+				if r.Query.Get("redirected") != "" && r.StatusCode == http.StatusOK {
+					redirectedRequests++
+				}
+			}
+			assert.Equal(t, 1, redirectedRequests, c.name) // Credentials were sent after the redirect, or the request would have failed
+		} else {
+			assert.Equal(t, []string{""}, cdnAuthorization, c.name)
+		}
+
+		src.Close()
+		server.Close()
+	}
+}
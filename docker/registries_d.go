@@ -51,6 +51,7 @@ type registryNamespace struct {
 	SigStore               string `yaml:"sigstore"`          // For compatibility, deprecated in favor of Lookaside.
 	SigStoreStaging        string `yaml:"sigstore-staging"`  // For compatibility, deprecated in favor of LookasideStaging.
 	UseSigstoreAttachments *bool  `yaml:"use-sigstore-attachments,omitempty"`
+	UseReferrersAPI        *bool  `yaml:"use-referrers-api,omitempty"` // Only relevant if UseSigstoreAttachments
 }
 
 // lookasideStorageBase is an "opaque" type representing a lookaside Docker signature storage.
@@ -229,31 +230,48 @@ func (config *registryConfiguration) signatureTopLevel(ref dockerReference, writ
 // config.useSigstoreAttachments returns whether we should look for and write sigstore attachments.
 // for ref.
 func (config *registryConfiguration) useSigstoreAttachments(ref dockerReference) bool {
+	return config.namespaceBool(ref, "Sigstore attachments", func(ns *registryNamespace) *bool {
+		return ns.UseSigstoreAttachments
+	})
+}
+
+// config.useReferrersAPI returns whether we should look for sigstore signatures of ref using the OCI referrers API,
+// before using the tag convention.
+func (config *registryConfiguration) useReferrersAPI(ref dockerReference) bool {
+	return config.namespaceBool(ref, "Referrers API", func(ns *registryNamespace) *bool {
+		return ns.UseReferrersAPI
+	})
+}
+
+// config.namespaceBool returns the value of an optional boolean option for ref, as returned by field,
+// from the most specific namespace which sets it; or false if no namespace sets it.
+// description is used in debug logs.
+func (config *registryConfiguration) namespaceBool(ref dockerReference, description string, field func(*registryNamespace) *bool) bool {
 	if config.Docker != nil {
 		// Look for a full match.
 		identity := ref.PolicyConfigurationIdentity()
 		if ns, ok := config.Docker[identity]; ok {
-			logrus.Debugf(` Sigstore attachments: using "docker" namespace %s`, identity)
-			if ns.UseSigstoreAttachments != nil {
-				return *ns.UseSigstoreAttachments
+			logrus.Debugf(` %s: using "docker" namespace %s`, description, identity)
+			if v := field(&ns); v != nil {
+				return *v
 			}
 		}
 
 		// Look for a match of the possible parent namespaces.
 		for _, name := range ref.PolicyConfigurationNamespaces() {
 			if ns, ok := config.Docker[name]; ok {
-				logrus.Debugf(` Sigstore attachments: using "docker" namespace %s`, name)
-				if ns.UseSigstoreAttachments != nil {
-					return *ns.UseSigstoreAttachments
+				logrus.Debugf(` %s: using "docker" namespace %s`, description, name)
+				if v := field(&ns); v != nil {
+					return *v
 				}
 			}
 		}
 	}
 	// Look for a default location
 	if config.DefaultDocker != nil {
-		logrus.Debugf(` Sigstore attachments: using "default-docker" configuration`)
-		if config.DefaultDocker.UseSigstoreAttachments != nil {
-			return *config.DefaultDocker.UseSigstoreAttachments
+		logrus.Debugf(` %s: using "default-docker" configuration`, description)
+		if v := field(config.DefaultDocker); v != nil {
+			return *v
 		}
 	}
 	return false
@@ -0,0 +1,164 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// lowSpeedChecksPerPeriod is the number of times per lowSpeedTime a watchedBody checks the transfer rate.
+const lowSpeedChecksPerPeriod = 10
+
+// watchedBody is an io.ReadCloser wrapping a HTTP response body, which fails reads (and aborts reads in progress)
+// as soon as a context is done, or if data is received too slowly.
+//
+// net/http already aborts reads of response bodies when the context of the request is done, but only as a part of the HTTP
+// transport implementation; this makes the behavior explicit, and allows reporting a clear error.
+type watchedBody struct {
+	body          io.ReadCloser
+	ctx           context.Context
+	lowSpeedLimit int64         // Minimum average number of bytes per second, or 0 if low speed detection is disabled
+	lowSpeedTime  time.Duration // The period lowSpeedLimit is averaged over
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stopped   chan struct{} // Closed when the watchdog should exit
+
+	lock sync.Mutex
+	// failure is the reason why reading has been aborted; once set, it is returned from all reads. Protected by lock.
+	failure error
+	// The following describe the current low speed detection period. Protected by lock.
+	readStart   time.Time     // The start of the Read call in progress, or time.Time{} if there is none
+	periodTime  time.Duration // Time spent in Read calls, excluding the one in progress
+	periodBytes int64         // Bytes read
+}
+
+// newWatchedBody returns body, wrapped so that reading from it fails when ctx is done,
+// or if less than lowSpeedLimit bytes per second (if not 0) are received on average over lowSpeedTime.
+func newWatchedBody(ctx context.Context, body io.ReadCloser, lowSpeedLimit int64, lowSpeedTime time.Duration) io.ReadCloser {
+	if ctx.Done() == nil && lowSpeedLimit == 0 {
+		return body // Nothing to watch for
+	}
+	return &watchedBody{
+		body:          body,
+		ctx:           ctx,
+		lowSpeedLimit: lowSpeedLimit,
+		lowSpeedTime:  lowSpeedTime,
+		stopped:       make(chan struct{}),
+	}
+}
+
+// Read implements io.Reader.
+func (w *watchedBody) Read(p []byte) (int, error) {
+	// Start the watchdog only when the body is being read, many response bodies are just closed.
+	w.startOnce.Do(func() {
+		go w.watchdog()
+	})
+
+	w.lock.Lock()
+	if w.failure == nil && w.ctx.Err() != nil {
+		w.failure = fmt.Errorf("reading response body: %w", w.ctx.Err())
+	}
+	if w.failure != nil {
+		err := w.failure
+		w.lock.Unlock()
+		return 0, err
+	}
+	w.readStart = time.Now()
+	w.lock.Unlock()
+
+	n, err := w.body.Read(p)
+
+	w.lock.Lock()
+	w.periodTime += time.Since(w.readStart)
+	w.readStart = time.Time{}
+	w.periodBytes += int64(n)
+	if w.failure != nil { // The watchdog has closed the body; report why, not the resulting read error.
+		err = w.failure
+	}
+	w.lock.Unlock()
+	if err != nil {
+		w.stop()
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (w *watchedBody) Close() error {
+	w.stop()
+	return w.body.Close()
+}
+
+// stop terminates the watchdog, if it is running.
+func (w *watchedBody) stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopped)
+	})
+}
+
+// watchdog aborts reading from w.body when w.ctx is done, or when data is being received too slowly.
+func (w *watchedBody) watchdog() {
+	var ticks <-chan time.Time // nil if low speed detection is disabled
+	if w.lowSpeedLimit != 0 {
+		interval := w.lowSpeedTime / lowSpeedChecksPerPeriod
+		if interval <= 0 { // Very short, but valid, lowSpeedTime values
+			interval = 1
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	for {
+		select {
+		case <-w.stopped:
+			return
+		case <-w.ctx.Done():
+			w.abort(fmt.Errorf("reading response body: %w", w.ctx.Err()))
+			return
+		case now := <-ticks:
+			if err := w.checkSpeed(now); err != nil {
+				w.abort(err)
+				return
+			}
+		}
+	}
+}
+
+// checkSpeed returns an error if the average rate of receiving data over the last w.lowSpeedTime spent reading
+// is smaller than w.lowSpeedLimit.
+func (w *watchedBody) checkSpeed(now time.Time) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	elapsed := w.periodTime
+	if w.readStart != (time.Time{}) {
+		elapsed += now.Sub(w.readStart)
+	}
+	if elapsed < w.lowSpeedTime {
+		return nil
+	}
+	if float64(w.periodBytes) < float64(w.lowSpeedLimit)*elapsed.Seconds() {
+		return fmt.Errorf("reading response body: received only %d bytes in %v, less than the required %d bytes per second",
+			w.periodBytes, elapsed.Round(time.Millisecond), w.lowSpeedLimit)
+	}
+	// Start a new period.
+	w.periodTime = 0
+	w.periodBytes = 0
+	if w.readStart != (time.Time{}) {
+		w.readStart = now
+	}
+	return nil
+}
+
+// abort makes all reads fail with err, and aborts the read in progress, if any.
+func (w *watchedBody) abort(err error) {
+	w.lock.Lock()
+	if w.failure == nil {
+		w.failure = err
+	}
+	w.lock.Unlock()
+	// Closing the body makes a concurrent Read fail; the caller still calls Close, which is safe to repeat for HTTP response bodies.
+	_ = w.body.Close()
+}
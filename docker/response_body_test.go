@@ -0,0 +1,181 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+// slowWriter writes a byte to w every interval, until w is closed.
+func slowWriter(w *io.PipeWriter, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if _, err := w.Write([]byte{'x'}); err != nil {
+			return
+		}
+	}
+}
+
+func TestNewWatchedBody(t *testing.T) {
+	// Nothing to watch for
+	body := io.NopCloser(strings.NewReader("data"))
+	res := newWatchedBody(context.Background(), body, 0, 0)
+	assert.Equal(t, body, res)
+	// A cancelable context
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	res = newWatchedBody(ctx, body, 0, 0)
+	assert.IsType(t, &watchedBody{}, res)
+	// Low speed detection
+	res = newWatchedBody(context.Background(), body, 1, time.Second)
+	assert.IsType(t, &watchedBody{}, res)
+	// A period too short to be divided into several checks is accepted.
+	r, w := io.Pipe()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = w.CloseWithError(errors.New("test done"))
+	}()
+	res = newWatchedBody(context.Background(), r, 1, 5*time.Nanosecond)
+	assert.IsType(t, &watchedBody{}, res)
+	_, err := io.ReadAll(res)
+	assert.Error(t, err)
+	err = res.Close()
+	assert.NoError(t, err)
+}
+
+func TestWatchedBodyContext(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	// A server sending data slowly, but steadily, is interrupted when the context is done.
+	r, w := io.Pipe()
+	go slowWriter(w, 10*time.Millisecond)
+	defer w.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	body := newWatchedBody(ctx, r, 0, 0)
+	start := time.Now()
+	_, err := io.ReadAll(body)
+	elapsed := time.Since(start)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, elapsed, 5*time.Second)
+	// Reads continue failing.
+	_, err = body.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	err = body.Close()
+	assert.NoError(t, err)
+
+	// Reading after the context is done fails immediately.
+	ctx, cancel = context.WithCancel(context.Background())
+	body = newWatchedBody(ctx, io.NopCloser(strings.NewReader("data")), 0, 0)
+	cancel()
+	_, err = body.Read(make([]byte, 10))
+	assert.ErrorIs(t, err, context.Canceled)
+	err = body.Close()
+	assert.NoError(t, err)
+
+	// A body read to the end before the context is done succeeds.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	body = newWatchedBody(ctx, io.NopCloser(strings.NewReader("data")), 0, 0)
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+	err = body.Close()
+	assert.NoError(t, err)
+}
+
+func TestWatchedBodyLowSpeed(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	// A server sending data too slowly is detected.
+	r, w := io.Pipe()
+	go slowWriter(w, 20*time.Millisecond) // ~50 bytes per second
+	defer w.Close()
+	body := newWatchedBody(context.Background(), r, 1000, 200*time.Millisecond)
+	_, err := io.ReadAll(body)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bytes per second")
+	assert.False(t, errors.Is(err, context.DeadlineExceeded))
+	err = body.Close()
+	assert.NoError(t, err)
+
+	// A server sending data fast enough is not affected.
+	r, w = io.Pipe()
+	go func() {
+		chunk := make([]byte, 1000) // ~100 kB per second
+		for i := 0; i < 50; i++ {
+			time.Sleep(10 * time.Millisecond)
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+		w.Close()
+	}()
+	body = newWatchedBody(context.Background(), r, 1000, 100*time.Millisecond)
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Len(t, data, 50*1000)
+	err = body.Close()
+	assert.NoError(t, err)
+
+	// A consumer reading slowly from a fast server is not affected: time not spent waiting for the server doesn’t count.
+	body = newWatchedBody(context.Background(), io.NopCloser(strings.NewReader(strings.Repeat("x", 20))), 1000, 50*time.Millisecond)
+	buf := make([]byte, 1)
+	total := 0
+	for {
+		n, err := body.Read(buf)
+		total += n
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 20, total)
+	err = body.Close()
+	assert.NoError(t, err)
+}
+
+func TestNewDockerClientFromRefLowSpeed(t *testing.T) {
+	ref, err := ParseReference("//busybox")
+	require.NoError(t, err)
+	dockerRef, ok := ref.(dockerReference)
+	require.True(t, ok)
+	authFile := filepath.Join(t.TempDir(), "auth.json") // Does not exist
+	registryConfig := &registryConfiguration{}
+
+	for _, c := range []struct {
+		limit         int64
+		time          time.Duration
+		expectedLimit int64
+		expectedTime  time.Duration
+	}{
+		{0, 0, 0, 0},
+		{1000, 0, 0, 0},
+		{0, time.Second, 0, 0},
+		{1000, time.Second, 1000, time.Second},
+	} {
+		sys := &types.SystemContext{AuthFilePath: authFile, DockerLowSpeedLimit: c.limit, DockerLowSpeedTime: c.time}
+		client, err := newDockerClientFromRef(sys, dockerRef, registryConfig, false, "pull")
+		require.NoError(t, err)
+		assert.Equal(t, c.expectedLimit, client.lowSpeedLimit)
+		assert.Equal(t, c.expectedTime, client.lowSpeedTime)
+	}
+
+	for _, sys := range []*types.SystemContext{
+		{AuthFilePath: authFile, DockerLowSpeedLimit: -1, DockerLowSpeedTime: time.Second},
+		{AuthFilePath: authFile, DockerLowSpeedLimit: 1000, DockerLowSpeedTime: -time.Second},
+	} {
+		_, err := newDockerClientFromRef(sys, dockerRef, registryConfig, false, "pull")
+		assert.Error(t, err)
+	}
+}
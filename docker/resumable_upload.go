@@ -0,0 +1,362 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/putblobdigest"
+	"github.com/containers/image/v5/internal/tmpdir"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// resumableUploadKey identifies a blob upload which can be resumed by a later PutBlobWithOptions call.
+type resumableUploadKey struct {
+	repo   string
+	digest digest.Digest
+}
+
+// resumableUpload is the state of an interrupted chunked blob upload.
+type resumableUpload struct {
+	location  *url.URL // The upload URL returned by the registry after the last accepted chunk
+	chunkSize int64
+}
+
+// resumableUploadState records interrupted uploads which can be resumed.
+// It is private to a dockerClient, or shared by dockerClients using the same registry and credentials in a session;
+// it is discarded with its owner.
+type resumableUploadState struct {
+	mutex   sync.Mutex // Protects uploads
+	uploads map[resumableUploadKey]resumableUpload
+}
+
+// record records upload as resumable by a later upload of the same blob.
+func (s *resumableUploadState) record(key resumableUploadKey, upload resumableUpload) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.uploads == nil {
+		s.uploads = map[resumableUploadKey]resumableUpload{}
+	}
+	s.uploads[key] = upload
+}
+
+// take returns, and forgets, a resumable upload for key, if any.
+// The caller is responsible for recording the upload again if it remains resumable.
+func (s *resumableUploadState) take(key resumableUploadKey) (resumableUpload, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	upload, ok := s.uploads[key]
+	if ok {
+		delete(s.uploads, key)
+	}
+	return upload, ok
+}
+
+// resumableUploadState returns the state of resumable uploads of c, shared with other clients in the session, if any.
+func (c *dockerClient) resumableUploadState() *resumableUploadState {
+	if c.shared != nil {
+		return &c.shared.uploads
+	}
+	return &c.uploads
+}
+
+// putBlobInChunks is PutBlobWithOptions with d.c.resumableUploads.
+// It uploads the blob in chunks; if an upload of a blob with a known digest fails after some chunks were accepted,
+// a later call for the same blob using the same resumableUploadState continues after the last accepted chunk.
+func (d *dockerImageDestination) putBlobInChunks(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
+	digester, stream := putblobdigest.DigestIfCanonicalUnknown(stream, inputInfo)
+	sizeCounter := &sizeCounter{}
+	stream = io.TeeReader(stream, sizeCounter)
+
+	// Without a known digest, we can’t tell whether a later upload is of the same blob.
+	var key *resumableUploadKey
+	if inputInfo.Digest != "" {
+		key = &resumableUploadKey{
+			repo:   reference.Path(d.ref.ref),
+			digest: inputInfo.Digest,
+		}
+	}
+	state := d.c.resumableUploadState()
+
+	var upload resumableUpload
+	offset := int64(0)
+	if key != nil {
+		if previous, ok := state.take(*key); ok {
+			previousOffset, previousLocation, err := d.uploadOffset(ctx, previous.location)
+			if err != nil {
+				logrus.Debugf("Not resuming the upload of %s: %v", key.digest, err)
+			} else {
+				logrus.Debugf("Resuming the upload of %s at offset %d", key.digest, previousOffset)
+				if _, err := io.CopyN(io.Discard, stream, previousOffset); err != nil {
+					state.record(*key, previous)
+					return private.UploadedBlob{}, fmt.Errorf("skipping already uploaded data: %w", err)
+				}
+				upload, offset = previous, previousOffset
+				upload.location = previousLocation
+			}
+		}
+	}
+	if upload.location == nil {
+		location, registryMinChunkSize, err := d.startUpload(ctx)
+		if err != nil {
+			return private.UploadedBlob{}, err
+		}
+		chunkSize := d.c.minUploadChunkSize
+		if registryMinChunkSize > chunkSize {
+			chunkSize = registryMinChunkSize
+		}
+		upload = resumableUpload{location: location, chunkSize: chunkSize}
+	}
+
+	bufferSize := upload.chunkSize
+	if inputInfo.Size != -1 && inputInfo.Size-offset < bufferSize { // Don’t allocate a large buffer for small blobs.
+		bufferSize = inputInfo.Size - offset + 1 // +1 so that a blob of a known size is uploaded in a single request
+	}
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	chunk := make([]byte, bufferSize)
+	for {
+		n, readErr := io.ReadFull(stream, chunk)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			if key != nil && offset > 0 {
+				state.record(*key, upload)
+			}
+			return private.UploadedBlob{}, fmt.Errorf("reading blob: %w", readErr)
+		}
+		if n > 0 {
+			location, err := d.uploadChunkWithRetries(ctx, upload.location, chunk[:n], offset)
+			if err != nil {
+				if key != nil && offset > 0 {
+					logrus.Debugf("Upload of %s failed after %d bytes, it can be resumed", key.digest, offset)
+					state.record(*key, upload)
+				}
+				return private.UploadedBlob{}, err
+			}
+			upload.location = location
+			offset += int64(n)
+		}
+		if readErr != nil { // io.EOF or io.ErrUnexpectedEOF
+			break
+		}
+	}
+	blobDigest := digester.Digest()
+
+	// If this fails, don’t resume the upload; if the uploaded data was incorrect, a later upload must start over.
+	if err := d.finishUpload(ctx, upload.location, blobDigest); err != nil {
+		return private.UploadedBlob{}, err
+	}
+	options.Cache.RecordKnownLocation(d.ref.Transport(), bicTransportScope(d.ref), blobDigest, newBICLocationReference(d.ref))
+	return private.UploadedBlob{Digest: blobDigest, Size: sizeCounter.size}, nil
+}
+
+// uploadChunk uploads chunk, starting at offset, to the blob upload at uploadLocation, and returns the upload URL to use for the next request.
+func (d *dockerImageDestination) uploadChunk(ctx context.Context, uploadLocation *url.URL, chunk []byte, offset int64) (*url.URL, error) {
+	headers := map[string][]string{
+		"Content-Type":  {"application/octet-stream"},
+		"Content-Range": {fmt.Sprintf("%d-%d", offset, offset+int64(len(chunk))-1)},
+	}
+	res, err := d.c.makeRequestToResolvedURL(ctx, http.MethodPatch, uploadLocation, headers, bytes.NewReader(chunk), int64(len(chunk)), v2Auth, nil)
+	if err != nil {
+		logrus.Debugf("Error uploading layer chunk at offset %d: %v", offset, err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		return nil, fmt.Errorf("uploading layer chunk at offset %d: %w", offset, registryHTTPResponseToError(res))
+	}
+	location, err := res.Location()
+	if err != nil {
+		return nil, fmt.Errorf("determining upload URL: %w", err)
+	}
+	return location, nil
+}
+
+// uploadChunkWithRetries is uploadChunk; if d.c.maxUploadRetries != 0 and the upload fails with a network error,
+// it asks the registry how much data was accepted, and continues uploading the rest of chunk, up to d.c.maxUploadRetries times.
+func (d *dockerImageDestination) uploadChunkWithRetries(ctx context.Context, uploadLocation *url.URL, chunk []byte, offset int64) (*url.URL, error) {
+	sent := int64(0) // The number of bytes of chunk accepted by the registry
+	for retries := 0; ; retries++ {
+		location, err := d.uploadChunk(ctx, uploadLocation, chunk[sent:], offset+sent)
+		if err == nil {
+			return location, nil
+		}
+		if !d.shouldRetryUpload(ctx, err, retries) {
+			return nil, err
+		}
+		accepted, acceptedLocation, offsetErr := d.uploadOffset(ctx, uploadLocation)
+		if offsetErr != nil {
+			logrus.Debugf("Upload failed (%v), and its state can’t be determined: %v", err, offsetErr)
+			return nil, err
+		}
+		if accepted < offset || accepted > offset+int64(len(chunk)) {
+			return nil, fmt.Errorf("registry reports accepting %d bytes of the upload, expected between %d and %d", accepted, offset, offset+int64(len(chunk)))
+		}
+		if accepted == offset+int64(len(chunk)) { // Only the response was lost
+			return acceptedLocation, nil
+		}
+		logrus.Debugf("Upload failed (%v), continuing at offset %d", err, accepted)
+		uploadLocation, sent = acceptedLocation, accepted-offset
+	}
+}
+
+// uploadOffset returns the number of bytes accepted by the registry in the blob upload at uploadLocation,
+// and the upload URL to use for the next request.
+func (d *dockerImageDestination) uploadOffset(ctx context.Context, uploadLocation *url.URL) (int64, *url.URL, error) {
+	res, err := d.c.makeRequestToResolvedURL(ctx, http.MethodGet, uploadLocation, nil, nil, -1, v2Auth, nil)
+	if err != nil {
+		return -1, nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return -1, nil, fmt.Errorf("reading upload status: %w", registryHTTPResponseToError(res))
+	}
+	// The registry reports the accepted data as an inclusive range, "0-0" both if it has accepted nothing and a single byte;
+	// we never resume such uploads, so that ambiguity does not matter.
+	hdr := res.Header.Get("Range")
+	first, last, ok := strings.Cut(hdr, "-")
+	if !ok || first != "0" {
+		return -1, nil, fmt.Errorf("invalid upload status Range: %q", hdr)
+	}
+	lastPos, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || lastPos < 0 {
+		return -1, nil, fmt.Errorf("invalid upload status Range: %q", hdr)
+	}
+	if lastPos == 0 {
+		return -1, nil, errors.New("no data has been accepted")
+	}
+	location := uploadLocation
+	if res.Header.Get("Location") != "" {
+		location, err = res.Location()
+		if err != nil {
+			return -1, nil, fmt.Errorf("determining upload URL: %w", err)
+		}
+	}
+	return lastPos + 1, location, nil
+}
+
+// replayableStream reads a blob sequentially from a source, and allows reading the data already read again, from any offset.
+// The data is buffered in a temporary file, unless the original stream can be read again directly.
+type replayableStream struct {
+	source   io.Reader   // The data not read yet
+	past     io.ReaderAt // The data read so far, starting at pastBase
+	pastBase int64
+	file     *os.File // The temporary file used as past, or nil
+	size     int64    // The number of bytes read from source so far
+	err      error    // A failure reading (or buffering) source, if any; io.EOF is not recorded
+}
+
+// newReplayableStream returns a replayableStream reading from source, which must contain the same data as original
+// (e.g. source may compute a digest of the data read from original).
+// If original implements io.ReaderAt and io.Seeker, the data already read is read from original again;
+// otherwise, it is buffered in a temporary file. The caller must call close on the result when done.
+func newReplayableStream(sys *types.SystemContext, original, source io.Reader) (*replayableStream, error) {
+	res := &replayableStream{source: source}
+	readerAt, isReaderAt := original.(io.ReaderAt)
+	seeker, isSeeker := original.(io.Seeker)
+	if isReaderAt && isSeeker {
+		// ReadAt offsets are relative to the start of the file, not to the current position of original.
+		base, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			res.past, res.pastBase = readerAt, base
+			return res, nil
+		}
+		logrus.Debugf("Buffering the uploaded blob, determining the current stream position failed: %v", err)
+	}
+	file, err := os.CreateTemp(tmpdir.TemporaryDirectoryForBigFiles(sys), "docker-upload")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary file for upload retries: %w", err)
+	}
+	res.past, res.file = file, file
+	return res, nil
+}
+
+// Read implements io.Reader, returning the data not read yet.
+func (s *replayableStream) Read(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.source.Read(p)
+	if n > 0 && s.file != nil {
+		if _, err := s.file.WriteAt(p[:n], s.size); err != nil {
+			s.err = fmt.Errorf("buffering blob data for upload retries: %w", err)
+			return 0, s.err
+		}
+	}
+	s.size += int64(n)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+	return n, err
+}
+
+// readerFrom returns a reader of the blob data starting at offset, which must not be larger than s.size.
+// Reading from the returned reader consumes s.
+func (s *replayableStream) readerFrom(offset int64) io.Reader {
+	return io.MultiReader(io.NewSectionReader(s.past, s.pastBase+offset, s.size-offset), s)
+}
+
+// close releases resources associated with s.
+func (s *replayableStream) close() {
+	if s.file != nil {
+		s.file.Close()
+		os.Remove(s.file.Name())
+	}
+}
+
+// shouldRetryUpload returns true if an upload which failed with err, after the specified number of retries,
+// should be retried and continued from the data accepted by the registry.
+func (d *dockerImageDestination) shouldRetryUpload(ctx context.Context, err error, retries int) bool {
+	if retries >= d.c.maxUploadRetries || ctx.Err() != nil {
+		return false
+	}
+	// Only retry if the request failed without a response; if the registry has rejected the data, sending it again won’t help.
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// uploadStreamWithRetries is uploadStream with d.c.maxUploadRetries != 0, for a blob of size (-1 if unknown):
+// if the upload fails with a network error, it asks the registry how much data was accepted, and continues the upload
+// from that offset, up to d.c.maxUploadRetries times.
+func (d *dockerImageDestination) uploadStreamWithRetries(ctx context.Context, uploadLocation *url.URL, stream *replayableStream, size int64) (*url.URL, error) {
+	offset := int64(0)
+	for retries := 0; ; retries++ {
+		location, err := d.uploadStream(ctx, uploadLocation, stream.readerFrom(offset), offset, size)
+		if err == nil {
+			return location, nil
+		}
+		if stream.err != nil {
+			return nil, fmt.Errorf("reading blob: %w", stream.err)
+		}
+		if !d.shouldRetryUpload(ctx, err, retries) {
+			return nil, err
+		}
+		accepted, acceptedLocation, offsetErr := d.uploadOffset(ctx, uploadLocation)
+		switch {
+		case offsetErr != nil:
+			logrus.Debugf("Upload failed (%v), and its state can’t be determined (%v), starting over", err, offsetErr)
+			uploadLocation, _, err = d.startUpload(ctx)
+			if err != nil {
+				return nil, err
+			}
+			offset = 0
+		case accepted > stream.size:
+			return nil, fmt.Errorf("registry reports accepting %d bytes of the upload, only %d bytes were sent", accepted, stream.size)
+		default:
+			logrus.Debugf("Upload failed (%v), continuing at offset %d", err, accepted)
+			uploadLocation, offset = acceptedLocation, accepted
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/containers/image/v5/internal/session"
+	"github.com/containers/image/v5/types"
+)
+
+// sharedRegistryStateKey identifies dockerClients which can share a sharedRegistryState.
+// Clients are only shared if they would behave identically: same configuration, same registry, same credentials.
+type sharedRegistryStateKey struct {
+	sys                *types.SystemContext
+	registry           string
+	insecureSkipVerify bool
+	userAgent          string
+	auth               types.DockerAuthConfig
+	registryToken      string
+}
+
+// sharedRegistryState is the part of the state of dockerClient which is shared by all dockerClients
+// with the same sharedRegistryStateKey within a session.Session, so that the registry is only pinged,
+// and authentication is only negotiated, once.
+type sharedRegistryState struct {
+	mutex sync.Mutex // Protects the members below
+	// The following members are set after a successful detectPropertiesHelper() on any of the dockerClients, and never change afterwards.
+	detected           bool
+	client             *http.Client
+	scheme             string
+	challenges         []challenge
+	supportsSignatures bool
+
+	// tokenCache is used instead of dockerClient.tokenCache (key: string, including the client’s scope, value: bearerToken)
+	tokenCache sync.Map
+	// uploads is used instead of dockerClient.uploads
+	uploads resumableUploadState
+}
+
+// useSession makes c share registry state with other dockerClients using the same configuration within the session associated with ctx, if any.
+// It must be called before c is used, after all of its configuration members are set.
+func (c *dockerClient) useSession(ctx context.Context) {
+	s := session.FromContext(ctx)
+	if s == nil {
+		return
+	}
+	key := sharedRegistryStateKey{
+		sys:                c.sys,
+		registry:           c.registry,
+		insecureSkipVerify: c.tlsClientConfig.InsecureSkipVerify,
+		userAgent:          c.userAgent,
+		auth:               c.auth,
+		registryToken:      c.registryToken,
+	}
+	c.shared = s.LoadOrCreate(key, func() any { return &sharedRegistryState{} }).(*sharedRegistryState)
+}
+
+// detectSharedProperties is detectPropertiesHelper for a dockerClient with c.shared set:
+// it only detects the registry properties if no other client using c.shared has done so successfully.
+func (c *dockerClient) detectSharedProperties(ctx context.Context) error {
+	s := c.shared
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.detected {
+		// Failures are not recorded, so that a transient failure does not affect other users of the session.
+		if err := c.detectPropertiesHelper(ctx); err != nil {
+			return err
+		}
+		s.detected = true
+		s.client = c.client
+		s.scheme = c.scheme
+		s.challenges = c.challenges
+		s.supportsSignatures = c.supportsSignatures
+		return nil
+	}
+	c.client = s.client
+	c.scheme = s.scheme
+	c.challenges = s.challenges
+	c.supportsSignatures = s.supportsSignatures
+	return nil
+}
+
+// Close releases the connections kept by the shared client, if any.
+func (s *sharedRegistryState) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.client != nil {
+		s.client.CloseIdleConnections()
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/session"
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageDestinationSession(t *testing.T) {
+	const token = "session-token"
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o644)
+	require.NoError(t, err)
+
+	var mutex sync.Mutex
+	pings := 0
+	tokenScopes := []string{}
+	var serverURL string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			pings++
+			rw.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, serverURL))
+			rw.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodGet && r.URL.Path == "/token":
+			tokenScopes = append(tokenScopes, r.URL.Query().Get("scope"))
+			_, err := rw.Write([]byte(fmt.Sprintf(`{"token":"%s"}`, token)))
+			require.NoError(t, err)
+		case r.Header.Get("Authorization") != "Bearer "+token:
+			rw.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/blobs/uploads/"):
+			rw.Header().Set("Location", r.URL.Path+"some-uuid")
+			rw.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodDelete && strings.HasSuffix(r.URL.Path, "/blobs/uploads/some-uuid"):
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	serverURL = server.URL
+	registryURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+
+	// Runs a preflight check for every image in refs, using ctx, and returns the number of pings and token requests.
+	preflight := func(ctx context.Context, refs ...string) (int, []string) {
+		mutex.Lock()
+		pings = 0
+		tokenScopes = []string{}
+		mutex.Unlock()
+		for _, refString := range refs {
+			ref, err := ParseReference("//" + registryURL.Host + "/" + refString)
+			require.NoError(t, err, refString)
+			dest, err := ref.NewImageDestination(ctx, sys)
+			require.NoError(t, err, refString)
+			checker, ok := dest.(private.PreflightChecker)
+			require.True(t, ok, refString)
+			err = checker.Preflight(ctx)
+			assert.NoError(t, err, refString)
+			err = dest.Close()
+			require.NoError(t, err, refString)
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		return pings, tokenScopes
+	}
+
+	// Without a session, every destination negotiates authentication separately
+	p, scopes := preflight(context.Background(), "repo:1", "repo:2", "repo:3")
+	assert.Equal(t, 3, p)
+	assert.Equal(t, []string{"repository:repo:pull,push", "repository:repo:pull,push", "repository:repo:pull,push"}, scopes)
+
+	// With a session, the registry is pinged once, and a token is only requested once for each repository
+	s := session.New()
+	defer s.Close()
+	ctx := session.WithSession(context.Background(), s)
+	p, scopes = preflight(ctx, "repo:1", "repo:2", "other:1", "repo:3")
+	assert.Equal(t, 1, p)
+	assert.Equal(t, []string{"repository:repo:pull,push", "repository:other:pull,push"}, scopes)
+
+	// Different credentials are not shared
+	sys.DockerAuthConfig = &types.DockerAuthConfig{Username: "user", Password: "pass"}
+	p, scopes = preflight(ctx, "repo:1", "repo:2")
+	assert.Equal(t, 1, p)
+	assert.Equal(t, []string{"repository:repo:pull,push"}, scopes)
+}
@@ -0,0 +1,66 @@
+//go:build containers_image_spnego
+// +build containers_image_spnego
+
+package docker
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// setNegotiateAuth sets up req to authenticate using the Negotiate (SPNEGO) authentication scheme, or fails.
+// It is nil if support for that scheme was not compiled in.
+var setNegotiateAuth = setKerberosNegotiateAuth
+
+// setKerberosNegotiateAuth sets up req to authenticate using the Negotiate authentication scheme,
+// with a Kerberos service ticket obtained using the credentials in the user’s Kerberos ticket cache.
+func setKerberosNegotiateAuth(req *http.Request) error {
+	configPath := os.Getenv("KRB5_CONFIG")
+	if configPath == "" {
+		configPath = "/etc/krb5.conf"
+	}
+	krb5Config, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("loading Kerberos configuration from %s: %w", configPath, err)
+	}
+	ccachePath, err := kerberosCCachePath()
+	if err != nil {
+		return err
+	}
+	ccache, err := credentials.LoadCCache(ccachePath)
+	if err != nil {
+		return fmt.Errorf("loading Kerberos ticket cache %s: %w", ccachePath, err)
+	}
+	krb5Client, err := client.NewFromCCache(ccache, krb5Config)
+	if err != nil {
+		return fmt.Errorf("creating Kerberos client from ticket cache %s: %w", ccachePath, err)
+	}
+	defer krb5Client.Destroy()
+	if err := spnego.SetSPNEGOHeader(krb5Client, req, "HTTP/"+req.URL.Hostname()); err != nil {
+		return fmt.Errorf("obtaining a Kerberos service ticket for %s: %w", req.URL.Hostname(), err)
+	}
+	return nil
+}
+
+// kerberosCCachePath returns the path of the user’s Kerberos ticket cache, following the conventions of MIT Kerberos.
+// Only file-based ticket caches are supported.
+func kerberosCCachePath() (string, error) {
+	name := os.Getenv("KRB5CCNAME")
+	if name == "" {
+		return fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid()), nil
+	}
+	if strings.HasPrefix(name, "FILE:") {
+		return strings.TrimPrefix(name, "FILE:"), nil
+	}
+	if cacheType, _, ok := strings.Cut(name, ":"); ok {
+		return "", fmt.Errorf("Kerberos ticket cache type %q in KRB5CCNAME is not supported, only FILE: is supported", cacheType)
+	}
+	return name, nil
+}
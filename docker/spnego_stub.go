@@ -0,0 +1,10 @@
+//go:build !containers_image_spnego
+// +build !containers_image_spnego
+
+package docker
+
+import "net/http"
+
+// setNegotiateAuth sets up req to authenticate using the Negotiate (SPNEGO) authentication scheme, or fails.
+// It is nil if support for that scheme was not compiled in, which requires the containers_image_spnego build tag.
+var setNegotiateAuth func(req *http.Request) error // = nil
@@ -0,0 +1,44 @@
+//go:build containers_image_spnego
+// +build containers_image_spnego
+
+package docker
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKerberosCCachePath(t *testing.T) {
+	for _, c := range []struct{ env, expected string }{
+		{"", fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())},
+		{"/some/path", "/some/path"},
+		{"FILE:/some/path", "/some/path"},
+		{"KEYRING:persistent:1000", ""},
+		{"KCM:", ""},
+	} {
+		t.Setenv("KRB5CCNAME", c.env)
+		res, err := kerberosCCachePath()
+		if c.expected == "" {
+			assert.Error(t, err, c.env)
+		} else {
+			assert.NoError(t, err, c.env)
+			assert.Equal(t, c.expected, res, c.env)
+		}
+	}
+}
+
+func TestSetKerberosNegotiateAuth(t *testing.T) {
+	// Without a usable ticket cache, setting up authentication fails.
+	t.Setenv("KRB5_CONFIG", "/this/does/not/exist")
+	t.Setenv("KRB5CCNAME", "FILE:/this/does/not/exist")
+	req, err := http.NewRequest(http.MethodGet, "https://registry.example/v2/", nil)
+	require.NoError(t, err)
+	err = setKerberosNegotiateAuth(req)
+	assert.Error(t, err)
+	assert.Empty(t, req.Header.Get("Authorization"))
+}
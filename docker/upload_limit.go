@@ -0,0 +1,31 @@
+package docker
+
+import (
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// uploadSemaphoreKey identifies a process-wide limit of concurrent blob uploads.
+type uploadSemaphoreKey struct {
+	registry string
+	limit    int
+}
+
+var (
+	uploadSemaphoresMutex sync.Mutex // Protects uploadSemaphores
+	uploadSemaphores      = map[uploadSemaphoreKey]*semaphore.Weighted{}
+)
+
+// uploadSemaphore returns the process-wide semaphore limiting blob uploads to registry to limit concurrent uploads.
+func uploadSemaphore(registry string, limit int) *semaphore.Weighted {
+	key := uploadSemaphoreKey{registry: registry, limit: limit}
+	uploadSemaphoresMutex.Lock()
+	defer uploadSemaphoresMutex.Unlock()
+	sem, ok := uploadSemaphores[key]
+	if !ok {
+		sem = semaphore.NewWeighted(int64(limit))
+		uploadSemaphores[key] = sem
+	}
+	return sem
+}
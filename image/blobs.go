@@ -0,0 +1,159 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/imagesource"
+	internalManifest "github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/exp/maps"
+)
+
+// BlobRole describes how an image uses a blob.
+type BlobRole string
+
+const (
+	// BlobRoleManifest is a manifest, or a manifest list.
+	BlobRoleManifest BlobRole = "manifest"
+	// BlobRoleConfig is the config of a single image.
+	BlobRoleConfig BlobRole = "config"
+	// BlobRoleLayer is a layer.
+	BlobRoleLayer BlobRole = "layer"
+	// BlobRoleForeignLayer is a layer which is expected to be downloaded from its URLs, not from the image source.
+	BlobRoleForeignLayer BlobRole = "foreign"
+	// BlobRoleSignature is a signature of a manifest.
+	// The digest and size describe the signature blob as stored (for sigstore, the signed payload).
+	BlobRoleSignature BlobRole = "signature"
+)
+
+// BlobRef describes a blob referenced by an image, as returned by ListBlobs.
+type BlobRef struct {
+	Role        BlobRole
+	Digest      digest.Digest
+	Size        int64             // -1 if unknown
+	MediaType   string            // "" if unknown
+	URLs        []string          // For BlobRoleForeignLayer, the URLs to download the blob from
+	Annotations map[string]string // nil if there are none
+}
+
+// ListBlobs returns all blobs referenced by the image ref: the manifest (and, if ref is a manifest list,
+// the manifest of the instance appropriate for sys), the config, the layers, and the signatures of the manifests,
+// in this order.
+// WARNING: This does not verify the signatures, so the returned list can be used to inspect or transfer an image,
+// but not to decide whether the image is trusted.
+func ListBlobs(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (res []BlobRef, retErr error) {
+	publicSrc, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, fmt.Errorf("initializing source %s: %w", transports.ImageName(ref), err)
+	}
+	src := imagesource.FromPublic(publicSrc)
+	defer func() {
+		if err := src.Close(); err != nil && retErr == nil {
+			res = nil
+			retErr = err
+		}
+	}()
+
+	unparsed := image.UnparsedInstance(src, nil)
+	manifests := []*image.UnparsedImage{unparsed}
+	manifestBlob, manifestType, err := unparsed.Manifest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest for %s: %w", transports.ImageName(ref), err)
+	}
+	manifestDigest, err := manifest.Digest(manifestBlob)
+	if err != nil {
+		return nil, fmt.Errorf("computing manifest digest for %s: %w", transports.ImageName(ref), err)
+	}
+	res = append(res, BlobRef{
+		Role:      BlobRoleManifest,
+		Digest:    manifestDigest,
+		Size:      int64(len(manifestBlob)),
+		MediaType: manifestType,
+	})
+
+	if manifest.MIMETypeIsMultiImage(manifestType) {
+		list, err := internalManifest.ListFromBlob(manifestBlob, manifestType)
+		if err != nil {
+			return nil, fmt.Errorf("parsing primary manifest as list for %s: %w", transports.ImageName(ref), err)
+		}
+		instanceDigest, err := list.ChooseInstance(sys)
+		if err != nil {
+			return nil, fmt.Errorf("choosing an image from manifest list %s: %w", transports.ImageName(ref), err)
+		}
+		unparsed = image.UnparsedInstance(src, &instanceDigest)
+		manifests = append(manifests, unparsed)
+		instanceBlob, instanceType, err := unparsed.Manifest(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("reading manifest %s for %s: %w", instanceDigest, transports.ImageName(ref), err)
+		}
+		res = append(res, BlobRef{
+			Role:      BlobRoleManifest,
+			Digest:    instanceDigest,
+			Size:      int64(len(instanceBlob)),
+			MediaType: instanceType,
+		})
+	}
+
+	img, err := image.FromUnparsedImage(ctx, sys, unparsed)
+	if err != nil {
+		return nil, fmt.Errorf("parsing image %s: %w", transports.ImageName(ref), err)
+	}
+	if config := img.ConfigInfo(); config.Digest != "" {
+		res = append(res, blobRefFromBlobInfo(BlobRoleConfig, config))
+	}
+	for _, layer := range img.LayerInfos() {
+		role := BlobRoleLayer
+		if len(layer.URLs) != 0 {
+			role = BlobRoleForeignLayer
+		}
+		res = append(res, blobRefFromBlobInfo(role, layer))
+	}
+
+	for _, m := range manifests {
+		sigs, err := m.UntrustedSignatures(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("reading signatures for %s: %w", transports.ImageName(ref), err)
+		}
+		for _, sig := range sigs {
+			var blob []byte
+			blobRef := BlobRef{Role: BlobRoleSignature}
+			switch sig := sig.(type) {
+			case signature.SimpleSigning:
+				blob = sig.UntrustedSignature()
+			case signature.Sigstore:
+				blob = sig.UntrustedPayload()
+				blobRef.MediaType = sig.UntrustedMIMEType()
+				if annotations := sig.UntrustedAnnotations(); len(annotations) != 0 {
+					blobRef.Annotations = annotations
+				}
+			default:
+				return nil, fmt.Errorf("unexpected signature format %q", sig.FormatID())
+			}
+			blobRef.Digest = digest.FromBytes(blob)
+			blobRef.Size = int64(len(blob))
+			res = append(res, blobRef)
+		}
+	}
+	return res, nil
+}
+
+// blobRefFromBlobInfo returns a BlobRef with role for info.
+func blobRefFromBlobInfo(role BlobRole, info types.BlobInfo) BlobRef {
+	res := BlobRef{
+		Role:      role,
+		Digest:    info.Digest,
+		Size:      info.Size,
+		MediaType: info.MediaType,
+		URLs:      info.URLs,
+	}
+	if len(info.Annotations) != 0 {
+		res.Annotations = maps.Clone(info.Annotations)
+	}
+	return res
+}
@@ -0,0 +1,153 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListBlobs(t *testing.T) {
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	layer1 := []byte("layer 1")
+	layer2 := []byte("layer 2")
+	foreignDigest := digest.FromString("foreign layer")
+	imageManifest, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config: imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageConfig,
+			Digest:    digest.FromBytes(config),
+			Size:      int64(len(config)),
+		},
+		Layers: []imgspecv1.Descriptor{
+			{
+				MediaType: imgspecv1.MediaTypeImageLayerGzip,
+				Digest:    digest.FromBytes(layer1),
+				Size:      int64(len(layer1)),
+			},
+			{
+				MediaType:   imgspecv1.MediaTypeImageLayerGzip,
+				Digest:      digest.FromBytes(layer2),
+				Size:        int64(len(layer2)),
+				Annotations: map[string]string{"org.example.layer": "2"},
+			},
+			{
+				MediaType: imgspecv1.MediaTypeImageLayerNonDistributableGzip, //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support them.
+				Digest:    foreignDigest,
+				Size:      1234,
+				URLs:      []string{"https://example.com/foreign"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	imageManifestDigest := digest.FromBytes(imageManifest)
+	index, err := json.Marshal(imgspecv1.Index{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{
+			{
+				MediaType: imgspecv1.MediaTypeImageManifest,
+				Digest:    digest.FromString("some other instance"),
+				Size:      100,
+				Platform:  &imgspecv1.Platform{Architecture: "arm64", OS: "linux"},
+			},
+			{
+				MediaType: imgspecv1.MediaTypeImageManifest,
+				Digest:    imageManifestDigest,
+				Size:      int64(len(imageManifest)),
+				Platform:  &imgspecv1.Platform{Architecture: "amd64", OS: "linux"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	simpleSig := []byte("\xA3 not really an OpenPGP signature") // The dir: transport stores simple signing signatures as they are.
+	simpleSigBlob, err := signature.Blob(signature.SimpleSigningFromBlob(simpleSig))
+	require.NoError(t, err)
+	sigstoreSig := signature.SigstoreFromComponents(signature.SigstoreSignatureMIMEType, []byte("sigstore payload"),
+		map[string]string{signature.SigstoreSignatureAnnotationKey: "signature"})
+	sigstoreSigBlob, err := signature.Blob(sigstoreSig)
+	require.NoError(t, err)
+
+	// writeImage writes files to a new directory, and returns a reference to it.
+	writeImage := func(files map[string][]byte) types.ImageReference {
+		dir := t.TempDir()
+		for path, contents := range files {
+			err := os.WriteFile(filepath.Join(dir, path), contents, 0o644)
+			require.NoError(t, err)
+		}
+		ref, err := directory.NewReference(dir)
+		require.NoError(t, err)
+		return ref
+	}
+	sys := &types.SystemContext{ArchitectureChoice: "amd64", OSChoice: "linux"}
+
+	imageBlobs := []BlobRef{
+		{Role: BlobRoleConfig, Digest: digest.FromBytes(config), Size: int64(len(config)), MediaType: imgspecv1.MediaTypeImageConfig},
+		{Role: BlobRoleLayer, Digest: digest.FromBytes(layer1), Size: int64(len(layer1)), MediaType: imgspecv1.MediaTypeImageLayerGzip},
+		{
+			Role: BlobRoleLayer, Digest: digest.FromBytes(layer2), Size: int64(len(layer2)), MediaType: imgspecv1.MediaTypeImageLayerGzip,
+			Annotations: map[string]string{"org.example.layer": "2"},
+		},
+		{
+			Role: BlobRoleForeignLayer, Digest: foreignDigest, Size: 1234, MediaType: imgspecv1.MediaTypeImageLayerNonDistributableGzip, //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support them.
+			URLs: []string{"https://example.com/foreign"},
+		},
+	}
+	simpleSigRef := BlobRef{Role: BlobRoleSignature, Digest: digest.FromBytes(simpleSig), Size: int64(len(simpleSig))}
+	sigstoreSigRef := BlobRef{
+		Role: BlobRoleSignature, Digest: digest.FromString("sigstore payload"), Size: int64(len("sigstore payload")),
+		MediaType:   signature.SigstoreSignatureMIMEType,
+		Annotations: map[string]string{signature.SigstoreSignatureAnnotationKey: "signature"},
+	}
+
+	// A single image
+	ref := writeImage(map[string][]byte{
+		"manifest.json": imageManifest,
+		"signature-1":   simpleSigBlob,
+		"signature-2":   sigstoreSigBlob,
+	})
+	blobs, err := ListBlobs(context.Background(), sys, ref)
+	require.NoError(t, err)
+	expected := []BlobRef{{Role: BlobRoleManifest, Digest: imageManifestDigest, Size: int64(len(imageManifest)), MediaType: imgspecv1.MediaTypeImageManifest}}
+	expected = append(expected, imageBlobs...)
+	expected = append(expected, simpleSigRef, sigstoreSigRef)
+	assert.Equal(t, expected, blobs)
+
+	// A manifest list; signatures of both the list and the instance are included.
+	ref = writeImage(map[string][]byte{
+		"manifest.json": index,
+		"signature-1":   simpleSigBlob,
+		imageManifestDigest.Encoded() + ".manifest.json": imageManifest,
+		imageManifestDigest.Encoded() + ".signature-1":   sigstoreSigBlob,
+	})
+	blobs, err = ListBlobs(context.Background(), sys, ref)
+	require.NoError(t, err)
+	expected = []BlobRef{
+		{Role: BlobRoleManifest, Digest: digest.FromBytes(index), Size: int64(len(index)), MediaType: imgspecv1.MediaTypeImageIndex},
+		{Role: BlobRoleManifest, Digest: imageManifestDigest, Size: int64(len(imageManifest)), MediaType: imgspecv1.MediaTypeImageManifest},
+	}
+	expected = append(expected, imageBlobs...)
+	expected = append(expected, simpleSigRef, sigstoreSigRef)
+	assert.Equal(t, expected, blobs)
+
+	// No instance matches sys
+	_, err = ListBlobs(context.Background(), &types.SystemContext{ArchitectureChoice: "s390x", OSChoice: "linux"}, ref)
+	assert.Error(t, err)
+
+	// Missing image
+	ref, err = directory.NewReference(filepath.Join(t.TempDir(), "this-does-not-exist"))
+	require.NoError(t, err)
+	_, err = ListBlobs(context.Background(), sys, ref)
+	assert.Error(t, err)
+}
@@ -0,0 +1,47 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+)
+
+// Created returns the creation time recorded in the config of the image ref (or, if ref is a manifest list,
+// of the instance appropriate for sys). Only the manifest(s) and the config are read, not the layers.
+// If the config does not record a creation time, or records the zero time, Created returns ok == false.
+func Created(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (created time.Time, ok bool, retErr error) {
+	img, err := image.FromReference(ctx, sys, ref)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer func() {
+		if err := img.Close(); err != nil && retErr == nil {
+			created, ok = time.Time{}, false
+			retErr = err
+		}
+	}()
+
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("reading config of %s: %w", transports.ImageName(ref), err)
+	}
+	if config.Created == nil || config.Created.IsZero() {
+		return time.Time{}, false, nil
+	}
+	return *config.Created, true, nil
+}
+
+// Age returns how long before now the image ref was created; callers would typically use time.Now() as now.
+// It follows the same rules as Created; in particular, if the creation time is not known, Age returns ok == false.
+// If the recorded creation time is after now, the returned age is negative.
+func Age(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, now time.Time) (age time.Duration, ok bool, err error) {
+	created, ok, err := Created(ctx, sys, ref)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	return now.Sub(created), true, nil
+}
@@ -0,0 +1,111 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeImageWithConfig writes an image with config and no layers to a new dir: directory, and returns a reference to it.
+func writeImageWithConfig(t *testing.T, manifestMIMEType string, config []byte) types.ImageReference {
+	dir := t.TempDir()
+	configDigest := digest.FromBytes(config)
+	var manifestBlob []byte
+	var err error
+	switch manifestMIMEType {
+	case manifest.DockerV2Schema2MediaType:
+		manifestBlob, err = manifest.Schema2FromComponents(manifest.Schema2Descriptor{
+			MediaType: manifest.DockerV2Schema2ConfigMediaType,
+			Size:      int64(len(config)),
+			Digest:    configDigest,
+		}, []manifest.Schema2Descriptor{}).Serialize()
+	case imgspecv1.MediaTypeImageManifest:
+		manifestBlob, err = json.Marshal(imgspecv1.Manifest{
+			Versioned: imgspecs.Versioned{SchemaVersion: 2},
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Config: imgspecv1.Descriptor{
+				MediaType: imgspecv1.MediaTypeImageConfig,
+				Digest:    configDigest,
+				Size:      int64(len(config)),
+			},
+			Layers: []imgspecv1.Descriptor{},
+		})
+	default:
+		t.Fatalf("unexpected manifest MIME type %q", manifestMIMEType)
+	}
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "manifest.json"), manifestBlob, 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, configDigest.Encoded()), config, 0o644)
+	require.NoError(t, err)
+	ref, err := directory.NewReference(dir)
+	require.NoError(t, err)
+	return ref
+}
+
+func TestCreatedAndAge(t *testing.T) {
+	created := time.Date(2023, 5, 17, 12, 30, 0, 0, time.UTC)
+	now := created.Add(36 * time.Hour)
+
+	for _, mimeType := range []string{manifest.DockerV2Schema2MediaType, imgspecv1.MediaTypeImageManifest} {
+		for _, c := range []struct {
+			config  string
+			created time.Time
+			ok      bool
+		}{
+			{`{"created":"2023-05-17T12:30:00Z","architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`, created, true},
+			{`{"created":"2023-05-17T14:30:00+02:00","architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`, created, true},
+			{`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`, time.Time{}, false},
+			{`{"created":"0001-01-01T00:00:00Z","architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`, time.Time{}, false},
+		} {
+			ref := writeImageWithConfig(t, mimeType, []byte(c.config))
+
+			res, ok, err := Created(context.Background(), nil, ref)
+			require.NoError(t, err, c.config)
+			assert.Equal(t, c.ok, ok, c.config)
+			assert.True(t, c.created.Equal(res), c.config)
+
+			age, ok, err := Age(context.Background(), nil, ref, now)
+			require.NoError(t, err, c.config)
+			assert.Equal(t, c.ok, ok, c.config)
+			if c.ok {
+				assert.Equal(t, 36*time.Hour, age, c.config)
+			} else {
+				assert.Equal(t, time.Duration(0), age, c.config)
+			}
+		}
+	}
+
+	// A creation time in the future
+	ref := writeImageWithConfig(t, imgspecv1.MediaTypeImageManifest,
+		[]byte(`{"created":"2023-05-17T12:30:00Z","architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`))
+	age, ok, err := Age(context.Background(), nil, ref, created.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, -time.Minute, age)
+
+	// Invalid config
+	ref = writeImageWithConfig(t, imgspecv1.MediaTypeImageManifest, []byte(`{"created":"this is not a time"}`))
+	_, _, err = Created(context.Background(), nil, ref)
+	assert.Error(t, err)
+	_, _, err = Age(context.Background(), nil, ref, now)
+	assert.Error(t, err)
+
+	// Missing image
+	ref, err = directory.NewReference(filepath.Join(t.TempDir(), "this-does-not-exist"))
+	require.NoError(t, err)
+	_, _, err = Created(context.Background(), nil, ref)
+	assert.Error(t, err)
+}
@@ -0,0 +1,128 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/pkg/digestverify"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// DiffIDOptions allows supplying non-default configuration modifying the behavior of LayerDiffIDs and LayerByDiffIDWithOptions.
+type DiffIDOptions struct {
+	// If ComputeMissingDiffIDs is set, and the image does not have a config listing the DiffIDs of its layers
+	// (e.g. because it is an artifact with a non-image config, or its config has no rootfs.diff_ids),
+	// the DiffIDs are computed by reading and decompressing the layers.
+	// This may require downloading all layers of the image, so it is only done if explicitly requested.
+	ComputeMissingDiffIDs bool
+	// BlobInfoCache is used to look up DiffIDs computed earlier, and to record newly computed ones,
+	// if ComputeMissingDiffIDs is set. If nil, blobinfocache.DefaultCache(sys) is used.
+	BlobInfoCache types.BlobInfoCache
+}
+
+// LayerDiffIDs returns the DiffIDs (digests of the uncompressed layers) of all layers of the image ref
+// (or, if ref is a manifest list, of the instance appropriate for sys), in the order of the layers.
+// Normally, the DiffIDs are read from the config of the image, and the layers are not read at all;
+// see DiffIDOptions.ComputeMissingDiffIDs for images without such a config. options may be nil.
+func LayerDiffIDs(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, options *DiffIDOptions) (_ []digest.Digest, retErr error) {
+	publicSrc, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, fmt.Errorf("initializing source %s: %w", transports.ImageName(ref), err)
+	}
+	src := imagesource.FromPublic(publicSrc)
+	defer func() {
+		if err := src.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, nil))
+	if err != nil {
+		return nil, fmt.Errorf("parsing image %s: %w", transports.ImageName(ref), err)
+	}
+	return layerDiffIDs(ctx, sys, ref, src, img, options)
+}
+
+// layerDiffIDs implements LayerDiffIDs for img, read from src.
+func layerDiffIDs(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, src private.ImageSource, img types.Image,
+	options *DiffIDOptions) ([]digest.Digest, error) {
+	if options == nil {
+		options = &DiffIDOptions{}
+	}
+	layers := img.LayerInfos()
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		var nonImage manifest.NonImageArtifactError
+		if !options.ComputeMissingDiffIDs || !errors.As(err, &nonImage) {
+			return nil, fmt.Errorf("reading config of %s: %w", transports.ImageName(ref), err)
+		}
+	} else {
+		if len(config.RootFS.DiffIDs) == len(layers) {
+			return config.RootFS.DiffIDs, nil
+		}
+		// A config which lists some, but not all, DiffIDs is broken, not missing data; don’t paper over that.
+		if !options.ComputeMissingDiffIDs || len(config.RootFS.DiffIDs) != 0 {
+			return nil, fmt.Errorf("image %s has %d layers, but its config lists %d DiffIDs", transports.ImageName(ref), len(layers), len(config.RootFS.DiffIDs))
+		}
+	}
+
+	cache := options.BlobInfoCache
+	if cache == nil {
+		cache = blobinfocache.DefaultCache(sys)
+	}
+	res := make([]digest.Digest, 0, len(layers))
+	for _, layer := range layers {
+		diffID, err := computeDiffID(ctx, src, layer, cache)
+		if err != nil {
+			return nil, fmt.Errorf("computing DiffID of layer %s of %s: %w", layer.Digest, transports.ImageName(ref), err)
+		}
+		res = append(res, diffID)
+	}
+	return res, nil
+}
+
+// computeDiffID returns the DiffID of layer, read from src, using cache to look up, and record, the result.
+func computeDiffID(ctx context.Context, src private.ImageSource, layer types.BlobInfo, cache types.BlobInfoCache) (digest.Digest, error) {
+	if diffID := cache.UncompressedDigest(layer.Digest); diffID != "" {
+		return diffID, nil
+	}
+	if mediaType, ok := manifest.IsLayer(layer.MediaType); ok && mediaType.Encrypted {
+		return "", errors.New("the layer is encrypted")
+	}
+
+	stream, _, err := src.GetBlob(ctx, layer, cache)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+	verifier, err := digestverify.NewReader(stream, layer.Digest, layer.Size)
+	if err != nil {
+		return "", err
+	}
+	decompressed, _, err := compression.AutoDecompress(verifier)
+	if err != nil {
+		return "", err
+	}
+	defer decompressed.Close()
+	diffID, err := digest.Canonical.FromReader(decompressed)
+	if err != nil {
+		return "", err
+	}
+	// The decompressor might not consume all of the compressed stream; make sure all of it has been verified
+	// before recording the DiffID.
+	if _, err := io.Copy(io.Discard, verifier); err != nil {
+		return "", err
+	}
+	cache.RecordDigestUncompressedPair(layer.Digest, diffID)
+	return diffID, nil
+}
@@ -0,0 +1,168 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// diffIDTestLayers are the uncompressed contents of layers of images created by writeDiffIDTestImage.
+var diffIDTestLayers = [][]byte{
+	[]byte("uncompressed layer"),
+	[]byte("gzip-compressed layer"),
+	[]byte("zstd-compressed layer"),
+}
+
+// writeDiffIDTestImage writes an image with diffIDTestLayers and a config with configMediaType and contents config
+// to a new directory. It returns a reference to the image, the path to the directory, and the layer descriptors.
+func writeDiffIDTestImage(t *testing.T, configMediaType string, config []byte) (types.ImageReference, string, []imgspecv1.Descriptor) {
+	dir := t.TempDir()
+	descriptors := []imgspecv1.Descriptor{}
+	for i, layer := range [][]byte{
+		diffIDTestLayers[0],
+		compressLayer(t, diffIDTestLayers[1], compression.Gzip),
+		compressLayer(t, diffIDTestLayers[2], compression.Zstd),
+	} {
+		d := digest.FromBytes(layer)
+		err := os.WriteFile(filepath.Join(dir, d.Encoded()), layer, 0o644)
+		require.NoError(t, err)
+		descriptors = append(descriptors, imgspecv1.Descriptor{
+			MediaType: []string{imgspecv1.MediaTypeImageLayer, imgspecv1.MediaTypeImageLayerGzip, imgspecv1.MediaTypeImageLayerZstd}[i],
+			Digest:    d,
+			Size:      int64(len(layer)),
+		})
+	}
+	manifestBlob, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config: imgspecv1.Descriptor{
+			MediaType: configMediaType,
+			Digest:    digest.FromBytes(config),
+			Size:      int64(len(config)),
+		},
+		Layers: descriptors,
+	})
+	require.NoError(t, err)
+	for path, contents := range map[string][]byte{
+		digest.FromBytes(config).Encoded(): config,
+		"manifest.json":                    manifestBlob,
+	} {
+		err := os.WriteFile(filepath.Join(dir, path), contents, 0o644)
+		require.NoError(t, err)
+	}
+	ref, err := directory.NewReference(dir)
+	require.NoError(t, err)
+	return ref, dir, descriptors
+}
+
+func TestLayerDiffIDs(t *testing.T) {
+	expected := []digest.Digest{}
+	for _, layer := range diffIDTestLayers {
+		expected = append(expected, digest.FromBytes(layer))
+	}
+	removeLayers := func(dir string, descriptors []imgspecv1.Descriptor) {
+		for _, d := range descriptors {
+			err := os.Remove(filepath.Join(dir, d.Digest.Encoded()))
+			require.NoError(t, err)
+		}
+	}
+
+	// An image config listing DiffIDs is used without reading the layers, even if ComputeMissingDiffIDs is set
+	config, err := json.Marshal(imgspecv1.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       imgspecv1.RootFS{Type: "layers", DiffIDs: expected},
+	})
+	require.NoError(t, err)
+	ref, dir, descriptors := writeDiffIDTestImage(t, imgspecv1.MediaTypeImageConfig, config)
+	removeLayers(dir, descriptors)
+	for _, options := range []*DiffIDOptions{nil, {ComputeMissingDiffIDs: true, BlobInfoCache: memory.New()}} {
+		res, err := LayerDiffIDs(context.Background(), nil, ref, options)
+		require.NoError(t, err)
+		assert.Equal(t, expected, res)
+	}
+
+	for _, c := range []struct {
+		name            string
+		configMediaType string
+		config          []byte
+	}{
+		{"artifact", "application/vnd.oci.empty.v1+json", []byte("{}")},
+		{"no diff_ids", imgspecv1.MediaTypeImageConfig, []byte(`{"architecture":"amd64","os":"linux"}`)},
+	} {
+		ref, dir, descriptors := writeDiffIDTestImage(t, c.configMediaType, c.config)
+
+		// Computing the DiffIDs must be explicitly requested
+		_, err := LayerDiffIDs(context.Background(), nil, ref, nil)
+		assert.Error(t, err, c.name)
+		if c.configMediaType != imgspecv1.MediaTypeImageConfig {
+			var nonImage manifest.NonImageArtifactError
+			assert.ErrorAs(t, err, &nonImage, c.name)
+		}
+
+		cache := memory.New()
+		options := &DiffIDOptions{ComputeMissingDiffIDs: true, BlobInfoCache: cache}
+		res, err := LayerDiffIDs(context.Background(), nil, ref, options)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, expected, res, c.name)
+		for i, d := range descriptors {
+			assert.Equal(t, expected[i], cache.UncompressedDigest(d.Digest), c.name)
+		}
+
+		// The layers can be found by DiffID
+		for i, diffID := range expected {
+			stream, err := LayerByDiffIDWithOptions(context.Background(), nil, ref, diffID, options)
+			require.NoError(t, err, c.name)
+			contents, err := io.ReadAll(stream)
+			require.NoError(t, err, c.name)
+			assert.Equal(t, diffIDTestLayers[i], contents, c.name)
+			err = stream.Close()
+			assert.NoError(t, err, c.name)
+		}
+		_, err = LayerByDiffIDWithOptions(context.Background(), nil, ref, digest.FromString("unknown layer"), options)
+		assert.ErrorIs(t, err, ErrLayerNotFound, c.name)
+
+		// With a cache, the layers are not read again
+		removeLayers(dir, descriptors)
+		res, err = LayerDiffIDs(context.Background(), nil, ref, options)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, expected, res, c.name)
+		// … but without a cache, they are.
+		_, err = LayerDiffIDs(context.Background(), nil, ref, &DiffIDOptions{ComputeMissingDiffIDs: true, BlobInfoCache: memory.New()})
+		assert.Error(t, err, c.name)
+	}
+
+	// A config listing some, but not all, DiffIDs is not silently ignored
+	config, err = json.Marshal(imgspecv1.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       imgspecv1.RootFS{Type: "layers", DiffIDs: expected[:2]},
+	})
+	require.NoError(t, err)
+	ref, _, _ = writeDiffIDTestImage(t, imgspecv1.MediaTypeImageConfig, config)
+	_, err = LayerDiffIDs(context.Background(), nil, ref, &DiffIDOptions{ComputeMissingDiffIDs: true, BlobInfoCache: memory.New()})
+	assert.Error(t, err)
+
+	// A layer which does not match its digest is rejected, and nothing is recorded in the cache
+	ref, dir, descriptors = writeDiffIDTestImage(t, "application/vnd.oci.empty.v1+json", []byte("{}"))
+	err = os.WriteFile(filepath.Join(dir, descriptors[0].Digest.Encoded()), []byte("uncompressed LAYER"), 0o644)
+	require.NoError(t, err)
+	cache := memory.New()
+	_, err = LayerDiffIDs(context.Background(), nil, ref, &DiffIDOptions{ComputeMissingDiffIDs: true, BlobInfoCache: cache})
+	assert.Error(t, err)
+	assert.Equal(t, digest.Digest(""), cache.UncompressedDigest(descriptors[0].Digest))
+}
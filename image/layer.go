@@ -0,0 +1,118 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/pkg/digestverify"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// ErrLayerNotFound is returned (possibly wrapped, detect it using errors.Is) by LayerByDiffID
+// if the image does not contain a layer with the requested DiffID.
+var ErrLayerNotFound = errors.New("layer not found")
+
+// LayerByDiffID returns the uncompressed contents of the layer with DiffID (the digest of the uncompressed layer)
+// diffID, of the image ref (or, if ref is a manifest list, of the instance appropriate for sys),
+// regardless of how the layer is compressed in ref.
+// The caller must call Close() on the returned stream.
+//
+// The contents are verified against diffID while they are read: the stream returns io.EOF only if they match,
+// and otherwise an error wrapping digestverify.ErrDigestMismatch. The data MUST NOT be trusted until io.EOF is reached.
+// If the image does not contain such a layer, LayerByDiffID returns an error wrapping ErrLayerNotFound.
+func LayerByDiffID(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, diffID digest.Digest) (io.ReadCloser, error) {
+	return LayerByDiffIDWithOptions(ctx, sys, ref, diffID, nil)
+}
+
+// LayerByDiffIDWithOptions is LayerByDiffID, with non-default configuration in options, which may be nil.
+// With options.ComputeMissingDiffIDs, it also works on images without a config listing the DiffIDs,
+// at the cost of reading the layers to compute their DiffIDs first.
+func LayerByDiffIDWithOptions(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, diffID digest.Digest,
+	options *DiffIDOptions) (_ io.ReadCloser, retErr error) {
+	if err := diffID.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid DiffID %q: %w", diffID, err)
+	}
+
+	publicSrc, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, fmt.Errorf("initializing source %s: %w", transports.ImageName(ref), err)
+	}
+	src := imagesource.FromPublic(publicSrc)
+	closers := []io.Closer{src}
+	defer func() {
+		if retErr != nil {
+			closeAll(closers)
+		}
+	}()
+
+	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, nil))
+	if err != nil {
+		return nil, fmt.Errorf("parsing image %s: %w", transports.ImageName(ref), err)
+	}
+	diffIDs, err := layerDiffIDs(ctx, sys, ref, src, img, options)
+	if err != nil {
+		return nil, err
+	}
+	layers := img.LayerInfos()
+	layerIndex := -1
+	for i, d := range diffIDs {
+		if d == diffID {
+			layerIndex = i
+			break
+		}
+	}
+	if layerIndex == -1 {
+		return nil, fmt.Errorf("DiffID %s in %s: %w", diffID, transports.ImageName(ref), ErrLayerNotFound)
+	}
+	layer := layers[layerIndex]
+	if mediaType, ok := manifest.IsLayer(layer.MediaType); ok && mediaType.Encrypted {
+		return nil, fmt.Errorf("layer %s of %s is encrypted", layer.Digest, transports.ImageName(ref))
+	}
+
+	stream, _, err := src.GetBlob(ctx, layer, none.NoCache)
+	if err != nil {
+		return nil, fmt.Errorf("reading layer %s of %s: %w", layer.Digest, transports.ImageName(ref), err)
+	}
+	closers = append(closers, stream)
+	decompressed, _, err := compression.AutoDecompress(stream)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing layer %s of %s: %w", layer.Digest, transports.ImageName(ref), err)
+	}
+	closers = append(closers, decompressed)
+	verifier, err := digestverify.NewReader(decompressed, diffID, -1)
+	if err != nil {
+		return nil, err
+	}
+	return &layerReader{Reader: verifier, closers: closers}, nil
+}
+
+// layerReader is the io.ReadCloser returned by LayerByDiffID, which closes all objects used to read the layer.
+type layerReader struct {
+	io.Reader
+	closers []io.Closer // In the order the objects were created
+}
+
+// Close implements io.Closer.
+func (r *layerReader) Close() error {
+	return closeAll(r.closers)
+}
+
+// closeAll closes closers in reverse order, and returns the first error, if any.
+func closeAll(closers []io.Closer) error {
+	var res error
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil && res == nil {
+			res = err
+		}
+	}
+	return res
+}
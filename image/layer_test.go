@@ -0,0 +1,130 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/pkg/digestverify"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// compressLayer returns contents compressed using algo.
+func compressLayer(t *testing.T, contents []byte, algo compression.Algorithm) []byte {
+	var buf bytes.Buffer
+	writer, err := compression.CompressStream(&buf, algo, nil)
+	require.NoError(t, err)
+	_, err = writer.Write(contents)
+	require.NoError(t, err)
+	err = writer.Close()
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestLayerByDiffID(t *testing.T) {
+	uncompressedLayers := [][]byte{
+		[]byte("uncompressed layer"),
+		[]byte("gzip-compressed layer"),
+		[]byte("zstd-compressed layer"),
+	}
+	layers := []struct {
+		blob      []byte
+		mediaType string
+	}{
+		{uncompressedLayers[0], imgspecv1.MediaTypeImageLayer},
+		{compressLayer(t, uncompressedLayers[1], compression.Gzip), imgspecv1.MediaTypeImageLayerGzip},
+		{compressLayer(t, uncompressedLayers[2], compression.Zstd), imgspecv1.MediaTypeImageLayerZstd},
+	}
+
+	// writeImage writes an image with layers and diffIDs in its config to a new directory, and returns a reference to it.
+	writeImage := func(diffIDs []digest.Digest) types.ImageReference {
+		dir := t.TempDir()
+		config, err := json.Marshal(imgspecv1.Image{
+			Architecture: "amd64",
+			OS:           "linux",
+			RootFS:       imgspecv1.RootFS{Type: "layers", DiffIDs: diffIDs},
+		})
+		require.NoError(t, err)
+		descriptors := []imgspecv1.Descriptor{}
+		for _, layer := range layers {
+			d := digest.FromBytes(layer.blob)
+			err := os.WriteFile(filepath.Join(dir, d.Encoded()), layer.blob, 0o644)
+			require.NoError(t, err)
+			descriptors = append(descriptors, imgspecv1.Descriptor{MediaType: layer.mediaType, Digest: d, Size: int64(len(layer.blob))})
+		}
+		manifestBlob, err := json.Marshal(imgspecv1.Manifest{
+			Versioned: imgspecs.Versioned{SchemaVersion: 2},
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Config: imgspecv1.Descriptor{
+				MediaType: imgspecv1.MediaTypeImageConfig,
+				Digest:    digest.FromBytes(config),
+				Size:      int64(len(config)),
+			},
+			Layers: descriptors,
+		})
+		require.NoError(t, err)
+		for path, contents := range map[string][]byte{
+			digest.FromBytes(config).Encoded(): config,
+			"manifest.json":                    manifestBlob,
+		} {
+			err := os.WriteFile(filepath.Join(dir, path), contents, 0o644)
+			require.NoError(t, err)
+		}
+		ref, err := directory.NewReference(dir)
+		require.NoError(t, err)
+		return ref
+	}
+
+	diffIDs := []digest.Digest{}
+	for _, layer := range uncompressedLayers {
+		diffIDs = append(diffIDs, digest.FromBytes(layer))
+	}
+	ref := writeImage(diffIDs)
+
+	// Success, regardless of the compression
+	for i, diffID := range diffIDs {
+		stream, err := LayerByDiffID(context.Background(), nil, ref, diffID)
+		require.NoError(t, err, diffID.String())
+		contents, err := io.ReadAll(stream)
+		require.NoError(t, err, diffID.String())
+		assert.Equal(t, uncompressedLayers[i], contents, diffID.String())
+		err = stream.Close()
+		assert.NoError(t, err, diffID.String())
+	}
+
+	// Unknown DiffID
+	_, err := LayerByDiffID(context.Background(), nil, ref, digest.FromString("unknown layer"))
+	assert.ErrorIs(t, err, ErrLayerNotFound)
+
+	// Invalid DiffID
+	_, err = LayerByDiffID(context.Background(), nil, ref, "sha256:invalid")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrLayerNotFound)
+
+	// The config lists a DiffID which does not match the layer contents
+	wrongDiffID := digest.FromString("not the gzip-compressed layer")
+	ref = writeImage([]digest.Digest{diffIDs[0], wrongDiffID, diffIDs[2]})
+	stream, err := LayerByDiffID(context.Background(), nil, ref, wrongDiffID)
+	require.NoError(t, err)
+	_, err = io.ReadAll(stream)
+	assert.ErrorIs(t, err, digestverify.ErrDigestMismatch)
+	err = stream.Close()
+	assert.NoError(t, err)
+
+	// The config lists a different number of DiffIDs than there are layers
+	ref = writeImage(diffIDs[:2])
+	_, err = LayerByDiffID(context.Background(), nil, ref, diffIDs[0])
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrLayerNotFound)
+}
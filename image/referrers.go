@@ -0,0 +1,126 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultReferrersMaxDepth is the maximum depth of WalkReferrers if WalkReferrersOptions.MaxDepth is not set.
+const defaultReferrersMaxDepth = 8
+
+var (
+	// ErrReferrersNotSupported is returned (possibly wrapped, detect it using errors.Is) by WalkReferrers
+	// if the source does not support listing referrers.
+	ErrReferrersNotSupported = errors.New("listing referrers is not supported")
+	// ErrSkipReferrers can be returned by a WalkReferrers callback to skip listing the referrers of the current node.
+	ErrSkipReferrers = errors.New("skip referrers of this node")
+)
+
+// ReferrerNode is a manifest found by WalkReferrers.
+type ReferrerNode struct {
+	// Descriptor of the manifest, as reported by the source; ArtifactType and Annotations describe the artifact.
+	Descriptor imgspecv1.Descriptor
+	// Subject is the digest of the manifest this manifest refers to.
+	Subject digest.Digest
+	// Depth is 1 for manifests referring to the starting manifest, 2 for manifests referring to those, and so on.
+	Depth int
+}
+
+// WalkReferrersOptions allows supplying non-default configuration modifying the behavior of WalkReferrers.
+type WalkReferrersOptions struct {
+	// MaxDepth is the maximum Depth of visited nodes; referrers of nodes at MaxDepth are not listed.
+	// If 0, a default of 8 is used.
+	MaxDepth int
+}
+
+// WalkReferrers walks the graph of manifests in src which refer to the manifest with manifestDigest using their subject field
+// (i.e. OCI 1.1 referrers), directly or through other referrers, in depth-first order.
+//
+// visit is called for every node before listing its referrers. If it returns ErrSkipReferrers, the referrers of the node
+// are not listed; any other non-nil error stops the walk, and is returned by WalkReferrers.
+// Every manifest is visited at most once, even if the source reports it as a referrer of several manifests,
+// or in a cycle; with a truthful source, neither can happen, because a manifest has only a single subject.
+// Note that the nodes are only reported by the source, and the manifests are not fetched or verified;
+// visit can fetch them using src.GetManifest, if necessary.
+//
+// It fails with an error wrapping ErrReferrersNotSupported if src can’t list referrers.
+func WalkReferrers(ctx context.Context, src types.ImageSource, manifestDigest digest.Digest, options *WalkReferrersOptions,
+	visit func(node ReferrerNode) error) error {
+	if options == nil {
+		options = &WalkReferrersOptions{}
+	}
+	maxDepth := options.MaxDepth
+	switch {
+	case maxDepth < 0:
+		return fmt.Errorf("invalid maximum referrers depth %d", maxDepth)
+	case maxDepth == 0:
+		maxDepth = defaultReferrersMaxDepth
+	}
+	if err := manifestDigest.Validate(); err != nil {
+		return fmt.Errorf("invalid manifest digest %q: %w", manifestDigest, err)
+	}
+	referrersSrc, ok := src.(private.ReferrersSource)
+	if !ok {
+		return fmt.Errorf("listing referrers of %s: %w", manifestDigest, ErrReferrersNotSupported)
+	}
+
+	w := referrersWalker{
+		src:      referrersSrc,
+		maxDepth: maxDepth,
+		visit:    visit,
+		visited:  map[digest.Digest]struct{}{manifestDigest: {}},
+	}
+	return w.walk(ctx, manifestDigest, 1)
+}
+
+// referrersWalker is the state of a single WalkReferrers call.
+type referrersWalker struct {
+	src      private.ReferrersSource
+	maxDepth int
+	visit    func(node ReferrerNode) error
+	visited  map[digest.Digest]struct{} // Manifests which have already been visited, including the starting manifest
+}
+
+// walk visits the referrers of subject, which are at depth, and their referrers.
+func (w *referrersWalker) walk(ctx context.Context, subject digest.Digest, depth int) error {
+	referrers, supported, err := w.src.GetReferrers(ctx, subject, "")
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return fmt.Errorf("listing referrers of %s: %w", subject, ErrReferrersNotSupported)
+	}
+	for _, desc := range referrers {
+		if err := desc.Digest.Validate(); err != nil {
+			return fmt.Errorf("invalid digest %q of a referrer of %s: %w", desc.Digest, subject, err)
+		}
+		if _, ok := w.visited[desc.Digest]; ok {
+			logrus.Debugf("Referrer %s of %s has already been visited, ignoring", desc.Digest, subject)
+			continue
+		}
+		w.visited[desc.Digest] = struct{}{}
+
+		err := w.visit(ReferrerNode{Descriptor: desc, Subject: subject, Depth: depth})
+		switch {
+		case errors.Is(err, ErrSkipReferrers):
+			continue
+		case err != nil:
+			return err
+		}
+		if depth >= w.maxDepth {
+			logrus.Debugf("Not listing referrers of %s, maximum depth %d reached", desc.Digest, w.maxDepth)
+			continue
+		}
+		if err := w.walk(ctx, desc.Digest, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/containers/image/v5/internal/testing/mocks"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// referrersSource is an ImageSource which only supports GetReferrers.
+type referrersSource struct {
+	mocks.ForbiddenImageSource
+	referrers   map[digest.Digest][]imgspecv1.Descriptor
+	unsupported bool
+	listed      []digest.Digest
+}
+
+func (s *referrersSource) GetReferrers(ctx context.Context, manifestDigest digest.Digest, artifactType string) ([]imgspecv1.Descriptor, bool, error) {
+	if artifactType != "" {
+		return nil, false, fmt.Errorf("unexpected artifact type %q", artifactType)
+	}
+	s.listed = append(s.listed, manifestDigest)
+	if s.unsupported {
+		return nil, false, nil
+	}
+	return s.referrers[manifestDigest], true, nil
+}
+
+// referrerDigest returns a digest of a manifest called name.
+func referrerDigest(name string) digest.Digest {
+	return digest.FromString(name)
+}
+
+// newReferrersSource returns a referrersSource with referrers of manifests specified as name → names of referrers.
+func newReferrersSource(graph map[string][]string) *referrersSource {
+	src := &referrersSource{referrers: map[digest.Digest][]imgspecv1.Descriptor{}}
+	for subject, referrers := range graph {
+		for _, r := range referrers {
+			src.referrers[referrerDigest(subject)] = append(src.referrers[referrerDigest(subject)], imgspecv1.Descriptor{
+				MediaType:    imgspecv1.MediaTypeImageManifest,
+				Digest:       referrerDigest(r),
+				Size:         int64(len(r)),
+				ArtifactType: "application/vnd.example." + r,
+				Annotations:  map[string]string{"name": r},
+			})
+		}
+	}
+	return src
+}
+
+// visitedNode is a simplified ReferrerNode.
+type visitedNode struct {
+	name, subject string
+	depth         int
+}
+
+// walkReferrers calls WalkReferrers, and returns the visited nodes.
+func walkReferrers(t *testing.T, src *referrersSource, root string, options *WalkReferrersOptions, visit func(node ReferrerNode) error) ([]visitedNode, error) {
+	names := map[digest.Digest]string{referrerDigest(root): root}
+	for _, referrers := range src.referrers {
+		for _, r := range referrers {
+			names[r.Digest] = r.Annotations["name"]
+		}
+	}
+	res := []visitedNode{}
+	err := WalkReferrers(context.Background(), src, referrerDigest(root), options, func(node ReferrerNode) error {
+		name := names[node.Descriptor.Digest]
+		assert.Equal(t, "application/vnd.example."+name, node.Descriptor.ArtifactType)
+		res = append(res, visitedNode{name: name, subject: names[node.Subject], depth: node.Depth})
+		if visit != nil {
+			return visit(node)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func TestWalkReferrers(t *testing.T) {
+	// image ← sbom ← sbom-signature ← countersignature; image ← signature
+	graph := map[string][]string{
+		"image":          {"sbom", "signature"},
+		"sbom":           {"sbom-signature"},
+		"sbom-signature": {"countersignature"},
+	}
+
+	// Everything
+	src := newReferrersSource(graph)
+	nodes, err := walkReferrers(t, src, "image", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []visitedNode{
+		{"sbom", "image", 1},
+		{"sbom-signature", "sbom", 2},
+		{"countersignature", "sbom-signature", 3},
+		{"signature", "image", 1},
+	}, nodes)
+	assert.Len(t, src.listed, 5)
+
+	// Limited depth
+	src = newReferrersSource(graph)
+	nodes, err = walkReferrers(t, src, "image", &WalkReferrersOptions{MaxDepth: 2}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []visitedNode{
+		{"sbom", "image", 1},
+		{"sbom-signature", "sbom", 2},
+		{"signature", "image", 1},
+	}, nodes)
+	assert.NotContains(t, src.listed, referrerDigest("sbom-signature"))
+
+	// Pruning
+	src = newReferrersSource(graph)
+	nodes, err = walkReferrers(t, src, "image", nil, func(node ReferrerNode) error {
+		if node.Descriptor.Annotations["name"] == "sbom" {
+			return ErrSkipReferrers
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []visitedNode{{"sbom", "image", 1}, {"signature", "image", 1}}, nodes)
+	assert.NotContains(t, src.listed, referrerDigest("sbom"))
+
+	// A callback failure stops the walk
+	callbackErr := errors.New("callback failed")
+	src = newReferrersSource(graph)
+	nodes, err = walkReferrers(t, src, "image", nil, func(node ReferrerNode) error {
+		if node.Depth == 2 {
+			return fmt.Errorf("wrapped: %w", callbackErr)
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, callbackErr)
+	assert.Equal(t, []visitedNode{{"sbom", "image", 1}, {"sbom-signature", "sbom", 2}}, nodes)
+
+	// No referrers
+	src = newReferrersSource(graph)
+	nodes, err = walkReferrers(t, src, "signature", nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, nodes)
+
+	// Invalid options and digests
+	src = newReferrersSource(graph)
+	_, err = walkReferrers(t, src, "image", &WalkReferrersOptions{MaxDepth: -1}, nil)
+	assert.Error(t, err)
+	err = WalkReferrers(context.Background(), src, "sha256:invalid", nil, func(node ReferrerNode) error { return nil })
+	assert.Error(t, err)
+	assert.Empty(t, src.listed)
+
+	// Unsupported
+	src = newReferrersSource(graph)
+	src.unsupported = true
+	_, err = walkReferrers(t, src, "image", nil, nil)
+	assert.ErrorIs(t, err, ErrReferrersNotSupported)
+	err = WalkReferrers(context.Background(), mocks.ForbiddenImageSource{}, referrerDigest("image"), nil, func(node ReferrerNode) error { return nil })
+	assert.ErrorIs(t, err, ErrReferrersNotSupported)
+}
+
+func TestWalkReferrersMaliciousSource(t *testing.T) {
+	// A cycle, including the starting manifest
+	src := newReferrersSource(map[string][]string{
+		"image": {"a"},
+		"a":     {"b", "image"},
+		"b":     {"a", "b"},
+	})
+	nodes, err := walkReferrers(t, src, "image", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []visitedNode{{"a", "image", 1}, {"b", "a", 2}}, nodes)
+
+	// A manifest reported as a referrer of several manifests is visited once
+	src = newReferrersSource(map[string][]string{
+		"image": {"a", "b"},
+		"a":     {"c"},
+		"b":     {"c"},
+	})
+	nodes, err = walkReferrers(t, src, "image", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []visitedNode{{"a", "image", 1}, {"c", "a", 2}, {"b", "image", 1}}, nodes)
+
+	// An infinitely deep graph is limited by the default depth
+	src = &referrersSource{referrers: map[digest.Digest][]imgspecv1.Descriptor{}}
+	for i := 0; i < 100; i++ {
+		src.referrers[referrerDigest(fmt.Sprintf("n%d", i))] = []imgspecv1.Descriptor{{
+			Digest:       referrerDigest(fmt.Sprintf("n%d", i+1)),
+			ArtifactType: fmt.Sprintf("application/vnd.example.n%d", i+1),
+			Annotations:  map[string]string{"name": fmt.Sprintf("n%d", i+1)},
+		}}
+	}
+	nodes, err = walkReferrers(t, src, "n0", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, nodes, defaultReferrersMaxDepth)
+
+	// Invalid digests
+	src = &referrersSource{referrers: map[digest.Digest][]imgspecv1.Descriptor{
+		referrerDigest("image"): {{Digest: "sha256:../../etc/passwd"}},
+	}}
+	_, err = walkReferrers(t, src, "image", nil, nil)
+	assert.Error(t, err)
+}
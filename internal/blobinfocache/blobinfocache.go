@@ -30,6 +30,10 @@ func (bic *v1OnlyBlobInfoCache) CandidateLocations2(transport types.ImageTranspo
 	return nil
 }
 
+func (bic *v1OnlyBlobInfoCache) CompressionVariants(uncompressedDigest digest.Digest) []BICCompressionVariant {
+	return nil
+}
+
 // CandidateLocationsFromV2 converts a slice of BICReplacementCandidate2 to a slice of
 // types.BICReplacementCandidate, dropping compression information.
 func CandidateLocationsFromV2(v2candidates []BICReplacementCandidate2) []types.BICReplacementCandidate {
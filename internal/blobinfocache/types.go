@@ -35,6 +35,12 @@ type BlobInfoCache2 interface {
 	//
 	// The CompressorName fields in returned data must never be UnknownCompression.
 	CandidateLocations2(transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest, canSubstitute bool) []BICReplacementCandidate2
+	// CompressionVariants returns the known variants of the blob with the uncompressed digest uncompressedDigest,
+	// i.e. the blobs recorded using RecordDigestUncompressedPair for which a compressor was recorded using RecordDigestCompressorName,
+	// sorted by digest. uncompressedDigest itself is included if it was recorded to be Uncompressed.
+	//
+	// The CompressorName fields in returned data must never be UnknownCompression.
+	CompressionVariants(uncompressedDigest digest.Digest) []BICCompressionVariant
 }
 
 // BICReplacementCandidate2 is an item returned by BlobInfoCache2.CandidateLocations2.
@@ -43,3 +49,9 @@ type BICReplacementCandidate2 struct {
 	CompressorName string // either the Name() of a known pkg/compression.Algorithm, or Uncompressed or UnknownCompression
 	Location       types.BICLocationReference
 }
+
+// BICCompressionVariant is an item returned by BlobInfoCache2.CompressionVariants.
+type BICCompressionVariant struct {
+	Digest         digest.Digest
+	CompressorName string // either the Name() of a known pkg/compression.Algorithm, or Uncompressed
+}
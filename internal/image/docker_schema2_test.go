@@ -188,6 +188,18 @@ func TestManifestSchema2ConfigBlob(t *testing.T) {
 		}
 	}
 
+	// A config which does not match the descriptor is reported using a ConfigDigestMismatchError
+	nonmatchingJSON := []byte("This does not match ConfigDescriptor.Digest")
+	src := configBlobImageSource{f: func() (io.ReadCloser, int64, error) {
+		return io.NopCloser(bytes.NewReader(nonmatchingJSON)), int64(len(nonmatchingJSON)), nil
+	}}
+	mismatched := manifestSchema2FromFixture(t, src, "schema2.json", false)
+	_, err = mismatched.ConfigBlob(context.Background())
+	var mismatchErr manifest.ConfigDigestMismatchError
+	require.ErrorAs(t, err, &mismatchErr)
+	assert.Equal(t, mismatched.ConfigInfo().Digest, mismatchErr.Expected)
+	assert.Equal(t, digest.FromBytes(nonmatchingJSON), mismatchErr.Actual)
+
 	// Generally configBlob should match ConfigInfo; we don’t quite need it to, and this will
 	// guarantee that the returned object is returning the original contents instead
 	// of reading an object from elsewhere.
@@ -5,7 +5,10 @@ import (
 	"fmt"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/iolimits"
+	internalManifest "github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
 	"github.com/containers/image/v5/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
@@ -119,3 +122,25 @@ func convertManifestIfRequiredWithUpdate(ctx context.Context, options types.Mani
 	optionsCopy.ManifestMIMEType = ""
 	return convertedImage.UpdatedImage(ctx, optionsCopy)
 }
+
+// fetchConfigBlob reads the config blob described by info from src, and verifies that it matches info.Digest.
+func fetchConfigBlob(ctx context.Context, src types.ImageSource, info types.BlobInfo) ([]byte, error) {
+	if err := info.Digest.Validate(); err != nil { // This also rejects digest algorithms we can’t compute.
+		return nil, fmt.Errorf("invalid config digest %q: %w", info.Digest, err)
+	}
+	stream, _, err := src.GetBlob(ctx, info, none.NoCache)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	blob, err := iolimits.ReadAtMost(stream, iolimits.MaxConfigBodySize)
+	if err != nil {
+		return nil, err
+	}
+	// Use the algorithm of the descriptor; the config is not required to use digest.Canonical.
+	computedDigest := info.Digest.Algorithm().FromBytes(blob)
+	if computedDigest != info.Digest {
+		return nil, internalManifest.NewConfigDigestMismatchError(info.Digest, computedDigest)
+	}
+	return blob, nil
+}
@@ -1,11 +1,17 @@
 package image
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"testing"
 
+	"github.com/containers/image/v5/internal/testing/mocks"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestManifestLayerInfosToBlobInfos(t *testing.T) {
@@ -69,3 +75,40 @@ func TestManifestLayerInfosToBlobInfos(t *testing.T) {
 		},
 	}, blobs)
 }
+
+// fixedBlobImageSource is a types.ImageSource which returns blob for all GetBlob calls.
+type fixedBlobImageSource struct {
+	mocks.ForbiddenImageSource // We inherit almost all of the methods, which just panic()
+	blob                       []byte
+}
+
+func (f fixedBlobImageSource) GetBlob(ctx context.Context, info types.BlobInfo, _ types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	return io.NopCloser(bytes.NewReader(f.blob)), int64(len(f.blob)), nil
+}
+
+func TestFetchConfigBlob(t *testing.T) {
+	config := []byte(`{"architecture":"amd64"}`)
+	src := fixedBlobImageSource{blob: config}
+
+	// Success, with various digest algorithms
+	for _, d := range []digest.Digest{digest.SHA256.FromBytes(config), digest.SHA512.FromBytes(config)} {
+		res, err := fetchConfigBlob(context.Background(), src, types.BlobInfo{Digest: d, Size: int64(len(config))})
+		require.NoError(t, err, d.String())
+		assert.Equal(t, config, res, d.String())
+	}
+
+	// Digest mismatch
+	for _, d := range []digest.Digest{digest.SHA256.FromString("other"), digest.SHA512.FromString("other")} {
+		_, err := fetchConfigBlob(context.Background(), src, types.BlobInfo{Digest: d, Size: int64(len(config))})
+		var mismatchErr manifest.ConfigDigestMismatchError
+		require.ErrorAs(t, err, &mismatchErr, d.String())
+		assert.Equal(t, d, mismatchErr.Expected)
+		assert.Equal(t, d.Algorithm().FromBytes(config), mismatchErr.Actual)
+	}
+
+	// Invalid digests are rejected without reading the blob
+	for _, d := range []digest.Digest{"", "sha256:invalid", digest.Digest("unknown:" + digest.SHA256.FromBytes(config).Encoded())} {
+		_, err := fetchConfigBlob(context.Background(), mocks.ForbiddenImageSource{}, types.BlobInfo{Digest: d})
+		assert.Error(t, err, d.String())
+	}
+}
@@ -12,7 +12,7 @@ import (
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache/none"
 	"github.com/containers/image/v5/types"
-	"github.com/opencontainers/go-digest"
+	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
@@ -63,19 +63,10 @@ func (m *manifestOCI1) ConfigBlob(ctx context.Context) ([]byte, error) {
 		if m.src == nil {
 			return nil, errors.New("Internal error: neither src nor configBlob set in manifestOCI1")
 		}
-		stream, _, err := m.src.GetBlob(ctx, manifest.BlobInfoFromOCI1Descriptor(m.m.Config), none.NoCache)
+		blob, err := fetchConfigBlob(ctx, m.src, manifest.BlobInfoFromOCI1Descriptor(m.m.Config))
 		if err != nil {
 			return nil, err
 		}
-		defer stream.Close()
-		blob, err := iolimits.ReadAtMost(stream, iolimits.MaxConfigBodySize)
-		if err != nil {
-			return nil, err
-		}
-		computedDigest := digest.FromBytes(blob)
-		if computedDigest != m.m.Config.Digest {
-			return nil, fmt.Errorf("Download config.json digest %s does not match expected %s", computedDigest, m.m.Config.Digest)
-		}
 		m.configBlob = blob
 	}
 	return m.configBlob, nil
@@ -127,7 +118,33 @@ func (m *manifestOCI1) Inspect(ctx context.Context) (*types.ImageInspectInfo, er
 		}
 		return config, nil
 	}
-	return m.m.Inspect(getter)
+	res, err := m.m.Inspect(getter)
+	if err != nil {
+		return nil, err
+	}
+	if m.src != nil {
+		for i := range res.LayersData {
+			annotations, err := manifest.InternalizeAnnotations(res.LayersData[i].Annotations, func(d digest.Digest) ([]byte, error) {
+				return fetchExternalizedAnnotation(ctx, m.src, d)
+			})
+			if err != nil {
+				return nil, err
+			}
+			res.LayersData[i].Annotations = annotations
+		}
+	}
+	return res, nil
+}
+
+// fetchExternalizedAnnotation returns the value of an externalized annotation stored in src as blob d.
+// The caller is responsible for verifying the digest.
+func fetchExternalizedAnnotation(ctx context.Context, src types.ImageSource, d digest.Digest) ([]byte, error) {
+	stream, _, err := src.GetBlob(ctx, types.BlobInfo{Digest: d, Size: -1}, none.NoCache)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	return iolimits.ReadAtMost(stream, iolimits.MaxExternalizedAnnotationBodySize)
 }
 
 // UpdatedImageNeedsLayerDiffIDs returns true iff UpdatedImage(options) needs InformationOnly.LayerDiffIDs.
@@ -15,6 +15,7 @@ import (
 	"github.com/containers/image/v5/internal/testing/mocks"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -180,6 +181,18 @@ func TestManifestOCI1ConfigBlob(t *testing.T) {
 		}
 	}
 
+	// A config which does not match the descriptor is reported using a ConfigDigestMismatchError
+	nonmatchingJSON := []byte("This does not match ConfigDescriptor.Digest")
+	src := configBlobImageSource{f: func() (io.ReadCloser, int64, error) {
+		return io.NopCloser(bytes.NewReader(nonmatchingJSON)), int64(len(nonmatchingJSON)), nil
+	}}
+	mismatched := manifestOCI1FromFixture(t, src, "oci1.json")
+	_, err = mismatched.ConfigBlob(context.Background())
+	var mismatchErr manifest.ConfigDigestMismatchError
+	require.ErrorAs(t, err, &mismatchErr)
+	assert.Equal(t, mismatched.ConfigInfo().Digest, mismatchErr.Expected)
+	assert.Equal(t, digest.FromBytes(nonmatchingJSON), mismatchErr.Actual)
+
 	// Generally configBlob should match ConfigInfo; we don’t quite need it to, and this will
 	// guarantee that the returned object is returning the original contents instead
 	// of reading an object from elsewhere.
@@ -25,6 +25,9 @@ type UnparsedImage struct {
 	// Valid iff cachedManifest is not nil.
 	cachedManifestMIMEType string
 	cachedSignatures       []signature.Signature // A private cache for Signatures(); nil if not yet known.
+	// A private cache for UntrustedSignatureSourceIndices(); valid iff cachedSignatures is not nil.
+	cachedSignatureSourceIndices []int
+	cachedAttestations           []signature.Sigstore // A private cache for UntrustedSigstoreAttestations(); nil if not yet known.
 }
 
 // UnparsedInstance returns a types.UnparsedImage implementation for (source, instanceDigest).
@@ -40,6 +43,20 @@ func UnparsedInstance(src types.ImageSource, instanceDigest *digest.Digest) *Unp
 	}
 }
 
+// UnparsedInstanceWithManifest is like UnparsedInstance, but uses the caller-supplied manifestBlob with manifestMIMEType
+// instead of reading the manifest from src; manifestBlob is verified the same way as a manifest read from src would be.
+//
+// The UnparsedImage must not be used after the underlying ImageSource is Close()d.
+func UnparsedInstanceWithManifest(src types.ImageSource, instanceDigest *digest.Digest, manifestBlob []byte, manifestMIMEType string) (*UnparsedImage, error) {
+	res := UnparsedInstance(src, instanceDigest)
+	if err := res.verifyManifest(manifestBlob); err != nil {
+		return nil, err
+	}
+	res.cachedManifest = manifestBlob
+	res.cachedManifestMIMEType = manifestMIMEType
+	return res, nil
+}
+
 // Reference returns the reference used to set up this source, _as specified by the user_
 // (not as the image itself, or its underlying storage, claims).  This can be used e.g. to determine which public keys are trusted for this image.
 func (i *UnparsedImage) Reference() types.ImageReference {
@@ -57,14 +74,8 @@ func (i *UnparsedImage) Manifest(ctx context.Context) ([]byte, string, error) {
 
 		// ImageSource.GetManifest does not do digest verification, but we do;
 		// this immediately protects also any user of types.Image.
-		if digest, haveDigest := i.expectedManifestDigest(); haveDigest {
-			matches, err := manifest.MatchesDigest(m, digest)
-			if err != nil {
-				return nil, "", fmt.Errorf("computing manifest digest: %w", err)
-			}
-			if !matches {
-				return nil, "", fmt.Errorf("Manifest does not match provided manifest digest %s", digest)
-			}
+		if err := i.verifyManifest(m); err != nil {
+			return nil, "", err
 		}
 
 		i.cachedManifest = m
@@ -73,6 +84,20 @@ func (i *UnparsedImage) Manifest(ctx context.Context) ([]byte, string, error) {
 	return i.cachedManifest, i.cachedManifestMIMEType, nil
 }
 
+// verifyManifest returns an error if m does not match the expected manifest digest, if any.
+func (i *UnparsedImage) verifyManifest(m []byte) error {
+	if digest, haveDigest := i.expectedManifestDigest(); haveDigest {
+		matches, err := manifest.MatchesDigest(m, digest)
+		if err != nil {
+			return fmt.Errorf("computing manifest digest: %w", err)
+		}
+		if !matches {
+			return fmt.Errorf("Manifest does not match provided manifest digest %s", digest)
+		}
+	}
+	return nil
+}
+
 // expectedManifestDigest returns a the expected value of the manifest digest, and an indicator whether it is known.
 // The bool return value seems redundant with digest != ""; it is used explicitly
 // to refuse (unexpected) situations when the digest exists but is "".
@@ -107,13 +132,56 @@ func (i *UnparsedImage) Signatures(ctx context.Context) ([][]byte, error) {
 }
 
 // UntrustedSignatures is like ImageSource.GetSignaturesWithFormat, but the result is cached; it is OK to call this however often you need.
+// The signatures are returned in the canonical order of signature.CanonicalOrder, regardless of the order used by the transport.
 func (i *UnparsedImage) UntrustedSignatures(ctx context.Context) ([]signature.Signature, error) {
+	if err := i.ensureSignaturesCached(ctx); err != nil {
+		return nil, err
+	}
+	return i.cachedSignatures, nil
+}
+
+// UntrustedSignatureSourceIndices returns, for every signature returned by UntrustedSignatures, its index in the
+// transport-specific order returned by ImageSource.GetSignaturesWithFormat. This is intended for debugging.
+func (i *UnparsedImage) UntrustedSignatureSourceIndices(ctx context.Context) ([]int, error) {
+	if err := i.ensureSignaturesCached(ctx); err != nil {
+		return nil, err
+	}
+	return i.cachedSignatureSourceIndices, nil
+}
+
+// ensureSignaturesCached reads the signatures from i.src into i.cachedSignatures, if they are not cached yet.
+func (i *UnparsedImage) ensureSignaturesCached(ctx context.Context) error {
 	if i.cachedSignatures == nil {
 		sigs, err := i.src.GetSignaturesWithFormat(ctx, i.instanceDigest)
+		if err != nil {
+			return err
+		}
+		sorted, indices, err := signature.CanonicalOrder(sigs)
+		if err != nil {
+			return err
+		}
+		i.cachedSignatures = sorted
+		i.cachedSignatureSourceIndices = indices
+	}
+	return nil
+}
+
+// UntrustedSigstoreAttestations is like SigstoreAttestationSource.GetSigstoreAttestations, but the result is cached;
+// it is OK to call this however often you need. It returns no attestations if the source does not support them.
+func (i *UnparsedImage) UntrustedSigstoreAttestations(ctx context.Context) ([]signature.Sigstore, error) {
+	if i.cachedAttestations == nil {
+		src, ok := i.src.(private.SigstoreAttestationSource)
+		if !ok {
+			return []signature.Sigstore{}, nil
+		}
+		attestations, err := src.GetSigstoreAttestations(ctx, i.instanceDigest)
 		if err != nil {
 			return nil, err
 		}
-		i.cachedSignatures = sigs
+		if attestations == nil {
+			attestations = []signature.Sigstore{}
+		}
+		i.cachedAttestations = attestations
 	}
-	return i.cachedSignatures, nil
+	return i.cachedAttestations, nil
 }
@@ -0,0 +1,78 @@
+package image
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/internal/testing/mocks"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// transportOnlyImageReference is a types.ImageReference which only implements Transport.
+type transportOnlyImageReference struct {
+	mocks.ForbiddenImageReference // We inherit almost all of the methods, which just panic()
+}
+
+func (ref transportOnlyImageReference) Transport() types.ImageTransport {
+	return mocks.NameImageTransport("== Transport mock")
+}
+
+// fixedSignaturesImageSource is a types.ImageSource which returns sigs for all GetSignatures calls.
+type fixedSignaturesImageSource struct {
+	mocks.ForbiddenImageSource // We inherit almost all of the methods, which just panic()
+	sigs                       [][]byte
+	calls                      *int
+}
+
+func (f fixedSignaturesImageSource) Reference() types.ImageReference {
+	return transportOnlyImageReference{}
+}
+
+func (f fixedSignaturesImageSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	*f.calls++
+	return f.sigs, nil
+}
+
+func TestUnparsedImageUntrustedSignatures(t *testing.T) {
+	sigs := [][]byte{[]byte("signature 1"), []byte("signature 2"), []byte("signature 3")}
+
+	var expected []signature.Signature
+	for _, order := range [][]int{{0, 1, 2}, {2, 1, 0}, {1, 2, 0}} {
+		sourceSigs := [][]byte{}
+		for _, i := range order {
+			sourceSigs = append(sourceSigs, sigs[i])
+		}
+		calls := 0
+		img := UnparsedInstance(fixedSignaturesImageSource{sigs: sourceSigs, calls: &calls}, nil)
+
+		res, err := img.UntrustedSignatures(context.Background())
+		require.NoError(t, err)
+		require.Len(t, res, len(sigs))
+		if expected == nil {
+			expected = res
+		}
+		// The order does not depend on the order used by the source
+		assert.Equal(t, expected, res)
+
+		indices, err := img.UntrustedSignatureSourceIndices(context.Background())
+		require.NoError(t, err)
+		require.Len(t, indices, len(sigs))
+		for i, index := range indices {
+			assert.Equal(t, signature.SimpleSigningFromBlob(sourceSigs[index]), res[i])
+		}
+
+		// Signatures uses the same order
+		simpleSigs, err := img.Signatures(context.Background())
+		require.NoError(t, err)
+		for i, sig := range simpleSigs {
+			assert.Equal(t, signature.SimpleSigningFromBlob(sig), res[i])
+		}
+
+		// The source is only queried once
+		assert.Equal(t, 1, calls)
+	}
+}
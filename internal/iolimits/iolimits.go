@@ -39,6 +39,12 @@ const (
 	// MaxTarFileManifestSize is the maximum allowed size of a (docker save)-like manifest (which may contain multiple images)
 	// The limit of 1 MB is considered to be greatly sufficient.
 	MaxTarFileManifestSize = megaByte
+	// MaxPolicyDecisionBodySize is the maximum allowed size of a response of a policy decision service.
+	// The limit of 1 MB is considered to be greatly sufficient.
+	MaxPolicyDecisionBodySize = megaByte
+	// MaxExternalizedAnnotationBodySize is the maximum allowed size of an externalized annotation value.
+	// The limit of 4 MB matches MaxManifestBodySize, which would have had to contain the value otherwise.
+	MaxExternalizedAnnotationBodySize = 4 * megaByte
 )
 
 // ReadAtMost reads from reader and errors out if the specified limit (in bytes) is exceeded.
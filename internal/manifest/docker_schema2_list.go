@@ -37,6 +37,8 @@ type Schema2ListPublic struct {
 	SchemaVersion int                         `json:"schemaVersion"`
 	MediaType     string                      `json:"mediaType"`
 	Manifests     []Schema2ManifestDescriptor `json:"manifests"`
+
+	unknownFields UnknownFields // Fields of the original blob not known to this type, preserved by Serialize
 }
 
 // MIMEType returns the MIME type of this particular manifest list.
@@ -103,7 +105,9 @@ func (list *Schema2ListPublic) ChooseInstance(ctx *types.SystemContext) (digest.
 		return "", fmt.Errorf("getting platform information %#v: %w", ctx, err)
 	}
 	for _, wantedPlatform := range wantedPlatforms {
-		for _, d := range list.Manifests {
+		var bestMatch *Schema2ManifestDescriptor
+		bestPreference := uint64(0)
+		for i, d := range list.Manifests {
 			imagePlatform := imgspecv1.Platform{
 				Architecture: d.Platform.Architecture,
 				OS:           d.Platform.OS,
@@ -112,9 +116,17 @@ func (list *Schema2ListPublic) ChooseInstance(ctx *types.SystemContext) (digest.
 				Variant:      d.Platform.Variant,
 			}
 			if platform.MatchesPlatform(imagePlatform, wantedPlatform) {
-				return d.Digest, nil
+				// Among matching instances, prefer the best OS version; otherwise, the first one.
+				preference := platform.OSVersionPreference(imagePlatform, wantedPlatform)
+				if bestMatch == nil || preference > bestPreference {
+					bestMatch = &list.Manifests[i]
+					bestPreference = preference
+				}
 			}
 		}
+		if bestMatch != nil {
+			return bestMatch.Digest, nil
+		}
 	}
 	return "", fmt.Errorf("no image found in manifest list for architecture %s, variant %q, OS %s", wantedPlatforms[0].Architecture, wantedPlatforms[0].Variant, wantedPlatforms[0].OS)
 }
@@ -122,7 +134,7 @@ func (list *Schema2ListPublic) ChooseInstance(ctx *types.SystemContext) (digest.
 // Serialize returns the list in a blob format.
 // NOTE: Serialize() does not in general reproduce the original blob if this object was loaded from one, even if no modifications were made!
 func (list *Schema2ListPublic) Serialize() ([]byte, error) {
-	buf, err := json.Marshal(list)
+	buf, err := MarshalWithUnknownFields(list, list.unknownFields, nil)
 	if err != nil {
 		return nil, fmt.Errorf("marshaling Schema2List %#v: %w", list, err)
 	}
@@ -163,7 +175,9 @@ func Schema2ListPublicFromComponents(components []Schema2ManifestDescriptor) *Sc
 // Schema2ListPublicClone creates a deep copy of the passed-in list.
 // This is publicly visible as c/image/manifest.Schema2ListClone.
 func Schema2ListPublicClone(list *Schema2ListPublic) *Schema2ListPublic {
-	return Schema2ListPublicFromComponents(list.Manifests)
+	res := Schema2ListPublicFromComponents(list.Manifests)
+	res.unknownFields = list.unknownFields
+	return res
 }
 
 // ToOCI1Index returns the list encoded as an OCI1 index.
@@ -208,6 +222,11 @@ func Schema2ListPublicFromManifest(manifest []byte) (*Schema2ListPublic, error)
 		AllowedFieldManifests); err != nil {
 		return nil, err
 	}
+	unknownFields, err := ParseUnknownFields(manifest, &list)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling Schema2List %q: %w", string(manifest), err)
+	}
+	list.unknownFields = unknownFields
 	return &list, nil
 }
 
@@ -249,6 +268,38 @@ func (index *Schema2List) Clone() ListPublic {
 	return index.CloneInternal()
 }
 
+// RemoveInstances removes the instances at the specified indices (into the value returned by Instances()) from the list.
+func (index *Schema2List) RemoveInstances(indices []int) error {
+	removed, err := removedInstancesSet(indices, len(index.Manifests))
+	if err != nil {
+		return err
+	}
+	manifests := make([]Schema2ManifestDescriptor, 0, len(index.Manifests))
+	for i, m := range index.Manifests {
+		if !removed.Contains(i) {
+			manifests = append(manifests, m)
+		}
+	}
+	index.Manifests = manifests
+	return nil
+}
+
+// InstancePlatforms returns the platforms of the instances, in the same order as Instances();
+// the value is nil for instances which don’t specify a platform.
+func (index *Schema2List) InstancePlatforms() []*imgspecv1.Platform {
+	res := make([]*imgspecv1.Platform, len(index.Manifests))
+	for i, m := range index.Manifests {
+		res[i] = &imgspecv1.Platform{
+			Architecture: m.Platform.Architecture,
+			OS:           m.Platform.OS,
+			OSVersion:    m.Platform.OSVersion,
+			OSFeatures:   slices.Clone(m.Platform.OSFeatures),
+			Variant:      m.Platform.Variant,
+		}
+	}
+	return res
+}
+
 // Schema2ListFromManifest creates a Schema2 manifest list instance from marshalled
 // JSON, presumably generated by encoding a Schema2 manifest list.
 func Schema2ListFromManifest(manifest []byte) (*Schema2List, error) {
@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -45,3 +47,19 @@ func TestSchema2ListFromManifest(t *testing.T) {
 	// Extra fields are rejected
 	testValidManifestWithExtraFieldsIsRejected(t, parser, validManifest, []string{"config", "fsLayers", "history", "layers"})
 }
+
+func TestSchema2ListPublicUnknownFields(t *testing.T) {
+	original := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.list.v2+json","manifests":[` +
+		`{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","size":527,"digest":"sha256:030fcb92e1487b18c974784dcc110a93147c9fc402188370fbfd17efabffc6af","platform":{"architecture":"amd64","os":"linux"}}` +
+		`],"futureField":"value"}`)
+	list, err := Schema2ListPublicFromManifest(original)
+	require.NoError(t, err)
+	serialized, err := list.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, string(original), string(serialized))
+	assert.Equal(t, digest.FromBytes(original), digest.FromBytes(serialized))
+
+	serialized, err = Schema2ListPublicClone(list).Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, string(original), string(serialized))
+}
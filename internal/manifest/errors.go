@@ -1,6 +1,10 @@
 package manifest
 
-import "fmt"
+import (
+	"fmt"
+
+	digest "github.com/opencontainers/go-digest"
+)
 
 // FIXME: This is a duplicate of c/image/manifestDockerV2Schema2ConfigMediaType.
 // Deduplicate that, depending on outcome of https://github.com/containers/image/pull/1791 .
@@ -38,3 +42,22 @@ func (e NonImageArtifactError) Error() string {
 	}
 	return fmt.Sprintf("unsupported image-specific operation on artifact with type %q", e.mimeType)
 }
+
+// ConfigDigestMismatchError (detected via errors.As) is used when a config blob does not match
+// the digest in the config descriptor of the manifest.
+//
+// This is publicly visible as c/image/manifest.ConfigDigestMismatchError (but we don’t provide a public constructor)
+type ConfigDigestMismatchError struct {
+	Expected digest.Digest // The digest in the config descriptor
+	Actual   digest.Digest // The digest of the config blob, using the algorithm of Expected
+}
+
+// NewConfigDigestMismatchError returns a ConfigDigestMismatchError for a config blob with digest actual,
+// where expected was required.
+func NewConfigDigestMismatchError(expected, actual digest.Digest) error {
+	return ConfigDigestMismatchError{Expected: expected, Actual: actual}
+}
+
+func (e ConfigDigestMismatchError) Error() string {
+	return fmt.Sprintf("Download config.json digest %s does not match expected %s", e.Actual, e.Expected)
+}
@@ -1,8 +1,12 @@
 package manifest
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 
+	"github.com/containers/image/v5/internal/set"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -55,6 +59,58 @@ type List interface {
 	// SystemContext ( or for the current platform if the SystemContext doesn't specify any detail ) and preferGzip for compression which
 	// when configured to OptionalBoolTrue and chooses best available compression when it is OptionalBoolFalse or left OptionalBoolUndefined.
 	ChooseInstanceByCompression(ctx *types.SystemContext, preferGzip types.OptionalBool) (digest.Digest, error)
+	// RemoveInstances removes the instances at the specified indices (into the value returned by Instances()) from the list.
+	RemoveInstances(indices []int) error
+	// InstancePlatforms returns the platforms of the instances, in the same order as Instances();
+	// the value is nil for instances which don’t specify a platform.
+	InstancePlatforms() []*imgspecv1.Platform
+}
+
+// removedInstancesSet validates indices passed to RemoveInstances for a list with numInstances instances,
+// and returns them as a set.
+func removedInstancesSet(indices []int, numInstances int) (*set.Set[int], error) {
+	res := set.New[int]()
+	for _, i := range indices {
+		if i < 0 || i >= numInstances {
+			return nil, fmt.Errorf("invalid instance index %d to remove from a list of %d instances", i, numInstances)
+		}
+		if res.Contains(i) {
+			return nil, fmt.Errorf("instance index %d specified for removal more than once", i)
+		}
+		res.Add(i)
+	}
+	return res, nil
+}
+
+// CanonicalListBlob returns a canonical serialization of list, and its digest.
+// The canonical form preserves the order of instances, but does not depend on the order of keys in the original
+// JSON or on the field order of the Go types: the JSON is compact, and object keys are sorted.
+// Parsing the result and canonicalizing it again returns exactly the same bytes and digest.
+// This is publicly visible as c/image/manifest.CanonicalListBlob.
+func CanonicalListBlob(list ListPublic) ([]byte, digest.Digest, error) {
+	serialized, err := list.Serialize()
+	if err != nil {
+		return nil, "", err
+	}
+	blob, err := canonicalJSON(serialized)
+	if err != nil {
+		return nil, "", fmt.Errorf("canonicalizing %s: %w", list.MIMEType(), err)
+	}
+	return blob, digest.FromBytes(blob), nil
+}
+
+// canonicalJSON returns input, a JSON document, in a compact form with sorted object keys.
+func canonicalJSON(input []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(input))
+	decoder.UseNumber() // Don’t lose precision, or change the representation of numbers, by converting to float64.
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return json.Marshal(value) // Sorts the keys of map[string]any objects.
 }
 
 // ListUpdate includes the fields which a List's UpdateInstances() method will modify.
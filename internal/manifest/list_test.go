@@ -1,6 +1,7 @@
 package manifest
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -64,6 +65,143 @@ func TestParseLists(t *testing.T) {
 	}
 }
 
+func TestCanonicalListBlob(t *testing.T) {
+	for _, listFile := range []string{"ociv1.image.index.json", "v2list.manifest.json", "ocilist-windows.json", "schema2list-windows.json"} {
+		manifest, err := os.ReadFile(filepath.Join("testdata", listFile))
+		require.NoError(t, err)
+		list, err := ListFromBlob(manifest, GuessMIMEType(manifest))
+		require.NoError(t, err)
+		instances := list.Instances()
+
+		blob, blobDigest, err := CanonicalListBlob(list)
+		require.NoError(t, err, listFile)
+		assert.Equal(t, digest.FromBytes(blob), blobDigest, listFile)
+		compacted, err := json.Marshal(json.RawMessage(blob))
+		require.NoError(t, err, listFile)
+		assert.Equal(t, blob, compacted, listFile)
+
+		// Canonicalization is idempotent
+		parsed, err := ListFromBlob(blob, list.MIMEType())
+		require.NoError(t, err, listFile)
+		assert.Equal(t, instances, parsed.Instances(), listFile) // The order of instances is preserved
+		blob2, blobDigest2, err := CanonicalListBlob(parsed)
+		require.NoError(t, err, listFile)
+		assert.Equal(t, blob, blob2, listFile)
+		assert.Equal(t, blobDigest, blobDigest2, listFile)
+
+		// Object keys are sorted, so the result does not depend on the key order of the input
+		var generic map[string]any
+		err = json.Unmarshal(manifest, &generic)
+		require.NoError(t, err, listFile)
+		reordered, err := json.MarshalIndent(generic, "", "\t")
+		require.NoError(t, err, listFile)
+		parsed, err = ListFromBlob(reordered, list.MIMEType())
+		require.NoError(t, err, listFile)
+		blob3, blobDigest3, err := CanonicalListBlob(parsed)
+		require.NoError(t, err, listFile)
+		assert.Equal(t, blob, blob3, listFile)
+		assert.Equal(t, blobDigest, blobDigest3, listFile)
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	for _, c := range []struct{ input, expected string }{
+		{`{"b": 1, "a": {"d": [3, 2, 1], "c": null}}`, `{"a":{"c":null,"d":[3,2,1]},"b":1}`},
+		{`{"size": 12345678901234567890}`, `{"size":12345678901234567890}`},
+		{`{"value": 1.50}`, `{"value":1.50}`},
+	} {
+		res, err := canonicalJSON([]byte(c.input))
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.expected, string(res), c.input)
+	}
+
+	for _, input := range []string{``, `{`, `{} {}`} {
+		_, err := canonicalJSON([]byte(input))
+		assert.Error(t, err, input)
+	}
+}
+
+func TestListRemoveInstances(t *testing.T) {
+	for _, listFile := range []string{"schema2list.json", "ocilist-variants.json"} {
+		validManifest, err := os.ReadFile(filepath.Join("testdata", listFile))
+		require.NoError(t, err)
+		list, err := ListFromBlob(validManifest, GuessMIMEType(validManifest))
+		require.NoError(t, err)
+		original := list.Instances()
+		require.GreaterOrEqual(t, len(original), 3, listFile)
+
+		// Invalid indices are rejected, without modifying the list
+		for _, indices := range [][]int{{-1}, {len(original)}, {0, 0}} {
+			err := list.CloneInternal().RemoveInstances(indices)
+			assert.Error(t, err, listFile)
+		}
+		err = list.RemoveInstances([]int{1, len(original)})
+		assert.Error(t, err, listFile)
+		assert.Equal(t, original, list.Instances(), listFile)
+
+		// Removing nothing
+		err = list.RemoveInstances(nil)
+		require.NoError(t, err, listFile)
+		assert.Equal(t, original, list.Instances(), listFile)
+
+		// Removing some instances keeps the others in order
+		err = list.RemoveInstances([]int{2, 0})
+		require.NoError(t, err, listFile)
+		expected := append([]digest.Digest{original[1]}, original[3:]...)
+		assert.Equal(t, expected, list.Instances(), listFile)
+		// The other data of the remaining instances is preserved
+		instance, err := list.Instance(original[1])
+		require.NoError(t, err, listFile)
+		originalList, err := ListFromBlob(validManifest, GuessMIMEType(validManifest))
+		require.NoError(t, err)
+		originalInstance, err := originalList.Instance(original[1])
+		require.NoError(t, err)
+		assert.Equal(t, originalInstance, instance, listFile)
+	}
+}
+
+func TestListInstancePlatforms(t *testing.T) {
+	for _, c := range []struct {
+		listFile string
+		expected []*imgspecv1.Platform
+	}{
+		{"oci1index.json", []*imgspecv1.Platform{
+			{Architecture: "ppc64le", OS: "linux"},
+			{Architecture: "amd64", OS: "linux", OSFeatures: []string{"sse4"}},
+		}},
+		{"ocilist-variants.json", []*imgspecv1.Platform{
+			{Architecture: "amd64", OS: "linux"},
+			{Architecture: "arm", OS: "linux", Variant: "v7"},
+			{Architecture: "arm", OS: "linux", Variant: "v6"},
+			{Architecture: "arm", OS: "linux", Variant: "v6"},
+			{Architecture: "arm", OS: "linux", Variant: "unrecognized-present"},
+			{Architecture: "arm", OS: "linux"},
+		}},
+		{"schema2list.json", []*imgspecv1.Platform{
+			{Architecture: "amd64", OS: "linux"},
+			{Architecture: "arm", OS: "linux", Variant: "v5"},
+			{Architecture: "arm", OS: "linux", Variant: "v6"},
+			{Architecture: "arm64", OS: "linux", Variant: "v8"},
+			{Architecture: "386", OS: "linux"},
+			{Architecture: "ppc64le", OS: "linux"},
+			{Architecture: "s390x", OS: "linux"},
+		}},
+	} {
+		manifest, err := os.ReadFile(filepath.Join("testdata", c.listFile))
+		require.NoError(t, err)
+		list, err := ListFromBlob(manifest, GuessMIMEType(manifest))
+		require.NoError(t, err)
+		res := list.InstancePlatforms()
+		require.Len(t, res, len(list.Instances()), c.listFile)
+		assert.Equal(t, c.expected, res, c.listFile)
+	}
+
+	// Instances without a platform
+	list, err := OCI1IndexFromManifest([]byte(`{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f","size":7143}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []*imgspecv1.Platform{nil}, list.InstancePlatforms())
+}
+
 func TestChooseInstance(t *testing.T) {
 	type expectedMatch struct {
 		arch, variant  string
@@ -159,3 +297,77 @@ func TestChooseInstance(t *testing.T) {
 		}
 	}
 }
+
+func TestChooseInstanceWindowsOSVersion(t *testing.T) {
+	const (
+		ltsc2019Old = "sha256:6f9421545999ff4fb6c5c38371b3d1d667c7d1df11a279df30fdcb64b94dfbe3" // 10.0.17763.1000
+		ltsc2019New = "sha256:c875a94b552a22cc4a3ef43623a03e3d1a30893fe6bb2085128a511f63d186a9" // 10.0.17763.2000
+		ltsc2022New = "sha256:f173effa1a8fbea7c06c572917194d7efa3a01c72562edaeb3c7f5b22c9d3f25" // 10.0.20348.1000
+		linux       = "sha256:90aecae9d82be07c069026957098bf1bb8c5d94706990fc259f6bd40ac5b0b54"
+	)
+	for _, listFile := range []string{"schema2list-windows.json", "ocilist-windows.json"} {
+		rawManifest, err := os.ReadFile(filepath.Join("testdata", listFile))
+		require.NoError(t, err)
+		list, err := ListFromBlob(rawManifest, GuessMIMEType(rawManifest))
+		require.NoError(t, err)
+
+		for _, c := range []struct{ os, osVersion, expected string }{
+			{"windows", "10.0.17763.3000", ltsc2019New}, // Same build, the highest revision is preferred
+			{"windows", "10.0.17763.1", ltsc2019New},    // The revision does not affect compatibility
+			{"windows", "10.0.20348.1", ltsc2022New},    // Same build
+			{"windows", "10.0.22621.1", ltsc2022New},    // LTSC 2022 images run on later hosts
+			{"windows", "10.0.26100.1", ltsc2022New},
+			{"windows", "", ltsc2019Old},                // The OS version is unknown: the first instance
+			{"windows", "this is invalid", ltsc2019Old}, // Invalid OS versions are ignored
+			{"linux", "10.0.20348.1", linux},            // OS versions are ignored for other OSes
+		} {
+			testName := fmt.Sprintf("%s %s %q", listFile, c.os, c.osVersion)
+			d, err := list.ChooseInstance(&types.SystemContext{
+				ArchitectureChoice: "amd64",
+				OSChoice:           c.os,
+				OSVersionChoice:    c.osVersion,
+			})
+			require.NoError(t, err, testName)
+			assert.Equal(t, digest.Digest(c.expected), d, testName)
+		}
+
+		for _, osVersion := range []string{
+			"10.0.19041.1", // Older hosts require exactly the same build
+			"10.0.14393.1",
+			"6.3.9600.1", // Different major/minor version
+		} {
+			_, err := list.ChooseInstance(&types.SystemContext{
+				ArchitectureChoice: "amd64",
+				OSChoice:           "windows",
+				OSVersionChoice:    osVersion,
+			})
+			assert.Error(t, err, osVersion)
+		}
+
+		// os.version and os.features are preserved when converting between list formats
+		for _, mimeType := range []string{DockerV2ListMediaType, imgspecv1.MediaTypeImageIndex} {
+			converted, err := list.ConvertToMIMEType(mimeType)
+			require.NoError(t, err)
+			serialized, err := converted.Serialize()
+			require.NoError(t, err)
+			var parsed struct {
+				Manifests []struct {
+					Digest   digest.Digest       `json:"digest"`
+					Platform *imgspecv1.Platform `json:"platform"`
+				} `json:"manifests"`
+			}
+			err = json.Unmarshal(serialized, &parsed)
+			require.NoError(t, err)
+			found := false
+			for _, m := range parsed.Manifests {
+				if m.Digest == ltsc2022New {
+					found = true
+					require.NotNil(t, m.Platform, mimeType)
+					assert.Equal(t, "10.0.20348.1000", m.Platform.OSVersion, mimeType)
+					assert.Equal(t, []string{"win32k"}, m.Platform.OSFeatures, mimeType)
+				}
+			}
+			assert.True(t, found, mimeType)
+		}
+	}
+}
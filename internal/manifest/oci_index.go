@@ -31,6 +31,11 @@ const (
 // Internal users should usually use OCI1Index instead.
 type OCI1IndexPublic struct {
 	imgspecv1.Index
+
+	// Fields of the original blob not known to imgspecv1.Index (e.g. added in newer versions of the specification),
+	// preserved by Serialize.
+	unknownFields           UnknownFields
+	unknownDescriptorFields DescriptorUnknownFields
 }
 
 // MIMEType returns the MIME type of this particular manifest index.
@@ -93,16 +98,19 @@ func instanceIsZstd(manifest imgspecv1.Descriptor) bool {
 }
 
 type instanceCandidate struct {
-	platformIndex    int           // Index of the candidate in platform.WantedPlatforms: lower numbers are preferred; or math.maxInt if the candidate doesn’t have a platform
-	isZstd           bool          // tells if particular instance if zstd instance
-	manifestPosition int           // A zero-based index of the instance in the manifest list
-	digest           digest.Digest // Instance digest
+	platformIndex       int           // Index of the candidate in platform.WantedPlatforms: lower numbers are preferred; or math.maxInt if the candidate doesn’t have a platform
+	osVersionPreference uint64        // platform.OSVersionPreference of the candidate: higher numbers are preferred
+	isZstd              bool          // tells if particular instance if zstd instance
+	manifestPosition    int           // A zero-based index of the instance in the manifest list
+	digest              digest.Digest // Instance digest
 }
 
 func (ic instanceCandidate) isPreferredOver(other *instanceCandidate, preferGzip bool) bool {
 	switch {
 	case ic.platformIndex != other.platformIndex:
 		return ic.platformIndex < other.platformIndex
+	case ic.osVersionPreference != other.osVersionPreference:
+		return ic.osVersionPreference > other.osVersionPreference
 	case ic.isZstd != other.isZstd:
 		if !preferGzip {
 			return ic.isZstd
@@ -143,6 +151,7 @@ func (index *OCI1IndexPublic) chooseInstance(ctx *types.SystemContext, preferGzi
 				if platform.MatchesPlatform(imagePlatform, wantedPlatform) {
 					foundPlatform = true
 					candidate.platformIndex = platformIndex
+					candidate.osVersionPreference = platform.OSVersionPreference(imagePlatform, wantedPlatform)
 					break
 				}
 			}
@@ -172,20 +181,33 @@ func (index *OCI1IndexPublic) ChooseInstance(ctx *types.SystemContext) (digest.D
 
 // Serialize returns the index in a blob format.
 // NOTE: Serialize() does not in general reproduce the original blob if this object was loaded from one, even if no modifications were made!
+// Fields of the original blob not known to imgspecv1.Index are preserved, though (for descriptors, only if the digest is unchanged).
 func (index *OCI1IndexPublic) Serialize() ([]byte, error) {
-	buf, err := json.Marshal(index)
+	buf, err := index.marshal()
 	if err != nil {
 		return nil, fmt.Errorf("marshaling OCI1Index %#v: %w", index, err)
 	}
 	return buf, nil
 }
 
+// marshal returns the JSON representation of index, including the unknown fields.
+func (index *OCI1IndexPublic) marshal() ([]byte, error) {
+	if index.unknownFields == nil && index.unknownDescriptorFields == nil {
+		return json.Marshal(index)
+	}
+	manifests, err := index.unknownDescriptorFields.NewMarshaler().Descriptors(index.Manifests)
+	if err != nil {
+		return nil, err
+	}
+	return MarshalWithUnknownFields(index.Index, index.unknownFields, map[string]json.RawMessage{"manifests": manifests})
+}
+
 // OCI1IndexPublicFromComponents creates an OCI1 image index instance from the
 // supplied data.
 // This is publicly visible as c/image/manifest.OCI1IndexFromComponents.
 func OCI1IndexPublicFromComponents(components []imgspecv1.Descriptor, annotations map[string]string) *OCI1IndexPublic {
 	index := OCI1IndexPublic{
-		imgspecv1.Index{
+		Index: imgspecv1.Index{
 			Versioned:   imgspec.Versioned{SchemaVersion: 2},
 			MediaType:   imgspecv1.MediaTypeImageIndex,
 			Manifests:   make([]imgspecv1.Descriptor, len(components)),
@@ -219,7 +241,10 @@ func OCI1IndexPublicFromComponents(components []imgspecv1.Descriptor, annotation
 // OCI1IndexPublicClone creates a deep copy of the passed-in index.
 // This is publicly visible as c/image/manifest.OCI1IndexClone.
 func OCI1IndexPublicClone(index *OCI1IndexPublic) *OCI1IndexPublic {
-	return OCI1IndexPublicFromComponents(index.Manifests, index.Annotations)
+	res := OCI1IndexPublicFromComponents(index.Manifests, index.Annotations)
+	res.unknownFields = index.unknownFields
+	res.unknownDescriptorFields = index.unknownDescriptorFields
+	return res
 }
 
 // ToOCI1Index returns the index encoded as an OCI1 index.
@@ -278,9 +303,34 @@ func OCI1IndexPublicFromManifest(manifest []byte) (*OCI1IndexPublic, error) {
 		AllowedFieldManifests); err != nil {
 		return nil, err
 	}
+	if err := index.parseUnknownFields(manifest); err != nil {
+		return nil, fmt.Errorf("unmarshaling OCI1Index %q: %w", string(manifest), err)
+	}
 	return &index, nil
 }
 
+// parseUnknownFields records the fields of manifest, and of descriptors in it, which are not known to index,
+// so that Serialize can preserve them.
+func (index *OCI1IndexPublic) parseUnknownFields(manifest []byte) error {
+	unknownFields, err := ParseUnknownFields(manifest, &index.Index)
+	if err != nil {
+		return err
+	}
+	var descriptors struct {
+		Manifests []json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(manifest, &descriptors); err != nil {
+		return err
+	}
+	unknownDescriptorFields, err := ParseDescriptorUnknownFields(descriptors.Manifests)
+	if err != nil {
+		return err
+	}
+	index.unknownFields = unknownFields
+	index.unknownDescriptorFields = unknownDescriptorFields
+	return nil
+}
+
 // Clone returns a deep copy of this list and its contents.
 func (index *OCI1IndexPublic) Clone() ListPublic {
 	return OCI1IndexPublicClone(index)
@@ -318,6 +368,40 @@ func (index *OCI1Index) Clone() ListPublic {
 	return index.CloneInternal()
 }
 
+// RemoveInstances removes the instances at the specified indices (into the value returned by Instances()) from the list.
+func (index *OCI1Index) RemoveInstances(indices []int) error {
+	removed, err := removedInstancesSet(indices, len(index.Manifests))
+	if err != nil {
+		return err
+	}
+	manifests := make([]imgspecv1.Descriptor, 0, len(index.Manifests))
+	for i, m := range index.Manifests {
+		if !removed.Contains(i) {
+			manifests = append(manifests, m)
+		}
+	}
+	index.Manifests = manifests
+	return nil
+}
+
+// InstancePlatforms returns the platforms of the instances, in the same order as Instances();
+// the value is nil for instances which don’t specify a platform.
+func (index *OCI1Index) InstancePlatforms() []*imgspecv1.Platform {
+	res := make([]*imgspecv1.Platform, len(index.Manifests))
+	for i, m := range index.Manifests {
+		if m.Platform != nil {
+			res[i] = &imgspecv1.Platform{
+				Architecture: m.Platform.Architecture,
+				OS:           m.Platform.OS,
+				OSVersion:    m.Platform.OSVersion,
+				OSFeatures:   slices.Clone(m.Platform.OSFeatures),
+				Variant:      m.Platform.Variant,
+			}
+		}
+	}
+	return res
+}
+
 // OCI1IndexFromManifest creates a OCI1 manifest list instance from marshalled
 // JSON, presumably generated by encoding a OCI1 manifest list.
 func OCI1IndexFromManifest(manifest []byte) (*OCI1Index, error) {
@@ -50,6 +50,33 @@ func TestOCI1IndexFromManifest(t *testing.T) {
 	testValidManifestWithExtraFieldsIsRejected(t, parser, validManifest, []string{"config", "fsLayers", "history", "layers"})
 }
 
+func TestOCI1IndexPublicUnknownFields(t *testing.T) {
+	// "artifactType" is not known to the version of imgspecv1.Index we use; "futureField" is not known to imgspecv1.Descriptor.
+	original := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` +
+		`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f","size":7143,"platform":{"architecture":"ppc64le","os":"linux"},"futureField":true},` +
+		`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270","size":7682,"platform":{"architecture":"amd64","os":"linux"}}` +
+		`],"artifactType":"application/vnd.example.future+json"}`)
+	index, err := OCI1IndexPublicFromManifest(original)
+	require.NoError(t, err)
+	serialized, err := index.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, string(original), string(serialized))
+	assert.Equal(t, digest.FromBytes(original), digest.FromBytes(serialized))
+
+	serialized, err = OCI1IndexPublicClone(index).Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, string(original), string(serialized))
+
+	// An instance with a modified digest loses its unknown fields
+	index.Manifests[0].Digest = "sha256:ec4b8955958665577945c89419d1af06b5f7636b4ac3da7f12184802ad867736"
+	serialized, err = index.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[`+
+		`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:ec4b8955958665577945c89419d1af06b5f7636b4ac3da7f12184802ad867736","size":7143,"platform":{"architecture":"ppc64le","os":"linux"}},`+
+		`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270","size":7682,"platform":{"architecture":"amd64","os":"linux"}}`+
+		`],"artifactType":"application/vnd.example.future+json"}`, string(serialized))
+}
+
 func TestOCI1IndexChooseInstanceByCompression(t *testing.T) {
 	type expectedMatch struct {
 		arch, variant  string
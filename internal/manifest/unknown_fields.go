@@ -0,0 +1,242 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// jsonMember is a single member of a JSON object.
+type jsonMember struct {
+	name  string
+	value json.RawMessage // Exactly as it appeared in the input
+}
+
+// UnknownFields are the members of a JSON object which do not correspond to any field of the Go type it was parsed into,
+// in their original order. They are preserved so that serializing the object again does not drop data
+// added by newer versions of the specifications (which would change the digest of the serialized manifest).
+// The zero value (nil) means there are no unknown fields.
+type UnknownFields []jsonMember
+
+// parseJSONObject returns the members of the JSON object in blob, in order.
+func parseJSONObject(blob []byte) ([]jsonMember, error) {
+	decoder := json.NewDecoder(bytes.NewReader(blob))
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, errors.New("expected a JSON object")
+	}
+	res := []jsonMember{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected JSON object key %v", token)
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		res = append(res, jsonMember{name: name, value: value})
+	}
+	if _, err := decoder.Token(); err != nil { // The closing '}'
+		return nil, err
+	}
+	return res, nil
+}
+
+// writeJSONObject returns a JSON object containing members.
+func writeJSONObject(members []jsonMember) ([]byte, error) {
+	res := bytes.Buffer{}
+	res.WriteByte('{')
+	for i, m := range members {
+		if i != 0 {
+			res.WriteByte(',')
+		}
+		name, err := json.Marshal(m.name)
+		if err != nil {
+			return nil, err
+		}
+		res.Write(name)
+		res.WriteByte(':')
+		res.Write(m.value)
+	}
+	res.WriteByte('}')
+	return res.Bytes(), nil
+}
+
+// knownJSONFields returns the names of JSON object members which encoding/json maps to fields of t, a struct type.
+func knownJSONFields(t reflect.Type) []string {
+	res := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				res = append(res, knownJSONFields(fieldType)...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		res = append(res, name)
+	}
+	return res
+}
+
+// isKnownJSONField returns true if encoding/json would map a JSON object member called name to one of known.
+func isKnownJSONField(known []string, name string) bool {
+	for _, k := range known {
+		if strings.EqualFold(k, name) { // encoding/json matches names case-insensitively
+			return true
+		}
+	}
+	return false
+}
+
+// ParseUnknownFields returns the members of the JSON object in blob which encoding/json does not map to any field of v,
+// a struct or a pointer to a struct.
+func ParseUnknownFields(blob []byte, v any) (UnknownFields, error) {
+	members, err := parseJSONObject(blob)
+	if err != nil {
+		return nil, err
+	}
+	known := knownJSONFields(reflect.Indirect(reflect.ValueOf(v)).Type())
+	var res UnknownFields
+	for _, m := range members {
+		if !isKnownJSONField(known, m.name) {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+// MarshalWithUnknownFields returns the JSON representation of v, a struct or a pointer to a struct, with fields appended.
+// Values of members in replacements are used instead of values of the corresponding members of the JSON representation of v.
+// It fails if any of fields corresponds to a field of v, so that fields can’t be used to override known data.
+func MarshalWithUnknownFields(v any, fields UnknownFields, replacements map[string]json.RawMessage) ([]byte, error) {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 && len(replacements) == 0 {
+		return blob, nil
+	}
+	members, err := parseJSONObject(blob)
+	if err != nil {
+		return nil, err
+	}
+	for i := range members {
+		if value, ok := replacements[members[i].name]; ok {
+			members[i].value = value
+		}
+	}
+	known := knownJSONFields(reflect.Indirect(reflect.ValueOf(v)).Type())
+	for _, f := range fields {
+		if isKnownJSONField(known, f.name) {
+			return nil, fmt.Errorf("refusing to add unknown field %q which matches a known field", f.name)
+		}
+		members = append(members, f)
+	}
+	return writeJSONObject(members)
+}
+
+// DescriptorUnknownFields are the UnknownFields of OCI descriptors in a single manifest, looked up by the descriptor digest.
+// A descriptor which is replaced by one with a different digest loses the unknown fields, because they
+// may describe the original blob.
+// The zero value (nil) means there are no unknown fields.
+type DescriptorUnknownFields map[digest.Digest][]UnknownFields // Indexed by the occurrence of the digest, in order
+
+// ParseDescriptorUnknownFields returns the DescriptorUnknownFields of descriptors, JSON objects in the order they appear
+// in a manifest, or nil if there are none. Empty or null values (i.e. missing descriptors) are ignored.
+func ParseDescriptorUnknownFields(descriptors []json.RawMessage) (DescriptorUnknownFields, error) {
+	res := DescriptorUnknownFields{}
+	found := false
+	for _, blob := range descriptors {
+		if len(blob) == 0 || string(blob) == "null" {
+			continue
+		}
+		var descriptor imgspecv1.Descriptor
+		if err := json.Unmarshal(blob, &descriptor); err != nil {
+			return nil, err
+		}
+		unknown, err := ParseUnknownFields(blob, &descriptor)
+		if err != nil {
+			return nil, err
+		}
+		// Record even descriptors without unknown fields, so that the occurrences of a digest are counted correctly.
+		res[descriptor.Digest] = append(res[descriptor.Digest], unknown)
+		if unknown != nil {
+			found = true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	return res, nil
+}
+
+// DescriptorMarshaler serializes descriptors of a single manifest, including their DescriptorUnknownFields.
+// The descriptors must be serialized in the same order they were added to DescriptorUnknownFields.
+type DescriptorMarshaler struct {
+	fields      DescriptorUnknownFields
+	occurrences map[digest.Digest]int
+}
+
+// NewMarshaler returns a DescriptorMarshaler using fields.
+func (fields DescriptorUnknownFields) NewMarshaler() *DescriptorMarshaler {
+	return &DescriptorMarshaler{
+		fields:      fields,
+		occurrences: map[digest.Digest]int{},
+	}
+}
+
+// Descriptor returns the JSON representation of descriptor, including its unknown fields, if any.
+func (m *DescriptorMarshaler) Descriptor(descriptor imgspecv1.Descriptor) (json.RawMessage, error) {
+	var unknown UnknownFields
+	all := m.fields[descriptor.Digest]
+	if occurrence := m.occurrences[descriptor.Digest]; occurrence < len(all) {
+		unknown = all[occurrence]
+	}
+	m.occurrences[descriptor.Digest]++
+	return MarshalWithUnknownFields(descriptor, unknown, nil)
+}
+
+// Descriptors returns the JSON representation of descriptors, including their unknown fields, if any.
+func (m *DescriptorMarshaler) Descriptors(descriptors []imgspecv1.Descriptor) (json.RawMessage, error) {
+	if descriptors == nil {
+		return json.RawMessage("null"), nil // Consistent with encoding/json
+	}
+	res := make([]json.RawMessage, 0, len(descriptors))
+	for _, d := range descriptors {
+		blob, err := m.Descriptor(d)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, blob)
+	}
+	return json.Marshal(res)
+}
@@ -0,0 +1,53 @@
+package manifest
+
+import (
+	"encoding/json"
+	"testing"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUnknownFields(t *testing.T) {
+	for _, c := range []struct {
+		input    string
+		expected UnknownFields
+	}{
+		{`{}`, nil},
+		{`{"mediaType":"a","digest":"sha256:0","size":1}`, nil},
+		{`{"MEDIATYPE":"a"}`, nil}, // encoding/json matches names case-insensitively
+		{`{"mediaType":"a","b":1,"c" : [ 2 ],"size":1}`, UnknownFields{
+			{name: "b", value: json.RawMessage(`1`)},
+			{name: "c", value: json.RawMessage(`[ 2 ]`)},
+		}},
+	} {
+		res, err := ParseUnknownFields([]byte(c.input), &imgspecv1.Descriptor{})
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.expected, res, c.input)
+	}
+
+	for _, input := range []string{``, `[]`, `1`, `{"a":}`, `{"a":1`} {
+		_, err := ParseUnknownFields([]byte(input), &imgspecv1.Descriptor{})
+		assert.Error(t, err, input)
+	}
+}
+
+func TestMarshalWithUnknownFields(t *testing.T) {
+	descriptor := imgspecv1.Descriptor{MediaType: "a", Digest: "sha256:0", Size: 1}
+
+	res, err := MarshalWithUnknownFields(descriptor, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `{"mediaType":"a","digest":"sha256:0","size":1}`, string(res))
+
+	res, err = MarshalWithUnknownFields(descriptor, UnknownFields{{name: "b", value: json.RawMessage(`{"c":1}`)}},
+		map[string]json.RawMessage{"size": json.RawMessage(`2`)})
+	require.NoError(t, err)
+	assert.Equal(t, `{"mediaType":"a","digest":"sha256:0","size":2,"b":{"c":1}}`, string(res))
+
+	// Known fields can't be overridden through the unknown fields, even if they are empty in v
+	for _, name := range []string{"digest", "Digest", "urls", "annotations"} {
+		_, err := MarshalWithUnknownFields(descriptor, UnknownFields{{name: name, value: json.RawMessage(`"x"`)}}, nil)
+		assert.Error(t, err, name)
+	}
+}
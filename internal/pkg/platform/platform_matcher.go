@@ -148,6 +148,16 @@ func WantedPlatforms(ctx *types.SystemContext) ([]imgspecv1.Platform, error) {
 	if ctx != nil && ctx.OSChoice != "" {
 		wantedOS = ctx.OSChoice
 	}
+	wantedOSVersion := ""
+	if ctx != nil && ctx.OSVersionChoice != "" {
+		wantedOSVersion = ctx.OSVersionChoice
+	} else if wantedOS == runtime.GOOS {
+		// Only auto-detect the OS version if we are looking for images of the host OS.
+		wantedOSVersion = hostOSVersion()
+	}
+	if wantedOS != "windows" {
+		wantedOSVersion = "" // We only implement OS version matching for Windows.
+	}
 
 	var variants []string = nil
 	if wantedVariant != "" {
@@ -177,6 +187,7 @@ func WantedPlatforms(ctx *types.SystemContext) ([]imgspecv1.Platform, error) {
 	for _, v := range variants {
 		res = append(res, imgspecv1.Platform{
 			OS:           wantedOS,
+			OSVersion:    wantedOSVersion,
 			Architecture: wantedArch,
 			Variant:      v,
 		})
@@ -186,8 +197,31 @@ func WantedPlatforms(ctx *types.SystemContext) ([]imgspecv1.Platform, error) {
 
 // MatchesPlatform returns true if a platform descriptor from a multi-arch image matches
 // an item from the return value of WantedPlatforms.
+// For Windows, this includes checking that the image os.version is compatible with the wanted one;
+// use OSVersionPreference to choose among several matching images.
 func MatchesPlatform(image imgspecv1.Platform, wanted imgspecv1.Platform) bool {
 	return image.Architecture == wanted.Architecture &&
 		image.OS == wanted.OS &&
-		image.Variant == wanted.Variant
+		image.Variant == wanted.Variant &&
+		osVersionMatches(image, wanted)
+}
+
+// MatchesPlatformFilter returns true if image, a platform descriptor from a multi-arch image, satisfies filter,
+// which must specify at least an OS and an architecture.
+// This uses the same compatibility rules as choosing an image for a SystemContext with OSChoice, ArchitectureChoice,
+// VariantChoice and OSVersionChoice set to the values of filter: e.g. a filter for arm/v7 is satisfied
+// by images with variants v7, v6 or v5, or without a variant, and a filter without a variant is satisfied by any variant.
+func MatchesPlatformFilter(image imgspecv1.Platform, filter imgspecv1.Platform) (bool, error) {
+	wanted, err := WantedPlatforms(&types.SystemContext{
+		OSChoice:           filter.OS,
+		ArchitectureChoice: filter.Architecture,
+		VariantChoice:      filter.Variant,
+		OSVersionChoice:    filter.OSVersion,
+	})
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(wanted, func(w imgspecv1.Platform) bool {
+		return MatchesPlatform(image, w)
+	}), nil
 }
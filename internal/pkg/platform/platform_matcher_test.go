@@ -45,6 +45,18 @@ func TestWantedPlatforms(t *testing.T) {
 				{OS: "linux", Architecture: "arm64", Variant: "v8"},
 			},
 		},
+		{ // Windows with an OS version
+			types.SystemContext{ArchitectureChoice: "amd64", OSChoice: "windows", OSVersionChoice: "10.0.20348.1000"},
+			[]imgspecv1.Platform{
+				{OS: "windows", Architecture: "amd64", Variant: "", OSVersion: "10.0.20348.1000"},
+			},
+		},
+		{ // OS versions are ignored for other OSes
+			types.SystemContext{ArchitectureChoice: "amd64", OSChoice: "linux", OSVersionChoice: "10.0.20348.1000"},
+			[]imgspecv1.Platform{
+				{OS: "linux", Architecture: "amd64", Variant: ""},
+			},
+		},
 		{ // Custom (completely unrecognized data)
 			types.SystemContext{ArchitectureChoice: "armel", OSChoice: "freeBSD", VariantChoice: "custom"},
 			[]imgspecv1.Platform{
@@ -59,3 +71,32 @@ func TestWantedPlatforms(t *testing.T) {
 		assert.Equal(t, c.expected, platforms, testName)
 	}
 }
+
+func TestMatchesPlatformFilter(t *testing.T) {
+	for _, c := range []struct {
+		image, filter imgspecv1.Platform
+		expected      bool
+	}{
+		{imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, true},
+		{imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, imgspecv1.Platform{OS: "linux", Architecture: "arm64"}, false},
+		{imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, imgspecv1.Platform{OS: "windows", Architecture: "amd64"}, false},
+		// A variant filter accepts the same variant, compatible variants, and no variant
+		{imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, true},
+		{imgspecv1.Platform{OS: "linux", Architecture: "arm"}, imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, true},
+		{imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}, imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, true},
+		{imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v8"}, imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, false},
+		// No variant in the filter accepts any variant
+		{imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v5"}, imgspecv1.Platform{OS: "linux", Architecture: "arm"}, true},
+		{imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, imgspecv1.Platform{OS: "linux", Architecture: "arm64"}, true},
+		// Unrecognized variants only match exactly
+		{imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v9"}, imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v9"}, true},
+		{imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v9"}, false},
+		// Windows OS versions
+		{imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.1000"}, imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.2000"}, true},
+		{imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.1000"}, imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.2000"}, false},
+	} {
+		res, err := MatchesPlatformFilter(c.image, c.filter)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, res, fmt.Sprintf("%#v vs. %#v", c.image, c.filter))
+	}
+}
@@ -0,0 +1,84 @@
+package platform
+
+import (
+	"strconv"
+	"strings"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// windowsLTSC2022Build is the build number of Windows Server 2022 (LTSC 2022).
+// Hosts with this or a later build can run containers with builds from this one up to the host build;
+// older hosts can only run containers with exactly the same build.
+const windowsLTSC2022Build = 20348
+
+// windowsOSVersion is a parsed Windows os.version value, "major.minor.build[.revision]".
+type windowsOSVersion struct {
+	major, minor, build, revision uint64
+}
+
+// parseWindowsOSVersion parses a Windows os.version value, and returns ok == false if it is not valid.
+func parseWindowsOSVersion(s string) (windowsOSVersion, bool) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 && len(parts) != 4 {
+		return windowsOSVersion{}, false
+	}
+	values := make([]uint64, 4)
+	for i, part := range parts {
+		v, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return windowsOSVersion{}, false
+		}
+		values[i] = v
+	}
+	return windowsOSVersion{major: values[0], minor: values[1], build: values[2], revision: values[3]}, true
+}
+
+// windowsOSVersionCompatible returns true if a container with version image can run on a host with version host.
+func windowsOSVersionCompatible(image, host windowsOSVersion) bool {
+	if image.major != host.major || image.minor != host.minor {
+		return false
+	}
+	if host.build < windowsLTSC2022Build {
+		return image.build == host.build
+	}
+	return image.build >= windowsLTSC2022Build && image.build <= host.build
+}
+
+// osVersionMatches returns true if the os.version of image is compatible with wanted (an item from the return value
+// of WantedPlatforms). This is only relevant for Windows images with a known wanted OS version; images without
+// a valid os.version are assumed to be compatible.
+func osVersionMatches(image, wanted imgspecv1.Platform) bool {
+	if wanted.OS != "windows" || wanted.OSVersion == "" {
+		return true
+	}
+	host, ok := parseWindowsOSVersion(wanted.OSVersion)
+	if !ok {
+		return true
+	}
+	imageVersion, ok := parseWindowsOSVersion(image.OSVersion)
+	if !ok {
+		return true
+	}
+	return windowsOSVersionCompatible(imageVersion, host)
+}
+
+// OSVersionPreference returns a value which is larger for images preferred when choosing among images which
+// match (per MatchesPlatform) the same item from the return value of WantedPlatforms.
+// For Windows images, it prefers the build closest to the host build, and then the highest revision;
+// images without a valid os.version are least preferred. For other images, or if the wanted OS version is not valid,
+// all values are equal.
+func OSVersionPreference(image, wanted imgspecv1.Platform) uint64 {
+	if wanted.OS != "windows" || wanted.OSVersion == "" {
+		return 0
+	}
+	if _, ok := parseWindowsOSVersion(wanted.OSVersion); !ok {
+		return 0
+	}
+	imageVersion, ok := parseWindowsOSVersion(image.OSVersion)
+	if !ok {
+		return 0
+	}
+	// Compatible builds are never larger than the host build, so a larger build is closer to the host.
+	return imageVersion.build<<32 | imageVersion.revision
+}
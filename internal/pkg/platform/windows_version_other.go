@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package platform
+
+// hostOSVersion returns the os.version value of the current host, or "" if it is not known.
+func hostOSVersion() string {
+	return ""
+}
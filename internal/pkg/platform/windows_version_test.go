@@ -0,0 +1,126 @@
+package platform
+
+import (
+	"testing"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWindowsOSVersion(t *testing.T) {
+	for _, c := range []struct {
+		input    string
+		expected windowsOSVersion
+	}{
+		{"10.0.20348.1000", windowsOSVersion{major: 10, minor: 0, build: 20348, revision: 1000}},
+		{"10.0.17763", windowsOSVersion{major: 10, minor: 0, build: 17763, revision: 0}},
+	} {
+		res, ok := parseWindowsOSVersion(c.input)
+		assert.True(t, ok, c.input)
+		assert.Equal(t, c.expected, res, c.input)
+	}
+
+	for _, input := range []string{
+		"",
+		"10",
+		"10.0",
+		"10.0.20348.1000.1",
+		"10.0.x.1000",
+		"10.0.-1.1000",
+		"10.0.20348.99999999999",
+		"10..20348",
+	} {
+		_, ok := parseWindowsOSVersion(input)
+		assert.False(t, ok, input)
+	}
+}
+
+func TestWindowsOSVersionCompatible(t *testing.T) {
+	for _, c := range []struct {
+		image, host string
+		expected    bool
+	}{
+		// Before LTSC 2022, the build must match exactly
+		{"10.0.17763.1000", "10.0.17763.2000", true},
+		{"10.0.17763.2000", "10.0.17763.1000", true},
+		{"10.0.17763.1000", "10.0.19041.1000", false},
+		{"10.0.19041.1000", "10.0.17763.1000", false},
+		// Since LTSC 2022, builds from LTSC 2022 up to the host build are compatible
+		{"10.0.20348.1000", "10.0.20348.1", true},
+		{"10.0.20348.1000", "10.0.22621.1", true},
+		{"10.0.22621.1", "10.0.22621.1", true},
+		{"10.0.22621.1", "10.0.20348.1", false},
+		{"10.0.17763.1000", "10.0.20348.1", false},
+		// Major and minor versions must match
+		{"6.3.20348.1", "10.0.20348.1", false},
+		{"10.1.20348.1", "10.0.20348.1", false},
+	} {
+		image, ok := parseWindowsOSVersion(c.image)
+		assert.True(t, ok, c.image)
+		host, ok := parseWindowsOSVersion(c.host)
+		assert.True(t, ok, c.host)
+		assert.Equal(t, c.expected, windowsOSVersionCompatible(image, host), "%s on %s", c.image, c.host)
+	}
+}
+
+func TestMatchesPlatformOSVersion(t *testing.T) {
+	for _, c := range []struct {
+		image, wanted imgspecv1.Platform
+		expected      bool
+	}{
+		{ // Compatible
+			imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.1000"},
+			imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.22621.1"},
+			true,
+		},
+		{ // Incompatible
+			imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.1000"},
+			imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.1"},
+			false,
+		},
+		{ // Unknown wanted OS version
+			imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.1000"},
+			imgspecv1.Platform{OS: "windows", Architecture: "amd64"},
+			true,
+		},
+		{ // Invalid wanted OS version
+			imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.1000"},
+			imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "invalid"},
+			true,
+		},
+		{ // Image without an OS version
+			imgspecv1.Platform{OS: "windows", Architecture: "amd64"},
+			imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.1"},
+			true,
+		},
+		{ // The OS version does not make other fields match
+			imgspecv1.Platform{OS: "windows", Architecture: "arm64", OSVersion: "10.0.20348.1000"},
+			imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.1"},
+			false,
+		},
+	} {
+		assert.Equal(t, c.expected, MatchesPlatform(c.image, c.wanted), "%#v vs. %#v", c.image, c.wanted)
+	}
+}
+
+func TestOSVersionPreference(t *testing.T) {
+	wanted := imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.22621.1"}
+	pref := func(osVersion string) uint64 {
+		return OSVersionPreference(imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: osVersion}, wanted)
+	}
+	// A closer build is preferred, then a higher revision
+	assert.Greater(t, pref("10.0.22621.1"), pref("10.0.20348.2000"))
+	assert.Greater(t, pref("10.0.20348.2000"), pref("10.0.20348.1000"))
+	// Images without a valid OS version are least preferred
+	assert.Greater(t, pref("10.0.20348.1000"), pref(""))
+	assert.Equal(t, pref(""), pref("invalid"))
+
+	// No preference without a valid wanted OS version, or for other OSes
+	for _, w := range []imgspecv1.Platform{
+		{OS: "windows", Architecture: "amd64"},
+		{OS: "windows", Architecture: "amd64", OSVersion: "invalid"},
+		{OS: "linux", Architecture: "amd64", OSVersion: "10.0.22621.1"},
+	} {
+		assert.Equal(t, uint64(0), OSVersionPreference(imgspecv1.Platform{OS: w.OS, Architecture: "amd64", OSVersion: "10.0.20348.1000"}, w))
+	}
+}
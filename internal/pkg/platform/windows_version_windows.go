@@ -0,0 +1,22 @@
+package platform
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// hostOSVersion returns the os.version value of the current host, or "" if it is not known.
+func hostOSVersion() string {
+	v := windows.RtlGetVersion()
+	// The revision (“update build revision”) is not reported by RtlGetVersion.
+	revision := uint64(0)
+	if key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion`, registry.QUERY_VALUE); err == nil {
+		if ubr, _, err := key.GetIntegerValue("UBR"); err == nil {
+			revision = ubr
+		}
+		key.Close()
+	}
+	return fmt.Sprintf("%d.%d.%d.%d", v.MajorVersion, v.MinorVersion, v.BuildNumber, revision)
+}
@@ -10,6 +10,7 @@ import (
 	compression "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // ImageSourceInternalOnly is the part of private.ImageSource that is not
@@ -24,6 +25,7 @@ type ImageSourceInternalOnly interface {
 	// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
 	// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
 	// (e.g. if the source never returns manifest lists).
+	// The order of the signatures is transport-specific; UnparsedImage.UntrustedSignatures returns them in a canonical order.
 	GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error)
 }
 
@@ -33,6 +35,48 @@ type ImageSource interface {
 	ImageSourceInternalOnly
 }
 
+// SigstoreAttestationSource is an optional extension of ImageSource, for transports which can store sigstore attestations.
+type SigstoreAttestationSource interface {
+	// GetSigstoreAttestations returns the sigstore attestations (usually in-toto statements in DSSE envelopes) of the image.
+	// It may use a remote (= slow) service.
+	// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve attestations for
+	// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+	// (e.g. if the source never returns manifest lists).
+	GetSigstoreAttestations(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Sigstore, error)
+}
+
+// ReferrersSource is an optional extension of ImageSource, for transports which can list the manifests referring to a manifest
+// using their subject field (i.e. OCI 1.1 referrers).
+type ReferrersSource interface {
+	// GetReferrers returns descriptors of the manifests which refer to manifestDigest, and have artifactType
+	// (or any artifact type, if artifactType is ""). The descriptors include the artifact type and annotations of the manifests.
+	// It returns (nil, false, nil) if listing referrers is not supported (e.g. by the remote registry).
+	// It may use a remote (= slow) service.
+	GetReferrers(ctx context.Context, manifestDigest digest.Digest, artifactType string) ([]imgspecv1.Descriptor, bool, error)
+}
+
+// PreflightChecker is an optional extension of ImageSource and ImageDestination, for transports which can cheaply detect,
+// before any data is transferred, that a copy would certainly fail.
+type PreflightChecker interface {
+	// Preflight performs cheap checks (e.g. whether the credentials allow the intended access, or whether the repository exists),
+	// and returns an error (to be displayed to the user) if using the source or destination would certainly fail.
+	// A nil return value does not guarantee that the copy will succeed.
+	Preflight(ctx context.Context) error
+}
+
+// SignatureStorageNegotiator is an optional extension of ImageDestination, for destinations which can store signatures
+// using one of several methods, depending on the capabilities of the underlying storage.
+type SignatureStorageNegotiator interface {
+	// SupportedSignatureStorageMethods returns the signature storage methods usable with this destination, for each signature format
+	// the destination can store, most preferred first.
+	// It may contact a remote (= slow) service.
+	SupportedSignatureStorageMethods(ctx context.Context) (map[signature.FormatID][]types.SignatureStorageMethod, error)
+	// UseSignatureStorageMethods instructs PutSignaturesWithFormat to store signatures of each format in methods
+	// using the corresponding method, which must be one of the values returned by SupportedSignatureStorageMethods.
+	// Formats not present in methods are stored using the default method of the destination.
+	UseSignatureStorageMethods(methods map[signature.FormatID]types.SignatureStorageMethod) error
+}
+
 // ImageDestinationInternalOnly is the part of private.ImageDestination that is not
 // a part of types.ImageDestination.
 type ImageDestinationInternalOnly interface {
@@ -159,5 +203,12 @@ func (e BadPartialRequestError) Error() string {
 type UnparsedImage interface {
 	types.UnparsedImage
 	// UntrustedSignatures is like ImageSource.GetSignaturesWithFormat, but the result is cached; it is OK to call this however often you need.
+	// The signatures are returned in the canonical order of signature.CanonicalOrder, regardless of the order used by the transport.
 	UntrustedSignatures(ctx context.Context) ([]signature.Signature, error)
+	// UntrustedSignatureSourceIndices returns, for every signature returned by UntrustedSignatures, its index in the
+	// transport-specific order returned by ImageSource.GetSignaturesWithFormat. This is intended for debugging.
+	UntrustedSignatureSourceIndices(ctx context.Context) ([]int, error)
+	// UntrustedSigstoreAttestations is like SigstoreAttestationSource.GetSigstoreAttestations, but the result is cached;
+	// it is OK to call this however often you need. It returns no attestations if the source does not support them.
+	UntrustedSigstoreAttestations(ctx context.Context) ([]signature.Sigstore, error)
 }
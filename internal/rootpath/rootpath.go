@@ -0,0 +1,79 @@
+// Package rootpath opens files which must stay within a directory, even if the directory contents are untrusted.
+package rootpath
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isLocal returns true if rel, a path relative to some directory (as returned by filepath.Rel), stays within that directory.
+func isLocal(rel string) bool {
+	return !filepath.IsAbs(rel) && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Resolve returns path, which must be within root, with all symbolic links resolved.
+// It fails if path is outside of root, either lexically or after resolving symbolic links (e.g. if a subdirectory
+// of root is a symbolic link to a different location).
+// root itself is trusted, and may be a symbolic link.
+// If path does not exist, the returned error satisfies os.IsNotExist.
+func Resolve(root, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	if !isLocal(rel) {
+		return "", fmt.Errorf("path %q is outside of %q", path, root)
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(resolvedRoot, rel))
+	if err != nil {
+		return "", err
+	}
+	resolvedRel, err := filepath.Rel(resolvedRoot, resolved)
+	if err != nil {
+		return "", err
+	}
+	if !isLocal(resolvedRel) {
+		return "", fmt.Errorf("path %q resolves to %q, outside of %q", path, resolved, root)
+	}
+	return resolved, nil
+}
+
+// Open opens path, which must be a regular file within root, for reading; see Resolve for details.
+func Open(root, path string) (*os.File, error) {
+	resolved, err := Resolve(root, path)
+	if err != nil {
+		return nil, err
+	}
+	// All symbolic links have been resolved; if the file is replaced by one now, refuse to follow it.
+	f, err := os.OpenFile(resolved, os.O_RDONLY|oNoFollow, 0)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		f.Close()
+		return nil, fmt.Errorf("%q is not a regular file", path)
+	}
+	return f, nil
+}
+
+// ReadFile reads path, which must be a regular file within root; see Resolve for details.
+func ReadFile(root, path string) ([]byte, error) {
+	f, err := Open(root, path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
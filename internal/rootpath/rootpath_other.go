@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package rootpath
+
+import "syscall"
+
+// oNoFollow makes os.OpenFile fail if the last component of the path is a symbolic link.
+const oNoFollow = syscall.O_NOFOLLOW
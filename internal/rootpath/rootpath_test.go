@@ -0,0 +1,130 @@
+package rootpath
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsLocal(t *testing.T) {
+	for _, c := range []struct {
+		rel      string
+		expected bool
+	}{
+		{".", true},
+		{"a", true},
+		{"a/b", true},
+		{"..a", true},
+		{"a/../b", true},
+		{"..", false},
+		{"../a", false},
+		{"/a", false},
+	} {
+		assert.Equal(t, c.expected, isLocal(filepath.FromSlash(c.rel)), c.rel)
+	}
+}
+
+// setupRoot creates a directory tree for tests:
+// root/file, root/dir/file, root/inside → dir, root/outside → a directory outside of root,
+// root/outsidefile and root/dir/relativeoutside → a file outside of root, and rootlink → root.
+// It returns the parent of root, and root.
+func setupRoot(t *testing.T) (string, string) {
+	top := t.TempDir()
+	root := filepath.Join(top, "root")
+	outside := filepath.Join(top, "outside")
+	for _, dir := range []string{root, filepath.Join(root, "dir"), outside} {
+		err := os.Mkdir(dir, 0o755)
+		require.NoError(t, err)
+	}
+	for _, file := range []string{filepath.Join(root, "file"), filepath.Join(root, "dir", "file"), filepath.Join(outside, "file")} {
+		err := os.WriteFile(file, []byte("contents of "+file), 0o644)
+		require.NoError(t, err)
+	}
+	for _, link := range []struct{ target, path string }{
+		{"dir", filepath.Join(root, "inside")},
+		{outside, filepath.Join(root, "outside")},
+		{filepath.Join(outside, "file"), filepath.Join(root, "outsidefile")},
+		{"../outside/file", filepath.Join(root, "dir", "relativeoutside")},
+		{root, filepath.Join(top, "rootlink")},
+	} {
+		err := os.Symlink(link.target, link.path)
+		require.NoError(t, err)
+	}
+	return top, root
+}
+
+func TestResolve(t *testing.T) {
+	top, root := setupRoot(t)
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	require.NoError(t, err)
+
+	for _, c := range []struct{ path, expected string }{
+		{"file", "file"},
+		{"dir/file", "dir/file"},
+		{"inside/file", "dir/file"},
+		{"dir/../file", "file"},
+	} {
+		res, err := Resolve(root, filepath.Join(root, c.path))
+		require.NoError(t, err, c.path)
+		assert.Equal(t, filepath.Join(resolvedRoot, c.expected), res, c.path)
+
+		// root itself may be a symbolic link
+		res, err = Resolve(filepath.Join(top, "rootlink"), filepath.Join(top, "rootlink", c.path))
+		require.NoError(t, err, c.path)
+		assert.Equal(t, filepath.Join(resolvedRoot, c.expected), res, c.path)
+	}
+
+	for _, path := range []string{
+		filepath.Join(root, "outside", "file"),
+		filepath.Join(root, "outsidefile"),
+		filepath.Join(root, "dir", "relativeoutside"),
+		filepath.Join(root, "..", "outside", "file"),
+		filepath.Join(top, "outside", "file"),
+		"/etc/passwd",
+	} {
+		_, err := Resolve(root, path)
+		assert.Error(t, err, path)
+		assert.False(t, os.IsNotExist(err), path)
+	}
+
+	_, err = Resolve(root, filepath.Join(root, "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOpen(t *testing.T) {
+	_, root := setupRoot(t)
+
+	f, err := Open(root, filepath.Join(root, "inside", "file"))
+	require.NoError(t, err)
+	defer f.Close()
+	contents, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "contents of "+filepath.Join(root, "dir", "file"), string(contents))
+
+	for _, path := range []string{
+		filepath.Join(root, "outside", "file"),
+		filepath.Join(root, "outsidefile"),
+		filepath.Join(root, "dir"), // Not a regular file
+	} {
+		_, err := Open(root, path)
+		assert.Error(t, err, path)
+	}
+
+	_, err = Open(root, filepath.Join(root, "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReadFile(t *testing.T) {
+	_, root := setupRoot(t)
+
+	contents, err := ReadFile(root, filepath.Join(root, "file"))
+	require.NoError(t, err)
+	assert.Equal(t, "contents of "+filepath.Join(root, "file"), string(contents))
+
+	_, err = ReadFile(root, filepath.Join(root, "outsidefile"))
+	assert.Error(t, err)
+}
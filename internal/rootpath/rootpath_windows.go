@@ -0,0 +1,5 @@
+package rootpath
+
+// oNoFollow would make os.OpenFile fail if the last component of the path is a symbolic link; Windows has no equivalent,
+// so we rely only on the checks in Resolve.
+const oNoFollow = 0
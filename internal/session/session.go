@@ -0,0 +1,66 @@
+// Package session allows transports to share state, e.g. connections to a registry and authentication tokens,
+// across several ImageSource/ImageDestination objects created for a single long-lived operation.
+package session
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Session holds state shared by transport objects created using a context returned by WithSession.
+// The values are opaque to the session; each transport chooses its own keys and value types.
+// A Session may be used concurrently.
+// The owner must call Close() when done.
+type Session struct {
+	mutex  sync.Mutex // Protects values
+	values map[any]any
+}
+
+// New returns a new, empty, Session.
+func New() *Session {
+	return &Session{values: map[any]any{}}
+}
+
+// LoadOrCreate returns the value stored for key, creating it using create if it does not exist yet.
+// key must be comparable; transports should use a private type for their keys to avoid collisions.
+func (s *Session) LoadOrCreate(key any, create func() any) any {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if v, ok := s.values[key]; ok {
+		return v
+	}
+	v := create()
+	s.values[key] = v
+	return v
+}
+
+// Close releases the resources associated with the session, by closing all values which implement io.Closer.
+func (s *Session) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, v := range s.values {
+		if closer, ok := v.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				logrus.Warnf("Error closing session state %v: %v", key, err)
+			}
+		}
+	}
+	s.values = map[any]any{}
+}
+
+// sessionContextKey is the context.Context key of the *Session of WithSession.
+type sessionContextKey struct{}
+
+// WithSession returns a context which makes s available to transports.
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, s)
+}
+
+// FromContext returns the *Session associated with ctx by WithSession, or nil.
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionContextKey{}).(*Session)
+	return s
+}
@@ -0,0 +1,33 @@
+package signature
+
+import (
+	"sort"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// CanonicalOrder returns sigs sorted in the canonical order used for signatures of all transports, and, for every
+// element of the result, the index of that signature in sigs (i.e. in the transport-specific order).
+//
+// The canonical order sorts signatures by the digest of their Blob(); identical signatures stay in their original order.
+// sigs is not modified.
+func CanonicalOrder(sigs []Signature) ([]Signature, []int, error) {
+	digests := make([]digest.Digest, len(sigs))
+	indices := make([]int, len(sigs))
+	for i, sig := range sigs {
+		blob, err := Blob(sig)
+		if err != nil {
+			return nil, nil, err
+		}
+		digests[i] = digest.FromBytes(blob)
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return digests[indices[i]] < digests[indices[j]]
+	})
+	res := make([]Signature, len(sigs))
+	for i, originalIndex := range indices {
+		res[i] = sigs[originalIndex]
+	}
+	return res, indices, nil
+}
@@ -0,0 +1,56 @@
+package signature
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalOrder(t *testing.T) {
+	sig1 := SimpleSigningFromBlob([]byte("signature 1"))
+	sig2 := SigstoreFromComponents("mime-type", []byte("payload 2"), map[string]string{"a": "b"})
+	sig3 := SigstoreFromComponents("mime-type", []byte("payload 3"), map[string]string{"a": "b"})
+	sig4 := SimpleSigningFromBlob([]byte("signature 4"))
+	all := []Signature{sig1, sig2, sig3, sig4}
+
+	expected, _, err := CanonicalOrder(all)
+	require.NoError(t, err)
+	require.Len(t, expected, len(all))
+	assert.ElementsMatch(t, all, expected)
+
+	for _, input := range [][]Signature{
+		{sig1, sig2, sig3, sig4},
+		{sig4, sig3, sig2, sig1},
+		{sig2, sig4, sig1, sig3},
+	} {
+		original := append([]Signature{}, input...)
+		res, indices, err := CanonicalOrder(input)
+		require.NoError(t, err)
+		assert.Equal(t, expected, res)
+		require.Len(t, indices, len(input))
+		for i, index := range indices {
+			assert.Equal(t, input[index], res[i])
+		}
+		assert.Equal(t, original, input) // The input is not modified
+	}
+
+	// Identical signatures stay in their original order
+	dup := SimpleSigningFromBlob([]byte("signature 1"))
+	res, indices, err := CanonicalOrder([]Signature{sig4, sig1, dup})
+	require.NoError(t, err)
+	assert.Len(t, res, 3)
+	sig1Indices := []int{}
+	for _, index := range indices {
+		if index != 0 {
+			sig1Indices = append(sig1Indices, index)
+		}
+	}
+	assert.Equal(t, []int{1, 2}, sig1Indices)
+
+	// Empty input
+	res, indices, err = CanonicalOrder([]Signature{})
+	require.NoError(t, err)
+	assert.Empty(t, res)
+	assert.Empty(t, indices)
+}
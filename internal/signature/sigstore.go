@@ -10,6 +10,8 @@ import (
 const (
 	// from sigstore/cosign/pkg/types.SimpleSigningMediaType
 	SigstoreSignatureMIMEType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// from sigstore/cosign/pkg/types.DssePayloadType; used for attestations
+	SigstoreAttestationMIMEType = "application/vnd.dsse.envelope.v1+json"
 	// from sigstore/cosign/pkg/oci/static.SignatureAnnotationKey
 	SigstoreSignatureAnnotationKey = "dev.cosignproject.cosign/signature"
 	// from sigstore/cosign/pkg/oci/static.BundleAnnotationKey
@@ -18,6 +20,8 @@ const (
 	SigstoreCertificateAnnotationKey = "dev.sigstore.cosign/certificate"
 	// from sigstore/cosign/pkg/oci/static.ChainAnnotationKey
 	SigstoreIntermediateCertificateChainAnnotationKey = "dev.sigstore.cosign/chain"
+	// from sigstore/cosign/pkg/oci/static.RFC3161TimestampAnnotationKey
+	SigstoreRFC3161TimestampAnnotationKey = "dev.sigstore.cosign/rfc3161timestamp"
 )
 
 // Sigstore is a github.com/cosign/cosign signature.
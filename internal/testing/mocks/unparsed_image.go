@@ -29,3 +29,13 @@ func (ref ForbiddenUnparsedImage) Signatures(context.Context) ([][]byte, error)
 func (ref ForbiddenUnparsedImage) UntrustedSignatures(ctx context.Context) ([]signature.Signature, error) {
 	panic("unexpected call to a mock function")
 }
+
+// UntrustedSignatureSourceIndices is a mock that panics.
+func (ref ForbiddenUnparsedImage) UntrustedSignatureSourceIndices(ctx context.Context) ([]int, error) {
+	panic("unexpected call to a mock function")
+}
+
+// UntrustedSigstoreAttestations is a mock that panics.
+func (ref ForbiddenUnparsedImage) UntrustedSigstoreAttestations(ctx context.Context) ([]signature.Sigstore, error) {
+	panic("unexpected call to a mock function")
+}
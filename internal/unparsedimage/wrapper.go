@@ -25,14 +25,34 @@ func FromPublic(unparsed types.UnparsedImage) private.UnparsedImage {
 }
 
 // UntrustedSignatures is like ImageSource.GetSignaturesWithFormat, but the result is cached; it is OK to call this however often you need.
+// The signatures are returned in the canonical order of signature.CanonicalOrder, regardless of the order used by the transport.
 func (w *wrapped) UntrustedSignatures(ctx context.Context) ([]signature.Signature, error) {
+	res, _, err := w.orderedSignatures(ctx)
+	return res, err
+}
+
+// UntrustedSignatureSourceIndices returns, for every signature returned by UntrustedSignatures, its index in the
+// transport-specific order returned by ImageSource.GetSignaturesWithFormat. This is intended for debugging.
+func (w *wrapped) UntrustedSignatureSourceIndices(ctx context.Context) ([]int, error) {
+	_, indices, err := w.orderedSignatures(ctx)
+	return indices, err
+}
+
+// orderedSignatures returns the signatures of w in the canonical order, and their indices in the order of w.Signatures.
+func (w *wrapped) orderedSignatures(ctx context.Context) ([]signature.Signature, []int, error) {
 	sigs, err := w.Signatures(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	res := []signature.Signature{}
 	for _, sig := range sigs {
 		res = append(res, signature.SimpleSigningFromBlob(sig))
 	}
-	return res, nil
+	return signature.CanonicalOrder(res)
+}
+
+// UntrustedSigstoreAttestations is like SigstoreAttestationSource.GetSigstoreAttestations, but the result is cached;
+// it is OK to call this however often you need. It returns no attestations if the source does not support them.
+func (w *wrapped) UntrustedSigstoreAttestations(ctx context.Context) ([]signature.Sigstore, error) {
+	return []signature.Sigstore{}, nil
 }
@@ -31,6 +31,8 @@ type Schema2 struct {
 	MediaType         string              `json:"mediaType"`
 	ConfigDescriptor  Schema2Descriptor   `json:"config"`
 	LayersDescriptors []Schema2Descriptor `json:"layers"`
+
+	unknownFields manifest.UnknownFields // Fields of the original blob not known to this type, preserved by Serialize
 }
 
 // Schema2Port is a Port, a string containing port number and protocol in the
@@ -173,6 +175,11 @@ func Schema2FromManifest(manifestBlob []byte) (*Schema2, error) {
 			return nil, err
 		}
 	}
+	unknownFields, err := manifest.ParseUnknownFields(manifestBlob, &s2)
+	if err != nil {
+		return nil, err
+	}
+	s2.unknownFields = unknownFields
 	return &s2, nil
 }
 
@@ -253,8 +260,9 @@ func (m *Schema2) UpdateLayerInfos(layerInfos []types.BlobInfo) error {
 
 // Serialize returns the manifest in a blob format.
 // NOTE: Serialize() does not in general reproduce the original blob if this object was loaded from one, even if no modifications were made!
+// Fields of the original blob not known to Schema2 are preserved, though.
 func (m *Schema2) Serialize() ([]byte, error) {
-	return json.Marshal(*m)
+	return manifest.MarshalWithUnknownFields(*m, m.unknownFields, nil)
 }
 
 // Inspect returns various information for (skopeo inspect) parsed from the manifest and configuration.
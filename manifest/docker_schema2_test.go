@@ -64,6 +64,23 @@ func TestSchema2FromManifest(t *testing.T) {
 	testValidManifestWithExtraFieldsIsRejected(t, parser, validManifest, []string{"fsLayers", "history", "manifests"})
 }
 
+func TestSchema2UnknownFields(t *testing.T) {
+	original := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json",` +
+		`"config":{"mediaType":"application/vnd.docker.container.image.v1+json","size":7023,"digest":"sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7"},` +
+		`"layers":[{"mediaType":"application/vnd.docker.image.rootfs.diff.tar.gzip","size":32654,"digest":"sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f"}],` +
+		`"futureField":{"a":1}}`)
+	m, err := Schema2FromManifest(original)
+	require.NoError(t, err)
+	serialized, err := m.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, string(original), string(serialized))
+	assert.Equal(t, digest.FromBytes(original), digest.FromBytes(serialized))
+
+	serialized, err = Schema2Clone(m).Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, string(original), string(serialized))
+}
+
 func TestUpdateLayerInfosV2S2GzipToZstd(t *testing.T) {
 	origManifest := manifestSchema2FromFixture(t, "v2s2.manifest.json")
 	err := origManifest.UpdateLayerInfos([]types.BlobInfo{
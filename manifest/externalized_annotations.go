@@ -0,0 +1,106 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	digest "github.com/opencontainers/go-digest"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Externalized annotations
+//
+// Registries limit the size of manifests they accept (commonly to 4 MiB), so a manifest with very large annotation
+// values (e.g. SBOM fragments) may be impossible to push. To allow pushing such a manifest, a large annotation value
+// can be “externalized”:
+//   - the value is stored, exactly as is, in a separate blob in the same repository, with media type
+//     ExternalizedAnnotationMediaType;
+//   - the annotation KEY is removed, and an annotation with the key ExternalizedAnnotationPrefix+KEY and the digest
+//     of the blob as a value is added instead.
+//
+// This applies to any annotations map in a manifest, e.g. the top-level annotations of OCI manifests and indexes,
+// and annotations of descriptors they contain. Readers can restore the original values using InternalizeAnnotations.
+//
+// The annotations are not references registries recognize, so registries which garbage-collect unreferenced blobs
+// would remove the blobs. Writers must therefore also store an OCI artifact, with a config media type of
+// ExternalizedAnnotationsArtifactType, which has the modified manifest as a subject, and the blobs as layers.
+
+const (
+	// ExternalizedAnnotationPrefix is prepended to the key of an externalized annotation.
+	ExternalizedAnnotationPrefix = "io.containers.image.externalized-annotation."
+	// ExternalizedAnnotationMediaType is the media type of blobs containing externalized annotation values.
+	ExternalizedAnnotationMediaType = "application/vnd.containers.image.annotation.v1"
+	// ExternalizedAnnotationsArtifactType is the artifact type of OCI artifacts which refer to blobs containing
+	// externalized annotation values, to keep the blobs from being garbage-collected.
+	ExternalizedAnnotationsArtifactType = "application/vnd.containers.image.externalized-annotations.v1+json"
+)
+
+// ExternalizeAnnotations returns annotations with every value of at least minSize bytes externalized, using putBlob to store
+// the value and return its digest, and true if any annotation was externalized.
+// Annotations which are already externalized are not modified.
+// The input map is not modified; if nothing was externalized, it is returned as is.
+func ExternalizeAnnotations(annotations map[string]string, minSize int, putBlob func(value []byte) (digest.Digest, error)) (map[string]string, bool, error) {
+	keys := make([]string, 0, len(annotations))
+	for key, value := range annotations {
+		if len(value) >= minSize && !strings.HasPrefix(key, ExternalizedAnnotationPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return annotations, false, nil
+	}
+	slices.Sort(keys) // Only to make the order of putBlob calls deterministic
+
+	res := maps.Clone(annotations)
+	for _, key := range keys {
+		if _, ok := res[ExternalizedAnnotationPrefix+key]; ok {
+			return nil, false, fmt.Errorf("externalizing annotation %q: annotation %q already exists", key, ExternalizedAnnotationPrefix+key)
+		}
+		d, err := putBlob([]byte(res[key]))
+		if err != nil {
+			return nil, false, fmt.Errorf("externalizing annotation %q: %w", key, err)
+		}
+		delete(res, key)
+		res[ExternalizedAnnotationPrefix+key] = d.String()
+	}
+	return res, true, nil
+}
+
+// InternalizeAnnotations returns annotations with every externalized annotation replaced by its original value,
+// using getBlob to read the contents of a blob.
+// The input map is not modified; if no annotation was externalized, it is returned as is.
+func InternalizeAnnotations(annotations map[string]string, getBlob func(digest.Digest) ([]byte, error)) (map[string]string, error) {
+	keys := []string{}
+	for key := range annotations {
+		if strings.HasPrefix(key, ExternalizedAnnotationPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return annotations, nil
+	}
+	slices.Sort(keys)
+
+	res := maps.Clone(annotations)
+	for _, pointerKey := range keys {
+		key := strings.TrimPrefix(pointerKey, ExternalizedAnnotationPrefix)
+		if _, ok := res[key]; ok {
+			return nil, fmt.Errorf("annotation %q is both present and externalized", key)
+		}
+		d, err := digest.Parse(res[pointerKey])
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest of externalized annotation %q: %w", key, err)
+		}
+		value, err := getBlob(d)
+		if err != nil {
+			return nil, fmt.Errorf("reading externalized annotation %q: %w", key, err)
+		}
+		if !d.Algorithm().Available() || d.Algorithm().FromBytes(value) != d {
+			return nil, fmt.Errorf("externalized annotation %q does not match digest %s", key, d.String())
+		}
+		delete(res, pointerKey)
+		res[key] = string(value)
+	}
+	return res, nil
+}
@@ -0,0 +1,118 @@
+package manifest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blobStore is a trivial in-memory blob store for externalized annotations.
+type blobStore map[digest.Digest][]byte
+
+func (s blobStore) put(value []byte) (digest.Digest, error) {
+	d := digest.FromBytes(value)
+	s[d] = value
+	return d, nil
+}
+
+func (s blobStore) get(d digest.Digest) ([]byte, error) {
+	value, ok := s[d]
+	if !ok {
+		return nil, errors.New("blob not found")
+	}
+	return value, nil
+}
+
+func TestExternalizeAnnotations(t *testing.T) {
+	large1 := strings.Repeat("a", 100)
+	large2 := strings.Repeat("b", 200)
+	original := map[string]string{
+		"small":  "value",
+		"large1": large1,
+		"large2": large2,
+	}
+
+	// Nothing to externalize
+	store := blobStore{}
+	res, changed, err := ExternalizeAnnotations(original, 1000, store.put)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, original, res)
+	assert.Empty(t, store)
+	res, changed, err = ExternalizeAnnotations(nil, 1, store.put)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Nil(t, res)
+
+	// Large values are externalized, and can be internalized again
+	res, changed, err = ExternalizeAnnotations(original, 100, store.put)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, map[string]string{
+		"small":                                 "value",
+		ExternalizedAnnotationPrefix + "large1": digest.FromString(large1).String(),
+		ExternalizedAnnotationPrefix + "large2": digest.FromString(large2).String(),
+	}, res)
+	assert.Len(t, original, 3) // The input was not modified
+	assert.Equal(t, large1, original["large1"])
+	assert.Len(t, store, 2)
+	internalized, err := InternalizeAnnotations(res, store.get)
+	require.NoError(t, err)
+	assert.Equal(t, original, internalized)
+
+	// Pointer annotations are not externalized again, even if they are large enough
+	res2, changed, err := ExternalizeAnnotations(res, 50, store.put)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, res, res2)
+
+	// A conflict with an existing pointer annotation
+	_, _, err = ExternalizeAnnotations(map[string]string{
+		"large1":                                large1,
+		ExternalizedAnnotationPrefix + "large1": "something",
+	}, 100, store.put)
+	assert.Error(t, err)
+
+	// putBlob failure
+	_, _, err = ExternalizeAnnotations(original, 100, func([]byte) (digest.Digest, error) {
+		return "", errors.New("put failed")
+	})
+	assert.ErrorContains(t, err, "put failed")
+}
+
+func TestInternalizeAnnotations(t *testing.T) {
+	store := blobStore{}
+	valueDigest, err := store.put([]byte("value"))
+	require.NoError(t, err)
+
+	// Nothing to internalize
+	original := map[string]string{"a": "b"}
+	res, err := InternalizeAnnotations(original, store.get)
+	require.NoError(t, err)
+	assert.Equal(t, original, res)
+	res, err = InternalizeAnnotations(nil, store.get)
+	require.NoError(t, err)
+	assert.Nil(t, res)
+
+	for _, annotations := range []map[string]string{
+		// Both present and externalized
+		{"a": "b", ExternalizedAnnotationPrefix + "a": valueDigest.String()},
+		// Invalid digest
+		{ExternalizedAnnotationPrefix + "a": "sha256:invalid"},
+		// Missing blob
+		{ExternalizedAnnotationPrefix + "a": digest.FromString("missing").String()},
+	} {
+		_, err := InternalizeAnnotations(annotations, store.get)
+		assert.Error(t, err, annotations)
+	}
+
+	// Digest mismatch
+	tamperedDigest := digest.FromString("tampered")
+	store[tamperedDigest] = []byte("not tampered")
+	_, err = InternalizeAnnotations(map[string]string{ExternalizedAnnotationPrefix + "a": tamperedDigest.String()}, store.get)
+	assert.ErrorContains(t, err, "does not match digest")
+}
@@ -2,6 +2,7 @@ package manifest
 
 import (
 	"github.com/containers/image/v5/internal/manifest"
+	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
@@ -33,3 +34,11 @@ func ListFromBlob(manifestBlob []byte, manifestMIMEType string) (List, error) {
 func ConvertListToMIMEType(list List, manifestMIMEType string) (List, error) {
 	return list.ConvertToMIMEType(manifestMIMEType)
 }
+
+// CanonicalListBlob returns a canonical serialization of list, and its digest.
+// The canonical form preserves the order of instances, but does not depend on the order of keys in the original
+// JSON: the JSON is compact, and object keys are sorted.
+// Parsing the result and canonicalizing it again returns exactly the same bytes and digest.
+func CanonicalListBlob(list List) ([]byte, digest.Digest, error) {
+	return manifest.CanonicalListBlob(list)
+}
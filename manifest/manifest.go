@@ -38,6 +38,10 @@ const (
 // on an object which is not a “container image” in the standard sense (e.g. an OCI artifact)
 type NonImageArtifactError = manifest.NonImageArtifactError
 
+// ConfigDigestMismatchError (detected via errors.As) is used when a config blob does not match
+// the digest in the config descriptor of the manifest.
+type ConfigDigestMismatchError = manifest.ConfigDigestMismatchError
+
 // SupportedSchema2MediaType checks if the specified string is a supported Docker v2s2 media type.
 func SupportedSchema2MediaType(m string) error {
 	switch m {
@@ -138,7 +142,7 @@ func AddDummyV2S1Signature(manifest []byte) ([]byte, error) {
 
 // MIMETypeIsMultiImage returns true if mimeType is a list of images
 func MIMETypeIsMultiImage(mimeType string) bool {
-	return mimeType == DockerV2ListMediaType || mimeType == imgspecv1.MediaTypeImageIndex
+	return IsIndex(mimeType)
 }
 
 // MIMETypeSupportsEncryption returns true if the mimeType supports encryption
@@ -0,0 +1,150 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/pkg/compression"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	ociencspec "github.com/containers/ocicrypt/spec"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// DockerV2Schema2LayerMediaTypeEncrypted is the MIME type used for encrypted gzipped schema 2 layers.
+	// Note that this is not defined by any standard; it is only produced by OCI encryption tools.
+	DockerV2Schema2LayerMediaTypeEncrypted = DockerV2Schema2LayerMediaType + encryptedMediaTypeSuffix
+	// OCI1EmptyJSONMediaType is the MIME type of the empty JSON object, used as a config of OCI artifacts without a config.
+	OCI1EmptyJSONMediaType = "application/vnd.oci.empty.v1+json"
+)
+
+// encryptedMediaTypeSuffix is the suffix added to layer MIME types by OCI encryption.
+const encryptedMediaTypeSuffix = "+encrypted"
+
+// mediaTypeKind is the kind of object described by a MIME type.
+type mediaTypeKind int
+
+const (
+	mediaTypeKindImageManifest mediaTypeKind = iota
+	mediaTypeKindIndex
+	mediaTypeKindConfig
+	mediaTypeKindLayer
+)
+
+// mediaTypeInfo describes a MIME type in knownMediaTypes.
+type mediaTypeInfo struct {
+	kind  mediaTypeKind
+	layer LayerMediaType // Only valid if kind == mediaTypeKindLayer
+}
+
+// knownMediaTypes contains all MIME types recognized by IsImageManifest, IsIndex, IsConfig, IsLayer, CompressionFromMediaType
+// and EncryptedVariantOf/DecryptedVariantOf.
+// For every encrypted layer type, the type without encryptedMediaTypeSuffix must also be present.
+var knownMediaTypes = map[string]mediaTypeInfo{
+	DockerV2Schema1MediaType:         {kind: mediaTypeKindImageManifest},
+	DockerV2Schema1SignedMediaType:   {kind: mediaTypeKindImageManifest},
+	DockerV2Schema2MediaType:         {kind: mediaTypeKindImageManifest},
+	imgspecv1.MediaTypeImageManifest: {kind: mediaTypeKindImageManifest},
+
+	DockerV2ListMediaType:         {kind: mediaTypeKindIndex},
+	imgspecv1.MediaTypeImageIndex: {kind: mediaTypeKindIndex},
+
+	DockerV2Schema2ConfigMediaType: {kind: mediaTypeKindConfig},
+	imgspecv1.MediaTypeImageConfig: {kind: mediaTypeKindConfig},
+	OCI1EmptyJSONMediaType:         {kind: mediaTypeKindConfig},
+
+	DockerV2SchemaLayerMediaTypeUncompressed: {kind: mediaTypeKindLayer},
+	DockerV2Schema2LayerMediaType:            {kind: mediaTypeKindLayer, layer: LayerMediaType{Compression: &compression.Gzip}},
+	DockerV2Schema2LayerMediaTypeEncrypted:   {kind: mediaTypeKindLayer, layer: LayerMediaType{Compression: &compression.Gzip, Encrypted: true}},
+	DockerV2Schema2ForeignLayerMediaType:     {kind: mediaTypeKindLayer, layer: LayerMediaType{NonDistributable: true}},
+	DockerV2Schema2ForeignLayerMediaTypeGzip: {kind: mediaTypeKindLayer, layer: LayerMediaType{Compression: &compression.Gzip, NonDistributable: true}},
+
+	imgspecv1.MediaTypeImageLayer:     {kind: mediaTypeKindLayer},
+	imgspecv1.MediaTypeImageLayerGzip: {kind: mediaTypeKindLayer, layer: LayerMediaType{Compression: &compression.Gzip}},
+	imgspecv1.MediaTypeImageLayerZstd: {kind: mediaTypeKindLayer, layer: LayerMediaType{Compression: &compression.Zstd}},
+	ociencspec.MediaTypeLayerEnc:      {kind: mediaTypeKindLayer, layer: LayerMediaType{Encrypted: true}},
+	ociencspec.MediaTypeLayerGzipEnc:  {kind: mediaTypeKindLayer, layer: LayerMediaType{Compression: &compression.Gzip, Encrypted: true}},
+	ociencspec.MediaTypeLayerZstdEnc:  {kind: mediaTypeKindLayer, layer: LayerMediaType{Compression: &compression.Zstd, Encrypted: true}},
+
+	imgspecv1.MediaTypeImageLayerNonDistributable:     {kind: mediaTypeKindLayer, layer: LayerMediaType{NonDistributable: true}},
+	imgspecv1.MediaTypeImageLayerNonDistributableGzip: {kind: mediaTypeKindLayer, layer: LayerMediaType{Compression: &compression.Gzip, NonDistributable: true}},
+	imgspecv1.MediaTypeImageLayerNonDistributableZstd: {kind: mediaTypeKindLayer, layer: LayerMediaType{Compression: &compression.Zstd, NonDistributable: true}},
+	ociencspec.MediaTypeLayerNonDistributableEnc:      {kind: mediaTypeKindLayer, layer: LayerMediaType{Encrypted: true, NonDistributable: true}},
+	ociencspec.MediaTypeLayerNonDistributableGzipEnc:  {kind: mediaTypeKindLayer, layer: LayerMediaType{Compression: &compression.Gzip, Encrypted: true, NonDistributable: true}},
+	ociencspec.MediaTypeLayerNonDistributableZsdtEnc:  {kind: mediaTypeKindLayer, layer: LayerMediaType{Compression: &compression.Zstd, Encrypted: true, NonDistributable: true}},
+}
+
+// LayerMediaType describes the attributes of a layer MIME type, as returned by IsLayer.
+type LayerMediaType struct {
+	// Compression is the compression algorithm of the layer contents, or nil if uncompressed.
+	// If Encrypted, this describes the contents after decryption.
+	Compression      *compressiontypes.Algorithm
+	Encrypted        bool // The layer is encrypted using OCI encryption
+	NonDistributable bool // The layer is a non-distributable (“foreign”) layer
+}
+
+// IsImageManifest returns true if mimeType is a known single-image manifest type.
+func IsImageManifest(mimeType string) bool {
+	info, ok := knownMediaTypes[mimeType]
+	return ok && info.kind == mediaTypeKindImageManifest
+}
+
+// IsIndex returns true if mimeType is a known manifest list / image index type.
+func IsIndex(mimeType string) bool {
+	info, ok := knownMediaTypes[mimeType]
+	return ok && info.kind == mediaTypeKindIndex
+}
+
+// IsConfig returns true if mimeType is a known config blob type.
+// Note that OCI artifacts can use arbitrary config types; those are not recognized.
+func IsConfig(mimeType string) bool {
+	info, ok := knownMediaTypes[mimeType]
+	return ok && info.kind == mediaTypeKindConfig
+}
+
+// IsLayer returns the attributes of mimeType and true if it is a known layer type, or LayerMediaType{}, false otherwise.
+func IsLayer(mimeType string) (LayerMediaType, bool) {
+	info, ok := knownMediaTypes[mimeType]
+	if !ok || info.kind != mediaTypeKindLayer {
+		return LayerMediaType{}, false
+	}
+	return info.layer, true
+}
+
+// CompressionFromMediaType returns the compression algorithm of a layer blob with mimeType (nil if uncompressed), and true,
+// or nil, false if mimeType is not a known layer type or the compression of the blob is not known
+// (notably for encrypted layers, which are not recognizable as compressed).
+func CompressionFromMediaType(mimeType string) (*compressiontypes.Algorithm, bool) {
+	layer, ok := IsLayer(mimeType)
+	if !ok || layer.Encrypted {
+		return nil, false
+	}
+	return layer.Compression, true
+}
+
+// EncryptedVariantOf returns the MIME type of an encrypted layer with the contents of a mimeType layer,
+// or an error if mimeType is not a known layer type which can be encrypted.
+func EncryptedVariantOf(mimeType string) (string, error) {
+	layer, ok := IsLayer(mimeType)
+	if !ok {
+		return "", fmt.Errorf("unsupported mediaType to encrypt: %v", mimeType)
+	}
+	if layer.Encrypted {
+		return "", fmt.Errorf("unsupported mediaType: %v already encrypted", mimeType)
+	}
+	res := mimeType + encryptedMediaTypeSuffix
+	if encLayer, ok := IsLayer(res); !ok || !encLayer.Encrypted {
+		return "", fmt.Errorf("unsupported mediaType to encrypt: %v", mimeType)
+	}
+	return res, nil
+}
+
+// DecryptedVariantOf returns the MIME type of a layer with the decrypted contents of a mimeType layer,
+// or an error if mimeType is not a known encrypted layer type.
+func DecryptedVariantOf(mimeType string) (string, error) {
+	layer, ok := IsLayer(mimeType)
+	if !ok || !layer.Encrypted {
+		return "", fmt.Errorf("unsupported mediaType to decrypt: %v", mimeType)
+	}
+	return strings.TrimSuffix(mimeType, encryptedMediaTypeSuffix), nil
+}
@@ -0,0 +1,171 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/containers/image/v5/pkg/compression"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	ociencspec "github.com/containers/ocicrypt/spec"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKnownMediaTypes(t *testing.T) {
+	for mt, info := range knownMediaTypes {
+		if info.kind != mediaTypeKindLayer {
+			assert.Equal(t, LayerMediaType{}, info.layer, mt)
+			continue
+		}
+		if info.layer.Encrypted {
+			decrypted, err := DecryptedVariantOf(mt)
+			require.NoError(t, err, mt)
+			decryptedInfo, ok := knownMediaTypes[decrypted]
+			require.True(t, ok, mt)
+			assert.Equal(t, LayerMediaType{
+				Compression:      info.layer.Compression,
+				NonDistributable: info.layer.NonDistributable,
+			}, decryptedInfo.layer, mt)
+		}
+		// Make sure the compression variant tables agree with knownMediaTypes.
+		for _, variantTable := range [][]compressionMIMETypeSet{oci1CompressionMIMETypeSets, schema2CompressionMIMETypeSets} {
+			if variants := findCompressionMIMETypeSet(variantTable, mt); variants != nil {
+				name := mtsUncompressed
+				if info.layer.Compression != nil {
+					name = info.layer.Compression.InternalUnstableUndocumentedMIMEQuestionMark()
+				}
+				assert.Equal(t, mt, variants[name], mt)
+			}
+		}
+	}
+}
+
+func TestMediaTypeClassification(t *testing.T) {
+	for _, c := range []struct {
+		mt                                  string
+		imageManifest, index, config, layer bool
+	}{
+		{DockerV2Schema1MediaType, true, false, false, false},
+		{DockerV2Schema1SignedMediaType, true, false, false, false},
+		{DockerV2Schema2MediaType, true, false, false, false},
+		{imgspecv1.MediaTypeImageManifest, true, false, false, false},
+		{DockerV2ListMediaType, false, true, false, false},
+		{imgspecv1.MediaTypeImageIndex, false, true, false, false},
+		{DockerV2Schema2ConfigMediaType, false, false, true, false},
+		{imgspecv1.MediaTypeImageConfig, false, false, true, false},
+		{OCI1EmptyJSONMediaType, false, false, true, false},
+		{DockerV2Schema2LayerMediaType, false, false, false, true},
+		{DockerV2Schema2ForeignLayerMediaType, false, false, false, true},
+		{imgspecv1.MediaTypeImageLayerZstd, false, false, false, true},
+		{ociencspec.MediaTypeLayerGzipEnc, false, false, false, true},
+		{"application/vnd.unknown.artifact.config.v1+json", false, false, false, false},
+		{"", false, false, false, false},
+	} {
+		assert.Equal(t, c.imageManifest, IsImageManifest(c.mt), c.mt)
+		assert.Equal(t, c.index, IsIndex(c.mt), c.mt)
+		assert.Equal(t, c.index, MIMETypeIsMultiImage(c.mt), c.mt)
+		assert.Equal(t, c.config, IsConfig(c.mt), c.mt)
+		_, isLayer := IsLayer(c.mt)
+		assert.Equal(t, c.layer, isLayer, c.mt)
+	}
+}
+
+func TestIsLayer(t *testing.T) {
+	for _, c := range []struct {
+		mt       string
+		expected LayerMediaType
+	}{
+		{DockerV2SchemaLayerMediaTypeUncompressed, LayerMediaType{}},
+		{DockerV2Schema2LayerMediaType, LayerMediaType{Compression: &compression.Gzip}},
+		{DockerV2Schema2LayerMediaTypeEncrypted, LayerMediaType{Compression: &compression.Gzip, Encrypted: true}},
+		{DockerV2Schema2ForeignLayerMediaType, LayerMediaType{NonDistributable: true}},
+		{DockerV2Schema2ForeignLayerMediaTypeGzip, LayerMediaType{Compression: &compression.Gzip, NonDistributable: true}},
+		{imgspecv1.MediaTypeImageLayer, LayerMediaType{}},
+		{imgspecv1.MediaTypeImageLayerGzip, LayerMediaType{Compression: &compression.Gzip}},
+		{imgspecv1.MediaTypeImageLayerZstd, LayerMediaType{Compression: &compression.Zstd}},
+		{imgspecv1.MediaTypeImageLayerNonDistributableZstd, LayerMediaType{Compression: &compression.Zstd, NonDistributable: true}},
+		{ociencspec.MediaTypeLayerEnc, LayerMediaType{Encrypted: true}},
+		{ociencspec.MediaTypeLayerNonDistributableGzipEnc, LayerMediaType{Compression: &compression.Gzip, Encrypted: true, NonDistributable: true}},
+	} {
+		res, ok := IsLayer(c.mt)
+		require.True(t, ok, c.mt)
+		assert.Equal(t, c.expected, res, c.mt)
+	}
+	for _, mt := range []string{imgspecv1.MediaTypeImageManifest, DockerV2Schema2ConfigMediaType, "application/vnd.oci.image.layer.v1.tar+unknown"} {
+		res, ok := IsLayer(mt)
+		assert.False(t, ok, mt)
+		assert.Equal(t, LayerMediaType{}, res, mt)
+	}
+}
+
+func TestCompressionFromMediaType(t *testing.T) {
+	for _, c := range []struct {
+		mt         string
+		expected   *compressiontypes.Algorithm
+		recognized bool
+	}{
+		{DockerV2SchemaLayerMediaTypeUncompressed, nil, true},
+		{DockerV2Schema2LayerMediaType, &compression.Gzip, true},
+		{DockerV2Schema2ForeignLayerMediaType, nil, true},
+		{DockerV2Schema2ForeignLayerMediaTypeGzip, &compression.Gzip, true},
+		{imgspecv1.MediaTypeImageLayer, nil, true},
+		{imgspecv1.MediaTypeImageLayerGzip, &compression.Gzip, true},
+		{imgspecv1.MediaTypeImageLayerZstd, &compression.Zstd, true},
+		{imgspecv1.MediaTypeImageLayerNonDistributableGzip, &compression.Gzip, true},
+		// Encrypted layers
+		{DockerV2Schema2LayerMediaTypeEncrypted, nil, false},
+		{ociencspec.MediaTypeLayerEnc, nil, false},
+		{ociencspec.MediaTypeLayerZstdEnc, nil, false},
+		// Not layers
+		{imgspecv1.MediaTypeImageConfig, nil, false},
+		{"this is not a known MIME type", nil, false},
+	} {
+		res, ok := CompressionFromMediaType(c.mt)
+		assert.Equal(t, c.recognized, ok, c.mt)
+		if c.expected == nil {
+			assert.Nil(t, res, c.mt)
+		} else {
+			require.NotNil(t, res, c.mt)
+			assert.Equal(t, c.expected.Name(), res.Name(), c.mt)
+		}
+	}
+}
+
+func TestEncryptedVariantOf(t *testing.T) {
+	for _, c := range []struct{ plain, encrypted string }{
+		{DockerV2Schema2LayerMediaType, DockerV2Schema2LayerMediaTypeEncrypted},
+		{imgspecv1.MediaTypeImageLayer, ociencspec.MediaTypeLayerEnc},
+		{imgspecv1.MediaTypeImageLayerGzip, ociencspec.MediaTypeLayerGzipEnc},
+		{imgspecv1.MediaTypeImageLayerZstd, ociencspec.MediaTypeLayerZstdEnc},
+		{imgspecv1.MediaTypeImageLayerNonDistributable, ociencspec.MediaTypeLayerNonDistributableEnc},
+		{imgspecv1.MediaTypeImageLayerNonDistributableGzip, ociencspec.MediaTypeLayerNonDistributableGzipEnc},
+		{imgspecv1.MediaTypeImageLayerNonDistributableZstd, ociencspec.MediaTypeLayerNonDistributableZsdtEnc},
+	} {
+		res, err := EncryptedVariantOf(c.plain)
+		require.NoError(t, err, c.plain)
+		assert.Equal(t, c.encrypted, res, c.plain)
+
+		res, err = DecryptedVariantOf(c.encrypted)
+		require.NoError(t, err, c.encrypted)
+		assert.Equal(t, c.plain, res, c.encrypted)
+	}
+
+	for _, mt := range []string{
+		DockerV2SchemaLayerMediaTypeUncompressed, // No encrypted variant is defined
+		DockerV2Schema2ForeignLayerMediaTypeGzip, // No encrypted variant is defined
+		ociencspec.MediaTypeLayerGzipEnc,         // Already encrypted
+		imgspecv1.MediaTypeImageConfig,           // Not a layer
+		"application/vnd.oci.image.layer.v1.tar+unknown",
+	} {
+		_, err := EncryptedVariantOf(mt)
+		assert.Error(t, err, mt)
+	}
+	for _, mt := range []string{
+		imgspecv1.MediaTypeImageLayerGzip, // Not encrypted
+		imgspecv1.MediaTypeImageConfig,    // Not a layer
+		"application/vnd.oci.image.layer.v1.tar+unknown+encrypted",
+	} {
+		_, err := DecryptedVariantOf(mt)
+		assert.Error(t, err, mt)
+	}
+}
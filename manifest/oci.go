@@ -3,7 +3,6 @@ package manifest
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/containers/image/v5/internal/manifest"
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
@@ -12,7 +11,6 @@ import (
 	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/specs-go"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"golang.org/x/exp/slices"
 )
 
 // BlobInfoFromOCI1Descriptor returns a types.BlobInfo based on the input OCI1 descriptor.
@@ -30,6 +28,11 @@ func BlobInfoFromOCI1Descriptor(desc imgspecv1.Descriptor) types.BlobInfo {
 // The underlying data from imgspecv1.Manifest is also available.
 type OCI1 struct {
 	imgspecv1.Manifest
+
+	// Fields of the original blob not known to imgspecv1.Manifest (e.g. added in newer versions of the specification),
+	// preserved by Serialize.
+	unknownFields           manifest.UnknownFields
+	unknownDescriptorFields manifest.DescriptorUnknownFields
 }
 
 // SupportedOCI1MediaType checks if the specified string is a supported OCI1
@@ -59,13 +62,41 @@ func OCI1FromManifest(manifestBlob []byte) (*OCI1, error) {
 		manifest.AllowedFieldConfig|manifest.AllowedFieldLayers); err != nil {
 		return nil, err
 	}
+	if err := oci1.parseUnknownFields(manifestBlob); err != nil {
+		return nil, err
+	}
 	return &oci1, nil
 }
 
+// parseUnknownFields records the fields of manifestBlob, and of descriptors in it, which are not known to m,
+// so that Serialize can preserve them.
+func (m *OCI1) parseUnknownFields(manifestBlob []byte) error {
+	unknownFields, err := manifest.ParseUnknownFields(manifestBlob, &m.Manifest)
+	if err != nil {
+		return err
+	}
+	var descriptors struct {
+		Config  json.RawMessage   `json:"config"`
+		Layers  []json.RawMessage `json:"layers"`
+		Subject json.RawMessage   `json:"subject"`
+	}
+	if err := json.Unmarshal(manifestBlob, &descriptors); err != nil {
+		return err
+	}
+	unknownDescriptorFields, err := manifest.ParseDescriptorUnknownFields(
+		append(append([]json.RawMessage{descriptors.Config}, descriptors.Layers...), descriptors.Subject))
+	if err != nil {
+		return err
+	}
+	m.unknownFields = unknownFields
+	m.unknownDescriptorFields = unknownDescriptorFields
+	return nil
+}
+
 // OCI1FromComponents creates an OCI1 manifest instance from the supplied data.
 func OCI1FromComponents(config imgspecv1.Descriptor, layers []imgspecv1.Descriptor) *OCI1 {
 	return &OCI1{
-		imgspecv1.Manifest{
+		Manifest: imgspecv1.Manifest{
 			Versioned: specs.Versioned{SchemaVersion: 2},
 			MediaType: imgspecv1.MediaTypeImageManifest,
 			Config:    config,
@@ -77,7 +108,9 @@ func OCI1FromComponents(config imgspecv1.Descriptor, layers []imgspecv1.Descript
 // OCI1Clone creates a copy of the supplied OCI1 manifest.
 func OCI1Clone(src *OCI1) *OCI1 {
 	return &OCI1{
-		Manifest: src.Manifest,
+		Manifest:                src.Manifest,
+		unknownFields:           src.unknownFields,
+		unknownDescriptorFields: src.unknownDescriptorFields,
 	}
 }
 
@@ -131,7 +164,7 @@ func (m *OCI1) UpdateLayerInfos(layerInfos []types.BlobInfo) error {
 	for i, info := range layerInfos {
 		mimeType := original[i].MediaType
 		if info.CryptoOperation == types.Decrypt {
-			decMimeType, err := getDecryptedMediaType(mimeType)
+			decMimeType, err := DecryptedVariantOf(mimeType)
 			if err != nil {
 				return fmt.Errorf("error preparing updated manifest: decryption specified but original mediatype is not encrypted: %q", mimeType)
 			}
@@ -142,7 +175,7 @@ func (m *OCI1) UpdateLayerInfos(layerInfos []types.BlobInfo) error {
 			return fmt.Errorf("preparing updated manifest, layer %q: %w", info.Digest, err)
 		}
 		if info.CryptoOperation == types.Encrypt {
-			encMediaType, err := getEncryptedMediaType(mimeType)
+			encMediaType, err := EncryptedVariantOf(mimeType)
 			if err != nil {
 				return fmt.Errorf("error preparing updated manifest: encryption specified but no counterpart for mediatype: %q", mimeType)
 			}
@@ -158,35 +191,31 @@ func (m *OCI1) UpdateLayerInfos(layerInfos []types.BlobInfo) error {
 	return nil
 }
 
-// getEncryptedMediaType will return the mediatype to its encrypted counterpart and return
-// an error if the mediatype does not support encryption
-func getEncryptedMediaType(mediatype string) (string, error) {
-	if slices.Contains(strings.Split(mediatype, "+")[1:], "encrypted") {
-		return "", fmt.Errorf("unsupported mediaType: %v already encrypted", mediatype)
-	}
-	unsuffixedMediatype := strings.Split(mediatype, "+")[0]
-	switch unsuffixedMediatype {
-	case DockerV2Schema2LayerMediaType, imgspecv1.MediaTypeImageLayer, imgspecv1.MediaTypeImageLayerNonDistributable:
-		return mediatype + "+encrypted", nil
-	}
-
-	return "", fmt.Errorf("unsupported mediaType to encrypt: %v", mediatype)
-}
-
-// getEncryptedMediaType will return the mediatype to its encrypted counterpart and return
-// an error if the mediatype does not support decryption
-func getDecryptedMediaType(mediatype string) (string, error) {
-	if !strings.HasSuffix(mediatype, "+encrypted") {
-		return "", fmt.Errorf("unsupported mediaType to decrypt: %v", mediatype)
-	}
-
-	return strings.TrimSuffix(mediatype, "+encrypted"), nil
-}
-
 // Serialize returns the manifest in a blob format.
 // NOTE: Serialize() does not in general reproduce the original blob if this object was loaded from one, even if no modifications were made!
+// Fields of the original blob not known to imgspecv1.Manifest are preserved, though (for descriptors, only if the digest is unchanged).
 func (m *OCI1) Serialize() ([]byte, error) {
-	return json.Marshal(*m)
+	if m.unknownFields == nil && m.unknownDescriptorFields == nil {
+		return json.Marshal(*m)
+	}
+	descriptors := m.unknownDescriptorFields.NewMarshaler()
+	config, err := descriptors.Descriptor(m.Config)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := descriptors.Descriptors(m.Layers)
+	if err != nil {
+		return nil, err
+	}
+	replacements := map[string]json.RawMessage{"config": config, "layers": layers}
+	if m.Subject != nil {
+		subject, err := descriptors.Descriptor(*m.Subject)
+		if err != nil {
+			return nil, err
+		}
+		replacements["subject"] = subject
+	}
+	return manifest.MarshalWithUnknownFields(m.Manifest, m.unknownFields, replacements)
 }
 
 // Inspect returns various information for (skopeo inspect) parsed from the manifest and configuration.
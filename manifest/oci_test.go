@@ -69,6 +69,46 @@ func TestOCI1FromManifest(t *testing.T) {
 	testValidManifestWithExtraFieldsIsRejected(t, parser, validManifest, []string{"fsLayers", "history", "manifests"})
 }
 
+func TestOCI1UnknownFields(t *testing.T) {
+	// "artifactType" is not known to the version of imgspecv1.Manifest we use; "futureField" is not known to imgspecv1.Descriptor.
+	original := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7","size":7023,"futureField":"config"},` +
+		`"layers":[` +
+		`{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f","size":32654,"futureField":1},` +
+		`{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f","size":32654,"futureField":2},` +
+		`{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:3c3a4604a545cdc127456d94e421cd355bca5b528f4a9c1905b15da2eb4a4c6b","size":16724,"futureField":{"nested":[3]}}` +
+		`],"artifactType":"application/vnd.example.future+json","futureList":[1,2,3]}`)
+
+	m, err := OCI1FromManifest(original)
+	require.NoError(t, err)
+	serialized, err := m.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, string(original), string(serialized))
+	assert.Equal(t, digest.FromBytes(original), digest.FromBytes(serialized))
+
+	// A clone preserves the fields as well
+	serialized, err = OCI1Clone(m).Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, string(original), string(serialized))
+
+	// Descriptors with a modified digest lose their unknown fields, the others keep them
+	err = m.UpdateLayerInfos([]types.BlobInfo{
+		{Digest: "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f", Size: 32654, MediaType: imgspecv1.MediaTypeImageLayerGzip},
+		{Digest: "sha256:ec4b8955958665577945c89419d1af06b5f7636b4ac3da7f12184802ad867736", Size: 73109, MediaType: imgspecv1.MediaTypeImageLayerGzip},
+		{Digest: "sha256:3c3a4604a545cdc127456d94e421cd355bca5b528f4a9c1905b15da2eb4a4c6b", Size: 16724, MediaType: imgspecv1.MediaTypeImageLayerGzip},
+	})
+	require.NoError(t, err)
+	serialized, err = m.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7","size":7023,"futureField":"config"},`+
+		`"layers":[`+
+		`{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f","size":32654,"futureField":1},`+
+		`{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:ec4b8955958665577945c89419d1af06b5f7636b4ac3da7f12184802ad867736","size":73109},`+
+		`{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:3c3a4604a545cdc127456d94e421cd355bca5b528f4a9c1905b15da2eb4a4c6b","size":16724,"futureField":{"nested":[3]}}`+
+		`],"artifactType":"application/vnd.example.future+json","futureList":[1,2,3]}`, string(serialized))
+}
+
 func TestUpdateLayerInfosOCIGzipToZstd(t *testing.T) {
 	manifest := manifestOCI1FromFixture(t, "ociv1.manifest.json")
 
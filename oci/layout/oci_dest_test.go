@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/containers/image/v5/internal/image"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/pkg/blobinfocache/memory"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
@@ -131,6 +135,120 @@ func TestPutTwoDifferentTags(t *testing.T) {
 	assert.Equal(t, "zomg", index.Manifests[2].Annotations[imgspecv1.AnnotationRefName])
 }
 
+func TestPutSignaturesWithFormat(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	ref, err := NewReference(tmpDir, "signed")
+	require.NoError(t, err)
+	ociRef, ok := ref.(ociReference)
+	require.True(t, ok)
+
+	manifest, err := os.ReadFile("../../internal/image/fixtures/oci1.json")
+	require.NoError(t, err)
+	manifestDigest := digest.FromBytes(manifest)
+	instanceDigest := digest.FromString("instance")
+	simpleSig, err := os.ReadFile("../../signature/fixtures/image.signature")
+	require.NoError(t, err)
+	sigs := []signature.Signature{
+		signature.SimpleSigningFromBlob(simpleSig),
+		signature.SigstoreFromComponents("application/vnd.dev.cosign.simplesigning.v1+json", []byte("payload"),
+			map[string]string{"dev.cosignproject.cosign/signature": "signature"}),
+	}
+
+	dest, err := newImageDestination(nil, ociRef)
+	require.NoError(t, err)
+	defer dest.Close()
+	err = dest.SupportsSignatures(ctx)
+	assert.NoError(t, err)
+	// Signatures can't be written before the manifest digest is known
+	err = dest.PutSignaturesWithFormat(ctx, sigs, nil)
+	assert.Error(t, err)
+	err = dest.PutManifest(ctx, manifest, nil)
+	require.NoError(t, err)
+	err = dest.PutSignaturesWithFormat(ctx, sigs, nil)
+	require.NoError(t, err)
+	err = dest.PutSignaturesWithFormat(ctx, sigs[1:], &instanceDigest)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(tmpDir, "signatures", "sha256", manifestDigest.Encoded(), "signature-2"))
+	assert.NoError(t, err)
+
+	src, err := newImageSource(nil, ociRef)
+	require.NoError(t, err)
+	defer src.Close()
+	res, err := src.GetSignaturesWithFormat(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, sigs, res)
+	res, err = src.GetSignaturesWithFormat(ctx, &manifestDigest)
+	require.NoError(t, err)
+	assert.Equal(t, sigs, res)
+	res, err = src.GetSignaturesWithFormat(ctx, &instanceDigest)
+	require.NoError(t, err)
+	assert.Equal(t, sigs[1:], res)
+	otherDigest := digest.FromString("unsigned")
+	res, err = src.GetSignaturesWithFormat(ctx, &otherDigest)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	// Overwriting signatures removes the old ones
+	dest, err = newImageDestination(nil, ociRef)
+	require.NoError(t, err)
+	defer dest.Close()
+	err = dest.PutSignaturesWithFormat(ctx, sigs[:1], &manifestDigest)
+	require.NoError(t, err)
+	res, err = src.GetSignaturesWithFormat(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, sigs[:1], res)
+}
+
+func TestSignaturesCanonicalOrder(t *testing.T) {
+	ctx := context.Background()
+	ref, _ := refToTempOCI(t)
+	ociRef, ok := ref.(ociReference)
+	require.True(t, ok)
+	manifest, err := os.ReadFile("../../internal/image/fixtures/oci1.json")
+	require.NoError(t, err)
+	dest, err := newImageDestination(nil, ociRef)
+	require.NoError(t, err)
+	defer dest.Close()
+	err = dest.PutManifest(ctx, manifest, nil)
+	require.NoError(t, err)
+
+	sigs := []signature.Signature{}
+	for i := 0; i < 4; i++ {
+		sigs = append(sigs, signature.SigstoreFromComponents(signature.SigstoreSignatureMIMEType, []byte(fmt.Sprintf("payload %d", i)), nil))
+	}
+	canonical, _, err := signature.CanonicalOrder(sigs)
+	require.NoError(t, err)
+	// Write the signatures in the reverse of the canonical order
+	written := []signature.Signature{}
+	for i := len(canonical) - 1; i >= 0; i-- {
+		written = append(written, canonical[i])
+	}
+	err = dest.PutSignaturesWithFormat(ctx, written, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+
+	src, err := newImageSource(nil, ociRef)
+	require.NoError(t, err)
+	defer src.Close()
+	// The transport returns the signatures in the order they were written …
+	res, err := src.GetSignaturesWithFormat(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, written, res)
+	// … but users of UnparsedImage see them in the canonical order.
+	unparsed := image.UnparsedInstance(src, nil)
+	res, err = unparsed.UntrustedSignatures(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, canonical, res)
+	indices, err := unparsed.UntrustedSignatureSourceIndices(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 2, 1, 0}, indices)
+}
+
 func putTestConfig(t *testing.T, ociRef ociReference, tmpDir string) {
 	data, err := os.ReadFile("../../internal/image/fixtures/oci1-config.json")
 	assert.NoError(t, err)
@@ -178,3 +296,78 @@ func putTestManifest(t *testing.T, ociRef ociReference, tmpDir string) {
 	digest := digest.FromBytes(data).Encoded()
 	assert.Contains(t, paths, filepath.Join(tmpDir, "blobs", "sha256", digest), "The OCI directory does not contain the new manifest data")
 }
+
+// caseFoldedPaths walks dir, simulating a case-insensitive filesystem, and fails if any two paths within dir
+// would collide, or if any path component is not lowercase (so that a collision could happen with a path created later).
+// It returns the relative paths of all files.
+func caseFoldedPaths(t *testing.T, dir string) []string {
+	res := []string{}
+	folded := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		require.NoError(t, err)
+		rel, err := filepath.Rel(dir, path)
+		require.NoError(t, err)
+		assert.Equal(t, strings.ToLower(rel), rel)
+		if other, ok := folded[strings.ToLower(rel)]; ok {
+			t.Errorf("%q collides with %q on case-insensitive filesystems", rel, other)
+		}
+		folded[strings.ToLower(rel)] = rel
+		if !d.IsDir() {
+			res = append(res, rel)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	return res
+}
+
+func TestLayoutFileNames(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	// The image name is only recorded in index.json, so it does not affect path lengths.
+	longName := strings.Repeat("very/deep/name/", 300) + "Image:Tag"
+	ref, err := NewReference(tmpDir, longName)
+	require.NoError(t, err)
+	ociRef, ok := ref.(ociReference)
+	require.True(t, ok)
+
+	manifest, err := os.ReadFile("../../internal/image/fixtures/oci1.json")
+	require.NoError(t, err)
+	cache := memory.New()
+	dest, err := newImageDestination(nil, ociRef)
+	require.NoError(t, err)
+	defer dest.Close()
+	for _, blob := range []string{"blob 1", "blob 2", "blob 3"} {
+		_, err := dest.PutBlob(ctx, strings.NewReader(blob), types.BlobInfo{Size: -1}, cache, false)
+		require.NoError(t, err)
+	}
+	// Blobs with digests which differ only by case would collide; only the canonical lowercase digest is accepted.
+	upperDigest := digest.Digest("sha256:" + strings.ToUpper(digest.FromString("blob 1").Encoded()))
+	_, err = dest.PutBlob(ctx, strings.NewReader("blob 1"), types.BlobInfo{Digest: upperDigest, Size: -1}, cache, false)
+	assert.Error(t, err)
+	_, _, err = dest.TryReusingBlob(ctx, types.BlobInfo{Digest: upperDigest, Size: -1}, cache, false)
+	assert.Error(t, err)
+	err = dest.PutManifest(ctx, manifest, nil)
+	require.NoError(t, err)
+	err = dest.PutSignaturesWithFormat(ctx, []signature.Signature{
+		signature.SigstoreFromComponents("application/vnd.dev.cosign.simplesigning.v1+json", []byte("payload"),
+			map[string]string{"dev.cosignproject.cosign/signature": "signature"}),
+	}, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+
+	paths := caseFoldedPaths(t, tmpDir)
+	assert.Len(t, paths, 2+4+1) // oci-layout, index.json; 3 blobs and a manifest; a signature
+	for _, path := range paths {
+		assert.NotContains(t, path, "very")
+	}
+
+	// The image can be read back using the original name
+	src, err := newImageSource(nil, ociRef)
+	require.NoError(t, err)
+	defer src.Close()
+	m, _, err := src.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, manifest, m)
+}
@@ -14,6 +14,8 @@ import (
 	"github.com/containers/image/v5/internal/imagesource/stubs"
 	"github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/rootpath"
+	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/pkg/tlsclientconfig"
 	"github.com/containers/image/v5/types"
 	"github.com/docker/go-connections/tlsconfig"
@@ -35,7 +37,6 @@ func (e ImageNotFoundError) Error() string {
 type ociImageSource struct {
 	impl.Compat
 	impl.PropertyMethodsInitialize
-	impl.NoSignatures
 	impl.DoesNotAffectLayerInfosForCopy
 	stubs.NoGetBlobAtInitialize
 
@@ -125,7 +126,7 @@ func (s *ociImageSource) GetManifest(ctx context.Context, instanceDigest *digest
 		return nil, "", err
 	}
 
-	m, err := os.ReadFile(manifestPath)
+	m, err := rootpath.ReadFile(s.blobRoot(), manifestPath)
 	if err != nil {
 		return nil, "", err
 	}
@@ -136,6 +137,37 @@ func (s *ociImageSource) GetManifest(ctx context.Context, instanceDigest *digest
 	return m, mimeType, nil
 }
 
+// GetSignaturesWithFormat returns the image's signatures.  It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+func (s *ociImageSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error) {
+	manifestDigest := s.descriptor.Digest
+	if instanceDigest != nil {
+		manifestDigest = *instanceDigest
+	}
+	signatures := []signature.Signature{}
+	for i := 0; ; i++ {
+		path, err := s.ref.signaturePath(manifestDigest, i)
+		if err != nil {
+			return nil, err
+		}
+		sigBlob, err := rootpath.ReadFile(s.ref.dir, path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				break
+			}
+			return nil, err
+		}
+		signature, err := signature.FromBlob(sigBlob)
+		if err != nil {
+			return nil, fmt.Errorf("parsing signature %q: %w", path, err)
+		}
+		signatures = append(signatures, signature)
+	}
+	return signatures, nil
+}
+
 // GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
 // The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
 // May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
@@ -154,17 +186,26 @@ func (s *ociImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache
 		return nil, 0, err
 	}
 
-	r, err := os.Open(path)
+	r, err := rootpath.Open(s.blobRoot(), path)
 	if err != nil {
 		return nil, 0, err
 	}
 	fi, err := r.Stat()
 	if err != nil {
+		r.Close()
 		return nil, 0, err
 	}
 	return r, fi.Size(), nil
 }
 
+// blobRoot returns the directory all blobs read by s must be located in.
+func (s *ociImageSource) blobRoot() string {
+	if s.sharedBlobDir != "" {
+		return s.sharedBlobDir
+	}
+	return s.ref.dir
+}
+
 // getExternalBlob returns the reader of the first available blob URL from urls, which must not be empty.
 // This function can return nil reader when no url is supported by this function. In this case, the caller
 // should fallback to fetch the non-external blob (i.e. pull from the registry).
@@ -4,11 +4,13 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -16,6 +18,8 @@ import (
 	"github.com/containers/image/v5/pkg/blobinfocache/memory"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -138,3 +142,124 @@ func createImageSource(t *testing.T, sys *types.SystemContext) types.ImageSource
 	require.NoError(t, err)
 	return imageSource
 }
+
+// writeUntrustedLayout creates an OCI layout in a new directory, with an index.json containing descriptors
+// (which may refer to blobs which don’t exist) and a single manifest blob, which is written to blobDir
+// relative to the layout (normally "blobs/sha256").
+// It returns the path to the layout, and the digest of the manifest blob.
+func writeUntrustedLayout(t *testing.T, blobDir string, descriptors func(manifestDigest digest.Digest) []imgspecv1.Descriptor) (string, digest.Digest) {
+	dir := filepath.Join(t.TempDir(), "layout")
+	manifestBlob := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},"layers":[]}`)
+	manifestDigest := digest.FromBytes(manifestBlob)
+	err := os.Mkdir(dir, 0o755)
+	require.NoError(t, err)
+	err = os.MkdirAll(filepath.Join(dir, blobDir), 0o755)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, blobDir, manifestDigest.Hex()), manifestBlob, 0o644)
+	require.NoError(t, err)
+	index, err := json.Marshal(imgspecv1.Index{
+		Versioned: imgspec.Versioned{SchemaVersion: 2},
+		Manifests: descriptors(manifestDigest),
+	})
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "index.json"), index, 0o644)
+	require.NoError(t, err)
+	return dir, manifestDigest
+}
+
+func TestUntrustedLayoutSymlinkedBlobs(t *testing.T) {
+	descriptors := func(manifestDigest digest.Digest) []imgspecv1.Descriptor {
+		return []imgspecv1.Descriptor{{MediaType: imgspecv1.MediaTypeImageManifest, Digest: manifestDigest, Size: -1}}
+	}
+
+	// A layout with a blobs directory which is a symbolic link to a location outside of the layout
+	dir, manifestDigest := writeUntrustedLayout(t, "../outside/sha256", descriptors)
+	err := os.Symlink("../outside", filepath.Join(dir, "blobs"))
+	require.NoError(t, err)
+	ref, err := NewReference(dir, "")
+	require.NoError(t, err)
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	_, _, err = src.GetManifest(context.Background(), nil)
+	assert.Error(t, err)
+	_, _, err = src.GetBlob(context.Background(), types.BlobInfo{Digest: manifestDigest, Size: -1}, memory.New())
+	assert.Error(t, err)
+
+	// A symbolic link to a blob outside of the layout
+	dir, manifestDigest = writeUntrustedLayout(t, "../outside/sha256", descriptors)
+	err = os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0o755)
+	require.NoError(t, err)
+	err = os.Symlink(filepath.Join(dir, "..", "outside", "sha256", manifestDigest.Hex()), filepath.Join(dir, "blobs", "sha256", manifestDigest.Hex()))
+	require.NoError(t, err)
+	ref, err = NewReference(dir, "")
+	require.NoError(t, err)
+	src, err = ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	_, _, err = src.GetManifest(context.Background(), nil)
+	assert.Error(t, err)
+
+	// Symbolic links within the layout are accepted
+	dir, manifestDigest = writeUntrustedLayout(t, "real-blobs/sha256", descriptors)
+	err = os.Symlink("real-blobs", filepath.Join(dir, "blobs"))
+	require.NoError(t, err)
+	ref, err = NewReference(dir, "")
+	require.NoError(t, err)
+	src, err = ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	m, _, err := src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, manifestDigest, digest.FromBytes(m))
+}
+
+func TestUntrustedLayoutInvalidDigests(t *testing.T) {
+	for _, d := range []digest.Digest{
+		"sha256:../../../../etc/passwd",
+		"sha256:../sha256/44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+		"../../etc:passwd",
+		"sha256:/etc/passwd",
+	} {
+		dir, _ := writeUntrustedLayout(t, "blobs/sha256", func(digest.Digest) []imgspecv1.Descriptor {
+			return []imgspecv1.Descriptor{{MediaType: imgspecv1.MediaTypeImageManifest, Digest: d, Size: -1}}
+		})
+		ref, err := NewReference(dir, "")
+		require.NoError(t, err)
+		src, err := ref.NewImageSource(context.Background(), nil)
+		require.NoError(t, err)
+		defer src.Close()
+		_, _, err = src.GetManifest(context.Background(), nil)
+		assert.Error(t, err, d)
+		_, _, err = src.GetBlob(context.Background(), types.BlobInfo{Digest: d, Size: -1}, memory.New())
+		assert.Error(t, err, d)
+	}
+}
+
+func TestUntrustedLayoutRefNames(t *testing.T) {
+	for _, refName := range []string{
+		"../../../etc/passwd",
+		"/etc/passwd",
+	} {
+		dir, manifestDigest := writeUntrustedLayout(t, "blobs/sha256", func(manifestDigest digest.Digest) []imgspecv1.Descriptor {
+			return []imgspecv1.Descriptor{{
+				MediaType:   imgspecv1.MediaTypeImageManifest,
+				Digest:      manifestDigest,
+				Size:        -1,
+				Annotations: map[string]string{imgspecv1.AnnotationRefName: refName},
+			}}
+		})
+		// Such names can’t be selected…
+		_, err := NewReference(dir, refName)
+		assert.Error(t, err, refName)
+		// … and if the image is selected otherwise, the name is not used to access any files.
+		ref, err := NewReference(dir, "")
+		require.NoError(t, err)
+		src, err := ref.NewImageSource(context.Background(), nil)
+		require.NoError(t, err)
+		defer src.Close()
+		m, _, err := src.GetManifest(context.Background(), nil)
+		require.NoError(t, err, refName)
+		assert.Equal(t, manifestDigest, digest.FromBytes(m))
+	}
+}
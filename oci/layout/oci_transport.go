@@ -5,13 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/containers/image/v5/directory/explicitfilepath"
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/rootpath"
 	"github.com/containers/image/v5/oci/internal"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
@@ -160,7 +160,7 @@ func (ref ociReference) NewImage(ctx context.Context, sys *types.SystemContext)
 // getIndex returns a pointer to the index references by this ociReference. If an error occurs opening an index nil is returned together
 // with an error.
 func (ref ociReference) getIndex() (*imgspecv1.Index, error) {
-	indexJSON, err := os.Open(ref.indexPath())
+	indexJSON, err := rootpath.Open(ref.dir, ref.indexPath())
 	if err != nil {
 		return nil, err
 	}
@@ -248,3 +248,13 @@ func (ref ociReference) blobPath(digest digest.Digest, sharedBlobDir string) (st
 	}
 	return filepath.Join(blobDir, digest.Algorithm().String(), digest.Hex()), nil
 }
+
+// signaturePath returns a path for a signature of the manifest with manifestDigest within a directory,
+// using our conventions (the OCI image-layout specification does not define a location for signatures).
+func (ref ociReference) signaturePath(manifestDigest digest.Digest, index int) (string, error) {
+	if err := manifestDigest.Validate(); err != nil {
+		return "", fmt.Errorf("unexpected digest reference %s: %w", manifestDigest, err)
+	}
+	return filepath.Join(ref.dir, "signatures", manifestDigest.Algorithm().String(), manifestDigest.Hex(),
+		fmt.Sprintf("signature-%d", index+1)), nil
+}
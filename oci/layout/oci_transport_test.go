@@ -4,10 +4,12 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	_ "github.com/containers/image/v5/internal/testing/explicitfilepath-tmpdir"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -294,4 +296,9 @@ func TestReferenceBlobPathInvalid(t *testing.T) {
 	require.True(t, ok)
 	_, err := ociRef.blobPath(hex, "")
 	assert.ErrorContains(t, err, "unexpected digest reference "+hex)
+	// Blob file names must be lowercase, so that they can't collide on case-insensitive filesystems.
+	_, err = ociRef.blobPath(digest.Digest("sha256:"+strings.ToUpper(hex)), "")
+	assert.Error(t, err)
+	_, err = ociRef.signaturePath(digest.Digest("sha256:"+strings.ToUpper(hex)), 0)
+	assert.Error(t, err)
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 	bolt "go.etcd.io/bbolt"
+	"golang.org/x/exp/slices"
 )
 
 var (
@@ -391,3 +392,55 @@ func (bdc *cache) candidateLocations(transport types.ImageTransport, scope types
 func (bdc *cache) CandidateLocations(transport types.ImageTransport, scope types.BICTransportScope, primaryDigest digest.Digest, canSubstitute bool) []types.BICReplacementCandidate {
 	return blobinfocache.CandidateLocationsFromV2(bdc.candidateLocations(transport, scope, primaryDigest, canSubstitute, false))
 }
+
+// CompressionVariants returns the known variants of the blob with the uncompressed digest uncompressedDigest,
+// i.e. the blobs recorded using RecordDigestUncompressedPair for which a compressor was recorded using RecordDigestCompressorName,
+// sorted by digest. uncompressedDigest itself is included if it was recorded to be Uncompressed.
+//
+// Caches written by versions which did not record compressors contain no compressor data, so they return no variants
+// until the blobs are copied again.
+func (bdc *cache) CompressionVariants(uncompressedDigest digest.Digest) []blobinfocache.BICCompressionVariant {
+	res := []blobinfocache.BICCompressionVariant{}
+	if err := bdc.view(func(tx *bolt.Tx) error {
+		// compressionBucket won't have been created if previous writers never recorded info about compression,
+		// and we don't want to fail just because of that
+		compressionBucket := tx.Bucket(digestCompressorBucket)
+		if compressionBucket == nil {
+			return nil
+		}
+		uncompressedBucket := tx.Bucket(uncompressedDigestBucket)
+		digests := []digest.Digest{uncompressedDigest}
+		if b := tx.Bucket(digestByUncompressedBucket); b != nil {
+			if b = b.Bucket([]byte(uncompressedDigest.String())); b != nil {
+				if err := b.ForEach(func(k, _ []byte) error {
+					d, err := digest.Parse(string(k))
+					if err != nil {
+						return err
+					}
+					if d != uncompressedDigest {
+						digests = append(digests, d)
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		for _, d := range digests {
+			key := []byte(d.String())
+			if d != uncompressedDigest &&
+				(uncompressedBucket == nil || string(uncompressedBucket.Get(key)) != uncompressedDigest.String()) {
+				continue // A stale entry, the uncompressed digest was later recorded differently.
+			}
+			if compressorName := compressionBucket.Get(key); len(compressorName) > 0 &&
+				(d != uncompressedDigest || string(compressorName) == blobinfocache.Uncompressed) {
+				res = append(res, blobinfocache.BICCompressionVariant{Digest: d, CompressorName: string(compressorName)})
+			}
+		}
+		return nil
+	}); err != nil { // Including os.IsNotExist(err)
+		return []blobinfocache.BICCompressionVariant{} // FIXME? Log err (but throttle the log volume on repeated accesses)?
+	}
+	slices.SortFunc(res, func(a, b blobinfocache.BICCompressionVariant) bool { return a.Digest < b.Digest })
+	return res
+}
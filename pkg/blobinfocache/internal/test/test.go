@@ -35,6 +35,7 @@ func GenericCache(t *testing.T, newTestCache func(t *testing.T) blobinfocache.Bl
 		{"RecordKnownLocations", testGenericRecordKnownLocations},
 		{"CandidateLocations", testGenericCandidateLocations},
 		{"CandidateLocations2", testGenericCandidateLocations2},
+		{"CompressionVariants", testGenericCompressionVariants},
 	} {
 		t.Run(s.name, func(t *testing.T) {
 			cache := newTestCache(t)
@@ -350,3 +351,53 @@ func testGenericCandidateLocations2(t *testing.T, cache blobinfocache.BlobInfoCa
 		}, cache.CandidateLocations2(transport, scope, digestCompressedUnrelated, true))
 	}
 }
+
+func testGenericCompressionVariants(t *testing.T, cache blobinfocache.BlobInfoCache2) {
+	// Nothing is known.
+	assert.Equal(t, []blobinfocache.BICCompressionVariant{}, cache.CompressionVariants(digestUnknown))
+	assert.Equal(t, []blobinfocache.BICCompressionVariant{}, cache.CompressionVariants(digestUncompressed))
+
+	// Digest pairs without compressors are not returned.
+	cache.RecordDigestUncompressedPair(digestCompressedB, digestUncompressed)
+	cache.RecordDigestUncompressedPair(digestCompressedA, digestUncompressed)
+	assert.Equal(t, []blobinfocache.BICCompressionVariant{}, cache.CompressionVariants(digestUncompressed))
+
+	cache.RecordDigestCompressorName(digestCompressedB, compressorNameB)
+	assert.Equal(t, []blobinfocache.BICCompressionVariant{
+		{Digest: digestCompressedB, CompressorName: compressorNameB},
+	}, cache.CompressionVariants(digestUncompressed))
+
+	// The uncompressed digest is included if it is known to be uncompressed, whether or not a trivial pair was recorded;
+	// the results are sorted by digest.
+	cache.RecordDigestCompressorName(digestCompressedA, compressorNameA)
+	cache.RecordDigestCompressorName(digestUncompressed, blobinfocache.Uncompressed)
+	expected := []blobinfocache.BICCompressionVariant{
+		{Digest: digestUncompressed, CompressorName: blobinfocache.Uncompressed},
+		{Digest: digestCompressedA, CompressorName: compressorNameA},
+		{Digest: digestCompressedB, CompressorName: compressorNameB},
+	}
+	assert.Equal(t, expected, cache.CompressionVariants(digestUncompressed))
+	cache.RecordDigestUncompressedPair(digestUncompressed, digestUncompressed)
+	assert.Equal(t, expected, cache.CompressionVariants(digestUncompressed))
+	// Only uncompressed digests have variants.
+	assert.Equal(t, []blobinfocache.BICCompressionVariant{}, cache.CompressionVariants(digestCompressedA))
+
+	// Forgetting the compressor removes the variant.
+	cache.RecordDigestCompressorName(digestCompressedA, blobinfocache.UnknownCompression)
+	assert.Equal(t, []blobinfocache.BICCompressionVariant{
+		{Digest: digestUncompressed, CompressorName: blobinfocache.Uncompressed},
+		{Digest: digestCompressedB, CompressorName: compressorNameB},
+	}, cache.CompressionVariants(digestUncompressed))
+
+	// A digest whose uncompressed digest is later recorded differently is no longer a variant.
+	cache.RecordDigestUncompressedPair(digestCompressedUnrelated, digestUncompressed)
+	cache.RecordDigestCompressorName(digestCompressedUnrelated, compressorNameCU)
+	cache.RecordDigestUncompressedPair(digestCompressedUnrelated, digestUnknown)
+	assert.Equal(t, []blobinfocache.BICCompressionVariant{
+		{Digest: digestUncompressed, CompressorName: blobinfocache.Uncompressed},
+		{Digest: digestCompressedB, CompressorName: compressorNameB},
+	}, cache.CompressionVariants(digestUncompressed))
+	assert.Equal(t, []blobinfocache.BICCompressionVariant{
+		{Digest: digestCompressedUnrelated, CompressorName: compressorNameCU},
+	}, cache.CompressionVariants(digestUnknown))
+}
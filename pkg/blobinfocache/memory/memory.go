@@ -2,6 +2,8 @@
 package memory
 
 import (
+	"container/list"
+	"fmt"
 	"sync"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
 )
 
 // locationKey only exists to make lookup in knownLocations easier.
@@ -20,6 +23,22 @@ type locationKey struct {
 	blobDigest digest.Digest
 }
 
+// entryKind identifies the map an entryKey refers to.
+type entryKind int
+
+const (
+	uncompressedDigestEntry entryKind = iota // An entry in cache.uncompressedDigests, and the corresponding cache.digestsByUncompressed member
+	knownLocationsEntry                      // An entry in cache.knownLocations
+	compressorEntry                          // An entry in cache.compressors
+)
+
+// entryKey identifies a cache entry tracked for least-recently-used eviction.
+type entryKey struct {
+	kind     entryKind
+	digest   digest.Digest // For uncompressedDigestEntry and compressorEntry
+	location locationKey   // For knownLocationsEntry
+}
+
 // cache implements an in-memory-only BlobInfoCache.
 type cache struct {
 	mutex sync.Mutex
@@ -28,6 +47,10 @@ type cache struct {
 	digestsByUncompressed map[digest.Digest]*set.Set[digest.Digest]                // stores a set of digests for each uncompressed digest
 	knownLocations        map[locationKey]map[types.BICLocationReference]time.Time // stores last known existence time for each location reference
 	compressors           map[digest.Digest]string                                 // stores a compressor name, or blobinfocache.Unknown, for each digest
+
+	maxEntries  int                        // The maximum number of entries, or 0 if unlimited
+	lru         *list.List                 // entryKey values, the most recently used first; nil if maxEntries == 0
+	lruElements map[entryKey]*list.Element // Elements of lru, by key
 }
 
 // New returns a BlobInfoCache implementation which is in-memory only.
@@ -42,6 +65,23 @@ func New() types.BlobInfoCache {
 	return new2()
 }
 
+// NewWithMaxEntries returns a BlobInfoCache implementation which is in-memory only, like New,
+// but which holds at most maxEntries entries, evicting the least recently used ones when more are recorded.
+// Every recorded uncompressed digest, compressor name, and (transport, scope, digest) combination
+// of known locations counts as a separate entry. maxEntries == 0 means no limit, like New.
+func NewWithMaxEntries(maxEntries int) (types.BlobInfoCache, error) {
+	if maxEntries < 0 {
+		return nil, fmt.Errorf("invalid maximum number of cache entries %d", maxEntries)
+	}
+	res := new2()
+	if maxEntries != 0 {
+		res.maxEntries = maxEntries
+		res.lru = list.New()
+		res.lruElements = map[entryKey]*list.Element{}
+	}
+	return res, nil
+}
+
 func new2() *cache {
 	return &cache{
 		uncompressedDigests:   map[digest.Digest]digest.Digest{},
@@ -51,6 +91,68 @@ func new2() *cache {
 	}
 }
 
+// recordedLocked records that the entry key has been added or updated, evicting the least recently used entries if necessary.
+// It must be called only with mem.mutex held.
+func (mem *cache) recordedLocked(key entryKey) {
+	if mem.lru == nil {
+		return
+	}
+	if element, ok := mem.lruElements[key]; ok {
+		mem.lru.MoveToFront(element)
+		return
+	}
+	mem.lruElements[key] = mem.lru.PushFront(key)
+	for mem.lru.Len() > mem.maxEntries {
+		oldest := mem.lru.Back()
+		mem.evictLocked(oldest.Value.(entryKey))
+	}
+}
+
+// usedLocked records that the entry key, if it exists, has been used.
+// It must be called only with mem.mutex held.
+func (mem *cache) usedLocked(key entryKey) {
+	if mem.lru == nil {
+		return
+	}
+	if element, ok := mem.lruElements[key]; ok {
+		mem.lru.MoveToFront(element)
+	}
+}
+
+// forgetLocked stops tracking the entry key, which has been removed by the caller.
+// It must be called only with mem.mutex held.
+func (mem *cache) forgetLocked(key entryKey) {
+	if mem.lru == nil {
+		return
+	}
+	if element, ok := mem.lruElements[key]; ok {
+		mem.lru.Remove(element)
+		delete(mem.lruElements, key)
+	}
+}
+
+// evictLocked removes the entry key from the cache.
+// It must be called only with mem.mutex held.
+func (mem *cache) evictLocked(key entryKey) {
+	switch key.kind {
+	case uncompressedDigestEntry:
+		// Keep digestsByUncompressed consistent, so that it does not refer to evicted digests.
+		uncompressed := mem.uncompressedDigests[key.digest]
+		delete(mem.uncompressedDigests, key.digest)
+		if s, ok := mem.digestsByUncompressed[uncompressed]; ok {
+			s.Delete(key.digest)
+			if s.Empty() {
+				delete(mem.digestsByUncompressed, uncompressed)
+			}
+		}
+	case knownLocationsEntry:
+		delete(mem.knownLocations, key.location)
+	case compressorEntry:
+		delete(mem.compressors, key.digest)
+	}
+	mem.forgetLocked(key)
+}
+
 // UncompressedDigest returns an uncompressed digest corresponding to anyDigest.
 // May return anyDigest if it is known to be uncompressed.
 // Returns "" if nothing is known about the digest (it may be compressed or uncompressed).
@@ -63,6 +165,7 @@ func (mem *cache) UncompressedDigest(anyDigest digest.Digest) digest.Digest {
 // uncompressedDigestLocked implements types.BlobInfoCache.UncompressedDigest, but must be called only with mem.mutex held.
 func (mem *cache) uncompressedDigestLocked(anyDigest digest.Digest) digest.Digest {
 	if d, ok := mem.uncompressedDigests[anyDigest]; ok {
+		mem.usedLocked(entryKey{kind: uncompressedDigestEntry, digest: anyDigest})
 		return d
 	}
 	// Presence in digestsByUncompressed implies that anyDigest must already refer to an uncompressed digest.
@@ -93,6 +196,7 @@ func (mem *cache) RecordDigestUncompressedPair(anyDigest digest.Digest, uncompre
 		mem.digestsByUncompressed[uncompressed] = anyDigestSet
 	}
 	anyDigestSet.Add(anyDigest)
+	mem.recordedLocked(entryKey{kind: uncompressedDigestEntry, digest: anyDigest})
 }
 
 // RecordKnownLocation records that a blob with the specified digest exists within the specified (transport, scope) scope,
@@ -107,6 +211,7 @@ func (mem *cache) RecordKnownLocation(transport types.ImageTransport, scope type
 		mem.knownLocations[key] = locationScope
 	}
 	locationScope[location] = time.Now() // Possibly overwriting an older entry.
+	mem.recordedLocked(entryKey{kind: knownLocationsEntry, location: key})
 }
 
 // RecordDigestCompressorName records that the blob with the specified digest is either compressed with the specified
@@ -116,14 +221,21 @@ func (mem *cache) RecordDigestCompressorName(blobDigest digest.Digest, compresso
 	defer mem.mutex.Unlock()
 	if compressorName == blobinfocache.UnknownCompression {
 		delete(mem.compressors, blobDigest)
+		mem.forgetLocked(entryKey{kind: compressorEntry, digest: blobDigest})
 		return
 	}
 	mem.compressors[blobDigest] = compressorName
+	mem.recordedLocked(entryKey{kind: compressorEntry, digest: blobDigest})
 }
 
 // appendReplacementCandidates creates prioritize.CandidateWithTime values for (transport, scope, digest), and returns the result of appending them to candidates.
 func (mem *cache) appendReplacementCandidates(candidates []prioritize.CandidateWithTime, transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest, requireCompressionInfo bool) []prioritize.CandidateWithTime {
-	locations := mem.knownLocations[locationKey{transport: transport.Name(), scope: scope, blobDigest: digest}] // nil if not present
+	key := locationKey{transport: transport.Name(), scope: scope, blobDigest: digest}
+	locations := mem.knownLocations[key] // nil if not present
+	if len(locations) != 0 {
+		mem.usedLocked(entryKey{kind: knownLocationsEntry, location: key})
+		mem.usedLocked(entryKey{kind: compressorEntry, digest: digest})
+	}
 	for l, t := range locations {
 		compressorName, compressorKnown := mem.compressors[digest]
 		if !compressorKnown {
@@ -186,3 +298,28 @@ func (mem *cache) candidateLocations(transport types.ImageTransport, scope types
 	}
 	return prioritize.DestructivelyPrioritizeReplacementCandidates(res, primaryDigest, uncompressedDigest)
 }
+
+// CompressionVariants returns the known variants of the blob with the uncompressed digest uncompressedDigest,
+// i.e. the blobs recorded using RecordDigestUncompressedPair for which a compressor was recorded using RecordDigestCompressorName,
+// sorted by digest. uncompressedDigest itself is included if it was recorded to be Uncompressed.
+func (mem *cache) CompressionVariants(uncompressedDigest digest.Digest) []blobinfocache.BICCompressionVariant {
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	digests := set.NewWithValues(uncompressedDigest)
+	if s, ok := mem.digestsByUncompressed[uncompressedDigest]; ok {
+		for _, d := range s.Values() {
+			digests.Add(d)
+		}
+	}
+	res := []blobinfocache.BICCompressionVariant{}
+	for _, d := range digests.Values() {
+		if d != uncompressedDigest && mem.uncompressedDigests[d] != uncompressedDigest {
+			continue // A stale entry, the uncompressed digest was later recorded differently.
+		}
+		if compressorName, ok := mem.compressors[d]; ok && (d != uncompressedDigest || compressorName == blobinfocache.Uncompressed) {
+			res = append(res, blobinfocache.BICCompressionVariant{Digest: d, CompressorName: compressorName})
+		}
+	}
+	slices.SortFunc(res, func(a, b blobinfocache.BICCompressionVariant) bool { return a.Digest < b.Digest })
+	return res
+}
@@ -1,10 +1,16 @@
 package memory
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/internal/testing/mocks"
 	"github.com/containers/image/v5/pkg/blobinfocache/internal/test"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var _ blobinfocache.BlobInfoCache2 = &cache{}
@@ -13,6 +19,96 @@ func newTestCache(t *testing.T) blobinfocache.BlobInfoCache2 {
 	return new2()
 }
 
+func newTestCacheWithMaxEntries(t *testing.T, maxEntries int) *cache {
+	c, err := NewWithMaxEntries(maxEntries)
+	require.NoError(t, err)
+	return c.(*cache)
+}
+
 func TestNew(t *testing.T) {
 	test.GenericCache(t, newTestCache)
 }
+
+func TestNewWithMaxEntries(t *testing.T) {
+	// A cap large enough not to evict anything in the generic tests
+	test.GenericCache(t, func(t *testing.T) blobinfocache.BlobInfoCache2 {
+		return newTestCacheWithMaxEntries(t, 1000)
+	})
+	// No limit
+	test.GenericCache(t, func(t *testing.T) blobinfocache.BlobInfoCache2 {
+		return newTestCacheWithMaxEntries(t, 0)
+	})
+
+	_, err := NewWithMaxEntries(-1)
+	assert.Error(t, err)
+}
+
+// testDigest returns a distinct digest for i and kind.
+func testDigest(kind string, i int) digest.Digest {
+	return digest.FromString(fmt.Sprintf("%s %d", kind, i))
+}
+
+func TestMaxEntriesEviction(t *testing.T) {
+	const maxEntries = 30
+	transport := mocks.NameImageTransport("==BlobInfocache transport mock")
+	scope := types.BICTransportScope{Opaque: "registry.example.com"}
+	location := types.BICLocationReference{Opaque: "somewhere"}
+
+	// Uncompressed digests
+	cache := newTestCacheWithMaxEntries(t, maxEntries)
+	for i := 0; i < maxEntries+10; i++ {
+		cache.RecordDigestUncompressedPair(testDigest("compressed", i), testDigest("uncompressed", i))
+	}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, digest.Digest(""), cache.UncompressedDigest(testDigest("compressed", i)), i)
+		// The reverse mapping was evicted as well
+		assert.Equal(t, digest.Digest(""), cache.UncompressedDigest(testDigest("uncompressed", i)), i)
+	}
+	for i := 10; i < maxEntries+10; i++ {
+		assert.Equal(t, testDigest("uncompressed", i), cache.UncompressedDigest(testDigest("compressed", i)), i)
+		assert.Equal(t, testDigest("uncompressed", i), cache.UncompressedDigest(testDigest("uncompressed", i)), i)
+	}
+	assert.Len(t, cache.uncompressedDigests, maxEntries)
+	assert.Len(t, cache.digestsByUncompressed, maxEntries)
+
+	// Known locations
+	cache = newTestCacheWithMaxEntries(t, maxEntries)
+	for i := 0; i < maxEntries+10; i++ {
+		cache.RecordKnownLocation(transport, scope, testDigest("blob", i), location)
+	}
+	for i := 0; i < 10; i++ {
+		assert.Empty(t, cache.CandidateLocations(transport, scope, testDigest("blob", i), false), i)
+	}
+	for i := 10; i < maxEntries+10; i++ {
+		assert.Equal(t, []types.BICReplacementCandidate{{Digest: testDigest("blob", i), Location: location}},
+			cache.CandidateLocations(transport, scope, testDigest("blob", i), false), i)
+	}
+	assert.Len(t, cache.knownLocations, maxEntries)
+
+	// Lookups count as use
+	cache = newTestCacheWithMaxEntries(t, maxEntries)
+	for i := 0; i < maxEntries; i++ {
+		cache.RecordDigestUncompressedPair(testDigest("compressed", i), testDigest("uncompressed", i))
+	}
+	assert.Equal(t, testDigest("uncompressed", 0), cache.UncompressedDigest(testDigest("compressed", 0)))
+	cache.RecordDigestUncompressedPair(testDigest("compressed", maxEntries), testDigest("uncompressed", maxEntries))
+	assert.Equal(t, testDigest("uncompressed", 0), cache.UncompressedDigest(testDigest("compressed", 0)))
+	assert.Equal(t, digest.Digest(""), cache.UncompressedDigest(testDigest("compressed", 1)))
+
+	// Evicting one of several compressed variants keeps the others
+	cache = newTestCacheWithMaxEntries(t, 2)
+	cache.RecordDigestUncompressedPair(testDigest("compressed", 0), testDigest("uncompressed", 0))
+	cache.RecordDigestUncompressedPair(testDigest("compressed", 1), testDigest("uncompressed", 0))
+	cache.RecordDigestCompressorName(testDigest("compressed", 1), "gzip")
+	assert.Equal(t, digest.Digest(""), cache.UncompressedDigest(testDigest("compressed", 0)))
+	assert.Equal(t, testDigest("uncompressed", 0), cache.UncompressedDigest(testDigest("compressed", 1)))
+	assert.Equal(t, testDigest("uncompressed", 0), cache.UncompressedDigest(testDigest("uncompressed", 0)))
+	assert.Equal(t, []blobinfocache.BICCompressionVariant{{Digest: testDigest("compressed", 1), CompressorName: "gzip"}},
+		cache.CompressionVariants(testDigest("uncompressed", 0)))
+	// Forgetting a compressor name frees its entry
+	cache.RecordDigestCompressorName(testDigest("compressed", 1), blobinfocache.UnknownCompression)
+	cache.RecordKnownLocation(transport, scope, testDigest("compressed", 1), location)
+	assert.Equal(t, testDigest("uncompressed", 0), cache.UncompressedDigest(testDigest("compressed", 1)))
+	assert.Equal(t, 2, cache.lru.Len())
+	assert.Len(t, cache.lruElements, 2)
+}
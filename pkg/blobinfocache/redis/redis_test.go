@@ -0,0 +1,93 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/internal/testing/mocks"
+	"github.com/containers/image/v5/pkg/blobinfocache/internal/test"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ blobinfocache.BlobInfoCache2 = &Cache{}
+
+func newTestCacheWithServer(t *testing.T, ttl time.Duration) (*miniredis.Miniredis, *Cache) {
+	server := miniredis.RunT(t)
+	cache, err := New("redis://"+server.Addr()+"/0", ttl)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		err := cache.Close()
+		assert.NoError(t, err)
+	})
+	return server, cache
+}
+
+func newTestCache(t *testing.T) blobinfocache.BlobInfoCache2 {
+	_, cache := newTestCacheWithServer(t, 0)
+	return cache
+}
+
+func TestNew(t *testing.T) {
+	test.GenericCache(t, newTestCache)
+
+	// Invalid parameters
+	for _, dsn := range []string{"", "http://localhost:6379", "redis://localhost:6379/notanumber"} {
+		_, err := New(dsn, 0)
+		assert.Error(t, err, dsn)
+	}
+	_, err := New("redis://localhost:6379/0", -time.Second)
+	assert.Error(t, err)
+}
+
+func TestTTL(t *testing.T) {
+	const (
+		digestCompressed   = digest.Digest("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+		digestUncompressed = digest.Digest("sha256:2222222222222222222222222222222222222222222222222222222222222222")
+	)
+	transport := mocks.NameImageTransport("==BlobInfocache transport mock")
+	scope := types.BICTransportScope{Opaque: "registry.example.com:5000"}
+	location := types.BICLocationReference{Opaque: "somewhere"}
+
+	server, cache := newTestCacheWithServer(t, time.Hour)
+	cache.RecordDigestUncompressedPair(digestCompressed, digestUncompressed)
+	cache.RecordDigestCompressorName(digestCompressed, "gzip")
+	cache.RecordKnownLocation(transport, scope, digestCompressed, location)
+	for _, key := range server.Keys() {
+		assert.Equal(t, time.Hour, server.TTL(key), key)
+	}
+	expected := []blobinfocache.BICReplacementCandidate2{{Digest: digestCompressed, CompressorName: "gzip", Location: location}}
+	assert.Equal(t, expected, cache.CandidateLocations2(transport, scope, digestCompressed, false))
+
+	// Writes refresh the TTL
+	server.FastForward(45 * time.Minute)
+	cache.RecordKnownLocation(transport, scope, digestCompressed, location)
+	server.FastForward(45 * time.Minute)
+	assert.Equal(t, []blobinfocache.BICReplacementCandidate2{}, cache.CandidateLocations2(transport, scope, digestCompressed, false))
+	assert.Equal(t, []types.BICReplacementCandidate{{Digest: digestCompressed, Location: location}},
+		cache.CandidateLocations(transport, scope, digestCompressed, false))
+	assert.Equal(t, digest.Digest(""), cache.UncompressedDigest(digestCompressed))
+
+	server.FastForward(time.Hour)
+	assert.Empty(t, server.Keys())
+	assert.Empty(t, cache.CandidateLocations(transport, scope, digestCompressed, false))
+}
+
+func TestUnavailableServer(t *testing.T) {
+	const digestCompressed = digest.Digest("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+	transport := mocks.NameImageTransport("==BlobInfocache transport mock")
+	scope := types.BICTransportScope{Opaque: "registry.example.com"}
+
+	server, cache := newTestCacheWithServer(t, 0)
+	server.Close()
+	// Nothing fails, the cache just appears to be empty.
+	cache.RecordDigestUncompressedPair(digestCompressed, digestCompressed)
+	cache.RecordDigestCompressorName(digestCompressed, blobinfocache.Uncompressed)
+	cache.RecordKnownLocation(transport, scope, digestCompressed, types.BICLocationReference{Opaque: "somewhere"})
+	assert.Equal(t, digest.Digest(""), cache.UncompressedDigest(digestCompressed))
+	assert.Empty(t, cache.CandidateLocations2(transport, scope, digestCompressed, true))
+}
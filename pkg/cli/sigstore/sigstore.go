@@ -50,11 +50,13 @@ func newSignerFromParameterData(params *params.SigningParameterFile, options *Op
 		default: // This shouldn’t happen, the caller is expected to set options.PrivateKeyPassphrasePrompt
 			return nil, fmt.Errorf("private key %s specified, but no way to get a passphrase", params.PrivateKeyFile)
 		}
-		passphrase, err := getPassphrase(params.PrivateKeyFile)
-		if err != nil {
-			return nil, err
-		}
-		opts = append(opts, sigstore.WithPrivateKeyFile(params.PrivateKeyFile, []byte(passphrase)))
+		opts = append(opts, sigstore.WithPrivateKeyFilePassphraseCallback(params.PrivateKeyFile, func() ([]byte, error) {
+			passphrase, err := getPassphrase(params.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			return []byte(passphrase), nil
+		}))
 	}
 
 	if params.Fulcio != nil {
@@ -5,6 +5,7 @@ import (
 	"compress/bzip2"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/containers/image/v5/pkg/compression/internal"
 	"github.com/containers/image/v5/pkg/compression/types"
@@ -77,10 +78,66 @@ func XzDecompressor(r io.Reader) (io.ReadCloser, error) {
 
 // gzipCompressor is a CompressorFunc for the gzip compression algorithm.
 func gzipCompressor(r io.Writer, metadata map[string]string, level *int) (io.WriteCloser, error) {
+	dest := &errorRecordingWriter{dest: r}
 	if level != nil {
-		return pgzip.NewWriterLevel(r, *level)
+		w, err := pgzip.NewWriterLevel(dest, *level)
+		if err != nil {
+			return nil, err
+		}
+		return gzipWriter{Writer: w, dest: dest}, nil
+	}
+	return gzipWriter{Writer: pgzip.NewWriter(dest), dest: dest}, nil
+}
+
+// gzipWriter is a *pgzip.Writer which does not leak its background goroutine if writing the compressed data fails.
+//
+// If writing to the underlying writer fails, pgzip.Writer.Close returns early, leaving the goroutine which writes
+// the compressed data waiting for more work forever. So, we hide such failures from pgzip.Writer, and report them ourselves.
+type gzipWriter struct {
+	*pgzip.Writer
+	dest *errorRecordingWriter
+}
+
+// Write compresses p.
+func (w gzipWriter) Write(p []byte) (int, error) {
+	if err := w.dest.error(); err != nil {
+		return 0, err
+	}
+	return w.Writer.Write(p)
+}
+
+// Close flushes and closes the writer.
+func (w gzipWriter) Close() error {
+	err := w.Writer.Close()
+	if destErr := w.dest.error(); destErr != nil {
+		return destErr
 	}
-	return pgzip.NewWriter(r), nil
+	return err
+}
+
+// errorRecordingWriter writes to dest until the first failure, records it, and afterwards discards all data.
+// It never reports a failure to its caller.
+type errorRecordingWriter struct {
+	dest io.Writer
+
+	mutex sync.Mutex
+	err   error
+}
+
+func (w *errorRecordingWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.err == nil {
+		_, w.err = w.dest.Write(p)
+	}
+	return len(p), nil
+}
+
+// error returns the first failure to write to w.dest, if any.
+func (w *errorRecordingWriter) error() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.err
 }
 
 // bzip2Compressor is a CompressorFunc for the bzip2 compression algorithm.
@@ -9,6 +9,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
 )
 
 func TestDetectCompression(t *testing.T) {
@@ -126,3 +127,30 @@ func TestAutoDecompress(t *testing.T) {
 	_, _, err = AutoDecompress(reader)
 	assert.Error(t, err)
 }
+
+// failingWriter is an io.Writer which accepts the first remaining bytes, and then fails with err.
+type failingWriter struct {
+	remaining int
+	err       error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.remaining {
+		w.remaining = 0
+		return 0, w.err
+	}
+	w.remaining -= len(p)
+	return len(p), nil
+}
+
+func TestGzipCompressorWriteFailure(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	writeErr := errors.New("write failed")
+	compressor, err := CompressStream(&failingWriter{remaining: 1024, err: writeErr}, Gzip, nil)
+	require.NoError(t, err)
+	input := bytes.Repeat([]byte{'a'}, 10*1024*1024)
+	_, _ = io.Copy(compressor, bytes.NewReader(input)) // The failure might only be reported by Close.
+	err = compressor.Close()
+	assert.ErrorIs(t, err, writeErr)
+}
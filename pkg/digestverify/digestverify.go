@@ -0,0 +1,204 @@
+// Package digestverify provides readers and writers which verify that the data passing through them
+// matches an expected digest and size.
+//
+// The verification result is only known after all of the data has been consumed: a Reader returns io.EOF
+// only if the data matched, and a Writer must be explicitly checked using Writer.Verify after the last write.
+// Until then, the data MUST NOT be trusted; in particular, data read from a Reader which is abandoned
+// (or closed) before reaching io.EOF has not been verified at all.
+package digestverify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+var (
+	// ErrDigestMismatch is returned (possibly wrapped, detect it using errors.Is) when the data does not match the expected digest.
+	ErrDigestMismatch = errors.New("digest mismatch")
+	// ErrSizeMismatch is returned (possibly wrapped, detect it using errors.Is) when the data does not match the expected size.
+	ErrSizeMismatch = errors.New("size mismatch")
+	// ErrClosed is returned when reading from a Reader after it has been closed.
+	ErrClosed = errors.New("read from a closed digest-verifying reader")
+)
+
+// verifier computes a digest and size of data, and compares them with the expected values.
+type verifier struct {
+	digester       digest.Digester
+	expectedDigest digest.Digest
+	expectedSize   int64 // -1 if unknown
+	size           int64
+}
+
+// newVerifier returns a verifier for expectedDigest and expectedSize (-1 if unknown).
+func newVerifier(expectedDigest digest.Digest, expectedSize int64) (*verifier, error) {
+	if err := expectedDigest.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid digest specification %q: %w", expectedDigest, err)
+	}
+	if expectedSize < -1 {
+		return nil, fmt.Errorf("Invalid expected size %d", expectedSize)
+	}
+	return &verifier{
+		digester:       expectedDigest.Algorithm().Digester(),
+		expectedDigest: expectedDigest,
+		expectedSize:   expectedSize,
+	}, nil
+}
+
+// exceedsExpectedSize returns an error if consuming additional bytes would exceed the expected size.
+func (v *verifier) exceedsExpectedSize(additional int) error {
+	if v.expectedSize != -1 && v.size+int64(additional) > v.expectedSize {
+		return fmt.Errorf("%w: expected %d bytes, got at least %d", ErrSizeMismatch, v.expectedSize, v.size+int64(additional))
+	}
+	return nil
+}
+
+// update records that p has been consumed.
+func (v *verifier) update(p []byte) {
+	// hash.Hash.Write never returns an error.
+	_, _ = v.digester.Hash().Write(p)
+	v.size += int64(len(p))
+}
+
+// finish verifies all of the consumed data against the expected values.
+func (v *verifier) finish() error {
+	if v.expectedSize != -1 && v.size != v.expectedSize {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrSizeMismatch, v.expectedSize, v.size)
+	}
+	if actualDigest := v.digester.Digest(); actualDigest != v.expectedDigest {
+		return fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, v.expectedDigest, actualDigest)
+	}
+	return nil
+}
+
+// Reader is an io.ReadCloser which returns the contents of an underlying reader,
+// and verifies them against an expected digest and size.
+//
+// Reader returns io.EOF only if the data matched the expected values; otherwise it returns an error
+// wrapping ErrDigestMismatch or ErrSizeMismatch, and keeps returning that error on any further reads.
+type Reader struct {
+	source    io.Reader
+	verifier  *verifier
+	failure   error // Non-nil if verification has failed
+	succeeded bool
+	closed    bool
+}
+
+// NewReader returns a Reader with contents of source, which will be verified against expectedDigest and
+// expectedSize (-1 if unknown).
+// It fails if expectedDigest is invalid or uses an unavailable algorithm.
+func NewReader(source io.Reader, expectedDigest digest.Digest, expectedSize int64) (*Reader, error) {
+	v, err := newVerifier(expectedDigest, expectedSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		source:   source,
+		verifier: v,
+	}, nil
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	switch {
+	case r.closed:
+		return 0, ErrClosed
+	case r.failure != nil:
+		return 0, r.failure
+	case r.succeeded:
+		return 0, io.EOF
+	}
+
+	n, err := r.source.Read(p)
+	if n > 0 {
+		if sizeErr := r.verifier.exceedsExpectedSize(n); sizeErr != nil {
+			r.failure = sizeErr
+			return 0, r.failure
+		}
+		r.verifier.update(p[:n])
+	}
+	if err == io.EOF {
+		if verifyErr := r.verifier.finish(); verifyErr != nil {
+			r.failure = verifyErr
+			return 0, r.failure
+		}
+		r.succeeded = true
+	}
+	return n, err
+}
+
+// Close closes the underlying reader, if it implements io.Closer.
+// Closing a Reader before it has returned io.EOF does not verify the data, and does not report an error about that.
+func (r *Reader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if closer, ok := r.source.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Verified returns true if all of the data has been read and it matched the expected digest and size.
+func (r *Reader) Verified() bool {
+	return r.succeeded
+}
+
+// Failed returns true if the data has been determined not to match the expected digest or size.
+// Note that Verified() and Failed() can both be false, if the data has not been read to the end.
+func (r *Reader) Failed() bool {
+	return r.failure != nil
+}
+
+// Writer is an io.Writer which passes data to an underlying writer,
+// and verifies it against an expected digest and size.
+//
+// The caller MUST call Verify after writing all of the data; until then, the data written to the
+// underlying writer has not been verified.
+type Writer struct {
+	dest     io.Writer
+	verifier *verifier
+	failure  error // Non-nil if verification has failed
+}
+
+// NewWriter returns a Writer which writes to dest, and verifies the written data against expectedDigest and
+// expectedSize (-1 if unknown).
+// It fails if expectedDigest is invalid or uses an unavailable algorithm.
+func NewWriter(dest io.Writer, expectedDigest digest.Digest, expectedSize int64) (*Writer, error) {
+	v, err := newVerifier(expectedDigest, expectedSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		dest:     dest,
+		verifier: v,
+	}, nil
+}
+
+// Write implements io.Writer.
+// Data which would exceed the expected size is not passed to the underlying writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.failure != nil {
+		return 0, w.failure
+	}
+	if err := w.verifier.exceedsExpectedSize(len(p)); err != nil {
+		w.failure = err
+		return 0, err
+	}
+	n, err := w.dest.Write(p)
+	w.verifier.update(p[:n])
+	return n, err
+}
+
+// Verify returns nil if the data written so far matches the expected digest and size,
+// or an error wrapping ErrDigestMismatch or ErrSizeMismatch.
+// It should be called after all of the data has been written.
+func (w *Writer) Verify() error {
+	if w.failure != nil {
+		return w.failure
+	}
+	return w.verifier.finish()
+}
@@ -0,0 +1,286 @@
+package digestverify
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var verifyTestCases = []struct {
+	input  []byte
+	digest digest.Digest
+}{
+	{[]byte(""), "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	{[]byte("abc"), "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	{make([]byte, 65537), "sha256:3266304f31be278d06c3bd3eb9aa3e00c59bedec0a890de466568b0b90b0e01f"},
+}
+
+var invalidDigests = []digest.Digest{
+	"abc",             // Not algo:hexvalue
+	"crc32:",          // Unknown algorithm, empty value
+	"crc32:012345678", // Unknown algorithm
+	"sha256:",         // Empty value
+	"sha256:0",        // Invalid hex value
+	"sha256:01",       // Invalid length of hex value
+}
+
+func TestNewReader(t *testing.T) {
+	// Only the failure cases, success is tested in TestReaderRead below.
+	source := bytes.NewReader([]byte("abc"))
+	for _, input := range invalidDigests {
+		_, err := NewReader(source, input, -1)
+		assert.Error(t, err, input.String())
+	}
+	_, err := NewReader(source, verifyTestCases[1].digest, -2)
+	assert.Error(t, err)
+}
+
+// closeRecorder is an io.ReadCloser which records whether it has been closed.
+type closeRecorder struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestReaderRead(t *testing.T) {
+	// Valid input, with known and unknown size
+	for _, c := range verifyTestCases {
+		for _, size := range []int64{int64(len(c.input)), -1} {
+			reader, err := NewReader(bytes.NewReader(c.input), c.digest, size)
+			require.NoError(t, err, c.digest.String())
+			dest := bytes.Buffer{}
+			n, err := io.Copy(&dest, reader)
+			assert.NoError(t, err, c.digest.String())
+			assert.Equal(t, int64(len(c.input)), n, c.digest.String())
+			assert.Equal(t, c.input, dest.Bytes(), c.digest.String())
+			assert.False(t, reader.Failed(), c.digest.String())
+			assert.True(t, reader.Verified(), c.digest.String())
+			// Reading again after EOF keeps returning EOF
+			n2, err := reader.Read(make([]byte, 10))
+			assert.Equal(t, 0, n2)
+			assert.Equal(t, io.EOF, err)
+		}
+	}
+
+	// Modified input, with unknown size
+	for _, c := range verifyTestCases {
+		reader, err := NewReader(bytes.NewReader(append(append([]byte{}, c.input...), 'x')), c.digest, -1)
+		require.NoError(t, err, c.digest.String())
+		_, err = io.Copy(io.Discard, reader)
+		assert.ErrorIs(t, err, ErrDigestMismatch, c.digest.String())
+		assert.True(t, reader.Failed(), c.digest.String())
+		assert.False(t, reader.Verified(), c.digest.String())
+		// Double-read misuse: the failure is sticky, a second read never returns EOF.
+		_, err2 := reader.Read(make([]byte, 10))
+		assert.Equal(t, err, err2, c.digest.String())
+		_, err2 = io.Copy(io.Discard, reader)
+		assert.Equal(t, err, err2, c.digest.String())
+	}
+
+	// Modified input of the expected size
+	for _, c := range verifyTestCases {
+		if len(c.input) == 0 {
+			continue
+		}
+		modified := append([]byte{}, c.input...)
+		modified[0] ^= 0xFF
+		reader, err := NewReader(bytes.NewReader(modified), c.digest, int64(len(c.input)))
+		require.NoError(t, err, c.digest.String())
+		_, err = io.Copy(io.Discard, reader)
+		assert.ErrorIs(t, err, ErrDigestMismatch, c.digest.String())
+		assert.True(t, reader.Failed(), c.digest.String())
+		assert.False(t, reader.Verified(), c.digest.String())
+	}
+
+	// Input longer than the expected size fails without returning the extra data
+	for _, c := range verifyTestCases {
+		reader, err := NewReader(bytes.NewReader(append(append([]byte{}, c.input...), 'x')), c.digest, int64(len(c.input)))
+		require.NoError(t, err, c.digest.String())
+		dest := bytes.Buffer{}
+		_, err = io.Copy(&dest, reader)
+		assert.ErrorIs(t, err, ErrSizeMismatch, c.digest.String())
+		assert.LessOrEqual(t, dest.Len(), len(c.input), c.digest.String())
+		assert.True(t, reader.Failed(), c.digest.String())
+		assert.False(t, reader.Verified(), c.digest.String())
+		_, err2 := reader.Read(make([]byte, 10))
+		assert.Equal(t, err, err2, c.digest.String())
+	}
+
+	// Truncated input
+	for _, c := range verifyTestCases {
+		if len(c.input) == 0 {
+			continue
+		}
+		truncated := c.input[:len(c.input)-1]
+		// With a known size, fails at EOF with a size mismatch
+		reader, err := NewReader(bytes.NewReader(truncated), c.digest, int64(len(c.input)))
+		require.NoError(t, err, c.digest.String())
+		_, err = io.Copy(io.Discard, reader)
+		assert.ErrorIs(t, err, ErrSizeMismatch, c.digest.String())
+		assert.True(t, reader.Failed(), c.digest.String())
+		assert.False(t, reader.Verified(), c.digest.String())
+		// With an unknown size, fails at EOF with a digest mismatch
+		reader, err = NewReader(bytes.NewReader(truncated), c.digest, -1)
+		require.NoError(t, err, c.digest.String())
+		_, err = io.Copy(io.Discard, reader)
+		assert.ErrorIs(t, err, ErrDigestMismatch, c.digest.String())
+		assert.True(t, reader.Failed(), c.digest.String())
+		assert.False(t, reader.Verified(), c.digest.String())
+	}
+
+	// Input not read to the end is neither verified nor failed
+	for _, c := range verifyTestCases {
+		reader, err := NewReader(bytes.NewReader(c.input), c.digest, int64(len(c.input)))
+		require.NoError(t, err, c.digest.String())
+		if len(c.input) != 0 {
+			truncatedLen := int64(len(c.input) - 1)
+			n, err := io.CopyN(io.Discard, reader, truncatedLen)
+			assert.NoError(t, err, c.digest.String())
+			assert.Equal(t, truncatedLen, n, c.digest.String())
+		}
+		assert.False(t, reader.Failed(), c.digest.String())
+		assert.False(t, reader.Verified(), c.digest.String())
+	}
+
+	// A source error is passed through
+	sourceErr := errors.New("source failed")
+	reader, err := NewReader(io.MultiReader(bytes.NewReader([]byte("ab")), &failingReader{err: sourceErr}), verifyTestCases[1].digest, 3)
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, reader)
+	assert.ErrorIs(t, err, sourceErr)
+	assert.False(t, reader.Failed())
+	assert.False(t, reader.Verified())
+}
+
+// failingReader is an io.Reader which always fails with err.
+type failingReader struct {
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	return 0, f.err
+}
+
+func TestReaderClose(t *testing.T) {
+	c := verifyTestCases[2]
+
+	// Early close
+	source := &closeRecorder{Reader: bytes.NewReader(c.input)}
+	reader, err := NewReader(source, c.digest, int64(len(c.input)))
+	require.NoError(t, err)
+	_, err = io.CopyN(io.Discard, reader, 100)
+	require.NoError(t, err)
+	err = reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, 1, source.closed)
+	assert.False(t, reader.Failed())
+	assert.False(t, reader.Verified())
+	_, err = reader.Read(make([]byte, 10))
+	assert.ErrorIs(t, err, ErrClosed)
+	// Closing again does not close the source again
+	err = reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, 1, source.closed)
+
+	// Close after successful verification
+	source = &closeRecorder{Reader: bytes.NewReader(c.input)}
+	reader, err = NewReader(source, c.digest, -1)
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, reader)
+	require.NoError(t, err)
+	err = reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, 1, source.closed)
+	assert.True(t, reader.Verified())
+
+	// A source which is not an io.Closer
+	reader, err = NewReader(bytes.NewReader(c.input), c.digest, -1)
+	require.NoError(t, err)
+	err = reader.Close()
+	assert.NoError(t, err)
+	assert.False(t, reader.Verified())
+}
+
+func TestNewWriter(t *testing.T) {
+	// Only the failure cases, success is tested in TestWriterWrite below.
+	for _, input := range invalidDigests {
+		_, err := NewWriter(io.Discard, input, -1)
+		assert.Error(t, err, input.String())
+	}
+	_, err := NewWriter(io.Discard, verifyTestCases[1].digest, -2)
+	assert.Error(t, err)
+}
+
+func TestWriterWrite(t *testing.T) {
+	// Valid input, with known and unknown size
+	for _, c := range verifyTestCases {
+		for _, size := range []int64{int64(len(c.input)), -1} {
+			dest := bytes.Buffer{}
+			writer, err := NewWriter(&dest, c.digest, size)
+			require.NoError(t, err, c.digest.String())
+			n, err := io.Copy(writer, bytes.NewReader(c.input))
+			require.NoError(t, err, c.digest.String())
+			assert.Equal(t, int64(len(c.input)), n, c.digest.String())
+			assert.True(t, bytes.Equal(c.input, dest.Bytes()), c.digest.String())
+			err = writer.Verify()
+			assert.NoError(t, err, c.digest.String())
+		}
+	}
+
+	// Modified input, with unknown size
+	for _, c := range verifyTestCases {
+		writer, err := NewWriter(io.Discard, c.digest, -1)
+		require.NoError(t, err, c.digest.String())
+		_, err = writer.Write(append(append([]byte{}, c.input...), 'x'))
+		require.NoError(t, err, c.digest.String())
+		err = writer.Verify()
+		assert.ErrorIs(t, err, ErrDigestMismatch, c.digest.String())
+	}
+
+	// Input longer than the expected size fails without writing the extra data
+	for _, c := range verifyTestCases {
+		dest := bytes.Buffer{}
+		writer, err := NewWriter(&dest, c.digest, int64(len(c.input)))
+		require.NoError(t, err, c.digest.String())
+		_, err = writer.Write(c.input)
+		require.NoError(t, err, c.digest.String())
+		_, err = writer.Write([]byte("x"))
+		assert.ErrorIs(t, err, ErrSizeMismatch, c.digest.String())
+		assert.True(t, bytes.Equal(c.input, dest.Bytes()), c.digest.String())
+		// The failure is sticky
+		_, err2 := writer.Write([]byte{})
+		assert.Equal(t, err, err2, c.digest.String())
+		err2 = writer.Verify()
+		assert.Equal(t, err, err2, c.digest.String())
+	}
+
+	// Truncated input
+	for _, c := range verifyTestCases {
+		if len(c.input) == 0 {
+			continue
+		}
+		truncated := c.input[:len(c.input)-1]
+		writer, err := NewWriter(io.Discard, c.digest, int64(len(c.input)))
+		require.NoError(t, err, c.digest.String())
+		_, err = writer.Write(truncated)
+		require.NoError(t, err, c.digest.String())
+		err = writer.Verify()
+		assert.ErrorIs(t, err, ErrSizeMismatch, c.digest.String())
+
+		writer, err = NewWriter(io.Discard, c.digest, -1)
+		require.NoError(t, err, c.digest.String())
+		_, err = writer.Write(truncated)
+		require.NoError(t, err, c.digest.String())
+		err = writer.Verify()
+		assert.ErrorIs(t, err, ErrDigestMismatch, c.digest.String())
+	}
+}
@@ -0,0 +1,218 @@
+package registrytest
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Fault is a failure injected into the server’s response to a request.
+type Fault struct {
+	// If Delay is not 0, the server waits for Delay before handling the request, and applying the rest of the fault.
+	Delay time.Duration
+	// If StatusCode is not 0, the request is not processed, and the server responds with StatusCode
+	// and an error in the format of the distribution specification.
+	StatusCode int
+	// If RetryAfter is not 0, a response with StatusCode includes a Retry-After header, rounded up to whole seconds.
+	RetryAfter time.Duration
+	// If ResetConnection is set, and StatusCode is 0, the request is processed, but the connection is reset
+	// after sending at most ResetAfterBytes bytes of the response body; with ResetAfterBytes == 0, no response is sent at all.
+	// If the response body is shorter than ResetAfterBytes, the connection is not reset.
+	ResetConnection bool
+	ResetAfterBytes int64
+	// If ResetAfterRequestBytes is not 0, and StatusCode is 0, only the first ResetAfterRequestBytes bytes of the request body
+	// are received and processed, as if the client has sent no more, and the connection is then reset without sending a response.
+	ResetAfterRequestBytes int64
+}
+
+// FaultInjector decides whether to inject a fault into the server’s response to a request;
+// it returns nil to process the request normally.
+// It may be called concurrently from several goroutines.
+type FaultInjector func(r *http.Request) *Fault
+
+// InjectFirst returns a FaultInjector which injects fault into the first n requests for which match returns true,
+// and processes all other requests normally. A nil match matches all requests.
+func InjectFirst(n int, match func(r *http.Request) bool, fault Fault) FaultInjector {
+	mutex := sync.Mutex{}
+	remaining := n
+	return func(r *http.Request) *Fault {
+		if match != nil && !match(r) {
+			return nil
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if remaining <= 0 {
+			return nil
+		}
+		remaining--
+		f := fault
+		return &f
+	}
+}
+
+// MatchRequest returns a function, usable with InjectFirst, which matches requests using method
+// (or any method, if method is ""), with a URL path matching pathRegexp.
+// It panics if pathRegexp is not a valid regular expression.
+func MatchRequest(method, pathRegexp string) func(r *http.Request) bool {
+	re := regexp.MustCompile(pathRegexp)
+	return func(r *http.Request) bool {
+		return (method == "" || r.Method == method) && re.MatchString(r.URL.Path)
+	}
+}
+
+// errConnectionReset is returned by writes to a connection reset by a Fault.
+var errConnectionReset = errors.New("connection reset by an injected fault")
+
+// apply applies f to the response written to w, and returns true if the request should be processed further.
+func (f *Fault) apply(w *recordingResponseWriter) bool {
+	if f.Delay != 0 {
+		time.Sleep(f.Delay)
+	}
+	if f.StatusCode != 0 {
+		if f.RetryAfter != 0 {
+			seconds := (f.RetryAfter + time.Second - 1) / time.Second
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(seconds), 10))
+		}
+		code := "UNKNOWN"
+		if f.StatusCode == http.StatusTooManyRequests {
+			code = "TOOMANYREQUESTS"
+		}
+		writeError(w, f.StatusCode, code, fmt.Sprintf("injected fault: status %d", f.StatusCode))
+		return false
+	}
+	if f.ResetConnection && f.ResetAfterBytes == 0 {
+		w.reset()
+		return false
+	}
+	return true
+}
+
+// truncateRequest applies f to the body of r, before r is processed.
+func (f *Fault) truncateRequest(r *http.Request) {
+	if f.ResetAfterRequestBytes != 0 {
+		r.Body = truncatedBody{Reader: io.LimitReader(r.Body, f.ResetAfterRequestBytes), Closer: r.Body}
+	}
+}
+
+// finishResponse applies f after processing a request, with the response written to w.
+func (f *Fault) finishResponse(w *recordingResponseWriter) {
+	if f.ResetAfterRequestBytes != 0 {
+		w.reset()
+	}
+}
+
+// truncatedBody is a request body truncated by a Fault.
+type truncatedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// wrapResponseWriter returns a http.ResponseWriter which applies f to the response written to w.
+func (f *Fault) wrapResponseWriter(w *recordingResponseWriter) http.ResponseWriter {
+	if f.ResetAfterRequestBytes != 0 {
+		return &discardingResponseWriter{header: http.Header{}}
+	}
+	if !f.ResetConnection {
+		return w
+	}
+	return &resettingResponseWriter{recordingResponseWriter: w, remaining: f.ResetAfterBytes}
+}
+
+// recordingResponseWriter is a http.ResponseWriter which records the status code of the response.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode   int
+	bytesWritten int64
+}
+
+func (w *recordingResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *recordingResponseWriter) Write(p []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytesWritten += int64(n)
+	return n, err
+}
+
+// reset flushes any data written so far, and resets the underlying connection.
+func (w *recordingResponseWriter) reset() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok && w.statusCode != 0 {
+		flusher.Flush()
+	}
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		panic("internal error: the http.ResponseWriter does not support hijacking the connection")
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		panic(fmt.Sprintf("internal error: hijacking the connection: %v", err))
+	}
+	resetConnection(conn)
+}
+
+// resetConnection closes conn, without a TLS close_notify alert, and sending a TCP RST if possible.
+func resetConnection(conn net.Conn) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+// resettingResponseWriter is a http.ResponseWriter which resets the connection after writing a specified number of body bytes.
+type resettingResponseWriter struct {
+	*recordingResponseWriter
+	remaining int64
+	isReset   bool
+}
+
+func (w *resettingResponseWriter) Write(p []byte) (int, error) {
+	if w.isReset {
+		return 0, errConnectionReset
+	}
+	if int64(len(p)) < w.remaining {
+		n, err := w.recordingResponseWriter.Write(p)
+		w.remaining -= int64(n)
+		return n, err
+	}
+	n, err := w.recordingResponseWriter.Write(p[:w.remaining])
+	w.remaining -= int64(n)
+	if err != nil {
+		return n, err
+	}
+	w.recordingResponseWriter.reset()
+	w.isReset = true
+	return n, errConnectionReset
+}
+
+// discardingResponseWriter is a http.ResponseWriter which discards the response.
+type discardingResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardingResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardingResponseWriter) WriteHeader(statusCode int) {
+}
+
+func (w *discardingResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
@@ -0,0 +1,787 @@
+// Package registrytest provides an in-process container registry, implementing enough of the
+// distribution API for testing code which uses the docker transport of this library.
+//
+// The registry is not intended for any use other than tests: it keeps all data in memory,
+// and it performs only the minimal validation of the data it receives.
+package registrytest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// AuthType is the kind of authentication required by a Server.
+type AuthType int
+
+const (
+	// NoAuth accepts all requests without authentication.
+	NoAuth AuthType = iota
+	// BasicAuth requires HTTP basic authentication with Options.Username and Options.Password.
+	BasicAuth
+	// TokenAuth requires bearer tokens, issued by the server’s token endpoint
+	// to clients authenticating with Options.Username and Options.Password.
+	TokenAuth
+)
+
+// Options allows supplying non-default configuration of a Server.
+type Options struct {
+	Auth     AuthType // NoAuth by default
+	Username string   // Required if Auth is not NoAuth
+	Password string   // Required if Auth is not NoAuth
+	// If DisableReferrersAPI is set, the server does not implement the referrers API, and does not report
+	// the subject of uploaded manifests, as registries predating the OCI distribution specification 1.1 do.
+	DisableReferrersAPI bool
+	// If ReferrersPageSize is not 0, responses of the referrers API contain at most ReferrersPageSize referrers,
+	// and link to the next page, if any, using a Link header.
+	ReferrersPageSize int
+	// If MaxManifestSize is not 0, uploads of manifests larger than MaxManifestSize bytes are refused
+	// with status 413 (Payload Too Large).
+	MaxManifestSize int
+	// If BlobRedirect is set, it is called for GET requests for existing blobs; if it returns a non-empty URL,
+	// the request is redirected to that URL (with status 307), e.g. to simulate a registry serving blobs from a CDN.
+	BlobRedirect func(r *http.Request, repo string, d digest.Digest) string
+}
+
+// Request is a record of a request received by a Server.
+type Request struct {
+	Method        string
+	Path          string
+	Query         url.Values
+	ContentLength int64 // The length of the request body declared by the client, or -1 if unknown.
+	StatusCode    int   // The status code of the response, or 0 if the connection was closed without a response.
+	BytesWritten  int64 // The number of bytes of the response body written by the server.
+}
+
+// Server is an in-process container registry.
+// It must be closed by calling Close.
+type Server struct {
+	server  *httptest.Server
+	options Options
+	token   string // The bearer token accepted with TokenAuth
+
+	mutex         sync.Mutex // Protects all fields below
+	repos         map[string]*repository
+	uploads       map[string]*upload
+	faultInjector FaultInjector
+	requests      []Request
+}
+
+// repository is the contents of a single repository in a Server.
+type repository struct {
+	blobs     map[digest.Digest][]byte
+	manifests map[digest.Digest]storedManifest
+	tags      map[string]digest.Digest
+}
+
+// storedManifest is a manifest stored in a repository.
+type storedManifest struct {
+	mediaType string
+	contents  []byte
+}
+
+// upload is the state of an ongoing blob upload.
+type upload struct {
+	repo     string
+	contents bytes.Buffer
+}
+
+// NewServer starts a Server, listening on a local address using TLS with a self-signed certificate.
+// Options may be nil.
+func NewServer(options *Options) *Server {
+	if options == nil {
+		options = &Options{}
+	}
+	s := &Server{
+		options: *options,
+		token:   randomHex(),
+		repos:   map[string]*repository{},
+		uploads: map[string]*upload{},
+	}
+	s.server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close shuts down the server, and waits for all outstanding requests to complete.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Host returns the host:port of the server, usable as a registry host name in image references,
+// e.g. "docker://"+s.Host()+"/repo:tag".
+func (s *Server) Host() string {
+	return s.server.Listener.Addr().String()
+}
+
+// SystemContext returns a types.SystemContext which allows the docker transport to connect to the server
+// and, if it requires authentication, to authenticate.
+// The returned value is a new object which may be freely modified by the caller.
+func (s *Server) SystemContext() *types.SystemContext {
+	sys := &types.SystemContext{
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+	if s.options.Auth != NoAuth {
+		sys.DockerAuthConfig = &types.DockerAuthConfig{
+			Username: s.options.Username,
+			Password: s.options.Password,
+		}
+	}
+	return sys
+}
+
+// SetFaultInjector sets a FaultInjector consulted for all following requests; nil disables fault injection.
+func (s *Server) SetFaultInjector(fi FaultInjector) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faultInjector = fi
+}
+
+// Requests returns a record of all requests received by the server so far, in the order they were received.
+// Requests which are still being processed are not included.
+func (s *Server) Requests() []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// PutBlob stores contents as a blob in repo, and returns its digest.
+func (s *Server) PutBlob(repo string, contents []byte) digest.Digest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	d := digest.FromBytes(contents)
+	s.repo(repo, true).blobs[d] = slices.Clone(contents)
+	return d
+}
+
+// Blob returns the contents of blob d in repo, if present.
+func (s *Server) Blob(repo string, d digest.Digest) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	r := s.repo(repo, false)
+	if r == nil {
+		return nil, false
+	}
+	contents, ok := r.blobs[d]
+	return slices.Clone(contents), ok
+}
+
+// PutManifest stores contents, of mediaType, as a manifest in repo, tags it with tag if tag is not "",
+// and returns its digest.
+func (s *Server) PutManifest(repo, tag, mediaType string, contents []byte) digest.Digest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	r := s.repo(repo, true)
+	d := digest.FromBytes(contents)
+	r.manifests[d] = storedManifest{mediaType: mediaType, contents: slices.Clone(contents)}
+	if tag != "" {
+		r.tags[tag] = d
+	}
+	return d
+}
+
+// Manifest returns the contents and media type of a manifest in repo, referenced by a tag or a digest, if present.
+func (s *Server) Manifest(repo, reference string) ([]byte, string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	m, _, ok := s.lookupManifest(repo, reference)
+	if !ok {
+		return nil, "", false
+	}
+	return slices.Clone(m.contents), m.mediaType, true
+}
+
+// Tags returns the tags in repo, sorted.
+func (s *Server) Tags(repo string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	r := s.repo(repo, false)
+	if r == nil {
+		return []string{}
+	}
+	tags := maps.Keys(r.tags)
+	slices.Sort(tags)
+	return tags
+}
+
+// Referrers returns descriptors of the manifests in repo which have a subject with digest subject,
+// as returned by the referrers API; if artifactType is not "", only manifests of that artifact type are returned.
+func (s *Server) Referrers(repo string, subject digest.Digest, artifactType string) []imgspecv1.Descriptor {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.referrers(repo, subject, artifactType)
+}
+
+// repo returns the repository with name, creating it if create; it returns nil if it does not exist and !create.
+// The caller must hold s.mutex.
+func (s *Server) repo(name string, create bool) *repository {
+	r, ok := s.repos[name]
+	if !ok && create {
+		r = &repository{
+			blobs:     map[digest.Digest][]byte{},
+			manifests: map[digest.Digest]storedManifest{},
+			tags:      map[string]digest.Digest{},
+		}
+		s.repos[name] = r
+	}
+	return r
+}
+
+// lookupManifest returns a manifest in repo, referenced by a tag or a digest, and its digest, if present.
+// The caller must hold s.mutex.
+func (s *Server) lookupManifest(repo, reference string) (storedManifest, digest.Digest, bool) {
+	r := s.repo(repo, false)
+	if r == nil {
+		return storedManifest{}, "", false
+	}
+	d, err := digest.Parse(reference)
+	if err != nil {
+		tagged, ok := r.tags[reference]
+		if !ok {
+			return storedManifest{}, "", false
+		}
+		d = tagged
+	}
+	m, ok := r.manifests[d]
+	return m, d, ok
+}
+
+// referrerFields are the fields of a manifest relevant for the referrers API.
+type referrerFields struct {
+	ArtifactType string                `json:"artifactType,omitempty"`
+	Config       imgspecv1.Descriptor  `json:"config"`
+	Subject      *imgspecv1.Descriptor `json:"subject,omitempty"`
+	Annotations  map[string]string     `json:"annotations,omitempty"`
+}
+
+// parseReferrerFields returns the referrer-relevant fields of contents, or nil if the manifest does not have a subject.
+func parseReferrerFields(contents []byte) *referrerFields {
+	var fields referrerFields
+	if err := json.Unmarshal(contents, &fields); err != nil || fields.Subject == nil {
+		return nil
+	}
+	return &fields
+}
+
+// referrers is Referrers; the caller must hold s.mutex.
+func (s *Server) referrers(repo string, subject digest.Digest, artifactType string) []imgspecv1.Descriptor {
+	res := []imgspecv1.Descriptor{}
+	r := s.repo(repo, false)
+	if r == nil {
+		return res
+	}
+	digests := maps.Keys(r.manifests)
+	slices.Sort(digests) // For deterministic output
+	for _, d := range digests {
+		m := r.manifests[d]
+		fields := parseReferrerFields(m.contents)
+		if fields == nil || fields.Subject.Digest != subject {
+			continue
+		}
+		mArtifactType := fields.ArtifactType
+		if mArtifactType == "" {
+			mArtifactType = fields.Config.MediaType
+		}
+		if artifactType != "" && mArtifactType != artifactType {
+			continue
+		}
+		res = append(res, imgspecv1.Descriptor{
+			MediaType:    m.mediaType,
+			Digest:       d,
+			Size:         int64(len(m.contents)),
+			ArtifactType: mArtifactType,
+			Annotations:  fields.Annotations,
+		})
+	}
+	return res
+}
+
+var (
+	uploadPathRegexp    = regexp.MustCompile(`^/v2/(.+)/blobs/uploads/([^/]*)$`)
+	blobPathRegexp      = regexp.MustCompile(`^/v2/(.+)/blobs/([^/]+)$`)
+	manifestPathRegexp  = regexp.MustCompile(`^/v2/(.+)/manifests/([^/]+)$`)
+	tagListPathRegexp   = regexp.MustCompile(`^/v2/(.+)/tags/list$`)
+	referrersPathRegexp = regexp.MustCompile(`^/v2/(.+)/referrers/([^/]+)$`)
+)
+
+// tokenPath is the path of the token endpoint, with TokenAuth.
+const tokenPath = "/token"
+
+// serveHTTP handles all requests to the server.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := &recordingResponseWriter{ResponseWriter: w}
+	defer func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.requests = append(s.requests, Request{
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Query:         r.URL.Query(),
+			ContentLength: r.ContentLength,
+			StatusCode:    rec.statusCode,
+			BytesWritten:  rec.bytesWritten,
+		})
+	}()
+
+	s.mutex.Lock()
+	fi := s.faultInjector
+	s.mutex.Unlock()
+	var rw http.ResponseWriter = rec
+	if fi != nil {
+		if fault := fi(r); fault != nil {
+			if !fault.apply(rec) {
+				return
+			}
+			fault.truncateRequest(r)
+			defer fault.finishResponse(rec)
+			rw = fault.wrapResponseWriter(rec)
+		}
+	}
+
+	if r.URL.Path == tokenPath && s.options.Auth == TokenAuth {
+		s.serveToken(rw, r)
+		return
+	}
+	if !s.authorized(r) {
+		s.writeUnauthorized(rw)
+		return
+	}
+
+	path := r.URL.Path
+	if path == "/v2/" {
+		rw.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+	if m := uploadPathRegexp.FindStringSubmatch(path); m != nil {
+		s.serveUpload(rw, r, m[1], m[2])
+		return
+	}
+	if m := blobPathRegexp.FindStringSubmatch(path); m != nil {
+		s.serveBlob(rw, r, m[1], m[2])
+		return
+	}
+	if m := manifestPathRegexp.FindStringSubmatch(path); m != nil {
+		s.serveManifest(rw, r, m[1], m[2])
+		return
+	}
+	if m := tagListPathRegexp.FindStringSubmatch(path); m != nil {
+		s.serveTagList(rw, r, m[1])
+		return
+	}
+	if m := referrersPathRegexp.FindStringSubmatch(path); m != nil && !s.options.DisableReferrersAPI {
+		s.serveReferrers(rw, r, m[1], m[2])
+		return
+	}
+	writeError(rw, http.StatusNotFound, "NAME_UNKNOWN", fmt.Sprintf("unknown path %q", path))
+}
+
+// authorized returns true if r is authenticated as required by s.options.Auth.
+func (s *Server) authorized(r *http.Request) bool {
+	switch s.options.Auth {
+	case BasicAuth:
+		username, password, ok := r.BasicAuth()
+		return ok && username == s.options.Username && password == s.options.Password
+	case TokenAuth:
+		return r.Header.Get("Authorization") == "Bearer "+s.token
+	default:
+		return true
+	}
+}
+
+// writeUnauthorized writes a response asking the client to authenticate.
+func (s *Server) writeUnauthorized(w http.ResponseWriter) {
+	switch s.options.Auth {
+	case BasicAuth:
+		w.Header().Set("WWW-Authenticate", `Basic realm="registrytest"`)
+	case TokenAuth:
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s%s",service="registrytest"`, s.server.URL, tokenPath))
+	}
+	writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+}
+
+// serveToken handles requests to the token endpoint.
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok || username != s.options.Username || password != s.options.Password {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid username or password")
+		return
+	}
+	writeJSON(w, http.StatusOK, "application/json", map[string]any{
+		"token":      s.token,
+		"expires_in": 3600,
+	})
+}
+
+// serveUpload handles requests to blob upload endpoints.
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, repo, uuid string) {
+	// Read the body before locking s.mutex, so that concurrent uploads are not serialized.
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if uuid == "" {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+			return
+		}
+		query := r.URL.Query()
+		if mount := query.Get("mount"); mount != "" {
+			if from := s.repo(query.Get("from"), false); from != nil {
+				if contents, ok := from.blobs[digest.Digest(mount)]; ok {
+					s.repo(repo, true).blobs[digest.Digest(mount)] = contents
+					writeBlobCreated(w, repo, digest.Digest(mount))
+					return
+				}
+			}
+			// Otherwise, start an ordinary upload, as the distribution specification requires.
+		}
+		u := &upload{repo: repo}
+		u.contents.Write(body)
+		if d := query.Get("digest"); d != "" { // A monolithic upload
+			s.finishUpload(w, u, d)
+			return
+		}
+		uuid = randomHex()
+		s.uploads[uuid] = u
+		writeUploadAccepted(w, repo, uuid, u)
+		return
+	}
+
+	u, ok := s.uploads[uuid]
+	if !ok || u.repo != repo {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", fmt.Sprintf("unknown upload %q", uuid))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		setUploadHeaders(w, repo, uuid, u)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPatch:
+		if contentRange := r.Header.Get("Content-Range"); contentRange != "" {
+			if contentRange != fmt.Sprintf("%d-%d", u.contents.Len(), u.contents.Len()+len(body)-1) {
+				writeError(w, http.StatusRequestedRangeNotSatisfiable, "BLOB_UPLOAD_INVALID",
+					fmt.Sprintf("unexpected Content-Range %q, %d bytes were uploaded", contentRange, u.contents.Len()))
+				return
+			}
+		}
+		u.contents.Write(body)
+		writeUploadAccepted(w, repo, uuid, u)
+	case http.MethodPut:
+		delete(s.uploads, uuid)
+		u.contents.Write(body)
+		s.finishUpload(w, u, r.URL.Query().Get("digest"))
+	case http.MethodDelete:
+		delete(s.uploads, uuid)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+	}
+}
+
+// finishUpload stores the contents of u, if they match expectedDigest.
+// The caller must hold s.mutex.
+func (s *Server) finishUpload(w http.ResponseWriter, u *upload, expectedDigest string) {
+	d, err := digest.Parse(expectedDigest)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", fmt.Sprintf("invalid digest %q", expectedDigest))
+		return
+	}
+	if actual := d.Algorithm().FromBytes(u.contents.Bytes()); actual != d {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", fmt.Sprintf("digest mismatch: uploaded %s, expected %s", actual, d))
+		return
+	}
+	s.repo(u.repo, true).blobs[d] = u.contents.Bytes()
+	writeBlobCreated(w, u.repo, d)
+}
+
+// serveBlob handles requests to blob endpoints.
+func (s *Server) serveBlob(w http.ResponseWriter, r *http.Request, repo, digestString string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+		return
+	}
+	d, err := digest.Parse(digestString)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", fmt.Sprintf("invalid digest %q", digestString))
+		return
+	}
+	contents, ok := s.Blob(repo, d)
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", fmt.Sprintf("blob %s not found", d))
+		return
+	}
+	if r.Method == http.MethodGet && s.options.BlobRedirect != nil {
+		if target := s.options.BlobRedirect(r, repo, d); target != "" {
+			http.Redirect(w, r, target, http.StatusTemporaryRedirect)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", d.String())
+	// http.ServeContent handles Range: headers, and HEAD requests.
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(contents))
+}
+
+// serveManifest handles requests to manifest endpoints.
+func (s *Server) serveManifest(w http.ResponseWriter, r *http.Request, repo, reference string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		m, d, ok := s.lookupManifest(repo, reference)
+		if !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest %q not found", reference))
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(m.contents)))
+		w.Header().Set("Docker-Content-Digest", d.String())
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(m.contents)
+		}
+
+	case http.MethodPut:
+		contents := body
+		if s.options.MaxManifestSize != 0 && len(contents) > s.options.MaxManifestSize {
+			writeError(w, http.StatusRequestEntityTooLarge, "SIZE_INVALID", fmt.Sprintf("manifest of %d bytes exceeds the limit of %d bytes", len(contents), s.options.MaxManifestSize))
+			return
+		}
+		if !json.Valid(contents) {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", "manifest is not valid JSON")
+			return
+		}
+		d := digest.FromBytes(contents)
+		tag := reference
+		if refDigest, err := digest.Parse(reference); err == nil {
+			if actual := refDigest.Algorithm().FromBytes(contents); actual != refDigest {
+				writeError(w, http.StatusBadRequest, "DIGEST_INVALID", fmt.Sprintf("digest mismatch: uploaded %s, expected %s", actual, refDigest))
+				return
+			}
+			d, tag = refDigest, ""
+		}
+		rep := s.repo(repo, true)
+		rep.manifests[d] = storedManifest{mediaType: manifestMediaType(r, contents), contents: contents}
+		if tag != "" {
+			rep.tags[tag] = d
+		}
+		if fields := parseReferrerFields(contents); fields != nil && !s.options.DisableReferrersAPI {
+			w.Header().Set("OCI-Subject", fields.Subject.Digest.String())
+		}
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/manifests/%s", repo, d))
+		w.Header().Set("Docker-Content-Digest", d.String())
+		w.WriteHeader(http.StatusCreated)
+
+	case http.MethodDelete:
+		rep := s.repo(repo, false)
+		if rep == nil {
+			writeError(w, http.StatusNotFound, "NAME_UNKNOWN", fmt.Sprintf("repository %q not found", repo))
+			return
+		}
+		d, err := digest.Parse(reference)
+		if err != nil { // Deleting a tag
+			if _, ok := rep.tags[reference]; !ok {
+				writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("tag %q not found", reference))
+				return
+			}
+			delete(rep.tags, reference)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if _, ok := rep.manifests[d]; !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest %s not found", d))
+			return
+		}
+		delete(rep.manifests, d)
+		for tag, tagged := range rep.tags {
+			if tagged == d {
+				delete(rep.tags, tag)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+	}
+}
+
+// manifestMediaType returns the media type of a manifest upload request r, or, if it is not set,
+// the mediaType field of contents.
+func manifestMediaType(r *http.Request, contents []byte) string {
+	mediaType, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	if mediaType == "" {
+		var m struct {
+			MediaType string `json:"mediaType"`
+		}
+		if err := json.Unmarshal(contents, &m); err == nil {
+			mediaType = m.MediaType
+		}
+	}
+	return mediaType
+}
+
+// serveTagList handles requests to the tag list endpoint.
+func (s *Server) serveTagList(w http.ResponseWriter, r *http.Request, repo string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+		return
+	}
+	s.mutex.Lock()
+	exists := s.repo(repo, false) != nil
+	s.mutex.Unlock()
+	if !exists {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", fmt.Sprintf("repository %q not found", repo))
+		return
+	}
+	tags := s.Tags(repo)
+
+	query := r.URL.Query()
+	if last := query.Get("last"); last != "" {
+		i, _ := slices.BinarySearch(tags, last)
+		if i < len(tags) && tags[i] == last {
+			i++
+		}
+		tags = tags[i:]
+	}
+	if nString := query.Get("n"); nString != "" {
+		n, err := strconv.Atoi(nString)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "PAGINATION_NUMBER_INVALID", fmt.Sprintf("invalid n %q", nString))
+			return
+		}
+		if n < len(tags) {
+			tags = tags[:n]
+			next := url.Values{"n": {nString}, "last": {tags[len(tags)-1]}}
+			w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?%s>; rel="next"`, repo, next.Encode()))
+		}
+	}
+	writeJSON(w, http.StatusOK, "application/json", map[string]any{
+		"name": repo,
+		"tags": tags,
+	})
+}
+
+// serveReferrers handles requests to the referrers API.
+func (s *Server) serveReferrers(w http.ResponseWriter, r *http.Request, repo, digestString string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+		return
+	}
+	d, err := digest.Parse(digestString)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", fmt.Sprintf("invalid digest %q", digestString))
+		return
+	}
+	query := r.URL.Query()
+	artifactType := query.Get("artifactType")
+	if artifactType != "" {
+		w.Header().Set("OCI-Filters-Applied", "artifactType")
+	}
+	referrers := s.Referrers(repo, d, artifactType) // Sorted by digest
+	if last := query.Get("last"); last != "" {
+		i, _ := slices.BinarySearchFunc(referrers, digest.Digest(last), func(desc imgspecv1.Descriptor, target digest.Digest) int {
+			return strings.Compare(desc.Digest.String(), target.String())
+		})
+		if i < len(referrers) && referrers[i].Digest.String() == last {
+			i++
+		}
+		referrers = referrers[i:]
+	}
+	if s.options.ReferrersPageSize != 0 && s.options.ReferrersPageSize < len(referrers) {
+		referrers = referrers[:s.options.ReferrersPageSize]
+		next := url.Values{"last": {referrers[len(referrers)-1].Digest.String()}}
+		if artifactType != "" {
+			next.Set("artifactType", artifactType)
+		}
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/referrers/%s?%s>; rel="next"`, repo, d, next.Encode()))
+	}
+	writeJSON(w, http.StatusOK, imgspecv1.MediaTypeImageIndex, imgspecv1.Index{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: referrers,
+	})
+}
+
+// writeUploadAccepted writes a response to a request which started or continued upload u, with uuid, in repo.
+func writeUploadAccepted(w http.ResponseWriter, repo, uuid string, u *upload) {
+	setUploadHeaders(w, repo, uuid, u)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// setUploadHeaders sets the headers describing the state of upload u, with uuid, in repo.
+func setUploadHeaders(w http.ResponseWriter, repo, uuid string, u *upload) {
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, uuid))
+	w.Header().Set("Docker-Upload-UUID", uuid)
+	end := u.contents.Len() - 1
+	if end < 0 {
+		end = 0
+	}
+	w.Header().Set("Range", fmt.Sprintf("0-%d", end))
+}
+
+// writeBlobCreated writes a response to a request which created blob d in repo.
+func writeBlobCreated(w http.ResponseWriter, repo string, d digest.Digest) {
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repo, d))
+	w.Header().Set("Docker-Content-Digest", d.String())
+	w.WriteHeader(http.StatusCreated)
+}
+
+// writeError writes an error response in the format of the distribution specification.
+func writeError(w http.ResponseWriter, statusCode int, code, message string) {
+	writeJSON(w, statusCode, "application/json", map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+// writeJSON writes a response with statusCode, and value encoded as JSON with mediaType.
+func writeJSON(w http.ResponseWriter, statusCode int, mediaType string, value any) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(body)
+}
+
+// randomHex returns a random hexadecimal string, usable as a unique identifier.
+func randomHex() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("reading random data: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
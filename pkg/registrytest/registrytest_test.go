@@ -0,0 +1,319 @@
+package registrytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// layerSize is the size of the layer of images created by createSourceImage.
+const layerSize = 2 * 1024 * 1024
+
+// createSourceImage creates a dir: image with a single random layer, and returns a reference to it.
+func createSourceImage(t *testing.T) types.ImageReference {
+	dir := t.TempDir()
+	layer := make([]byte, layerSize)
+	_, err := rand.New(rand.NewSource(1)).Read(layer)
+	require.NoError(t, err)
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":["` + digest.FromBytes(layer).String() + `"]}}`)
+	manifestBlob, err := manifest.OCI1FromComponents(imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageConfig,
+		Digest:    digest.FromBytes(config),
+		Size:      int64(len(config)),
+	}, []imgspecv1.Descriptor{{
+		MediaType: imgspecv1.MediaTypeImageLayer,
+		Digest:    digest.FromBytes(layer),
+		Size:      int64(len(layer)),
+	}}).Serialize()
+	require.NoError(t, err)
+	for path, contents := range map[string][]byte{
+		digest.FromBytes(config).Encoded(): config,
+		digest.FromBytes(layer).Encoded():  layer,
+		"manifest.json":                    manifestBlob,
+	} {
+		err := os.WriteFile(filepath.Join(dir, path), contents, 0o644)
+		require.NoError(t, err)
+	}
+	ref, err := directory.NewReference(dir)
+	require.NoError(t, err)
+	return ref
+}
+
+// copyImage copies src to dest, using sys for any docker: references, and returns the copied manifest.
+func copyImage(t *testing.T, sys *types.SystemContext, dest, src types.ImageReference, options *copy.Options) ([]byte, error) {
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{
+		Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+	if options == nil {
+		options = &copy.Options{}
+	}
+	options.SourceCtx = sys
+	options.DestinationCtx = sys
+	return copy.Image(context.Background(), policyContext, dest, src, options)
+}
+
+// newSystemContext returns a types.SystemContext for s, which does not use any system-wide configuration.
+func newSystemContext(t *testing.T, s *Server) *types.SystemContext {
+	sys := s.SystemContext()
+	sys.SystemRegistriesConfPath = "/dev/null"
+	sys.RegistriesDirPath = t.TempDir()
+	sys.BlobInfoCacheDir = t.TempDir()
+	if sys.DockerAuthConfig == nil {
+		sys.AuthFilePath = filepath.Join(t.TempDir(), "auth.json")
+	}
+	return sys
+}
+
+// dockerRef returns a docker: reference to repoAndTag in s.
+func dockerRef(t *testing.T, s *Server, repoAndTag string) types.ImageReference {
+	ref, err := alltransports.ParseImageName("docker://" + s.Host() + "/" + repoAndTag)
+	require.NoError(t, err)
+	return ref
+}
+
+// countRequests returns the number of requests received by s with method, path and statusCode.
+func countRequests(s *Server, method, path string, statusCode int) int {
+	res := 0
+	for _, r := range s.Requests() {
+		if r.Method == method && r.Path == path && r.StatusCode == statusCode {
+			res++
+		}
+	}
+	return res
+}
+
+func TestServerPushPull(t *testing.T) {
+	src := createSourceImage(t)
+	for _, options := range []*Options{
+		nil,
+		{Auth: BasicAuth, Username: "user", Password: "pass"},
+		{Auth: TokenAuth, Username: "user", Password: "pass"},
+	} {
+		s := NewServer(options)
+		defer s.Close()
+		sys := newSystemContext(t, s)
+
+		pushed, err := copyImage(t, sys, dockerRef(t, s, "ns/repo:tag"), src, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tag"}, s.Tags("ns/repo"))
+		stored, mimeType, ok := s.Manifest("ns/repo", "tag")
+		require.True(t, ok)
+		assert.Equal(t, pushed, stored)
+		assert.Equal(t, manifest.GuessMIMEType(pushed), mimeType)
+		_, _, ok = s.Manifest("ns/repo", digest.FromBytes(pushed).String())
+		assert.True(t, ok)
+
+		destDir := t.TempDir()
+		destRef, err := directory.NewReference(destDir)
+		require.NoError(t, err)
+		pulled, err := copyImage(t, sys, destRef, dockerRef(t, s, "ns/repo:tag"), nil)
+		require.NoError(t, err)
+		assert.Equal(t, pushed, pulled)
+
+		tags, err := docker.GetRepositoryTags(context.Background(), sys, dockerRef(t, s, "ns/repo:tag"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tag"}, tags)
+	}
+
+	// Invalid credentials
+	s := NewServer(&Options{Auth: TokenAuth, Username: "user", Password: "pass"})
+	defer s.Close()
+	sys := newSystemContext(t, s)
+	sys.DockerAuthConfig.Password = "wrong"
+	_, err := copyImage(t, sys, dockerRef(t, s, "ns/repo:tag"), src, nil)
+	assert.Error(t, err)
+	assert.Empty(t, s.Tags("ns/repo"))
+}
+
+func TestServerCrossRepoMount(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	sys := newSystemContext(t, s)
+
+	pushed, err := copyImage(t, sys, dockerRef(t, s, "a/repo:tag"), createSourceImage(t), nil)
+	require.NoError(t, err)
+	m, err := manifest.FromBlob(pushed, manifest.GuessMIMEType(pushed))
+	require.NoError(t, err)
+	layer := m.LayerInfos()[0].Digest
+
+	_, err = copyImage(t, sys, dockerRef(t, s, "b/repo:tag"), dockerRef(t, s, "a/repo:tag"), nil)
+	require.NoError(t, err)
+	mounted := false
+	for _, r := range s.Requests() {
+		if r.Method == http.MethodPost && r.Path == "/v2/b/repo/blobs/uploads/" &&
+			r.Query.Get("mount") == layer.String() && r.Query.Get("from") == "a/repo" {
+			assert.Equal(t, http.StatusCreated, r.StatusCode)
+			mounted = true
+		}
+	}
+	assert.True(t, mounted)
+	_, ok := s.Blob("b/repo", layer)
+	assert.True(t, ok)
+}
+
+func TestServerFaults(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	sys := newSystemContext(t, s)
+	pushed, err := copyImage(t, sys, dockerRef(t, s, "repo:tag"), createSourceImage(t), nil)
+	require.NoError(t, err)
+	m, err := manifest.FromBlob(pushed, manifest.GuessMIMEType(pushed))
+	require.NoError(t, err)
+	layerPath := "/v2/repo/blobs/" + m.LayerInfos()[0].Digest.String()
+
+	pull := func() error {
+		destRef, err := directory.NewReference(t.TempDir())
+		require.NoError(t, err)
+		_, err = copyImage(t, sys, destRef, dockerRef(t, s, "repo:tag"), nil)
+		return err
+	}
+
+	// 429 responses are retried
+	s.SetFaultInjector(InjectFirst(1, MatchRequest(http.MethodGet, `/manifests/`),
+		Fault{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second}))
+	err = pull()
+	require.NoError(t, err)
+	assert.Equal(t, 1, countRequests(s, http.MethodGet, "/v2/repo/manifests/tag", http.StatusTooManyRequests))
+
+	// A connection reset in the middle of a blob is resumed
+	s.SetFaultInjector(InjectFirst(1, MatchRequest(http.MethodGet, "^"+layerPath+"$"),
+		Fault{ResetConnection: true, ResetAfterBytes: 100 * 1024}))
+	err = pull()
+	require.NoError(t, err)
+	assert.Equal(t, 1, countRequests(s, http.MethodGet, layerPath, http.StatusPartialContent))
+
+	// Other failures are reported
+	s.SetFaultInjector(InjectFirst(1, MatchRequest(http.MethodGet, "^"+layerPath+"$"),
+		Fault{StatusCode: http.StatusInternalServerError}))
+	err = pull()
+	assert.Error(t, err)
+	s.SetFaultInjector(nil)
+	err = pull()
+	assert.NoError(t, err)
+}
+
+func TestServerReferrers(t *testing.T) {
+	for _, disableReferrersAPI := range []bool{false, true} {
+		s := NewServer(&Options{DisableReferrersAPI: disableReferrersAPI})
+		defer s.Close()
+		sys := newSystemContext(t, s)
+
+		sbom := []byte(`{"spdxVersion":"SPDX-2.3"}`)
+		pushed, err := copyImage(t, sys, dockerRef(t, s, "repo:tag"), createSourceImage(t), &copy.Options{
+			SBOM:          sbom,
+			SBOMMediaType: copy.SBOMMediaTypeSPDXJSON,
+		})
+		require.NoError(t, err)
+		subject := digest.FromBytes(pushed)
+
+		referrers := s.Referrers("repo", subject, "")
+		require.Len(t, referrers, 1)
+		assert.Equal(t, imgspecv1.MediaTypeImageManifest, referrers[0].MediaType)
+		assert.Equal(t, copy.SBOMMediaTypeSPDXJSON, referrers[0].ArtifactType)
+		assert.Len(t, s.Referrers("repo", subject, copy.SBOMMediaTypeSPDXJSON), 1)
+		assert.Len(t, s.Referrers("repo", subject, "application/x-other"), 0)
+
+		res, err := s.server.Client().Get(s.server.URL + "/v2/repo/referrers/" + subject.String())
+		require.NoError(t, err)
+		defer res.Body.Close()
+		if disableReferrersAPI {
+			assert.Equal(t, http.StatusNotFound, res.StatusCode)
+			continue
+		}
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, imgspecv1.MediaTypeImageIndex, res.Header.Get("Content-Type"))
+		var index imgspecv1.Index
+		err = json.NewDecoder(res.Body).Decode(&index)
+		require.NoError(t, err)
+		assert.Equal(t, referrers, index.Manifests)
+	}
+}
+
+func TestServerReferrersPagination(t *testing.T) {
+	s := NewServer(&Options{ReferrersPageSize: 2})
+	defer s.Close()
+	subject := digest.FromString("subject")
+	for i := 0; i < 5; i++ {
+		s.PutManifest("repo", "", imgspecv1.MediaTypeImageManifest, []byte(fmt.Sprintf(
+			`{"schemaVersion":2,"mediaType":"%s","artifactType":"application/x-test","config":{},"subject":{"digest":"%s"},"annotations":{"i":"%d"}}`,
+			imgspecv1.MediaTypeImageManifest, subject, i)))
+	}
+
+	referrers := []imgspecv1.Descriptor{}
+	pages := 0
+	path := "/v2/repo/referrers/" + subject.String() + "?artifactType=application%2Fx-test"
+	for path != "" {
+		res, err := s.server.Client().Get(s.server.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var index imgspecv1.Index
+		err = json.NewDecoder(res.Body).Decode(&index)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(index.Manifests), 2)
+		referrers = append(referrers, index.Manifests...)
+		pages++
+		path = ""
+		if link := res.Header.Get("Link"); link != "" {
+			path = link[1 : len(link)-len(`>; rel="next"`)]
+		}
+	}
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, s.Referrers("repo", subject, "application/x-test"), referrers)
+}
+
+func TestServerTagListPagination(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	for _, tag := range []string{"c", "a", "d", "b"} {
+		s.PutManifest("repo", tag, imgspecv1.MediaTypeImageManifest, []byte(`{"schemaVersion":2}`))
+	}
+
+	tags := []string{}
+	path := "/v2/repo/tags/list?n=3"
+	for path != "" {
+		res, err := s.server.Client().Get(s.server.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&list)
+		require.NoError(t, err)
+		tags = append(tags, list.Tags...)
+		path = ""
+		if link := res.Header.Get("Link"); link != "" {
+			path = link[1 : len(link)-len(`>; rel="next"`)]
+		}
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d"}, tags)
+
+	res, err := s.server.Client().Get(s.server.URL + "/v2/unknown/tags/list")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
@@ -1,6 +1,7 @@
 package sysregistriesv2
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/containers/image/v5/docker/reference"
@@ -46,6 +48,14 @@ const (
 	MirrorByTagOnly = "tag-only"
 )
 
+const (
+	// configuration values for "pull-source-policy"
+	// mirrors will be tried in the order they are configured
+	PullSourcesByPriority = "priority"
+	// mirrors will be tried in the order of increasing latency, measured by a quick request to each of them
+	PullSourcesByLatency = "latency"
+)
+
 // Endpoint describes a remote location of a registry.
 type Endpoint struct {
 	// The endpoint's remote location. Can be empty iff Prefix contains
@@ -68,6 +78,12 @@ type Endpoint struct {
 	// This can only be set in a registry's Mirror field, not in the registry's primary Endpoint.
 	// This per-mirror setting is allowed only when mirror-by-digest-only is not configured for the primary registry.
 	PullFromMirror string `toml:"pull-from-mirror,omitempty"`
+	// Credentials, if set, is the key of the credentials to use when pulling through this mirror, in the format
+	// used by credential stores and `podman login` ("registry[:port][/namespace…]"), e.g. to use credentials
+	// of a different account than the one stored for the mirror location.
+	// If not set, the credentials stored for the mirror location are used, as for any other registry.
+	// This can only be set in a registry's Mirror field, not in the registry's primary Endpoint.
+	Credentials string `toml:"credentials,omitempty"`
 }
 
 // userRegistriesFile is the path to the per user registry configuration file.
@@ -132,6 +148,16 @@ type Registry struct {
 	// tag can potentially yield different images, depending on which endpoint
 	// we pull from.  Restricting mirrors to pulls by digest avoids that issue.
 	MirrorByDigestOnly bool `toml:"mirror-by-digest-only,omitempty"`
+	// PullSourcePolicy determines the order in which mirrors are tried; set to "priority" or "latency".
+	// Default is "priority" (or left empty), mirrors are tried in the order they are configured.
+	// With "latency", mirrors are tried in the order of increasing latency; please refer to OrderPullSourcesByLatency.
+	// In either case, the primary location is tried last.
+	PullSourcePolicy string `toml:"pull-source-policy,omitempty"`
+	// If true, the primary location is tried after the mirrors even if pull-from-mirrors-only is set in the configuration.
+	FallbackToPrimary bool `toml:"fallback-to-primary,omitempty"`
+
+	// pullFromMirrorsOnly is the value of V2RegistriesConf.PullFromMirrorsOnly in the configuration r was loaded from.
+	pullFromMirrorsOnly bool
 }
 
 // PullSource consists of an Endpoint and a Reference. Note that the reference is
@@ -139,10 +165,14 @@ type Registry struct {
 type PullSource struct {
 	Endpoint  Endpoint
 	Reference reference.Named
+
+	primary bool // The source is the primary location of the registry, not a mirror
 }
 
 // PullSourcesFromReference returns a slice of PullSource's based on the passed
 // reference.
+// The primary location is the last element, unless pulling from it is disabled by pull-from-mirrors-only
+// (and not re-enabled by r.FallbackToPrimary); in that case, it fails if no mirror can be used for ref.
 func (r *Registry) PullSourcesFromReference(ref reference.Named) ([]PullSource, error) {
 	var endpoints []Endpoint
 	_, isDigested := ref.(reference.Canonical)
@@ -167,20 +197,106 @@ func (r *Registry) PullSourcesFromReference(ref reference.Named) ([]PullSource,
 			endpoints = append(endpoints, mirror)
 		}
 	}
-	endpoints = append(endpoints, r.Endpoint)
+	usePrimary := !r.pullFromMirrorsOnly || r.FallbackToPrimary || len(r.Mirrors) == 0
+	if usePrimary {
+		endpoints = append(endpoints, r.Endpoint)
+	} else if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no mirror of registry %q can be used to pull %q, and pulling from the primary location is disabled by pull-from-mirrors-only",
+			r.Prefix, ref.String())
+	}
 
 	sources := []PullSource{}
-	for _, ep := range endpoints {
+	for i, ep := range endpoints {
 		rewritten, err := ep.rewriteReference(ref, r.Prefix)
 		if err != nil {
 			return nil, err
 		}
-		sources = append(sources, PullSource{Endpoint: ep, Reference: rewritten})
+		sources = append(sources, PullSource{Endpoint: ep, Reference: rewritten, primary: usePrimary && i == len(endpoints)-1})
 	}
 
 	return sources, nil
 }
 
+// PrimaryPullSource returns the PullSource for pulling ref from the primary location of r,
+// even if PullSourcesFromReference would not include it (e.g. because of pull-from-mirrors-only).
+func (r *Registry) PrimaryPullSource(ref reference.Named) (PullSource, error) {
+	rewritten, err := r.Endpoint.rewriteReference(ref, r.Prefix)
+	if err != nil {
+		return PullSource{}, err
+	}
+	return PullSource{Endpoint: r.Endpoint, Reference: rewritten, primary: true}, nil
+}
+
+// IsPrimary returns true if the source is the primary location of the registry, not a mirror.
+func (s PullSource) IsPrimary() bool {
+	return s.primary
+}
+
+// EffectivePullSourcePolicy returns the pull source policy to use for r, one of PullSourcesByPriority and PullSourcesByLatency,
+// taking into account an override in sys.
+func (r *Registry) EffectivePullSourcePolicy(sys *types.SystemContext) (string, error) {
+	policy := r.PullSourcePolicy
+	if sys != nil && sys.PullSourcePolicy != "" {
+		policy = sys.PullSourcePolicy
+	}
+	switch policy {
+	case "":
+		return PullSourcesByPriority, nil
+	case PullSourcesByPriority, PullSourcesByLatency:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unsupported pull-source-policy value %q", policy)
+	}
+}
+
+// OrderPullSourcesByLatency returns sources, as returned by PullSourcesFromReference, with the mirrors ordered by increasing
+// latency as reported by probe, which is called concurrently for all mirrors.
+// Mirrors for which probe fails are ordered after all others, in their original order; the primary location,
+// if it is included in sources, always stays last.
+// If there are fewer than two mirrors, sources is returned unchanged without calling probe.
+func OrderPullSourcesByLatency(ctx context.Context, sources []PullSource, probe func(ctx context.Context, source PullSource) (time.Duration, error)) []PullSource {
+	numMirrors := len(sources)
+	if numMirrors > 0 && sources[numMirrors-1].primary {
+		numMirrors--
+	}
+	if numMirrors < 2 {
+		return sources
+	}
+	type probeResult struct {
+		source  PullSource
+		latency time.Duration
+		err     error
+	}
+	mirrors := make([]probeResult, numMirrors)
+	wg := sync.WaitGroup{}
+	for i := range mirrors {
+		mirrors[i].source = sources[i]
+		wg.Add(1)
+		go func(res *probeResult) {
+			defer wg.Done()
+			res.latency, res.err = probe(ctx, res.source)
+		}(&mirrors[i])
+	}
+	wg.Wait()
+	sort.SliceStable(mirrors, func(i, j int) bool {
+		if (mirrors[i].err == nil) != (mirrors[j].err == nil) {
+			return mirrors[i].err == nil
+		}
+		return mirrors[i].err == nil && mirrors[i].latency < mirrors[j].latency
+	})
+
+	res := make([]PullSource, 0, len(sources))
+	for _, m := range mirrors {
+		if m.err != nil {
+			logrus.Debugf("Probing mirror %q failed: %v", m.source.Endpoint.Location, m.err)
+		} else {
+			logrus.Debugf("Mirror %q latency: %v", m.source.Endpoint.Location, m.latency)
+		}
+		res = append(res, m.source)
+	}
+	return append(res, sources[numMirrors:]...)
+}
+
 // V1TOMLregistries is for backwards compatibility to sysregistries v1
 type V1TOMLregistries struct {
 	Registries []string `toml:"registries"`
@@ -247,6 +363,11 @@ type V2RegistriesConf struct {
 	// potentially use all unqualified-search registries
 	ShortNameMode string `toml:"short-name-mode"`
 
+	// PullFromMirrorsOnly, if set to true, disables pulling from the primary location of registries which have mirrors;
+	// only the mirrors are used, and pulls fail if none of them can be used.  Registries can override this
+	// using fallback-to-primary.  A nil value means the setting is inherited from previously loaded configuration files.
+	PullFromMirrorsOnly *bool `toml:"pull-from-mirrors-only,omitempty"`
+
 	shortNameAliasConf
 
 	// If you add any field, make sure to update Nonempty() below.
@@ -422,6 +543,12 @@ func (config *V2RegistriesConf) postProcessRegistries() error {
 		if reg.PullFromMirror != "" {
 			return fmt.Errorf("pull-from-mirror must not be set for a non-mirror registry %q", reg.Prefix)
 		}
+		if reg.Credentials != "" {
+			return fmt.Errorf("credentials must not be set for a non-mirror registry %q", reg.Prefix)
+		}
+		if reg.PullSourcePolicy != "" && reg.PullSourcePolicy != PullSourcesByPriority && reg.PullSourcePolicy != PullSourcesByLatency {
+			return &InvalidRegistries{s: fmt.Sprintf("unsupported pull-source-policy value %q for registry %q", reg.PullSourcePolicy, reg.Prefix)}
+		}
 		// make sure mirrors are valid
 		for _, mir := range reg.Mirrors {
 			mir.Location, err = parseLocation(mir.Location)
@@ -443,6 +570,10 @@ func (config *V2RegistriesConf) postProcessRegistries() error {
 				mir.PullFromMirror != MirrorByDigestOnly && mir.PullFromMirror != MirrorByTagOnly {
 				return &InvalidRegistries{s: fmt.Sprintf("unsupported pull-from-mirror value %q for mirror %q", mir.PullFromMirror, mir.Location)}
 			}
+			if strings.HasPrefix(mir.Credentials, "http://") || strings.HasPrefix(mir.Credentials, "https://") ||
+				strings.ContainsRune(mir.Credentials, '@') {
+				return &InvalidRegistries{s: fmt.Sprintf("invalid credentials %q for mirror %q", mir.Credentials, mir.Location)}
+			}
 		}
 		if reg.Location == "" {
 			regMap[reg.Prefix] = append(regMap[reg.Prefix], reg)
@@ -751,6 +882,12 @@ func tryUpdatingCache(ctx *types.SystemContext, wrapper configWrapper) (*parsedC
 		config.partialV2.CredentialHelpers = []string{AuthenticationFileHelper}
 	}
 
+	if config.partialV2.PullFromMirrorsOnly != nil {
+		for i := range config.partialV2.Registries {
+			config.partialV2.Registries[i].pullFromMirrorsOnly = *config.partialV2.PullFromMirrorsOnly
+		}
+	}
+
 	// populate the cache
 	configCache[wrapper] = config
 	return config, nil
@@ -1044,6 +1181,11 @@ func (c *parsedConfig) updateWithConfigurationFrom(updates *parsedConfig) {
 		c.partialV2.CredentialHelpers = updates.partialV2.CredentialHelpers
 	}
 
+	// == Merge PullFromMirrorsOnly:
+	if updates.partialV2.PullFromMirrorsOnly != nil {
+		c.partialV2.PullFromMirrorsOnly = updates.partialV2.PullFromMirrorsOnly
+	}
+
 	// == Merge shortNameMode:
 	// We don’t maintain c.partialV2.ShortNameMode.
 	if updates.shortNameMode != types.ShortNameModeInvalid {
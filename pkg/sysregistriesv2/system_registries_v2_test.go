@@ -1,15 +1,24 @@
 package sysregistriesv2
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/maps"
 )
 
 var v1RegistriesConfEmptyTestData = []struct {
@@ -146,6 +155,260 @@ func TestMirrors(t *testing.T) {
 	assert.True(t, reg.Mirrors[1].Insecure)
 }
 
+func TestMirrorCredentials(t *testing.T) {
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    "testdata/mirror-credentials.conf",
+		SystemRegistriesConfDirPath: "testdata/this-does-not-exist",
+	}
+
+	reg, err := FindRegistry(sys, "registry.com/image:tag")
+	require.NoError(t, err)
+	require.NotNil(t, reg)
+	assert.Equal(t, "", reg.Credentials)
+	require.Len(t, reg.Mirrors, 2)
+	assert.Equal(t, "mirror-1.registry.com/pull-through", reg.Mirrors[0].Credentials)
+	assert.Equal(t, "", reg.Mirrors[1].Credentials)
+
+	// The field is available in pull sources
+	pullSources, err := reg.PullSourcesFromReference(toNamedRef(t, "registry.com/image:tag"))
+	require.NoError(t, err)
+	require.Len(t, pullSources, 3)
+	assert.Equal(t, []string{"mirror-1.registry.com/pull-through", "", ""},
+		[]string{pullSources[0].Endpoint.Credentials, pullSources[1].Endpoint.Credentials, pullSources[2].Endpoint.Credentials})
+
+	// Round trip through TOML
+	var config V2RegistriesConf
+	_, err = toml.DecodeFile("testdata/mirror-credentials.conf", &config)
+	require.NoError(t, err)
+	buf := bytes.Buffer{}
+	err = toml.NewEncoder(&buf).Encode(config)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `credentials = "mirror-1.registry.com/pull-through"`)
+	assert.Equal(t, 1, strings.Count(buf.String(), "credentials")) // Unset values are omitted
+	var decoded V2RegistriesConf
+	_, err = toml.Decode(buf.String(), &decoded)
+	require.NoError(t, err)
+	assert.Equal(t, config, decoded)
+}
+
+func TestPullSourcePolicy(t *testing.T) {
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    "testdata/pull-source-policy.conf",
+		SystemRegistriesConfDirPath: "testdata/this-does-not-exist",
+	}
+	for _, c := range []struct {
+		registry, override, expected string
+	}{
+		{"registry.com", "", PullSourcesByLatency},
+		{"other.registry.com", "", PullSourcesByPriority},
+		{"registry.com", PullSourcesByPriority, PullSourcesByPriority},
+		{"other.registry.com", PullSourcesByLatency, PullSourcesByLatency},
+		{"registry.com", "invalid", ""},
+	} {
+		reg, err := FindRegistry(sys, c.registry+"/image:tag")
+		require.NoError(t, err)
+		require.NotNil(t, reg)
+		policy, err := reg.EffectivePullSourcePolicy(&types.SystemContext{PullSourcePolicy: c.override})
+		if c.expected == "" {
+			assert.Error(t, err, c.override)
+		} else {
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, policy, c.registry, c.override)
+		}
+	}
+	reg, err := FindRegistry(sys, "registry.com/image:tag")
+	require.NoError(t, err)
+	policy, err := reg.EffectivePullSourcePolicy(nil)
+	require.NoError(t, err)
+	assert.Equal(t, PullSourcesByLatency, policy)
+
+	_, err = GetRegistries(&types.SystemContext{
+		SystemRegistriesConfPath:    "testdata/invalid-pull-source-policy.conf",
+		SystemRegistriesConfDirPath: "testdata/this-does-not-exist",
+	})
+	assert.ErrorContains(t, err, fmt.Sprintf("unsupported pull-source-policy value %q for registry %q", "random", "registry-a.com"))
+}
+
+func TestOrderPullSourcesByLatency(t *testing.T) {
+	ref := toNamedRef(t, "registry.com/image:tag")
+	reg := Registry{
+		Prefix:   "registry.com",
+		Endpoint: Endpoint{Location: "registry.com"},
+	}
+	for _, c := range []struct {
+		latencies map[string]time.Duration // -1 for a failure
+		expected  []string
+	}{
+		{ // No mirrors
+			map[string]time.Duration{},
+			[]string{"registry.com"},
+		},
+		{ // A single mirror is not probed
+			map[string]time.Duration{"m1.com": -1},
+			[]string{"m1.com", "registry.com"},
+		},
+		{
+			map[string]time.Duration{"m1.com": 30 * time.Millisecond, "m2.com": 10 * time.Millisecond, "m3.com": 20 * time.Millisecond},
+			[]string{"m2.com", "m3.com", "m1.com", "registry.com"},
+		},
+		{ // Failed mirrors are last, in their original order
+			map[string]time.Duration{"m1.com": -1, "m2.com": 10 * time.Millisecond, "m3.com": -1, "m4.com": 5 * time.Millisecond},
+			[]string{"m4.com", "m2.com", "m1.com", "m3.com", "registry.com"},
+		},
+		{ // Equal latencies preserve the original order
+			map[string]time.Duration{"m1.com": time.Millisecond, "m2.com": time.Millisecond},
+			[]string{"m1.com", "m2.com", "registry.com"},
+		},
+	} {
+		mirrors := maps.Keys(c.latencies)
+		sort.Strings(mirrors)
+		reg.Mirrors = nil
+		for _, m := range mirrors {
+			reg.Mirrors = append(reg.Mirrors, Endpoint{Location: m})
+		}
+		sources, err := reg.PullSourcesFromReference(ref)
+		require.NoError(t, err)
+
+		var mutex sync.Mutex
+		probed := []string{}
+		ordered := OrderPullSourcesByLatency(context.Background(), sources, func(ctx context.Context, source PullSource) (time.Duration, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			probed = append(probed, source.Endpoint.Location)
+			latency := c.latencies[source.Endpoint.Location]
+			if latency == -1 {
+				return -1, errors.New("probe failed")
+			}
+			return latency, nil
+		})
+		res := []string{}
+		for _, s := range ordered {
+			res = append(res, s.Endpoint.Location)
+			assert.Equal(t, s.Endpoint.Location+"/image:tag", s.Reference.String())
+		}
+		assert.Equal(t, c.expected, res)
+		if len(mirrors) < 2 {
+			assert.Empty(t, probed)
+		} else {
+			assert.ElementsMatch(t, mirrors, probed) // The primary location is not probed
+		}
+	}
+}
+
+func TestPullFromMirrorsOnly(t *testing.T) {
+	pullSourceLocations := func(t *testing.T, sys *types.SystemContext, ref string) ([]string, error) {
+		reg, err := FindRegistry(sys, ref)
+		require.NoError(t, err)
+		require.NotNil(t, reg)
+		sources, err := reg.PullSourcesFromReference(toNamedRef(t, ref))
+		if err != nil {
+			return nil, err
+		}
+		res := []string{}
+		for _, s := range sources {
+			res = append(res, s.Endpoint.Location)
+		}
+		return res, nil
+	}
+	const digestSuffix = "@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    "testdata/pull-from-mirrors-only.conf",
+		SystemRegistriesConfDirPath: "testdata/this-does-not-exist",
+	}
+	for _, c := range []struct {
+		ref      string
+		expected []string // nil if an error is expected
+	}{
+		// The primary location is excluded
+		{"registry.com/image:tag", []string{"mirror-1.registry.com", "mirror-2.registry.com"}},
+		// The primary location is tried last with fallback-to-primary
+		{"fallback.registry.com/image:tag", []string{"mirror.fallback.registry.com", "fallback.registry.com"}},
+		// Registries without mirrors are not affected
+		{"no-mirrors.registry.com/image:tag", []string{"no-mirrors.registry.com"}},
+		// Pulls which can't use any mirror fail instead of falling back to the primary location
+		{"digest-only.registry.com/image" + digestSuffix, []string{"mirror.digest-only.registry.com"}},
+		{"digest-only.registry.com/image:tag", nil},
+	} {
+		res, err := pullSourceLocations(t, sys, c.ref)
+		if c.expected == nil {
+			assert.ErrorContains(t, err, "pull-from-mirrors-only", c.ref)
+		} else {
+			require.NoError(t, err, c.ref)
+			assert.Equal(t, c.expected, res, c.ref)
+		}
+	}
+
+	// A drop-in can disable the option again
+	sys = &types.SystemContext{
+		SystemRegistriesConfPath:    "testdata/pull-from-mirrors-only.conf",
+		SystemRegistriesConfDirPath: "testdata/pull-from-mirrors-only.conf.d",
+	}
+	res, err := pullSourceLocations(t, sys, "registry.com/image:tag")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mirror-1.registry.com", "mirror-2.registry.com", "registry.com"}, res)
+	res, err = pullSourceLocations(t, sys, "digest-only.registry.com/image:tag")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"digest-only.registry.com"}, res)
+
+	// Without a primary location, all sources are mirrors ordered by latency
+	sys = &types.SystemContext{
+		SystemRegistriesConfPath:    "testdata/pull-from-mirrors-only.conf",
+		SystemRegistriesConfDirPath: "testdata/this-does-not-exist",
+	}
+	reg, err := FindRegistry(sys, "registry.com/image:tag")
+	require.NoError(t, err)
+	sources, err := reg.PullSourcesFromReference(toNamedRef(t, "registry.com/image:tag"))
+	require.NoError(t, err)
+	ordered := OrderPullSourcesByLatency(context.Background(), sources, func(ctx context.Context, source PullSource) (time.Duration, error) {
+		if source.Endpoint.Location == "mirror-1.registry.com" {
+			return 20 * time.Millisecond, nil
+		}
+		return 10 * time.Millisecond, nil
+	})
+	require.Len(t, ordered, 2)
+	assert.Equal(t, "mirror-2.registry.com", ordered[0].Endpoint.Location)
+	assert.Equal(t, "mirror-1.registry.com", ordered[1].Endpoint.Location)
+}
+
+func TestPrimaryPullSource(t *testing.T) {
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    "testdata/pull-from-mirrors-only.conf",
+		SystemRegistriesConfDirPath: "testdata/this-does-not-exist",
+	}
+	for _, c := range []struct{ ref, expectedLocation string }{
+		{"registry.com/image:tag", "registry.com"}, // Excluded from PullSourcesFromReference
+		{"fallback.registry.com/image:tag", "fallback.registry.com"},
+		{"no-mirrors.registry.com/image:tag", "no-mirrors.registry.com"},
+	} {
+		reg, err := FindRegistry(sys, c.ref)
+		require.NoError(t, err)
+		require.NotNil(t, reg)
+		primary, err := reg.PrimaryPullSource(toNamedRef(t, c.ref))
+		require.NoError(t, err, c.ref)
+		assert.Equal(t, c.expectedLocation, primary.Endpoint.Location, c.ref)
+		assert.Equal(t, c.ref, primary.Reference.String(), c.ref)
+		assert.True(t, primary.IsPrimary(), c.ref)
+
+		sources, err := reg.PullSourcesFromReference(toNamedRef(t, c.ref))
+		require.NoError(t, err, c.ref)
+		for i, s := range sources {
+			assert.Equal(t, s.Endpoint.Location == c.expectedLocation, s.IsPrimary(), "%s source %d", c.ref, i)
+		}
+	}
+
+	// The primary reference is rewritten according to the location
+	registry := Registry{
+		Prefix:   "example.com/foo",
+		Endpoint: Endpoint{Location: "primary.example.com/bar"},
+		Mirrors:  []Endpoint{{Location: "mirror.example.com/baz"}},
+	}
+	primary, err := registry.PrimaryPullSource(toNamedRef(t, "example.com/foo/image:tag"))
+	require.NoError(t, err)
+	assert.Equal(t, "primary.example.com/bar/image:tag", primary.Reference.String())
+	assert.True(t, primary.IsPrimary())
+}
+
 func TestRefMatchingSubdomainPrefix(t *testing.T) {
 	for _, c := range []struct {
 		ref, prefix string
@@ -799,6 +1062,20 @@ func TestInvalidMirrorConfig(t *testing.T) {
 			},
 			expectErr: fmt.Sprintf("unsupported pull-from-mirror value %q for mirror %q", "notvalid", "mirror-1.registry-a.com"),
 		},
+		{
+			sys: &types.SystemContext{
+				SystemRegistriesConfPath:    "testdata/invalid-config-level-credentials.conf",
+				SystemRegistriesConfDirPath: "testdata/this-does-not-exist",
+			},
+			expectErr: fmt.Sprintf("credentials must not be set for a non-mirror registry %q", "registry-a.com/foo"),
+		},
+		{
+			sys: &types.SystemContext{
+				SystemRegistriesConfPath:    "testdata/invalid-value-credentials.conf",
+				SystemRegistriesConfDirPath: "testdata/this-does-not-exist",
+			},
+			expectErr: fmt.Sprintf("invalid credentials %q for mirror %q", "https://mirror-1.registry-a.com", "mirror-1.registry-a.com"),
+		},
 	} {
 		_, err := GetRegistries(tc.sys)
 		assert.ErrorContains(t, err, tc.expectErr)
@@ -0,0 +1,224 @@
+// Package conformance contains test vectors for policy evaluation by the signature package,
+// and a runner which evaluates them using this library.
+//
+// The vectors are intended to allow other implementations of policy evaluation to verify that they make the same
+// decisions as this library; each vector is a self-contained JSON file in the vectors subdirectory of this package,
+// which can be consumed without using Go.
+// The vectors are tested against this library, so they always describe its current behavior.
+package conformance
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/imagesource/impl"
+	"github.com/containers/image/v5/internal/imagesource/stubs"
+	internalsig "github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// FormatVersion is the version of the vector format described by Vector.
+// It is incremented on any change to the format which is not backward-compatible.
+const FormatVersion = 1
+
+// Vector is a single test vector: a policy, an image, and the decision this library makes about the image.
+type Vector struct {
+	Version     int             `json:"version"`     // Always FormatVersion
+	Description string          `json:"description"` // A human-readable description of the case
+	Policy      json.RawMessage `json:"policy"`      // The policy, in the format of policy.json; it does not refer to any files
+	Image       Image           `json:"image"`
+	Expected    Decision        `json:"expected"`
+}
+
+// Image is the image evaluated by a Vector.
+type Image struct {
+	// DockerReference is the identity of the image, which is evaluated as a reference in the docker transport;
+	// it always contains a tag or a digest.
+	DockerReference string `json:"dockerReference"`
+	Manifest        []byte `json:"manifest"` // The manifest of the image (base64-encoded in JSON)
+	// Signatures are the signatures of the image (each base64-encoded in JSON).
+	// A simple signing signature is stored as is; other signatures start with a zero byte and a format identifier,
+	// as in the signature-N files of the dir transport (e.g. "\x00sigstore-json" followed by a JSON object).
+	Signatures [][]byte `json:"signatures"`
+}
+
+// Decision is the outcome of evaluating a Vector.
+type Decision struct {
+	Allowed bool `json:"allowed"`
+	// Reason is the signature.PRReason of the first policy requirement which rejected the image,
+	// or "" if the image is allowed, or if it is rejected for an unspecified reason
+	// (e.g. because evaluation failed, or the image was rejected by an error other than signature.PolicyRequirementError).
+	Reason signature.PRReason `json:"reason,omitempty"`
+}
+
+// vectorsDir is the directory of vectorFiles containing the vectors.
+const vectorsDir = "vectors"
+
+//go:embed vectors
+var vectorFiles embed.FS
+
+// Vectors returns all test vectors shipped with this package, indexed by file name.
+func Vectors() (map[string]Vector, error) {
+	entries, err := fs.ReadDir(vectorFiles, vectorsDir)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]Vector{}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".json" {
+			continue
+		}
+		data, err := fs.ReadFile(vectorFiles, path.Join(vectorsDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		v, err := ParseVector(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", e.Name(), err)
+		}
+		res[e.Name()] = v
+	}
+	return res, nil
+}
+
+// ParseVector parses a test vector in the JSON format.
+func ParseVector(data []byte) (Vector, error) {
+	var v Vector
+	if err := json.Unmarshal(data, &v); err != nil {
+		return Vector{}, err
+	}
+	if v.Version != FormatVersion {
+		return Vector{}, fmt.Errorf("unsupported vector format version %d", v.Version)
+	}
+	return v, nil
+}
+
+// Evaluate returns the decision of this library about v.Image, using v.Policy.
+// It returns an error only if v can not be evaluated at all, e.g. because v.Policy is invalid.
+func Evaluate(ctx context.Context, v Vector) (Decision, error) {
+	policy, err := signature.NewPolicyFromBytes(v.Policy)
+	if err != nil {
+		return Decision{}, fmt.Errorf("parsing policy: %w", err)
+	}
+	pc, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		return Decision{}, err
+	}
+	defer func() {
+		_ = pc.Destroy()
+	}()
+
+	src, err := newImageSource(v.Image)
+	if err != nil {
+		return Decision{}, err
+	}
+	allowed, err := pc.IsRunningImageAllowed(ctx, image.UnparsedInstance(src, nil))
+	if allowed && err == nil {
+		return Decision{Allowed: true}, nil
+	}
+	res := Decision{Allowed: false}
+	var prErr signature.PolicyRequirementError
+	if errors.As(err, &prErr) {
+		res.Reason = prErr.Reason
+	}
+	return res, nil
+}
+
+// Run evaluates v using this library, and returns an error if the decision does not match v.Expected.
+func Run(ctx context.Context, v Vector) error {
+	decision, err := Evaluate(ctx, v)
+	if err != nil {
+		return err
+	}
+	if decision != v.Expected {
+		return fmt.Errorf("unexpected decision %+v, expected %+v", decision, v.Expected)
+	}
+	return nil
+}
+
+// imageSource is a private.ImageSource for an Image.
+type imageSource struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	impl.DoesNotAffectLayerInfosForCopy
+	stubs.NoGetBlobAtInitialize
+
+	ref        types.ImageReference
+	manifest   []byte
+	signatures []internalsig.Signature
+}
+
+// newImageSource returns an imageSource for img.
+func newImageSource(img Image) (*imageSource, error) {
+	named, err := reference.ParseNormalizedNamed(img.DockerReference)
+	if err != nil {
+		return nil, fmt.Errorf("parsing image reference %q: %w", img.DockerReference, err)
+	}
+	ref, err := docker.NewReference(named)
+	if err != nil {
+		return nil, fmt.Errorf("parsing image reference %q: %w", img.DockerReference, err)
+	}
+	sigs := []internalsig.Signature{}
+	for i, blob := range img.Signatures {
+		sig, err := internalsig.FromBlob(blob)
+		if err != nil {
+			return nil, fmt.Errorf("parsing signature %d: %w", i, err)
+		}
+		sigs = append(sigs, sig)
+	}
+	s := &imageSource{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			HasThreadSafeGetBlob: true,
+		}),
+		NoGetBlobAtInitialize: stubs.NoGetBlobAt(ref),
+
+		ref:        ref,
+		manifest:   img.Manifest,
+		signatures: sigs,
+	}
+	s.Compat = impl.AddCompat(s)
+	return s, nil
+}
+
+// Reference returns the reference used to set up this source.
+func (s *imageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *imageSource) Close() error {
+	return nil
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+func (s *imageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if instanceDigest != nil {
+		return nil, "", errors.New("manifest lists are not supported in test vectors")
+	}
+	return s.manifest, manifest.GuessMIMEType(s.manifest), nil
+}
+
+// GetBlob always fails; test vectors don’t contain any blobs.
+func (s *imageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	return nil, -1, fmt.Errorf("blob %s is not available in test vectors", info.Digest)
+}
+
+// GetSignaturesWithFormat returns the image's signatures.
+func (s *imageSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]internalsig.Signature, error) {
+	if instanceDigest != nil {
+		return nil, errors.New("manifest lists are not supported in test vectors")
+	}
+	return s.signatures, nil
+}
@@ -0,0 +1,521 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+var updateVectors = flag.Bool("update-vectors", false, "regenerate the files in the vectors directory")
+
+// fixturesDir is the directory containing the fixtures used by tests of the signature package.
+const fixturesDir = "../fixtures"
+
+// vectorCase describes a test vector to generate from fixturesDir.
+type vectorCase struct {
+	name            string // The file name, without the .json suffix; it must start with the type of the requirement it tests
+	description     string
+	requirements    []signature.PolicyRequirement // The default policy, if scopes is nil
+	scopes          signature.PolicyTransportScopes
+	dir             string // A dir: image in fixturesDir
+	dockerReference string
+	expected        Decision
+}
+
+// fixture returns the contents of fixturesDir/path.
+func fixture(t *testing.T, path string) []byte {
+	contents, err := os.ReadFile(filepath.Join(fixturesDir, path))
+	require.NoError(t, err)
+	return contents
+}
+
+// vectorCases returns the cases of all vectors. They are derived from the tests of the signature package,
+// notably TestPRSignedByIsRunningImageAllowed and TestPRSigstoreSignedIsRunningImageAllowed.
+func vectorCases(t *testing.T) []vectorCase {
+	x := func(pr signature.PolicyRequirement, err error) signature.PolicyRequirement {
+		require.NoError(t, err)
+		return pr
+	}
+	prmExactReference := func(ref string) signature.PolicyReferenceMatch {
+		prm, err := signature.NewPRMExactReference(ref)
+		require.NoError(t, err)
+		return prm
+	}
+	gpgKey := func(name string) signature.PolicyRequirement {
+		return x(signature.NewPRSignedByKeyData(signature.SBKeyTypeGPGKeys, fixture(t, name), signature.NewPRMMatchExact()))
+	}
+	// We prefer to test with a Cosign-created signature for interoperability, and that doesn’t work with matchExact.
+	prmCosign := signature.NewPRMMatchRepository()
+	const cosignImage = "192.168.64.2:5000/cosign-signed-single-sample:latest"
+	fulcio, err := signature.NewPRSigstoreSignedFulcio(
+		signature.PRSigstoreSignedFulcioWithCAData(fixture(t, "fulcio_v1.crt.pem")),
+		signature.PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"),
+		signature.PRSigstoreSignedFulcioWithSubjectEmail("mitr@redhat.com"),
+	)
+	require.NoError(t, err)
+
+	return []vectorCase{
+		{
+			name:            "insecureAcceptAnything",
+			description:     "insecureAcceptAnything allows an unsigned image",
+			requirements:    []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()},
+			dir:             "dir-img-unsigned",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: true},
+		},
+		{
+			name:            "reject",
+			description:     "reject rejects a signed image",
+			requirements:    []signature.PolicyRequirement{signature.NewPRReject()},
+			dir:             "dir-img-valid",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonRejected},
+		},
+		{
+			name:         "reject-scoped",
+			description:  "Requirements of the most specific scope are used instead of the default",
+			requirements: []signature.PolicyRequirement{signature.NewPRReject()},
+			scopes: signature.PolicyTransportScopes{
+				"docker.io/testing":                {signature.NewPRReject()},
+				"docker.io/testing/manifest":       {signature.NewPRInsecureAcceptAnything()},
+				"docker.io/testing/manifest:other": {signature.NewPRReject()},
+			},
+			dir:             "dir-img-unsigned",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: true},
+		},
+		{
+			name:            "signedBy-valid",
+			description:     "signedBy allows an image with a valid signature",
+			requirements:    []signature.PolicyRequirement{gpgKey("public-key.gpg")},
+			dir:             "dir-img-valid",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: true},
+		},
+		{
+			name:            "signedBy-unsigned",
+			description:     "signedBy rejects an unsigned image",
+			requirements:    []signature.PolicyRequirement{gpgKey("public-key.gpg")},
+			dir:             "dir-img-unsigned",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonNoSignatures},
+		},
+		{
+			name:            "signedBy-identity-mismatch",
+			description:     "signedBy with matchExact rejects a signature claiming a different tag",
+			requirements:    []signature.PolicyRequirement{gpgKey("public-key.gpg")},
+			dir:             "dir-img-valid",
+			dockerReference: "testing/manifest:notlatest",
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonIdentityMismatch},
+		},
+		{
+			name:            "signedBy-untrusted-key",
+			description:     "signedBy rejects a signature made by a different key",
+			requirements:    []signature.PolicyRequirement{gpgKey("public-key-2.gpg")},
+			dir:             "dir-img-valid",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonUntrustedKey},
+		},
+		{
+			name:            "signedBy-mixed",
+			description:     "signedBy allows an image with an invalid and a valid signature",
+			requirements:    []signature.PolicyRequirement{gpgKey("public-key.gpg")},
+			dir:             "dir-img-mixed",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: true},
+		},
+		{
+			name:            "signedBy-modified-manifest",
+			description:     "signedBy rejects a signature of a different manifest digest",
+			requirements:    []signature.PolicyRequirement{gpgKey("public-key.gpg")},
+			dir:             "dir-img-modified-manifest",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonDigestMismatch},
+		},
+		{
+			name:            "signedBaseLayer",
+			description:     "signedBaseLayer is not implemented",
+			requirements:    []signature.PolicyRequirement{x(signature.NewPRSignedBaseLayer(signature.NewPRMMatchRepository()))},
+			dir:             "dir-img-valid",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonNotImplemented},
+		},
+		{
+			name:        "sigstoreSigned-valid",
+			description: "sigstoreSigned allows an image with a valid signature",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithKeyData(fixture(t, "cosign.pub")),
+				signature.PRSigstoreSignedWithSignedIdentity(prmCosign),
+			))},
+			dir:             "dir-img-cosign-valid",
+			dockerReference: cosignImage,
+			expected:        Decision{Allowed: true},
+		},
+		{
+			name:        "sigstoreSigned-unsigned",
+			description: "sigstoreSigned rejects an unsigned image",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithKeyData(fixture(t, "cosign.pub")),
+				signature.PRSigstoreSignedWithSignedIdentity(prmCosign),
+			))},
+			dir:             "dir-img-unsigned",
+			dockerReference: cosignImage,
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonNoSignatures},
+		},
+		{
+			name:        "sigstoreSigned-simple-signing-only",
+			description: "sigstoreSigned ignores simple signing signatures",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithKeyData(fixture(t, "cosign.pub")),
+				signature.PRSigstoreSignedWithSignedIdentity(prmCosign),
+			))},
+			dir:             "dir-img-valid",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonNoSignatures},
+		},
+		{
+			name:        "sigstoreSigned-untrusted-key",
+			description: "sigstoreSigned rejects a signature made by a different key",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithKeyData(fixture(t, "cosign2.pub")),
+				signature.PRSigstoreSignedWithSignedIdentity(prmCosign),
+			))},
+			dir:             "dir-img-cosign-valid",
+			dockerReference: cosignImage,
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonUntrustedKey},
+		},
+		{
+			name:        "sigstoreSigned-modified-manifest",
+			description: "sigstoreSigned rejects a signature of a different manifest digest",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithKeyData(fixture(t, "cosign.pub")),
+				signature.PRSigstoreSignedWithSignedIdentity(prmCosign),
+			))},
+			dir:             "dir-img-cosign-modified-manifest",
+			dockerReference: cosignImage,
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonDigestMismatch},
+		},
+		{
+			name:        "sigstoreSigned-identity-mismatch",
+			description: "sigstoreSigned with matchExact rejects a signature claiming a different tag",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithKeyData(fixture(t, "cosign.pub")),
+				signature.PRSigstoreSignedWithSignedIdentity(signature.NewPRMMatchExact()),
+			))},
+			dir:             "dir-img-cosign-valid-with-tag",
+			dockerReference: "192.168.64.2:5000/skopeo-signed:othertag",
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonIdentityMismatch},
+		},
+		{
+			name:        "sigstoreSigned-exact-reference",
+			description: "sigstoreSigned with exactReference allows a signature claiming that reference",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithKeyData(fixture(t, "cosign.pub")),
+				signature.PRSigstoreSignedWithSignedIdentity(prmExactReference("192.168.64.2:5000/skopeo-signed:tag")),
+			))},
+			dir:             "dir-img-cosign-valid-with-tag",
+			dockerReference: "192.168.64.2:5000/skopeo-signed:othertag",
+			expected:        Decision{Allowed: true},
+		},
+		{
+			name:        "sigstoreSigned-key-rekor",
+			description: "sigstoreSigned allows a signature with a valid Rekor SET",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithKeyData(fixture(t, "cosign2.pub")),
+				signature.PRSigstoreSignedWithRekorPublicKeyData(fixture(t, "rekor.pub")),
+				signature.PRSigstoreSignedWithSignedIdentity(prmCosign),
+			))},
+			dir:             "dir-img-cosign-key-rekor-valid",
+			dockerReference: "192.168.64.2:5000/cosign-signed/key-1:latest",
+			expected:        Decision{Allowed: true},
+		},
+		{
+			name:        "sigstoreSigned-rekor-required",
+			description: "sigstoreSigned rejects a signature without a Rekor SET if a Rekor key is configured",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithKeyData(fixture(t, "cosign.pub")),
+				signature.PRSigstoreSignedWithRekorPublicKeyData(fixture(t, "rekor.pub")),
+				signature.PRSigstoreSignedWithSignedIdentity(prmCosign),
+			))},
+			dir:             "dir-img-cosign-valid",
+			dockerReference: cosignImage,
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonRekorRequired},
+		},
+		{
+			name:        "sigstoreSigned-fulcio-rekor",
+			description: "sigstoreSigned allows a signature with a valid Fulcio certificate and Rekor SET",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithFulcio(fulcio),
+				signature.PRSigstoreSignedWithRekorPublicKeyData(fixture(t, "rekor.pub")),
+				signature.PRSigstoreSignedWithSignedIdentity(prmCosign),
+			))},
+			dir:             "dir-img-cosign-fulcio-rekor-valid",
+			dockerReference: "192.168.64.2:5000/cosign-signed/fulcio-rekor-1:latest",
+			expected:        Decision{Allowed: true},
+		},
+		{
+			name:        "sigstoreSigned-required-annotations",
+			description: "sigstoreSigned allows a signature with the required annotations",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithKeyData(fixture(t, "cosign-annotated.pub")),
+				signature.PRSigstoreSignedWithSignedIdentity(prmCosign),
+				signature.PRSigstoreSignedWithRequiredAnnotations(map[string]string{"env": "prod", "team": "platform"}),
+			))},
+			dir:             "dir-img-cosign-annotated",
+			dockerReference: cosignImage,
+			expected:        Decision{Allowed: true},
+		},
+		{
+			name:        "sigstoreSigned-annotation-mismatch",
+			description: "sigstoreSigned rejects a signature with a different value of a required annotation",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithKeyData(fixture(t, "cosign-annotated.pub")),
+				signature.PRSigstoreSignedWithSignedIdentity(prmCosign),
+				signature.PRSigstoreSignedWithRequiredAnnotations(map[string]string{"env": "staging"}),
+			))},
+			dir:             "dir-img-cosign-annotated",
+			dockerReference: cosignImage,
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonAnnotationMismatch},
+		},
+		{
+			name:        "sigstoreSigned-minimum-signatures",
+			description: "sigstoreSigned allows an image signed by the required number of distinct keys",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithKeyDatas([][]byte{fixture(t, "cosign.pub"), fixture(t, "cosign3.pub")}),
+				signature.PRSigstoreSignedWithMinimumSignatures(2),
+				signature.PRSigstoreSignedWithSignedIdentity(prmCosign),
+			))},
+			dir:             "dir-img-cosign-multiple-keys",
+			dockerReference: cosignImage,
+			expected:        Decision{Allowed: true},
+		},
+		{
+			name:        "sigstoreSigned-insufficient-signatures",
+			description: "sigstoreSigned rejects an image signed by fewer than the required number of distinct keys",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreSigned(
+				signature.PRSigstoreSignedWithKeyDatas([][]byte{fixture(t, "cosign2.pub"), fixture(t, "cosign.pub"), fixture(t, "cosign3.pub")}),
+				signature.PRSigstoreSignedWithMinimumSignatures(3),
+				signature.PRSigstoreSignedWithSignedIdentity(prmCosign),
+			))},
+			dir:             "dir-img-cosign-multiple-keys",
+			dockerReference: cosignImage,
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonInsufficientSignatures},
+		},
+		{
+			name:        "sigstoreAttestation-no-attestations",
+			description: "sigstoreAttestation rejects an image without attestations",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRSigstoreAttestation(
+				signature.PRSigstoreAttestationWithKeyData(fixture(t, "cosign.pub")),
+				signature.PRSigstoreAttestationWithPredicateType("https://slsa.dev/provenance/v1"),
+			))},
+			dir:             "dir-img-cosign-valid",
+			dockerReference: cosignImage,
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonNoAttestations},
+		},
+		{
+			name:        "rejectSignedBy-rejected-key",
+			description: "rejectSignedBy rejects an image signed by a rejected key, even if it is also signed by another key",
+			requirements: []signature.PolicyRequirement{
+				x(signature.NewPRRejectSignedBy(signature.PRRejectSignedByWithKeyData(fixture(t, "public-key-2.gpg")))),
+				signature.NewPRInsecureAcceptAnything(),
+			},
+			dir:             "dir-img-dual-signed",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: false, Reason: signature.PRReasonRejectedKey},
+		},
+		{
+			name:        "rejectSignedBy-other-key",
+			description: "rejectSignedBy allows an image signed only by other keys",
+			requirements: []signature.PolicyRequirement{
+				x(signature.NewPRRejectSignedBy(signature.PRRejectSignedByWithKeyData(fixture(t, "public-key-2.gpg")))),
+				gpgKey("public-key.gpg"),
+			},
+			dir:             "dir-img-valid",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: true},
+		},
+		{
+			// This relies on nothing accepting connections on the discard port of the local host.
+			name:        "remote-fail-open",
+			description: "remote with failureMode failOpen allows an image if the decision service is unavailable",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRRemote(
+				signature.PRRemoteWithURL("http://127.0.0.1:9/decide"),
+				signature.PRRemoteWithTimeout(5*time.Second),
+				signature.PRRemoteWithFailureMode(signature.PRRemoteFailOpen),
+			))},
+			dir:             "dir-img-unsigned",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: true},
+		},
+		{
+			name:        "remote-fail-closed",
+			description: "remote with failureMode failClosed rejects an image, for an unspecified reason, if the decision service is unavailable",
+			requirements: []signature.PolicyRequirement{x(signature.NewPRRemote(
+				signature.PRRemoteWithURL("http://127.0.0.1:9/decide"),
+				signature.PRRemoteWithTimeout(5*time.Second),
+				signature.PRRemoteWithFailureMode(signature.PRRemoteFailClosed),
+			))},
+			dir:             "dir-img-unsigned",
+			dockerReference: "testing/manifest:latest",
+			expected:        Decision{Allowed: false},
+		},
+	}
+}
+
+// generateVector returns the contents of a vector file for c.
+func generateVector(t *testing.T, c vectorCase) []byte {
+	policy := signature.Policy{Default: c.requirements, Transports: map[string]signature.PolicyTransportScopes{}}
+	if c.scopes != nil {
+		policy.Transports = map[string]signature.PolicyTransportScopes{"docker": c.scopes}
+	}
+	policyJSON, err := json.Marshal(policy)
+	require.NoError(t, err, c.name)
+
+	sigs := [][]byte{}
+	for i := 1; ; i++ {
+		sig, err := os.ReadFile(filepath.Join(fixturesDir, c.dir, "signature-"+strconv.Itoa(i)))
+		if os.IsNotExist(err) {
+			break
+		}
+		require.NoError(t, err, c.name)
+		sigs = append(sigs, sig)
+	}
+	res, err := json.MarshalIndent(Vector{
+		Version:     FormatVersion,
+		Description: c.description,
+		Policy:      policyJSON,
+		Image: Image{
+			DockerReference: c.dockerReference,
+			Manifest:        fixture(t, filepath.Join(c.dir, "manifest.json")),
+			Signatures:      sigs,
+		},
+		Expected: c.expected,
+	}, "", "\t")
+	require.NoError(t, err, c.name)
+	return append(res, '\n')
+}
+
+func TestGeneratedVectors(t *testing.T) {
+	expected := map[string][]byte{}
+	for _, c := range vectorCases(t) {
+		name := c.name + ".json"
+		_, duplicate := expected[name]
+		require.False(t, duplicate, name)
+		expected[name] = generateVector(t, c)
+	}
+
+	if *updateVectors {
+		existing, err := filepath.Glob(filepath.Join(vectorsDir, "*.json"))
+		require.NoError(t, err)
+		for _, path := range existing {
+			err := os.Remove(path)
+			require.NoError(t, err)
+		}
+		for name, contents := range expected {
+			err := os.WriteFile(filepath.Join(vectorsDir, name), contents, 0o644)
+			require.NoError(t, err)
+		}
+	}
+
+	existing, err := filepath.Glob(filepath.Join(vectorsDir, "*.json"))
+	require.NoError(t, err)
+	existingNames := []string{}
+	for _, path := range existing {
+		existingNames = append(existingNames, filepath.Base(path))
+	}
+	expectedNames := maps.Keys(expected)
+	slices.Sort(expectedNames)
+	assert.Equal(t, expectedNames, existingNames, "run go test -update-vectors to update the vectors")
+	for name, contents := range expected {
+		actual, err := os.ReadFile(filepath.Join(vectorsDir, name))
+		if err == nil {
+			assert.True(t, bytes.Equal(contents, actual), "%s is out of date, run go test -update-vectors to update the vectors", name)
+		}
+	}
+}
+
+func TestVectors(t *testing.T) {
+	vectors, err := Vectors()
+	require.NoError(t, err)
+	require.NotEmpty(t, vectors)
+	for name, v := range vectors {
+		err := Run(context.Background(), v)
+		assert.NoError(t, err, name)
+	}
+}
+
+// policyRequirementTypes returns the values of all prTypeIdentifier constants in the signature package.
+func policyRequirementTypes(t *testing.T) []string {
+	file, err := parser.ParseFile(token.NewFileSet(), "../policy_types.go", nil, 0)
+	require.NoError(t, err)
+	res := []string{}
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			if ident, ok := valueSpec.Type.(*ast.Ident); !ok || ident.Name != "prTypeIdentifier" {
+				continue
+			}
+			for _, value := range valueSpec.Values {
+				lit, ok := value.(*ast.BasicLit)
+				require.True(t, ok)
+				s, err := strconv.Unquote(lit.Value)
+				require.NoError(t, err)
+				res = append(res, s)
+			}
+		}
+	}
+	return res
+}
+
+func TestVectorsCoverAllRequirementTypes(t *testing.T) {
+	types := policyRequirementTypes(t)
+	require.NotEmpty(t, types)
+	vectors, err := Vectors()
+	require.NoError(t, err)
+	for _, prType := range types {
+		covered := false
+		for name, v := range vectors {
+			if strings.HasPrefix(name, prType+"-") || name == prType+".json" {
+				var policy bytes.Buffer
+				err := json.Compact(&policy, v.Policy)
+				require.NoError(t, err, name)
+				assert.Contains(t, policy.String(), `"type":"`+prType+`"`, name)
+				covered = true
+			}
+		}
+		assert.True(t, covered, "policy requirement type %q has no test vectors", prType)
+	}
+}
+
+func TestParseVector(t *testing.T) {
+	_, err := ParseVector([]byte(`{"version":1,"policy":{"default":[{"type":"reject"}]}}`))
+	assert.NoError(t, err)
+	for _, data := range []string{
+		`{"version":2,"policy":{"default":[{"type":"reject"}]}}`,
+		`{"policy":{"default":[{"type":"reject"}]}}`,
+		`not JSON`,
+	} {
+		_, err := ParseVector([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
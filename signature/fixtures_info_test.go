@@ -9,6 +9,8 @@ const (
 	TestImageSignatureReference = "testing/manifest"
 	// TestKeyFingerprint is the fingerprint of the private key in this directory.
 	TestKeyFingerprint = "1D8230F6CDB6A06716E414C1DB72F2188BB46CC8"
+	// TestKeyFingerprintEd25519 is the fingerprint of the ed25519 public key in "public-key-ed25519.gpg".
+	TestKeyFingerprintEd25519 = "2E50427B632AFA98FB84CC5AE684D222408814A9"
 	// TestOtherFingerprint1 is a random fingerprint.
 	TestOtherFingerprint1 = "0123456789ABCDEF0123456789ABCDEF01234567"
 	// TestOtherFingerprint2 is a random fingerprint.
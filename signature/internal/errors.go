@@ -1,9 +1,14 @@
 package internal
 
+import "errors"
+
 // InvalidSignatureError is returned when parsing an invalid signature.
 // This is publicly visible as signature.InvalidSignatureError
 type InvalidSignatureError struct {
 	msg string
+	// untrustedKey is true if the signature could not be verified by any of the trusted keys,
+	// and not because it was malformed.
+	untrustedKey bool
 }
 
 func (err InvalidSignatureError) Error() string {
@@ -13,3 +18,15 @@ func (err InvalidSignatureError) Error() string {
 func NewInvalidSignatureError(msg string) InvalidSignatureError {
 	return InvalidSignatureError{msg: msg}
 }
+
+// NewUntrustedKeyError returns an InvalidSignatureError for a signature which could not be verified
+// by any of the trusted keys.
+func NewUntrustedKeyError(msg string) InvalidSignatureError {
+	return InvalidSignatureError{msg: msg, untrustedKey: true}
+}
+
+// IsUntrustedKeyError returns true if err is an InvalidSignatureError created by NewUntrustedKeyError.
+func IsUntrustedKeyError(err error) bool {
+	var sigErr InvalidSignatureError
+	return errors.As(err, &sigErr) && sigErr.untrustedKey
+}
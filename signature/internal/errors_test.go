@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,3 +14,10 @@ func TestInvalidSignatureError(t *testing.T) {
 	err := NewInvalidSignatureError(s)
 	assert.Equal(t, s, err.Error())
 }
+
+func TestIsUntrustedKeyError(t *testing.T) {
+	assert.True(t, IsUntrustedKeyError(NewUntrustedKeyError("test")))
+	assert.False(t, IsUntrustedKeyError(NewInvalidSignatureError("test")))
+	assert.False(t, IsUntrustedKeyError(errors.New("test")))
+	assert.True(t, IsUntrustedKeyError(fmt.Errorf("wrapped: %w", NewUntrustedKeyError("test"))))
+}
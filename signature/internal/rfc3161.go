@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+	"golang.org/x/exp/slices"
+)
+
+// UntrustedRFC3161Timestamp is a parsed content of the sigstore-signature RFC 3161 timestamp annotation.
+// This corresponds to github.com/sigstore/cosign/bundle.RFC3161Timestamp, but we impose a stricter decoder.
+type UntrustedRFC3161Timestamp struct {
+	UntrustedSignedRFC3161Timestamp []byte // A DER-encoded RFC 3161 TimeStampResp
+}
+
+// A compile-time check that UntrustedRFC3161Timestamp implements json.Unmarshaler
+var _ json.Unmarshaler = (*UntrustedRFC3161Timestamp)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (t *UntrustedRFC3161Timestamp) UnmarshalJSON(data []byte) error {
+	err := t.strictUnmarshalJSON(data)
+	if err != nil {
+		if formatErr, ok := err.(JSONFormatError); ok {
+			err = NewInvalidSignatureError(formatErr.Error())
+		}
+	}
+	return err
+}
+
+// strictUnmarshalJSON is UnmarshalJSON, except that it may return the internal JSONFormatError error type.
+// Splitting it into a separate function allows us to do the JSONFormatError → InvalidSignatureError in a single place, the caller.
+func (t *UntrustedRFC3161Timestamp) strictUnmarshalJSON(data []byte) error {
+	return ParanoidUnmarshalJSONObjectExactFields(data, map[string]any{
+		"SignedRFC3161Timestamp": &t.UntrustedSignedRFC3161Timestamp,
+	})
+}
+
+// A compile-time check that UntrustedRFC3161Timestamp and *UntrustedRFC3161Timestamp implements json.Marshaler
+var _ json.Marshaler = UntrustedRFC3161Timestamp{}
+var _ json.Marshaler = (*UntrustedRFC3161Timestamp)(nil)
+
+// MarshalJSON implements the json.Marshaler interface.
+func (t UntrustedRFC3161Timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"SignedRFC3161Timestamp": t.UntrustedSignedRFC3161Timestamp,
+	})
+}
+
+// The following types correspond to the ASN.1 definitions in RFC 3161.
+
+type rfc3161PKIStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type rfc3161TimeStampResp struct {
+	Status         rfc3161PKIStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type rfc3161MessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type rfc3161Accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type rfc3161TSTInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint rfc3161MessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time        `asn1:"generalized"`
+	Accuracy       rfc3161Accuracy  `asn1:"optional"`
+	Ordering       bool             `asn1:"optional,default:false"`
+	Nonce          *big.Int         `asn1:"optional"`
+	TSA            asn1.RawValue    `asn1:"optional,explicit,tag:0"`
+	Extensions     []pkix.Extension `asn1:"optional,tag:1"`
+}
+
+const (
+	rfc3161StatusGranted             = 0
+	rfc3161StatusGrantedWithMods     = 1
+	rfc3161TSTInfoVersion            = 1
+	rfc3161MaximumTimestampTokenSize = 1 << 20 // An arbitrary limit, real-world tokens are a few kilobytes
+)
+
+// rfc3161HashAlgorithms are the accepted message imprint hash algorithms.
+var rfc3161HashAlgorithms = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, crypto.SHA256},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}, crypto.SHA384},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}, crypto.SHA512},
+}
+
+// VerifyRFC3161Timestamp verifies that unverifiedTimestampAnnotation contains an RFC 3161 timestamp of unverifiedSignature
+// (the raw signature, not its base64 encoding), issued by a time-stamping authority with a certificate chaining to tsaRoots.
+// Returns the time asserted by the time-stamping authority on success.
+func VerifyRFC3161Timestamp(tsaRoots *x509.CertPool, unverifiedTimestampAnnotation []byte, unverifiedSignature []byte) (time.Time, error) {
+	var timestamp UntrustedRFC3161Timestamp
+	if err := json.Unmarshal(unverifiedTimestampAnnotation, &timestamp); err != nil {
+		return time.Time{}, err
+	}
+	if len(timestamp.UntrustedSignedRFC3161Timestamp) > rfc3161MaximumTimestampTokenSize {
+		return time.Time{}, NewInvalidSignatureError(fmt.Sprintf("RFC 3161 timestamp is too large (%d bytes)", len(timestamp.UntrustedSignedRFC3161Timestamp)))
+	}
+
+	var resp rfc3161TimeStampResp
+	rest, err := asn1.Unmarshal(timestamp.UntrustedSignedRFC3161Timestamp, &resp)
+	if err != nil {
+		return time.Time{}, NewInvalidSignatureError(fmt.Sprintf("parsing RFC 3161 timestamp response: %v", err))
+	}
+	if len(rest) != 0 {
+		return time.Time{}, NewInvalidSignatureError("unexpected data after the RFC 3161 timestamp response")
+	}
+	if resp.Status.Status != rfc3161StatusGranted && resp.Status.Status != rfc3161StatusGrantedWithMods {
+		return time.Time{}, NewInvalidSignatureError(fmt.Sprintf("RFC 3161 timestamp was not granted, status %d", resp.Status.Status))
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return time.Time{}, NewInvalidSignatureError("RFC 3161 timestamp response does not contain a timestamp token")
+	}
+
+	token, err := pkcs7.Parse(resp.TimeStampToken.FullBytes)
+	if err != nil {
+		return time.Time{}, NewInvalidSignatureError(fmt.Sprintf("parsing RFC 3161 timestamp token: %v", err))
+	}
+	var untrustedInfo rfc3161TSTInfo
+	rest, err = asn1.Unmarshal(token.Content, &untrustedInfo)
+	if err != nil {
+		return time.Time{}, NewInvalidSignatureError(fmt.Sprintf("parsing RFC 3161 timestamp token contents: %v", err))
+	}
+	if len(rest) != 0 {
+		return time.Time{}, NewInvalidSignatureError("unexpected data after the RFC 3161 timestamp token contents")
+	}
+	if untrustedInfo.Version != rfc3161TSTInfoVersion {
+		return time.Time{}, NewInvalidSignatureError(fmt.Sprintf("unsupported RFC 3161 timestamp token version %d", untrustedInfo.Version))
+	}
+
+	// RFC 3161 requires the TSA certificate to have the timeStamping extended key usage.
+	// token.VerifyWithChainAtTime accepts any key usage, so check this separately.
+	untrustedSigner := token.GetOnlySigner()
+	if untrustedSigner == nil {
+		return time.Time{}, NewInvalidSignatureError("RFC 3161 timestamp token does not have exactly one signer with a certificate")
+	}
+	if !slices.Contains(untrustedSigner.ExtKeyUsage, x509.ExtKeyUsageTimeStamping) {
+		return time.Time{}, NewInvalidSignatureError("RFC 3161 timestamp token signer is not a time-stamping authority")
+	}
+	if err := token.VerifyWithChainAtTime(tsaRoots, untrustedInfo.GenTime); err != nil {
+		return time.Time{}, NewInvalidSignatureError(fmt.Sprintf("verifying RFC 3161 timestamp token: %v", err))
+	}
+	// The token contents are now trusted.
+	info := untrustedInfo
+
+	hash := crypto.Hash(0)
+	for _, alg := range rfc3161HashAlgorithms {
+		if info.MessageImprint.HashAlgorithm.Algorithm.Equal(alg.oid) {
+			hash = alg.hash
+			break
+		}
+	}
+	if hash == 0 {
+		return time.Time{}, NewInvalidSignatureError(fmt.Sprintf("unsupported RFC 3161 timestamp hash algorithm %s", info.MessageImprint.HashAlgorithm.Algorithm))
+	}
+	h := hash.New()
+	h.Write(unverifiedSignature)
+	if subtle.ConstantTimeCompare(h.Sum(nil), info.MessageImprint.HashedMessage) != 1 {
+		return time.Time{}, NewInvalidSignatureError("RFC 3161 timestamp does not match the signature")
+	}
+	return info.GenTime, nil
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Verify that input can be unmarshaled as an UntrustedRFC3161Timestamp.
+func successfullyUnmarshalUntrustedRFC3161Timestamp(t *testing.T, input []byte) UntrustedRFC3161Timestamp {
+	var ts UntrustedRFC3161Timestamp
+	err := json.Unmarshal(input, &ts)
+	require.NoError(t, err, string(input))
+
+	return ts
+}
+
+// Verify that input can't be unmarshaled as an UntrustedRFC3161Timestamp.
+func assertUnmarshalUntrustedRFC3161TimestampFails(t *testing.T, input []byte) {
+	var ts UntrustedRFC3161Timestamp
+	err := json.Unmarshal(input, &ts)
+	assert.Error(t, err, string(input))
+}
+
+func TestUntrustedRFC3161TimestampUnmarshalJSON(t *testing.T) {
+	// Invalid input. Note that json.Unmarshal is guaranteed to validate input before calling our
+	// UnmarshalJSON implementation; so test that first, then test our error handling for completeness.
+	assertUnmarshalUntrustedRFC3161TimestampFails(t, []byte("&"))
+	var ts UntrustedRFC3161Timestamp
+	err := ts.UnmarshalJSON([]byte("&"))
+	assert.Error(t, err)
+
+	// Not an object
+	assertUnmarshalUntrustedRFC3161TimestampFails(t, []byte("1"))
+
+	// Start with a valid JSON.
+	validTimestamp := UntrustedRFC3161Timestamp{
+		UntrustedSignedRFC3161Timestamp: []byte("timestamp#@!"),
+	}
+	validJSON, err := json.Marshal(validTimestamp)
+	require.NoError(t, err)
+
+	// Success
+	ts = successfullyUnmarshalUntrustedRFC3161Timestamp(t, validJSON)
+	assert.Equal(t, validTimestamp, ts)
+
+	// Various ways to corrupt the JSON
+	breakFns := []func(mSA){
+		// The field is missing
+		func(v mSA) { delete(v, "SignedRFC3161Timestamp") },
+		// Extra top-level sub-object
+		func(v mSA) { v["unexpected"] = 1 },
+		// "SignedRFC3161Timestamp" not a string
+		func(v mSA) { v["SignedRFC3161Timestamp"] = 1 },
+		// "SignedRFC3161Timestamp" not base64
+		func(v mSA) { v["SignedRFC3161Timestamp"] = "this is invalid base64" },
+	}
+	for _, fn := range breakFns {
+		testJSON := modifiedJSON(t, validJSON, fn)
+		assertUnmarshalUntrustedRFC3161TimestampFails(t, testJSON)
+	}
+}
+
+// loadTestCertPool returns a pool with the certificates in path.
+func loadTestCertPool(t *testing.T, path string) *x509.CertPool {
+	pemBytes, err := os.ReadFile(path)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	ok := pool.AppendCertsFromPEM(pemBytes)
+	require.True(t, ok)
+	return pool
+}
+
+func TestVerifyRFC3161Timestamp(t *testing.T) {
+	tsaRoots := loadTestCertPool(t, "testdata/tsa-root.pem")
+	otherRoots := loadTestCertPool(t, "testdata/tsa-other-root.pem")
+
+	sigBlob, err := os.ReadFile("testdata/valid.signature")
+	require.NoError(t, err)
+	genericSig, err := signature.FromBlob(sigBlob)
+	require.NoError(t, err)
+	sigstoreSig, ok := genericSig.(signature.Sigstore)
+	require.True(t, ok)
+	cryptoBase64Sig, ok := sigstoreSig.UntrustedAnnotations()[signature.SigstoreSignatureAnnotationKey]
+	require.True(t, ok)
+	cryptoSig, err := base64.StdEncoding.DecodeString(cryptoBase64Sig)
+	require.NoError(t, err)
+
+	timestampBytes, err := os.ReadFile("testdata/rfc3161-timestamp")
+	require.NoError(t, err)
+	otherDataTimestampBytes, err := os.ReadFile("testdata/rfc3161-timestamp-other-data")
+	require.NoError(t, err)
+
+	// Successful verification
+	tm, err := VerifyRFC3161Timestamp(tsaRoots, timestampBytes, cryptoSig)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 15, 0, 43, 31, 0, time.UTC), tm.UTC())
+
+	// A timestamp issued by an untrusted TSA
+	_, err = VerifyRFC3161Timestamp(otherRoots, timestampBytes, cryptoSig)
+	assert.Error(t, err)
+
+	// A timestamp of different data
+	_, err = VerifyRFC3161Timestamp(tsaRoots, otherDataTimestampBytes, cryptoSig)
+	assert.Error(t, err)
+	_, err = VerifyRFC3161Timestamp(tsaRoots, timestampBytes, []byte("some other signature"))
+	assert.Error(t, err)
+
+	// Invalid annotation contents
+	for _, c := range [][]byte{
+		[]byte("&"),
+		[]byte(`{}`),
+		[]byte(`{"SignedRFC3161Timestamp":"YWJj"}`),
+	} {
+		_, err = VerifyRFC3161Timestamp(tsaRoots, c, cryptoSig)
+		assert.Error(t, err, string(c))
+	}
+
+	// Trailing data after the response
+	var timestamp UntrustedRFC3161Timestamp
+	err = json.Unmarshal(timestampBytes, &timestamp)
+	require.NoError(t, err)
+	timestamp.UntrustedSignedRFC3161Timestamp = append(timestamp.UntrustedSignedRFC3161Timestamp, 0)
+	trailingBytes, err := json.Marshal(timestamp)
+	require.NoError(t, err)
+	_, err = VerifyRFC3161Timestamp(tsaRoots, trailingBytes, cryptoSig)
+	assert.Error(t, err)
+}
@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	digest "github.com/opencontainers/go-digest"
+	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
+	"golang.org/x/exp/slices"
+)
+
+// inTotoPayloadType is the DSSE payload type of an in-toto statement.
+const inTotoPayloadType = "application/vnd.in-toto+json"
+
+// inTotoStatementTypes are the accepted values of the "_type" field of an in-toto statement.
+var inTotoStatementTypes = []string{
+	"https://in-toto.io/Statement/v0.1",
+	"https://in-toto.io/Statement/v1",
+}
+
+// dsseEnvelope is the JSON encoding of a DSSE envelope.
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"` // base64-encoded
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+// dsseSignature is the JSON encoding of a single signature in a DSSE envelope.
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"` // base64-encoded
+}
+
+// UntrustedInTotoSubject is a single element of the subject of an in-toto statement.
+type UntrustedInTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// UntrustedInTotoStatement is a parsed content of an in-toto statement (not the full DSSE envelope)
+type UntrustedInTotoStatement struct {
+	untrustedType          string
+	untrustedSubjects      []UntrustedInTotoSubject
+	untrustedPredicateType string
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (s *UntrustedInTotoStatement) UnmarshalJSON(data []byte) error {
+	*s = UntrustedInTotoStatement{}
+	// The predicate and any other fields are opaque to us; we only care about the fields that identify the image and the kind of the attestation.
+	var tmp struct {
+		Type          string                   `json:"_type"`
+		Subject       []UntrustedInTotoSubject `json:"subject"`
+		PredicateType string                   `json:"predicateType"`
+	}
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return NewInvalidSignatureError(err.Error())
+	}
+	s.untrustedType = tmp.Type
+	s.untrustedSubjects = tmp.Subject
+	s.untrustedPredicateType = tmp.PredicateType
+	return nil
+}
+
+// UntrustedSubjects returns the subjects of the statement.
+// The value is only trustworthy if s was returned by VerifyDSSEAttestation.
+func (s *UntrustedInTotoStatement) UntrustedSubjects() []UntrustedInTotoSubject {
+	return s.untrustedSubjects
+}
+
+// UntrustedPredicateType returns the predicateType value of the statement.
+// The value is only trustworthy if s was returned by VerifyDSSEAttestation.
+func (s *UntrustedInTotoStatement) UntrustedPredicateType() string {
+	return s.untrustedPredicateType
+}
+
+// SigstoreAttestationAcceptanceRules specifies how to decide whether an untrusted in-toto statement is acceptable.
+// We centralize the actual parsing and data extraction in VerifyDSSEAttestation; this supplies
+// the policy.
+type SigstoreAttestationAcceptanceRules struct {
+	ValidatePredicateType func(string) error
+	ValidateSubjects      func([]UntrustedInTotoSubject) error
+}
+
+// dssePAE returns the DSSE pre-authentication encoding of payloadType and payload, which is what the signatures sign.
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// VerifyDSSEAttestation verifies that unverifiedEnvelope is a DSSE envelope containing an in-toto statement,
+// correctly signed by any of publicKeys, and that the statement matches rules, and returns the statement
+// and the element of publicKeys which verified the signature.
+func VerifyDSSEAttestation(publicKeys []crypto.PublicKey, unverifiedEnvelope []byte, rules SigstoreAttestationAcceptanceRules) (*UntrustedInTotoStatement, crypto.PublicKey, error) {
+	if len(publicKeys) == 0 {
+		return nil, nil, errors.New("Need at least one public key to verify the attestation, but got 0")
+	}
+
+	verifiers := make([]sigstoreSignature.Verifier, 0, len(publicKeys))
+	for _, key := range publicKeys {
+		// As in VerifySigstorePayloadWithKey, fail if any of the keys is unusable.
+		verifier, err := sigstoreSignature.LoadVerifier(key, sigstoreHarcodedHashAlgorithm)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating verifier: %w", err)
+		}
+		verifiers = append(verifiers, verifier)
+	}
+
+	var envelope dsseEnvelope
+	if err := json.Unmarshal(unverifiedEnvelope, &envelope); err != nil {
+		return nil, nil, NewInvalidSignatureError(fmt.Sprintf("parsing DSSE envelope: %v", err))
+	}
+	if envelope.PayloadType != inTotoPayloadType {
+		return nil, nil, NewInvalidSignatureError(fmt.Sprintf("Unexpected DSSE payload type %q", envelope.PayloadType))
+	}
+	unverifiedPayload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return nil, nil, NewInvalidSignatureError(fmt.Sprintf("base64 decoding DSSE payload: %v", err))
+	}
+	if len(envelope.Signatures) == 0 {
+		return nil, nil, NewInvalidSignatureError("DSSE envelope contains no signatures")
+	}
+
+	pae := dssePAE(envelope.PayloadType, unverifiedPayload)
+	var failures []string
+	var verifyingKey crypto.PublicKey // = nil
+	for _, sig := range envelope.Signatures {
+		unverifiedSignature, err := base64.StdEncoding.DecodeString(sig.Sig)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("base64 decoding: %v", err))
+			continue
+		}
+		for i, verifier := range verifiers {
+			if err := verifier.VerifySignature(bytes.NewReader(unverifiedSignature), bytes.NewReader(pae)); err != nil {
+				failures = append(failures, err.Error())
+				continue
+			}
+			verifyingKey = publicKeys[i]
+			break
+		}
+		if verifyingKey != nil {
+			break
+		}
+	}
+	if verifyingKey == nil {
+		return nil, nil, NewUntrustedKeyError(fmt.Sprintf("cryptographic signature verification failed: %s", strings.Join(failures, ", ")))
+	}
+
+	var unmatchedStatement UntrustedInTotoStatement
+	if err := json.Unmarshal(unverifiedPayload, &unmatchedStatement); err != nil {
+		return nil, nil, NewInvalidSignatureError(err.Error())
+	}
+	if !slices.Contains(inTotoStatementTypes, unmatchedStatement.untrustedType) {
+		return nil, nil, NewInvalidSignatureError(fmt.Sprintf("Unrecognized in-toto statement type %q", unmatchedStatement.untrustedType))
+	}
+	if err := rules.ValidatePredicateType(unmatchedStatement.untrustedPredicateType); err != nil {
+		return nil, nil, err
+	}
+	if err := rules.ValidateSubjects(unmatchedStatement.untrustedSubjects); err != nil {
+		return nil, nil, err
+	}
+	// SigstoreAttestationAcceptanceRules have accepted this value.
+	return &unmatchedStatement, verifyingKey, nil
+}
+
+// InTotoSubjectDigest returns the sha256 digest of subject, or "" if it does not have a valid one.
+func InTotoSubjectDigest(subject UntrustedInTotoSubject) digest.Digest {
+	hex, ok := subject.Digest[digest.SHA256.String()]
+	if !ok {
+		return ""
+	}
+	d := digest.NewDigestFromEncoded(digest.SHA256, hex)
+	if d.Validate() != nil {
+		return ""
+	}
+	return d
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/containers/image/v5/version"
@@ -15,7 +16,10 @@ import (
 )
 
 const (
-	sigstoreSignatureType         = "cosign container image signature"
+	sigstoreSignatureType = "cosign container image signature"
+	// sigstoreAtomicSignatureType is the critical.type value of simple signing signatures,
+	// which is also accepted in sigstore payloads for compatibility.
+	sigstoreAtomicSignatureType   = "atomic container signature"
 	sigstoreHarcodedHashAlgorithm = crypto.SHA256
 )
 
@@ -29,6 +33,9 @@ type UntrustedSigstorePayload struct {
 	// So, this is explicitly an int64, and we reject fractional values. If we did need more precise timestamps eventually,
 	// we would add another field, UntrustedTimestampNS int64.
 	untrustedTimestamp *int64
+	// untrustedAnnotations contains the string-valued fields of "optional" other than "creator" and "timestamp",
+	// typically added by (cosign sign -a key=value); nil if there are none.
+	untrustedAnnotations map[string]string
 }
 
 // NewUntrustedSigstorePayload returns an UntrustedSigstorePayload object with
@@ -61,6 +68,9 @@ func (s UntrustedSigstorePayload) MarshalJSON() ([]byte, error) {
 		"identity": map[string]string{"docker-reference": s.untrustedDockerReference},
 	}
 	optional := map[string]any{}
+	for k, v := range s.untrustedAnnotations {
+		optional[k] = v
+	}
 	if s.untrustedCreatorID != nil {
 		optional["creator"] = *s.untrustedCreatorID
 	}
@@ -102,6 +112,7 @@ func (s *UntrustedSigstorePayload) strictUnmarshalJSON(data []byte) error {
 	var creatorID string
 	var timestamp float64
 	var gotCreatorID, gotTimestamp = false, false
+	otherFields := map[string]*json.RawMessage{}
 	// /usr/bin/cosign generates "optional": null if there are no user-specified annotations.
 	if !bytes.Equal(optional, []byte("null")) {
 		if err := ParanoidUnmarshalJSONObject(optional, func(key string) any {
@@ -113,13 +124,24 @@ func (s *UntrustedSigstorePayload) strictUnmarshalJSON(data []byte) error {
 				gotTimestamp = true
 				return &timestamp
 			default:
-				var ignore any
-				return &ignore
+				var value json.RawMessage
+				otherFields[key] = &value
+				return &value
 			}
 		}); err != nil {
 			return err
 		}
 	}
+	for key, value := range otherFields {
+		var stringValue string
+		if err := json.Unmarshal(*value, &stringValue); err != nil {
+			continue // Values of other types are ignored.
+		}
+		if s.untrustedAnnotations == nil {
+			s.untrustedAnnotations = map[string]string{}
+		}
+		s.untrustedAnnotations[key] = stringValue
+	}
 	if gotCreatorID {
 		s.untrustedCreatorID = &creatorID
 	}
@@ -140,7 +162,7 @@ func (s *UntrustedSigstorePayload) strictUnmarshalJSON(data []byte) error {
 	}); err != nil {
 		return err
 	}
-	if t != sigstoreSignatureType {
+	if t != sigstoreSignatureType && t != sigstoreAtomicSignatureType {
 		return NewInvalidSignatureError(fmt.Sprintf("Unrecognized signature type %s", t))
 	}
 
@@ -157,6 +179,49 @@ func (s *UntrustedSigstorePayload) strictUnmarshalJSON(data []byte) error {
 	})
 }
 
+// UntrustedDockerManifestDigest returns the docker-manifest-digest value of the payload.
+// The value is only trustworthy if s was returned by VerifySigstorePayload.
+func (s *UntrustedSigstorePayload) UntrustedDockerManifestDigest() digest.Digest {
+	return s.untrustedDockerManifestDigest
+}
+
+// UntrustedDockerReference returns the docker-reference value of the payload.
+// The value is only trustworthy if s was returned by VerifySigstorePayload.
+func (s *UntrustedSigstorePayload) UntrustedDockerReference() string {
+	return s.untrustedDockerReference
+}
+
+// UntrustedCreatorID returns the optional creator value of the payload, or nil if not present.
+// The value is only trustworthy if s was returned by VerifySigstorePayload.
+func (s *UntrustedSigstorePayload) UntrustedCreatorID() *string {
+	if s.untrustedCreatorID == nil {
+		return nil
+	}
+	res := *s.untrustedCreatorID
+	return &res
+}
+
+// UntrustedTimestamp returns the optional timestamp value of the payload, or nil if not present.
+// The value is only trustworthy if s was returned by VerifySigstorePayload.
+func (s *UntrustedSigstorePayload) UntrustedTimestamp() *time.Time {
+	if s.untrustedTimestamp == nil {
+		return nil
+	}
+	res := time.Unix(*s.untrustedTimestamp, 0)
+	return &res
+}
+
+// UntrustedAnnotations returns a copy of the string-valued optional annotations of the payload
+// (excluding the creator and timestamp fields).
+// The values are only trustworthy if s was returned by VerifySigstorePayload.
+func (s *UntrustedSigstorePayload) UntrustedAnnotations() map[string]string {
+	res := make(map[string]string, len(s.untrustedAnnotations))
+	for k, v := range s.untrustedAnnotations {
+		res[k] = v
+	}
+	return res
+}
+
 // SigstorePayloadAcceptanceRules specifies how to decide whether an untrusted payload is acceptable.
 // We centralize the actual parsing and data extraction in VerifySigstorePayload; this supplies
 // the policy.  We use an object instead of supplying func parameters to verifyAndExtractSignature
@@ -167,36 +232,63 @@ type SigstorePayloadAcceptanceRules struct {
 	ValidateSignedDockerManifestDigest func(digest.Digest) error
 }
 
-// VerifySigstorePayload verifies unverifiedBase64Signature of unverifiedPayload was correctly created by publicKey, and that its principal components
+// VerifySigstorePayload verifies unverifiedBase64Signature of unverifiedPayload was correctly created by any of publicKeys, and that its principal components
 // match expected values, both as specified by rules, and returns it.
 // We return an *UntrustedSigstorePayload, although nothing actually uses it,
 // just to double-check against stupid typos.
-func VerifySigstorePayload(publicKey crypto.PublicKey, unverifiedPayload []byte, unverifiedBase64Signature string, rules SigstorePayloadAcceptanceRules) (*UntrustedSigstorePayload, error) {
-	verifier, err := sigstoreSignature.LoadVerifier(publicKey, sigstoreHarcodedHashAlgorithm)
-	if err != nil {
-		return nil, fmt.Errorf("creating verifier: %w", err)
+func VerifySigstorePayload(publicKeys []crypto.PublicKey, unverifiedPayload []byte, unverifiedBase64Signature string, rules SigstorePayloadAcceptanceRules) (*UntrustedSigstorePayload, error) {
+	payload, _, err := VerifySigstorePayloadWithKey(publicKeys, unverifiedPayload, unverifiedBase64Signature, rules)
+	return payload, err
+}
+
+// VerifySigstorePayloadWithKey is VerifySigstorePayload, which also returns the element of publicKeys which verified the signature.
+func VerifySigstorePayloadWithKey(publicKeys []crypto.PublicKey, unverifiedPayload []byte, unverifiedBase64Signature string, rules SigstorePayloadAcceptanceRules) (*UntrustedSigstorePayload, crypto.PublicKey, error) {
+	if len(publicKeys) == 0 {
+		return nil, nil, errors.New("Need at least one public key to verify the sigstore payload, but got 0")
+	}
+
+	verifiers := make([]sigstoreSignature.Verifier, 0, len(publicKeys))
+	for _, key := range publicKeys {
+		// Failing to load a verifier indicates that something is really, really invalid about the public key;
+		// prefer to fail even if the signature might be valid with other keys, so that users fix their
+		// fallback keys before they need them.
+		verifier, err := sigstoreSignature.LoadVerifier(key, sigstoreHarcodedHashAlgorithm)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating verifier: %w", err)
+		}
+		verifiers = append(verifiers, verifier)
 	}
 
 	unverifiedSignature, err := base64.StdEncoding.DecodeString(unverifiedBase64Signature)
 	if err != nil {
-		return nil, NewInvalidSignatureError(fmt.Sprintf("base64 decoding: %v", err))
+		return nil, nil, NewInvalidSignatureError(fmt.Sprintf("base64 decoding: %v", err))
 	}
 	// github.com/sigstore/cosign/pkg/cosign.verifyOCISignature uses signatureoptions.WithContext(),
 	// which seems to be not used by anything. So we don’t bother.
-	if err := verifier.VerifySignature(bytes.NewReader(unverifiedSignature), bytes.NewReader(unverifiedPayload)); err != nil {
-		return nil, NewInvalidSignatureError(fmt.Sprintf("cryptographic signature verification failed: %v", err))
+	var failures []string
+	var verifyingKey crypto.PublicKey // = nil
+	for i, verifier := range verifiers {
+		if err := verifier.VerifySignature(bytes.NewReader(unverifiedSignature), bytes.NewReader(unverifiedPayload)); err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		verifyingKey = publicKeys[i]
+		break
+	}
+	if verifyingKey == nil {
+		return nil, nil, NewUntrustedKeyError(fmt.Sprintf("cryptographic signature verification failed: %s", strings.Join(failures, ", ")))
 	}
 
 	var unmatchedPayload UntrustedSigstorePayload
 	if err := json.Unmarshal(unverifiedPayload, &unmatchedPayload); err != nil {
-		return nil, NewInvalidSignatureError(err.Error())
+		return nil, nil, NewInvalidSignatureError(err.Error())
 	}
 	if err := rules.ValidateSignedDockerManifestDigest(unmatchedPayload.untrustedDockerManifestDigest); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if err := rules.ValidateSignedDockerReference(unmatchedPayload.untrustedDockerReference); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// SigstorePayloadAcceptanceRules have accepted this value.
-	return &unmatchedPayload, nil
+	return &unmatchedPayload, verifyingKey, nil
 }
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"crypto"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -74,6 +75,15 @@ func TestUntrustedSigstorePayloadMarshalJSON(t *testing.T) {
 			},
 			"{\"critical\":{\"identity\":{\"docker-reference\":\"reference#@!\"},\"image\":{\"docker-manifest-digest\":\"digest!@#\"},\"type\":\"cosign container image signature\"},\"optional\":{}}",
 		},
+		{
+			UntrustedSigstorePayload{
+				untrustedDockerManifestDigest: "digest!@#",
+				untrustedDockerReference:      "reference#@!",
+				untrustedCreatorID:            &creatorID,
+				untrustedAnnotations:          map[string]string{"env": "prod"},
+			},
+			"{\"critical\":{\"identity\":{\"docker-reference\":\"reference#@!\"},\"image\":{\"docker-manifest-digest\":\"digest!@#\"},\"type\":\"cosign container image signature\"},\"optional\":{\"creator\":\"CREATOR\",\"env\":\"prod\"}}",
+		},
 	} {
 		marshaled, err := c.input.MarshalJSON()
 		require.NoError(t, err)
@@ -151,6 +161,8 @@ func TestUntrustedSigstorePayloadUnmarshalJSON(t *testing.T) {
 		// Invalid "type"
 		func(v mSA) { x(v, "critical")["type"] = 1 },
 		func(v mSA) { x(v, "critical")["type"] = "unexpected" },
+		func(v mSA) { x(v, "critical")["type"] = "" },
+		func(v mSA) { x(v, "critical")["type"] = "cosign container image signature " },
 		// Invalid "image" object
 		func(v mSA) { x(v, "critical")["image"] = 1 },
 		func(v mSA) { delete(x(v, "critical", "image"), "docker-manifest-digest") },
@@ -178,6 +190,8 @@ func TestUntrustedSigstorePayloadUnmarshalJSON(t *testing.T) {
 	allowedModificationFns := []func(mSA){
 		// Add an optional field
 		func(v mSA) { x(v, "optional")["unexpected"] = 1 },
+		// The simple signing type is accepted as well
+		func(v mSA) { x(v, "critical")["type"] = "atomic container signature" },
 	}
 	for _, fn := range allowedModificationFns {
 		testJSON := modifiedJSON(t, validJSON, fn)
@@ -185,6 +199,14 @@ func TestUntrustedSigstorePayloadUnmarshalJSON(t *testing.T) {
 		assert.Equal(t, validSig, s)
 	}
 
+	// String-valued unrecognized fields in "optional" are recorded as annotations
+	testJSON := modifiedJSON(t, validJSON, func(v mSA) {
+		x(v, "optional")["env"] = "prod"
+		x(v, "optional")["number"] = 1
+	})
+	s = successfullyUnmarshalUntrustedSigstorePayload(t, testJSON)
+	assert.Equal(t, map[string]string{"env": "prod"}, s.untrustedAnnotations)
+
 	// Optional fields can be missing
 	validSig = UntrustedSigstorePayload{
 		untrustedDockerManifestDigest: "digest!@#",
@@ -198,11 +220,42 @@ func TestUntrustedSigstorePayloadUnmarshalJSON(t *testing.T) {
 	assert.Equal(t, validSig, s)
 }
 
+func TestUntrustedSigstorePayloadAccessors(t *testing.T) {
+	creatorID := "CREATOR"
+	timestamp := int64(1484683104)
+	s := UntrustedSigstorePayload{
+		untrustedDockerManifestDigest: "digest!@#",
+		untrustedDockerReference:      "reference#@!",
+		untrustedCreatorID:            &creatorID,
+		untrustedTimestamp:            &timestamp,
+		untrustedAnnotations:          map[string]string{"env": "prod"},
+	}
+	assert.Equal(t, digest.Digest("digest!@#"), s.UntrustedDockerManifestDigest())
+	assert.Equal(t, "reference#@!", s.UntrustedDockerReference())
+	require.NotNil(t, s.UntrustedCreatorID())
+	assert.Equal(t, creatorID, *s.UntrustedCreatorID())
+	require.NotNil(t, s.UntrustedTimestamp())
+	assert.Equal(t, time.Unix(timestamp, 0), *s.UntrustedTimestamp())
+	annotations := s.UntrustedAnnotations()
+	assert.Equal(t, map[string]string{"env": "prod"}, annotations)
+	annotations["env"] = "modified" // The returned map is a copy
+	assert.Equal(t, map[string]string{"env": "prod"}, s.untrustedAnnotations)
+
+	s = UntrustedSigstorePayload{}
+	assert.Nil(t, s.UntrustedCreatorID())
+	assert.Nil(t, s.UntrustedTimestamp())
+	assert.Equal(t, map[string]string{}, s.UntrustedAnnotations())
+}
+
 func TestVerifySigstorePayload(t *testing.T) {
 	publicKeyPEM, err := os.ReadFile("./testdata/cosign.pub")
 	require.NoError(t, err)
 	publicKey, err := cryptoutils.UnmarshalPEMToPublicKey(publicKeyPEM)
 	require.NoError(t, err)
+	otherPublicKeyPEM, err := os.ReadFile("./testdata/rekor.pub")
+	require.NoError(t, err)
+	otherPublicKey, err := cryptoutils.UnmarshalPEMToPublicKey(otherPublicKeyPEM)
+	require.NoError(t, err)
 
 	type acceptanceData struct {
 		signedDockerReference      string
@@ -244,7 +297,7 @@ func TestVerifySigstorePayload(t *testing.T) {
 	// Successful verification
 	wanted = signatureData
 	recorded = acceptanceData{}
-	res, err := VerifySigstorePayload(publicKey, sigstoreSig.UntrustedPayload(), cryptoBase64Sig, recordingRules)
+	res, err := VerifySigstorePayload([]crypto.PublicKey{publicKey}, sigstoreSig.UntrustedPayload(), cryptoBase64Sig, recordingRules)
 	require.NoError(t, err)
 	assert.Equal(t, res, &UntrustedSigstorePayload{
 		untrustedDockerManifestDigest: TestSigstoreManifestDigest,
@@ -254,12 +307,35 @@ func TestVerifySigstorePayload(t *testing.T) {
 	})
 	assert.Equal(t, signatureData, recorded)
 
+	// Successful verification, with the matching key not being the first one
+	wanted = signatureData
+	recorded = acceptanceData{}
+	res, err = VerifySigstorePayload([]crypto.PublicKey{otherPublicKey, publicKey}, sigstoreSig.UntrustedPayload(), cryptoBase64Sig, recordingRules)
+	require.NoError(t, err)
+	assert.NotNil(t, res)
+	assert.Equal(t, signatureData, recorded)
+
 	// For extra paranoia, test that we return a nil signature object on error.
 
+	// No public keys
+	recorded = acceptanceData{}
+	res, err = VerifySigstorePayload([]crypto.PublicKey{}, sigstoreSig.UntrustedPayload(), cryptoBase64Sig, recordingRules)
+	assert.Error(t, err)
+	assert.Nil(t, res)
+	assert.Equal(t, acceptanceData{}, recorded)
+
+	// No matching public key
+	recorded = acceptanceData{}
+	res, err = VerifySigstorePayload([]crypto.PublicKey{otherPublicKey, otherPublicKey}, sigstoreSig.UntrustedPayload(), cryptoBase64Sig, recordingRules)
+	assert.Error(t, err)
+	assert.IsType(t, InvalidSignatureError{}, err)
+	assert.Nil(t, res)
+	assert.Equal(t, acceptanceData{}, recorded)
+
 	// Invalid verifier
 	recorded = acceptanceData{}
 	invalidPublicKey := struct{}{} // crypto.PublicKey is, for some reason, just an any, so this is acceptable.
-	res, err = VerifySigstorePayload(invalidPublicKey, sigstoreSig.UntrustedPayload(), cryptoBase64Sig, recordingRules)
+	res, err = VerifySigstorePayload([]crypto.PublicKey{invalidPublicKey}, sigstoreSig.UntrustedPayload(), cryptoBase64Sig, recordingRules)
 	assert.Error(t, err)
 	assert.Nil(t, res)
 	assert.Equal(t, acceptanceData{}, recorded)
@@ -271,7 +347,7 @@ func TestVerifySigstorePayload(t *testing.T) {
 		cryptoBase64Sig[:len(cryptoBase64Sig)-1], // Truncated base64 data
 	} {
 		recorded = acceptanceData{}
-		res, err = VerifySigstorePayload(publicKey, sigstoreSig.UntrustedPayload(), invalidBase64Sig, recordingRules)
+		res, err = VerifySigstorePayload([]crypto.PublicKey{publicKey}, sigstoreSig.UntrustedPayload(), invalidBase64Sig, recordingRules)
 		assert.Error(t, err)
 		assert.Nil(t, res)
 		assert.Equal(t, acceptanceData{}, recorded)
@@ -286,7 +362,7 @@ func TestVerifySigstorePayload(t *testing.T) {
 		append(validSignatureBytes, validSignatureBytes...),
 	} {
 		recorded = acceptanceData{}
-		res, err = VerifySigstorePayload(publicKey, sigstoreSig.UntrustedPayload(), base64.StdEncoding.EncodeToString(invalidSig), recordingRules)
+		res, err = VerifySigstorePayload([]crypto.PublicKey{publicKey}, sigstoreSig.UntrustedPayload(), base64.StdEncoding.EncodeToString(invalidSig), recordingRules)
 		assert.Error(t, err)
 		assert.Nil(t, res)
 		assert.Equal(t, acceptanceData{}, recorded)
@@ -294,14 +370,14 @@ func TestVerifySigstorePayload(t *testing.T) {
 
 	// Valid signature of non-JSON
 	recorded = acceptanceData{}
-	res, err = VerifySigstorePayload(publicKey, []byte("&"), "MEUCIARnnxZQPALBfqkB4aNAYXad79Qs6VehcrgIeZ8p7I2FAiEAzq2HXwXlz1iJeh+ucUR3L0zpjynQk6Rk0+/gXYp49RU=", recordingRules)
+	res, err = VerifySigstorePayload([]crypto.PublicKey{publicKey}, []byte("&"), "MEUCIARnnxZQPALBfqkB4aNAYXad79Qs6VehcrgIeZ8p7I2FAiEAzq2HXwXlz1iJeh+ucUR3L0zpjynQk6Rk0+/gXYp49RU=", recordingRules)
 	assert.Error(t, err)
 	assert.Nil(t, res)
 	assert.Equal(t, acceptanceData{}, recorded)
 
 	// Valid signature of an unacceptable JSON
 	recorded = acceptanceData{}
-	res, err = VerifySigstorePayload(publicKey, []byte("{}"), "MEUCIQDkySOBGxastVP0+koTA33NH5hXjwosFau4rxTPN6g48QIgb7eWKkGqfEpHMM3aT4xiqyP/170jEkdFuciuwN4mux4=", recordingRules)
+	res, err = VerifySigstorePayload([]crypto.PublicKey{publicKey}, []byte("{}"), "MEUCIQDkySOBGxastVP0+koTA33NH5hXjwosFau4rxTPN6g48QIgb7eWKkGqfEpHMM3aT4xiqyP/170jEkdFuciuwN4mux4=", recordingRules)
 	assert.Error(t, err)
 	assert.Nil(t, res)
 	assert.Equal(t, acceptanceData{}, recorded)
@@ -310,7 +386,7 @@ func TestVerifySigstorePayload(t *testing.T) {
 	wanted = signatureData
 	wanted.signedDockerManifestDigest = "invalid digest"
 	recorded = acceptanceData{}
-	res, err = VerifySigstorePayload(publicKey, sigstoreSig.UntrustedPayload(), cryptoBase64Sig, recordingRules)
+	res, err = VerifySigstorePayload([]crypto.PublicKey{publicKey}, sigstoreSig.UntrustedPayload(), cryptoBase64Sig, recordingRules)
 	assert.Error(t, err)
 	assert.Nil(t, res)
 	assert.Equal(t, acceptanceData{
@@ -321,7 +397,7 @@ func TestVerifySigstorePayload(t *testing.T) {
 	wanted = signatureData
 	wanted.signedDockerReference = "unexpected docker reference"
 	recorded = acceptanceData{}
-	res, err = VerifySigstorePayload(publicKey, sigstoreSig.UntrustedPayload(), cryptoBase64Sig, recordingRules)
+	res, err = VerifySigstorePayload([]crypto.PublicKey{publicKey}, sigstoreSig.UntrustedPayload(), cryptoBase64Sig, recordingRules)
 	assert.Error(t, err)
 	assert.Nil(t, res)
 	assert.Equal(t, signatureData, recorded)
@@ -44,6 +44,10 @@ type signingMechanismWithPassphrase interface {
 	// Sign creates a (non-detached) signature of input using keyIdentity and passphrase.
 	// Fails with a SigningNotSupportedError if the mechanism does not support signing.
 	SignWithPassphrase(input []byte, keyIdentity string, passphrase string) ([]byte, error)
+
+	// verifyAllowingExpiredKeys is Verify, except that it also accepts signatures created before the signing key expired,
+	// even if the key has expired since.
+	verifyAllowingExpiredKeys(unverifiedSignature []byte) (contents []byte, keyIdentity string, err error)
 }
 
 // SigningNotSupportedError is returned when trying to sign using a mechanism which does not support that.
@@ -172,6 +172,17 @@ func (m *gpgmeSigningMechanism) Sign(input []byte, keyIdentity string) ([]byte,
 
 // Verify parses unverifiedSignature and returns the content and the signer's identity
 func (m *gpgmeSigningMechanism) Verify(unverifiedSignature []byte) (contents []byte, keyIdentity string, err error) {
+	return m.verify(unverifiedSignature, false)
+}
+
+// verifyAllowingExpiredKeys is Verify, except that it also accepts signatures created before the signing key expired,
+// even if the key has expired since.
+func (m *gpgmeSigningMechanism) verifyAllowingExpiredKeys(unverifiedSignature []byte) (contents []byte, keyIdentity string, err error) {
+	return m.verify(unverifiedSignature, true)
+}
+
+// verify is Verify, optionally accepting signatures created before the signing key expired.
+func (m *gpgmeSigningMechanism) verify(unverifiedSignature []byte, allowExpiredKeys bool) (contents []byte, keyIdentity string, err error) {
 	signedBuffer := bytes.Buffer{}
 	signedData, err := gpgme.NewDataWriter(&signedBuffer)
 	if err != nil {
@@ -189,14 +200,42 @@ func (m *gpgmeSigningMechanism) Verify(unverifiedSignature []byte) (contents []b
 		return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Unexpected GPG signature count %d", len(sigs)))
 	}
 	sig := sigs[0]
+	status := sig.Status
+	// An expired key is the only problem reported in sig.Summary, and the caller accepts that if the signature predates the expiry.
+	if allowExpiredKeys && status != nil && sig.Summary&gpgme.SigSumKeyExpired != 0 &&
+		sig.Summary&(gpgme.SigSumRed|gpgme.SigSumKeyRevoked|gpgme.SigSumKeyMissing|gpgme.SigSumSigExpired) == 0 {
+		signedBeforeExpiry, err := m.signedBeforeKeyExpiry(sig)
+		if err != nil {
+			return nil, "", err
+		}
+		if signedBeforeExpiry {
+			status = nil
+		}
+	}
 	// This is sig.Summary == gpgme.SigSumValid except for key trust, which we handle ourselves
-	if sig.Status != nil || sig.Validity == gpgme.ValidityNever || sig.ValidityReason != nil || sig.WrongKeyUsage {
+	if status != nil || sig.Validity == gpgme.ValidityNever || sig.ValidityReason != nil || sig.WrongKeyUsage {
 		// FIXME: Better error reporting eventually
 		return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Invalid GPG signature: %#v", sig))
 	}
 	return signedBuffer.Bytes(), sig.Fingerprint, nil
 }
 
+// signedBeforeKeyExpiry returns true if sig was created before the key which made it expired.
+func (m *gpgmeSigningMechanism) signedBeforeKeyExpiry(sig gpgme.Signature) (bool, error) {
+	key, err := m.ctx.GetKey(sig.Fingerprint, false)
+	if err != nil {
+		return false, err
+	}
+	defer key.Release()
+	for subkey := key.SubKeys(); subkey != nil; subkey = subkey.Next() {
+		if subkey.Fingerprint() == sig.Fingerprint {
+			expires := subkey.Expires()
+			return !expires.IsZero() && sig.Timestamp.Before(expires), nil
+		}
+	}
+	return false, nil
+}
+
 // UntrustedSignatureContents returns UNTRUSTED contents of the signature WITHOUT ANY VERIFICATION,
 // along with a short identifier of the key used for signing.
 // WARNING: The short key identifier (which corresponds to "Key ID" for OpenPGP keys)
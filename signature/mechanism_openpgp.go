@@ -23,11 +23,16 @@ import (
 	// use this frozen deprecated implementation.
 	//lint:ignore SA1019 See above
 	"golang.org/x/crypto/openpgp" //nolint:staticcheck
+	//lint:ignore SA1019 See above
+	pgpErrors "golang.org/x/crypto/openpgp/errors" //nolint:staticcheck
+	//lint:ignore SA1019 See above
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck
 )
 
 // A GPG/OpenPGP signing mechanism, implemented using x/crypto/openpgp.
 type openpgpSigningMechanism struct {
-	keyring openpgp.EntityList
+	keyring   openpgp.EntityList
+	eddsaKeys []eddsaPublicKey // Not supported by x/crypto/openpgp, see mechanism_openpgp_eddsa.go
 }
 
 // newGPGSigningMechanismInDirectory returns a new GPG/OpenPGP signing mechanism, using optionalDir if not empty.
@@ -86,11 +91,23 @@ func (m *openpgpSigningMechanism) Close() error {
 // importKeysFromBytes imports public keys from the supplied blob and returns their identities.
 // The blob is assumed to have an appropriate format (the caller is expected to know which one).
 func (m *openpgpSigningMechanism) importKeysFromBytes(blob []byte) ([]string, error) {
+	eddsaKeys, eddsaErr := readEdDSAPublicKeys(blob)
 	keyring, err := openpgp.ReadKeyRing(bytes.NewReader(blob))
 	if err != nil {
 		k, e2 := openpgp.ReadArmoredKeyRing(bytes.NewReader(blob))
 		if e2 != nil {
-			return nil, err // The original error  -- FIXME: is this better?
+			if eddsaErr != nil || len(eddsaKeys) == 0 {
+				var unsupported pgpErrors.UnsupportedError
+				if errors.As(err, &unsupported) {
+					return nil, fmt.Errorf("no supported GPG keys found: %w", err)
+				}
+				if errors.As(e2, &unsupported) {
+					return nil, fmt.Errorf("no supported GPG keys found: %w", e2)
+				}
+				return nil, err // The original error  -- FIXME: is this better?
+			}
+			// The blob only contains EdDSA keys (and perhaps other unsupported ones).
+			k = openpgp.EntityList{}
 		}
 		keyring = k
 	}
@@ -107,6 +124,12 @@ func (m *openpgpSigningMechanism) importKeysFromBytes(blob []byte) ([]string, er
 		keyIdentities = append(keyIdentities, strings.ToUpper(fmt.Sprintf("%x", entity.PrimaryKey.Fingerprint)))
 		m.keyring = append(m.keyring, entity)
 	}
+	if eddsaErr == nil {
+		for _, key := range eddsaKeys {
+			keyIdentities = append(keyIdentities, key.identity())
+			m.eddsaKeys = append(m.eddsaKeys, key)
+		}
+	}
 	return keyIdentities, nil
 }
 
@@ -129,6 +152,29 @@ func (m *openpgpSigningMechanism) Sign(input []byte, keyIdentity string) ([]byte
 
 // Verify parses unverifiedSignature and returns the content and the signer's identity
 func (m *openpgpSigningMechanism) Verify(unverifiedSignature []byte) (contents []byte, keyIdentity string, err error) {
+	return m.verify(unverifiedSignature, false)
+}
+
+// verifyAllowingExpiredKeys is Verify, except that it also accepts signatures created before the signing key expired,
+// even if the key has expired since.
+func (m *openpgpSigningMechanism) verifyAllowingExpiredKeys(unverifiedSignature []byte) (contents []byte, keyIdentity string, err error) {
+	return m.verify(unverifiedSignature, true)
+}
+
+// verify is Verify, optionally accepting signatures created before the signing key expired.
+func (m *openpgpSigningMechanism) verify(unverifiedSignature []byte, allowExpiredKeys bool) (contents []byte, keyIdentity string, err error) {
+	// If the message can’t be parsed here, let openpgp.ReadMessage report the failure.
+	if msg, err := readOpaqueSignedMessage(unverifiedSignature); err == nil {
+		switch msg.onePassSignature.PubKeyAlgo {
+		case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSASignOnly, packet.PubKeyAlgoDSA, packet.PubKeyAlgoECDSA:
+			// Handled by openpgp.ReadMessage below.
+		case pubKeyAlgoEdDSA:
+			return m.verifyEdDSA(msg)
+		default:
+			return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Unsupported GPG signature public key algorithm %d", msg.onePassSignature.PubKeyAlgo))
+		}
+	}
+
 	md, err := openpgp.ReadMessage(bytes.NewReader(unverifiedSignature), m.keyring, nil, nil)
 	if err != nil {
 		return nil, "", err
@@ -152,7 +198,9 @@ func (m *openpgpSigningMechanism) Verify(unverifiedSignature []byte) (contents [
 	if md.SignedBy == nil {
 		return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Invalid GPG signature: %#v", md.Signature))
 	}
+	var signatureCreationTime time.Time
 	if md.Signature != nil {
+		signatureCreationTime = md.Signature.CreationTime
 		if md.Signature.SigLifetimeSecs != nil {
 			expiry := md.Signature.CreationTime.Add(time.Duration(*md.Signature.SigLifetimeSecs) * time.Second)
 			if time.Now().After(expiry) {
@@ -163,12 +211,42 @@ func (m *openpgpSigningMechanism) Verify(unverifiedSignature []byte) (contents [
 		// Coverage: If md.SignedBy != nil, the final md.UnverifiedBody.Read() either sets one of md.Signature or md.SignatureV3,
 		// or sets md.SignatureError.
 		return nil, "", internal.NewInvalidSignatureError("Unexpected openpgp.MessageDetails: neither Signature nor SignatureV3 is set")
+	} else {
+		signatureCreationTime = md.SignatureV3.CreationTime
+	}
+	// openpgp.ReadMessage does not check the validity of the key, so reject revoked and expired keys, like gpgme does.
+	if err := validateOpenPGPSigningKey(md.SignedBy, time.Now(), signatureCreationTime, allowExpiredKeys); err != nil {
+		return nil, "", err
 	}
 
 	// Uppercase the fingerprint to be compatible with gpgme
 	return content, strings.ToUpper(fmt.Sprintf("%x", md.SignedBy.PublicKey.Fingerprint)), nil
 }
 
+// validateOpenPGPSigningKey returns an error if key has been revoked, or if it has expired at now.
+// If allowExpiredKeys, a key which has expired is accepted if signatureCreationTime is before the expiry.
+func validateOpenPGPSigningKey(key *openpgp.Key, now, signatureCreationTime time.Time, allowExpiredKeys bool) error {
+	fingerprint := strings.ToUpper(fmt.Sprintf("%x", key.PublicKey.Fingerprint))
+	if key.Entity != nil && len(key.Entity.Revocations) > 0 {
+		return internal.NewInvalidSignatureError(fmt.Sprintf("Key %s has been revoked", fingerprint))
+	}
+	if key.SelfSignature == nil {
+		return nil
+	}
+	// For subkeys, SelfSignature is the binding or revocation signature.
+	if key.SelfSignature.SigType == packet.SigTypeSubkeyRevocation || key.SelfSignature.RevocationReason != nil {
+		return internal.NewInvalidSignatureError(fmt.Sprintf("Key %s has been revoked", fingerprint))
+	}
+	// The key lifetime is relative to the key creation time (RFC 4880 section 5.2.3.6).
+	if key.SelfSignature.KeyLifetimeSecs != nil && *key.SelfSignature.KeyLifetimeSecs != 0 {
+		expiry := key.PublicKey.CreationTime.Add(time.Duration(*key.SelfSignature.KeyLifetimeSecs) * time.Second)
+		if now.After(expiry) && (!allowExpiredKeys || !signatureCreationTime.Before(expiry)) {
+			return internal.NewInvalidSignatureError(fmt.Sprintf("Key %s expired on %s", fingerprint, expiry))
+		}
+	}
+	return nil
+}
+
 // UntrustedSignatureContents returns UNTRUSTED contents of the signature WITHOUT ANY VERIFICATION,
 // along with a short identifier of the key used for signing.
 // WARNING: The short key identifier (which corresponds to "Key ID" for OpenPGP keys)
@@ -0,0 +1,331 @@
+//go:build containers_image_openpgp
+// +build containers_image_openpgp
+
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/signature/internal"
+	// See the comment in mechanism_openpgp.go.
+	//lint:ignore SA1019 See above
+	"golang.org/x/crypto/openpgp/armor" //nolint:staticcheck
+	//lint:ignore SA1019 See above
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck
+	//lint:ignore SA1019 See above
+	"golang.org/x/crypto/openpgp/s2k" //nolint:staticcheck
+)
+
+// golang.org/x/crypto/openpgp does not support EdDSA keys and signatures (RFC 4880bis),
+// so this file implements verification of Ed25519 signatures, using only a small subset of the OpenPGP format:
+// v4 primary keys, and binary v4 signatures of a (possibly compressed) one-pass signed message, as created by (gpg --sign).
+
+const (
+	pubKeyAlgoEdDSA = packet.PublicKeyAlgorithm(22)
+
+	packetTagSignature        = 2
+	packetTagOnePassSignature = 4
+	packetTagPublicKey        = 6
+	packetTagCompressed       = 8
+	packetTagLiteralData      = 11
+
+	signatureSubpacketCreationTime      = 2
+	signatureSubpacketExpirationTime    = 3
+	signatureSubpacketIssuer            = 16
+	signatureSubpacketIssuerFingerprint = 33
+	signatureSubpacketCritical          = 0x80
+)
+
+// ed25519CurveOID is the OpenPGP encoding of the Ed25519 curve OID, 1.3.6.1.4.1.11591.15.1.
+var ed25519CurveOID = []byte{0x2B, 0x06, 0x01, 0x04, 0x01, 0xDA, 0x47, 0x0F, 0x01}
+
+// eddsaPublicKey is an Ed25519 OpenPGP primary key.
+type eddsaPublicKey struct {
+	fingerprint [20]byte
+	key         ed25519.PublicKey
+}
+
+// keyID returns the OpenPGP key ID of k.
+func (k *eddsaPublicKey) keyID() uint64 {
+	return binary.BigEndian.Uint64(k.fingerprint[12:])
+}
+
+// identity returns the key identity of k, in the format used by the signing mechanism.
+func (k *eddsaPublicKey) identity() string {
+	// Uppercase the fingerprint to be compatible with gpgme
+	return strings.ToUpper(fmt.Sprintf("%x", k.fingerprint))
+}
+
+// readEdDSAPublicKeys returns the Ed25519 primary keys in blob, which contains a binary or an ASCII-armored keyring.
+// Keys of other types are ignored.
+func readEdDSAPublicKeys(blob []byte) ([]eddsaPublicKey, error) {
+	var r io.Reader = bytes.NewReader(blob)
+	if bytes.HasPrefix(bytes.TrimSpace(blob), []byte("-----BEGIN ")) {
+		block, err := armor.Decode(bytes.NewReader(blob))
+		if err != nil {
+			return nil, err
+		}
+		r = block.Body
+	}
+
+	res := []eddsaPublicKey{}
+	opaqueReader := packet.NewOpaqueReader(r)
+	for {
+		p, err := opaqueReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p.Tag != packetTagPublicKey {
+			continue
+		}
+		key, ok, err := parseEdDSAPublicKey(p.Contents)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, key)
+		}
+	}
+	return res, nil
+}
+
+// parseEdDSAPublicKey parses contents of a public key packet, and returns the key and true if it is an Ed25519 key.
+func parseEdDSAPublicKey(contents []byte) (eddsaPublicKey, bool, error) {
+	// RFC 4880 section 5.5.2 and RFC 4880bis section 5.5.5.5:
+	// version (4), creation time (4 bytes), algorithm, curve OID length, curve OID, MPI of the point in the native format.
+	if len(contents) < 6 || contents[0] != 4 || packet.PublicKeyAlgorithm(contents[5]) != pubKeyAlgoEdDSA {
+		return eddsaPublicKey{}, false, nil
+	}
+	rest := contents[6:]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		return eddsaPublicKey{}, false, errors.New("EdDSA public key packet truncated")
+	}
+	oid := rest[1 : 1+int(rest[0])]
+	if !bytes.Equal(oid, ed25519CurveOID) {
+		return eddsaPublicKey{}, false, nil // Other curves, e.g. Ed448, are not supported.
+	}
+	point, rest, err := readMPI(rest[1+int(rest[0]):])
+	if err != nil {
+		return eddsaPublicKey{}, false, fmt.Errorf("parsing EdDSA public key: %w", err)
+	}
+	if len(rest) != 0 {
+		return eddsaPublicKey{}, false, errors.New("unexpected data after an EdDSA public key")
+	}
+	// The point is prefixed by 0x40 to indicate the native format.
+	if len(point) != 1+ed25519.PublicKeySize || point[0] != 0x40 {
+		return eddsaPublicKey{}, false, errors.New("invalid Ed25519 public key")
+	}
+
+	// RFC 4880 section 12.2: The fingerprint is SHA-1 of 0x99, a two-byte packet length, and the packet contents.
+	h := sha1.New()
+	_, _ = h.Write([]byte{0x99, byte(len(contents) >> 8), byte(len(contents))})
+	_, _ = h.Write(contents)
+	res := eddsaPublicKey{key: ed25519.PublicKey(point[1:])}
+	copy(res.fingerprint[:], h.Sum(nil))
+	return res, true, nil
+}
+
+// readMPI parses an OpenPGP multiprecision integer at the start of data, and returns its big-endian contents and the rest of data.
+func readMPI(data []byte) ([]byte, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errors.New("MPI truncated")
+	}
+	bits := int(binary.BigEndian.Uint16(data[:2]))
+	length := (bits + 7) / 8
+	if len(data) < 2+length {
+		return nil, nil, errors.New("MPI truncated")
+	}
+	return data[2 : 2+length], data[2+length:], nil
+}
+
+// opaqueSignedMessage contains the packets of a one-pass signed message.
+type opaqueSignedMessage struct {
+	onePassSignature *packet.OnePassSignature
+	literalData      *packet.OpaquePacket
+	signature        *packet.OpaquePacket
+}
+
+// readOpaqueSignedMessage reads the one-pass signature, literal data and signature packets from a (possibly compressed) signed message.
+func readOpaqueSignedMessage(unverifiedSignature []byte) (*opaqueSignedMessage, error) {
+	packets := []*packet.OpaquePacket{}
+	opaqueReader := packet.NewOpaqueReader(bytes.NewReader(unverifiedSignature))
+	for compressed := false; ; {
+		p, err := opaqueReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p.Tag == packetTagCompressed {
+			if compressed || len(packets) != 0 {
+				return nil, errors.New("unexpected compressed data packet")
+			}
+			parsed, err := p.Parse()
+			if err != nil {
+				return nil, err
+			}
+			c, ok := parsed.(*packet.Compressed)
+			if !ok {
+				return nil, fmt.Errorf("unexpected compressed data packet type %T", parsed)
+			}
+			opaqueReader = packet.NewOpaqueReader(c.Body)
+			compressed = true
+			continue
+		}
+		packets = append(packets, p)
+	}
+	if len(packets) != 3 || packets[0].Tag != packetTagOnePassSignature || packets[1].Tag != packetTagLiteralData ||
+		packets[2].Tag != packetTagSignature {
+		return nil, errors.New("not a one-pass signed message")
+	}
+	parsed, err := packets[0].Parse()
+	if err != nil {
+		return nil, err
+	}
+	ops, ok := parsed.(*packet.OnePassSignature)
+	if !ok {
+		return nil, fmt.Errorf("unexpected one-pass signature packet type %T", parsed)
+	}
+	return &opaqueSignedMessage{
+		onePassSignature: ops,
+		literalData:      packets[1],
+		signature:        packets[2],
+	}, nil
+}
+
+// verifyEdDSA verifies an EdDSA-signed msg, and returns the content and the signer's identity.
+func (m *openpgpSigningMechanism) verifyEdDSA(msg *opaqueSignedMessage) ([]byte, string, error) {
+	// RFC 4880 section 5.2.3: version, signature type, public key algorithm, hash algorithm, hashed subpackets length, hashed subpackets,
+	// unhashed subpackets length, unhashed subpackets, left 16 bits of the hash, and the algorithm-specific fields.
+	sig := msg.signature.Contents
+	if len(sig) < 6 || sig[0] != 4 {
+		return nil, "", internal.NewInvalidSignatureError("Unsupported EdDSA GPG signature packet version")
+	}
+	sigType, sigAlgo, sigHash := packet.SignatureType(sig[1]), packet.PublicKeyAlgorithm(sig[2]), sig[3]
+	if sigType != packet.SigTypeBinary || sigType != msg.onePassSignature.SigType {
+		return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Unsupported GPG signature type %d", sigType))
+	}
+	if sigAlgo != pubKeyAlgoEdDSA {
+		return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("GPG signature algorithm %d does not match the one-pass signature", sigAlgo))
+	}
+	hashFunc, ok := s2k.HashIdToHash(sigHash)
+	if !ok || !hashFunc.Available() || hashFunc != msg.onePassSignature.Hash {
+		return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Unsupported GPG signature hash algorithm %d", sigHash))
+	}
+	hashedLen := int(binary.BigEndian.Uint16(sig[4:6]))
+	if len(sig) < 6+hashedLen+2 {
+		return nil, "", internal.NewInvalidSignatureError("GPG signature packet truncated")
+	}
+	hashedPart, rest := sig[:6+hashedLen], sig[6+hashedLen:]
+	unhashedLen := int(binary.BigEndian.Uint16(rest[:2]))
+	if len(rest) < 2+unhashedLen+2 {
+		return nil, "", internal.NewInvalidSignatureError("GPG signature packet truncated")
+	}
+	unhashedSubpackets, rest := rest[2:2+unhashedLen], rest[2+unhashedLen:]
+	left16, rest := rest[:2], rest[2:]
+	r, rest, err := readMPI(rest)
+	if err != nil {
+		return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Invalid EdDSA GPG signature: %v", err))
+	}
+	s, rest, err := readMPI(rest)
+	if err != nil {
+		return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Invalid EdDSA GPG signature: %v", err))
+	}
+	if len(rest) != 0 || len(r) > ed25519.SignatureSize/2 || len(s) > ed25519.SignatureSize/2 {
+		return nil, "", internal.NewInvalidSignatureError("Invalid EdDSA GPG signature")
+	}
+
+	var creationTime time.Time
+	var lifetime *uint32
+	hashed, err := packet.OpaqueSubpackets(hashedPart[6:])
+	if err != nil {
+		return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Invalid GPG signature subpackets: %v", err))
+	}
+	for _, sp := range hashed {
+		switch sp.SubType &^ signatureSubpacketCritical {
+		case signatureSubpacketCreationTime:
+			if len(sp.Contents) != 4 {
+				return nil, "", internal.NewInvalidSignatureError("Invalid GPG signature creation time")
+			}
+			creationTime = time.Unix(int64(binary.BigEndian.Uint32(sp.Contents)), 0)
+		case signatureSubpacketExpirationTime:
+			if len(sp.Contents) != 4 {
+				return nil, "", internal.NewInvalidSignatureError("Invalid GPG signature expiration time")
+			}
+			l := binary.BigEndian.Uint32(sp.Contents)
+			lifetime = &l
+		case signatureSubpacketIssuer, signatureSubpacketIssuerFingerprint:
+			// The key is identified by the one-pass signature packet; it must match the signing key, which we verify below.
+		default:
+			if sp.SubType&signatureSubpacketCritical != 0 {
+				return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Unknown critical GPG signature subpacket type %d", sp.SubType&^signatureSubpacketCritical))
+			}
+		}
+	}
+	if _, err := packet.OpaqueSubpackets(unhashedSubpackets); err != nil {
+		return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Invalid GPG signature subpackets: %v", err))
+	}
+
+	var key *eddsaPublicKey
+	for i := range m.eddsaKeys {
+		if m.eddsaKeys[i].keyID() == msg.onePassSignature.KeyId {
+			key = &m.eddsaKeys[i]
+			break
+		}
+	}
+	if key == nil {
+		return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Invalid GPG signature: unknown EdDSA key %016X", msg.onePassSignature.KeyId))
+	}
+
+	parsed, err := msg.literalData.Parse()
+	if err != nil {
+		return nil, "", err
+	}
+	literalData, ok := parsed.(*packet.LiteralData)
+	if !ok {
+		return nil, "", fmt.Errorf("unexpected literal data packet type %T", parsed)
+	}
+	content, err := io.ReadAll(literalData.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// RFC 4880 section 5.2.4: The hash covers the data, the hashed part of the signature packet, and a trailer.
+	h := hashFunc.New()
+	_, _ = h.Write(content)
+	_, _ = h.Write(hashedPart)
+	trailer := []byte{4, 0xff, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(trailer[2:], uint32(len(hashedPart)))
+	_, _ = h.Write(trailer)
+	digest := h.Sum(nil)
+	if !bytes.Equal(digest[:2], left16) {
+		return nil, "", internal.NewInvalidSignatureError("Invalid GPG signature: hash mismatch")
+	}
+	// RFC 4880bis section 5.2.3.3: r and s are the two halves of the native signature; MPIs drop leading zeros.
+	edSig := make([]byte, ed25519.SignatureSize)
+	copy(edSig[ed25519.SignatureSize/2-len(r):], r)
+	copy(edSig[ed25519.SignatureSize-len(s):], s)
+	if !ed25519.Verify(key.key, digest, edSig) {
+		return nil, "", internal.NewInvalidSignatureError("Invalid GPG signature: EdDSA verification failed")
+	}
+
+	if lifetime != nil && *lifetime != 0 {
+		expiry := creationTime.Add(time.Duration(*lifetime) * time.Second)
+		if time.Now().After(expiry) {
+			return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Signature expired on %s", expiry))
+		}
+	}
+	return content, key.identity(), nil
+}
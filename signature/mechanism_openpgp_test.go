@@ -4,10 +4,18 @@
 package signature
 
 import (
+	"bytes"
+	"io"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	//lint:ignore SA1019 See the comment in mechanism_openpgp.go
+	"golang.org/x/crypto/openpgp" //nolint:staticcheck
+	//lint:ignore SA1019 See the comment in mechanism_openpgp.go
+	"golang.org/x/crypto/openpgp/armor" //nolint:staticcheck
 )
 
 func TestOpenpgpSigningMechanismSupportsSigning(t *testing.T) {
@@ -27,3 +35,51 @@ func TestOpenpgpSigningMechanismSign(t *testing.T) {
 	assert.Error(t, err)
 	assert.IsType(t, SigningNotSupportedError(""), err)
 }
+
+func TestOpenpgpSigningMechanismUnsupportedKeyType(t *testing.T) {
+	armored, err := os.ReadFile("./fixtures/public-key-ed25519.gpg")
+	require.NoError(t, err)
+	block, err := armor.Decode(bytes.NewReader(armored))
+	require.NoError(t, err)
+	keyBlob, err := io.ReadAll(block.Body)
+	require.NoError(t, err)
+	// Replace the Ed25519 curve OID with a different, unsupported, one.
+	i := bytes.Index(keyBlob, ed25519CurveOID)
+	require.NotEqual(t, -1, i)
+	keyBlob[i+len(ed25519CurveOID)-1] = 0x02
+
+	_, _, err = NewEphemeralGPGSigningMechanism(keyBlob)
+	assert.ErrorContains(t, err, "no supported GPG keys found")
+}
+
+func TestValidateOpenPGPSigningKey(t *testing.T) {
+	keyBlob, err := os.ReadFile("./fixtures/public-key-expired.gpg")
+	require.NoError(t, err)
+	keyring, err := openpgp.ReadKeyRing(bytes.NewReader(keyBlob))
+	require.NoError(t, err)
+	require.Len(t, keyring, 1)
+	keys := keyring.KeysById(keyring[0].PrimaryKey.KeyId)
+	require.Len(t, keys, 1)
+	key := keys[0]
+	created := key.PublicKey.CreationTime
+	expiry := created.Add(time.Duration(*key.SelfSignature.KeyLifetimeSecs) * time.Second)
+
+	for _, c := range []struct {
+		now, signatureCreationTime time.Time
+		allowExpiredKeys           bool
+		accepted                   bool
+	}{
+		{expiry.Add(-time.Hour), created, false, true},                  // Not expired yet
+		{expiry.Add(time.Hour), created, false, false},                  // Expired
+		{expiry.Add(time.Hour), created, true, true},                    // Expired, but signed before the expiry
+		{expiry.Add(2 * time.Hour), expiry.Add(time.Hour), true, false}, // Signed after the expiry
+		{expiry.Add(time.Hour), expiry, true, false},                    // Signed at the time of the expiry
+	} {
+		err := validateOpenPGPSigningKey(&key, c.now, c.signatureCreationTime, c.allowExpiredKeys)
+		if c.accepted {
+			assert.NoError(t, err, "%#v", c)
+		} else {
+			assert.Error(t, err, "%#v", c)
+		}
+	}
+}
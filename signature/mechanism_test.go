@@ -269,6 +269,87 @@ func TestGPGSigningMechanismVerify(t *testing.T) {
 	// The various GPG/GPGME failures cases are not obviously easy to reach.
 }
 
+func TestGPGSigningMechanismVerifyKeyValidity(t *testing.T) {
+	for _, c := range []struct {
+		keyFile, sigFile              string
+		acceptedIfAllowingExpiredKeys bool
+	}{
+		{"./fixtures/public-key-expired.gpg", "./fixtures/expired-key.signature", true},            // The key has expired after creating the signature
+		{"./fixtures/public-key-revoked.gpg", "./fixtures/revoked-key.signature", false},           // The key has been revoked after creating the signature
+		{"./fixtures/public-key-revoked-subkey.gpg", "./fixtures/revoked-subkey.signature", false}, // The signing subkey has been revoked after creating the signature
+	} {
+		keyBlob, err := os.ReadFile(c.keyFile)
+		require.NoError(t, err)
+		mech, keyIdentities, err := newEphemeralGPGSigningMechanism([][]byte{keyBlob})
+		require.NoError(t, err, c.keyFile)
+		defer mech.Close()
+		require.Len(t, keyIdentities, 1, c.keyFile)
+
+		signature, err := os.ReadFile(c.sigFile)
+		require.NoError(t, err)
+		content, signingFingerprint, err := mech.Verify(signature)
+		assertSigningError(t, content, signingFingerprint, err, c.sigFile)
+
+		content, signingFingerprint, err = mech.verifyAllowingExpiredKeys(signature)
+		if c.acceptedIfAllowingExpiredKeys {
+			require.NoError(t, err, c.sigFile)
+			assert.Equal(t, []byte("This is not JSON\n"), content, c.sigFile)
+			assert.Equal(t, keyIdentities[0], signingFingerprint, c.sigFile)
+		} else {
+			assertSigningError(t, content, signingFingerprint, err, c.sigFile)
+		}
+	}
+}
+
+func TestGPGSigningMechanismVerifyEd25519(t *testing.T) {
+	ed25519KeyBlob, err := os.ReadFile("./fixtures/public-key-ed25519.gpg")
+	require.NoError(t, err)
+	rsaKeyBlob, err := os.ReadFile("./fixtures/public-key.gpg")
+	require.NoError(t, err)
+	ed25519Signature, err := os.ReadFile("./fixtures/dir-img-ed25519-valid/signature-1")
+	require.NoError(t, err)
+	rsaSignature, err := os.ReadFile("./fixtures/invalid-blob.signature")
+	require.NoError(t, err)
+
+	mech, keyIdentities, err := NewEphemeralGPGSigningMechanism(ed25519KeyBlob)
+	require.NoError(t, err)
+	defer mech.Close()
+	assert.Equal(t, []string{TestKeyFingerprintEd25519}, keyIdentities)
+
+	// Successful verification
+	content, signingFingerprint, err := mech.Verify(ed25519Signature)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"docker-reference":"testing/manifest:latest"`)
+	assert.Equal(t, TestKeyFingerprintEd25519, signingFingerprint)
+
+	// Corrupt signature
+	signature, err := os.ReadFile("./fixtures/corrupt-ed25519.signature")
+	require.NoError(t, err)
+	content, signingFingerprint, err = mech.Verify(signature)
+	assertSigningError(t, content, signingFingerprint, err)
+
+	// A signature using a different key
+	content, signingFingerprint, err = mech.Verify(rsaSignature)
+	assertSigningError(t, content, signingFingerprint, err)
+	mech2, _, err := NewEphemeralGPGSigningMechanism(rsaKeyBlob)
+	require.NoError(t, err)
+	defer mech2.Close()
+	content, signingFingerprint, err = mech2.Verify(ed25519Signature)
+	assertSigningError(t, content, signingFingerprint, err)
+
+	// Both key types at the same time
+	mech3, keyIdentities, err := newEphemeralGPGSigningMechanism([][]byte{rsaKeyBlob, ed25519KeyBlob})
+	require.NoError(t, err)
+	defer mech3.Close()
+	assert.Equal(t, []string{TestKeyFingerprint, TestKeyFingerprintEd25519}, keyIdentities)
+	_, signingFingerprint, err = mech3.Verify(ed25519Signature)
+	require.NoError(t, err)
+	assert.Equal(t, TestKeyFingerprintEd25519, signingFingerprint)
+	_, signingFingerprint, err = mech3.Verify(rsaSignature)
+	require.NoError(t, err)
+	assert.Equal(t, TestKeyFingerprint, signingFingerprint)
+}
+
 func TestGPGSigningMechanismUntrustedSignatureContents(t *testing.T) {
 	mech, _, err := NewEphemeralGPGSigningMechanism([]byte{})
 	require.NoError(t, err)
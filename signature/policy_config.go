@@ -19,13 +19,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/set"
 	"github.com/containers/image/v5/signature/internal"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/homedir"
 	"github.com/containers/storage/pkg/regexp"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 // systemDefaultPolicyPath is the policy path used for DefaultPolicy().
@@ -187,7 +191,11 @@ func (m *policyTransportScopesWithTransport) UnmarshalJSON(data []byte) error {
 			return nil
 		}
 		if key != "" && m.transport != nil {
-			if err := m.transport.ValidatePolicyConfigurationScope(key); err != nil {
+			scope := key
+			if prefix, ok := scopePrefix(key); ok && prefix != "" {
+				scope = prefix // A prefix scope is valid if the prefix itself is a valid scope.
+			}
+			if err := m.transport.ValidatePolicyConfigurationScope(scope); err != nil {
 				return nil
 			}
 		}
@@ -197,12 +205,63 @@ func (m *policyTransportScopesWithTransport) UnmarshalJSON(data []byte) error {
 	}); err != nil {
 		return err
 	}
+	if err := validateScopePrefixes(maps.Keys(tmpMap)); err != nil {
+		return err
+	}
 	for key, ptr := range tmpMap {
 		(*m.dest)[key] = *ptr
 	}
 	return nil
 }
 
+// scopePrefixSuffix marks a PolicyTransportScopes key as a prefix scope, matching all images
+// with a PolicyConfigurationIdentity() starting with the rest of the key.
+const scopePrefixSuffix = "*"
+
+// scopePrefix returns the prefix matched by scope, and true, if scope is a prefix scope.
+func scopePrefix(scope string) (string, bool) {
+	if !strings.HasSuffix(scope, scopePrefixSuffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(scope, scopePrefixSuffix), true
+}
+
+// validateScopePrefixes returns an error if any of the prefix scopes in scopes is invalid,
+// or could be confused with another scope.
+func validateScopePrefixes(scopes []string) error {
+	slices.Sort(scopes) // For deterministic error messages
+	exactScopes := set.New[string]()
+	for _, scope := range scopes {
+		if _, ok := scopePrefix(scope); !ok {
+			exactScopes.Add(scope)
+		}
+	}
+	for _, scope := range scopes {
+		prefix, ok := scopePrefix(scope)
+		if !ok {
+			continue
+		}
+		switch {
+		case prefix == "":
+			return InvalidPolicyFormatError(fmt.Sprintf(`Invalid scope %q: use "" to match all images`, scope))
+		case strings.Contains(prefix, scopePrefixSuffix):
+			return InvalidPolicyFormatError(fmt.Sprintf("Invalid scope %q: %q may only be used once, at the end of a prefix scope", scope, scopePrefixSuffix))
+		case strings.HasSuffix(prefix, "/"):
+			return InvalidPolicyFormatError(fmt.Sprintf("Invalid scope %q: use the namespace scope %q instead", scope, strings.TrimSuffix(prefix, "/")))
+		case exactScopes.Contains(prefix):
+			return InvalidPolicyFormatError(fmt.Sprintf("Scope %q is ambiguous with scope %q", scope, prefix))
+		}
+		// Namespace scopes take precedence over prefix scopes, so a prefix scope within a namespace scope would never be used.
+		for _, exact := range scopes {
+			if exact != "" && exactScopes.Contains(exact) &&
+				(strings.HasPrefix(prefix, exact+"/") || strings.HasPrefix(prefix, exact+":")) {
+				return InvalidPolicyFormatError(fmt.Sprintf("Scope %q would never be used, scope %q takes precedence", scope, exact))
+			}
+		}
+	}
+	return nil
+}
+
 // Compile-time check that PolicyRequirements implements json.Unmarshaler.
 var _ json.Unmarshaler = (*PolicyRequirements)(nil)
 
@@ -245,6 +304,12 @@ func newPolicyRequirementFromJSON(data []byte) (PolicyRequirement, error) {
 		res = &prSignedBaseLayer{}
 	case prTypeSigstoreSigned:
 		res = &prSigstoreSigned{}
+	case prTypeSigstoreAttestation:
+		res = &prSigstoreAttestation{}
+	case prTypeRemote:
+		res = &prRemote{}
+	case prTypeRejectSignedBy:
+		res = &prRejectSignedBy{}
 	default:
 		return nil, InvalidPolicyFormatError(fmt.Sprintf("Unknown policy requirement type \"%s\"", typeField.Type))
 	}
@@ -315,7 +380,7 @@ func (pr *prReject) UnmarshalJSON(data []byte) error {
 }
 
 // newPRSignedBy returns a new prSignedBy if parameters are valid.
-func newPRSignedBy(keyType sbKeyType, keyPath string, keyPaths []string, keyData []byte, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
+func newPRSignedBy(keyType sbKeyType, keyPath string, keyPaths []string, keyData []byte, keyDirectory string, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
 	if !keyType.IsValid() {
 		return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid keyType \"%s\"", keyType))
 	}
@@ -329,8 +394,11 @@ func newPRSignedBy(keyType sbKeyType, keyPath string, keyPaths []string, keyData
 	if keyData != nil {
 		keySources++
 	}
+	if keyDirectory != "" {
+		keySources++
+	}
 	if keySources != 1 {
-		return nil, InvalidPolicyFormatError("exactly one of keyPath, keyPaths and keyData must be specified")
+		return nil, InvalidPolicyFormatError("exactly one of keyPath, keyPaths, keyData and keyDirectory must be specified")
 	}
 	if signedIdentity == nil {
 		return nil, InvalidPolicyFormatError("signedIdentity not specified")
@@ -341,13 +409,14 @@ func newPRSignedBy(keyType sbKeyType, keyPath string, keyPaths []string, keyData
 		KeyPath:        keyPath,
 		KeyPaths:       keyPaths,
 		KeyData:        keyData,
+		KeyDirectory:   keyDirectory,
 		SignedIdentity: signedIdentity,
 	}, nil
 }
 
 // newPRSignedByKeyPath is NewPRSignedByKeyPath, except it returns the private type.
 func newPRSignedByKeyPath(keyType sbKeyType, keyPath string, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
-	return newPRSignedBy(keyType, keyPath, nil, nil, signedIdentity)
+	return newPRSignedBy(keyType, keyPath, nil, nil, "", signedIdentity)
 }
 
 // NewPRSignedByKeyPath returns a new "signedBy" PolicyRequirement using a KeyPath
@@ -357,7 +426,7 @@ func NewPRSignedByKeyPath(keyType sbKeyType, keyPath string, signedIdentity Poli
 
 // newPRSignedByKeyPaths is NewPRSignedByKeyPaths, except it returns the private type.
 func newPRSignedByKeyPaths(keyType sbKeyType, keyPaths []string, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
-	return newPRSignedBy(keyType, "", keyPaths, nil, signedIdentity)
+	return newPRSignedBy(keyType, "", keyPaths, nil, "", signedIdentity)
 }
 
 // NewPRSignedByKeyPaths returns a new "signedBy" PolicyRequirement using KeyPaths
@@ -367,7 +436,7 @@ func NewPRSignedByKeyPaths(keyType sbKeyType, keyPaths []string, signedIdentity
 
 // newPRSignedByKeyData is NewPRSignedByKeyData, except it returns the private type.
 func newPRSignedByKeyData(keyType sbKeyType, keyData []byte, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
-	return newPRSignedBy(keyType, "", nil, keyData, signedIdentity)
+	return newPRSignedBy(keyType, "", nil, keyData, "", signedIdentity)
 }
 
 // NewPRSignedByKeyData returns a new "signedBy" PolicyRequirement using a KeyData
@@ -375,6 +444,16 @@ func NewPRSignedByKeyData(keyType sbKeyType, keyData []byte, signedIdentity Poli
 	return newPRSignedByKeyData(keyType, keyData, signedIdentity)
 }
 
+// newPRSignedByKeyDirectory is NewPRSignedByKeyDirectory, except it returns the private type.
+func newPRSignedByKeyDirectory(keyType sbKeyType, keyDirectory string, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
+	return newPRSignedBy(keyType, "", nil, nil, keyDirectory, signedIdentity)
+}
+
+// NewPRSignedByKeyDirectory returns a new "signedBy" PolicyRequirement using a KeyDirectory
+func NewPRSignedByKeyDirectory(keyType sbKeyType, keyDirectory string, signedIdentity PolicyReferenceMatch) (PolicyRequirement, error) {
+	return newPRSignedByKeyDirectory(keyType, keyDirectory, signedIdentity)
+}
+
 // Compile-time check that prSignedBy implements json.Unmarshaler.
 var _ json.Unmarshaler = (*prSignedBy)(nil)
 
@@ -382,7 +461,7 @@ var _ json.Unmarshaler = (*prSignedBy)(nil)
 func (pr *prSignedBy) UnmarshalJSON(data []byte) error {
 	*pr = prSignedBy{}
 	var tmp prSignedBy
-	var gotKeyPath, gotKeyPaths, gotKeyData = false, false, false
+	var gotKeyPath, gotKeyPaths, gotKeyData, gotKeyDirectory = false, false, false, false
 	var signedIdentity json.RawMessage
 	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
 		switch key {
@@ -399,8 +478,13 @@ func (pr *prSignedBy) UnmarshalJSON(data []byte) error {
 		case "keyData":
 			gotKeyData = true
 			return &tmp.KeyData
+		case "keyDirectory":
+			gotKeyDirectory = true
+			return &tmp.KeyDirectory
 		case "signedIdentity":
 			return &signedIdentity
+		case "allowExpiredKeys":
+			return &tmp.AllowExpiredKeys
 		default:
 			return nil
 		}
@@ -424,20 +508,23 @@ func (pr *prSignedBy) UnmarshalJSON(data []byte) error {
 	var res *prSignedBy
 	var err error
 	switch {
-	case gotKeyPath && !gotKeyPaths && !gotKeyData:
+	case gotKeyPath && !gotKeyPaths && !gotKeyData && !gotKeyDirectory:
 		res, err = newPRSignedByKeyPath(tmp.KeyType, tmp.KeyPath, tmp.SignedIdentity)
-	case !gotKeyPath && gotKeyPaths && !gotKeyData:
+	case !gotKeyPath && gotKeyPaths && !gotKeyData && !gotKeyDirectory:
 		res, err = newPRSignedByKeyPaths(tmp.KeyType, tmp.KeyPaths, tmp.SignedIdentity)
-	case !gotKeyPath && !gotKeyPaths && gotKeyData:
+	case !gotKeyPath && !gotKeyPaths && gotKeyData && !gotKeyDirectory:
 		res, err = newPRSignedByKeyData(tmp.KeyType, tmp.KeyData, tmp.SignedIdentity)
-	case !gotKeyPath && !gotKeyPaths && !gotKeyData:
-		return InvalidPolicyFormatError("Exactly one of keyPath, keyPaths and keyData must be specified, none of them present")
+	case !gotKeyPath && !gotKeyPaths && !gotKeyData && gotKeyDirectory:
+		res, err = newPRSignedByKeyDirectory(tmp.KeyType, tmp.KeyDirectory, tmp.SignedIdentity)
+	case !gotKeyPath && !gotKeyPaths && !gotKeyData && !gotKeyDirectory:
+		return InvalidPolicyFormatError("Exactly one of keyPath, keyPaths, keyData and keyDirectory must be specified, none of them present")
 	default:
-		return fmt.Errorf("Exactly one of keyPath, keyPaths and keyData must be specified, more than one present")
+		return fmt.Errorf("Exactly one of keyPath, keyPaths, keyData and keyDirectory must be specified, more than one present")
 	}
 	if err != nil {
 		return err
 	}
+	res.AllowExpiredKeys = tmp.AllowExpiredKeys
 	*pr = *res
 
 	return nil
@@ -0,0 +1,102 @@
+package signature
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/signature/internal"
+)
+
+// PRRejectSignedByOption is way to pass values to NewPRRejectSignedBy
+type PRRejectSignedByOption func(*prRejectSignedBy) error
+
+// PRRejectSignedByWithKeyPath specifies a value for the "keyPath" field when calling NewPRRejectSignedBy.
+func PRRejectSignedByWithKeyPath(keyPath string) PRRejectSignedByOption {
+	return func(pr *prRejectSignedBy) error {
+		if pr.KeyPath != "" {
+			return errors.New(`"keyPath" already specified`)
+		}
+		pr.KeyPath = keyPath
+		return nil
+	}
+}
+
+// PRRejectSignedByWithKeyData specifies a value for the "keyData" field when calling NewPRRejectSignedBy.
+func PRRejectSignedByWithKeyData(keyData []byte) PRRejectSignedByOption {
+	return func(pr *prRejectSignedBy) error {
+		if pr.KeyData != nil {
+			return errors.New(`"keyData" already specified`)
+		}
+		pr.KeyData = keyData
+		return nil
+	}
+}
+
+// newPRRejectSignedBy is NewPRRejectSignedBy, except it returns the private type.
+func newPRRejectSignedBy(options ...PRRejectSignedByOption) (*prRejectSignedBy, error) {
+	res := prRejectSignedBy{
+		prCommon: prCommon{Type: prTypeRejectSignedBy},
+	}
+	for _, o := range options {
+		if err := o(&res); err != nil {
+			return nil, err
+		}
+	}
+
+	if (res.KeyPath != "") == (res.KeyData != nil) {
+		return nil, InvalidPolicyFormatError("exactly one of keyPath and keyData must be specified")
+	}
+
+	return &res, nil
+}
+
+// NewPRRejectSignedBy returns a new "rejectSignedBy" PolicyRequirement based on options.
+func NewPRRejectSignedBy(options ...PRRejectSignedByOption) (PolicyRequirement, error) {
+	return newPRRejectSignedBy(options...)
+}
+
+// Compile-time check that prRejectSignedBy implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prRejectSignedBy)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prRejectSignedBy) UnmarshalJSON(data []byte) error {
+	*pr = prRejectSignedBy{}
+	var tmp prRejectSignedBy
+	var gotKeyPath, gotKeyData bool
+	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
+		switch key {
+		case "type":
+			return &tmp.Type
+		case "keyPath":
+			gotKeyPath = true
+			return &tmp.KeyPath
+		case "keyData":
+			gotKeyData = true
+			return &tmp.KeyData
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeRejectSignedBy {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type \"%s\"", tmp.Type))
+	}
+
+	var opts []PRRejectSignedByOption
+	if gotKeyPath {
+		opts = append(opts, PRRejectSignedByWithKeyPath(tmp.KeyPath))
+	}
+	if gotKeyData {
+		opts = append(opts, PRRejectSignedByWithKeyData(tmp.KeyData))
+	}
+
+	res, err := newPRRejectSignedBy(opts...)
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
@@ -0,0 +1,105 @@
+package signature
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// xNewPRRejectSignedBy is like NewPRRejectSignedBy, except it must not fail.
+func xNewPRRejectSignedBy(options ...PRRejectSignedByOption) PolicyRequirement {
+	pr, err := NewPRRejectSignedBy(options...)
+	if err != nil {
+		panic("xNewPRRejectSignedBy failed")
+	}
+	return pr
+}
+
+func TestNewPRRejectSignedBy(t *testing.T) {
+	const testKeyPath = "/foo/bar"
+	testKeyData := []byte("abc")
+
+	// Success
+	for _, c := range []struct {
+		options  []PRRejectSignedByOption
+		expected prRejectSignedBy
+	}{
+		{
+			options: []PRRejectSignedByOption{PRRejectSignedByWithKeyPath(testKeyPath)},
+			expected: prRejectSignedBy{
+				prCommon: prCommon{prTypeRejectSignedBy},
+				KeyPath:  testKeyPath,
+			},
+		},
+		{
+			options: []PRRejectSignedByOption{PRRejectSignedByWithKeyData(testKeyData)},
+			expected: prRejectSignedBy{
+				prCommon: prCommon{prTypeRejectSignedBy},
+				KeyData:  testKeyData,
+			},
+		},
+	} {
+		pr, err := newPRRejectSignedBy(c.options...)
+		require.NoError(t, err)
+		assert.Equal(t, &c.expected, pr)
+	}
+
+	for _, c := range [][]PRRejectSignedByOption{
+		{}, // None of keyPath and keyData
+		{ // Both keyPath and keyData
+			PRRejectSignedByWithKeyPath(testKeyPath),
+			PRRejectSignedByWithKeyData(testKeyData),
+		},
+		{ // Duplicate keyPath
+			PRRejectSignedByWithKeyPath(testKeyPath),
+			PRRejectSignedByWithKeyPath(testKeyPath + "1"),
+		},
+		{ // Duplicate keyData
+			PRRejectSignedByWithKeyData(testKeyData),
+			PRRejectSignedByWithKeyData([]byte("def")),
+		},
+	} {
+		_, err := newPRRejectSignedBy(c...)
+		assert.Error(t, err)
+	}
+}
+
+func TestPRRejectSignedByUnmarshalJSON(t *testing.T) {
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prRejectSignedBy{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRRejectSignedBy(PRRejectSignedByWithKeyData([]byte("abc")))
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// The "type" field is missing
+			func(v mSA) { delete(v, "type") },
+			// Wrong "type" field
+			func(v mSA) { v["type"] = 1 },
+			func(v mSA) { v["type"] = "this is invalid" },
+			// Extra top-level sub-object
+			func(v mSA) { v["unexpected"] = 1 },
+			// Both "keyPath" and "keyData" are missing
+			func(v mSA) { delete(v, "keyData") },
+			// Both "keyPath" and "keyData" are present
+			func(v mSA) { v["keyPath"] = "/foo/bar" },
+			// Invalid "keyPath" field
+			func(v mSA) { delete(v, "keyData"); v["keyPath"] = 1 },
+			// Invalid "keyData" field
+			func(v mSA) { v["keyData"] = 1 },
+			func(v mSA) { v["keyData"] = "this is invalid base64" },
+		},
+		duplicateFields: []string{"type", "keyData"},
+	}.run(t)
+	// Test keyPath-specific duplicate fields
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prRejectSignedBy{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRRejectSignedBy(PRRejectSignedByWithKeyPath("/foo/bar"))
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "keyPath"},
+	}.run(t)
+}
@@ -0,0 +1,168 @@
+package signature
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/containers/image/v5/signature/internal"
+)
+
+// prRemoteDefaultTimeout is the timeout of requests to the decision service, if prRemote.Timeout is not specified.
+const prRemoteDefaultTimeout = 10 * time.Second
+
+// PRRemoteOption is way to pass values to NewPRRemote
+type PRRemoteOption func(*prRemote) error
+
+// PRRemoteWithURL specifies a value for the "url" field when calling NewPRRemote.
+func PRRemoteWithURL(url string) PRRemoteOption {
+	return func(pr *prRemote) error {
+		if pr.URL != "" {
+			return errors.New(`"url" already specified`)
+		}
+		pr.URL = url
+		return nil
+	}
+}
+
+// PRRemoteWithTimeout specifies a value for the "timeout" field when calling NewPRRemote.
+func PRRemoteWithTimeout(timeout time.Duration) PRRemoteOption {
+	return func(pr *prRemote) error {
+		if pr.Timeout != "" {
+			return errors.New(`"timeout" already specified`)
+		}
+		pr.Timeout = timeout.String()
+		return nil
+	}
+}
+
+// prRemoteWithTimeoutString is PRRemoteWithTimeout, except that it accepts the JSON representation.
+func prRemoteWithTimeoutString(timeout string) PRRemoteOption {
+	return func(pr *prRemote) error {
+		if pr.Timeout != "" {
+			return errors.New(`"timeout" already specified`)
+		}
+		pr.Timeout = timeout
+		return nil
+	}
+}
+
+// PRRemoteWithFailureMode specifies a value for the "failureMode" field when calling NewPRRemote.
+func PRRemoteWithFailureMode(mode prRemoteFailureMode) PRRemoteOption {
+	return func(pr *prRemote) error {
+		if pr.FailureMode != "" {
+			return errors.New(`"failureMode" already specified`)
+		}
+		pr.FailureMode = mode
+		return nil
+	}
+}
+
+// newPRRemote is NewPRRemote, except it returns the private type.
+func newPRRemote(options ...PRRemoteOption) (*prRemote, error) {
+	res := prRemote{
+		prCommon: prCommon{Type: prTypeRemote},
+	}
+	for _, o := range options {
+		if err := o(&res); err != nil {
+			return nil, err
+		}
+	}
+
+	if res.URL == "" {
+		return nil, InvalidPolicyFormatError("url not specified")
+	}
+	u, err := url.Parse(res.URL)
+	if err != nil {
+		return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid url %q: %v", res.URL, err))
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid url %q: only http:// and https:// URLs are supported", res.URL))
+	}
+	if res.Timeout != "" {
+		timeout, err := time.ParseDuration(res.Timeout)
+		if err != nil {
+			return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid timeout %q: %v", res.Timeout, err))
+		}
+		if timeout <= 0 {
+			return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid timeout %q: must be positive", res.Timeout))
+		}
+	}
+	switch res.FailureMode {
+	case "", PRRemoteFailClosed, PRRemoteFailOpen:
+	default:
+		return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid failureMode %q", res.FailureMode))
+	}
+
+	return &res, nil
+}
+
+// NewPRRemote returns a new "remote" PolicyRequirement based on options.
+func NewPRRemote(options ...PRRemoteOption) (PolicyRequirement, error) {
+	return newPRRemote(options...)
+}
+
+// Compile-time check that prRemote implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prRemote)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prRemote) UnmarshalJSON(data []byte) error {
+	*pr = prRemote{}
+	var tmp prRemote
+	var gotURL, gotTimeout, gotFailureMode bool
+	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
+		switch key {
+		case "type":
+			return &tmp.Type
+		case "url":
+			gotURL = true
+			return &tmp.URL
+		case "timeout":
+			gotTimeout = true
+			return &tmp.Timeout
+		case "failureMode":
+			gotFailureMode = true
+			return &tmp.FailureMode
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeRemote {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type \"%s\"", tmp.Type))
+	}
+
+	var opts []PRRemoteOption
+	if gotURL {
+		opts = append(opts, PRRemoteWithURL(tmp.URL))
+	}
+	if gotTimeout {
+		opts = append(opts, prRemoteWithTimeoutString(tmp.Timeout))
+	}
+	if gotFailureMode {
+		opts = append(opts, PRRemoteWithFailureMode(tmp.FailureMode))
+	}
+
+	res, err := newPRRemote(opts...)
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
+
+// timeout returns the timeout of requests to the decision service.
+func (pr *prRemote) timeout() time.Duration {
+	if pr.Timeout == "" {
+		return prRemoteDefaultTimeout
+	}
+	timeout, err := time.ParseDuration(pr.Timeout)
+	if err != nil || timeout <= 0 { // Should have been rejected by newPRRemote
+		return prRemoteDefaultTimeout
+	}
+	return timeout
+}
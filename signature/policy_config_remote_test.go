@@ -0,0 +1,112 @@
+package signature
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPRRemote(t *testing.T) {
+	const testURL = "https://decisions.example.com/v1/allow"
+
+	// Success
+	for _, c := range []struct {
+		options  []PRRemoteOption
+		expected prRemote
+	}{
+		{
+			options: []PRRemoteOption{PRRemoteWithURL(testURL)},
+			expected: prRemote{
+				prCommon: prCommon{prTypeRemote},
+				URL:      testURL,
+			},
+		},
+		{
+			options: []PRRemoteOption{
+				PRRemoteWithURL("http://localhost:8181/allow"),
+				PRRemoteWithTimeout(500 * time.Millisecond),
+				PRRemoteWithFailureMode(PRRemoteFailOpen),
+			},
+			expected: prRemote{
+				prCommon:    prCommon{prTypeRemote},
+				URL:         "http://localhost:8181/allow",
+				Timeout:     "500ms",
+				FailureMode: PRRemoteFailOpen,
+			},
+		},
+	} {
+		pr, err := newPRRemote(c.options...)
+		require.NoError(t, err)
+		assert.Equal(t, &c.expected, pr)
+	}
+
+	for _, c := range [][]PRRemoteOption{
+		{}, // Missing url
+		{PRRemoteWithURL("decisions.example.com")},                    // Not an absolute URL
+		{PRRemoteWithURL("grpc://decisions.example.com:9191")},        // Unsupported scheme
+		{PRRemoteWithURL("https://")},                                 // Missing host
+		{PRRemoteWithURL(testURL), PRRemoteWithTimeout(0)},            // Invalid timeout
+		{PRRemoteWithURL(testURL), PRRemoteWithTimeout(-time.Second)}, // Invalid timeout
+		{PRRemoteWithURL(testURL), PRRemoteWithFailureMode("this is invalid")},
+		{PRRemoteWithURL(testURL), PRRemoteWithURL(testURL + "1")}, // Duplicate url
+		{ // Duplicate timeout
+			PRRemoteWithURL(testURL),
+			PRRemoteWithTimeout(time.Second),
+			PRRemoteWithTimeout(2 * time.Second),
+		},
+		{ // Duplicate failureMode
+			PRRemoteWithURL(testURL),
+			PRRemoteWithFailureMode(PRRemoteFailOpen),
+			PRRemoteWithFailureMode(PRRemoteFailClosed),
+		},
+	} {
+		_, err := newPRRemote(c...)
+		assert.Error(t, err)
+	}
+}
+
+func TestPRRemoteUnmarshalJSON(t *testing.T) {
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prRemote{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRRemote(
+				PRRemoteWithURL("https://decisions.example.com/v1/allow"),
+				PRRemoteWithTimeout(3*time.Second),
+				PRRemoteWithFailureMode(PRRemoteFailClosed),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// The "type" field is missing
+			func(v mSA) { delete(v, "type") },
+			// Wrong "type" field
+			func(v mSA) { v["type"] = 1 },
+			func(v mSA) { v["type"] = "this is invalid" },
+			// Extra top-level sub-object
+			func(v mSA) { v["unexpected"] = 1 },
+			// The "url" field is missing
+			func(v mSA) { delete(v, "url") },
+			// Invalid "url" field
+			func(v mSA) { v["url"] = 1 },
+			func(v mSA) { v["url"] = "ftp://decisions.example.com" },
+			// Invalid "timeout" field
+			func(v mSA) { v["timeout"] = 1 },
+			func(v mSA) { v["timeout"] = "this is invalid" },
+			func(v mSA) { v["timeout"] = "-1s" },
+			// Invalid "failureMode" field
+			func(v mSA) { v["failureMode"] = 1 },
+			func(v mSA) { v["failureMode"] = "this is invalid" },
+		},
+		duplicateFields: []string{"type", "url", "timeout", "failureMode"},
+	}.run(t)
+
+	// "timeout" and "failureMode" are optional
+	var pr prRemote
+	err := json.Unmarshal([]byte(`{"type":"remote","url":"https://decisions.example.com"}`), &pr)
+	require.NoError(t, err)
+	assert.Equal(t, prRemote{prCommon: prCommon{prTypeRemote}, URL: "https://decisions.example.com"}, pr)
+	assert.Equal(t, prRemoteDefaultTimeout, pr.timeout())
+}
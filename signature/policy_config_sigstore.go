@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/containers/image/v5/internal/set"
 	"github.com/containers/image/v5/signature/internal"
 )
 
@@ -22,6 +24,20 @@ func PRSigstoreSignedWithKeyPath(keyPath string) PRSigstoreSignedOption {
 	}
 }
 
+// PRSigstoreSignedWithKeyPaths specifies a value for the "keyPaths" field when calling NewPRSigstoreSigned.
+func PRSigstoreSignedWithKeyPaths(keyPaths []string) PRSigstoreSignedOption {
+	return func(pr *prSigstoreSigned) error {
+		if pr.KeyPaths != nil {
+			return errors.New(`"keyPaths" already specified`)
+		}
+		if len(keyPaths) == 0 {
+			return errors.New(`"keyPaths" contains no entries`)
+		}
+		pr.KeyPaths = keyPaths
+		return nil
+	}
+}
+
 // PRSigstoreSignedWithKeyData specifies a value for the "keyData" field when calling NewPRSigstoreSigned.
 func PRSigstoreSignedWithKeyData(keyData []byte) PRSigstoreSignedOption {
 	return func(pr *prSigstoreSigned) error {
@@ -33,6 +49,20 @@ func PRSigstoreSignedWithKeyData(keyData []byte) PRSigstoreSignedOption {
 	}
 }
 
+// PRSigstoreSignedWithKeyDatas specifies a value for the "keyDatas" field when calling NewPRSigstoreSigned.
+func PRSigstoreSignedWithKeyDatas(keyDatas [][]byte) PRSigstoreSignedOption {
+	return func(pr *prSigstoreSigned) error {
+		if pr.KeyDatas != nil {
+			return errors.New(`"keyDatas" already specified`)
+		}
+		if len(keyDatas) == 0 {
+			return errors.New(`"keyDatas" contains no entries`)
+		}
+		pr.KeyDatas = keyDatas
+		return nil
+	}
+}
+
 // PRSigstoreSignedWithFulcio specifies a value for the "fulcio" field when calling NewPRSigstoreSigned.
 func PRSigstoreSignedWithFulcio(fulcio PRSigstoreSignedFulcio) PRSigstoreSignedOption {
 	return func(pr *prSigstoreSigned) error {
@@ -66,6 +96,20 @@ func PRSigstoreSignedWithRekorPublicKeyData(rekorPublicKeyData []byte) PRSigstor
 	}
 }
 
+// PRSigstoreSignedWithMinimumSignatures specifies a value for the "minimumSignatures" field when calling NewPRSigstoreSigned.
+func PRSigstoreSignedWithMinimumSignatures(minimumSignatures int) PRSigstoreSignedOption {
+	return func(pr *prSigstoreSigned) error {
+		if pr.MinimumSignatures != 0 {
+			return errors.New(`"minimumSignatures" already specified`)
+		}
+		if minimumSignatures < 1 {
+			return fmt.Errorf(`"minimumSignatures" must be at least 1, not %d`, minimumSignatures)
+		}
+		pr.MinimumSignatures = minimumSignatures
+		return nil
+	}
+}
+
 // PRSigstoreSignedWithSignedIdentity specifies a value for the "signedIdentity" field when calling NewPRSigstoreSigned.
 func PRSigstoreSignedWithSignedIdentity(signedIdentity PolicyReferenceMatch) PRSigstoreSignedOption {
 	return func(pr *prSigstoreSigned) error {
@@ -77,6 +121,50 @@ func PRSigstoreSignedWithSignedIdentity(signedIdentity PolicyReferenceMatch) PRS
 	}
 }
 
+// PRSigstoreSignedWithRequiredAnnotations specifies a value for the "requiredAnnotations" field when calling NewPRSigstoreSigned.
+func PRSigstoreSignedWithRequiredAnnotations(requiredAnnotations map[string]string) PRSigstoreSignedOption {
+	return func(pr *prSigstoreSigned) error {
+		if pr.RequiredAnnotations != nil {
+			return errors.New(`"requiredAnnotations" already specified`)
+		}
+		pr.RequiredAnnotations = requiredAnnotations
+		return nil
+	}
+}
+
+// PRSigstoreSignedWithSignedAfter specifies a value for the "signedAfter" field when calling NewPRSigstoreSigned.
+func PRSigstoreSignedWithSignedAfter(signedAfter time.Time) PRSigstoreSignedOption {
+	return func(pr *prSigstoreSigned) error {
+		if pr.SignedAfter != nil {
+			return errors.New(`"signedAfter" already specified`)
+		}
+		pr.SignedAfter = &signedAfter
+		return nil
+	}
+}
+
+// PRSigstoreSignedWithTSACertificatePath specifies a value for the "tsaCertificatePath" field when calling NewPRSigstoreSigned.
+func PRSigstoreSignedWithTSACertificatePath(tsaCertificatePath string) PRSigstoreSignedOption {
+	return func(pr *prSigstoreSigned) error {
+		if pr.TSACertificatePath != "" {
+			return errors.New(`"tsaCertificatePath" already specified`)
+		}
+		pr.TSACertificatePath = tsaCertificatePath
+		return nil
+	}
+}
+
+// PRSigstoreSignedWithTSACertificateData specifies a value for the "tsaCertificateData" field when calling NewPRSigstoreSigned.
+func PRSigstoreSignedWithTSACertificateData(tsaCertificateData []byte) PRSigstoreSignedOption {
+	return func(pr *prSigstoreSigned) error {
+		if pr.TSACertificateData != nil {
+			return errors.New(`"tsaCertificateData" already specified`)
+		}
+		pr.TSACertificateData = tsaCertificateData
+		return nil
+	}
+}
+
 // newPRSigstoreSigned is NewPRSigstoreSigned, except it returns the private type.
 func newPRSigstoreSigned(options ...PRSigstoreSignedOption) (*prSigstoreSigned, error) {
 	res := prSigstoreSigned{
@@ -92,14 +180,20 @@ func newPRSigstoreSigned(options ...PRSigstoreSignedOption) (*prSigstoreSigned,
 	if res.KeyPath != "" {
 		keySources++
 	}
+	if res.KeyPaths != nil {
+		keySources++
+	}
 	if res.KeyData != nil {
 		keySources++
 	}
+	if res.KeyDatas != nil {
+		keySources++
+	}
 	if res.Fulcio != nil {
 		keySources++
 	}
 	if keySources != 1 {
-		return nil, InvalidPolicyFormatError("exactly one of keyPath, keyData and fulcio must be specified")
+		return nil, InvalidPolicyFormatError("exactly one of keyPath, keyPaths, keyData, keyDatas and fulcio must be specified")
 	}
 
 	if res.RekorPublicKeyPath != "" && res.RekorPublicKeyData != nil {
@@ -108,6 +202,31 @@ func newPRSigstoreSigned(options ...PRSigstoreSignedOption) (*prSigstoreSigned,
 	if res.Fulcio != nil && res.RekorPublicKeyPath == "" && res.RekorPublicKeyData == nil {
 		return nil, InvalidPolicyFormatError("At least one of RekorPublickeyPath and RekorPublickeyData must be specified if fulcio is used")
 	}
+	if res.TSACertificatePath != "" && res.TSACertificateData != nil {
+		return nil, InvalidPolicyFormatError("tsaCertificatePath and tsaCertificateData cannot be used simultaneously")
+	}
+
+	if res.MinimumSignatures != 0 {
+		keys := 0
+		switch {
+		case res.KeyPath != "" || res.KeyData != nil:
+			keys = 1
+		case res.KeyPaths != nil:
+			keys = len(set.NewWithValues(res.KeyPaths...).Values())
+		case res.KeyDatas != nil:
+			keyDatas := set.New[string]()
+			for _, keyData := range res.KeyDatas {
+				keyDatas.Add(string(keyData))
+			}
+			keys = len(keyDatas.Values())
+		default: // res.Fulcio != nil
+			return nil, InvalidPolicyFormatError("minimumSignatures cannot be used with fulcio")
+		}
+		// Different paths or data may still contain the same key; that is only detected when the keys are loaded.
+		if res.MinimumSignatures > keys {
+			return nil, InvalidPolicyFormatError(fmt.Sprintf("minimumSignatures (%d) is larger than the number of distinct keys (%d)", res.MinimumSignatures, keys))
+		}
+	}
 
 	if res.SignedIdentity == nil {
 		return nil, InvalidPolicyFormatError("signedIdentity not specified")
@@ -144,7 +263,7 @@ var _ json.Unmarshaler = (*prSigstoreSigned)(nil)
 func (pr *prSigstoreSigned) UnmarshalJSON(data []byte) error {
 	*pr = prSigstoreSigned{}
 	var tmp prSigstoreSigned
-	var gotKeyPath, gotKeyData, gotFulcio, gotRekorPublicKeyPath, gotRekorPublicKeyData bool
+	var gotKeyPath, gotKeyPaths, gotKeyData, gotKeyDatas, gotFulcio, gotRekorPublicKeyPath, gotRekorPublicKeyData, gotMinimumSignatures, gotRequiredAnnotations, gotSignedAfter, gotTSACertificatePath, gotTSACertificateData bool
 	var fulcio prSigstoreSignedFulcio
 	var signedIdentity json.RawMessage
 	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
@@ -154,9 +273,15 @@ func (pr *prSigstoreSigned) UnmarshalJSON(data []byte) error {
 		case "keyPath":
 			gotKeyPath = true
 			return &tmp.KeyPath
+		case "keyPaths":
+			gotKeyPaths = true
+			return &tmp.KeyPaths
 		case "keyData":
 			gotKeyData = true
 			return &tmp.KeyData
+		case "keyDatas":
+			gotKeyDatas = true
+			return &tmp.KeyDatas
 		case "fulcio":
 			gotFulcio = true
 			return &fulcio
@@ -166,8 +291,23 @@ func (pr *prSigstoreSigned) UnmarshalJSON(data []byte) error {
 		case "rekorPublicKeyData":
 			gotRekorPublicKeyData = true
 			return &tmp.RekorPublicKeyData
+		case "minimumSignatures":
+			gotMinimumSignatures = true
+			return &tmp.MinimumSignatures
 		case "signedIdentity":
 			return &signedIdentity
+		case "requiredAnnotations":
+			gotRequiredAnnotations = true
+			return &tmp.RequiredAnnotations
+		case "signedAfter":
+			gotSignedAfter = true
+			return &tmp.SignedAfter
+		case "tsaCertificatePath":
+			gotTSACertificatePath = true
+			return &tmp.TSACertificatePath
+		case "tsaCertificateData":
+			gotTSACertificateData = true
+			return &tmp.TSACertificateData
 		default:
 			return nil
 		}
@@ -192,9 +332,15 @@ func (pr *prSigstoreSigned) UnmarshalJSON(data []byte) error {
 	if gotKeyPath {
 		opts = append(opts, PRSigstoreSignedWithKeyPath(tmp.KeyPath))
 	}
+	if gotKeyPaths {
+		opts = append(opts, PRSigstoreSignedWithKeyPaths(tmp.KeyPaths))
+	}
 	if gotKeyData {
 		opts = append(opts, PRSigstoreSignedWithKeyData(tmp.KeyData))
 	}
+	if gotKeyDatas {
+		opts = append(opts, PRSigstoreSignedWithKeyDatas(tmp.KeyDatas))
+	}
 	if gotFulcio {
 		opts = append(opts, PRSigstoreSignedWithFulcio(&fulcio))
 	}
@@ -204,6 +350,24 @@ func (pr *prSigstoreSigned) UnmarshalJSON(data []byte) error {
 	if gotRekorPublicKeyData {
 		opts = append(opts, PRSigstoreSignedWithRekorPublicKeyData(tmp.RekorPublicKeyData))
 	}
+	if gotMinimumSignatures {
+		opts = append(opts, PRSigstoreSignedWithMinimumSignatures(tmp.MinimumSignatures))
+	}
+	if gotRequiredAnnotations {
+		opts = append(opts, PRSigstoreSignedWithRequiredAnnotations(tmp.RequiredAnnotations))
+	}
+	if gotSignedAfter {
+		if tmp.SignedAfter == nil {
+			return InvalidPolicyFormatError(`"signedAfter" must be a timestamp, not null`)
+		}
+		opts = append(opts, PRSigstoreSignedWithSignedAfter(*tmp.SignedAfter))
+	}
+	if gotTSACertificatePath {
+		opts = append(opts, PRSigstoreSignedWithTSACertificatePath(tmp.TSACertificatePath))
+	}
+	if gotTSACertificateData {
+		opts = append(opts, PRSigstoreSignedWithTSACertificateData(tmp.TSACertificateData))
+	}
 	opts = append(opts, PRSigstoreSignedWithSignedIdentity(tmp.SignedIdentity))
 
 	res, err := newPRSigstoreSigned(opts...)
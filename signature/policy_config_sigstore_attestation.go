@@ -0,0 +1,143 @@
+package signature
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/signature/internal"
+)
+
+// PRSigstoreAttestationOption is way to pass values to NewPRSigstoreAttestation
+type PRSigstoreAttestationOption func(*prSigstoreAttestation) error
+
+// PRSigstoreAttestationWithKeyPath specifies a value for the "keyPath" field when calling NewPRSigstoreAttestation.
+func PRSigstoreAttestationWithKeyPath(keyPath string) PRSigstoreAttestationOption {
+	return func(pr *prSigstoreAttestation) error {
+		if pr.KeyPath != "" {
+			return errors.New(`"keyPath" already specified`)
+		}
+		pr.KeyPath = keyPath
+		return nil
+	}
+}
+
+// PRSigstoreAttestationWithKeyData specifies a value for the "keyData" field when calling NewPRSigstoreAttestation.
+func PRSigstoreAttestationWithKeyData(keyData []byte) PRSigstoreAttestationOption {
+	return func(pr *prSigstoreAttestation) error {
+		if pr.KeyData != nil {
+			return errors.New(`"keyData" already specified`)
+		}
+		pr.KeyData = keyData
+		return nil
+	}
+}
+
+// PRSigstoreAttestationWithPredicateType specifies a value for the "predicateType" field when calling NewPRSigstoreAttestation.
+func PRSigstoreAttestationWithPredicateType(predicateType string) PRSigstoreAttestationOption {
+	return func(pr *prSigstoreAttestation) error {
+		if pr.PredicateType != "" {
+			return errors.New(`"predicateType" already specified`)
+		}
+		pr.PredicateType = predicateType
+		return nil
+	}
+}
+
+// PRSigstoreAttestationWithSignedIdentity specifies a value for the "signedIdentity" field when calling NewPRSigstoreAttestation.
+func PRSigstoreAttestationWithSignedIdentity(signedIdentity PolicyReferenceMatch) PRSigstoreAttestationOption {
+	return func(pr *prSigstoreAttestation) error {
+		if pr.SignedIdentity != nil {
+			return errors.New(`"signedIdentity" already specified`)
+		}
+		pr.SignedIdentity = signedIdentity
+		return nil
+	}
+}
+
+// newPRSigstoreAttestation is NewPRSigstoreAttestation, except it returns the private type.
+func newPRSigstoreAttestation(options ...PRSigstoreAttestationOption) (*prSigstoreAttestation, error) {
+	res := prSigstoreAttestation{
+		prCommon: prCommon{Type: prTypeSigstoreAttestation},
+	}
+	for _, o := range options {
+		if err := o(&res); err != nil {
+			return nil, err
+		}
+	}
+
+	if (res.KeyPath != "") == (res.KeyData != nil) {
+		return nil, InvalidPolicyFormatError("exactly one of keyPath and keyData must be specified")
+	}
+	if res.PredicateType == "" {
+		return nil, InvalidPolicyFormatError("predicateType not specified")
+	}
+
+	return &res, nil
+}
+
+// NewPRSigstoreAttestation returns a new "sigstoreAttestation" PolicyRequirement based on options.
+func NewPRSigstoreAttestation(options ...PRSigstoreAttestationOption) (PolicyRequirement, error) {
+	return newPRSigstoreAttestation(options...)
+}
+
+// Compile-time check that prSigstoreAttestation implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prSigstoreAttestation)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prSigstoreAttestation) UnmarshalJSON(data []byte) error {
+	*pr = prSigstoreAttestation{}
+	var tmp prSigstoreAttestation
+	var gotKeyPath, gotKeyData, gotPredicateType bool
+	var signedIdentity json.RawMessage
+	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
+		switch key {
+		case "type":
+			return &tmp.Type
+		case "keyPath":
+			gotKeyPath = true
+			return &tmp.KeyPath
+		case "keyData":
+			gotKeyData = true
+			return &tmp.KeyData
+		case "predicateType":
+			gotPredicateType = true
+			return &tmp.PredicateType
+		case "signedIdentity":
+			return &signedIdentity
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeSigstoreAttestation {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type \"%s\"", tmp.Type))
+	}
+
+	var opts []PRSigstoreAttestationOption
+	if gotKeyPath {
+		opts = append(opts, PRSigstoreAttestationWithKeyPath(tmp.KeyPath))
+	}
+	if gotKeyData {
+		opts = append(opts, PRSigstoreAttestationWithKeyData(tmp.KeyData))
+	}
+	if gotPredicateType {
+		opts = append(opts, PRSigstoreAttestationWithPredicateType(tmp.PredicateType))
+	}
+	if signedIdentity != nil {
+		si, err := newPolicyReferenceMatchFromJSON(signedIdentity)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, PRSigstoreAttestationWithSignedIdentity(si))
+	}
+
+	res, err := newPRSigstoreAttestation(opts...)
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
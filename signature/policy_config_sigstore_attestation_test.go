@@ -0,0 +1,153 @@
+package signature
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPRSigstoreAttestation(t *testing.T) {
+	const testKeyPath = "/foo/bar"
+	testKeyData := []byte("abc")
+	const testPredicateType = "https://slsa.dev/provenance/v1"
+	testIdentity := NewPRMMatchRepository()
+
+	// Success
+	for _, c := range []struct {
+		options  []PRSigstoreAttestationOption
+		expected prSigstoreAttestation
+	}{
+		{
+			options: []PRSigstoreAttestationOption{
+				PRSigstoreAttestationWithKeyPath(testKeyPath),
+				PRSigstoreAttestationWithPredicateType(testPredicateType),
+			},
+			expected: prSigstoreAttestation{
+				prCommon:      prCommon{prTypeSigstoreAttestation},
+				KeyPath:       testKeyPath,
+				PredicateType: testPredicateType,
+			},
+		},
+		{
+			options: []PRSigstoreAttestationOption{
+				PRSigstoreAttestationWithKeyData(testKeyData),
+				PRSigstoreAttestationWithPredicateType(testPredicateType),
+				PRSigstoreAttestationWithSignedIdentity(testIdentity),
+			},
+			expected: prSigstoreAttestation{
+				prCommon:       prCommon{prTypeSigstoreAttestation},
+				KeyData:        testKeyData,
+				PredicateType:  testPredicateType,
+				SignedIdentity: testIdentity,
+			},
+		},
+	} {
+		pr, err := newPRSigstoreAttestation(c.options...)
+		require.NoError(t, err)
+		assert.Equal(t, &c.expected, pr)
+	}
+
+	for _, c := range [][]PRSigstoreAttestationOption{
+		{}, // None of keyPath and keyData
+		{ // Both keyPath and keyData
+			PRSigstoreAttestationWithKeyPath(testKeyPath),
+			PRSigstoreAttestationWithKeyData(testKeyData),
+			PRSigstoreAttestationWithPredicateType(testPredicateType),
+		},
+		{ // Missing predicateType
+			PRSigstoreAttestationWithKeyPath(testKeyPath),
+		},
+		{ // Duplicate keyPath
+			PRSigstoreAttestationWithKeyPath(testKeyPath),
+			PRSigstoreAttestationWithKeyPath(testKeyPath + "1"),
+			PRSigstoreAttestationWithPredicateType(testPredicateType),
+		},
+		{ // Duplicate keyData
+			PRSigstoreAttestationWithKeyData(testKeyData),
+			PRSigstoreAttestationWithKeyData([]byte("def")),
+			PRSigstoreAttestationWithPredicateType(testPredicateType),
+		},
+		{ // Duplicate predicateType
+			PRSigstoreAttestationWithKeyPath(testKeyPath),
+			PRSigstoreAttestationWithPredicateType(testPredicateType),
+			PRSigstoreAttestationWithPredicateType("https://example.com/other"),
+		},
+		{ // Duplicate signedIdentity
+			PRSigstoreAttestationWithKeyPath(testKeyPath),
+			PRSigstoreAttestationWithPredicateType(testPredicateType),
+			PRSigstoreAttestationWithSignedIdentity(testIdentity),
+			PRSigstoreAttestationWithSignedIdentity(newPRMMatchRepoDigestOrExact()),
+		},
+	} {
+		_, err := newPRSigstoreAttestation(c...)
+		assert.Error(t, err)
+	}
+}
+
+func TestPRSigstoreAttestationUnmarshalJSON(t *testing.T) {
+	keyDataTests := policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreAttestation{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreAttestation(
+				PRSigstoreAttestationWithKeyData([]byte("abc")),
+				PRSigstoreAttestationWithPredicateType("https://slsa.dev/provenance/v1"),
+				PRSigstoreAttestationWithSignedIdentity(NewPRMMatchRepository()),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// The "type" field is missing
+			func(v mSA) { delete(v, "type") },
+			// Wrong "type" field
+			func(v mSA) { v["type"] = 1 },
+			func(v mSA) { v["type"] = "this is invalid" },
+			// Extra top-level sub-object
+			func(v mSA) { v["unexpected"] = 1 },
+			// Both "keyPath" and "keyData" are missing
+			func(v mSA) { delete(v, "keyData") },
+			// Both "keyPath" and "keyData" are present
+			func(v mSA) { v["keyPath"] = "/foo/bar" },
+			// Invalid "keyPath" field
+			func(v mSA) { delete(v, "keyData"); v["keyPath"] = 1 },
+			// Invalid "keyData" field
+			func(v mSA) { v["keyData"] = 1 },
+			func(v mSA) { v["keyData"] = "this is invalid base64" },
+			// The "predicateType" field is missing
+			func(v mSA) { delete(v, "predicateType") },
+			// Invalid "predicateType" field
+			func(v mSA) { v["predicateType"] = 1 },
+			func(v mSA) { v["predicateType"] = "" },
+			// Invalid "signedIdentity" field
+			func(v mSA) { v["signedIdentity"] = "this is invalid" },
+		},
+		duplicateFields: []string{"type", "keyData", "predicateType", "signedIdentity"},
+	}
+	keyDataTests.run(t)
+	// Test keyPath-specific duplicate fields
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreAttestation{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreAttestation(
+				PRSigstoreAttestationWithKeyPath("/foo/bar"),
+				PRSigstoreAttestationWithPredicateType("https://slsa.dev/provenance/v1"),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "keyPath", "predicateType"},
+	}.run(t)
+
+	// "signedIdentity" is optional
+	var pr prSigstoreAttestation
+	_, validJSON := keyDataTests.validObjectAndJSON(t)
+	var tmp mSA
+	err := json.Unmarshal(validJSON, &tmp)
+	require.NoError(t, err)
+	delete(tmp, "signedIdentity")
+	testJSON, err := json.Marshal(tmp)
+	require.NoError(t, err)
+	err = json.Unmarshal(testJSON, &pr)
+	require.NoError(t, err)
+	assert.Nil(t, pr.SignedIdentity)
+}
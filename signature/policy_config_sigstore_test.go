@@ -3,6 +3,7 @@ package signature
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -20,7 +21,12 @@ func xNewPRSigstoreSigned(options ...PRSigstoreSignedOption) PolicyRequirement {
 
 func TestNewPRSigstoreSigned(t *testing.T) {
 	const testKeyPath = "/foo/bar"
+	testKeyPaths := []string{"/foo/bar", "/foo/baz"}
 	testKeyData := []byte("abc")
+	testKeyDatas := [][]byte{[]byte("abc"), []byte("def")}
+	testSignedAfter := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	const testTSACertificatePath = "/foo/tsa"
+	testTSACertificateData := []byte("tsa")
 	testFulcio, err := NewPRSigstoreSignedFulcio(
 		PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
 		PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"),
@@ -50,6 +56,41 @@ func TestNewPRSigstoreSigned(t *testing.T) {
 				SignedIdentity: testIdentity,
 			},
 		},
+		{
+			options: []PRSigstoreSignedOption{
+				PRSigstoreSignedWithKeyPaths(testKeyPaths),
+				PRSigstoreSignedWithSignedIdentity(testIdentity),
+			},
+			expected: prSigstoreSigned{
+				prCommon:       prCommon{prTypeSigstoreSigned},
+				KeyPaths:       testKeyPaths,
+				SignedIdentity: testIdentity,
+			},
+		},
+		{
+			options: []PRSigstoreSignedOption{
+				PRSigstoreSignedWithKeyDatas(testKeyDatas),
+				PRSigstoreSignedWithSignedIdentity(testIdentity),
+			},
+			expected: prSigstoreSigned{
+				prCommon:       prCommon{prTypeSigstoreSigned},
+				KeyDatas:       testKeyDatas,
+				SignedIdentity: testIdentity,
+			},
+		},
+		{
+			options: []PRSigstoreSignedOption{
+				PRSigstoreSignedWithKeyPaths(testKeyPaths),
+				PRSigstoreSignedWithMinimumSignatures(2),
+				PRSigstoreSignedWithSignedIdentity(testIdentity),
+			},
+			expected: prSigstoreSigned{
+				prCommon:          prCommon{prTypeSigstoreSigned},
+				KeyPaths:          testKeyPaths,
+				MinimumSignatures: 2,
+				SignedIdentity:    testIdentity,
+			},
+		},
 		{
 			options: []PRSigstoreSignedOption{
 				PRSigstoreSignedWithKeyData(testKeyData),
@@ -63,6 +104,58 @@ func TestNewPRSigstoreSigned(t *testing.T) {
 				SignedIdentity: testIdentity,
 			},
 		},
+		{
+			options: []PRSigstoreSignedOption{
+				PRSigstoreSignedWithKeyData(testKeyData),
+				PRSigstoreSignedWithSignedIdentity(testIdentity),
+				PRSigstoreSignedWithRequiredAnnotations(map[string]string{"env": "prod"}),
+			},
+			expected: prSigstoreSigned{
+				prCommon:            prCommon{prTypeSigstoreSigned},
+				KeyData:             testKeyData,
+				SignedIdentity:      testIdentity,
+				RequiredAnnotations: map[string]string{"env": "prod"},
+			},
+		},
+		{
+			options: []PRSigstoreSignedOption{
+				PRSigstoreSignedWithKeyData(testKeyData),
+				PRSigstoreSignedWithSignedIdentity(testIdentity),
+				PRSigstoreSignedWithSignedAfter(testSignedAfter),
+			},
+			expected: prSigstoreSigned{
+				prCommon:       prCommon{prTypeSigstoreSigned},
+				KeyData:        testKeyData,
+				SignedIdentity: testIdentity,
+				SignedAfter:    &testSignedAfter,
+			},
+		},
+		{
+			options: []PRSigstoreSignedOption{
+				PRSigstoreSignedWithKeyData(testKeyData),
+				PRSigstoreSignedWithSignedIdentity(testIdentity),
+				PRSigstoreSignedWithTSACertificatePath(testTSACertificatePath),
+			},
+			expected: prSigstoreSigned{
+				prCommon:           prCommon{prTypeSigstoreSigned},
+				KeyData:            testKeyData,
+				SignedIdentity:     testIdentity,
+				TSACertificatePath: testTSACertificatePath,
+			},
+		},
+		{
+			options: []PRSigstoreSignedOption{
+				PRSigstoreSignedWithKeyData(testKeyData),
+				PRSigstoreSignedWithSignedIdentity(testIdentity),
+				PRSigstoreSignedWithTSACertificateData(testTSACertificateData),
+			},
+			expected: prSigstoreSigned{
+				prCommon:           prCommon{prTypeSigstoreSigned},
+				KeyData:            testKeyData,
+				SignedIdentity:     testIdentity,
+				TSACertificateData: testTSACertificateData,
+			},
+		},
 		{
 			options: []PRSigstoreSignedOption{
 				PRSigstoreSignedWithFulcio(testFulcio),
@@ -123,12 +216,27 @@ func TestNewPRSigstoreSigned(t *testing.T) {
 	)
 	require.NoError(t, err)
 	for _, c := range [][]PRSigstoreSignedOption{
-		{}, // None of keyPath nor keyData, fulcio specified
+		{}, // None of keyPath, keyPaths, keyData, keyDatas nor fulcio specified
 		{ // Both keyPath and keyData specified
 			PRSigstoreSignedWithKeyPath(testKeyPath),
 			PRSigstoreSignedWithKeyData(testKeyData),
 			PRSigstoreSignedWithSignedIdentity(testIdentity),
 		},
+		{ // Both keyPath and keyPaths specified
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithKeyPaths(testKeyPaths),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Both keyData and keyDatas specified
+			PRSigstoreSignedWithKeyData(testKeyData),
+			PRSigstoreSignedWithKeyDatas(testKeyDatas),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Both keyPaths and keyDatas specified
+			PRSigstoreSignedWithKeyPaths(testKeyPaths),
+			PRSigstoreSignedWithKeyDatas(testKeyDatas),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
 		{ // both keyPath and fulcio specified
 			PRSigstoreSignedWithKeyPath(testKeyPath),
 			PRSigstoreSignedWithFulcio(testFulcio),
@@ -151,6 +259,61 @@ func TestNewPRSigstoreSigned(t *testing.T) {
 			PRSigstoreSignedWithKeyData([]byte("def")),
 			PRSigstoreSignedWithSignedIdentity(testIdentity),
 		},
+		{ // Duplicate keyPaths
+			PRSigstoreSignedWithKeyPaths(testKeyPaths),
+			PRSigstoreSignedWithKeyPaths([]string{"/foo/other"}),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Empty keyPaths
+			PRSigstoreSignedWithKeyPaths([]string{}),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Duplicate keyDatas
+			PRSigstoreSignedWithKeyDatas(testKeyDatas),
+			PRSigstoreSignedWithKeyDatas([][]byte{[]byte("ghi")}),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Empty keyDatas
+			PRSigstoreSignedWithKeyDatas([][]byte{}),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Invalid minimumSignatures
+			PRSigstoreSignedWithKeyPaths(testKeyPaths),
+			PRSigstoreSignedWithMinimumSignatures(0),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Duplicate minimumSignatures
+			PRSigstoreSignedWithKeyPaths(testKeyPaths),
+			PRSigstoreSignedWithMinimumSignatures(1),
+			PRSigstoreSignedWithMinimumSignatures(2),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // minimumSignatures larger than the number of keys
+			PRSigstoreSignedWithKeyPaths(testKeyPaths),
+			PRSigstoreSignedWithMinimumSignatures(3),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // minimumSignatures larger than the number of distinct key paths
+			PRSigstoreSignedWithKeyPaths([]string{testKeyPaths[0], testKeyPaths[0]}),
+			PRSigstoreSignedWithMinimumSignatures(2),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // minimumSignatures larger than the number of distinct key data
+			PRSigstoreSignedWithKeyDatas([][]byte{testKeyData, testKeyData}),
+			PRSigstoreSignedWithMinimumSignatures(2),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // minimumSignatures larger than 1 with a single key
+			PRSigstoreSignedWithKeyData(testKeyData),
+			PRSigstoreSignedWithMinimumSignatures(2),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // minimumSignatures with fulcio
+			PRSigstoreSignedWithFulcio(testFulcio),
+			PRSigstoreSignedWithRekorPublicKeyPath(testRekorKeyPath),
+			PRSigstoreSignedWithMinimumSignatures(1),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
 		{ // Duplicate fulcio
 			PRSigstoreSignedWithFulcio(testFulcio),
 			PRSigstoreSignedWithFulcio(testFulcio2),
@@ -187,6 +350,36 @@ func TestNewPRSigstoreSigned(t *testing.T) {
 			PRSigstoreSignedWithSignedIdentity(testIdentity),
 			PRSigstoreSignedWithSignedIdentity(newPRMMatchRepository()),
 		},
+		{ // Duplicate requiredAnnotations
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithRequiredAnnotations(map[string]string{"env": "prod"}),
+			PRSigstoreSignedWithRequiredAnnotations(map[string]string{"env": "staging"}),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Duplicate signedAfter
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithSignedAfter(testSignedAfter),
+			PRSigstoreSignedWithSignedAfter(testSignedAfter.Add(time.Hour)),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Both tsaCertificatePath and tsaCertificateData
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithTSACertificatePath(testTSACertificatePath),
+			PRSigstoreSignedWithTSACertificateData(testTSACertificateData),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Duplicate tsaCertificatePath
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithTSACertificatePath(testTSACertificatePath),
+			PRSigstoreSignedWithTSACertificatePath(testTSACertificatePath + "1"),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Duplicate tsaCertificateData
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithTSACertificateData(testTSACertificateData),
+			PRSigstoreSignedWithTSACertificateData([]byte("other")),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
 	} {
 		_, err = newPRSigstoreSigned(c...)
 		assert.Error(t, err)
@@ -252,6 +445,10 @@ func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
 			func(v mSA) { delete(v, "keyData") },
 			// Both "keyPath" and "keyData" is present
 			func(v mSA) { v["keyPath"] = "/foo/bar" },
+			// Both "keyData" and "keyDatas" is present
+			func(v mSA) { v["keyDatas"] = []string{"YWJj"} },
+			// Both "keyData" and "keyPaths" is present
+			func(v mSA) { v["keyPaths"] = []string{"/foo/bar"} },
 			// Both "keyData" and "fulcio" is present
 			func(v mSA) {
 				v["fulcio"] = mSA{
@@ -265,6 +462,14 @@ func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
 			// Invalid "keyData" field
 			func(v mSA) { v["keyData"] = 1 },
 			func(v mSA) { v["keyData"] = "this is invalid base64" },
+			// Invalid "keyPaths" field
+			func(v mSA) { delete(v, "keyData"); v["keyPaths"] = 1 },
+			func(v mSA) { delete(v, "keyData"); v["keyPaths"] = []int{1} },
+			func(v mSA) { delete(v, "keyData"); v["keyPaths"] = []string{} },
+			// Invalid "keyDatas" field
+			func(v mSA) { delete(v, "keyData"); v["keyDatas"] = 1 },
+			func(v mSA) { delete(v, "keyData"); v["keyDatas"] = []string{"this is invalid base64"} },
+			func(v mSA) { delete(v, "keyData"); v["keyDatas"] = []string{} },
 			// Invalid "fulcio" field
 			func(v mSA) { v["fulcio"] = 1 },
 			func(v mSA) { v["fulcio"] = mSA{} },
@@ -275,6 +480,11 @@ func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
 				v["rekorPublicKeyPath"] = "/foo/baz"
 				v["rekorPublicKeyData"] = ""
 			},
+			// Invalid "minimumSignatures" field
+			func(v mSA) { v["minimumSignatures"] = "1" },
+			func(v mSA) { v["minimumSignatures"] = 0 },
+			// "minimumSignatures" larger than the number of keys
+			func(v mSA) { v["minimumSignatures"] = 2 },
 			// Invalid "rekorPublicKeyPath" field
 			func(v mSA) { v["rekorPublicKeyPath"] = 1 },
 			// Invalid "rekorPublicKeyData" field
@@ -284,10 +494,79 @@ func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
 			func(v mSA) { v["signedIdentity"] = "this is invalid" },
 			// "signedIdentity" an explicit nil
 			func(v mSA) { v["signedIdentity"] = nil },
+			// Invalid "requiredAnnotations" field
+			func(v mSA) { v["requiredAnnotations"] = 1 },
+			func(v mSA) { v["requiredAnnotations"] = mSA{"env": 1} },
+			// Invalid "signedAfter" field
+			func(v mSA) { v["signedAfter"] = 1 },
+			func(v mSA) { v["signedAfter"] = "this is invalid" },
+			func(v mSA) { v["signedAfter"] = nil },
+			// Both "tsaCertificatePath" and "tsaCertificateData" is present
+			func(v mSA) {
+				v["tsaCertificatePath"] = "/foo/tsa"
+				v["tsaCertificateData"] = ""
+			},
+			// Invalid "tsaCertificatePath" field
+			func(v mSA) { v["tsaCertificatePath"] = 1 },
+			// Invalid "tsaCertificateData" field
+			func(v mSA) { v["tsaCertificateData"] = 1 },
+			func(v mSA) { v["tsaCertificateData"] = "this is invalid base64" },
 		},
 		duplicateFields: []string{"type", "keyData", "signedIdentity"},
 	}
 	keyDataTests.run(t)
+	// Test requiredAnnotations duplicate fields
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreSigned(
+				PRSigstoreSignedWithKeyPath("/foo/bar"),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+				PRSigstoreSignedWithRequiredAnnotations(map[string]string{"env": "prod"}),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "keyPath", "signedIdentity", "requiredAnnotations"},
+	}.run(t)
+	// Test signedAfter duplicate fields
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreSigned(
+				PRSigstoreSignedWithKeyPath("/foo/bar"),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+				PRSigstoreSignedWithSignedAfter(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "keyPath", "signedIdentity", "signedAfter"},
+	}.run(t)
+	// Test tsaCertificatePath duplicate fields
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreSigned(
+				PRSigstoreSignedWithKeyPath("/foo/bar"),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+				PRSigstoreSignedWithTSACertificatePath("/foo/tsa"),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "keyPath", "signedIdentity", "tsaCertificatePath"},
+	}.run(t)
+	// Test tsaCertificateData duplicate fields
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreSigned(
+				PRSigstoreSignedWithKeyPath("/foo/bar"),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+				PRSigstoreSignedWithTSACertificateData([]byte("tsa")),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "keyPath", "signedIdentity", "tsaCertificateData"},
+	}.run(t)
 	// Test keyPath-specific duplicate fields
 	policyJSONUmarshallerTests[PolicyRequirement]{
 		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
@@ -297,6 +576,43 @@ func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
 		otherJSONParser: newPolicyRequirementFromJSON,
 		duplicateFields: []string{"type", "keyPath", "signedIdentity"},
 	}.run(t)
+	// Test keyPaths-specific duplicate fields
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreSigned(
+				PRSigstoreSignedWithKeyPaths([]string{"/foo/bar", "/foo/baz"}),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "keyPaths", "signedIdentity"},
+	}.run(t)
+	// Test keyDatas-specific duplicate fields
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreSigned(
+				PRSigstoreSignedWithKeyDatas([][]byte{[]byte("abc"), []byte("def")}),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "keyDatas", "signedIdentity"},
+	}.run(t)
+	// Test minimumSignatures duplicate fields
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreSigned(
+				PRSigstoreSignedWithKeyDatas([][]byte{[]byte("abc"), []byte("def")}),
+				PRSigstoreSignedWithMinimumSignatures(2),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "keyDatas", "minimumSignatures", "signedIdentity"},
+	}.run(t)
 	// Test Fulcio and rekorPublicKeyPath duplicate fields
 	testFulcio, err := NewPRSigstoreSignedFulcio(
 		PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
@@ -552,6 +552,19 @@ func TestPolicyTransportScopesWithTransportUnmarshalJSON(t *testing.T) {
 		// A scope is an invalid PolicyRequirements
 		func(v mSA) { v["docker.io/library/busybox"] = PolicyRequirements{} },
 		func(v mSA) { v[""] = PolicyRequirements{} },
+		// Invalid prefix scopes
+		func(v mSA) { v["*"] = v[""] },
+		func(v mSA) { v["docker.io/*/busybox*"] = v[""] },
+		func(v mSA) { v["docker.io/library/*"] = v[""] },
+		// Ambiguous prefix scopes
+		func(v mSA) { v["docker.io/library/busybox*"] = v[""] },
+		func(v mSA) { v["registry.access.redhat.com/ubi*"] = v[""] },
+		func(v mSA) { v["docker.io/library/busybox:1.*"] = v[""] },
+		// Invalid wildcard scopes
+		func(v mSA) { v["registry.*.example.com"] = v[""] },
+		func(v mSA) { v["*.example.com/ns"] = v[""] },
+		func(v mSA) { v["*.example.com/team-*"] = v[""] },
+		func(v mSA) { v["*.example.com:5000"] = v[""] },
 	}
 	for _, fn := range breakFns {
 		err = tryUnmarshalModifiedPTS(t, &pts, docker.Transport, validJSON, fn)
@@ -587,11 +600,31 @@ func TestPolicyTransportScopesWithTransportUnmarshalJSON(t *testing.T) {
 		func(v mSA) { delete(v, "") },
 		// The policy is completely empty
 		func(v mSA) { maps.Clear(v) },
+		// Prefix scopes
+		func(v mSA) { v["docker.io/library/busy*"] = v[""] },
+		func(v mSA) { v["quay.io/team-*"] = v[""]; v["quay.io/team-a*"] = v[""] },
+		// Wildcard scopes
+		func(v mSA) { v["*.registry.example.com"] = v[""]; v["eu.registry.example.com"] = v[""] },
 	}
 	for _, fn := range allowedModificationFns {
 		err = tryUnmarshalModifiedPTS(t, &pts, docker.Transport, validJSON, fn)
 		require.NoError(t, err)
 	}
+
+	// Prefix scopes are validated by the transport
+	err = tryUnmarshalModifiedPTS(t, &pts, directory.Transport, validJSON, func(v mSA) {
+		v["/var/lib/images/team-*"] = v[""]
+		delete(v, "docker.io/library/busybox")
+		delete(v, "registry.access.redhat.com")
+	})
+	require.NoError(t, err)
+	assert.Contains(t, pts, "/var/lib/images/team-*")
+	err = tryUnmarshalModifiedPTS(t, &pts, directory.Transport, validJSON, func(v mSA) {
+		v["relative/team-*"] = v[""]
+		delete(v, "docker.io/library/busybox")
+		delete(v, "registry.access.redhat.com")
+	})
+	assert.Error(t, err)
 }
 
 func TestPolicyRequirementsUnmarshalJSON(t *testing.T) {
@@ -721,10 +754,11 @@ func TestNewPRSignedBy(t *testing.T) {
 	const testPath = "/foo/bar"
 	testPaths := []string{"/path/1", "/path/2"}
 	testData := []byte("abc")
+	const testDirectory = "/keys"
 	testIdentity := NewPRMMatchRepoDigestOrExact()
 
 	// Success
-	pr, err := newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil, testIdentity)
+	pr, err := newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil, "", testIdentity)
 	require.NoError(t, err)
 	assert.Equal(t, &prSignedBy{
 		prCommon:       prCommon{prTypeSignedBy},
@@ -734,7 +768,7 @@ func TestNewPRSignedBy(t *testing.T) {
 		KeyData:        nil,
 		SignedIdentity: testIdentity,
 	}, pr)
-	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, "", testPaths, nil, testIdentity)
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, "", testPaths, nil, "", testIdentity)
 	require.NoError(t, err)
 	assert.Equal(t, &prSignedBy{
 		prCommon:       prCommon{prTypeSignedBy},
@@ -744,7 +778,7 @@ func TestNewPRSignedBy(t *testing.T) {
 		KeyData:        nil,
 		SignedIdentity: testIdentity,
 	}, pr)
-	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, "", nil, testData, testIdentity)
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, "", nil, testData, "", testIdentity)
 	require.NoError(t, err)
 	assert.Equal(t, &prSignedBy{
 		prCommon:       prCommon{prTypeSignedBy},
@@ -754,27 +788,44 @@ func TestNewPRSignedBy(t *testing.T) {
 		KeyData:        testData,
 		SignedIdentity: testIdentity,
 	}, pr)
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, "", nil, nil, testDirectory, testIdentity)
+	require.NoError(t, err)
+	assert.Equal(t, &prSignedBy{
+		prCommon:       prCommon{prTypeSignedBy},
+		KeyType:        SBKeyTypeGPGKeys,
+		KeyPath:        "",
+		KeyPaths:       nil,
+		KeyData:        nil,
+		KeyDirectory:   testDirectory,
+		SignedIdentity: testIdentity,
+	}, pr)
 
 	// Invalid keyType
-	_, err = newPRSignedBy(sbKeyType(""), testPath, nil, nil, testIdentity)
+	_, err = newPRSignedBy(sbKeyType(""), testPath, nil, nil, "", testIdentity)
 	assert.Error(t, err)
-	_, err = newPRSignedBy(sbKeyType("this is invalid"), testPath, nil, nil, testIdentity)
+	_, err = newPRSignedBy(sbKeyType("this is invalid"), testPath, nil, nil, "", testIdentity)
 	assert.Error(t, err)
 
 	// Invalid keyPath/keyPaths/keyData combinations
-	_, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, testPaths, testData, testIdentity)
+	_, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, testPaths, testData, "", testIdentity)
+	assert.Error(t, err)
+	_, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, testPaths, nil, "", testIdentity)
+	assert.Error(t, err)
+	_, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, testData, "", testIdentity)
+	assert.Error(t, err)
+	_, err = newPRSignedBy(SBKeyTypeGPGKeys, "", testPaths, testData, "", testIdentity)
 	assert.Error(t, err)
-	_, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, testPaths, nil, testIdentity)
+	_, err = newPRSignedBy(SBKeyTypeGPGKeys, "", nil, nil, "", testIdentity)
 	assert.Error(t, err)
-	_, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, testData, testIdentity)
+	_, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil, testDirectory, testIdentity)
 	assert.Error(t, err)
-	_, err = newPRSignedBy(SBKeyTypeGPGKeys, "", testPaths, testData, testIdentity)
+	_, err = newPRSignedBy(SBKeyTypeGPGKeys, "", testPaths, nil, testDirectory, testIdentity)
 	assert.Error(t, err)
-	_, err = newPRSignedBy(SBKeyTypeGPGKeys, "", nil, nil, testIdentity)
+	_, err = newPRSignedBy(SBKeyTypeGPGKeys, "", nil, testData, testDirectory, testIdentity)
 	assert.Error(t, err)
 
 	// Invalid signedIdentity
-	_, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil, nil)
+	_, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil, "", nil)
 	assert.Error(t, err)
 }
 
@@ -808,6 +859,16 @@ func TestNewPRSignedByKeyData(t *testing.T) {
 	// Failure cases tested in TestNewPRSignedBy.
 }
 
+func TestNewPRSignedByKeyDirectory(t *testing.T) {
+	const testDirectory = "/keys"
+	_pr, err := NewPRSignedByKeyDirectory(SBKeyTypeGPGKeys, testDirectory, NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	pr, ok := _pr.(*prSignedBy)
+	require.True(t, ok)
+	assert.Equal(t, testDirectory, pr.KeyDirectory)
+	// Failure cases tested in TestNewPRSignedBy.
+}
+
 // Return the result of modifying validJSON with fn and unmarshaling it into *pr
 func tryUnmarshalModifiedSignedBy(t *testing.T, pr *prSignedBy, validJSON []byte, modifyFn func(mSA)) error {
 	var tmp mSA
@@ -847,6 +908,7 @@ func TestPRSignedByUnmarshalJSON(t *testing.T) {
 			func(v mSA) { v["keyPath"] = "/foo/bar"; v["keyPaths"] = []string{"/1", "/2"}; delete(v, "keyData") },
 			func(v mSA) { v["keyPath"] = "/foo/bar" },
 			func(v mSA) { v["keyPaths"] = []string{"/1", "/2"} },
+			func(v mSA) { v["keyDirectory"] = "/keys" },
 			// Invalid "keyPath" field
 			func(v mSA) { delete(v, "keyData"); v["keyPath"] = 1 },
 			// Invalid "keyPaths" field
@@ -881,6 +943,40 @@ func TestPRSignedByUnmarshalJSON(t *testing.T) {
 		otherJSONParser: newPolicyRequirementFromJSON,
 		duplicateFields: []string{"type", "keyType", "keyPaths", "signedIdentity"},
 	}.run(t)
+	// Test the keyDirectory-specific aspects
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSignedBy{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSignedByKeyDirectory(SBKeyTypeGPGKeys, "/keys", NewPRMMatchRepoDigestOrExact())
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// Invalid "keyDirectory" field
+			func(v mSA) { v["keyDirectory"] = 1 },
+			func(v mSA) { v["keyDirectory"] = "" },
+			// Both "keyDirectory" and "keyPath" are present
+			func(v mSA) { v["keyPath"] = "/foo/bar" },
+		},
+		duplicateFields: []string{"type", "keyType", "keyDirectory", "signedIdentity"},
+	}.run(t)
+	// Test the allowExpiredKeys-specific aspects
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSignedBy{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			pr, err := newPRSignedByKeyData(SBKeyTypeGPGKeys, []byte("abc"), NewPRMMatchRepoDigestOrExact())
+			if err != nil {
+				return nil, err
+			}
+			pr.AllowExpiredKeys = true
+			return pr, nil
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// Invalid "allowExpiredKeys" field
+			func(v mSA) { v["allowExpiredKeys"] = "true" },
+		},
+		duplicateFields: []string{"type", "keyType", "keyData", "signedIdentity", "allowExpiredKeys"},
+	}.run(t)
 
 	var pr prSignedBy
 
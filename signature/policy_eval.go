@@ -7,19 +7,121 @@ package signature
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/containers/image/v5/internal/image"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/internal/unparsedimage"
+	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 )
 
-// PolicyRequirementError is an explanatory text for rejecting a signature or an image.
-type PolicyRequirementError string
+// PolicyRequirementError is an explanatory text for rejecting a signature or an image,
+// with a machine-readable reason.
+type PolicyRequirementError struct {
+	Reason  PRReason // The kind of the rejection; PRReasonUnspecified if not known
+	Message string   // The explanatory text; if empty, the text of Cause is used
+	Cause   error    // The underlying error, if any
+}
 
 func (err PolicyRequirementError) Error() string {
-	return string(err)
+	if err.Message == "" && err.Cause != nil {
+		return err.Cause.Error()
+	}
+	return err.Message
+}
+
+// Unwrap returns the underlying error, if any.
+func (err PolicyRequirementError) Unwrap() error {
+	return err.Cause
+}
+
+// PRReason is a machine-readable reason for a PolicyRequirementError.
+// Warning: new reasons may be added any time.
+type PRReason string
+
+const (
+	// PRReasonUnspecified is used if the reason is not one of the more specific values.
+	PRReasonUnspecified PRReason = ""
+	// PRReasonRejected is used by the "reject" requirement.
+	PRReasonRejected PRReason = "rejected"
+	// PRReasonNoRequirements is used if there are no policy requirements applicable to the image.
+	PRReasonNoRequirements PRReason = "noRequirements"
+	// PRReasonNotImplemented is used by requirements which are not implemented.
+	PRReasonNotImplemented PRReason = "notImplemented"
+	// PRReasonNoDockerReference is used if an identity requirement can’t be evaluated because the image has no Docker reference.
+	PRReasonNoDockerReference PRReason = "noDockerReference"
+	// PRReasonNoSignatures is used if a signature is required, but the image has no signatures of the relevant kind.
+	PRReasonNoSignatures PRReason = "noSignatures"
+	// PRReasonNoAttestations is used if an attestation is required, but the image has no attestations of the relevant kind.
+	PRReasonNoAttestations PRReason = "noAttestations"
+	// PRReasonNoAcceptedSignatures is used if several signatures (or attestations) were rejected, for different reasons.
+	// If all of them were rejected for the same reason, that reason is used instead.
+	PRReasonNoAcceptedSignatures PRReason = "noAcceptedSignatures"
+	// PRReasonInsufficientSignatures is used if fewer than the required number of distinct keys have signed the image.
+	PRReasonInsufficientSignatures PRReason = "insufficientSignatures"
+	// PRReasonUntrustedKey is used if a signature was not made by any of the trusted keys.
+	PRReasonUntrustedKey PRReason = "untrustedKey"
+	// PRReasonRejectedKey is used by the "rejectSignedBy" requirement if a signature was made by one of the rejected keys.
+	PRReasonRejectedKey PRReason = "rejectedKey"
+	// PRReasonIdentityMismatch is used if a signature claims an identity which is not accepted for the image.
+	PRReasonIdentityMismatch PRReason = "identityMismatch"
+	// PRReasonDigestMismatch is used if a signature is for a different manifest digest.
+	PRReasonDigestMismatch PRReason = "digestMismatch"
+	// PRReasonAnnotationMismatch is used if a signature does not contain the required annotations.
+	PRReasonAnnotationMismatch PRReason = "annotationMismatch"
+	// PRReasonRekorRequired is used if the policy requires a Rekor inclusion proof, but a signature does not have one.
+	PRReasonRekorRequired PRReason = "rekorRequired"
+	// PRReasonSignatureTooOld is used if a signature was not created after the time required by the policy.
+	PRReasonSignatureTooOld PRReason = "signatureTooOld"
+	// PRReasonTimestampRequired is used if the policy requires a trusted timestamp, but a signature does not have one.
+	PRReasonTimestampRequired PRReason = "timestampRequired"
+	// PRReasonPredicateTypeMismatch is used if an attestation has a different predicate type.
+	PRReasonPredicateTypeMismatch PRReason = "predicateTypeMismatch"
+	// PRReasonRejectedByDecisionService is used if a decision service of a "remote" requirement has rejected the image.
+	PRReasonRejectedByDecisionService PRReason = "rejectedByDecisionService"
+)
+
+// newPolicyRequirementError returns a PolicyRequirementError with reason and message.
+func newPolicyRequirementError(reason PRReason, message string) PolicyRequirementError {
+	return PolicyRequirementError{Reason: reason, Message: message}
+}
+
+// policyRequirementErrorWithCause returns a PolicyRequirementError with reason, with the text of cause.
+func policyRequirementErrorWithCause(reason PRReason, cause error) PolicyRequirementError {
+	return PolicyRequirementError{Reason: reason, Cause: cause}
+}
+
+// policyRequirementReason returns the reason of err, if err is a PolicyRequirementError, or PRReasonUnspecified.
+func policyRequirementReason(err error) PRReason {
+	var prErr PolicyRequirementError
+	if errors.As(err, &prErr) {
+		return prErr.Reason
+	}
+	return PRReasonUnspecified
+}
+
+// commonRejectionReason returns the reason shared by all of rejections, or PRReasonNoAcceptedSignatures if they differ.
+func commonRejectionReason(rejections []error) PRReason {
+	if len(rejections) == 0 {
+		return PRReasonNoAcceptedSignatures
+	}
+	res := policyRequirementReason(rejections[0])
+	for _, err := range rejections[1:] {
+		if policyRequirementReason(err) != res {
+			return PRReasonNoAcceptedSignatures
+		}
+	}
+	if res == PRReasonUnspecified {
+		return PRReasonNoAcceptedSignatures
+	}
+	return res
 }
 
 // signatureAcceptanceResult is the principal value returned by isSignatureAuthorAccepted.
@@ -64,7 +166,25 @@ type PolicyRequirement interface {
 	// succeeded but the result was rejection.
 	// WARNING: This validates signatures and the manifest, but does not download or validate the
 	// layers. Users must validate that the layers match their expected digests.
-	isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error)
+	// state may be nil.
+	isRunningImageAllowed(ctx context.Context, image private.UnparsedImage, state *requirementEvaluationState) (bool, error)
+}
+
+// signatureReportingPolicyRequirement is implemented by signature-based PolicyRequirements
+// which can report the signatures that caused them to allow running an image.
+type signatureReportingPolicyRequirement interface {
+	// isRunningImageAllowedWithSignatures is isRunningImageAllowed, which also returns the signatures
+	// which caused the requirement to allow running the image, if it returns true.
+	isRunningImageAllowedWithSignatures(ctx context.Context, image private.UnparsedImage, state *requirementEvaluationState) (bool, []AcceptedSignature, error)
+}
+
+// signatureEvaluatingPolicyRequirement is implemented by signature-based PolicyRequirements
+// which can evaluate individual signatures of an image, for EvaluateAllRequirements.
+type signatureEvaluatingPolicyRequirement interface {
+	// evaluateSignature returns applicable == false if sig is not of a kind this requirement deals with.
+	// Otherwise, it returns a description of sig (with SignatureIndex unset) if the requirement accepts it,
+	// or a non-nil error, which should be an PolicyRequirementError if evaluation succeeded but the result was rejection.
+	evaluateSignature(ctx context.Context, image private.UnparsedImage, sig signature.Signature) (applicable bool, accepted *AcceptedSignature, err error)
 }
 
 // PolicyReferenceMatch specifies a set of image identities accepted in PolicyRequirement.
@@ -80,7 +200,82 @@ type PolicyReferenceMatch interface {
 // for speeding up its evaluation.
 type PolicyContext struct {
 	Policy *Policy
-	state  policyContextState // Internal consistency checking
+	// SignatureEvaluationCallback, if set, is called by IsRunningImageAllowed (and its variants)
+	// after each signature is evaluated by a signature-based requirement, e.g. to report progress.
+	// Callers can abort a long evaluation by canceling the context; that is checked between signatures,
+	// and the evaluation then fails with the context’s error (e.g. context.Canceled).
+	SignatureEvaluationCallback func(SignatureEvaluation)
+	// SystemContext, if set, is used by requirements which contact other servers (e.g. "remote"),
+	// for TLS and authentication configuration.
+	SystemContext *types.SystemContext
+	state         policyContextState     // Internal consistency checking
+	cache         *policyEvaluationCache // nil if caching is disabled
+}
+
+// PolicyContextOptions contains optional parameters for NewPolicyContextWithOptions.
+type PolicyContextOptions struct {
+	// CacheSize, if not 0, enables caching of successful IsRunningImageAllowed evaluations (and its variants),
+	// keyed by the image reference, the manifest digest and the applicable requirements,
+	// and is the maximum number of cached results.
+	// Results are only cached if all of the applicable requirements only depend on the image and its signatures;
+	// e.g. results involving a "remote" requirement are never cached.
+	// Note that a cached result is used even if the signatures of the image change without changing the manifest,
+	// and that SignatureEvaluationCallback is not called for cached results.
+	CacheSize int
+	// CacheTTL, if not 0, is the time after which a cached result expires.
+	CacheTTL time.Duration
+}
+
+// SignatureEvaluation is the outcome of evaluating a single signature, as reported to PolicyContext.SignatureEvaluationCallback.
+type SignatureEvaluation struct {
+	RequirementIndex int   // The index of the requirement within the policy requirements applicable to the image
+	SignatureIndex   int   // The index of the signature among all signatures of the image, in the canonical order used for all transports
+	Accepted         bool  // true if the requirement accepted the signature
+	Err              error // The reason for rejection, if !Accepted
+}
+
+// requirementEvaluationState is the state of a PolicyContext necessary to evaluate a single requirement.
+// A nil *requirementEvaluationState is valid, and means no SystemContext and no SignatureEvaluationCallback.
+type requirementEvaluationState struct {
+	sys              *types.SystemContext      // PolicyContext.SystemContext
+	callback         func(SignatureEvaluation) // PolicyContext.SignatureEvaluationCallback, or nil
+	requirementIndex int                       // The index of the requirement, for callback
+}
+
+// requirementEvaluationState returns the state necessary to evaluate requirement number reqNumber.
+// Signature evaluations are reported to pc.SignatureEvaluationCallback only if reportSignatures.
+func (pc *PolicyContext) requirementEvaluationState(reqNumber int, reportSignatures bool) *requirementEvaluationState {
+	res := &requirementEvaluationState{
+		sys:              pc.SystemContext,
+		requirementIndex: reqNumber,
+	}
+	if reportSignatures {
+		res.callback = pc.SignatureEvaluationCallback
+	}
+	return res
+}
+
+// systemContext returns the *types.SystemContext to use for contacting other servers, or nil.
+func (state *requirementEvaluationState) systemContext() *types.SystemContext {
+	if state == nil {
+		return nil
+	}
+	return state.sys
+}
+
+// signatureEvaluated reports that signature sigIndex was evaluated, and accepted iff err == nil,
+// to the SignatureEvaluationCallback in state, if any.
+// It returns ctx.Err(), so that callers stop evaluating further signatures if ctx has been canceled.
+func (state *requirementEvaluationState) signatureEvaluated(ctx context.Context, sigIndex int, err error) error {
+	if state != nil && state.callback != nil {
+		state.callback(SignatureEvaluation{
+			RequirementIndex: state.requirementIndex,
+			SignatureIndex:   sigIndex,
+			Accepted:         err == nil,
+			Err:              err,
+		})
+	}
+	return ctx.Err()
 }
 
 // policyContextState is used internally to verify the users are not misusing a PolicyContext.
@@ -117,12 +312,31 @@ func NewPolicyContext(policy *Policy) (*PolicyContext, error) {
 	return pc, nil
 }
 
+// NewPolicyContextWithOptions is NewPolicyContext, with additional options.
+// If this function succeeds, the caller should call PolicyContext.Destroy() when done.
+func NewPolicyContextWithOptions(policy *Policy, options PolicyContextOptions) (*PolicyContext, error) {
+	if options.CacheSize < 0 {
+		return nil, fmt.Errorf("invalid cache size %d", options.CacheSize)
+	}
+	if options.CacheTTL < 0 {
+		return nil, fmt.Errorf("invalid cache TTL %v", options.CacheTTL)
+	}
+	pc, err := NewPolicyContext(policy)
+	if err != nil {
+		return nil, err
+	}
+	if options.CacheSize != 0 {
+		pc.cache = newPolicyEvaluationCache(options.CacheSize, options.CacheTTL)
+	}
+	return pc, nil
+}
+
 // Destroy should be called when the user of the context is done with it.
 func (pc *PolicyContext) Destroy() error {
 	if err := pc.changeState(pcReady, pcDestroying); err != nil {
 		return err
 	}
-	// FIXME: destroy
+	pc.cache = nil
 	return pc.changeState(pcDestroying, pcDestroyed)
 }
 
@@ -145,13 +359,30 @@ func (pc *PolicyContext) requirementsForImageRef(ref types.ImageReference) Polic
 		}
 
 		// Look for a match of the possible parent namespaces.
-		for _, name := range ref.PolicyConfigurationNamespaces() {
+		// Wildcard namespaces matching all subdomains of a registry (e.g. "*.example.com") are more general
+		// than any prefix scope on a specific registry, so they are only considered after prefix scopes.
+		namespaces, wildcardNamespaces := splitWildcardNamespaces(ref.PolicyConfigurationNamespaces())
+		for _, name := range namespaces {
 			if req, ok := transportScopes[name]; ok {
 				logrus.Debugf(` Using transport "%s" specific policy section %s`, transportName, name)
 				return req
 			}
 		}
 
+		// Look for the longest matching prefix scope.
+		if scope, ok := longestMatchingScopePrefix(transportScopes, identity); ok {
+			logrus.Debugf(` Using transport "%s" prefix policy section %s`, transportName, scope)
+			return transportScopes[scope]
+		}
+
+		// Look for a match of the wildcard namespaces, from the most specific one.
+		for _, name := range wildcardNamespaces {
+			if req, ok := transportScopes[name]; ok {
+				logrus.Debugf(` Using transport "%s" wildcard policy section %s`, transportName, name)
+				return req
+			}
+		}
+
 		// Look for a default match for the transport.
 		if req, ok := transportScopes[""]; ok {
 			logrus.Debugf(` Using transport "%s" policy section ""`, transportName)
@@ -163,6 +394,36 @@ func (pc *PolicyContext) requirementsForImageRef(ref types.ImageReference) Polic
 	return pc.Policy.Default
 }
 
+// splitWildcardNamespaces splits namespaces, as returned by types.ImageReference.PolicyConfigurationNamespaces,
+// into ordinary namespaces and wildcard namespaces matching all subdomains of a host (e.g. "*.example.com"),
+// preserving the order within each of them.
+func splitWildcardNamespaces(namespaces []string) ([]string, []string) {
+	ordinary, wildcards := []string{}, []string{}
+	for _, name := range namespaces {
+		if strings.HasPrefix(name, "*.") {
+			wildcards = append(wildcards, name)
+		} else {
+			ordinary = append(ordinary, name)
+		}
+	}
+	return ordinary, wildcards
+}
+
+// longestMatchingScopePrefix returns the prefix scope in transportScopes with the longest prefix matching identity, if any.
+func longestMatchingScopePrefix(transportScopes PolicyTransportScopes, identity string) (string, bool) {
+	bestScope, bestLen := "", -1
+	for scope := range transportScopes {
+		prefix, ok := scopePrefix(scope)
+		if !ok || !strings.HasPrefix(identity, prefix) {
+			continue
+		}
+		if len(prefix) > bestLen { // Two different scopes can't have matching prefixes of the same length.
+			bestScope, bestLen = scope, len(prefix)
+		}
+	}
+	return bestScope, bestLen >= 0
+}
+
 // GetSignaturesWithAcceptedAuthor returns those signatures from an image
 // for which the policy accepts the author (and which have been successfully
 // verified).
@@ -258,13 +519,54 @@ func (pc *PolicyContext) GetSignaturesWithAcceptedAuthor(ctx context.Context, pu
 // succeeded but the result was rejection.
 // WARNING: This validates signatures and the manifest, but does not download or validate the
 // layers. Users must validate that the layers match their expected digests.
-func (pc *PolicyContext) IsRunningImageAllowed(ctx context.Context, publicImage types.UnparsedImage) (res bool, finalErr error) {
+func (pc *PolicyContext) IsRunningImageAllowed(ctx context.Context, publicImage types.UnparsedImage) (bool, error) {
+	res, _, err := pc.IsRunningImageAllowedWithResult(ctx, publicImage)
+	return res, err
+}
+
+// PolicyRequirementResult is the outcome of evaluating a single PolicyRequirement in IsRunningImageAllowedWithResult.
+type PolicyRequirementResult struct {
+	Index   int   // The index of the requirement within the policy requirements applicable to the image
+	Allowed bool  // true if the requirement allows running the image
+	Err     error // The reason for rejection, if !Allowed
+	// AcceptedSignatures are the signatures which caused a signature-based requirement to allow running the image.
+	// This is empty for requirements which do not deal with signatures, and if !Allowed.
+	AcceptedSignatures []AcceptedSignature
+}
+
+// AcceptedSignature describes a signature which caused a PolicyRequirement to allow running an image.
+type AcceptedSignature struct {
+	SignatureIndex       int           // The index of the signature among all signatures of the image, in the canonical order used for all transports
+	DockerManifestDigest digest.Digest // The manifest digest claimed by the signature
+	DockerReference      string        // The image identity claimed by the signature
+	// KeyIdentity identifies the key which verified the signature:
+	// for signedBy, the fingerprint of the GPG key; for sigstoreSigned, the digest of the DER-encoded public key.
+	KeyIdentity string
+	// Signer identifies the signer: for sigstoreSigned with Fulcio, the subject email of the certificate;
+	// otherwise, the same as KeyIdentity.
+	Signer string
+	// Creator and Timestamp are the optional creator and creation time recorded in the signature payload;
+	// they are currently only set for sigstoreSigned, and only if the payload contains them.
+	Creator   string
+	Timestamp *time.Time
+	// TrustedTimestamp is the time asserted by an RFC 3161 time-stamping authority trusted by the policy;
+	// it is currently only set for sigstoreSigned with tsaCertificatePath or tsaCertificateData.
+	TrustedTimestamp *time.Time
+}
+
+// IsRunningImageAllowedWithResult is IsRunningImageAllowed, which also returns a report of the evaluated policy requirements,
+// in order, e.g. to allow recording which signatures and keys caused the image to be accepted.
+// Evaluation stops at the first requirement which rejects the image; that requirement is the last element of the report.
+// WARNING: This validates signatures and the manifest, but does not download or validate the
+// layers. Users must validate that the layers match their expected digests.
+func (pc *PolicyContext) IsRunningImageAllowedWithResult(ctx context.Context, publicImage types.UnparsedImage) (res bool, report []PolicyRequirementResult, finalErr error) {
 	if err := pc.changeState(pcReady, pcInUse); err != nil {
-		return false, err
+		return false, nil, err
 	}
 	defer func() {
 		if err := pc.changeState(pcInUse, pcReady); err != nil {
 			res = false
+			report = nil
 			finalErr = err
 		}
 	}()
@@ -275,19 +577,101 @@ func (pc *PolicyContext) IsRunningImageAllowed(ctx context.Context, publicImage
 	reqs := pc.requirementsForImageRef(image.Reference())
 
 	if len(reqs) == 0 {
-		return false, PolicyRequirementError("List of verification policy requirements must not be empty")
+		return false, nil, newPolicyRequirementError(PRReasonNoRequirements, "List of verification policy requirements must not be empty")
+	}
+
+	var cacheKey *policyEvaluationCacheKey // nil if the result should not be cached
+	if pc.cache != nil && requirementsAreCacheable(reqs) {
+		key, err := newPolicyEvaluationCacheKey(ctx, image, reqs)
+		if err != nil {
+			// Don’t fail here, evaluating the requirements will report the error, if it matters.
+			logrus.Debugf("Not using the policy evaluation cache: %v", err)
+		} else {
+			if cachedReport, ok := pc.cache.get(key, time.Now()); ok {
+				logrus.Debugf("Overall: allowed (cached)")
+				return true, cachedReport, nil
+			}
+			cacheKey = &key
+		}
 	}
 
 	for reqNumber, req := range reqs {
-		// FIXME: supply state
-		allowed, err := req.isRunningImageAllowed(ctx, image)
+		var allowed bool
+		var sigs []AcceptedSignature
+		var err error
+		state := pc.requirementEvaluationState(reqNumber, true)
+		if sr, ok := req.(signatureReportingPolicyRequirement); ok {
+			allowed, sigs, err = sr.isRunningImageAllowedWithSignatures(ctx, image, state)
+		} else {
+			allowed, err = req.isRunningImageAllowed(ctx, image, state)
+		}
 		if !allowed {
 			logrus.Debugf("Requirement %d: denied, done", reqNumber)
-			return false, err
+			report = append(report, PolicyRequirementResult{Index: reqNumber, Allowed: false, Err: err})
+			return false, report, err
 		}
 		logrus.Debugf(" Requirement %d: allowed", reqNumber)
+		report = append(report, PolicyRequirementResult{Index: reqNumber, Allowed: true, AcceptedSignatures: sigs})
 	}
 	// We have tested that len(reqs) != 0, so at least one req must have explicitly allowed this image.
 	logrus.Debugf("Overall: allowed")
-	return true, nil
+	if cacheKey != nil {
+		pc.cache.add(*cacheKey, report, time.Now())
+	}
+	return true, report, nil
+}
+
+// SignatureAcceptance pairs a signature which caused the policy to allow running an image
+// with the policy requirement which accepted it.
+type SignatureAcceptance struct {
+	RequirementIndex int               // The index of the requirement within the policy requirements applicable to the image
+	Requirement      PolicyRequirement // The requirement
+	Signature        AcceptedSignature // The signature, including its index and the identity of its signer
+}
+
+// IsRunningImageAllowedWithDetails is IsRunningImageAllowed, which also returns, if the image is allowed,
+// the signatures which caused signature-based requirements to allow running the image, paired with those requirements.
+// For each requirement, only the signatures necessary to satisfy it are evaluated and reported
+// (this is usually one signature, or sigstoreSigned.minimumSignatures signatures).
+// WARNING: This validates signatures and the manifest, but does not download or validate the
+// layers. Users must validate that the layers match their expected digests.
+func (pc *PolicyContext) IsRunningImageAllowedWithDetails(ctx context.Context, publicImage types.UnparsedImage) (bool, []SignatureAcceptance, error) {
+	allowed, report, err := pc.IsRunningImageAllowedWithResult(ctx, publicImage)
+	if !allowed || err != nil { // Be paranoid and fail if either return value indicates so.
+		return false, nil, err
+	}
+	reqs := pc.requirementsForImageRef(publicImage.Reference())
+	res := []SignatureAcceptance{}
+	for _, r := range report {
+		for _, sig := range r.AcceptedSignatures {
+			res = append(res, SignatureAcceptance{
+				RequirementIndex: r.Index,
+				Requirement:      reqs[r.Index],
+				Signature:        sig,
+			})
+		}
+	}
+	return true, res, nil
+}
+
+// IsRunningImageAllowedWithManifest is like IsRunningImageAllowed for the image (src, instanceDigest),
+// but uses the caller-supplied manifestBlob with manifestDigest instead of reading the manifest from src.
+// Signatures are still read from src.
+// manifestBlob is verified to match manifestDigest (and instanceDigest or a digest in the reference of src, if any),
+// so the caller does not need to trust the origin of manifestBlob.
+// WARNING: This validates signatures and the manifest, but does not download or validate the
+// layers. Users must validate that the layers match their expected digests.
+func (pc *PolicyContext) IsRunningImageAllowedWithManifest(ctx context.Context, src types.ImageSource, instanceDigest *digest.Digest, manifestBlob []byte, manifestDigest digest.Digest) (bool, error) {
+	matches, err := manifest.MatchesDigest(manifestBlob, manifestDigest)
+	if err != nil {
+		return false, fmt.Errorf("computing manifest digest: %w", err)
+	}
+	if !matches {
+		return false, fmt.Errorf("Manifest does not match provided manifest digest %s", manifestDigest)
+	}
+	unparsed, err := image.UnparsedInstanceWithManifest(src, instanceDigest, manifestBlob, manifest.GuessMIMEType(manifestBlob))
+	if err != nil {
+		return false, err
+	}
+	return pc.IsRunningImageAllowed(ctx, unparsed)
 }
@@ -13,8 +13,8 @@ func (pr *prSignedBaseLayer) isSignatureAuthorAccepted(ctx context.Context, imag
 	return sarUnknown, nil, nil
 }
 
-func (pr *prSignedBaseLayer) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
+func (pr *prSignedBaseLayer) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage, state *requirementEvaluationState) (bool, error) {
 	// FIXME? Reject this at policy parsing time already?
 	logrus.Errorf("signedBaseLayer not implemented yet!")
-	return false, PolicyRequirementError("signedBaseLayer not implemented yet!")
+	return false, newPolicyRequirementError(PRReasonNotImplemented, "signedBaseLayer not implemented yet!")
 }
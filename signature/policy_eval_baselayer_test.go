@@ -20,6 +20,6 @@ func TestPRSignedBaseLayerIsRunningImageAllowed(t *testing.T) {
 	pr, err := NewPRSignedBaseLayer(NewPRMMatchRepository())
 	require.NoError(t, err)
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	res, err := pr.isRunningImageAllowed(context.Background(), nil)
+	res, err := pr.isRunningImageAllowed(context.Background(), nil, nil)
 	assertRunningRejectedPolicyRequirement(t, res, err)
 }
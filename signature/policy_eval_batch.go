@@ -0,0 +1,223 @@
+// This defines a helper for evaluating a policy for many images.
+
+package signature
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/internal/session"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// BatchVerificationResult is the outcome of evaluating a policy for a single image in VerifyImagesInBatch.
+type BatchVerificationResult struct {
+	// ImageName is the transports.ImageName value of the evaluated image reference.
+	ImageName string
+	// ManifestDigest is the digest of the evaluated manifest, or "" if the manifest could not be read.
+	ManifestDigest digest.Digest
+	// Allowed is true if the policy allows running the image.
+	Allowed bool
+	// Err is the reason why the image is not allowed, nil if Allowed.
+	// It is a PolicyRequirementError if the evaluation succeeded but the result was rejection.
+	Err error
+	// Duration is the time spent evaluating the image.
+	Duration time.Duration
+}
+
+// BatchVerificationStateStore records progress of VerifyImagesInBatch,
+// so that an interrupted batch can be resumed without re-evaluating completed images.
+// VerifyImagesInBatch never calls the methods concurrently.
+type BatchVerificationStateStore interface {
+	// IsCompleted returns true if an image with imageName (a transports.ImageName value) has already been evaluated.
+	IsCompleted(imageName string) (bool, error)
+	// RecordResult records that an image has been evaluated.
+	RecordResult(result BatchVerificationResult) error
+}
+
+// BatchVerificationOptions contains optional parameters for VerifyImagesInBatch.
+type BatchVerificationOptions struct {
+	SystemContext *types.SystemContext // Used when reading the images.
+	// Concurrency is the maximum number of images evaluated at the same time; 0 means 1.
+	Concurrency int
+	// MinimumInterval, if not 0, is the minimum time between starting evaluations of two images,
+	// to limit the load on the registries.
+	MinimumInterval time.Duration
+	// StateStore, if not nil, is used to skip images evaluated by an earlier, interrupted, run,
+	// and to record results of this run.
+	StateStore BatchVerificationStateStore
+	// ReportResult, if not nil, is called for every evaluated image (but not for images skipped due to StateStore).
+	// VerifyImagesInBatch never calls it concurrently.
+	ReportResult func(BatchVerificationResult)
+}
+
+// VerifyImagesInBatch evaluates policy for every image reference received from refs, until refs is closed.
+//
+// A separate PolicyContext is created for each worker, because a PolicyContext can not be used concurrently.
+// All workers share connections, the detected registry properties, and authentication tokens,
+// for all images on the same registry.
+//
+// The returned error only reports failures of the batch as a whole (e.g. a cancelled ctx, or a StateStore failure);
+// rejections and failures to read individual images are reported as BatchVerificationResult values.
+// On error, the caller may need to drain refs to allow the producer to terminate.
+func VerifyImagesInBatch(ctx context.Context, policy *Policy, refs <-chan types.ImageReference, options *BatchVerificationOptions) error {
+	if options == nil {
+		options = &BatchVerificationOptions{}
+	}
+	concurrency := options.Concurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	if concurrency < 0 {
+		return fmt.Errorf("invalid concurrency %d", concurrency)
+	}
+
+	s := session.New()
+	defer s.Close()
+	ctx, cancel := context.WithCancel(session.WithSession(ctx, s))
+	defer cancel()
+
+	b := batchVerification{options: options}
+	var ticker *time.Ticker
+	if options.MinimumInterval > 0 {
+		ticker = time.NewTicker(options.MinimumInterval)
+		defer ticker.Stop()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		pc, err := NewPolicyContext(policy)
+		if err != nil {
+			cancel()
+			wg.Wait()
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if err := pc.Destroy(); err != nil {
+					b.fail(err)
+				}
+			}()
+			for {
+				var ref types.ImageReference
+				select {
+				case <-ctx.Done():
+					return
+				case r, ok := <-refs:
+					if !ok {
+						return
+					}
+					ref = r
+				}
+				if err := b.verifyImage(ctx, pc, ticker, ref); err != nil {
+					b.fail(err)
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if b.err != nil {
+		return b.err
+	}
+	return ctx.Err()
+}
+
+// batchVerification is the state of a single VerifyImagesInBatch call.
+type batchVerification struct {
+	options *BatchVerificationOptions
+
+	lock sync.Mutex // Protects err, and serializes calls to options.StateStore and options.ReportResult
+	err  error      // The first failure of the batch as a whole
+}
+
+// fail records err as a failure of the batch, unless an earlier failure was already recorded.
+func (b *batchVerification) fail(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// verifyImage evaluates the policy in pc for ref, and records the result.
+// It only returns an error if the batch should be aborted.
+func (b *batchVerification) verifyImage(ctx context.Context, pc *PolicyContext, ticker *time.Ticker, ref types.ImageReference) error {
+	imageName := transports.ImageName(ref)
+	if b.options.StateStore != nil {
+		b.lock.Lock()
+		completed, err := b.options.StateStore.IsCompleted(imageName)
+		b.lock.Unlock()
+		if err != nil {
+			return fmt.Errorf("checking state of %s: %w", imageName, err)
+		}
+		if completed {
+			logrus.Debugf("Skipping already verified image %s", imageName)
+			return nil
+		}
+	}
+	if ticker != nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	start := time.Now()
+	manifestDigest, allowed, err := evaluateImageByReference(ctx, b.options.SystemContext, pc, ref)
+	if ctx.Err() != nil {
+		return ctx.Err() // Don’t record an interrupted evaluation as completed.
+	}
+	result := BatchVerificationResult{
+		ImageName:      imageName,
+		ManifestDigest: manifestDigest,
+		Allowed:        allowed,
+		Err:            err,
+		Duration:       time.Since(start),
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.options.StateStore != nil {
+		if err := b.options.StateStore.RecordResult(result); err != nil {
+			return fmt.Errorf("recording state of %s: %w", imageName, err)
+		}
+	}
+	if b.options.ReportResult != nil {
+		b.options.ReportResult(result)
+	}
+	return nil
+}
+
+// evaluateImageByReference opens ref and evaluates the policy in pc for it.
+func evaluateImageByReference(ctx context.Context, sys *types.SystemContext, pc *PolicyContext, ref types.ImageReference) (digest.Digest, bool, error) {
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return "", false, err
+	}
+	defer src.Close()
+
+	unparsed := image.UnparsedInstance(src, nil)
+	m, _, err := unparsed.Manifest(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	manifestDigest, err := manifest.Digest(m)
+	if err != nil {
+		return "", false, err
+	}
+	allowed, err := pc.IsRunningImageAllowed(ctx, unparsed)
+	return manifestDigest, allowed, err
+}
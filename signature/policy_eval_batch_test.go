@@ -0,0 +1,217 @@
+package signature
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryBatchStateStore is a BatchVerificationStateStore for tests.
+type memoryBatchStateStore struct {
+	completed map[string]bool
+	failWith  error
+}
+
+func (s *memoryBatchStateStore) IsCompleted(imageName string) (bool, error) {
+	return s.completed[imageName], nil
+}
+
+func (s *memoryBatchStateStore) RecordResult(result BatchVerificationResult) error {
+	if s.failWith != nil {
+		return s.failWith
+	}
+	s.completed[result.ImageName] = true
+	return nil
+}
+
+// batchTestRefs returns a closed channel containing references to dirs.
+func batchTestRefs(t *testing.T, dirs []string) <-chan types.ImageReference {
+	res := make(chan types.ImageReference, len(dirs))
+	for _, dir := range dirs {
+		ref, err := directory.NewReference(dir)
+		require.NoError(t, err)
+		res <- ref
+	}
+	close(res)
+	return res
+}
+
+func TestVerifyImagesInBatch(t *testing.T) {
+	prm, err := NewPRMExactRepository(TestImageSignatureReference)
+	require.NoError(t, err)
+	pr, err := NewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", prm)
+	require.NoError(t, err)
+	policy := &Policy{Default: PolicyRequirements{pr}}
+	dirs := []string{"fixtures/dir-img-valid", "fixtures/dir-img-unsigned", "fixtures/dir-img-valid-2", "fixtures/this-does-not-exist"}
+	imageName := func(dir string) string {
+		ref, err := directory.NewReference(dir)
+		require.NoError(t, err)
+		return transports.ImageName(ref)
+	}
+
+	for _, concurrency := range []int{0, 1, 3} {
+		results := map[string]BatchVerificationResult{}
+		err := VerifyImagesInBatch(context.Background(), policy, batchTestRefs(t, dirs), &BatchVerificationOptions{
+			Concurrency: concurrency,
+			ReportResult: func(r BatchVerificationResult) {
+				results[r.ImageName] = r
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, results, len(dirs))
+
+		r := results[imageName("fixtures/dir-img-valid")]
+		assert.True(t, r.Allowed)
+		assert.NoError(t, r.Err)
+		assert.NotEmpty(t, r.ManifestDigest)
+
+		r = results[imageName("fixtures/dir-img-unsigned")]
+		assert.False(t, r.Allowed)
+		assert.IsType(t, PolicyRequirementError{}, r.Err)
+		assert.NotEmpty(t, r.ManifestDigest)
+
+		r = results[imageName("fixtures/dir-img-valid-2")]
+		assert.True(t, r.Allowed)
+		assert.NoError(t, r.Err)
+
+		r = results[imageName("fixtures/this-does-not-exist")]
+		assert.False(t, r.Allowed)
+		assert.Error(t, r.Err)
+		assert.Empty(t, r.ManifestDigest)
+	}
+
+	// Resuming using a state store
+	store := &memoryBatchStateStore{completed: map[string]bool{
+		imageName("fixtures/dir-img-valid"): true,
+	}}
+	reported := []string{}
+	err = VerifyImagesInBatch(context.Background(), policy, batchTestRefs(t, dirs), &BatchVerificationOptions{
+		Concurrency: 2,
+		StateStore:  store,
+		ReportResult: func(r BatchVerificationResult) {
+			reported = append(reported, r.ImageName)
+		},
+	})
+	require.NoError(t, err)
+	sort.Strings(reported)
+	expected := []string{imageName("fixtures/dir-img-unsigned"), imageName("fixtures/dir-img-valid-2"), imageName("fixtures/this-does-not-exist")}
+	sort.Strings(expected)
+	assert.Equal(t, expected, reported)
+	for _, dir := range dirs {
+		assert.True(t, store.completed[imageName(dir)], dir)
+	}
+
+	// A state store failure aborts the batch
+	storeErr := errors.New("state store failure")
+	err = VerifyImagesInBatch(context.Background(), policy, batchTestRefs(t, dirs), &BatchVerificationOptions{
+		StateStore: &memoryBatchStateStore{completed: map[string]bool{}, failWith: storeErr},
+	})
+	assert.ErrorIs(t, err, storeErr)
+
+	// A cancelled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = VerifyImagesInBatch(ctx, policy, make(chan types.ImageReference), nil)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Invalid concurrency
+	err = VerifyImagesInBatch(context.Background(), policy, batchTestRefs(t, dirs), &BatchVerificationOptions{Concurrency: -1})
+	assert.Error(t, err)
+}
+
+func TestVerifyImagesInBatchSharesRegistryState(t *testing.T) {
+	const token = "batch-token"
+	const numImages = 4
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o644)
+	require.NoError(t, err)
+	config := []byte(`{}`)
+	m, err := manifest.Schema2FromComponents(manifest.Schema2Descriptor{
+		MediaType: manifest.DockerV2Schema2ConfigMediaType,
+		Digest:    digest.FromBytes(config),
+		Size:      int64(len(config)),
+	}, []manifest.Schema2Descriptor{}).Serialize()
+	require.NoError(t, err)
+
+	var mutex sync.Mutex
+	pings, tokenRequests := 0, 0
+	var serverURL string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			pings++
+			rw.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, serverURL))
+			rw.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodGet && r.URL.Path == "/token":
+			tokenRequests++
+			_, err := rw.Write([]byte(fmt.Sprintf(`{"token":"%s"}`, token)))
+			assert.NoError(t, err)
+		case r.Header.Get("Authorization") != "Bearer "+token:
+			rw.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/repo/manifests/tag":
+			rw.Header().Set("Content-Type", manifest.DockerV2Schema2MediaType)
+			_, err := rw.Write(m)
+			assert.NoError(t, err)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	serverURL = server.URL
+	registryURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	refs := make(chan types.ImageReference, numImages)
+	for i := 0; i < numImages; i++ {
+		ref, err := docker.ParseReference("//" + registryURL.Host + "/repo:tag")
+		require.NoError(t, err)
+		refs <- ref
+	}
+	close(refs)
+
+	const concurrency = 2
+	allowed := 0
+	err = VerifyImagesInBatch(context.Background(), &Policy{Default: PolicyRequirements{NewPRInsecureAcceptAnything()}}, refs, &BatchVerificationOptions{
+		SystemContext: &types.SystemContext{
+			RegistriesDirPath:           "/this/does/not/exist",
+			DockerPerHostCertDirPath:    "/this/does/not/exist",
+			SystemRegistriesConfPath:    registriesConf,
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		},
+		Concurrency: concurrency,
+		ReportResult: func(r BatchVerificationResult) {
+			assert.NoError(t, r.Err, r.ImageName)
+			if r.Allowed {
+				allowed++
+			}
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, numImages, allowed)
+
+	// The registry is pinged only once, and authentication is negotiated at most once per worker,
+	// instead of once per image.
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, 1, pings)
+	assert.LessOrEqual(t, tokenRequests, concurrency)
+}
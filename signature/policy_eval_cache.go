@@ -0,0 +1,138 @@
+// This implements caching of policy evaluation results in a PolicyContext.
+
+package signature
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// cacheablePolicyRequirement is implemented by PolicyRequirements whose outcome for an image
+// only depends on the image reference, the manifest and the signatures, and not on any external service.
+// Requirements which do not implement it are never cached.
+type cacheablePolicyRequirement interface {
+	// isCacheable returns true if results of isRunningImageAllowed can be cached for an image reference and manifest digest.
+	isCacheable() bool
+}
+
+// policyEvaluationCacheKey identifies a cached policy evaluation result.
+type policyEvaluationCacheKey struct {
+	imageName      string        // transports.ImageName of the image reference; this determines the policy scope and the expected identity
+	manifestDigest digest.Digest // The digest of the evaluated manifest
+	policyDigest   digest.Digest // A digest of the JSON representation of the evaluated requirements
+}
+
+// policyEvaluationCacheEntry is a single cached policy evaluation result.
+type policyEvaluationCacheEntry struct {
+	key     policyEvaluationCacheKey
+	report  []PolicyRequirementResult
+	expires time.Time // Zero if the entry does not expire
+}
+
+// policyEvaluationCache is a LRU cache of successful policy evaluations.
+// It is not safe for concurrent use; that’s fine because a PolicyContext can not be used concurrently.
+type policyEvaluationCache struct {
+	size    int
+	ttl     time.Duration
+	entries map[policyEvaluationCacheKey]*list.Element // Values are *policyEvaluationCacheEntry
+	lru     *list.List                                 // The most recently used entry first
+}
+
+// newPolicyEvaluationCache returns an empty cache with at most size entries, which expire after ttl (never if 0).
+func newPolicyEvaluationCache(size int, ttl time.Duration) *policyEvaluationCache {
+	return &policyEvaluationCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[policyEvaluationCacheKey]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// requirementsAreCacheable returns true if results of evaluating all of reqs can be cached.
+func requirementsAreCacheable(reqs PolicyRequirements) bool {
+	for _, req := range reqs {
+		cr, ok := req.(cacheablePolicyRequirement)
+		if !ok || !cr.isCacheable() {
+			return false
+		}
+	}
+	return true
+}
+
+// newPolicyEvaluationCacheKey returns a key for evaluating reqs for image.
+func newPolicyEvaluationCacheKey(ctx context.Context, image private.UnparsedImage, reqs PolicyRequirements) (policyEvaluationCacheKey, error) {
+	m, _, err := image.Manifest(ctx)
+	if err != nil {
+		return policyEvaluationCacheKey{}, err
+	}
+	manifestDigest, err := manifest.Digest(m)
+	if err != nil {
+		return policyEvaluationCacheKey{}, err
+	}
+	policyJSON, err := json.Marshal(reqs)
+	if err != nil {
+		return policyEvaluationCacheKey{}, err
+	}
+	return policyEvaluationCacheKey{
+		imageName:      transports.ImageName(image.Reference()),
+		manifestDigest: manifestDigest,
+		policyDigest:   digest.FromBytes(policyJSON),
+	}, nil
+}
+
+// get returns a copy of the report cached for key at now, if any.
+func (c *policyEvaluationCache) get(key policyEvaluationCacheKey, now time.Time) ([]PolicyRequirementResult, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*policyEvaluationCacheEntry)
+	if !entry.expires.IsZero() && !now.Before(entry.expires) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return copyPolicyRequirementResults(entry.report), true
+}
+
+// add records report for key at now, evicting the least recently used entry if necessary.
+func (c *policyEvaluationCache) add(key policyEvaluationCacheKey, report []PolicyRequirementResult, now time.Time) {
+	entry := &policyEvaluationCacheEntry{
+		key:    key,
+		report: copyPolicyRequirementResults(report),
+	}
+	if c.ttl != 0 {
+		entry.expires = now.Add(c.ttl)
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*policyEvaluationCacheEntry).key)
+	}
+}
+
+// copyPolicyRequirementResults returns a copy of report which does not share any slices with it.
+func copyPolicyRequirementResults(report []PolicyRequirementResult) []PolicyRequirementResult {
+	res := make([]PolicyRequirementResult, len(report))
+	for i, r := range report {
+		res[i] = r
+		if r.AcceptedSignatures != nil {
+			res[i].AcceptedSignatures = append([]AcceptedSignature{}, r.AcceptedSignatures...)
+		}
+	}
+	return res
+}
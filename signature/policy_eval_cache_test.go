@@ -0,0 +1,206 @@
+package signature
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPolicyContextWithOptions(t *testing.T) {
+	policy := &Policy{Default: PolicyRequirements{NewPRReject()}}
+
+	pc, err := NewPolicyContextWithOptions(policy, PolicyContextOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, pcReady, pc.state)
+	assert.Nil(t, pc.cache)
+	err = pc.Destroy()
+	require.NoError(t, err)
+
+	pc, err = NewPolicyContextWithOptions(policy, PolicyContextOptions{CacheSize: 10, CacheTTL: time.Minute})
+	require.NoError(t, err)
+	require.NotNil(t, pc.cache)
+	assert.Equal(t, 10, pc.cache.size)
+	assert.Equal(t, time.Minute, pc.cache.ttl)
+	err = pc.Destroy()
+	require.NoError(t, err)
+	assert.Nil(t, pc.cache)
+
+	for _, opts := range []PolicyContextOptions{
+		{CacheSize: -1},
+		{CacheSize: 1, CacheTTL: -time.Second},
+	} {
+		_, err := NewPolicyContextWithOptions(policy, opts)
+		assert.Error(t, err, opts)
+	}
+}
+
+func TestRequirementsAreCacheable(t *testing.T) {
+	remote, err := NewPRRemote(PRRemoteWithURL("https://example.com/decide"))
+	require.NoError(t, err)
+	rejectSignedBy := xNewPRRejectSignedBy(PRRejectSignedByWithKeyPath("fixtures/public-key-1.gpg"))
+	for _, c := range []struct {
+		reqs      PolicyRequirements
+		cacheable bool
+	}{
+		{PolicyRequirements{NewPRInsecureAcceptAnything()}, true},
+		{PolicyRequirements{NewPRInsecureAcceptAnything(), xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository())}, true},
+		{PolicyRequirements{xNewPRSigstoreSigned(
+			PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+			PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+		)}, true},
+		{PolicyRequirements{remote}, false},
+		{PolicyRequirements{NewPRInsecureAcceptAnything(), remote}, false},
+		{PolicyRequirements{NewPRInsecureAcceptAnything(), rejectSignedBy}, false},
+	} {
+		assert.Equal(t, c.cacheable, requirementsAreCacheable(c.reqs), c.reqs)
+	}
+}
+
+func TestPolicyContextIsRunningImageAllowedCached(t *testing.T) {
+	policy := &Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"192.168.64.2:5000/cosign-signed-single-sample": {
+					xNewPRSigstoreSigned(
+						PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+						PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+					),
+				},
+			},
+		},
+	}
+	pc, err := NewPolicyContextWithOptions(policy, PolicyContextOptions{CacheSize: 10})
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+	evaluations := 0
+	pc.SignatureEvaluationCallback = func(e SignatureEvaluation) {
+		evaluations++
+	}
+
+	// The first evaluation verifies the signature, the following ones use the cached result.
+	var firstReport []PolicyRequirementResult
+	for i := 0; i < 3; i++ {
+		evaluations = 0
+		img := pcImageMock(t, "fixtures/dir-img-cosign-valid", "192.168.64.2:5000/cosign-signed-single-sample:latest")
+		res, report, err := pc.IsRunningImageAllowedWithResult(context.Background(), img)
+		assertRunningAllowed(t, res, err)
+		if i == 0 {
+			assert.Equal(t, 1, evaluations)
+			firstReport = report
+		} else {
+			assert.Equal(t, 0, evaluations, i)
+			assert.Equal(t, firstReport, report, i)
+		}
+	}
+	assert.Equal(t, 1, pc.cache.lru.Len())
+
+	// A different manifest is evaluated separately
+	evaluations = 0
+	img := pcImageMock(t, "fixtures/dir-img-cosign-modified-manifest", "192.168.64.2:5000/cosign-signed-single-sample:latest")
+	res, err := pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejected(t, res, err)
+	assert.Equal(t, 1, evaluations)
+	// Rejections are not cached
+	evaluations = 0
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejected(t, res, err)
+	assert.Equal(t, 1, evaluations)
+	assert.Equal(t, 1, pc.cache.lru.Len())
+}
+
+func TestPolicyEvaluationCache(t *testing.T) {
+	key := func(i int) policyEvaluationCacheKey {
+		return policyEvaluationCacheKey{
+			imageName:      "docker://busybox:latest",
+			manifestDigest: digest.FromBytes([]byte{byte(i)}),
+			policyDigest:   digest.FromString("policy"),
+		}
+	}
+	report := func(i int) []PolicyRequirementResult {
+		return []PolicyRequirementResult{{Index: i, Allowed: true, AcceptedSignatures: []AcceptedSignature{{SignatureIndex: i}}}}
+	}
+	now := time.Now()
+
+	// Least recently used entries are evicted
+	c := newPolicyEvaluationCache(2, 0)
+	c.add(key(1), report(1), now)
+	c.add(key(2), report(2), now)
+	_, ok := c.get(key(1), now)
+	assert.True(t, ok)
+	c.add(key(3), report(3), now)
+	res, ok := c.get(key(1), now)
+	require.True(t, ok)
+	assert.Equal(t, report(1), res)
+	_, ok = c.get(key(2), now)
+	assert.False(t, ok)
+	res, ok = c.get(key(3), now)
+	require.True(t, ok)
+	assert.Equal(t, report(3), res)
+	// Without a TTL, entries never expire
+	_, ok = c.get(key(3), now.Add(1000*time.Hour))
+	assert.True(t, ok)
+
+	// Returned reports can be modified without affecting the cache
+	res[0].AcceptedSignatures[0].SignatureIndex = 100
+	res, ok = c.get(key(3), now)
+	require.True(t, ok)
+	assert.Equal(t, report(3), res)
+
+	// Replacing an entry
+	c.add(key(3), report(4), now)
+	res, ok = c.get(key(3), now)
+	require.True(t, ok)
+	assert.Equal(t, report(4), res)
+	assert.Equal(t, 2, c.lru.Len())
+
+	// Entries expire after the TTL
+	c = newPolicyEvaluationCache(2, time.Minute)
+	c.add(key(1), report(1), now)
+	_, ok = c.get(key(1), now.Add(59*time.Second))
+	assert.True(t, ok)
+	_, ok = c.get(key(1), now.Add(time.Minute))
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.lru.Len())
+	assert.Len(t, c.entries, 0)
+}
+
+func BenchmarkPolicyContextIsRunningImageAllowed(b *testing.B) {
+	policy := &Policy{
+		Default: PolicyRequirements{xNewPRSigstoreSigned(
+			PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+			PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+		)},
+	}
+	for _, c := range []struct {
+		name      string
+		cacheSize int
+	}{
+		{"uncached", 0},
+		{"cached", 10},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			pc, err := NewPolicyContextWithOptions(policy, PolicyContextOptions{CacheSize: c.cacheSize})
+			require.NoError(b, err)
+			defer func() {
+				err := pc.Destroy()
+				require.NoError(b, err)
+			}()
+			img := pcImageMock(b, "fixtures/dir-img-cosign-valid", "192.168.64.2:5000/cosign-signed-single-sample:latest")
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				allowed, err := pc.IsRunningImageAllowed(context.Background(), img)
+				if !allowed || err != nil {
+					b.Fatalf("Unexpected result %v, %v", allowed, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// Policy evaluation for prRejectSignedBy.
+
+package signature
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"golang.org/x/exp/slices"
+)
+
+// rejectedKeysMechanism returns a signing mechanism which can only verify signatures by the keys rejected by pr,
+// and identities of those keys. The caller must call Close() on the returned mechanism.
+func (pr *prRejectSignedBy) rejectedKeysMechanism() (SigningMechanism, []string, error) {
+	// FIXME: move this to per-context initialization
+	var data []byte
+	switch {
+	case pr.KeyPath != "" && pr.KeyData == nil:
+		d, err := os.ReadFile(pr.KeyPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = d
+	case pr.KeyPath == "" && pr.KeyData != nil:
+		data = pr.KeyData
+	default:
+		return nil, nil, errors.New(`Internal inconsistency: not exactly one of "keyPath" and "keyData" specified`)
+	}
+	mech, rejectedIdentities, err := newEphemeralGPGSigningMechanism([][]byte{data})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rejectedIdentities) == 0 {
+		mech.Close()
+		// Don’t silently allow everything if the key file is unusable.
+		return nil, nil, newPolicyRequirementError(PRReasonUntrustedKey, "No public keys imported")
+	}
+	return mech, rejectedIdentities, nil
+}
+
+// rejectedSignatureError returns a PolicyRequirementError if sig has been made by one of rejectedIdentities, or nil.
+func rejectedSignatureError(mech SigningMechanism, rejectedIdentities []string, sig []byte) error {
+	// mech only contains the rejected keys, so any successfully verified signature was made by one of them.
+	if _, keyIdentity, err := mech.Verify(sig); err == nil && slices.Contains(rejectedIdentities, keyIdentity) {
+		return newPolicyRequirementError(PRReasonRejectedKey, fmt.Sprintf("Signature by key %s is rejected by policy", keyIdentity))
+	}
+	return nil
+}
+
+func (pr *prRejectSignedBy) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	mech, rejectedIdentities, err := pr.rejectedKeysMechanism()
+	if err != nil {
+		return sarRejected, nil, err
+	}
+	defer mech.Close()
+	if err := rejectedSignatureError(mech, rejectedIdentities, sig); err != nil {
+		return sarRejected, nil, err
+	}
+	// prRejectSignedBy never accepts a signature, other requirements must do that.
+	return sarUnknown, nil, nil
+}
+
+func (pr *prRejectSignedBy) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage, state *requirementEvaluationState) (bool, error) {
+	sigs, err := image.UntrustedSignatures(ctx)
+	if err != nil {
+		return false, err
+	}
+	mech, rejectedIdentities, err := pr.rejectedKeysMechanism()
+	if err != nil {
+		return false, err
+	}
+	defer mech.Close()
+	for _, s := range sigs {
+		simpleSig, ok := s.(signature.SimpleSigning)
+		if !ok {
+			continue
+		}
+		if err := rejectedSignatureError(mech, rejectedIdentities, simpleSig.UntrustedSignature()); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,87 @@
+package signature
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPRRejectSignedByIsSignatureAuthorAccepted(t *testing.T) {
+	compromised, err := NewPRRejectSignedBy(PRRejectSignedByWithKeyPath("fixtures/public-key-2.gpg"))
+	require.NoError(t, err)
+	other, err := NewPRRejectSignedBy(PRRejectSignedByWithKeyPath("fixtures/public-key-ed25519.gpg"))
+	require.NoError(t, err)
+	// fixtures/dir-img-dual-signed is signed by TestKeyFingerprint (in public-key-1.gpg),
+	// and by TestKeyFingerprintWithPassphrase (in public-key-2.gpg).
+	img := dirImageMock(t, "fixtures/dir-img-dual-signed", "testing/manifest:latest")
+	validSig, err := os.ReadFile("fixtures/dir-img-dual-signed/signature-1")
+	require.NoError(t, err)
+	compromisedSig, err := os.ReadFile("fixtures/dir-img-dual-signed/signature-2")
+	require.NoError(t, err)
+
+	sar, parsedSig, err := compromised.isSignatureAuthorAccepted(context.Background(), img, validSig)
+	assertSARUnknown(t, sar, parsedSig, err)
+	sar, parsedSig, err = compromised.isSignatureAuthorAccepted(context.Background(), img, compromisedSig)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+	assertRejectionReason(t, PRReasonRejectedKey, err)
+	for _, sig := range [][]byte{validSig, compromisedSig} {
+		sar, parsedSig, err = other.isSignatureAuthorAccepted(context.Background(), img, sig)
+		assertSARUnknown(t, sar, parsedSig, err)
+	}
+}
+
+func TestPRRejectSignedByIsRunningImageAllowed(t *testing.T) {
+	compromisedKey, err := os.ReadFile("fixtures/public-key-2.gpg")
+	require.NoError(t, err)
+	const dualSignedDir = "fixtures/dir-img-dual-signed"
+
+	for _, pr := range []PolicyRequirement{
+		xNewPRRejectSignedBy(PRRejectSignedByWithKeyPath("fixtures/public-key-2.gpg")),
+		xNewPRRejectSignedBy(PRRejectSignedByWithKeyData(compromisedKey)),
+	} {
+		// An image signed by the compromised key, and by a valid key, is rejected
+		img := dirImageMock(t, dualSignedDir, "testing/manifest:latest")
+		allowed, err := pr.isRunningImageAllowed(context.Background(), img, nil)
+		assertRunningRejectedPolicyRequirement(t, allowed, err)
+		assertRejectionReason(t, PRReasonRejectedKey, err)
+
+		// An image signed only by the valid key is not blocked
+		img = dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+		allowed, err = pr.isRunningImageAllowed(context.Background(), img, nil)
+		assertRunningAllowed(t, allowed, err)
+
+		// Unsigned images and sigstore signatures are not blocked
+		for _, dir := range []string{"fixtures/dir-img-unsigned", "fixtures/dir-img-cosign-valid"} {
+			img = dirImageMock(t, dir, "testing/manifest:latest")
+			allowed, err = pr.isRunningImageAllowed(context.Background(), img, nil)
+			assertRunningAllowed(t, allowed, err)
+		}
+	}
+
+	// The requirement composes with requirements which accept the image
+	pc, err := NewPolicyContext(&Policy{Default: PolicyRequirements{
+		xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key-1.gpg", NewPRMMatchExact()),
+		xNewPRRejectSignedBy(PRRejectSignedByWithKeyPath("fixtures/public-key-2.gpg")),
+	}})
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+	allowed, err := pc.IsRunningImageAllowed(context.Background(), pcImageMock(t, dualSignedDir, "testing/manifest:latest"))
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	allowed, err = pc.IsRunningImageAllowed(context.Background(), pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest"))
+	assertRunningAllowed(t, allowed, err)
+
+	// Unusable keys
+	for _, pr := range []PolicyRequirement{
+		xNewPRRejectSignedBy(PRRejectSignedByWithKeyPath("/this/does/not/exist")),
+		xNewPRRejectSignedBy(PRRejectSignedByWithKeyData([]byte("this is invalid"))),
+	} {
+		img := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+		allowed, err := pr.isRunningImageAllowed(context.Background(), img, nil)
+		assertRunningRejected(t, allowed, err)
+	}
+}
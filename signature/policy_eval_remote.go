@@ -0,0 +1,197 @@
+// Policy evaluation for prRemote.
+
+package signature
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/tlsclientconfig"
+	"github.com/containers/image/v5/signature/internal"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/go-connections/tlsconfig"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// remoteDecisionRequest is the body of a request to a decision service of prRemote.
+type remoteDecisionRequest struct {
+	ImageReference  string                   `json:"imageReference"`            // transports.ImageName of the image
+	DockerReference string                   `json:"dockerReference,omitempty"` // The Docker reference of the image, if any
+	ManifestDigest  digest.Digest            `json:"manifestDigest"`
+	Signatures      []remoteSignatureSummary `json:"signatures"`
+}
+
+// remoteSignatureSummary is a summary of a single signature of the image, as sent to a decision service.
+// NOTE: The signatures are NOT verified; all of the values are claims made by the signature, and the decision
+// service must verify the signatures on its own if it relies on them.
+type remoteSignatureSummary struct {
+	Format                        signature.FormatID `json:"format"`
+	UntrustedDockerManifestDigest digest.Digest      `json:"untrustedDockerManifestDigest,omitempty"`
+	UntrustedDockerReference      string             `json:"untrustedDockerReference,omitempty"`
+	UntrustedShortKeyIdentifier   string             `json:"untrustedShortKeyIdentifier,omitempty"` // Only for simple signing signatures
+	Error                         string             `json:"error,omitempty"`                       // Set if the signature could not be parsed
+}
+
+// remoteDecisionResponse is the body of a response of a decision service of prRemote.
+type remoteDecisionResponse struct {
+	Allowed *bool  `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func (pr *prRemote) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	// The decision service decides about images, not about signatures.
+	return sarUnknown, nil, nil
+}
+
+func (pr *prRemote) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage, state *requirementEvaluationState) (bool, error) {
+	request, err := remoteDecisionRequestForImage(ctx, image)
+	if err != nil {
+		return false, err
+	}
+	response, err := pr.queryDecisionService(ctx, state.systemContext(), request)
+	if err != nil {
+		if ctx.Err() != nil { // Our caller has given up, don’t pretend the service has failed.
+			return false, ctx.Err()
+		}
+		if pr.FailureMode == PRRemoteFailOpen {
+			logrus.Warnf("Policy decision service %s failed, allowing image %s: %v", pr.URL, request.ImageReference, err)
+			return true, nil
+		}
+		return false, fmt.Errorf("policy decision service %s: %w", pr.URL, err)
+	}
+	if !*response.Allowed {
+		reason := response.Reason
+		if reason == "" {
+			reason = "no reason given"
+		}
+		return false, newPolicyRequirementError(PRReasonRejectedByDecisionService, fmt.Sprintf("Running image %s is rejected by policy decision service %s: %s", request.ImageReference, pr.URL, reason))
+	}
+	return true, nil
+}
+
+// remoteDecisionRequestForImage returns a request to a decision service, describing image.
+func remoteDecisionRequestForImage(ctx context.Context, image private.UnparsedImage) (*remoteDecisionRequest, error) {
+	m, _, err := image.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	manifestDigest, err := manifest.Digest(m)
+	if err != nil {
+		return nil, err
+	}
+	sigs, err := image.UntrustedSignatures(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := remoteDecisionRequest{
+		ImageReference: transports.ImageName(image.Reference()),
+		ManifestDigest: manifestDigest,
+		Signatures:     make([]remoteSignatureSummary, 0, len(sigs)),
+	}
+	if ref := image.Reference().DockerReference(); ref != nil {
+		res.DockerReference = ref.String()
+	}
+	for _, sig := range sigs {
+		res.Signatures = append(res.Signatures, summarizeUntrustedSignature(sig))
+	}
+	return &res, nil
+}
+
+// summarizeUntrustedSignature returns a summary of sig, WITHOUT verifying it.
+func summarizeUntrustedSignature(sig signature.Signature) remoteSignatureSummary {
+	res := remoteSignatureSummary{Format: sig.FormatID()}
+	switch sig := sig.(type) {
+	case signature.SimpleSigning:
+		info, err := GetUntrustedSignatureInformationWithoutVerifying(sig.UntrustedSignature())
+		if err != nil {
+			res.Error = err.Error()
+			break
+		}
+		res.UntrustedDockerManifestDigest = info.UntrustedDockerManifestDigest
+		res.UntrustedDockerReference = info.UntrustedDockerReference
+		res.UntrustedShortKeyIdentifier = info.UntrustedShortKeyIdentifier
+	case signature.Sigstore:
+		if sig.UntrustedMIMEType() != signature.SigstoreSignatureMIMEType {
+			res.Error = fmt.Sprintf("unexpected MIME type %q", sig.UntrustedMIMEType())
+			break
+		}
+		var payload internal.UntrustedSigstorePayload
+		if err := json.Unmarshal(sig.UntrustedPayload(), &payload); err != nil {
+			res.Error = err.Error()
+			break
+		}
+		res.UntrustedDockerManifestDigest = payload.UntrustedDockerManifestDigest()
+		res.UntrustedDockerReference = payload.UntrustedDockerReference()
+	default:
+		res.Error = "unsupported signature format"
+	}
+	return res
+}
+
+// queryDecisionService sends request to the decision service of pr, using sys (which may be nil), and returns its valid response.
+// Any failure to obtain a valid response is reported as an error.
+func (pr *prRemote) queryDecisionService(ctx context.Context, sys *types.SystemContext, request *remoteDecisionRequest) (*remoteDecisionResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newRemoteDecisionClient(sys)
+	if err != nil {
+		return nil, err
+	}
+	defer client.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(ctx, pr.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pr.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if sys != nil && sys.PolicyDecisionServiceBearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+sys.PolicyDecisionServiceBearerToken)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", res.Status)
+	}
+	responseBody, err := iolimits.ReadAtMost(res.Body, iolimits.MaxPolicyDecisionBodySize)
+	if err != nil {
+		return nil, err
+	}
+	var response remoteDecisionResponse
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	if response.Allowed == nil {
+		return nil, errors.New(`invalid response: "allowed" not specified`)
+	}
+	return &response, nil
+}
+
+// newRemoteDecisionClient returns a HTTP client for contacting decision services, configured using sys.
+func newRemoteDecisionClient(sys *types.SystemContext) (*http.Client, error) {
+	tr := tlsclientconfig.NewTransport()
+	tr.TLSClientConfig = tlsconfig.ClientDefault()
+	if sys != nil && sys.PolicyDecisionServiceCertPath != "" {
+		if err := tlsclientconfig.SetupCertificates(sys.PolicyDecisionServiceCertPath, tr.TLSClientConfig); err != nil {
+			return nil, err
+		}
+	}
+	return &http.Client{Transport: tr}, nil
+}
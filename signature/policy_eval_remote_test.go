@@ -0,0 +1,243 @@
+package signature
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decisionServiceMock is a mock of a decision service of prRemote.
+type decisionServiceMock struct {
+	mutex    sync.Mutex
+	requests []remoteDecisionRequest
+	headers  []http.Header
+	// handle, if set, is used to respond to requests instead of respond.
+	handle  func(w http.ResponseWriter, r *http.Request)
+	respond remoteDecisionResponse
+}
+
+// reset clears the recorded requests, and sets up responses using handle or respond.
+func (m *decisionServiceMock) reset(handle func(w http.ResponseWriter, r *http.Request), respond remoteDecisionResponse) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.requests = nil
+	m.headers = nil
+	m.handle = handle
+	m.respond = respond
+}
+
+// recorded returns the recorded requests and their headers.
+func (m *decisionServiceMock) recorded() ([]remoteDecisionRequest, []http.Header) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.requests, m.headers
+}
+
+func (m *decisionServiceMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request remoteDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.mutex.Lock()
+	m.requests = append(m.requests, request)
+	m.headers = append(m.headers, r.Header.Clone())
+	handle, respond := m.handle, m.respond
+	m.mutex.Unlock()
+	if handle != nil {
+		handle(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(respond)
+}
+
+// newPRRemoteForTest returns a prRemote for url, failing the test on errors.
+func newPRRemoteForTest(t *testing.T, url string, options ...PRRemoteOption) PolicyRequirement {
+	pr, err := NewPRRemote(append([]PRRemoteOption{PRRemoteWithURL(url)}, options...)...)
+	require.NoError(t, err)
+	return pr
+}
+
+func TestPRRemoteIsSignatureAuthorAccepted(t *testing.T) {
+	// The decision service is not consulted about individual signatures.
+	pr := newPRRemoteForTest(t, "https://decisions.example.com")
+	img := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	sig, err := os.ReadFile("fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), img, sig)
+	assertSARUnknown(t, sar, parsedSig, err)
+}
+
+func TestPRRemoteIsRunningImageAllowed(t *testing.T) {
+	allowed, denied := true, false
+	mock := &decisionServiceMock{respond: remoteDecisionResponse{Allowed: &allowed}}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	// The request contents
+	for _, c := range []struct {
+		dir, dockerReference string
+		normalizedReference  string
+		manifestDigest       digest.Digest
+		signatures           []remoteSignatureSummary
+	}{
+		{
+			dir:                 "fixtures/dir-img-valid",
+			dockerReference:     "testing/manifest:latest",
+			normalizedReference: "docker.io/testing/manifest:latest",
+			manifestDigest:      TestImageManifestDigest,
+			signatures: []remoteSignatureSummary{{
+				Format:                        signature.SimpleSigningFormat,
+				UntrustedDockerManifestDigest: TestImageManifestDigest,
+				UntrustedDockerReference:      "testing/manifest:latest",
+				UntrustedShortKeyIdentifier:   TestKeyShortID,
+			}},
+		},
+		{
+			dir:                 "fixtures/dir-img-cosign-valid",
+			dockerReference:     "192.168.64.2:5000/cosign-signed-single-sample:latest",
+			normalizedReference: "192.168.64.2:5000/cosign-signed-single-sample:latest",
+			manifestDigest:      "sha256:634a8f35b5f16dcf4aaa0822adc0b1964bb786fca12f6831de8ddc45e5986a00",
+			signatures: []remoteSignatureSummary{{
+				Format:                        signature.SigstoreFormat,
+				UntrustedDockerManifestDigest: "sha256:634a8f35b5f16dcf4aaa0822adc0b1964bb786fca12f6831de8ddc45e5986a00",
+				UntrustedDockerReference:      "192.168.64.2:5000/cosign-signed-single-sample",
+			}},
+		},
+		{
+			dir:                 "fixtures/dir-img-unsigned",
+			dockerReference:     "testing/manifest:latest",
+			normalizedReference: "docker.io/testing/manifest:latest",
+			manifestDigest:      TestImageManifestDigest,
+			signatures:          []remoteSignatureSummary{},
+		},
+	} {
+		mock.reset(nil, remoteDecisionResponse{Allowed: &allowed})
+		img := pcImageMock(t, c.dir, c.dockerReference)
+		res, err := newPRRemoteForTest(t, server.URL).isRunningImageAllowed(context.Background(), img, nil)
+		assertRunningAllowed(t, res, err)
+		requests, _ := mock.recorded()
+		require.Len(t, requests, 1, c.dir)
+		assert.Equal(t, remoteDecisionRequest{
+			ImageReference:  "docker:== StringWithinTransport mock",
+			DockerReference: c.normalizedReference,
+			ManifestDigest:  c.manifestDigest,
+			Signatures:      c.signatures,
+		}, requests[0], c.dir)
+	}
+
+	img := pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+
+	// Denied
+	mock.reset(nil, remoteDecisionResponse{Allowed: &denied, Reason: "image is not from an approved registry"})
+	for _, mode := range []prRemoteFailureMode{PRRemoteFailClosed, PRRemoteFailOpen} {
+		res, err := newPRRemoteForTest(t, server.URL, PRRemoteWithFailureMode(mode)).isRunningImageAllowed(context.Background(), img, nil)
+		assertRunningRejectedPolicyRequirement(t, res, err)
+		assert.ErrorContains(t, err, "image is not from an approved registry")
+	}
+
+	// Service failures
+	for _, handle := range []func(w http.ResponseWriter, r *http.Request){
+		func(w http.ResponseWriter, r *http.Request) { // Timeout
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+		},
+		func(w http.ResponseWriter, r *http.Request) { // HTTP error
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		},
+		func(w http.ResponseWriter, r *http.Request) { // Invalid JSON
+			_, _ = w.Write([]byte("this is invalid"))
+		},
+		func(w http.ResponseWriter, r *http.Request) { // Missing "allowed"
+			_, _ = w.Write([]byte(`{"reason":"allowed is missing"}`))
+		},
+	} {
+		mock.reset(handle, remoteDecisionResponse{})
+		pr := newPRRemoteForTest(t, server.URL, PRRemoteWithTimeout(100*time.Millisecond))
+		res, err := pr.isRunningImageAllowed(context.Background(), img, nil)
+		assertRunningRejected(t, res, err)
+
+		pr = newPRRemoteForTest(t, server.URL, PRRemoteWithTimeout(100*time.Millisecond), PRRemoteWithFailureMode(PRRemoteFailOpen))
+		res, err = pr.isRunningImageAllowed(context.Background(), img, nil)
+		assertRunningAllowed(t, res, err)
+	}
+	mock.reset(nil, remoteDecisionResponse{Allowed: &allowed})
+
+	// A service which can’t be contacted at all
+	unreachable := httptest.NewServer(mock)
+	unreachable.Close()
+	res, err := newPRRemoteForTest(t, unreachable.URL).isRunningImageAllowed(context.Background(), img, nil)
+	assertRunningRejected(t, res, err)
+	res, err = newPRRemoteForTest(t, unreachable.URL, PRRemoteWithFailureMode(PRRemoteFailOpen)).isRunningImageAllowed(context.Background(), img, nil)
+	assertRunningAllowed(t, res, err)
+
+	// A canceled caller’s context is not a service failure, even with failOpen
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err = newPRRemoteForTest(t, server.URL, PRRemoteWithFailureMode(PRRemoteFailOpen)).isRunningImageAllowed(ctx, img, nil)
+	assertRunningRejected(t, res, err)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Local failures are not affected by failOpen
+	img = pcImageMock(t, "fixtures/dir-img-no-manifest", "testing/manifest:latest")
+	res, err = newPRRemoteForTest(t, server.URL, PRRemoteWithFailureMode(PRRemoteFailOpen)).isRunningImageAllowed(context.Background(), img, nil)
+	assertRunningRejected(t, res, err)
+}
+
+func TestPRRemoteSystemContext(t *testing.T) {
+	allowed := true
+	mock := &decisionServiceMock{respond: remoteDecisionResponse{Allowed: &allowed}}
+	server := httptest.NewTLSServer(mock)
+	defer server.Close()
+	certDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(certDir, "ca.crt"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o644)
+	require.NoError(t, err)
+
+	policy := &Policy{Default: PolicyRequirements{newPRRemoteForTest(t, server.URL)}}
+	img := pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+
+	// Without the CA certificate, the server is not trusted.
+	pc, err := NewPolicyContext(policy)
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+	res, err := pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejected(t, res, err)
+	requests, _ := mock.recorded()
+	assert.Empty(t, requests)
+
+	pc.SystemContext = &types.SystemContext{
+		PolicyDecisionServiceCertPath:    certDir,
+		PolicyDecisionServiceBearerToken: "secret-token",
+	}
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	_, headers := mock.recorded()
+	require.Len(t, headers, 1)
+	assert.Equal(t, "Bearer secret-token", headers[0].Get("Authorization"))
+
+	report, err := pc.EvaluateAllRequirements(context.Background(), img)
+	require.NoError(t, err)
+	assert.True(t, report.Allowed)
+	_, headers = mock.recorded()
+	assert.Len(t, headers, 2)
+}
@@ -0,0 +1,156 @@
+// This defines a diagnostic evaluation of a policy, reporting all rejections.
+
+package signature
+
+import (
+	"context"
+	"time"
+
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/internal/unparsedimage"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// PolicyEvaluationReport is the outcome of PolicyContext.EvaluateAllRequirements.
+type PolicyEvaluationReport struct {
+	// Allowed is true iff the policy allows running the image; it is always consistent with IsRunningImageAllowed.
+	Allowed bool `json:"allowed"`
+	// Error is the reason why the policy can’t allow running the image at all, regardless of the individual requirements.
+	Error string `json:"error,omitempty"`
+	// Requirements are the results of all of the policy requirements applicable to the image, in order.
+	Requirements []RequirementEvaluationReport `json:"requirements"`
+}
+
+// RequirementEvaluationReport is the outcome of evaluating a single PolicyRequirement in EvaluateAllRequirements.
+type RequirementEvaluationReport struct {
+	Index       int               `json:"index"` // The index of the requirement within the policy requirements applicable to the image
+	Requirement PolicyRequirement `json:"requirement"`
+	Allowed     bool              `json:"allowed"`          // true if the requirement allows running the image
+	Error       string            `json:"error,omitempty"`  // The reason for rejection, if !Allowed
+	Reason      PRReason          `json:"reason,omitempty"` // The machine-readable reason for rejection, if !Allowed and known
+	// Signatures are the results of evaluating the individual signatures the requirement deals with.
+	// This is empty for requirements which do not deal with signatures.
+	Signatures []SignatureEvaluationReport `json:"signatures,omitempty"`
+}
+
+// SignatureEvaluationReport is the outcome of evaluating a single signature by a single PolicyRequirement in EvaluateAllRequirements.
+type SignatureEvaluationReport struct {
+	Index       int      `json:"index"`       // The index of the signature among all signatures of the image, in the canonical order used for all transports
+	SourceIndex int      `json:"sourceIndex"` // The index of the signature in the transport-specific order, for debugging
+	Accepted    bool     `json:"accepted"`
+	Error       string   `json:"error,omitempty"`  // The reason for rejection, if !Accepted
+	Reason      PRReason `json:"reason,omitempty"` // The machine-readable reason for rejection, if !Accepted and known
+	// The following fields are only set if Accepted, see AcceptedSignature for their values.
+	DockerManifestDigest digest.Digest `json:"dockerManifestDigest,omitempty"`
+	DockerReference      string        `json:"dockerReference,omitempty"`
+	KeyIdentity          string        `json:"keyIdentity,omitempty"`
+	Signer               string        `json:"signer,omitempty"`
+	Creator              string        `json:"creator,omitempty"`
+	Timestamp            *time.Time    `json:"timestamp,omitempty"`
+}
+
+// EvaluateAllRequirements evaluates every policy requirement applicable to the image, and every signature of the image
+// by each requirement which deals with signatures, and returns a report of all of the results, e.g. for debugging a policy.
+// Unlike IsRunningImageAllowed, it does not stop at the first rejection.
+// Requirements may accept an image without accepting all of its signatures; Allowed in the report, and the Allowed results
+// of the individual requirements, decide whether the policy allows running the image, exactly as IsRunningImageAllowed does.
+// The error return value is only used if the evaluation could not be performed;
+// rejections are recorded in the report.
+// WARNING: This validates signatures and the manifest, but does not download or validate the
+// layers. Users must validate that the layers match their expected digests.
+func (pc *PolicyContext) EvaluateAllRequirements(ctx context.Context, publicImage types.UnparsedImage) (report *PolicyEvaluationReport, finalErr error) {
+	if err := pc.changeState(pcReady, pcInUse); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := pc.changeState(pcInUse, pcReady); err != nil {
+			report = nil
+			finalErr = err
+		}
+	}()
+
+	image := unparsedimage.FromPublic(publicImage)
+
+	logrus.Debugf("EvaluateAllRequirements for image %s", policyIdentityLogName(image.Reference()))
+	reqs := pc.requirementsForImageRef(image.Reference())
+
+	res := &PolicyEvaluationReport{
+		Allowed:      len(reqs) != 0,
+		Requirements: []RequirementEvaluationReport{},
+	}
+	if len(reqs) == 0 {
+		res.Error = newPolicyRequirementError(PRReasonNoRequirements, "List of verification policy requirements must not be empty").Error()
+		return res, nil
+	}
+
+	var sigs []signature.Signature // Read only if necessary
+	var sigSourceIndices []int     // Valid iff sigsRead
+	sigsRead := false
+	for reqNumber, req := range reqs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		reqReport := RequirementEvaluationReport{Index: reqNumber, Requirement: req}
+		// The verdict is determined exactly as in IsRunningImageAllowed; the signature evaluations below are only informative.
+		allowed, err := req.isRunningImageAllowed(ctx, image, pc.requirementEvaluationState(reqNumber, false))
+		reqReport.Allowed = allowed
+		if !allowed {
+			logrus.Debugf(" Requirement %d: denied", reqNumber)
+			res.Allowed = false
+			if err != nil {
+				reqReport.Error = err.Error()
+				reqReport.Reason = policyRequirementReason(err)
+			}
+		} else {
+			logrus.Debugf(" Requirement %d: allowed", reqNumber)
+		}
+
+		if sr, ok := req.(signatureEvaluatingPolicyRequirement); ok {
+			if !sigsRead {
+				s, err := image.UntrustedSignatures(ctx)
+				if err != nil {
+					return nil, err
+				}
+				indices, err := image.UntrustedSignatureSourceIndices(ctx)
+				if err != nil {
+					return nil, err
+				}
+				sigs = s
+				sigSourceIndices = indices
+				sigsRead = true
+			}
+			for sigIndex, sig := range sigs {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				applicable, accepted, err := sr.evaluateSignature(ctx, image, sig)
+				if !applicable {
+					continue
+				}
+				sigReport := SignatureEvaluationReport{Index: sigIndex, SourceIndex: sigSourceIndices[sigIndex]}
+				if err != nil || accepted == nil {
+					logrus.Debugf("  Signature %d: rejected", sigIndex)
+					if err != nil {
+						sigReport.Error = err.Error()
+						sigReport.Reason = policyRequirementReason(err)
+					}
+				} else {
+					logrus.Debugf("  Signature %d: accepted", sigIndex)
+					sigReport.Accepted = true
+					sigReport.DockerManifestDigest = accepted.DockerManifestDigest
+					sigReport.DockerReference = accepted.DockerReference
+					sigReport.KeyIdentity = accepted.KeyIdentity
+					sigReport.Signer = accepted.Signer
+					sigReport.Creator = accepted.Creator
+					sigReport.Timestamp = accepted.Timestamp
+				}
+				reqReport.Signatures = append(reqReport.Signatures, sigReport)
+			}
+		}
+		res.Requirements = append(res.Requirements, reqReport)
+	}
+	logrus.Debugf("Overall: allowed = %v", res.Allowed)
+	return res, nil
+}
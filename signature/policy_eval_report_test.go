@@ -0,0 +1,173 @@
+package signature
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signatureReportWithSourceIndex returns the element of reports which describes the signature with sourceIndex.
+func signatureReportWithSourceIndex(t *testing.T, reports []SignatureEvaluationReport, sourceIndex int) SignatureEvaluationReport {
+	for i, r := range reports {
+		if r.SourceIndex == sourceIndex {
+			assert.Equal(t, i, r.Index)
+			return r
+		}
+	}
+	require.FailNow(t, "signature not found", "source index %d", sourceIndex)
+	return SignatureEvaluationReport{} // Unreachable
+}
+
+func TestPolicyContextEvaluateAllRequirements(t *testing.T) {
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest:latest": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key-2.gpg", NewPRMMatchRepository()),
+					NewPRInsecureAcceptAnything(),
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository()),
+				},
+				"docker.io/testing/manifest:allowed": {
+					NewPRInsecureAcceptAnything(),
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository()),
+				},
+				"192.168.64.2:5000/cosign-signed-single-sample": {
+					xNewPRSigstoreSigned(
+						PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+						PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+					),
+				},
+				"docker.io/testing/manifest:empty": {},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+
+	// All requirements and signatures are evaluated, even after a rejection.
+	img := pcImageMock(t, "fixtures/dir-img-mixed", "testing/manifest:latest")
+	report, err := pc.EvaluateAllRequirements(context.Background(), img)
+	require.NoError(t, err)
+	assert.False(t, report.Allowed)
+	assert.Empty(t, report.Error)
+	require.Len(t, report.Requirements, 3)
+	for i, r := range report.Requirements {
+		assert.Equal(t, i, r.Index)
+	}
+	// signedBy an unexpected key: both signatures are rejected
+	r := report.Requirements[0]
+	assert.False(t, r.Allowed)
+	assert.NotEmpty(t, r.Error)
+	require.Len(t, r.Signatures, 2)
+	sourceIndices := []int{}
+	for i, s := range r.Signatures {
+		assert.Equal(t, i, s.Index)
+		sourceIndices = append(sourceIndices, s.SourceIndex)
+		assert.False(t, s.Accepted)
+		assert.NotEmpty(t, s.Error)
+		assert.Empty(t, s.KeyIdentity)
+	}
+	assert.ElementsMatch(t, []int{0, 1}, sourceIndices)
+	assert.Equal(t, PRReasonUntrustedKey, signatureReportWithSourceIndex(t, r.Signatures, 1).Reason)
+	// insecureAcceptAnything: no signatures are evaluated
+	r = report.Requirements[1]
+	assert.True(t, r.Allowed)
+	assert.Empty(t, r.Error)
+	assert.Empty(t, r.Signatures)
+	// signedBy the expected key: the first signature is invalid, the second one is accepted
+	r = report.Requirements[2]
+	assert.True(t, r.Allowed)
+	assert.Empty(t, r.Error)
+	require.Len(t, r.Signatures, 2)
+	s := signatureReportWithSourceIndex(t, r.Signatures, 0)
+	assert.False(t, s.Accepted)
+	assert.NotEmpty(t, s.Error)
+	s = signatureReportWithSourceIndex(t, r.Signatures, 1)
+	assert.Equal(t, SignatureEvaluationReport{
+		Index:                canonicalSignatureIndex(t, img, 1),
+		SourceIndex:          1,
+		Accepted:             true,
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+		KeyIdentity:          TestKeyFingerprint,
+		Signer:               TestKeyFingerprint,
+	}, s)
+	// The boolean API is unchanged.
+	allowed, err := pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+
+	// The report is consistent with IsRunningImageAllowed for allowed images.
+	img = pcImageMock(t, "fixtures/dir-img-mixed", "testing/manifest:allowed")
+	report, err = pc.EvaluateAllRequirements(context.Background(), img)
+	require.NoError(t, err)
+	assert.True(t, report.Allowed)
+	require.Len(t, report.Requirements, 2)
+	assert.True(t, report.Requirements[0].Allowed)
+	assert.True(t, report.Requirements[1].Allowed)
+	allowed, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningAllowed(t, allowed, err)
+
+	// sigstoreSigned: one invalid, one valid signature (in this order)
+	img = pcImageMock(t, "fixtures/dir-img-cosign-mixed", "192.168.64.2:5000/cosign-signed-single-sample:latest")
+	report, err = pc.EvaluateAllRequirements(context.Background(), img)
+	require.NoError(t, err)
+	assert.True(t, report.Allowed)
+	require.Len(t, report.Requirements, 1)
+	r = report.Requirements[0]
+	assert.True(t, r.Allowed)
+	require.Len(t, r.Signatures, 2)
+	s = signatureReportWithSourceIndex(t, r.Signatures, 0)
+	assert.False(t, s.Accepted)
+	assert.NotEmpty(t, s.Error)
+	s = signatureReportWithSourceIndex(t, r.Signatures, 1)
+	assert.True(t, s.Accepted)
+	assert.Empty(t, s.Error)
+	assert.NotEmpty(t, s.KeyIdentity)
+
+	// Empty requirements are rejected
+	img = pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:empty")
+	report, err = pc.EvaluateAllRequirements(context.Background(), img)
+	require.NoError(t, err)
+	assert.False(t, report.Allowed)
+	assert.NotEmpty(t, report.Error)
+	assert.Empty(t, report.Requirements)
+
+	// The report can be serialized to JSON
+	img = pcImageMock(t, "fixtures/dir-img-mixed", "testing/manifest:latest")
+	report, err = pc.EvaluateAllRequirements(context.Background(), img)
+	require.NoError(t, err)
+	reportJSON, err := json.Marshal(report)
+	require.NoError(t, err)
+	var parsed map[string]any
+	err = json.Unmarshal(reportJSON, &parsed)
+	require.NoError(t, err)
+	assert.Equal(t, false, parsed["allowed"])
+	reqs, ok := parsed["requirements"].([]any)
+	require.True(t, ok)
+	require.Len(t, reqs, 3)
+	req, ok := reqs[1].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, map[string]any{"type": "insecureAcceptAnything"}, req["requirement"])
+	assert.Equal(t, true, req["allowed"])
+
+	// Evaluation aborts if ctx is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = pc.EvaluateAllRequirements(ctx, img)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Misuse of the PolicyContext is rejected
+	destroyedPC, err := NewPolicyContext(pc.Policy)
+	require.NoError(t, err)
+	err = destroyedPC.Destroy()
+	require.NoError(t, err)
+	_, err = destroyedPC.EvaluateAllRequirements(context.Background(), img)
+	assert.Error(t, err)
+}
@@ -7,77 +7,106 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/manifest"
 	digest "github.com/opencontainers/go-digest"
 	"golang.org/x/exp/slices"
 )
 
 func (pr *prSignedBy) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	res, signature, _, err := pr.isSignatureAuthorAcceptedWithKeyIdentity(ctx, image, sig)
+	return res, signature, err
+}
+
+// isSignatureAuthorAcceptedWithKeyIdentity is isSignatureAuthorAccepted, which also returns the identity of the key
+// which verified the signature, if the signature is accepted.
+func (pr *prSignedBy) isSignatureAuthorAcceptedWithKeyIdentity(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, string, error) {
 	switch pr.KeyType {
 	case SBKeyTypeGPGKeys:
 	case SBKeyTypeSignedByGPGKeys, SBKeyTypeX509Certificates, SBKeyTypeSignedByX509CAs:
 		// FIXME? Reject this at policy parsing time already?
-		return sarRejected, nil, fmt.Errorf(`Unimplemented "keyType" value "%s"`, string(pr.KeyType))
+		return sarRejected, nil, "", fmt.Errorf(`Unimplemented "keyType" value "%s"`, string(pr.KeyType))
 	default:
 		// This should never happen, newPRSignedBy ensures KeyType.IsValid()
-		return sarRejected, nil, fmt.Errorf(`Unknown "keyType" value "%s"`, string(pr.KeyType))
+		return sarRejected, nil, "", fmt.Errorf(`Unknown "keyType" value "%s"`, string(pr.KeyType))
 	}
 
 	// FIXME: move this to per-context initialization
 	var data [][]byte
+	var dataSources []string // A description of each element of data, for error messages
 	keySources := 0
 	if pr.KeyPath != "" {
 		keySources++
 		d, err := os.ReadFile(pr.KeyPath)
 		if err != nil {
-			return sarRejected, nil, err
+			return sarRejected, nil, "", err
 		}
 		data = [][]byte{d}
+		dataSources = []string{pr.KeyPath}
 	}
 	if pr.KeyPaths != nil {
 		keySources++
 		data = [][]byte{}
+		dataSources = []string{}
 		for _, path := range pr.KeyPaths {
 			d, err := os.ReadFile(path)
 			if err != nil {
-				return sarRejected, nil, err
+				return sarRejected, nil, "", err
 			}
 			data = append(data, d)
+			dataSources = append(dataSources, path)
 		}
 	}
 	if pr.KeyData != nil {
 		keySources++
 		data = [][]byte{pr.KeyData}
+		dataSources = []string{`"keyData"`}
+	}
+	if pr.KeyDirectory != "" {
+		keySources++
+		d, paths, err := readKeyDirectory(pr.KeyDirectory)
+		if err != nil {
+			return sarRejected, nil, "", err
+		}
+		data = d
+		dataSources = paths
 	}
 	if keySources != 1 {
-		return sarRejected, nil, errors.New(`Internal inconsistency: not exactly one of "keyPath", "keyPaths" and "keyData" specified`)
+		return sarRejected, nil, "", errors.New(`Internal inconsistency: not exactly one of "keyPath", "keyPaths", "keyData" and "keyDirectory" specified`)
 	}
 
 	// FIXME: move this to per-context initialization
 	mech, trustedIdentities, err := newEphemeralGPGSigningMechanism(data)
 	if err != nil {
-		return sarRejected, nil, err
+		return sarRejected, nil, "", keyImportError(data, dataSources, err)
 	}
 	defer mech.Close()
 	if len(trustedIdentities) == 0 {
-		return sarRejected, nil, PolicyRequirementError("No public keys imported")
+		return sarRejected, nil, "", newPolicyRequirementError(PRReasonUntrustedKey, "No public keys imported")
 	}
 
-	signature, err := verifyAndExtractSignature(mech, sig, signatureAcceptanceRules{
+	var verifier SigningMechanism = mech
+	if pr.AllowExpiredKeys {
+		verifier = expiredKeysAllowingMechanism{mech}
+	}
+	acceptedKeyIdentity := ""
+	signature, err := verifyAndExtractSignature(verifier, sig, signatureAcceptanceRules{
 		validateKeyIdentity: func(keyIdentity string) error {
 			if slices.Contains(trustedIdentities, keyIdentity) {
+				acceptedKeyIdentity = keyIdentity
 				return nil
 			}
 			// Coverage: We use a private GPG home directory and only import trusted keys, so this should
 			// not be reachable.
-			return PolicyRequirementError(fmt.Sprintf("Signature by key %s is not accepted", keyIdentity))
+			return newPolicyRequirementError(PRReasonUntrustedKey, fmt.Sprintf("Signature by key %s is not accepted", keyIdentity))
 		},
 		validateSignedDockerReference: func(ref string) error {
 			if !pr.SignedIdentity.matchesDockerReference(image, ref) {
-				return PolicyRequirementError(fmt.Sprintf("Signature for identity %s is not accepted", ref))
+				return newPolicyRequirementError(PRReasonIdentityMismatch, fmt.Sprintf("Signature for identity %s is not accepted", ref))
 			}
 			return nil
 		},
@@ -91,32 +120,150 @@ func (pr *prSignedBy) isSignatureAuthorAccepted(ctx context.Context, image priva
 				return err
 			}
 			if !digestMatches {
-				return PolicyRequirementError(fmt.Sprintf("Signature for digest %s does not match", digest))
+				return newPolicyRequirementError(PRReasonDigestMismatch, fmt.Sprintf("Signature for digest %s does not match", digest))
 			}
 			return nil
 		},
 	})
 	if err != nil {
-		return sarRejected, nil, err
+		var prErr PolicyRequirementError
+		if !errors.As(err, &prErr) && isSignedByUntrustedKey(mech, sig, trustedIdentities) {
+			err = policyRequirementErrorWithCause(PRReasonUntrustedKey, err)
+		}
+		return sarRejected, nil, "", err
 	}
 
-	return sarAccepted, signature, nil
+	return sarAccepted, signature, acceptedKeyIdentity, nil
+}
+
+// readKeyDirectory returns the contents of all files in dir, and their paths.
+func readKeyDirectory(dir string) ([][]byte, []string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	data := [][]byte{}
+	paths := []string{}
+	for _, entry := range entries { // os.ReadDir returns the entries sorted by name.
+		path := filepath.Join(dir, entry.Name())
+		fi, err := os.Stat(path) // Unlike entry.Type(), this follows symbolic links.
+		if err != nil {
+			return nil, nil, err
+		}
+		if fi.IsDir() {
+			continue
+		}
+		d, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = append(data, d)
+		paths = append(paths, path)
+	}
+	return data, paths, nil
 }
 
-func (pr *prSignedBy) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
-	// FIXME: Use image.UntrustedSignatures, use that to improve error messages
+// keyImportError returns an error for err, a failure to import keys from data, identifying the element of data which
+// caused the failure using dataSources, if possible.
+func keyImportError(data [][]byte, dataSources []string, err error) error {
+	if len(data) > 1 {
+		// The mechanism doesn’t tell us which of the blobs has failed; import them one at a time to find out.
+		for i, blob := range data {
+			mech, _, blobErr := newEphemeralGPGSigningMechanism([][]byte{blob})
+			if blobErr != nil {
+				return fmt.Errorf("importing keys from %s: %w", dataSources[i], blobErr)
+			}
+			mech.Close()
+		}
+	} else if len(data) == 1 {
+		return fmt.Errorf("importing keys from %s: %w", dataSources[0], err)
+	}
+	return err
+}
+
+// expiredKeysAllowingMechanism is a SigningMechanism which also accepts signatures created before the signing key expired,
+// even if the key has expired since.
+type expiredKeysAllowingMechanism struct {
+	signingMechanismWithPassphrase
+}
+
+// Verify parses unverifiedSignature and returns the content and the signer's identity
+func (m expiredKeysAllowingMechanism) Verify(unverifiedSignature []byte) (contents []byte, keyIdentity string, err error) {
+	return m.verifyAllowingExpiredKeys(unverifiedSignature)
+}
+
+// isSignedByUntrustedKey returns true if the UNVERIFIED sig claims to be made by a key other than trustedIdentities.
+// This is only useful for classifying an already rejected signature; it must not be used to accept anything.
+func isSignedByUntrustedKey(mech SigningMechanism, sig []byte, trustedIdentities []string) bool {
+	_, shortKeyIdentifier, err := mech.UntrustedSignatureContents(sig)
+	if err != nil || shortKeyIdentifier == "" {
+		return false
+	}
+	// The short key identifier is a suffix of the fingerprint for V4 keys; for other keys, this errs on the side
+	// of classifying the signature as made by an untrusted key, which it almost certainly is.
+	for _, identity := range trustedIdentities {
+		if strings.HasSuffix(strings.ToUpper(identity), shortKeyIdentifier) {
+			return false
+		}
+	}
+	return true
+}
+
+func (pr *prSignedBy) evaluateSignature(ctx context.Context, image private.UnparsedImage, sig signature.Signature) (bool, *AcceptedSignature, error) {
+	simpleSig, ok := sig.(signature.SimpleSigning)
+	if !ok {
+		return false, nil, nil
+	}
+	switch res, acceptedSig, keyIdentity, err := pr.isSignatureAuthorAcceptedWithKeyIdentity(ctx, image, simpleSig.UntrustedSignature()); res {
+	case sarAccepted:
+		return true, &AcceptedSignature{
+			DockerManifestDigest: acceptedSig.DockerManifestDigest,
+			DockerReference:      acceptedSig.DockerReference,
+			KeyIdentity:          keyIdentity,
+			Signer:               keyIdentity,
+		}, nil
+	case sarRejected:
+		return true, nil, err
+	default:
+		return true, nil, fmt.Errorf(`Internal error: Unexpected signature verification result "%s"`, string(res))
+	}
+}
+
+func (pr *prSignedBy) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage, state *requirementEvaluationState) (bool, error) {
+	res, _, err := pr.isRunningImageAllowedWithSignatures(ctx, image, state)
+	return res, err
+}
+
+func (pr *prSignedBy) isCacheable() bool {
+	return true
+}
+
+func (pr *prSignedBy) isRunningImageAllowedWithSignatures(ctx context.Context, image private.UnparsedImage, state *requirementEvaluationState) (bool, []AcceptedSignature, error) {
+	// FIXME: Use image.UntrustedSignatures to improve error messages
 	// (needs tests!)
-	sigs, err := image.Signatures(ctx)
+	sigs, err := image.UntrustedSignatures(ctx)
 	if err != nil {
-		return false, err
+		return false, nil, err
 	}
 	var rejections []error
-	for _, s := range sigs {
+	for sigIndex, s := range sigs {
+		simpleSig, ok := s.(signature.SimpleSigning)
+		if !ok {
+			continue
+		}
 		var reason error
-		switch res, _, err := pr.isSignatureAuthorAccepted(ctx, image, s); res {
+		switch res, acceptedSig, keyIdentity, err := pr.isSignatureAuthorAcceptedWithKeyIdentity(ctx, image, simpleSig.UntrustedSignature()); res {
 		case sarAccepted:
 			// One accepted signature is enough.
-			return true, nil
+			// The evaluation is complete, so cancellation of ctx no longer matters.
+			_ = state.signatureEvaluated(ctx, sigIndex, nil)
+			return true, []AcceptedSignature{{
+				SignatureIndex:       sigIndex,
+				DockerManifestDigest: acceptedSig.DockerManifestDigest,
+				DockerReference:      acceptedSig.DockerReference,
+				KeyIdentity:          keyIdentity,
+				Signer:               keyIdentity,
+			}}, nil
 		case sarRejected:
 			reason = err
 		case sarUnknown:
@@ -126,11 +273,14 @@ func (pr *prSignedBy) isRunningImageAllowed(ctx context.Context, image private.U
 			reason = fmt.Errorf(`Internal error: Unexpected signature verification result "%s"`, string(res))
 		}
 		rejections = append(rejections, reason)
+		if err := state.signatureEvaluated(ctx, sigIndex, reason); err != nil {
+			return false, nil, err
+		}
 	}
 	var summary error
 	switch len(rejections) {
 	case 0:
-		summary = PolicyRequirementError("A signature was required, but no signature exists")
+		summary = newPolicyRequirementError(PRReasonNoSignatures, "A signature was required, but no signature exists")
 	case 1:
 		summary = rejections[0]
 	default:
@@ -138,8 +288,8 @@ func (pr *prSignedBy) isRunningImageAllowed(ctx context.Context, image private.U
 		for _, e := range rejections {
 			msgs = append(msgs, e.Error())
 		}
-		summary = PolicyRequirementError(fmt.Sprintf("None of the signatures were accepted, reasons: %s",
+		summary = newPolicyRequirementError(commonRejectionReason(rejections), fmt.Sprintf("None of the signatures were accepted, reasons: %s",
 			strings.Join(msgs, "; ")))
 	}
-	return false, summary
+	return false, nil, summary
 }
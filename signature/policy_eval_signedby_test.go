@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/v5/directory"
@@ -24,7 +25,7 @@ func dirImageMock(t *testing.T, dir, dockerReference string) private.UnparsedIma
 }
 
 // dirImageMockWithRef returns a private.UnparsedImage for a directory, claiming a specified ref.
-func dirImageMockWithRef(t *testing.T, dir string, ref types.ImageReference) private.UnparsedImage {
+func dirImageMockWithRef(t testing.TB, dir string, ref types.ImageReference) private.UnparsedImage {
 	srcRef, err := directory.NewReference(dir)
 	require.NoError(t, err)
 	src, err := srcRef.NewImageSource(context.Background(), nil)
@@ -83,6 +84,52 @@ func TestPRSignedByIsSignatureAuthorAccepted(t *testing.T) {
 		})
 	}
 
+	// Successful validation of a signature created using an ed25519 key
+	pr, err := NewPRSignedByKeyPath(ktGPG, "fixtures/public-key-ed25519.gpg", prm)
+	require.NoError(t, err)
+	ed25519Image := dirImageMock(t, "fixtures/dir-img-ed25519-valid", "testing/manifest:latest")
+	ed25519Sig, err := os.ReadFile("fixtures/dir-img-ed25519-valid/signature-1")
+	require.NoError(t, err)
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), ed25519Image, ed25519Sig)
+	assertSARAccepted(t, sar, parsedSig, err, Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+	})
+	// … but not with a different key
+	pr, err = NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", prm)
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), ed25519Image, ed25519Sig)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// Successful validation with KeyDirectory, using a signature by the second key in the directory.
+	pr, err = NewPRSignedByKeyDirectory(ktGPG, "fixtures/keyring-directory", prm)
+	require.NoError(t, err)
+	dualSignedImage := dirImageMock(t, "fixtures/dir-img-dual-signed", "testing/manifest:latest")
+	for _, sigFile := range []string{"signature-1", "signature-2"} {
+		sig, err := os.ReadFile(filepath.Join("fixtures/dir-img-dual-signed", sigFile))
+		require.NoError(t, err)
+		sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), dualSignedImage, sig)
+		assertSARAccepted(t, sar, parsedSig, err, Signature{
+			DockerManifestDigest: TestImageManifestDigest,
+			DockerReference:      "testing/manifest:latest",
+		})
+	}
+
+	// A signature by a key which has expired since is rejected, unless AllowExpiredKeys
+	expiredKeyImage := dirImageMock(t, "fixtures/dir-img-expired-key", "testing/manifest:latest")
+	expiredKeySig, err := os.ReadFile("fixtures/dir-img-expired-key/signature-1")
+	require.NoError(t, err)
+	expiredKeyPR, err := newPRSignedByKeyPath(ktGPG, "fixtures/public-key-expired.gpg", prm)
+	require.NoError(t, err)
+	sar, parsedSig, err = expiredKeyPR.isSignatureAuthorAccepted(context.Background(), expiredKeyImage, expiredKeySig)
+	assertSARRejected(t, sar, parsedSig, err)
+	expiredKeyPR.AllowExpiredKeys = true
+	sar, parsedSig, err = expiredKeyPR.isSignatureAuthorAccepted(context.Background(), expiredKeyImage, expiredKeySig)
+	assertSARAccepted(t, sar, parsedSig, err, Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+	})
+
 	// Unimplemented and invalid KeyType values
 	for _, keyType := range []sbKeyType{SBKeyTypeSignedByGPGKeys,
 		SBKeyTypeX509Certificates,
@@ -128,6 +175,15 @@ func TestPRSignedByIsSignatureAuthorAccepted(t *testing.T) {
 		func() (PolicyRequirement, error) { // One of the KeyPaths is invalid
 			return NewPRSignedByKeyPaths(ktGPG, []string{"fixtures/public-key.gpg", "/this/does/not/exist"}, prm)
 		},
+		func() (PolicyRequirement, error) { // KeyDirectory and KeyPath set. Do not use NewPRSignedBy*, because it would reject this.
+			return &prSignedBy{KeyType: ktGPG, KeyPath: "fixtures/public-key.gpg", KeyDirectory: "fixtures/keyring-directory", SignedIdentity: prm}, nil
+		},
+		func() (PolicyRequirement, error) { // Invalid KeyDirectory
+			return NewPRSignedByKeyDirectory(ktGPG, "/this/does/not/exist", prm)
+		},
+		func() (PolicyRequirement, error) { // KeyDirectory is a file
+			return NewPRSignedByKeyDirectory(ktGPG, "fixtures/public-key.gpg", prm)
+		},
 	} {
 		pr, err := fn()
 		require.NoError(t, err)
@@ -138,11 +194,29 @@ func TestPRSignedByIsSignatureAuthorAccepted(t *testing.T) {
 
 	// Errors initializing the temporary GPG directory and mechanism are not obviously easy to reach.
 
+	// KeyDirectory contains a file which is not a key
+	keyDir := t.TempDir()
+	for name, contents := range map[string][]byte{"1.gpg": keyData, "2.gpg": []byte("this is not a key")} {
+		err := os.WriteFile(filepath.Join(keyDir, name), contents, 0o644)
+		require.NoError(t, err)
+	}
+	pr, err = NewPRSignedByKeyDirectory(ktGPG, keyDir, prm)
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARRejected(t, sar, parsedSig, err)
+	assert.ErrorContains(t, err, filepath.Join(keyDir, "2.gpg"))
+
+	// KeyDirectory is empty
+	pr, err = NewPRSignedByKeyDirectory(ktGPG, t.TempDir(), prm)
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
 	// KeyData has no public keys.
-	pr, err := NewPRSignedByKeyData(ktGPG, []byte{}, prm)
+	pr, err = NewPRSignedByKeyData(ktGPG, []byte{}, prm)
 	require.NoError(t, err)
 	// Pass nil pointers to, kind of, test that the return value does not depend on the parameters.
-	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), nil, nil)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, nil)
 	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
 
 	// A signature which does not GPG verify
@@ -162,6 +236,7 @@ func TestPRSignedByIsSignatureAuthorAccepted(t *testing.T) {
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image parameter..
 	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), nil, sig)
 	assertSARRejected(t, sar, parsedSig, err)
+	assertRejectionReason(t, PRReasonUntrustedKey, err)
 
 	// A valid signature of an invalid JSON.
 	pr, err = NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", prm)
@@ -232,7 +307,7 @@ func TestPRSignedByIsRunningImageAllowed(t *testing.T) {
 	image := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
 	pr, err := NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", prm)
 	require.NoError(t, err)
-	allowed, err := pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err := pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningAllowed(t, allowed, err)
 
 	// Error reading signatures
@@ -240,41 +315,52 @@ func TestPRSignedByIsRunningImageAllowed(t *testing.T) {
 	image = dirImageMock(t, invalidSigDir, "testing/manifest:latest")
 	pr, err = NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", prm)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningRejected(t, allowed, err)
 
 	// No signatures
 	image = dirImageMock(t, "fixtures/dir-img-unsigned", "testing/manifest:latest")
 	pr, err = NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", prm)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	assertRejectionReason(t, PRReasonNoSignatures, err)
 
 	// 1 invalid signature: use dir-img-valid, but a non-matching Docker reference
 	image = dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:notlatest")
 	pr, err = NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", prm)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	assertRejectionReason(t, PRReasonIdentityMismatch, err)
+
+	// 1 signature by a different key
+	image = dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	pr, err = NewPRSignedByKeyPath(ktGPG, "fixtures/public-key-2.gpg", prm)
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	assertRejectionReason(t, PRReasonUntrustedKey, err)
 
 	// 2 valid signatures
 	image = dirImageMock(t, "fixtures/dir-img-valid-2", "testing/manifest:latest")
 	pr, err = NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", prm)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningAllowed(t, allowed, err)
 
 	// One invalid, one valid signature (in this order)
 	image = dirImageMock(t, "fixtures/dir-img-mixed", "testing/manifest:latest")
 	pr, err = NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", prm)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningAllowed(t, allowed, err)
 
 	// 2 invalid signatures: use dir-img-valid-2, but a non-matching Docker reference
 	image = dirImageMock(t, "fixtures/dir-img-valid-2", "testing/manifest:notlatest")
 	pr, err = NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", prm)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	assertRejectionReason(t, PRReasonIdentityMismatch, err)
 }
@@ -7,17 +7,22 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/x509"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/set"
 	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/signature/internal"
 	digest "github.com/opencontainers/go-digest"
 	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 // loadBytesFromDataOrPath ensures there is at most one of ${prefix}Data and ${prefix}Path set,
@@ -39,6 +44,53 @@ func loadBytesFromDataOrPath(prefix string, data []byte, path string) ([]byte, e
 	}
 }
 
+// configBytesSources contains configuration fields which may result in one or more []byte values
+type configBytesSources struct {
+	inconsistencyErrorMessage string   // Error to return if more than one source is set
+	path                      string   // …Path: a path to a file containing the data, or ""
+	paths                     []string // …Paths: paths to files containing the data, or nil
+	data                      []byte   // …Data: a single instance of the raw data, or nil
+	datas                     [][]byte // …Datas: the raw data, or nil
+}
+
+// loadBytesFromConfigSources ensures at most one of the sources in src is set,
+// and returns the referenced data, or nil if neither is set.
+func loadBytesFromConfigSources(src configBytesSources) ([][]byte, error) {
+	sources := 0
+	var data [][]byte // = nil
+	if src.path != "" {
+		sources++
+		d, err := os.ReadFile(src.path)
+		if err != nil {
+			return nil, err
+		}
+		data = [][]byte{d}
+	}
+	if src.paths != nil {
+		sources++
+		data = [][]byte{}
+		for _, path := range src.paths {
+			d, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, d)
+		}
+	}
+	if src.data != nil {
+		sources++
+		data = [][]byte{src.data}
+	}
+	if src.datas != nil {
+		sources++
+		data = src.datas
+	}
+	if sources > 1 {
+		return nil, errors.New(src.inconsistencyErrorMessage)
+	}
+	return data, nil
+}
+
 // prepareTrustRoot creates a fulcioTrustRoot from the input data.
 // (This also prevents external implementations of this interface, ensuring that prSigstoreSignedFulcio is the only one.)
 func (f *prSigstoreSignedFulcio) prepareTrustRoot() (*fulcioTrustRoot, error) {
@@ -66,24 +118,36 @@ func (f *prSigstoreSignedFulcio) prepareTrustRoot() (*fulcioTrustRoot, error) {
 
 // sigstoreSignedTrustRoot contains an already parsed version of the prSigstoreSigned policy
 type sigstoreSignedTrustRoot struct {
-	publicKey      crypto.PublicKey
+	publicKeys     []crypto.PublicKey
 	fulcio         *fulcioTrustRoot
 	rekorPublicKey *ecdsa.PublicKey
+	tsaRoots       *x509.CertPool
 }
 
 func (pr *prSigstoreSigned) prepareTrustRoot() (*sigstoreSignedTrustRoot, error) {
 	res := sigstoreSignedTrustRoot{}
 
-	publicKeyPEM, err := loadBytesFromDataOrPath("key", pr.KeyData, pr.KeyPath)
+	publicKeyPEMs, err := loadBytesFromConfigSources(configBytesSources{
+		inconsistencyErrorMessage: `Internal inconsistency: more than one of "keyPath", "keyPaths", "keyData", "keyDatas" specified`,
+		path:                      pr.KeyPath,
+		paths:                     pr.KeyPaths,
+		data:                      pr.KeyData,
+		datas:                     pr.KeyDatas,
+	})
 	if err != nil {
 		return nil, err
 	}
-	if publicKeyPEM != nil {
-		pk, err := cryptoutils.UnmarshalPEMToPublicKey(publicKeyPEM)
-		if err != nil {
-			return nil, fmt.Errorf("parsing public key: %w", err)
+	if publicKeyPEMs != nil {
+		for index, keyData := range publicKeyPEMs {
+			pk, err := cryptoutils.UnmarshalPEMToPublicKey(keyData)
+			if err != nil {
+				return nil, fmt.Errorf("parsing public key %d: %w", index+1, err)
+			}
+			res.publicKeys = append(res.publicKeys, pk)
+		}
+		if len(res.publicKeys) == 0 {
+			return nil, errors.New(`Internal inconsistency: "keyPath", "keyPaths", "keyData" or "keyDatas" produced no public keys`)
 		}
-		res.publicKey = pk
 	}
 
 	if pr.Fulcio != nil {
@@ -111,6 +175,17 @@ func (pr *prSigstoreSigned) prepareTrustRoot() (*sigstoreSignedTrustRoot, error)
 		res.rekorPublicKey = pkECDSA
 	}
 
+	tsaCertificatePEM, err := loadBytesFromDataOrPath("tsaCertificate", pr.TSACertificateData, pr.TSACertificatePath)
+	if err != nil {
+		return nil, err
+	}
+	if tsaCertificatePEM != nil {
+		res.tsaRoots = x509.NewCertPool()
+		if ok := res.tsaRoots.AppendCertsFromPEM(tsaCertificatePEM); !ok {
+			return nil, errors.New("error loading TSA certificates")
+		}
+	}
+
 	return &res, nil
 }
 
@@ -121,59 +196,102 @@ func (pr *prSigstoreSigned) isSignatureAuthorAccepted(ctx context.Context, image
 }
 
 func (pr *prSigstoreSigned) isSignatureAccepted(ctx context.Context, image private.UnparsedImage, sig signature.Sigstore) (signatureAcceptanceResult, error) {
+	res, _, err := pr.isSignatureAcceptedWithDescription(ctx, image, sig)
+	return res, err
+}
+
+// isSignatureAcceptedWithDescription is isSignatureAccepted, which also returns a description of the signature, if it is accepted.
+func (pr *prSigstoreSigned) isSignatureAcceptedWithDescription(ctx context.Context, image private.UnparsedImage, sig signature.Sigstore) (signatureAcceptanceResult, *AcceptedSignature, error) {
 	// FIXME: move this to per-context initialization
 	trustRoot, err := pr.prepareTrustRoot()
 	if err != nil {
-		return sarRejected, err
+		return sarRejected, nil, err
 	}
+	return pr.isSignatureAcceptedWithTrustRoot(ctx, image, sig, trustRoot)
+}
 
+// isSignatureAcceptedWithTrustRoot is isSignatureAccepted, using an already prepared trustRoot;
+// it also returns a description of the signature, if it is accepted.
+func (pr *prSigstoreSigned) isSignatureAcceptedWithTrustRoot(ctx context.Context, image private.UnparsedImage, sig signature.Sigstore, trustRoot *sigstoreSignedTrustRoot) (signatureAcceptanceResult, *AcceptedSignature, error) {
 	untrustedAnnotations := sig.UntrustedAnnotations()
 	untrustedBase64Signature, ok := untrustedAnnotations[signature.SigstoreSignatureAnnotationKey]
 	if !ok {
-		return sarRejected, fmt.Errorf("missing %s annotation", signature.SigstoreSignatureAnnotationKey)
+		return sarRejected, nil, fmt.Errorf("missing %s annotation", signature.SigstoreSignatureAnnotationKey)
 	}
 	untrustedPayload := sig.UntrustedPayload()
 
-	var publicKey crypto.PublicKey
+	var trustedTimestamp *time.Time // = nil
+	if trustRoot.tsaRoots != nil {
+		untrustedRFC3161Timestamp, ok := untrustedAnnotations[signature.SigstoreRFC3161TimestampAnnotationKey]
+		if !ok {
+			return sarRejected, nil, newPolicyRequirementError(PRReasonTimestampRequired, fmt.Sprintf("missing %s annotation", signature.SigstoreRFC3161TimestampAnnotationKey))
+		}
+		untrustedSignature, err := base64.StdEncoding.DecodeString(untrustedBase64Signature)
+		if err != nil {
+			return sarRejected, nil, internal.NewInvalidSignatureError(fmt.Sprintf("base64 decoding: %v", err))
+		}
+		// The timestamp covers the signature, so it is trustworthy as soon as the signature is verified below.
+		t, err := internal.VerifyRFC3161Timestamp(trustRoot.tsaRoots, []byte(untrustedRFC3161Timestamp), untrustedSignature)
+		if err != nil {
+			return sarRejected, nil, err
+		}
+		trustedTimestamp = &t
+	}
+
+	var publicKeys []crypto.PublicKey
 	switch {
-	case trustRoot.publicKey != nil && trustRoot.fulcio != nil: // newPRSigstoreSigned rejects such combinations.
-		return sarRejected, errors.New("Internal inconsistency: Both a public key and Fulcio CA specified")
-	case trustRoot.publicKey == nil && trustRoot.fulcio == nil: // newPRSigstoreSigned rejects such combinations.
-		return sarRejected, errors.New("Internal inconsistency: Neither a public key nor a Fulcio CA specified")
+	case trustRoot.publicKeys != nil && trustRoot.fulcio != nil: // newPRSigstoreSigned rejects such combinations.
+		return sarRejected, nil, errors.New("Internal inconsistency: Both a public key and Fulcio CA specified")
+	case trustRoot.publicKeys == nil && trustRoot.fulcio == nil: // newPRSigstoreSigned rejects such combinations.
+		return sarRejected, nil, errors.New("Internal inconsistency: Neither a public key nor a Fulcio CA specified")
 
-	case trustRoot.publicKey != nil:
+	case trustRoot.publicKeys != nil:
 		if trustRoot.rekorPublicKey != nil {
 			untrustedSET, ok := untrustedAnnotations[signature.SigstoreSETAnnotationKey]
 			if !ok { // For user convenience; passing an empty []byte to VerifyRekorSet should work.
-				return sarRejected, fmt.Errorf("missing %s annotation", signature.SigstoreSETAnnotationKey)
+				return sarRejected, nil, newPolicyRequirementError(PRReasonRekorRequired, fmt.Sprintf("missing %s annotation", signature.SigstoreSETAnnotationKey))
 			}
-			// We could use publicKeyPEM directly, but let’s re-marshal to avoid inconsistencies.
-			// FIXME: We could just generate DER instead of the full PEM text
-			recreatedPublicKeyPEM, err := cryptoutils.MarshalPublicKeyToPEM(trustRoot.publicKey)
-			if err != nil {
-				// Coverage: The key was loaded from a PEM format, so it’s unclear how this could fail.
-				// (PEM is not essential, MarshalPublicKeyToPEM can only fail if marshaling to ASN1.DER fails.)
-				return sarRejected, fmt.Errorf("re-marshaling public key to PEM: %w", err)
 
+			var rekorFailures []string
+			for _, candidatePublicKey := range trustRoot.publicKeys {
+				// We could use publicKeyPEM directly, but let’s re-marshal to avoid inconsistencies.
+				// FIXME: We could just generate DER instead of the full PEM text
+				recreatedPublicKeyPEM, err := cryptoutils.MarshalPublicKeyToPEM(candidatePublicKey)
+				if err != nil {
+					// Coverage: The key was loaded from a PEM format, so it’s unclear how this could fail.
+					// (PEM is not essential, MarshalPublicKeyToPEM can only fail if marshaling to ASN1.DER fails.)
+					return sarRejected, nil, fmt.Errorf("re-marshaling public key to PEM: %w", err)
+				}
+				// We don’t care about the Rekor timestamp, just about log presence.
+				_, err = internal.VerifyRekorSET(trustRoot.rekorPublicKey, []byte(untrustedSET), recreatedPublicKeyPEM, untrustedBase64Signature, untrustedPayload)
+				if err == nil {
+					publicKeys = append(publicKeys, candidatePublicKey)
+					break // The SET can only accept one public key entry, so if we found one, the rest either doesn’t match or is a duplicate
+				}
+				rekorFailures = append(rekorFailures, err.Error())
 			}
-			// We don’t care about the Rekor timestamp, just about log presence.
-			if _, err := internal.VerifyRekorSET(trustRoot.rekorPublicKey, []byte(untrustedSET), recreatedPublicKeyPEM, untrustedBase64Signature, untrustedPayload); err != nil {
-				return sarRejected, err
+			if len(publicKeys) == 0 {
+				if len(rekorFailures) == 0 {
+					// Coverage: We have ensured that len(trustRoot.publicKeys) != 0, when nothing succeeds, there must be at least one failure.
+					return sarRejected, nil, errors.New(`Internal inconsistency: Rekor SET did not match any key but we have no failures.`)
+				}
+				return sarRejected, nil, internal.NewInvalidSignatureError(fmt.Sprintf("No public key verified against the RekorSET: %s", strings.Join(rekorFailures, ", ")))
 			}
+		} else {
+			publicKeys = trustRoot.publicKeys
 		}
-		publicKey = trustRoot.publicKey
 
 	case trustRoot.fulcio != nil:
 		if trustRoot.rekorPublicKey == nil { // newPRSigstoreSigned rejects such combinations.
-			return sarRejected, errors.New("Internal inconsistency: Fulcio CA specified without a Rekor public key")
+			return sarRejected, nil, errors.New("Internal inconsistency: Fulcio CA specified without a Rekor public key")
 		}
 		untrustedSET, ok := untrustedAnnotations[signature.SigstoreSETAnnotationKey]
 		if !ok { // For user convenience; passing an empty []byte to VerifyRekorSet should correctly reject it anyway.
-			return sarRejected, fmt.Errorf("missing %s annotation", signature.SigstoreSETAnnotationKey)
+			return sarRejected, nil, newPolicyRequirementError(PRReasonRekorRequired, fmt.Sprintf("missing %s annotation", signature.SigstoreSETAnnotationKey))
 		}
 		untrustedCert, ok := untrustedAnnotations[signature.SigstoreCertificateAnnotationKey]
 		if !ok { // For user convenience; passing an empty []byte to VerifyRekorSet should correctly reject it anyway.
-			return sarRejected, fmt.Errorf("missing %s annotation", signature.SigstoreCertificateAnnotationKey)
+			return sarRejected, nil, fmt.Errorf("missing %s annotation", signature.SigstoreCertificateAnnotationKey)
 		}
 		var untrustedIntermediateChainBytes []byte
 		if untrustedIntermediateChain, ok := untrustedAnnotations[signature.SigstoreIntermediateCertificateChainAnnotationKey]; ok {
@@ -182,19 +300,25 @@ func (pr *prSigstoreSigned) isSignatureAccepted(ctx context.Context, image priva
 		pk, err := verifyRekorFulcio(trustRoot.rekorPublicKey, trustRoot.fulcio,
 			[]byte(untrustedSET), []byte(untrustedCert), untrustedIntermediateChainBytes, untrustedBase64Signature, untrustedPayload)
 		if err != nil {
-			return sarRejected, err
+			return sarRejected, nil, err
+		}
+		if trustedTimestamp != nil {
+			// verifyRekorFulcio has verified the certificate at the Rekor integration time; it must have been valid at the timestamp as well.
+			if _, err := trustRoot.fulcio.verifyFulcioCertificateAtTime(*trustedTimestamp, []byte(untrustedCert), untrustedIntermediateChainBytes); err != nil {
+				return sarRejected, nil, err
+			}
 		}
-		publicKey = pk
+		publicKeys = []crypto.PublicKey{pk}
 	}
 
-	if publicKey == nil {
+	if len(publicKeys) == 0 {
 		// Coverage: This should never happen, we have already excluded the possibility in the switch above.
-		return sarRejected, fmt.Errorf("Internal inconsistency: publicKey not set before verifying sigstore payload")
+		return sarRejected, nil, fmt.Errorf("Internal inconsistency: publicKey not set before verifying sigstore payload")
 	}
-	signature, err := internal.VerifySigstorePayload(publicKey, untrustedPayload, untrustedBase64Signature, internal.SigstorePayloadAcceptanceRules{
+	signature, verifyingKey, err := internal.VerifySigstorePayloadWithKey(publicKeys, untrustedPayload, untrustedBase64Signature, internal.SigstorePayloadAcceptanceRules{
 		ValidateSignedDockerReference: func(ref string) error {
 			if !pr.SignedIdentity.matchesDockerReference(image, ref) {
-				return PolicyRequirementError(fmt.Sprintf("Signature for identity %s is not accepted", ref))
+				return newPolicyRequirementError(PRReasonIdentityMismatch, fmt.Sprintf("Signature for identity %s is not accepted", ref))
 			}
 			return nil
 		},
@@ -208,30 +332,123 @@ func (pr *prSigstoreSigned) isSignatureAccepted(ctx context.Context, image priva
 				return err
 			}
 			if !digestMatches {
-				return PolicyRequirementError(fmt.Sprintf("Signature for digest %s does not match", digest))
+				return newPolicyRequirementError(PRReasonDigestMismatch, fmt.Sprintf("Signature for digest %s does not match", digest))
 			}
 			return nil
 		},
 	})
 	if err != nil {
-		return sarRejected, err
+		if internal.IsUntrustedKeyError(err) {
+			err = policyRequirementErrorWithCause(PRReasonUntrustedKey, err)
+		}
+		return sarRejected, nil, err
+	}
+	if signature == nil || verifyingKey == nil { // A paranoid sanity check that VerifySigstorePayloadWithKey has returned consistent values
+		return sarRejected, nil, errors.New("internal error: VerifySigstorePayload succeeded but returned no data") // Coverage: This should never happen.
+	}
+	if len(pr.RequiredAnnotations) != 0 {
+		signedAnnotations := signature.UntrustedAnnotations() // Trustworthy, VerifySigstorePayloadWithKey has succeeded.
+		requiredKeys := maps.Keys(pr.RequiredAnnotations)
+		slices.Sort(requiredKeys) // For deterministic error messages
+		for _, key := range requiredKeys {
+			value, ok := signedAnnotations[key]
+			if !ok {
+				return sarRejected, nil, newPolicyRequirementError(PRReasonAnnotationMismatch, fmt.Sprintf("Signature does not contain the required annotation %q", key))
+			}
+			if value != pr.RequiredAnnotations[key] {
+				return sarRejected, nil, newPolicyRequirementError(PRReasonAnnotationMismatch, fmt.Sprintf("Signature annotation %q has value %q, but %q is required", key, value, pr.RequiredAnnotations[key]))
+			}
+		}
+	}
+	// The timestamp is trustworthy, VerifySigstorePayloadWithKey has succeeded.
+	timestamp := signature.UntrustedTimestamp()
+	if pr.SignedAfter != nil {
+		signingTime := timestamp
+		if trustedTimestamp != nil {
+			// Unlike the timestamp in the payload, this can’t be chosen by a holder of a compromised key.
+			signingTime = trustedTimestamp
+		}
+		if signingTime == nil {
+			return sarRejected, nil, newPolicyRequirementError(PRReasonSignatureTooOld, fmt.Sprintf("Signature does not contain a timestamp, but signatures created after %s are required",
+				pr.SignedAfter.Format(time.RFC3339)))
+		}
+		if !signingTime.After(*pr.SignedAfter) {
+			return sarRejected, nil, newPolicyRequirementError(PRReasonSignatureTooOld, fmt.Sprintf("Signature was created at %s, but signatures created after %s are required",
+				signingTime.Format(time.RFC3339), pr.SignedAfter.Format(time.RFC3339)))
+		}
+	}
+	keyIdentity, err := sigstorePublicKeyIdentity(verifyingKey)
+	if err != nil {
+		return sarRejected, nil, err
+	}
+
+	signer := keyIdentity
+	if trustRoot.fulcio != nil {
+		signer = trustRoot.fulcio.subjectEmail // verifyRekorFulcio has verified the certificate is issued for this subject.
+	}
+
+	creator := ""
+	if creatorID := signature.UntrustedCreatorID(); creatorID != nil {
+		creator = *creatorID
+	}
+	return sarAccepted, &AcceptedSignature{
+		DockerManifestDigest: signature.UntrustedDockerManifestDigest(),
+		DockerReference:      signature.UntrustedDockerReference(),
+		KeyIdentity:          keyIdentity,
+		Signer:               signer,
+		Creator:              creator,
+		Timestamp:            timestamp,
+		TrustedTimestamp:     trustedTimestamp,
+	}, nil
+}
+
+// sigstorePublicKeyIdentity returns a string identifying key, based on the digest of its DER encoding.
+func sigstorePublicKeyIdentity(key crypto.PublicKey) (string, error) {
+	der, err := cryptoutils.MarshalPublicKeyToDER(key)
+	if err != nil {
+		// Coverage: The key was loaded from a PEM format, so it’s unclear how this could fail.
+		return "", fmt.Errorf("re-marshaling public key: %w", err)
+	}
+	return digest.FromBytes(der).String(), nil
+}
+
+func (pr *prSigstoreSigned) evaluateSignature(ctx context.Context, image private.UnparsedImage, sig signature.Signature) (bool, *AcceptedSignature, error) {
+	sigstoreSig, ok := sig.(signature.Sigstore)
+	if !ok || sigstoreSig.UntrustedMIMEType() != signature.SigstoreSignatureMIMEType {
+		return false, nil, nil
 	}
-	if signature == nil { // A paranoid sanity check that VerifySigstorePayload has returned consistent values
-		return sarRejected, errors.New("internal error: VerifySigstorePayload succeeded but returned no data") // Coverage: This should never happen.
+	switch res, accepted, err := pr.isSignatureAcceptedWithDescription(ctx, image, sigstoreSig); res {
+	case sarAccepted:
+		if err != nil || accepted == nil { // Coverage: This should never happen.
+			return true, nil, errors.New("Internal error: signature accepted without a description, or with an error")
+		}
+		return true, accepted, nil
+	case sarRejected:
+		return true, nil, err
+	default:
+		return true, nil, fmt.Errorf(`Internal error: Unexpected signature verification result "%s"`, string(res))
 	}
+}
+
+func (pr *prSigstoreSigned) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage, state *requirementEvaluationState) (bool, error) {
+	res, _, err := pr.isRunningImageAllowedWithSignatures(ctx, image, state)
+	return res, err
+}
 
-	return sarAccepted, nil
+func (pr *prSigstoreSigned) isCacheable() bool {
+	return true // All verification, including of Rekor data, is done offline.
 }
 
-func (pr *prSigstoreSigned) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
+func (pr *prSigstoreSigned) isRunningImageAllowedWithSignatures(ctx context.Context, image private.UnparsedImage, state *requirementEvaluationState) (bool, []AcceptedSignature, error) {
 	sigs, err := image.UntrustedSignatures(ctx)
 	if err != nil {
-		return false, err
+		return false, nil, err
 	}
-	var rejections []error
+	var sigstoreSigs []signature.Sigstore
+	var sigstoreSigIndexes []int // Indexes of sigstoreSigs elements in sigs
 	foundNonSigstoreSignatures := 0
 	foundSigstoreNonAttachments := 0
-	for _, s := range sigs {
+	for sigIndex, s := range sigs {
 		sigstoreSig, ok := s.(signature.Sigstore)
 		if !ok {
 			foundNonSigstoreSignatures++
@@ -241,12 +458,23 @@ func (pr *prSigstoreSigned) isRunningImageAllowed(ctx context.Context, image pri
 			foundSigstoreNonAttachments++
 			continue
 		}
+		sigstoreSigs = append(sigstoreSigs, sigstoreSig)
+		sigstoreSigIndexes = append(sigstoreSigIndexes, sigIndex)
+	}
+	if len(sigstoreSigs) != 0 && pr.MinimumSignatures > 1 {
+		return pr.isRunningImageAllowedByDistinctKeys(ctx, image, state, sigstoreSigs, sigstoreSigIndexes)
+	}
 
+	var rejections []error
+	for i, sigstoreSig := range sigstoreSigs {
 		var reason error
-		switch res, err := pr.isSignatureAccepted(ctx, image, sigstoreSig); res {
+		switch res, accepted, err := pr.isSignatureAcceptedWithDescription(ctx, image, sigstoreSig); res {
 		case sarAccepted:
 			// One accepted signature is enough.
-			return true, nil
+			// The evaluation is complete, so cancellation of ctx no longer matters.
+			_ = state.signatureEvaluated(ctx, sigstoreSigIndexes[i], nil)
+			accepted.SignatureIndex = sigstoreSigIndexes[i]
+			return true, []AcceptedSignature{*accepted}, nil
 		case sarRejected:
 			reason = err
 		case sarUnknown:
@@ -256,15 +484,18 @@ func (pr *prSigstoreSigned) isRunningImageAllowed(ctx context.Context, image pri
 			reason = fmt.Errorf(`Internal error: Unexpected signature verification result "%s"`, string(res))
 		}
 		rejections = append(rejections, reason)
+		if err := state.signatureEvaluated(ctx, sigstoreSigIndexes[i], reason); err != nil {
+			return false, nil, err
+		}
 	}
 	var summary error
 	switch len(rejections) {
 	case 0:
 		if foundNonSigstoreSignatures == 0 && foundSigstoreNonAttachments == 0 {
 			// A nice message for the most common case.
-			summary = PolicyRequirementError("A signature was required, but no signature exists")
+			summary = newPolicyRequirementError(PRReasonNoSignatures, "A signature was required, but no signature exists")
 		} else {
-			summary = PolicyRequirementError(fmt.Sprintf("A signature was required, but no signature exists (%d non-sigstore signatures, %d sigstore non-signature attachments)",
+			summary = newPolicyRequirementError(PRReasonNoSignatures, fmt.Sprintf("A signature was required, but no signature exists (%d non-sigstore signatures, %d sigstore non-signature attachments)",
 				foundNonSigstoreSignatures, foundSigstoreNonAttachments))
 		}
 	case 1:
@@ -274,8 +505,72 @@ func (pr *prSigstoreSigned) isRunningImageAllowed(ctx context.Context, image pri
 		for _, e := range rejections {
 			msgs = append(msgs, e.Error())
 		}
-		summary = PolicyRequirementError(fmt.Sprintf("None of the signatures were accepted, reasons: %s",
+		summary = newPolicyRequirementError(commonRejectionReason(rejections), fmt.Sprintf("None of the signatures were accepted, reasons: %s",
 			strings.Join(msgs, "; ")))
 	}
-	return false, summary
+	return false, nil, summary
+}
+
+// isRunningImageAllowedByDistinctKeys implements isRunningImageAllowed for pr.MinimumSignatures > 1,
+// requiring accepted signatures in sigs by at least pr.MinimumSignatures distinct keys.
+// sigIndexes are the indexes of sigs elements in all signatures of the image.
+func (pr *prSigstoreSigned) isRunningImageAllowedByDistinctKeys(ctx context.Context, image private.UnparsedImage, state *requirementEvaluationState, sigs []signature.Sigstore, sigIndexes []int) (bool, []AcceptedSignature, error) {
+	// FIXME: move this to per-context initialization
+	trustRoot, err := pr.prepareTrustRoot()
+	if err != nil {
+		return false, nil, err
+	}
+	if trustRoot.fulcio != nil { // newPRSigstoreSigned rejects such combinations.
+		return false, nil, errors.New("Internal inconsistency: minimumSignatures specified with Fulcio")
+	}
+
+	// The same key may be listed more than once (e.g. in different formats); count each key only once.
+	var keys []crypto.PublicKey
+	seenKeys := set.New[string]()
+	for _, key := range trustRoot.publicKeys {
+		keyIdentity, err := sigstorePublicKeyIdentity(key)
+		if err != nil {
+			return false, nil, err
+		}
+		if !seenKeys.Contains(keyIdentity) {
+			seenKeys.Add(keyIdentity)
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) < pr.MinimumSignatures {
+		return false, nil, fmt.Errorf("minimumSignatures (%d) is larger than the number of distinct keys (%d)", pr.MinimumSignatures, len(keys))
+	}
+
+	var accepted []AcceptedSignature
+	var rejections []string
+	for _, key := range keys {
+		keyTrustRoot := *trustRoot // A shallow copy
+		keyTrustRoot.publicKeys = []crypto.PublicKey{key}
+		for i, sig := range sigs {
+			res, acceptedSig, err := pr.isSignatureAcceptedWithTrustRoot(ctx, image, sig, &keyTrustRoot)
+			if res == sarAccepted && err == nil {
+				acceptedSig.SignatureIndex = sigIndexes[i]
+				accepted = append(accepted, *acceptedSig)
+				// If the evaluation is complete, cancellation of ctx no longer matters.
+				if err := state.signatureEvaluated(ctx, sigIndexes[i], nil); err != nil && len(accepted) < pr.MinimumSignatures {
+					return false, nil, err
+				}
+				break
+			}
+			if err != nil && !slices.Contains(rejections, err.Error()) {
+				rejections = append(rejections, err.Error())
+			}
+			if err := state.signatureEvaluated(ctx, sigIndexes[i], err); err != nil {
+				return false, nil, err
+			}
+		}
+		if len(accepted) >= pr.MinimumSignatures {
+			return true, accepted, nil
+		}
+	}
+	msg := fmt.Sprintf("Accepted signatures by %d distinct keys were found, but %d are required", len(accepted), pr.MinimumSignatures)
+	if len(rejections) != 0 {
+		msg += fmt.Sprintf(", reasons: %s", strings.Join(rejections, "; "))
+	}
+	return false, nil, newPolicyRequirementError(PRReasonInsufficientSignatures, msg)
 }
@@ -0,0 +1,140 @@
+// Policy evaluation for prSigstoreAttestation.
+
+package signature
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature/internal"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+)
+
+// preparePublicKey loads the trusted public key of pr.
+func (pr *prSigstoreAttestation) preparePublicKey() (crypto.PublicKey, error) {
+	publicKeyPEM, err := loadBytesFromDataOrPath("key", pr.KeyData, pr.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if publicKeyPEM == nil {
+		return nil, errors.New(`Internal inconsistency: neither "keyPath" nor "keyData" specified`)
+	}
+	pk, err := cryptoutils.UnmarshalPEMToPublicKey(publicKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+	return pk, nil
+}
+
+func (pr *prSigstoreAttestation) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	// Attestations are not signatures of the image; there is nothing to return.
+	return sarRejected, nil, errors.New("isSignatureAuthorAccepted is not implemented for sigstore attestations")
+}
+
+// isAttestationAccepted decides whether attestation is a signed attestation of image with pr.PredicateType.
+func (pr *prSigstoreAttestation) isAttestationAccepted(ctx context.Context, image private.UnparsedImage, attestation signature.Sigstore, publicKey crypto.PublicKey) (signatureAcceptanceResult, error) {
+	_, _, err := internal.VerifyDSSEAttestation([]crypto.PublicKey{publicKey}, attestation.UntrustedPayload(), internal.SigstoreAttestationAcceptanceRules{
+		ValidatePredicateType: func(predicateType string) error {
+			if predicateType != pr.PredicateType {
+				return newPolicyRequirementError(PRReasonPredicateTypeMismatch, fmt.Sprintf("Attestation predicate type %s is not accepted", predicateType))
+			}
+			return nil
+		},
+		ValidateSubjects: func(subjects []internal.UntrustedInTotoSubject) error {
+			m, _, err := image.Manifest(ctx)
+			if err != nil {
+				return err
+			}
+			for _, subject := range subjects {
+				d := internal.InTotoSubjectDigest(subject)
+				if d == "" {
+					continue
+				}
+				digestMatches, err := manifest.MatchesDigest(m, d)
+				if err != nil {
+					return err
+				}
+				if !digestMatches {
+					continue
+				}
+				if pr.SignedIdentity != nil && !pr.SignedIdentity.matchesDockerReference(image, subject.Name) {
+					return newPolicyRequirementError(PRReasonIdentityMismatch, fmt.Sprintf("Attestation for identity %s is not accepted", subject.Name))
+				}
+				return nil
+			}
+			return newPolicyRequirementError(PRReasonDigestMismatch, "Attestation subject does not match the image manifest digest")
+		},
+	})
+	if err != nil {
+		if internal.IsUntrustedKeyError(err) {
+			err = policyRequirementErrorWithCause(PRReasonUntrustedKey, err)
+		}
+		return sarRejected, err
+	}
+	return sarAccepted, nil
+}
+
+func (pr *prSigstoreAttestation) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage, state *requirementEvaluationState) (bool, error) {
+	attestations, err := image.UntrustedSigstoreAttestations(ctx)
+	if err != nil {
+		return false, err
+	}
+	// FIXME: move this to per-context initialization
+	publicKey, err := pr.preparePublicKey()
+	if err != nil {
+		return false, err
+	}
+
+	foundNonDSSEAttestations := 0
+	var rejections []error
+	for _, attestation := range attestations {
+		if attestation.UntrustedMIMEType() != signature.SigstoreAttestationMIMEType {
+			foundNonDSSEAttestations++
+			continue
+		}
+		var reason error
+		switch res, err := pr.isAttestationAccepted(ctx, image, attestation, publicKey); res {
+		case sarAccepted:
+			// One accepted attestation is enough.
+			return true, nil
+		case sarRejected:
+			reason = err
+		case sarUnknown:
+			// Huh?! This should not happen at all; treat it as any other invalid value.
+			fallthrough
+		default:
+			reason = fmt.Errorf(`Internal error: Unexpected signature verification result "%s"`, string(res))
+		}
+		rejections = append(rejections, reason)
+	}
+	var summary error
+	switch len(rejections) {
+	case 0:
+		if foundNonDSSEAttestations == 0 {
+			// A nice message for the most common case.
+			summary = newPolicyRequirementError(PRReasonNoAttestations, "An attestation was required, but no attestation exists")
+		} else {
+			summary = newPolicyRequirementError(PRReasonNoAttestations, fmt.Sprintf("An attestation was required, but no attestation exists (%d non-DSSE attestations)", foundNonDSSEAttestations))
+		}
+	case 1:
+		summary = rejections[0]
+	default:
+		var msgs []string
+		for _, e := range rejections {
+			msgs = append(msgs, e.Error())
+		}
+		summary = newPolicyRequirementError(commonRejectionReason(rejections), fmt.Sprintf("None of the attestations were accepted, reasons: %s",
+			strings.Join(msgs, "; ")))
+	}
+	return false, summary
+}
+
+func (pr *prSigstoreAttestation) isCacheable() bool {
+	return true
+}
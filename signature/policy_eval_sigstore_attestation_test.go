@@ -0,0 +1,239 @@
+// Policy evaluation for prSigstoreAttestation.
+
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
+	"github.com/stretchr/testify/require"
+)
+
+const testAttestationPredicateType = "https://slsa.dev/provenance/v1"
+
+// dirImageSourceWithAttestationsMock is a dirImageSourceMock which returns a fixed set of sigstore attestations.
+type dirImageSourceWithAttestationsMock struct {
+	dirImageSourceMock
+	attestations []signature.Sigstore
+}
+
+func (d *dirImageSourceWithAttestationsMock) GetSigstoreAttestations(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Sigstore, error) {
+	return d.attestations, nil
+}
+
+// attestationImageMock returns a private.UnparsedImage for fixtures/dir-img-cosign-valid, claiming dockerReference,
+// with the specified attestations.
+func attestationImageMock(t *testing.T, dockerReference string, attestations []signature.Sigstore) private.UnparsedImage {
+	ref, err := reference.ParseNormalizedNamed(dockerReference)
+	require.NoError(t, err)
+	srcRef, err := directory.NewReference("fixtures/dir-img-cosign-valid")
+	require.NoError(t, err)
+	src, err := srcRef.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		err := src.Close()
+		require.NoError(t, err)
+	})
+	return image.UnparsedInstance(&dirImageSourceWithAttestationsMock{
+		dirImageSourceMock: dirImageSourceMock{
+			ImageSource: imagesource.FromPublic(src),
+			ref:         refImageReferenceMock{ref: ref},
+		},
+		attestations: attestations,
+	}, nil)
+}
+
+// attestationSigner creates DSSE-enveloped in-toto statements signed by a newly generated key.
+type attestationSigner struct {
+	signer       sigstoreSignature.SignerVerifier
+	publicKeyPEM []byte
+}
+
+func newAttestationSigner(t *testing.T) *attestationSigner {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := sigstoreSignature.LoadECDSASignerVerifier(privateKey, crypto.SHA256)
+	require.NoError(t, err)
+	publicKeyPEM, err := cryptoutils.MarshalPublicKeyToPEM(privateKey.Public())
+	require.NoError(t, err)
+	return &attestationSigner{signer: signer, publicKeyPEM: publicKeyPEM}
+}
+
+// envelope returns a DSSE envelope of statement with payloadType.
+func (s *attestationSigner) envelope(t *testing.T, payloadType string, statement any) []byte {
+	payload, err := json.Marshal(statement)
+	require.NoError(t, err)
+	pae := fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload)
+	sig, err := s.signer.SignMessage(bytes.NewReader([]byte(pae)))
+	require.NoError(t, err)
+	envelope, err := json.Marshal(mSA{
+		"payloadType": payloadType,
+		"payload":     base64.StdEncoding.EncodeToString(payload),
+		"signatures":  []mSA{{"keyid": "", "sig": base64.StdEncoding.EncodeToString(sig)}},
+	})
+	require.NoError(t, err)
+	return envelope
+}
+
+// attestation returns a sigstore attestation of statement.
+func (s *attestationSigner) attestation(t *testing.T, statement any) signature.Sigstore {
+	return signature.SigstoreFromComponents(signature.SigstoreAttestationMIMEType,
+		s.envelope(t, "application/vnd.in-toto+json", statement), nil)
+}
+
+// inTotoStatement returns an in-toto statement about name@manifestDigest with predicateType.
+func inTotoStatement(name string, manifestDigest digest.Digest, predicateType string) mSA {
+	return mSA{
+		"_type": "https://in-toto.io/Statement/v1",
+		"subject": []mSA{{
+			"name":   name,
+			"digest": mSA{manifestDigest.Algorithm().String(): manifestDigest.Encoded()},
+		}},
+		"predicateType": predicateType,
+		"predicate":     mSA{"buildDefinition": mSA{}},
+	}
+}
+
+func TestPRSigstoreAttestationIsSignatureAuthorAccepted(t *testing.T) {
+	// Currently, this fails even with a correctly signed image.
+	signer := newAttestationSigner(t)
+	prm := NewPRMMatchRepository()
+	pr, err := NewPRSigstoreAttestation(
+		PRSigstoreAttestationWithKeyData(signer.publicKeyPEM),
+		PRSigstoreAttestationWithPredicateType(testAttestationPredicateType),
+		PRSigstoreAttestationWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	img := attestationImageMock(t, "192.168.64.2:5000/cosign-signed-single-sample:latest", nil)
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), img, nil)
+	assertSARRejected(t, sar, parsedSig, err)
+}
+
+func TestPRSigstoreAttestationIsRunningImageAllowed(t *testing.T) {
+	const imageName = "192.168.64.2:5000/cosign-signed-single-sample"
+	const imageRef = imageName + ":latest"
+	manifestDigest := digest.Digest("sha256:634a8f35b5f16dcf4aaa0822adc0b1964bb786fca12f6831de8ddc45e5986a00")
+	signer := newAttestationSigner(t)
+	otherSigner := newAttestationSigner(t)
+	validAttestation := signer.attestation(t, inTotoStatement(imageName, manifestDigest, testAttestationPredicateType))
+	newPR := func(options ...PRSigstoreAttestationOption) PolicyRequirement {
+		options = append([]PRSigstoreAttestationOption{
+			PRSigstoreAttestationWithKeyData(signer.publicKeyPEM),
+			PRSigstoreAttestationWithPredicateType(testAttestationPredicateType),
+		}, options...)
+		pr, err := NewPRSigstoreAttestation(options...)
+		require.NoError(t, err)
+		return pr
+	}
+
+	// A correctly signed attestation
+	for _, pr := range []PolicyRequirement{
+		newPR(),
+		newPR(PRSigstoreAttestationWithSignedIdentity(NewPRMMatchRepository())),
+	} {
+		img := attestationImageMock(t, imageRef, []signature.Sigstore{validAttestation})
+		allowed, err := pr.isRunningImageAllowed(context.Background(), img, nil)
+		assertRunningAllowed(t, allowed, err)
+	}
+
+	// One of several attestations is valid
+	img := attestationImageMock(t, imageRef, []signature.Sigstore{
+		signature.SigstoreFromComponents("application/vnd.example.other", []byte("other"), nil),
+		otherSigner.attestation(t, inTotoStatement(imageName, manifestDigest, testAttestationPredicateType)),
+		validAttestation,
+	})
+	allowed, err := newPR().isRunningImageAllowed(context.Background(), img, nil)
+	assertRunningAllowed(t, allowed, err)
+
+	// No attestations
+	for _, attestations := range [][]signature.Sigstore{
+		nil,
+		{signature.SigstoreFromComponents("application/vnd.example.other", []byte("other"), nil)},
+	} {
+		img := attestationImageMock(t, imageRef, attestations)
+		allowed, err := newPR().isRunningImageAllowed(context.Background(), img, nil)
+		assertRunningRejectedPolicyRequirement(t, allowed, err)
+	}
+
+	// A source which does not support attestations
+	img = dirImageMock(t, "fixtures/dir-img-cosign-valid", imageRef)
+	allowed, err = newPR().isRunningImageAllowed(context.Background(), img, nil)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+
+	// Rejected attestations
+	for _, c := range []struct {
+		attestation signature.Sigstore
+		pr          PolicyRequirement
+	}{
+		{ // Wrong predicate type
+			attestation: signer.attestation(t, inTotoStatement(imageName, manifestDigest, "https://example.com/other")),
+		},
+		{ // Wrong digest
+			attestation: signer.attestation(t, inTotoStatement(imageName, digest.FromString("other"), testAttestationPredicateType)),
+		},
+		{ // Wrong key
+			attestation: otherSigner.attestation(t, inTotoStatement(imageName, manifestDigest, testAttestationPredicateType)),
+		},
+		{ // Wrong statement type
+			attestation: signer.attestation(t, mSA{
+				"_type":         "https://example.com/Statement",
+				"subject":       inTotoStatement(imageName, manifestDigest, testAttestationPredicateType)["subject"],
+				"predicateType": testAttestationPredicateType,
+			}),
+		},
+		{ // Wrong payload type
+			attestation: signature.SigstoreFromComponents(signature.SigstoreAttestationMIMEType,
+				signer.envelope(t, "application/vnd.example.other", inTotoStatement(imageName, manifestDigest, testAttestationPredicateType)), nil),
+		},
+		{ // Invalid envelope
+			attestation: signature.SigstoreFromComponents(signature.SigstoreAttestationMIMEType, []byte("this is invalid"), nil),
+		},
+		{ // Identity mismatch
+			attestation: signer.attestation(t, inTotoStatement("example.com/other/image", manifestDigest, testAttestationPredicateType)),
+			pr:          newPR(PRSigstoreAttestationWithSignedIdentity(NewPRMMatchRepository())),
+		},
+	} {
+		pr := c.pr
+		if pr == nil {
+			pr = newPR()
+		}
+		img := attestationImageMock(t, imageRef, []signature.Sigstore{c.attestation})
+		allowed, err := pr.isRunningImageAllowed(context.Background(), img, nil)
+		assertRunningRejected(t, allowed, err)
+	}
+
+	// Multiple rejected attestations
+	img = attestationImageMock(t, imageRef, []signature.Sigstore{
+		otherSigner.attestation(t, inTotoStatement(imageName, manifestDigest, testAttestationPredicateType)),
+		signer.attestation(t, inTotoStatement(imageName, manifestDigest, "https://example.com/other")),
+	})
+	allowed, err = newPR().isRunningImageAllowed(context.Background(), img, nil)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+
+	// Invalid key
+	pr, err := NewPRSigstoreAttestation(
+		PRSigstoreAttestationWithKeyData([]byte("this is not a key")),
+		PRSigstoreAttestationWithPredicateType(testAttestationPredicateType),
+	)
+	require.NoError(t, err)
+	img = attestationImageMock(t, imageRef, []signature.Sigstore{validAttestation})
+	allowed, err = pr.isRunningImageAllowed(context.Background(), img, nil)
+	assertRunningRejected(t, allowed, err)
+}
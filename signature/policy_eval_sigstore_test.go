@@ -4,14 +4,27 @@ package signature
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/signature/sigstore"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/go-tuf/encrypted"
 )
 
 func TestPRSigstoreSignedFulcioPrepareTrustRoot(t *testing.T) {
@@ -88,6 +101,9 @@ func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
 	const testKeyPath = "fixtures/cosign.pub"
 	testKeyData, err := os.ReadFile(testKeyPath)
 	require.NoError(t, err)
+	const testKeyPath2 = "fixtures/cosign2.pub"
+	testKeyData2, err := os.ReadFile(testKeyPath2)
+	require.NoError(t, err)
 	testFulcio, err := NewPRSigstoreSignedFulcio(
 		PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
 		PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"),
@@ -101,21 +117,20 @@ func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
 	testIdentityOption := PRSigstoreSignedWithSignedIdentity(testIdentity)
 
 	// Success with public key
-	for _, c := range [][]PRSigstoreSignedOption{
-		{
-			PRSigstoreSignedWithKeyPath(testKeyPath),
-			testIdentityOption,
-		},
-		{
-			PRSigstoreSignedWithKeyData(testKeyData),
-			testIdentityOption,
-		},
+	for _, c := range []struct {
+		options      []PRSigstoreSignedOption
+		expectedKeys int
+	}{
+		{[]PRSigstoreSignedOption{PRSigstoreSignedWithKeyPath(testKeyPath), testIdentityOption}, 1},
+		{[]PRSigstoreSignedOption{PRSigstoreSignedWithKeyPaths([]string{testKeyPath, testKeyPath2}), testIdentityOption}, 2},
+		{[]PRSigstoreSignedOption{PRSigstoreSignedWithKeyData(testKeyData), testIdentityOption}, 1},
+		{[]PRSigstoreSignedOption{PRSigstoreSignedWithKeyDatas([][]byte{testKeyData, testKeyData2}), testIdentityOption}, 2},
 	} {
-		pr, err := newPRSigstoreSigned(c...)
+		pr, err := newPRSigstoreSigned(c.options...)
 		require.NoError(t, err)
 		res, err := pr.prepareTrustRoot()
 		require.NoError(t, err)
-		assert.NotNil(t, res.publicKey)
+		assert.Len(t, res.publicKeys, c.expectedKeys)
 		assert.Nil(t, res.fulcio)
 		assert.Nil(t, res.rekorPublicKey)
 	}
@@ -128,7 +143,7 @@ func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
 	require.NoError(t, err)
 	res, err := pr.prepareTrustRoot()
 	require.NoError(t, err)
-	assert.Nil(t, res.publicKey)
+	assert.Nil(t, res.publicKeys)
 	assert.NotNil(t, res.fulcio)
 	assert.NotNil(t, res.rekorPublicKey)
 	// Success with Rekor public key
@@ -148,7 +163,7 @@ func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
 		require.NoError(t, err)
 		res, err := pr.prepareTrustRoot()
 		require.NoError(t, err)
-		assert.NotNil(t, res.publicKey)
+		assert.Len(t, res.publicKeys, 1)
 		assert.Nil(t, res.fulcio)
 		assert.NotNil(t, res.rekorPublicKey)
 	}
@@ -160,10 +175,32 @@ func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
 			KeyData:        testKeyData,
 			SignedIdentity: testIdentity,
 		},
+		{ // Both KeyPath and KeyPaths specified
+			KeyPath:        testKeyPath,
+			KeyPaths:       []string{testKeyPath2},
+			SignedIdentity: testIdentity,
+		},
+		{ // Both KeyData and KeyDatas specified
+			KeyData:        testKeyData,
+			KeyDatas:       [][]byte{testKeyData2},
+			SignedIdentity: testIdentity,
+		},
 		{ // Invalid public key path
 			KeyPath:        "fixtures/image.signature",
 			SignedIdentity: testIdentity,
 		},
+		{ // Invalid public key path in KeyPaths
+			KeyPaths:       []string{testKeyPath, "fixtures/image.signature"},
+			SignedIdentity: testIdentity,
+		},
+		{ // Unusable public key path in KeyPaths
+			KeyPaths:       []string{testKeyPath, "fixtures/this/does/not/exist"},
+			SignedIdentity: testIdentity,
+		},
+		{ // Invalid public key data in KeyDatas
+			KeyDatas:       [][]byte{testKeyData, []byte("this is invalid")},
+			SignedIdentity: testIdentity,
+		},
 		{ // Unusable public key path
 			KeyPath:        "fixtures/this/does/not/exist",
 			SignedIdentity: testIdentity,
@@ -346,6 +383,40 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
 	sar, err = pr2.isSignatureAccepted(context.Background(), nil, testKeyRekorImageSig)
 	assertRejected(sar, err)
+	// key+Rekor with multiple keys: the SET matches the second key
+	pr2, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign.pub", "fixtures/cosign2.pub"}),
+		PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	sar, err = pr2.isSignatureAccepted(context.Background(), testKeyRekorImage, testKeyRekorImageSig)
+	assertAccepted(sar, err)
+	// key+Rekor with multiple keys: the SET matches none of the keys
+	pr2, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign.pub", "fixtures/cosign.pub"}),
+		PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
+	sar, err = pr2.isSignatureAccepted(context.Background(), nil, testKeyRekorImageSig)
+	assertRejected(sar, err)
+	// key without a Rekor requirement: the SET annotation is ignored, whether it is present, missing, or invalid.
+	pr2, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign2.pub"),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	sar, err = pr2.isSignatureAccepted(context.Background(), testKeyRekorImage, testKeyRekorImageSig)
+	assertAccepted(sar, err)
+	sar, err = pr2.isSignatureAccepted(context.Background(), testKeyRekorImage,
+		sigstoreSignatureWithoutAnnotation(t, testKeyRekorImageSig, signature.SigstoreSETAnnotationKey))
+	assertAccepted(sar, err)
+	sar, err = pr2.isSignatureAccepted(context.Background(), testKeyRekorImage,
+		sigstoreSignatureWithModifiedAnnotation(testKeyRekorImageSig, signature.SigstoreSETAnnotationKey,
+			"this is not a valid SET"))
+	assertAccepted(sar, err)
 
 	// Successful Fulcio certificate use
 	fulcio, err = NewPRSigstoreSignedFulcio(
@@ -463,6 +534,35 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 	sar, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
 	assertAccepted(sar, err)
 
+	// Successful validation, with KeyPaths and KeyDatas, where the signature matches a non-first key
+	keyData2, err := os.ReadFile("fixtures/cosign2.pub")
+	require.NoError(t, err)
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign2.pub", "fixtures/cosign.pub"}),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	sar, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
+	assertAccepted(sar, err)
+
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyDatas([][]byte{keyData2, keyData}),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	sar, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
+	assertAccepted(sar, err)
+
+	// A valid signature using a key which is not in KeyDatas
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyDatas([][]byte{keyData2, keyData2}),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
+	sar, err = pr.isSignatureAccepted(context.Background(), nil, testKeyImageSig)
+	assertRejected(sar, err)
+
 	// A signature which does not verify
 	pr, err = newPRSigstoreSigned(
 		PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
@@ -554,6 +654,378 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 	require.NoError(t, err)
 	sar, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
 	assertRejected(sar, err)
+
+	// requiredAnnotations:
+	annotatedImage := dirImageMock(t, "fixtures/dir-img-cosign-annotated", "192.168.64.2:5000/cosign-signed-single-sample")
+	annotatedImageSig := sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-annotated/signature-1")
+	for _, c := range []struct {
+		requiredAnnotations map[string]string
+		accepted            bool
+	}{
+		{nil, true},                              // No requirements
+		{map[string]string{}, true},              // An empty map behaves the same
+		{map[string]string{"env": "prod"}, true}, // A matching annotation
+		{map[string]string{"env": "prod", "team": "platform"}, true}, // All annotations matching
+		{map[string]string{"env": "staging"}, false},                 // A different value
+		{map[string]string{"env": "prod", "team": "other"}, false},   // One of the values differs
+		{map[string]string{"env": "prod", "region": "eu"}, false},    // A missing annotation
+		{map[string]string{"creator": ""}, false},                    // Fields which are not annotations are not accepted
+	} {
+		pr, err = newPRSigstoreSigned(
+			PRSigstoreSignedWithKeyPath("fixtures/cosign-annotated.pub"),
+			PRSigstoreSignedWithSignedIdentity(prm),
+			PRSigstoreSignedWithRequiredAnnotations(c.requiredAnnotations),
+		)
+		require.NoError(t, err)
+		sar, err = pr.isSignatureAccepted(context.Background(), annotatedImage, annotatedImageSig)
+		if c.accepted {
+			assertAccepted(sar, err)
+		} else {
+			assertRejected(sar, err)
+			assert.IsType(t, PolicyRequirementError{}, err)
+		}
+	}
+	// - A signature without annotations is rejected if any are required
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+		PRSigstoreSignedWithSignedIdentity(prm),
+		PRSigstoreSignedWithRequiredAnnotations(map[string]string{"env": "prod"}),
+	)
+	require.NoError(t, err)
+	sar, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
+	assertRejected(sar, err)
+	// - Annotations don’t matter if the signature is not cryptographically valid
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+		PRSigstoreSignedWithSignedIdentity(prm),
+		PRSigstoreSignedWithRequiredAnnotations(map[string]string{"env": "prod"}),
+	)
+	require.NoError(t, err)
+	sar, err = pr.isSignatureAccepted(context.Background(), annotatedImage, annotatedImageSig)
+	assertRejected(sar, err)
+}
+
+func TestPRSigstoreSignedIsSignatureAcceptedWithCreatedSignatures(t *testing.T) {
+	manifestDigest, err := digest.Parse("sha256:634a8f35b5f16dcf4aaa0822adc0b1964bb786fca12f6831de8ddc45e5986a00")
+	require.NoError(t, err)
+	testImage := dirImageMock(t, "fixtures/dir-img-cosign-valid", "192.168.64.2:5000/cosign-signed-single-sample")
+	dockerReference, err := reference.ParseNormalizedNamed("192.168.64.2:5000/cosign-signed-single-sample:latest")
+	require.NoError(t, err)
+
+	// ed25519 keys are not created by sigstore.GenerateKeyPair, so build one as cosign would.
+	ed25519PublicKey, ed25519PrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ed25519PKCS8, err := x509.MarshalPKCS8PrivateKey(ed25519PrivateKey)
+	require.NoError(t, err)
+	ed25519Passphrase := []byte("ed25519 passphrase")
+	ed25519Encrypted, err := encrypted.Encrypt(ed25519PKCS8, ed25519Passphrase)
+	require.NoError(t, err)
+	ed25519PublicKeyPEM, err := cryptoutils.MarshalPublicKeyToPEM(ed25519PublicKey)
+	require.NoError(t, err)
+	ed25519KeyPair := &sigstore.GenerateKeyPairResult{
+		PublicKey:  ed25519PublicKeyPEM,
+		PrivateKey: pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED COSIGN PRIVATE KEY", Bytes: ed25519Encrypted}),
+	}
+
+	for _, c := range []struct {
+		name       string
+		keyPair    func(passphrase []byte) (*sigstore.GenerateKeyPairResult, error)
+		passphrase []byte
+	}{
+		{"ECDSA, passphrase", sigstore.GenerateKeyPair, []byte("some passphrase")},
+		{"ECDSA, empty passphrase", sigstore.GenerateKeyPair, []byte{}},
+		{"ECDSA, nil passphrase", sigstore.GenerateKeyPair, nil},
+		{"ed25519", func([]byte) (*sigstore.GenerateKeyPairResult, error) { return ed25519KeyPair, nil }, ed25519Passphrase},
+	} {
+		keyPair, err := c.keyPair(c.passphrase)
+		require.NoError(t, err, c.name)
+		privateKeyFile := filepath.Join(t.TempDir(), "private.key")
+		err = os.WriteFile(privateKeyFile, keyPair.PrivateKey, 0o600)
+		require.NoError(t, err, c.name)
+
+		created, err := sigstore.SignDockerManifestDigestWithPrivateKeyFile(context.Background(), manifestDigest, dockerReference,
+			privateKeyFile, c.passphrase)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, signature.SigstoreSignatureMIMEType, created.MIMEType, c.name)
+		_, err = base64.StdEncoding.DecodeString(created.Annotations[signature.SigstoreSignatureAnnotationKey])
+		assert.NoError(t, err, c.name)
+		sig := signature.SigstoreFromComponents(created.MIMEType, created.Payload, created.Annotations)
+
+		pr, err := newPRSigstoreSigned(
+			PRSigstoreSignedWithKeyData(keyPair.PublicKey),
+			PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+		)
+		require.NoError(t, err, c.name)
+		sar, err := pr.isSignatureAccepted(context.Background(), testImage, sig)
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, sarAccepted, sar, c.name)
+	}
+
+	// A wrong passphrase
+	keyPair, err := sigstore.GenerateKeyPair([]byte("some passphrase"))
+	require.NoError(t, err)
+	privateKeyFile := filepath.Join(t.TempDir(), "private.key")
+	err = os.WriteFile(privateKeyFile, keyPair.PrivateKey, 0o600)
+	require.NoError(t, err)
+	_, err = sigstore.SignDockerManifestDigestWithPrivateKeyFile(context.Background(), manifestDigest, dockerReference,
+		privateKeyFile, []byte("wrong passphrase"))
+	assert.Error(t, err)
+	// A reference without a tag or digest
+	_, err = sigstore.SignDockerManifestDigestWithPrivateKeyFile(context.Background(), manifestDigest, reference.TrimNamed(dockerReference),
+		privateKeyFile, []byte("some passphrase"))
+	assert.Error(t, err)
+}
+
+func TestPRSigstoreSignedIsSignatureAcceptedSignedAfter(t *testing.T) {
+	manifestDigest, err := digest.Parse("sha256:634a8f35b5f16dcf4aaa0822adc0b1964bb786fca12f6831de8ddc45e5986a00")
+	require.NoError(t, err)
+	testImage := dirImageMock(t, "fixtures/dir-img-cosign-valid", "192.168.64.2:5000/cosign-signed-single-sample")
+	dockerReference, err := reference.ParseNormalizedNamed("192.168.64.2:5000/cosign-signed-single-sample:latest")
+	require.NoError(t, err)
+	keyPair, err := sigstore.GenerateKeyPair([]byte("some passphrase"))
+	require.NoError(t, err)
+	privateKeyFile := filepath.Join(t.TempDir(), "private.key")
+	err = os.WriteFile(privateKeyFile, keyPair.PrivateKey, 0o600)
+	require.NoError(t, err)
+	beforeSigning := time.Now().Add(-time.Minute)
+	created, err := sigstore.SignDockerManifestDigestWithPrivateKeyFile(context.Background(), manifestDigest, dockerReference,
+		privateKeyFile, []byte("some passphrase"))
+	require.NoError(t, err)
+	sig := signature.SigstoreFromComponents(created.MIMEType, created.Payload, created.Annotations)
+
+	// Without signedAfter, the creator and timestamp are reported
+	pr, err := newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyData(keyPair.PublicKey),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+	)
+	require.NoError(t, err)
+	sar, accepted, err := pr.isSignatureAcceptedWithDescription(context.Background(), testImage, sig)
+	require.NoError(t, err)
+	assert.Equal(t, sarAccepted, sar)
+	require.NotNil(t, accepted)
+	assert.True(t, strings.HasPrefix(accepted.Creator, "containers/image "))
+	require.NotNil(t, accepted.Timestamp)
+	assert.True(t, accepted.Timestamp.After(beforeSigning))
+
+	for _, c := range []struct {
+		signedAfter time.Time
+		accepted    bool
+	}{
+		{beforeSigning, true},                        // A cutoff before the signature was created
+		{time.Now().Add(time.Hour), false},           // A stale signature
+		{*accepted.Timestamp, false},                 // A signature created exactly at the cutoff
+		{accepted.Timestamp.Add(-time.Second), true}, // A signature created just after the cutoff
+	} {
+		pr, err := newPRSigstoreSigned(
+			PRSigstoreSignedWithKeyData(keyPair.PublicKey),
+			PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+			PRSigstoreSignedWithSignedAfter(c.signedAfter),
+		)
+		require.NoError(t, err)
+		sar, err := pr.isSignatureAccepted(context.Background(), testImage, sig)
+		if c.accepted {
+			assert.NoError(t, err, c.signedAfter)
+			assert.Equal(t, sarAccepted, sar, c.signedAfter)
+		} else {
+			assert.Equal(t, sarRejected, sar, c.signedAfter)
+			assertRejectionReason(t, PRReasonSignatureTooOld, err)
+		}
+	}
+
+	// A signature without a timestamp (as created by /usr/bin/cosign) is rejected
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+		PRSigstoreSignedWithSignedAfter(beforeSigning),
+	)
+	require.NoError(t, err)
+	sar, err = pr.isSignatureAccepted(context.Background(), testImage, sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-valid/signature-1"))
+	assert.Equal(t, sarRejected, sar)
+	assertRejectionReason(t, PRReasonSignatureTooOld, err)
+}
+
+func TestPRSigstoreSignedIsSignatureAcceptedTimestamp(t *testing.T) {
+	testImage := dirImageMock(t, "fixtures/dir-img-cosign-tsa-valid", "192.168.64.2:5000/cosign-signed-single-sample")
+	timestampedSig := sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-tsa-valid/signature-1")
+	timestampTime := time.Date(2026, 10, 15, 0, 43, 31, 0, time.UTC)
+	otherDataTimestamp, err := os.ReadFile("fixtures/rfc3161-timestamp-other-data")
+	require.NoError(t, err)
+
+	// withTimestamp returns a copy of timestampedSig with the RFC 3161 timestamp annotation replaced by timestamp, or removed if timestamp is nil.
+	withTimestamp := func(timestamp []byte) signature.Sigstore {
+		annotations := map[string]string{}
+		for k, v := range timestampedSig.UntrustedAnnotations() {
+			annotations[k] = v
+		}
+		if timestamp == nil {
+			delete(annotations, signature.SigstoreRFC3161TimestampAnnotationKey)
+		} else {
+			annotations[signature.SigstoreRFC3161TimestampAnnotationKey] = string(timestamp)
+		}
+		return signature.SigstoreFromComponents(timestampedSig.UntrustedMIMEType(), timestampedSig.UntrustedPayload(), annotations)
+	}
+
+	// Success
+	pr, err := newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+		PRSigstoreSignedWithTSACertificatePath("fixtures/tsa-root.pem"),
+	)
+	require.NoError(t, err)
+	sar, accepted, err := pr.isSignatureAcceptedWithDescription(context.Background(), testImage, timestampedSig)
+	require.NoError(t, err)
+	assert.Equal(t, sarAccepted, sar)
+	require.NotNil(t, accepted)
+	require.NotNil(t, accepted.TrustedTimestamp)
+	assert.True(t, timestampTime.Equal(*accepted.TrustedTimestamp))
+
+	// Without a TSA configured, the timestamp is ignored
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+	)
+	require.NoError(t, err)
+	sar, accepted, err = pr.isSignatureAcceptedWithDescription(context.Background(), testImage, timestampedSig)
+	require.NoError(t, err)
+	assert.Equal(t, sarAccepted, sar)
+	require.NotNil(t, accepted)
+	assert.Nil(t, accepted.TrustedTimestamp)
+
+	// Invalid TSA certificate data
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+		PRSigstoreSignedWithTSACertificateData([]byte("this is not a certificate")),
+	)
+	require.NoError(t, err)
+	sar, err = pr.isSignatureAccepted(context.Background(), testImage, timestampedSig)
+	assert.Error(t, err)
+	assert.Equal(t, sarRejected, sar)
+
+	// A missing timestamp
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+		PRSigstoreSignedWithTSACertificatePath("fixtures/tsa-root.pem"),
+	)
+	require.NoError(t, err)
+	sar, err = pr.isSignatureAccepted(context.Background(), testImage, withTimestamp(nil))
+	assert.Equal(t, sarRejected, sar)
+	assertRejectionReason(t, PRReasonTimestampRequired, err)
+
+	// A timestamp of some other data
+	sar, err = pr.isSignatureAccepted(context.Background(), testImage, withTimestamp(otherDataTimestamp))
+	assert.Error(t, err)
+	assert.Equal(t, sarRejected, sar)
+
+	// A timestamp from an untrusted TSA
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+		PRSigstoreSignedWithTSACertificatePath("fixtures/tsa-other-root.pem"),
+	)
+	require.NoError(t, err)
+	sar, err = pr.isSignatureAccepted(context.Background(), testImage, timestampedSig)
+	assert.Error(t, err)
+	assert.Equal(t, sarRejected, sar)
+
+	// signedAfter is evaluated against the trusted timestamp (the signature payload itself has no timestamp)
+	for _, c := range []struct {
+		signedAfter time.Time
+		accepted    bool
+	}{
+		{timestampTime.Add(-time.Hour), true},
+		{timestampTime, false},
+		{timestampTime.Add(time.Hour), false},
+	} {
+		pr, err := newPRSigstoreSigned(
+			PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+			PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+			PRSigstoreSignedWithTSACertificatePath("fixtures/tsa-root.pem"),
+			PRSigstoreSignedWithSignedAfter(c.signedAfter),
+		)
+		require.NoError(t, err)
+		sar, err := pr.isSignatureAccepted(context.Background(), testImage, timestampedSig)
+		if c.accepted {
+			assert.NoError(t, err, c.signedAfter)
+			assert.Equal(t, sarAccepted, sar, c.signedAfter)
+		} else {
+			assert.Equal(t, sarRejected, sar, c.signedAfter)
+			assertRejectionReason(t, PRReasonSignatureTooOld, err)
+		}
+	}
+}
+
+func TestPRSigstoreSignedIsSignatureAcceptedWithRemapIdentity(t *testing.T) {
+	// An image mirrored from docker.io, with a signature naming the original docker.io reference.
+	manifestDigest, err := digest.Parse("sha256:634a8f35b5f16dcf4aaa0822adc0b1964bb786fca12f6831de8ddc45e5986a00")
+	require.NoError(t, err)
+	signedReference, err := reference.ParseNormalizedNamed("docker.io/library/busybox:latest")
+	require.NoError(t, err)
+	keyPair, err := sigstore.GenerateKeyPair([]byte("some passphrase"))
+	require.NoError(t, err)
+	privateKeyFile := filepath.Join(t.TempDir(), "private.key")
+	err = os.WriteFile(privateKeyFile, keyPair.PrivateKey, 0o600)
+	require.NoError(t, err)
+	created, err := sigstore.SignDockerManifestDigestWithPrivateKeyFile(context.Background(), manifestDigest, signedReference,
+		privateKeyFile, []byte("some passphrase"))
+	require.NoError(t, err)
+	sig := signature.SigstoreFromComponents(created.MIMEType, created.Payload, created.Annotations)
+
+	for _, c := range []struct {
+		imageRef             string
+		prefix, signedPrefix string
+		accepted             bool
+	}{
+		{"mirror.internal/library/busybox:latest", "mirror.internal", "docker.io", true},
+		{"mirror.internal/library/busybox:latest", "mirror.internal/library", "docker.io/library", true},
+		{"mirror.internal/library/busybox:latest", "mirror.internal/library/busybox", "docker.io/library/busybox", true},
+		// matchRepoDigestOrExact semantics apply after the rewrite
+		{"mirror.internal/library/busybox:notlatest", "mirror.internal", "docker.io", false},
+		{"mirror.internal/library/notbusybox:latest", "mirror.internal", "docker.io", false},
+		// Prefixes only match on path component boundaries, so no rewrite happens
+		{"mirror.internal/library/busyboxx:latest", "mirror.internal/library/busybox", "docker.io/library/busybox", false},
+		{"mirror.internalx/library/busybox:latest", "mirror.internal", "docker.io", false},
+		// A different mirror
+		{"other-mirror.internal/library/busybox:latest", "mirror.internal", "docker.io", false},
+	} {
+		testName := fmt.Sprintf("%#v", c)
+		testImage := dirImageMock(t, "fixtures/dir-img-cosign-valid", c.imageRef)
+		prm, err := NewPRMRemapIdentity(c.prefix, c.signedPrefix)
+		require.NoError(t, err, testName)
+		pr, err := newPRSigstoreSigned(
+			PRSigstoreSignedWithKeyData(keyPair.PublicKey),
+			PRSigstoreSignedWithSignedIdentity(prm),
+		)
+		require.NoError(t, err, testName)
+		sar, err := pr.isSignatureAccepted(context.Background(), testImage, sig)
+		if c.accepted {
+			assert.NoError(t, err, testName)
+			assert.Equal(t, sarAccepted, sar, testName)
+		} else {
+			assert.Error(t, err, testName)
+			assert.Equal(t, sarRejected, sar, testName)
+		}
+	}
+
+	// Without remapping, the signature is rejected for the mirrored image.
+	testImage := dirImageMock(t, "fixtures/dir-img-cosign-valid", "mirror.internal/library/busybox:latest")
+	pr, err := newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyData(keyPair.PublicKey),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+	)
+	require.NoError(t, err)
+	sar, err := pr.isSignatureAccepted(context.Background(), testImage, sig)
+	assert.Error(t, err)
+	assert.Equal(t, sarRejected, sar)
+
+	// Invalid prefixes are rejected at policy-parse time.
+	for _, prefix := range []string{"", "mirror.internal/", "mirror.internal/library:tag", "mirror.internal/Library"} {
+		_, err := NewPRMRemapIdentity(prefix, "docker.io")
+		assert.Error(t, err, prefix)
+		_, err = NewPRMRemapIdentity("mirror.internal", prefix)
+		assert.Error(t, err, prefix)
+	}
 }
 
 func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
@@ -566,7 +1038,7 @@ func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	allowed, err := pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err := pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningAllowed(t, allowed, err)
 
 	// Error reading signatures
@@ -577,7 +1049,7 @@ func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningRejected(t, allowed, err)
 
 	// No signatures
@@ -587,8 +1059,21 @@ func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningRejected(t, allowed, err)
+	assertRejectionReason(t, PRReasonNoSignatures, err)
+
+	// A signature by a different key
+	image = dirImageMock(t, "fixtures/dir-img-cosign-valid", "192.168.64.2:5000/cosign-signed-single-sample")
+	pr, err = NewPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign2.pub"),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	assertRejectionReason(t, PRReasonUntrustedKey, err)
+	assert.ErrorAs(t, err, &InvalidSignatureError{})
 
 	// Only non-sigstore signatures
 	image = dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
@@ -597,7 +1082,7 @@ func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningRejected(t, allowed, err)
 
 	// Only non-signature sigstore attachments
@@ -607,7 +1092,7 @@ func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningRejected(t, allowed, err)
 
 	// 1 invalid signature: use dir-img-valid, but a non-matching Docker reference
@@ -617,7 +1102,7 @@ func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningRejectedPolicyRequirement(t, allowed, err)
 
 	// 2 valid signatures
@@ -627,7 +1112,7 @@ func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningAllowed(t, allowed, err)
 
 	// One invalid, one valid signature (in this order)
@@ -637,7 +1122,7 @@ func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningAllowed(t, allowed, err)
 
 	// 2 invalid signajtures: use dir-img-cosign-valid-2, but a non-matching Docker reference
@@ -647,9 +1132,68 @@ func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningRejectedPolicyRequirement(t, allowed, err)
 
+	// minimumSignatures: signatures by 2 distinct keys, both required
+	image = dirImageMock(t, "fixtures/dir-img-cosign-multiple-keys", "192.168.64.2:5000/cosign-signed-single-sample")
+	pr, err = NewPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign.pub", "fixtures/cosign3.pub"}),
+		PRSigstoreSignedWithMinimumSignatures(2),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
+	assertRunningAllowed(t, allowed, err)
+
+	// minimumSignatures: 2 of 3 keys are enough
+	pr, err = NewPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign2.pub", "fixtures/cosign.pub", "fixtures/cosign3.pub"}),
+		PRSigstoreSignedWithMinimumSignatures(2),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
+	assertRunningAllowed(t, allowed, err)
+
+	// minimumSignatures: signatures by 2 distinct keys, 3 required
+	pr, err = NewPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign2.pub", "fixtures/cosign.pub", "fixtures/cosign3.pub"}),
+		PRSigstoreSignedWithMinimumSignatures(3),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	assert.ErrorContains(t, err, "by 2 distinct keys were found, but 3 are required")
+
+	// minimumSignatures: several signatures by the same key count only once
+	image = dirImageMock(t, "fixtures/dir-img-cosign-valid-2", "192.168.64.2:5000/cosign-signed-single-sample")
+	pr, err = NewPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign.pub", "fixtures/cosign2.pub"}),
+		PRSigstoreSignedWithMinimumSignatures(2),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+
+	// minimumSignatures: the same key listed twice counts only once, and makes the requirement unsatisfiable
+	keyCopy := filepath.Join(t.TempDir(), "cosign.pub")
+	keyContents, err := os.ReadFile("fixtures/cosign.pub")
+	require.NoError(t, err)
+	err = os.WriteFile(keyCopy, keyContents, 0o644)
+	require.NoError(t, err)
+	pr, err = NewPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign.pub", keyCopy}),
+		PRSigstoreSignedWithMinimumSignatures(2),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
+	assertRunningRejected(t, allowed, err)
+	assert.ErrorContains(t, err, "larger than the number of distinct keys (1)")
+
 	// Minimally check that the prmMatchExact also works as expected:
 	// - Signatures with a matching tag work
 	image = dirImageMock(t, "fixtures/dir-img-cosign-valid-with-tag", "192.168.64.2:5000/skopeo-signed:tag")
@@ -658,7 +1202,7 @@ func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(NewPRMMatchExact()),
 	)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningAllowed(t, allowed, err)
 	// - Signatures with a non-matching tag are rejected
 	image = dirImageMock(t, "fixtures/dir-img-cosign-valid-with-tag", "192.168.64.2:5000/skopeo-signed:othertag")
@@ -667,7 +1211,7 @@ func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(NewPRMMatchExact()),
 	)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningRejectedPolicyRequirement(t, allowed, err)
 	// - Cosign-created signatures are rejected
 	image = dirImageMock(t, "fixtures/dir-img-cosign-valid", "192.168.64.2:5000/cosign-signed-single-sample")
@@ -676,6 +1220,6 @@ func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(NewPRMMatchExact()),
 	)
 	require.NoError(t, err)
-	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image, nil)
 	assertRunningRejectedPolicyRequirement(t, allowed, err)
 }
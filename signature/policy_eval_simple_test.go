@@ -39,7 +39,7 @@ func TestPRInsecureAcceptAnythingIsSignatureAuthorAccepted(t *testing.T) {
 
 func TestPRInsecureAcceptAnythingIsRunningImageAllowed(t *testing.T) {
 	pr := NewPRInsecureAcceptAnything()
-	res, err := pr.isRunningImageAllowed(context.Background(), nameOnlyImageMock{})
+	res, err := pr.isRunningImageAllowed(context.Background(), nameOnlyImageMock{}, nil)
 	assertRunningAllowed(t, res, err)
 }
 
@@ -52,6 +52,6 @@ func TestPRRejectIsSignatureAuthorAccepted(t *testing.T) {
 
 func TestPRRejectIsRunningImageAllowed(t *testing.T) {
 	pr := NewPRReject()
-	res, err := pr.isRunningImageAllowed(context.Background(), nameOnlyImageMock{})
+	res, err := pr.isRunningImageAllowed(context.Background(), nameOnlyImageMock{}, nil)
 	assertRunningRejectedPolicyRequirement(t, res, err)
 }
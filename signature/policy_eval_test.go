@@ -2,25 +2,67 @@ package signature
 
 import (
 	"context"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"os"
 	"testing"
 
+	"github.com/containers/image/v5/directory"
 	"github.com/containers/image/v5/docker"
 	"github.com/containers/image/v5/docker/policyconfiguration"
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/imagesource"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/testing/mocks"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
 )
 
 func TestPolicyRequirementError(t *testing.T) {
-	// A stupid test just to keep code coverage
 	s := "test"
-	err := PolicyRequirementError(s)
+	err := newPolicyRequirementError(PRReasonNoSignatures, s)
 	assert.Equal(t, s, err.Error())
+	assert.Equal(t, PRReasonNoSignatures, err.Reason)
+	assert.Nil(t, errors.Unwrap(err))
+
+	cause := errors.New("cause")
+	err = policyRequirementErrorWithCause(PRReasonUntrustedKey, cause)
+	assert.Equal(t, "cause", err.Error())
+	assert.ErrorIs(t, err, cause)
+	err = PolicyRequirementError{Message: s, Cause: cause}
+	assert.Equal(t, s, err.Error())
+	assert.ErrorIs(t, err, cause)
+
+	var prErr PolicyRequirementError
+	require.ErrorAs(t, fmt.Errorf("wrapped: %w", newPolicyRequirementError(PRReasonRejected, s)), &prErr)
+	assert.Equal(t, PRReasonRejected, prErr.Reason)
+}
+
+func TestCommonRejectionReason(t *testing.T) {
+	for _, c := range []struct {
+		rejections []error
+		expected   PRReason
+	}{
+		{nil, PRReasonNoAcceptedSignatures},
+		{[]error{newPolicyRequirementError(PRReasonDigestMismatch, "a")}, PRReasonDigestMismatch},
+		{
+			[]error{newPolicyRequirementError(PRReasonUntrustedKey, "a"), policyRequirementErrorWithCause(PRReasonUntrustedKey, errors.New("b"))},
+			PRReasonUntrustedKey,
+		},
+		{
+			[]error{newPolicyRequirementError(PRReasonUntrustedKey, "a"), newPolicyRequirementError(PRReasonDigestMismatch, "b")},
+			PRReasonNoAcceptedSignatures,
+		},
+		{[]error{newPolicyRequirementError(PRReasonUntrustedKey, "a"), errors.New("b")}, PRReasonNoAcceptedSignatures},
+		{[]error{errors.New("a"), errors.New("b")}, PRReasonNoAcceptedSignatures},
+	} {
+		assert.Equal(t, c.expected, commonRejectionReason(c.rejections), "%#v", c.rejections)
+	}
 }
 
 func TestPolicyContextChangeState(t *testing.T) {
@@ -151,6 +193,13 @@ func TestPolicyContextRequirementsForImageRef(t *testing.T) {
 		{"docker", "deep.com/n1/n2/n3"},
 		{"docker", "deep.com/n1/n2/n3/repo"},
 		{"docker", "deep.com/n1/n2/n3/repo:tag2"},
+		{"docker", "prefix.com/team-*"},
+		{"docker", "prefix.com/team-a*"},
+		{"docker", "prefix.com/team-a/repo"},
+		{"docker", "exact.wild.org"},
+		{"docker", "*.wild.org"},
+		{"docker", "*.eu.wild.org"},
+		{"docker", "team.wild.org/team-*"},
 		{"atomic", "unmatched"},
 	} {
 		if _, ok := policy.Transports[t.transport]; !ok {
@@ -175,8 +224,25 @@ func TestPolicyContextRequirementsForImageRef(t *testing.T) {
 		// Sub domain match
 		{"docker", "very.deep.com/n1/n2/n3/repo:tag2", "docker", "*.deep.com"},
 		{"docker", "not.very.deep.com/n1/n2/n3/repo:tag2", "docker", "*.very.deep.com"},
+		// Prefix matches
+		{"docker", "prefix.com/team-b/repo:tag", "docker", "prefix.com/team-*"},
+		{"docker", "prefix.com/team-a/other:tag", "docker", "prefix.com/team-a*"},
+		{"docker", "prefix.com/team-abc:tag", "docker", "prefix.com/team-a*"},
+		// Namespace matches win over prefix matches
+		{"docker", "prefix.com/team-a/repo:tag", "docker", "prefix.com/team-a/repo"},
+		// Wildcard matches, with a port number or from the most specific one
+		{"docker", "us.wild.org/repo:tag", "docker", "*.wild.org"},
+		{"docker", "us.wild.org:5000/repo:tag", "docker", "*.wild.org"},
+		{"docker", "registry.eu.wild.org/repo:tag", "docker", "*.eu.wild.org"},
+		// Exact host name and prefix matches win over wildcard matches
+		{"docker", "exact.wild.org/repo:tag", "docker", "exact.wild.org"},
+		{"docker", "team.wild.org/team-a/repo:tag", "docker", "team.wild.org/team-*"},
+		{"docker", "team.wild.org/other:tag", "docker", "*.wild.org"},
+		// A wildcard does not match the host name itself
+		{"docker", "wild.org/repo:tag", "docker", ""},
 		// Default
 		{"docker", "this.does-not/match:anything", "docker", ""},
+		{"docker", "prefix.com/team:tag", "docker", ""},
 		// No match within a matched transport which doesn't have a "" scope
 		{"atomic", "this.does-not/match:anything", "", ""},
 		// No configuration available for this transport at all
@@ -204,12 +270,25 @@ func TestPolicyContextRequirementsForImageRef(t *testing.T) {
 }
 
 // pcImageMock returns a private.UnparsedImage for a directory, claiming a specified dockerReference and implementing PolicyConfigurationIdentity/PolicyConfigurationNamespaces.
-func pcImageMock(t *testing.T, dir, dockerReference string) private.UnparsedImage {
+func pcImageMock(t testing.TB, dir, dockerReference string) private.UnparsedImage {
 	ref, err := reference.ParseNormalizedNamed(dockerReference)
 	require.NoError(t, err)
 	return dirImageMockWithRef(t, dir, pcImageReferenceMock{transportName: "docker", ref: ref})
 }
 
+// canonicalSignatureIndex returns the index, in the canonical order, of the signature with sourceIndex in the transport-specific order of img.
+func canonicalSignatureIndex(t *testing.T, img private.UnparsedImage, sourceIndex int) int {
+	indices, err := img.UntrustedSignatureSourceIndices(context.Background())
+	require.NoError(t, err)
+	for i, index := range indices {
+		if index == sourceIndex {
+			return i
+		}
+	}
+	require.FailNow(t, "signature not found", "source index %d", sourceIndex)
+	return -1 // Unreachable
+}
+
 func TestPolicyContextGetSignaturesWithAcceptedAuthor(t *testing.T) {
 	expectedSig := &Signature{
 		DockerManifestDigest: TestImageManifestDigest,
@@ -446,6 +525,381 @@ func TestPolicyContextIsRunningImageAllowed(t *testing.T) {
 	// mistakes only, anyway.
 }
 
+// sigstoreKeyIdentityFromFile returns the expected AcceptedSignature.KeyIdentity for a sigstore public key in path.
+func sigstoreKeyIdentityFromFile(t *testing.T, path string) string {
+	pemData, err := os.ReadFile(path)
+	require.NoError(t, err)
+	block, _ := pem.Decode(pemData)
+	require.NotNil(t, block)
+	return digest.FromBytes(block.Bytes).String()
+}
+
+func TestPolicyContextIsRunningImageAllowedWithResult(t *testing.T) {
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest:latest": {
+					NewPRInsecureAcceptAnything(),
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact()),
+				},
+				"docker.io/testing/manifest:allowDeny": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository()),
+					NewPRReject(),
+					NewPRInsecureAcceptAnything(),
+				},
+				"192.168.64.2:5000/cosign-signed-single-sample:latest": {
+					xNewPRSigstoreSigned(
+						PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign2.pub", "fixtures/cosign.pub"}),
+						PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+					),
+				},
+				"192.168.64.2:5000/cosign-signed-single-sample:multipleKeys": {
+					xNewPRSigstoreSigned(
+						PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign.pub", "fixtures/cosign3.pub"}),
+						PRSigstoreSignedWithMinimumSignatures(2),
+						PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+					),
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+
+	// signedBy
+	img := pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	res, report, err := pc.IsRunningImageAllowedWithResult(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	assert.Equal(t, []PolicyRequirementResult{
+		{Index: 0, Allowed: true},
+		{Index: 1, Allowed: true, AcceptedSignatures: []AcceptedSignature{{
+			DockerManifestDigest: TestImageManifestDigest,
+			DockerReference:      "testing/manifest:latest",
+			KeyIdentity:          TestKeyFingerprint,
+			Signer:               TestKeyFingerprint,
+		}}},
+	}, report)
+
+	// Evaluation stops at the first rejecting requirement
+	img = pcImageMock(t, "fixtures/dir-img-mixed", "testing/manifest:allowDeny")
+	res, report, err = pc.IsRunningImageAllowedWithResult(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	require.Len(t, report, 2)
+	assert.True(t, report[0].Allowed)
+	assert.Len(t, report[0].AcceptedSignatures, 1)
+	assert.Equal(t, PolicyRequirementResult{Index: 1, Allowed: false, Err: err}, report[1])
+
+	// A rejected signature-based requirement reports no signatures
+	img = pcImageMock(t, "fixtures/dir-img-unsigned", "testing/manifest:latest")
+	res, report, err = pc.IsRunningImageAllowedWithResult(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	assert.Equal(t, []PolicyRequirementResult{
+		{Index: 0, Allowed: true},
+		{Index: 1, Allowed: false, Err: err},
+	}, report)
+
+	// sigstoreSigned, reporting the key which verified the signature
+	img = pcImageMock(t, "fixtures/dir-img-cosign-valid", "192.168.64.2:5000/cosign-signed-single-sample:latest")
+	res, report, err = pc.IsRunningImageAllowedWithResult(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	assert.Equal(t, []PolicyRequirementResult{
+		{Index: 0, Allowed: true, AcceptedSignatures: []AcceptedSignature{{
+			DockerManifestDigest: "sha256:634a8f35b5f16dcf4aaa0822adc0b1964bb786fca12f6831de8ddc45e5986a00",
+			DockerReference:      "192.168.64.2:5000/cosign-signed-single-sample",
+			KeyIdentity:          sigstoreKeyIdentityFromFile(t, "fixtures/cosign.pub"),
+			Signer:               sigstoreKeyIdentityFromFile(t, "fixtures/cosign.pub"),
+		}}},
+	}, report)
+
+	// sigstoreSigned with minimumSignatures reports all of the required signatures
+	img = pcImageMock(t, "fixtures/dir-img-cosign-multiple-keys", "192.168.64.2:5000/cosign-signed-single-sample:multipleKeys")
+	res, report, err = pc.IsRunningImageAllowedWithResult(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	require.Len(t, report, 1)
+	require.Len(t, report[0].AcceptedSignatures, 2)
+	assert.Equal(t, sigstoreKeyIdentityFromFile(t, "fixtures/cosign.pub"), report[0].AcceptedSignatures[0].KeyIdentity)
+	assert.Equal(t, sigstoreKeyIdentityFromFile(t, "fixtures/cosign3.pub"), report[0].AcceptedSignatures[1].KeyIdentity)
+
+	// Empty list of requirements (invalid)
+	pcEmpty, err := NewPolicyContext(&Policy{Default: PolicyRequirements{}})
+	require.NoError(t, err)
+	defer func() {
+		err := pcEmpty.Destroy()
+		require.NoError(t, err)
+	}()
+	img = pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	res, report, err = pcEmpty.IsRunningImageAllowedWithResult(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	assert.Empty(t, report)
+}
+
+func TestPolicyContextSignatureEvaluationCallback(t *testing.T) {
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest": {
+					NewPRInsecureAcceptAnything(),
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository()),
+				},
+				"192.168.64.2:5000/cosign-signed-single-sample": {
+					xNewPRSigstoreSigned(
+						PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+						PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+					),
+				},
+				"192.168.64.2:5000/cosign-signed-single-sample:multipleKeys": {
+					xNewPRSigstoreSigned(
+						PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign.pub", "fixtures/cosign3.pub"}),
+						PRSigstoreSignedWithMinimumSignatures(2),
+						PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+					),
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+
+	var evaluations []SignatureEvaluation
+	pc.SignatureEvaluationCallback = func(e SignatureEvaluation) {
+		evaluations = append(evaluations, e)
+	}
+	for _, c := range []struct {
+		dir, ref string
+		reqIndex int
+	}{
+		// One invalid, one valid signature (in this order in the directory)
+		{"fixtures/dir-img-mixed", "testing/manifest:latest", 1},
+		{"fixtures/dir-img-cosign-mixed", "192.168.64.2:5000/cosign-signed-single-sample:latest", 0},
+	} {
+		evaluations = nil
+		img := pcImageMock(t, c.dir, c.ref)
+		res, err := pc.IsRunningImageAllowed(context.Background(), img)
+		assertRunningAllowed(t, res, err)
+		// Signatures are evaluated in the canonical order, until the valid one is accepted
+		validIndex := canonicalSignatureIndex(t, img, 1)
+		require.Len(t, evaluations, validIndex+1, c.dir)
+		for i, e := range evaluations {
+			assert.Equal(t, c.reqIndex, e.RequirementIndex, c.dir)
+			assert.Equal(t, i, e.SignatureIndex, c.dir)
+			assert.Equal(t, i == validIndex, e.Accepted, c.dir)
+			if i == validIndex {
+				assert.NoError(t, e.Err, c.dir)
+			} else {
+				assert.Error(t, e.Err, c.dir)
+			}
+		}
+	}
+
+	// minimumSignatures: every evaluation, including the accepted signature of each key, is reported
+	evaluations = nil
+	img := pcImageMock(t, "fixtures/dir-img-cosign-multiple-keys", "192.168.64.2:5000/cosign-signed-single-sample:multipleKeys")
+	res, err := pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	accepted := 0
+	for _, e := range evaluations {
+		if e.Accepted {
+			accepted++
+		}
+	}
+	assert.Equal(t, 2, accepted)
+
+	// Canceling the context between signatures aborts the evaluation.
+	// (The mixed fixtures are not useful here: in the canonical order, their valid signature is evaluated first.)
+	for _, c := range []struct{ dir, ref string }{
+		{"fixtures/dir-img-cosign-multiple-keys", "192.168.64.2:5000/cosign-signed-single-sample:multipleKeys"},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		evaluations = nil
+		pc.SignatureEvaluationCallback = func(e SignatureEvaluation) {
+			evaluations = append(evaluations, e)
+			cancel()
+		}
+		img := pcImageMock(t, c.dir, c.ref)
+		res, err := pc.IsRunningImageAllowed(ctx, img)
+		assert.False(t, res, c.dir)
+		assert.ErrorIs(t, err, context.Canceled, c.dir)
+		assert.Len(t, evaluations, 1, c.dir)
+		cancel()
+	}
+
+	// The callback is not necessary.
+	pc.SignatureEvaluationCallback = nil
+	img = pcImageMock(t, "fixtures/dir-img-cosign-mixed", "192.168.64.2:5000/cosign-signed-single-sample:latest")
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+}
+
+func TestPolicyContextIsRunningImageAllowedWithDetails(t *testing.T) {
+	signedByReq := xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository())
+	sigstoreReq := xNewPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+	)
+	fulcio, err := NewPRSigstoreSignedFulcio(
+		PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
+		PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"),
+		PRSigstoreSignedFulcioWithSubjectEmail("mitr@redhat.com"),
+	)
+	require.NoError(t, err)
+	fulcioReq := xNewPRSigstoreSigned(
+		PRSigstoreSignedWithFulcio(fulcio),
+		PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+	)
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest:latest": {
+					NewPRInsecureAcceptAnything(),
+					signedByReq,
+				},
+				"192.168.64.2:5000/cosign-signed-single-sample:latest": {
+					sigstoreReq,
+				},
+				"192.168.64.2:5000/cosign-signed/fulcio-rekor-1:latest": {
+					fulcioReq,
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+
+	// signedBy, with the decisive signature not being the first one in the directory
+	img := pcImageMock(t, "fixtures/dir-img-mixed", "testing/manifest:latest")
+	res, details, err := pc.IsRunningImageAllowedWithDetails(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	assert.Equal(t, []SignatureAcceptance{{
+		RequirementIndex: 1,
+		Requirement:      signedByReq,
+		Signature: AcceptedSignature{
+			SignatureIndex:       canonicalSignatureIndex(t, img, 1),
+			DockerManifestDigest: TestImageManifestDigest,
+			DockerReference:      "testing/manifest:latest",
+			KeyIdentity:          TestKeyFingerprint,
+			Signer:               TestKeyFingerprint,
+		},
+	}}, details)
+
+	// sigstoreSigned with a public key
+	img = pcImageMock(t, "fixtures/dir-img-cosign-mixed", "192.168.64.2:5000/cosign-signed-single-sample:latest")
+	res, details, err = pc.IsRunningImageAllowedWithDetails(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	require.Len(t, details, 1)
+	assert.Equal(t, 0, details[0].RequirementIndex)
+	assert.Equal(t, sigstoreReq, details[0].Requirement)
+	assert.Equal(t, canonicalSignatureIndex(t, img, 1), details[0].Signature.SignatureIndex)
+	assert.Equal(t, sigstoreKeyIdentityFromFile(t, "fixtures/cosign.pub"), details[0].Signature.Signer)
+
+	// sigstoreSigned with Fulcio reports the certificate subject
+	img = pcImageMock(t, "fixtures/dir-img-cosign-fulcio-rekor-valid", "192.168.64.2:5000/cosign-signed/fulcio-rekor-1:latest")
+	res, details, err = pc.IsRunningImageAllowedWithDetails(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	require.Len(t, details, 1)
+	assert.Equal(t, fulcioReq, details[0].Requirement)
+	assert.Equal(t, 0, details[0].Signature.SignatureIndex)
+	assert.Equal(t, "mitr@redhat.com", details[0].Signature.Signer)
+	assert.NotEqual(t, "", details[0].Signature.KeyIdentity)
+
+	// A rejected image reports no details
+	img = pcImageMock(t, "fixtures/dir-img-unsigned", "testing/manifest:latest")
+	res, details, err = pc.IsRunningImageAllowedWithDetails(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	assertRejectionReason(t, PRReasonNoSignatures, err)
+	assert.Nil(t, details)
+}
+
+// noManifestImageSourceMock is a dirImageSourceMock which fails on any GetManifest call.
+type noManifestImageSourceMock struct {
+	dirImageSourceMock
+}
+
+func (s *noManifestImageSourceMock) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	return nil, "", errors.New("unexpected GetManifest call")
+}
+
+func TestPolicyContextIsRunningImageAllowedWithManifest(t *testing.T) {
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest:latest": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact()),
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+
+	// noManifestSource returns a source for dir which fails if the manifest is read from it.
+	noManifestSource := func(dir string) types.ImageSource {
+		ref, err := reference.ParseNormalizedNamed("testing/manifest:latest")
+		require.NoError(t, err)
+		srcRef, err := directory.NewReference(dir)
+		require.NoError(t, err)
+		src, err := srcRef.NewImageSource(context.Background(), nil)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			err := src.Close()
+			require.NoError(t, err)
+		})
+		return &noManifestImageSourceMock{dirImageSourceMock{
+			ImageSource: imagesource.FromPublic(src),
+			ref:         pcImageReferenceMock{transportName: "docker", ref: ref},
+		}}
+	}
+	manifestBlob, err := os.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+
+	// Success
+	src := noManifestSource("fixtures/dir-img-valid")
+	res, err := pc.IsRunningImageAllowedWithManifest(context.Background(), src, nil, manifestBlob, TestImageManifestDigest)
+	assertRunningAllowed(t, res, err)
+
+	// A matching instanceDigest is accepted; the fixture has no per-instance signatures, so the policy rejects the image.
+	instanceDigest := TestImageManifestDigest
+	res, err = pc.IsRunningImageAllowedWithManifest(context.Background(), src, &instanceDigest, manifestBlob, TestImageManifestDigest)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+
+	// The manifest does not match the provided digest
+	res, err = pc.IsRunningImageAllowedWithManifest(context.Background(), src, nil, manifestBlob, digest.FromString("not the manifest"))
+	assertRunningRejected(t, res, err)
+	_, isPolicyRequirementError := err.(PolicyRequirementError)
+	assert.False(t, isPolicyRequirementError)
+
+	// The manifest does not match instanceDigest
+	otherDigest := digest.FromString("not the manifest")
+	res, err = pc.IsRunningImageAllowedWithManifest(context.Background(), src, &otherDigest, manifestBlob, TestImageManifestDigest)
+	assertRunningRejected(t, res, err)
+
+	// A different manifest, consistent with its digest, is not accepted by the signatures
+	modifiedManifest := append(slices.Clone(manifestBlob), '\n')
+	res, err = pc.IsRunningImageAllowedWithManifest(context.Background(), src, nil, modifiedManifest, digest.FromBytes(modifiedManifest))
+	assertRunningRejectedPolicyRequirement(t, res, err)
+
+	// Signature errors are reported
+	invalidSigDir := createInvalidSigDir(t)
+	res, err = pc.IsRunningImageAllowedWithManifest(context.Background(), noManifestSource(invalidSigDir), nil, manifestBlob, TestImageManifestDigest)
+	assertRunningRejected(t, res, err)
+}
+
 // Helpers for validating PolicyRequirement.isSignatureAuthorAccepted results:
 
 // assertSARRejected verifies that isSignatureAuthorAccepted returns a consistent sarRejected result
@@ -467,7 +921,7 @@ func assertSARRejected(t *testing.T, sar signatureAcceptanceResult, parsedSig *S
 // and that the returned error is a PolicyRequirementError..
 func assertSARRejectedPolicyRequirement(t *testing.T, sar signatureAcceptanceResult, parsedSig *Signature, err error) {
 	assertSARRejected(t, sar, parsedSig, err)
-	assert.IsType(t, PolicyRequirementError(""), err)
+	assert.IsType(t, PolicyRequirementError{}, err)
 }
 
 // assertSARRejected verifies that isSignatureAuthorAccepted returns a consistent sarUnknown result.
@@ -495,5 +949,13 @@ func assertRunningRejected(t *testing.T, allowed bool, err error) {
 // and that the returned error is a PolicyRequirementError.
 func assertRunningRejectedPolicyRequirement(t *testing.T, allowed bool, err error) {
 	assertRunningRejected(t, allowed, err)
-	assert.IsType(t, PolicyRequirementError(""), err)
+	assert.IsType(t, PolicyRequirementError{}, err)
+}
+
+// assertRejectionReason verifies that err is, or wraps, a PolicyRequirementError with reason.
+func assertRejectionReason(t *testing.T, reason PRReason, err error) {
+	var prErr PolicyRequirementError
+	if assert.ErrorAs(t, err, &prErr) {
+		assert.Equal(t, reason, prErr.Reason)
+	}
 }
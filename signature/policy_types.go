@@ -6,6 +6,8 @@
 
 package signature
 
+import "time"
+
 // NOTE: Keep this in sync with docs/containers-policy.json.5.md!
 
 // Policy defines requirements for considering a signature, or an image, valid.
@@ -22,8 +24,13 @@ type Policy struct {
 // Scopes are defined by the transport (types.ImageReference.PolicyConfigurationIdentity etc.);
 // there is one scope precisely matching to a single image, and namespace scopes as prefixes
 // of the single-image scope. (e.g. hostname[/zero[/or[/more[/namespaces[/individualimage]]]]])
+// A prefix scope, ending with "*" (e.g. "registry.example.com/team-*"), matches all images whose single-image scope
+// starts with the rest of the key.
 // The empty scope, if exists, is considered a parent namespace of all other scopes.
-// Most specific scope wins, duplication is prohibited (hard failure).
+// Most specific scope wins, duplication is prohibited (hard failure): the single-image scope is preferred,
+// then namespace scopes from the most specific one, then the longest matching prefix scope,
+// then wildcard namespace scopes matching all subdomains of a host (e.g. "*.example.com") from the most specific one,
+// then the empty scope.
 type PolicyTransportScopes map[string]PolicyRequirements
 
 // PolicyRequirements is a set of requirements applying to a set of images; each of them must be satisfied (though perhaps each by a different signature).
@@ -47,6 +54,9 @@ const (
 	prTypeSignedBy               prTypeIdentifier = "signedBy"
 	prTypeSignedBaseLayer        prTypeIdentifier = "signedBaseLayer"
 	prTypeSigstoreSigned         prTypeIdentifier = "sigstoreSigned"
+	prTypeSigstoreAttestation    prTypeIdentifier = "sigstoreAttestation"
+	prTypeRemote                 prTypeIdentifier = "remote"
+	prTypeRejectSignedBy         prTypeIdentifier = "rejectSignedBy"
 )
 
 // prInsecureAcceptAnything is a PolicyRequirement with type = prTypeInsecureAcceptAnything:
@@ -67,21 +77,28 @@ type prReject struct {
 type prSignedBy struct {
 	prCommon
 
-	// KeyType specifies what kind of key reference KeyPath/KeyPaths/KeyData is.
+	// KeyType specifies what kind of key reference KeyPath/KeyPaths/KeyData/KeyDirectory is.
 	// Acceptable values are “GPGKeys” | “signedByGPGKeys” “X.509Certificates” | “signedByX.509CAs”
 	// FIXME: eventually also support GPGTOFU, X.509TOFU, with KeyPath only
 	KeyType sbKeyType `json:"keyType"`
 
-	// KeyPath is a pathname to a local file containing the trusted key(s). Exactly one of KeyPath, KeyPaths and KeyData must be specified.
+	// KeyPath is a pathname to a local file containing the trusted key(s). Exactly one of KeyPath, KeyPaths, KeyData and KeyDirectory must be specified.
 	KeyPath string `json:"keyPath,omitempty"`
-	// KeyPaths if a set of pathnames to local files containing the trusted key(s). Exactly one of KeyPath, KeyPaths and KeyData must be specified.
+	// KeyPaths if a set of pathnames to local files containing the trusted key(s). Exactly one of KeyPath, KeyPaths, KeyData and KeyDirectory must be specified.
 	KeyPaths []string `json:"keyPaths,omitempty"`
-	// KeyData contains the trusted key(s), base64-encoded. Exactly one of KeyPath, KeyPaths and KeyData must be specified.
+	// KeyData contains the trusted key(s), base64-encoded. Exactly one of KeyPath, KeyPaths, KeyData and KeyDirectory must be specified.
 	KeyData []byte `json:"keyData,omitempty"`
+	// KeyDirectory is a pathname to a local directory; all files in it contain the trusted key(s).
+	// Exactly one of KeyPath, KeyPaths, KeyData and KeyDirectory must be specified.
+	KeyDirectory string `json:"keyDirectory,omitempty"`
 
 	// SignedIdentity specifies what image identity the signature must be claiming about the image.
 	// Defaults to "matchRepoDigestOrExact" if not specified.
 	SignedIdentity PolicyReferenceMatch `json:"signedIdentity"`
+
+	// AllowExpiredKeys, if true, accepts signatures by keys which have expired, as long as the signature was created
+	// before the key expired. Signatures by revoked keys are always rejected.
+	AllowExpiredKeys bool `json:"allowExpiredKeys,omitempty"`
 }
 
 // sbKeyType are the allowed values for prSignedBy.KeyType
@@ -100,6 +117,18 @@ const (
 	SBKeyTypeSignedByX509CAs sbKeyType = "signedByX509CAs"
 )
 
+// prRejectSignedBy is a PolicyRequirement with type = prTypeRejectSignedBy: the image is rejected if it has a signature
+// made by any of the specified GPG keys (e.g. keys known to be compromised); otherwise, this requirement does not block the image.
+// It does not accept any signatures, so it must be combined with other requirements which govern acceptance.
+type prRejectSignedBy struct {
+	prCommon
+
+	// KeyPath is a pathname to a local file containing the rejected key(s). Exactly one of KeyPath and KeyData must be specified.
+	KeyPath string `json:"keyPath,omitempty"`
+	// KeyData contains the rejected key(s), base64-encoded. Exactly one of KeyPath and KeyData must be specified.
+	KeyData []byte `json:"keyData,omitempty"`
+}
+
 // prSignedBaseLayer is a PolicyRequirement with type = prSignedBaseLayer: the image has a specified, correctly signed, base image.
 type prSignedBaseLayer struct {
 	prCommon
@@ -111,13 +140,16 @@ type prSignedBaseLayer struct {
 type prSigstoreSigned struct {
 	prCommon
 
-	// KeyPath is a pathname to a local file containing the trusted key. Exactly one of KeyPath, KeyData, Fulcio must be specified.
+	// KeyPath is a pathname to a local file containing the trusted key. Exactly one of KeyPath, KeyPaths, KeyData, KeyDatas and Fulcio must be specified.
 	KeyPath string `json:"keyPath,omitempty"`
-	// KeyData contains the trusted key, base64-encoded. Exactly one of KeyPath, KeyData, Fulcio must be specified.
+	// KeyPaths is a set of pathnames to local files containing the trusted key(s). Exactly one of KeyPath, KeyPaths, KeyData, KeyDatas and Fulcio must be specified.
+	KeyPaths []string `json:"keyPaths,omitempty"`
+	// KeyData contains the trusted key, base64-encoded. Exactly one of KeyPath, KeyPaths, KeyData, KeyDatas and Fulcio must be specified.
 	KeyData []byte `json:"keyData,omitempty"`
-	// FIXME: Multiple public keys?
+	// KeyDatas is a set of trusted keys, base64-encoded. Exactly one of KeyPath, KeyPaths, KeyData, KeyDatas and Fulcio must be specified.
+	KeyDatas [][]byte `json:"keyDatas,omitempty"`
 
-	// Fulcio specifies which Fulcio-generated certificates are accepted. Exactly one of KeyPath, KeyData, Fulcio must be specified.
+	// Fulcio specifies which Fulcio-generated certificates are accepted. Exactly one of KeyPath, KeyPaths, KeyData, KeyDatas and Fulcio must be specified.
 	// If Fulcio is specified, one of RekorPublicKeyPath or RekorPublicKeyData must be specified as well.
 	Fulcio PRSigstoreSignedFulcio `json:"fulcio,omitempty"`
 
@@ -130,12 +162,79 @@ type prSigstoreSigned struct {
 	// (and Rekor inclusion is not required if a Rekor public key is not specified).
 	RekorPublicKeyData []byte `json:"rekorPublicKeyData,omitempty"`
 
+	// MinimumSignatures, if not 0, is the number of distinct keys from KeyPath, KeyPaths, KeyData or KeyDatas which must
+	// have made an accepted signature of the image; it cannot be used with Fulcio.
+	// If 0 (the default), a single accepted signature is sufficient.
+	MinimumSignatures int `json:"minimumSignatures,omitempty"`
+
 	// SignedIdentity specifies what image identity the signature must be claiming about the image.
 	// Defaults to "matchRepoDigestOrExact" if not specified.
 	// Note that /usr/bin/cosign interoperability might require using repo-only matching.
 	SignedIdentity PolicyReferenceMatch `json:"signedIdentity"`
+
+	// RequiredAnnotations, if not empty, contains annotations (as set by (cosign sign -a key=value)) which the signature payload
+	// must contain with exactly the specified values.
+	RequiredAnnotations map[string]string `json:"requiredAnnotations,omitempty"`
+
+	// SignedAfter, if not nil, requires the signature payload to contain a timestamp later than this value,
+	// e.g. to reject signatures made before a key was known to be compromised.
+	// Note that the timestamp is claimed by the signer: it is covered by the signature, but a holder of a compromised key can set any value.
+	SignedAfter *time.Time `json:"signedAfter,omitempty"`
+
+	// TSACertificatePath is a pathname to a local file containing PEM-encoded root certificates of trusted RFC 3161 time-stamping authorities.
+	// At most one of TSACertificatePath and TSACertificateData may be specified.
+	// If either is specified, signatures must carry an RFC 3161 timestamp of the signature (as created by (cosign sign --timestamp-server-url)),
+	// issued by one of these authorities. The timestamp is then used instead of the signer-claimed timestamp for SignedAfter,
+	// and Fulcio certificates must be valid at the time of the timestamp.
+	TSACertificatePath string `json:"tsaCertificatePath,omitempty"`
+	// TSACertificateData contains PEM-encoded root certificates of trusted RFC 3161 time-stamping authorities, base64-encoded.
+	// At most one of TSACertificatePath and TSACertificateData may be specified; see TSACertificatePath.
+	TSACertificateData []byte `json:"tsaCertificateData,omitempty"`
 }
 
+// prSigstoreAttestation is a PolicyRequirement with type = prTypeSigstoreAttestation: the image has a sigstore attestation
+// (an in-toto statement in a DSSE envelope, as created by (cosign attest)) of a specified predicate type, signed by a trusted key.
+type prSigstoreAttestation struct {
+	prCommon
+
+	// KeyPath is a pathname to a local file containing the trusted key. Exactly one of KeyPath and KeyData must be specified.
+	KeyPath string `json:"keyPath,omitempty"`
+	// KeyData contains the trusted key, base64-encoded. Exactly one of KeyPath and KeyData must be specified.
+	KeyData []byte `json:"keyData,omitempty"`
+
+	// PredicateType is the in-toto predicate type the attestation must have, e.g. "https://slsa.dev/provenance/v1".
+	PredicateType string `json:"predicateType"`
+
+	// SignedIdentity, if not nil, specifies what image identity a subject of the attestation must be claiming about the image.
+	// Note that (cosign attest) records the repository name only, so repo-only matching is typically necessary.
+	SignedIdentity PolicyReferenceMatch `json:"signedIdentity,omitempty"`
+}
+
+// prRemote is a PolicyRequirement with type = prTypeRemote: a decision service, contacted over HTTP(S),
+// decides whether the image is allowed to run.
+type prRemote struct {
+	prCommon
+
+	// URL is the http:// or https:// URL of the decision service; requests are POSTed to it.
+	URL string `json:"url"`
+	// Timeout is the maximum duration of a request to the decision service, as a Go duration string (e.g. "5s").
+	// Defaults to "10s" if not specified.
+	Timeout string `json:"timeout,omitempty"`
+	// FailureMode specifies what happens if the decision service can’t be contacted, or does not provide a valid answer.
+	// Defaults to "failClosed" if not specified.
+	FailureMode prRemoteFailureMode `json:"failureMode,omitempty"`
+}
+
+// prRemoteFailureMode are the allowed values for prRemote.FailureMode
+type prRemoteFailureMode string
+
+const (
+	// PRRemoteFailClosed rejects the image if the decision service does not provide an answer.
+	PRRemoteFailClosed prRemoteFailureMode = "failClosed"
+	// PRRemoteFailOpen allows the image to run if the decision service does not provide an answer.
+	PRRemoteFailOpen prRemoteFailureMode = "failOpen"
+)
+
 // PRSigstoreSignedFulcio contains Fulcio configuration options for a "sigstoreSigned" PolicyRequirement.
 // This is a public type with a single private implementation.
 type PRSigstoreSignedFulcio interface {
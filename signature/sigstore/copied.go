@@ -55,6 +55,7 @@ func loadPrivateKey(key []byte, pass []byte) (signature.SignerVerifier, error) {
 	if err != nil {
 		return nil, fmt.Errorf("decrypt: %w", err)
 	}
+	defer clearBytes(x509Encoded) // Not in the cosign original: the parsed key does not refer to x509Encoded.
 
 	pk, err := x509.ParsePKCS8PrivateKey(x509Encoded)
 	if err != nil {
@@ -79,6 +80,7 @@ func marshalKeyPair(privateKey crypto.PrivateKey, publicKey crypto.PublicKey, pa
 	if err != nil {
 		return nil, nil, fmt.Errorf("x509 encoding private key: %w", err)
 	}
+	defer clearBytes(x509Encoded) // Not in the cosign original.
 
 	encBytes, err := encrypted.Encrypt(x509Encoded, password)
 	if err != nil {
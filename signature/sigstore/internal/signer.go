@@ -12,6 +12,7 @@ import (
 	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/signature/internal"
+	"github.com/opencontainers/go-digest"
 	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
 )
 
@@ -39,16 +40,25 @@ func (s *SigstoreSigner) ProgressMessage() string {
 
 // SignImageManifest creates a new signature for manifest m as dockerReference.
 func (s *SigstoreSigner) SignImageManifest(ctx context.Context, m []byte, dockerReference reference.Named) (signature.Signature, error) {
+	manifestDigest, err := manifest.Digest(m)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := s.SignManifestDigest(ctx, manifestDigest, dockerReference)
+	if err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// SignManifestDigest creates a new signature for a manifest with manifestDigest as dockerReference.
+func (s *SigstoreSigner) SignManifestDigest(ctx context.Context, manifestDigest digest.Digest, dockerReference reference.Named) (signature.Sigstore, error) {
 	if s.PrivateKey == nil {
-		return nil, errors.New("internal error: nothing to sign with, should have been detected in NewSigner")
+		return signature.Sigstore{}, errors.New("internal error: nothing to sign with, should have been detected in NewSigner")
 	}
 
 	if reference.IsNameOnly(dockerReference) {
-		return nil, fmt.Errorf("reference %s can’t be signed, it has neither a tag nor a digest", dockerReference.String())
-	}
-	manifestDigest, err := manifest.Digest(m)
-	if err != nil {
-		return nil, err
+		return signature.Sigstore{}, fmt.Errorf("reference %s can’t be signed, it has neither a tag nor a digest", dockerReference.String())
 	}
 	// sigstore/cosign completely ignores dockerReference for actual policy decisions.
 	// They record the repo (but NOT THE TAG) in the value; without the tag we can’t detect version rollbacks.
@@ -56,21 +66,21 @@ func (s *SigstoreSigner) SignImageManifest(ctx context.Context, m []byte, docker
 	payloadData := internal.NewUntrustedSigstorePayload(manifestDigest, dockerReference.String())
 	payloadBytes, err := json.Marshal(payloadData)
 	if err != nil {
-		return nil, err
+		return signature.Sigstore{}, err
 	}
 
 	// github.com/sigstore/cosign/internal/pkg/cosign.payloadSigner uses signatureoptions.WithContext(),
 	// which seems to be not used by anything. So we don’t bother.
 	signatureBytes, err := s.PrivateKey.SignMessage(bytes.NewReader(payloadBytes))
 	if err != nil {
-		return nil, fmt.Errorf("creating signature: %w", err)
+		return signature.Sigstore{}, fmt.Errorf("creating signature: %w", err)
 	}
 	base64Signature := base64.StdEncoding.EncodeToString(signatureBytes)
 	var rekorSETBytes []byte // = nil
 	if s.RekorUploader != nil {
 		set, err := s.RekorUploader(ctx, s.SigningKeyOrCert, signatureBytes, payloadBytes)
 		if err != nil {
-			return nil, err
+			return signature.Sigstore{}, err
 		}
 		rekorSETBytes = set
 	}
@@ -0,0 +1,44 @@
+package sigstore
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/signature/sigstore/internal"
+	"github.com/opencontainers/go-digest"
+)
+
+// Signature is a sigstore signature, as returned by SignDockerManifestDigestWithPrivateKeyFile.
+// To be usable, it must be stored alongside the signed image, e.g. as a layer of a sigstore attachment in a registry,
+// using the provided MIME type and annotations.
+type Signature struct {
+	MIMEType    string
+	Payload     []byte
+	Annotations map[string]string
+}
+
+// SignDockerManifestDigestWithPrivateKeyFile returns a sigstore signature for a manifest with manifestDigest
+// as dockerReference, using a private key in privateKeyFile encrypted using passphrase (which may be empty).
+//
+// Most callers copying images should instead use NewSigner with copy.Options.Signers;
+// this function is intended for tools which create signatures of existing images.
+// The caller remains responsible for passphrase, and should clear it after this function returns.
+func SignDockerManifestDigestWithPrivateKeyFile(ctx context.Context, manifestDigest digest.Digest, dockerReference reference.Named,
+	privateKeyFile string, passphrase []byte) (*Signature, error) {
+	if passphrase == nil {
+		passphrase = []byte{} // WithPrivateKeyFile treats nil as “not provided”, but the key may be encrypted using an empty passphrase.
+	}
+	s := internal.SigstoreSigner{}
+	if err := WithPrivateKeyFile(privateKeyFile, passphrase)(&s); err != nil {
+		return nil, err
+	}
+	sig, err := s.SignManifestDigest(ctx, manifestDigest, dockerReference)
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{
+		MIMEType:    sig.UntrustedMIMEType(),
+		Payload:     sig.UntrustedPayload(),
+		Annotations: sig.UntrustedAnnotations(),
+	}, nil
+}
@@ -9,24 +9,44 @@ import (
 	"github.com/containers/image/v5/signature/signer"
 	"github.com/containers/image/v5/signature/sigstore/internal"
 	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"golang.org/x/exp/slices"
 )
 
 type Option = internal.Option
 
+// WithPrivateKeyFile returns an Option for NewSigner, specifying a private key file encrypted using passphrase.
+// The caller remains responsible for passphrase, and should clear it after NewSigner returns;
+// prefer WithPrivateKeyFilePassphraseCallback to avoid keeping a copy of the passphrase around.
 func WithPrivateKeyFile(file string, passphrase []byte) Option {
+	return WithPrivateKeyFilePassphraseCallback(file, func() ([]byte, error) {
+		return slices.Clone(passphrase), nil
+	})
+}
+
+// WithPrivateKeyFilePassphraseCallback returns an Option for NewSigner, specifying a private key file,
+// with getPassphrase called to obtain its passphrase only when the key is being decrypted.
+// getPassphrase must return a newly allocated slice (or nil if no passphrase is available);
+// the slice is cleared as soon as the private key is decrypted, whether that succeeds or not.
+func WithPrivateKeyFilePassphraseCallback(file string, getPassphrase func() ([]byte, error)) Option {
 	return func(s *internal.SigstoreSigner) error {
 		if s.PrivateKey != nil {
 			return fmt.Errorf("multiple private key sources specified when preparing to create sigstore signatures")
 		}
 
-		if passphrase == nil {
-			return errors.New("private key passphrase not provided")
-		}
-
 		privateKeyPEM, err := os.ReadFile(file)
 		if err != nil {
 			return fmt.Errorf("reading private key from %s: %w", file, err)
 		}
+		defer clearBytes(privateKeyPEM)
+		passphrase, err := getPassphrase()
+		if err != nil {
+			return fmt.Errorf("obtaining passphrase for private key %s: %w", file, err)
+		}
+		defer clearBytes(passphrase)
+		if passphrase == nil {
+			return errors.New("private key passphrase not provided")
+		}
+
 		signerVerifier, err := loadPrivateKey(privateKeyPEM, passphrase)
 		if err != nil {
 			return fmt.Errorf("initializing private key: %w", err)
@@ -45,6 +65,13 @@ func WithPrivateKeyFile(file string, passphrase []byte) Option {
 	}
 }
 
+// clearBytes overwrites b, which contained key material or a passphrase, with zeroes.
+func clearBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
 func NewSigner(opts ...Option) (*signer.Signer, error) {
 	s := internal.SigstoreSigner{}
 	for _, o := range opts {
@@ -0,0 +1,106 @@
+package sigstore
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+// assertErrorChainDoesNotContain checks that none of the errors in the chain of err contain any of secrets.
+func assertErrorChainDoesNotContain(t *testing.T, err error, secrets ...[]byte) {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		for _, secret := range secrets {
+			assert.NotContains(t, e.Error(), string(secret))
+		}
+	}
+}
+
+func TestWithPrivateKeyFilePassphraseCallback(t *testing.T) {
+	passphrase := []byte("some passphrase")
+	keyPair, err := GenerateKeyPair(passphrase)
+	require.NoError(t, err)
+	privateKeyBlock, _ := pem.Decode(keyPair.PrivateKey)
+	require.NotNil(t, privateKeyBlock)
+	tmpDir := t.TempDir()
+	privateKeyFile := filepath.Join(tmpDir, "private.key")
+	err = os.WriteFile(privateKeyFile, keyPair.PrivateKey, 0600)
+	require.NoError(t, err)
+
+	// returnPassphrase returns a callback returning a copy of p, and that copy after it is returned.
+	returnPassphrase := func(p []byte) (func() ([]byte, error), *[]byte) {
+		var returned []byte
+		return func() ([]byte, error) {
+			returned = slices.Clone(p)
+			return returned, nil
+		}, &returned
+	}
+	// isCleared returns true if all of b is zero.
+	isCleared := func(b []byte) bool {
+		return bytes.Count(b, []byte{0}) == len(b)
+	}
+
+	// Success
+	cb, returned := returnPassphrase(passphrase)
+	signer, err := NewSigner(WithPrivateKeyFilePassphraseCallback(privateKeyFile, cb))
+	require.NoError(t, err)
+	signer.Close()
+	assert.True(t, isCleared(*returned))
+
+	// WithPrivateKeyFile does not modify the caller’s passphrase
+	callerPassphrase := slices.Clone(passphrase)
+	signer, err = NewSigner(WithPrivateKeyFile(privateKeyFile, callerPassphrase))
+	require.NoError(t, err)
+	signer.Close()
+	assert.Equal(t, passphrase, callerPassphrase)
+
+	// An incorrect passphrase
+	wrongPassphrase := []byte("this is not the passphrase")
+	cb, returned = returnPassphrase(wrongPassphrase)
+	_, err = NewSigner(WithPrivateKeyFilePassphraseCallback(privateKeyFile, cb))
+	require.Error(t, err)
+	assert.True(t, isCleared(*returned))
+	assertErrorChainDoesNotContain(t, err, wrongPassphrase, privateKeyBlock.Bytes, keyPair.PrivateKey)
+
+	// The callback fails
+	cbErr := errors.New("passphrase not available")
+	_, err = NewSigner(WithPrivateKeyFilePassphraseCallback(privateKeyFile, func() ([]byte, error) {
+		return nil, cbErr
+	}))
+	assert.ErrorIs(t, err, cbErr)
+
+	// No passphrase
+	_, err = NewSigner(WithPrivateKeyFilePassphraseCallback(privateKeyFile, func() ([]byte, error) {
+		return nil, nil
+	}))
+	assert.Error(t, err)
+
+	// The private key file is missing; the callback is not called
+	_, err = NewSigner(WithPrivateKeyFilePassphraseCallback(filepath.Join(tmpDir, "this-does-not-exist"), func() ([]byte, error) {
+		require.Fail(t, "The passphrase callback should not be called")
+		return nil, nil
+	}))
+	assert.Error(t, err)
+
+	// Corrupted and unexpected private key files
+	for _, contents := range [][]byte{
+		privateKeyBlock.Bytes, // Not PEM
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBlock.Bytes}),                                       // Unexpected type
+		pem.EncodeToMemory(&pem.Block{Type: privateKeyBlock.Type, Bytes: privateKeyBlock.Bytes[:len(privateKeyBlock.Bytes)/2]}), // Truncated
+	} {
+		corruptedFile := filepath.Join(tmpDir, "corrupted.key")
+		err := os.WriteFile(corruptedFile, contents, 0600)
+		require.NoError(t, err)
+		cb, returned := returnPassphrase(passphrase)
+		_, err = NewSigner(WithPrivateKeyFilePassphraseCallback(corruptedFile, cb))
+		require.Error(t, err)
+		assert.True(t, isCleared(*returned))
+		assertErrorChainDoesNotContain(t, err, passphrase, privateKeyBlock.Bytes, contents)
+	}
+}
@@ -0,0 +1,154 @@
+// Note: Consider the API unstable until the code supports at least three different image formats or transports.
+
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/signature/internal"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+)
+
+// SigstoreVerificationResult contains the verified contents of a sigstore signature payload.
+type SigstoreVerificationResult struct {
+	DockerManifestDigest digest.Digest
+	DockerReference      string // FIXME: more precise type?
+	CreatorID            *string
+	Timestamp            *time.Time
+	// Annotations are the string-valued optional fields of the payload, e.g. as added by (cosign sign -a key=value);
+	// they are covered by the cryptographic signature.
+	Annotations map[string]string
+}
+
+// VerifySigstoreSignature checks that a sigstore signature, consisting of unverifiedPayload and unverifiedAnnotations
+// (as stored in a sigstore attachment layer), was created by publicKeyPEM, and that it claims the manifest with
+// expectedManifestDigest as expectedReference. expectedReference must match the signed identity exactly.
+//
+// This is intended for out-of-band verification of a single signature; it only supports public keys, and it does not
+// check Fulcio certificates or Rekor presence. Use a PolicyContext to evaluate signatures against a full policy.
+//
+// Signature contents that are not accepted are reported as InvalidSignatureError.
+func VerifySigstoreSignature(publicKeyPEM []byte, unverifiedPayload []byte, unverifiedAnnotations map[string]string,
+	expectedManifestDigest digest.Digest, expectedReference reference.Named) (*SigstoreVerificationResult, error) {
+	if expectedReference == nil {
+		return nil, errors.New("no expected reference specified")
+	}
+	publicKey, err := cryptoutils.UnmarshalPEMToPublicKey(publicKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+	unverifiedBase64Signature, ok := unverifiedAnnotations[signature.SigstoreSignatureAnnotationKey]
+	if !ok {
+		return nil, internal.NewInvalidSignatureError(fmt.Sprintf("missing %s annotation", signature.SigstoreSignatureAnnotationKey))
+	}
+
+	payload, err := internal.VerifySigstorePayload([]crypto.PublicKey{publicKey}, unverifiedPayload, unverifiedBase64Signature, internal.SigstorePayloadAcceptanceRules{
+		ValidateSignedDockerReference: func(signedDockerReference string) error {
+			signedRef, err := reference.ParseNormalizedNamed(signedDockerReference)
+			if err != nil {
+				return internal.NewInvalidSignatureError(fmt.Sprintf("Invalid docker reference %s in signature", signedDockerReference))
+			}
+			if signedRef.String() != expectedReference.String() {
+				return internal.NewInvalidSignatureError(fmt.Sprintf("Docker reference %s does not match %s",
+					signedDockerReference, expectedReference.String()))
+			}
+			return nil
+		},
+		ValidateSignedDockerManifestDigest: func(signedDockerManifestDigest digest.Digest) error {
+			if signedDockerManifestDigest != expectedManifestDigest {
+				return internal.NewInvalidSignatureError(fmt.Sprintf("Signature for docker digest %q does not match", signedDockerManifestDigest))
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SigstoreVerificationResult{
+		DockerManifestDigest: payload.UntrustedDockerManifestDigest(),
+		DockerReference:      payload.UntrustedDockerReference(),
+		CreatorID:            payload.UntrustedCreatorID(),
+		Timestamp:            payload.UntrustedTimestamp(),
+		Annotations:          payload.UntrustedAnnotations(),
+	}, nil
+}
+
+// SigstoreRekorEntry contains the verified contents of a Rekor transparency log entry recorded for a sigstore signature.
+type SigstoreRekorEntry struct {
+	LogID          string
+	LogIndex       int64
+	IntegratedTime time.Time
+	Body           []byte // The canonicalized entry body, currently always a hashedrekord v0.0.1 entry
+}
+
+// NoRekorEntryError is returned by VerifySigstoreRekorEntry if the signature does not contain any Rekor data.
+type NoRekorEntryError string
+
+func (err NoRekorEntryError) Error() string {
+	return string(err)
+}
+
+// VerifySigstoreRekorEntry checks that a sigstore signature, consisting of unverifiedPayload and unverifiedAnnotations
+// (as stored in a sigstore attachment layer), carries a Rekor SET signed by rekorPublicKeyPEM, which records the
+// signature as created by publicKeyPEM, and returns the recorded log entry.
+//
+// If publicKeyPEM is nil, the certificate in the signature annotations is used instead; note that this function
+// does not verify that certificate against a Fulcio CA, nor does it verify the signature payload itself.
+// Rekor inclusion proofs are not included in the signature format, so only the SET is verified.
+//
+// If the signature does not contain a Rekor SET, NoRekorEntryError is returned; other signature contents that
+// are not accepted are reported as InvalidSignatureError.
+func VerifySigstoreRekorEntry(rekorPublicKeyPEM []byte, publicKeyPEM []byte, unverifiedPayload []byte, unverifiedAnnotations map[string]string) (*SigstoreRekorEntry, error) {
+	rekorPublicKey, err := cryptoutils.UnmarshalPEMToPublicKey(rekorPublicKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parsing Rekor public key: %w", err)
+	}
+	rekorPublicKeyECDSA, ok := rekorPublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Rekor public key is not using ECDSA")
+	}
+	untrustedSET, ok := unverifiedAnnotations[signature.SigstoreSETAnnotationKey]
+	if !ok {
+		return nil, NoRekorEntryError(fmt.Sprintf("missing %s annotation", signature.SigstoreSETAnnotationKey))
+	}
+	unverifiedBase64Signature, ok := unverifiedAnnotations[signature.SigstoreSignatureAnnotationKey]
+	if !ok {
+		return nil, internal.NewInvalidSignatureError(fmt.Sprintf("missing %s annotation", signature.SigstoreSignatureAnnotationKey))
+	}
+	var keyOrCertPEM []byte
+	if publicKeyPEM != nil {
+		publicKey, err := cryptoutils.UnmarshalPEMToPublicKey(publicKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("parsing public key: %w", err)
+		}
+		// Re-marshal the key, so that it matches the key recorded by Rekor regardless of PEM formatting details.
+		keyOrCertPEM, err = cryptoutils.MarshalPublicKeyToPEM(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("re-marshaling public key to PEM: %w", err)
+		}
+	} else {
+		untrustedCert, ok := unverifiedAnnotations[signature.SigstoreCertificateAnnotationKey]
+		if !ok {
+			return nil, internal.NewInvalidSignatureError(fmt.Sprintf("no public key specified, and missing %s annotation", signature.SigstoreCertificateAnnotationKey))
+		}
+		keyOrCertPEM = []byte(untrustedCert)
+	}
+
+	payload, err := internal.VerifyRekorSETPayload(rekorPublicKeyECDSA, []byte(untrustedSET), keyOrCertPEM, unverifiedBase64Signature, unverifiedPayload)
+	if err != nil {
+		return nil, err
+	}
+	return &SigstoreRekorEntry{
+		LogID:          payload.LogID,
+		LogIndex:       payload.LogIndex,
+		IntegratedTime: time.Unix(payload.IntegratedTime, 0),
+		Body:           payload.Body,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package signature
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/signature"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySigstoreSignature(t *testing.T) {
+	publicKeyPEM, err := os.ReadFile("fixtures/cosign.pub")
+	require.NoError(t, err)
+	otherPublicKeyPEM, err := os.ReadFile("fixtures/cosign2.pub")
+	require.NoError(t, err)
+	const manifestDigest = digest.Digest("sha256:634a8f35b5f16dcf4aaa0822adc0b1964bb786fca12f6831de8ddc45e5986a00")
+	ref, err := reference.ParseNormalizedNamed("192.168.64.2:5000/cosign-signed-single-sample")
+	require.NoError(t, err)
+	sig := sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-valid/signature-1")
+
+	// Success
+	res, err := VerifySigstoreSignature(publicKeyPEM, sig.UntrustedPayload(), sig.UntrustedAnnotations(), manifestDigest, ref)
+	require.NoError(t, err)
+	assert.Equal(t, &SigstoreVerificationResult{
+		DockerManifestDigest: manifestDigest,
+		DockerReference:      "192.168.64.2:5000/cosign-signed-single-sample",
+		CreatorID:            nil,
+		Timestamp:            nil,
+		Annotations:          map[string]string{},
+	}, res)
+
+	// Success, with optional fields
+	taggedRef, err := reference.ParseNormalizedNamed("192.168.64.2:5000/skopeo-signed:tag")
+	require.NoError(t, err)
+	taggedSig := sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-valid-with-tag/signature-1")
+	res, err = VerifySigstoreSignature(publicKeyPEM, taggedSig.UntrustedPayload(), taggedSig.UntrustedAnnotations(), manifestDigest, taggedRef)
+	require.NoError(t, err)
+	require.NotNil(t, res.CreatorID)
+	assert.Equal(t, "containers/image 5.21.2-dev", *res.CreatorID)
+	require.NotNil(t, res.Timestamp)
+	assert.Equal(t, time.Unix(1657296609, 0), *res.Timestamp)
+
+	// Missing expected reference
+	res, err = VerifySigstoreSignature(publicKeyPEM, sig.UntrustedPayload(), sig.UntrustedAnnotations(), manifestDigest, nil)
+	assert.Error(t, err)
+	assert.Nil(t, res)
+
+	// Invalid public key
+	res, err = VerifySigstoreSignature([]byte("not a public key"), sig.UntrustedPayload(), sig.UntrustedAnnotations(), manifestDigest, ref)
+	assert.Error(t, err)
+	assert.Nil(t, res)
+
+	for _, c := range []struct {
+		name           string
+		publicKeyPEM   []byte
+		annotations    map[string]string
+		manifestDigest digest.Digest
+		ref            string
+	}{
+		{"wrong key", otherPublicKeyPEM, sig.UntrustedAnnotations(), manifestDigest, ref.String()},
+		{"missing signature annotation", publicKeyPEM, map[string]string{}, manifestDigest, ref.String()},
+		{"invalid signature", publicKeyPEM, map[string]string{signature.SigstoreSignatureAnnotationKey: "invalid"}, manifestDigest, ref.String()},
+		{"digest mismatch", publicKeyPEM, sig.UntrustedAnnotations(), digest.FromString("other"), ref.String()},
+		{"reference mismatch", publicKeyPEM, sig.UntrustedAnnotations(), manifestDigest, "192.168.64.2:5000/cosign-signed-single-sample:tag"},
+	} {
+		expectedRef, err := reference.ParseNormalizedNamed(c.ref)
+		require.NoError(t, err)
+		res, err := VerifySigstoreSignature(c.publicKeyPEM, sig.UntrustedPayload(), c.annotations, c.manifestDigest, expectedRef)
+		assert.ErrorAs(t, err, &InvalidSignatureError{}, c.name)
+		assert.Nil(t, res, c.name)
+	}
+}
+
+func TestVerifySigstoreRekorEntry(t *testing.T) {
+	rekorPublicKeyPEM, err := os.ReadFile("fixtures/rekor.pub")
+	require.NoError(t, err)
+	publicKeyPEM, err := os.ReadFile("fixtures/cosign2.pub")
+	require.NoError(t, err)
+	otherPublicKeyPEM, err := os.ReadFile("fixtures/cosign.pub")
+	require.NoError(t, err)
+	keySig := sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-key-rekor-valid/signature-1")
+	fulcioSig := sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-fulcio-rekor-valid/signature-1")
+
+	// Success, with a public key
+	res, err := VerifySigstoreRekorEntry(rekorPublicKeyPEM, publicKeyPEM, keySig.UntrustedPayload(), keySig.UntrustedAnnotations())
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, "c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d", res.LogID)
+	assert.Equal(t, int64(11608800), res.LogIndex)
+	assert.Equal(t, time.Unix(1674251859, 0), res.IntegratedTime)
+	assert.Contains(t, string(res.Body), `"kind":"hashedrekord"`)
+
+	// Success, with the certificate in the signature
+	res, err = VerifySigstoreRekorEntry(rekorPublicKeyPEM, nil, fulcioSig.UntrustedPayload(), fulcioSig.UntrustedAnnotations())
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, int64(11605770), res.LogIndex)
+	assert.Equal(t, time.Unix(1674247893, 0), res.IntegratedTime)
+
+	// Invalid Rekor public key
+	res, err = VerifySigstoreRekorEntry([]byte("not a public key"), publicKeyPEM, keySig.UntrustedPayload(), keySig.UntrustedAnnotations())
+	assert.Error(t, err)
+	assert.Nil(t, res)
+
+	// Invalid public key
+	res, err = VerifySigstoreRekorEntry(rekorPublicKeyPEM, []byte("not a public key"), keySig.UntrustedPayload(), keySig.UntrustedAnnotations())
+	assert.Error(t, err)
+	assert.Nil(t, res)
+
+	// No Rekor data
+	res, err = VerifySigstoreRekorEntry(rekorPublicKeyPEM, publicKeyPEM, keySig.UntrustedPayload(),
+		sigstoreSignatureWithoutAnnotation(t, keySig, signature.SigstoreSETAnnotationKey).UntrustedAnnotations())
+	assert.ErrorAs(t, err, new(NoRekorEntryError))
+	assert.Nil(t, res)
+
+	for _, c := range []struct {
+		name         string
+		rekorKeyPEM  []byte
+		publicKeyPEM []byte
+		sig          signature.Sigstore
+	}{
+		{"wrong Rekor key", publicKeyPEM, publicKeyPEM, keySig},
+		{"wrong public key", rekorPublicKeyPEM, otherPublicKeyPEM, keySig},
+		{"missing signature annotation", rekorPublicKeyPEM, publicKeyPEM, sigstoreSignatureWithoutAnnotation(t, keySig, signature.SigstoreSignatureAnnotationKey)},
+		{"missing certificate annotation", rekorPublicKeyPEM, nil, sigstoreSignatureWithoutAnnotation(t, fulcioSig, signature.SigstoreCertificateAnnotationKey)},
+		{"payload mismatch", rekorPublicKeyPEM, publicKeyPEM, signature.SigstoreFromComponents(keySig.UntrustedMIMEType(), []byte("other payload"), keySig.UntrustedAnnotations())},
+	} {
+		res, err := VerifySigstoreRekorEntry(c.rekorKeyPEM, c.publicKeyPEM, c.sig.UntrustedPayload(), c.sig.UntrustedAnnotations())
+		assert.ErrorAs(t, err, &InvalidSignatureError{}, c.name)
+		assert.Nil(t, res, c.name)
+	}
+}
@@ -50,6 +50,10 @@ func TestNewSigner(t *testing.T) {
 	// An option causes an error
 	_, err = NewSigner(WithKeyFingerprint(testKeyFingerprintWithPassphrase), WithPassphrase("\n"))
 	assert.Error(t, err)
+	// … and the error does not include the passphrase
+	_, err = NewSigner(WithKeyFingerprint(testKeyFingerprintWithPassphrase), WithPassphrase(testPassphrase+"\n"))
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), testPassphrase)
 
 	// WithKeyFingerprint is missing
 	_, err = NewSigner(WithPassphrase("something"))
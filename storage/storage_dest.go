@@ -232,7 +232,7 @@ func (s *storageImageDestination) putBlobToPendingFile(stream io.Reader, blobinf
 	s.filenames[blobDigest] = filename
 	s.lock.Unlock()
 	// This is safe because we have just computed diffID, and blobDigest was either computed
-	// by us, or validated by the caller (usually copy.digestingReader).
+	// by us, or validated by the caller (usually using digestverify.Reader in the copy package).
 	options.Cache.RecordDigestUncompressedPair(blobDigest, diffID.Digest())
 	return private.UploadedBlob{
 		Digest: blobDigest,
@@ -0,0 +1,77 @@
+//go:build !containers_image_storage_stub
+// +build !containers_image_storage_stub
+
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/containers/storage"
+	digest "github.com/opencontainers/go-digest"
+	"golang.org/x/exp/slices"
+)
+
+// ListedImage describes an image in a store, as returned by ListImages.
+type ListedImage struct {
+	// Reference refers to the image by its ID.
+	Reference types.ImageReference
+	ID        string
+	// Names are the names of the image, as recorded in the store; usually fully-qualified name:tag values.
+	Names []string
+	// Digest is the digest of the primary manifest of the image, or "" if unknown.
+	Digest digest.Digest
+	// Digests are the digests of all manifests stored for the image.
+	Digests []digest.Digest
+	Created time.Time
+	// TopLayer describes the top layer of the image, or is nil if the image has no layers.
+	TopLayer *ListedLayer
+}
+
+// ListedLayer describes a layer of an image listed by ListImages.
+type ListedLayer struct {
+	ID                 string
+	UncompressedDigest digest.Digest // "" if unknown
+	UncompressedSize   int64         // -1 if unknown
+}
+
+// ListImages returns all images in store, with their names, digests, and information about their top layers.
+func ListImages(store storage.Store) ([]ListedImage, error) {
+	images, err := store.Images()
+	if err != nil {
+		return nil, fmt.Errorf("listing images: %w", err)
+	}
+	res := make([]ListedImage, 0, len(images))
+	for _, img := range images {
+		ref, err := Transport.NewStoreReference(store, nil, img.ID)
+		if err != nil {
+			return nil, fmt.Errorf("creating a reference for image %q: %w", img.ID, err)
+		}
+		listed := ListedImage{
+			Reference: ref,
+			ID:        img.ID,
+			Names:     slices.Clone(img.Names),
+			Digest:    img.Digest,
+			Digests:   slices.Clone(img.Digests),
+			Created:   img.Created,
+		}
+		if img.TopLayer != "" {
+			layer, err := store.Layer(img.TopLayer)
+			if err != nil {
+				return nil, fmt.Errorf("reading top layer %q of image %q: %w", img.TopLayer, img.ID, err)
+			}
+			listedLayer := ListedLayer{
+				ID:                 layer.ID,
+				UncompressedDigest: layer.UncompressedDigest,
+				UncompressedSize:   -1,
+			}
+			if layer.UncompressedDigest != "" { // The store records the size together with the digest.
+				listedLayer.UncompressedSize = layer.UncompressedSize
+			}
+			listed.TopLayer = &listedLayer
+		}
+		res = append(res, listed)
+	}
+	return res, nil
+}
@@ -0,0 +1,51 @@
+//go:build !containers_image_storage_stub
+// +build !containers_image_storage_stub
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListImages(t *testing.T) {
+	store := newStore(t)
+
+	images, err := ListImages(store)
+	require.NoError(t, err)
+	assert.Empty(t, images)
+
+	const noLayersID = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	const withLayerID = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	_, err = store.CreateImage(noLayersID, []string{"docker.io/library/busybox:latest", "example.com/busybox:1"}, "", "", nil)
+	require.NoError(t, err)
+	layer, err := store.CreateLayer("", "", nil, "", false, nil)
+	require.NoError(t, err)
+	_, err = store.CreateImage(withLayerID, nil, layer.ID, "", nil)
+	require.NoError(t, err)
+
+	images, err = ListImages(store)
+	require.NoError(t, err)
+	require.Len(t, images, 2)
+	byID := map[string]ListedImage{}
+	for _, img := range images {
+		byID[img.ID] = img
+	}
+
+	img, ok := byID[noLayersID]
+	require.True(t, ok)
+	assert.Equal(t, []string{"docker.io/library/busybox:latest", "example.com/busybox:1"}, img.Names)
+	assert.Nil(t, img.TopLayer)
+
+	img, ok = byID[withLayerID]
+	require.True(t, ok)
+	assert.Empty(t, img.Names)
+	require.NotNil(t, img.TopLayer)
+	assert.Equal(t, ListedLayer{ID: layer.ID, UncompressedDigest: "", UncompressedSize: -1}, *img.TopLayer)
+	storageRef, ok := img.Reference.(*storageReference)
+	require.True(t, ok)
+	assert.Equal(t, withLayerID, storageRef.id)
+	assert.Nil(t, storageRef.named)
+}
@@ -219,6 +219,18 @@ func (s *storageTransport) GetStore() (storage.Store, error) {
 // tries to figure out which it is, and returns it in a reference object.
 // If _id_ is the ID of an image that's present in local storage, it can be truncated, and
 // even be specified as if it were a _name_, value.
+//
+// The full grammar is:
+//
+//	reference       := [ "[" store-specifier "]" ] image
+//	store-specifier := [ driver "@" ] graphroot [ "+" runroot ] [ ":" options ]
+//	options         := option { "," option }
+//	image           := "@" id | id-prefix | named [ "@" id ]
+//	named           := name [ ":" tag ] [ "@" digest ]
+//
+// graphroot and runroot must be absolute paths; driver, if present, must not be empty.
+// A "@" suffix is treated as a digest if it parses as one, and as an image ID otherwise.
+// Errors caused by malformed input wrap ErrInvalidReference or ErrPathNotAbsolute.
 func (s *storageTransport) ParseReference(reference string) (types.ImageReference, error) {
 	var store storage.Store
 	// Check if there's a store location prefix.  If there is, then it
@@ -228,9 +240,10 @@ func (s *storageTransport) ParseReference(reference string) (types.ImageReferenc
 	if len(reference) > 0 && reference[0] == '[' {
 		closeIndex := strings.IndexRune(reference, ']')
 		if closeIndex < 1 {
-			return nil, ErrInvalidReference
+			return nil, fmt.Errorf("store specifier in %q did not end: %w", reference, ErrInvalidReference)
 		}
-		storeSpec := reference[1:closeIndex]
+		fullStoreSpec := reference[1:closeIndex]
+		storeSpec := fullStoreSpec
 		reference = reference[closeIndex+1:]
 		// Peel off a "driver@" from the start.
 		driverInfo := ""
@@ -238,16 +251,16 @@ func (s *storageTransport) ParseReference(reference string) (types.ImageReferenc
 		if !gotDriver {
 			storeSpec = driverPart1
 			if storeSpec == "" {
-				return nil, ErrInvalidReference
+				return nil, fmt.Errorf("empty store specifier \"[]\": %w", ErrInvalidReference)
 			}
 		} else {
 			driverInfo = driverPart1
 			if driverInfo == "" {
-				return nil, ErrInvalidReference
+				return nil, fmt.Errorf("empty graph driver name in store specifier %q: %w", fullStoreSpec, ErrInvalidReference)
 			}
 			storeSpec = driverPart2
 			if storeSpec == "" {
-				return nil, ErrInvalidReference
+				return nil, fmt.Errorf("empty graph root in store specifier \"%s@\": %w", driverInfo, ErrInvalidReference)
 			}
 		}
 		// Peel off a ":options" from the end.
@@ -262,10 +275,10 @@ func (s *storageTransport) ParseReference(reference string) (types.ImageReferenc
 		rootInfo := storeSpec
 		// Check that any paths are absolute paths.
 		if rootInfo != "" && !filepath.IsAbs(rootInfo) {
-			return nil, ErrPathNotAbsolute
+			return nil, fmt.Errorf("graph root %q: %w", rootInfo, ErrPathNotAbsolute)
 		}
 		if runRootInfo != "" && !filepath.IsAbs(runRootInfo) {
-			return nil, ErrPathNotAbsolute
+			return nil, fmt.Errorf("run root %q: %w", runRootInfo, ErrPathNotAbsolute)
 		}
 		store2, err := storage.GetStore(storage.StoreOptions{
 			GraphDriverName:    driverInfo,
@@ -276,7 +289,7 @@ func (s *storageTransport) ParseReference(reference string) (types.ImageReferenc
 			GIDMap:             s.defaultGIDMap,
 		})
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("opening store %q: %w", fullStoreSpec, err)
 		}
 		store = store2
 	} else {
@@ -135,6 +135,22 @@ func TestTransportParseReference(t *testing.T) {
 			}
 		}
 	}
+
+	// Malformed store specifiers are reported using the documented errors
+	for _, c := range []struct {
+		prefix   string
+		expected error
+	}{
+		{"[unterminated", ErrInvalidReference},
+		{"[]", ErrInvalidReference},
+		{"[@" + root + "suffix2]", ErrInvalidReference},
+		{"[" + driver + "@]", ErrInvalidReference},
+		{"[relative/path]", ErrPathNotAbsolute},
+		{"[" + driver + "@" + root + "suffix3+relative/path]", ErrPathNotAbsolute},
+	} {
+		_, err := Transport.ParseReference(c.prefix + "busybox")
+		assert.ErrorIs(t, err, c.expected, c.prefix)
+	}
 }
 
 func TestTransportValidatePolicyConfigurationScope(t *testing.T) {
@@ -2,6 +2,7 @@ package types
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"time"
 
@@ -262,6 +263,7 @@ type ImageSource interface {
 	// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
 	// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
 	// (e.g. if the source never returns manifest lists).
+	// The order of the signatures is transport-specific; UnparsedImage.Signatures returns them in a canonical order.
 	GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error)
 	// LayerInfosForCopy returns either nil (meaning the values in the manifest are fine), or updated values for the layer
 	// blobsums that are listed in the image's manifest.  If values are returned, they should be used when using GetBlob()
@@ -362,6 +364,45 @@ func (e ManifestTypeRejectedError) Error() string {
 	return e.Err.Error()
 }
 
+// ErrManifestTooLarge is returned by ImageDestination.PutManifest (possibly wrapped, detect it using errors.As)
+// if the destination refuses a manifest because it is too large.
+type ErrManifestTooLarge struct {
+	Size  int64 // The size of the refused manifest
+	Limit int64 // The maximum size accepted by the destination, or -1 if not known
+	Err   error // The underlying error reported by the destination, if any
+}
+
+func (e ErrManifestTooLarge) Error() string {
+	msg := fmt.Sprintf("manifest of %d bytes is too large", e.Size)
+	if e.Limit != -1 {
+		msg += fmt.Sprintf(", the limit is %d bytes", e.Limit)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e ErrManifestTooLarge) Unwrap() error {
+	return e.Err
+}
+
+// SignatureStorageMethod identifies a way an ImageDestination can store signatures,
+// for destinations which support more than one.
+type SignatureStorageMethod string
+
+const (
+	// SignatureStorageLookaside stores simple signing signatures in a lookaside location, as configured in registries.d.
+	SignatureStorageLookaside SignatureStorageMethod = "lookaside"
+	// SignatureStorageAPIExtension stores simple signing signatures using the X-Registry-Supports-Signatures API extension.
+	SignatureStorageAPIExtension SignatureStorageMethod = "api-extension"
+	// SignatureStorageSigstoreAttachments stores sigstore signatures in an attachment manifest, tagged using a tag derived from the signed manifest digest.
+	SignatureStorageSigstoreAttachments SignatureStorageMethod = "sigstore-attachments"
+	// SignatureStorageReferrers stores sigstore signatures in manifests with a subject referring to the signed manifest,
+	// to be found using the OCI referrers API.
+	SignatureStorageReferrers SignatureStorageMethod = "referrers"
+)
+
 // UnparsedImage is an Image-to-be; until it is verified and accepted, it only caries its identity and caches manifest and signature blobs.
 // Thus, an UnparsedImage can be created from an ImageSource simply by fetching blobs without interpreting them,
 // allowing cryptographic signature verification to happen first, before even fetching the manifest, or parsing anything else.
@@ -377,6 +418,7 @@ type UnparsedImage interface {
 	// Manifest is like ImageSource.GetManifest, but the result is cached; it is OK to call this however often you need.
 	Manifest(ctx context.Context) ([]byte, string, error)
 	// Signatures is like ImageSource.GetSignatures, but the result is cached; it is OK to call this however often you need.
+	// The implementations in this library return the signatures in a canonical order, which does not depend on the transport.
 	Signatures(ctx context.Context) ([][]byte, error)
 }
 
@@ -499,6 +541,13 @@ type DockerAuthConfig struct {
 	IdentityToken string
 }
 
+// DockerRateLimit contains the rate-limit budget reported by a registry in the headers of a response.
+type DockerRateLimit struct {
+	Registry  string // The registry which sent the response, as host[:port]
+	Limit     int64  // The number of requests allowed in the current window, or -1 if not reported
+	Remaining int64  // The number of requests remaining in the current window, or -1 if not reported
+}
+
 // OptionalBool is a boolean with an additional undefined value, which is meant
 // to be used in the context of user input to distinguish between a
 // user-specified value and a default value.
@@ -576,6 +625,9 @@ type SystemContext struct {
 	SystemRegistriesConfPath string
 	// Path to the system-wide registries configuration directory
 	SystemRegistriesConfDirPath string
+	// If not "", overrides the pull-source-policy setting of all registries in registries.conf,
+	// i.e. the order in which mirrors are tried: "priority" or "latency"; see pkg/sysregistriesv2.
+	PullSourcePolicy string
 	// Path to the user-specific short-names configuration file
 	UserShortNameAliasConfPath string
 	// If set, short-name resolution in pkg/shortnames must follow the specified mode
@@ -598,6 +650,8 @@ type SystemContext struct {
 	ArchitectureChoice string
 	// If not "", overrides the use of platform.GOOS when choosing an image or verifying OS match.
 	OSChoice string
+	// If not "", overrides the use of the detected host OS version (e.g. "10.0.20348.1787") when choosing a Windows image.
+	OSVersionChoice string
 	// If not "", overrides the use of detected ARM platform variant when choosing an image or verifying variant match.
 	VariantChoice string
 	// If not "", overrides the system's default directory containing a blob info cache.
@@ -607,6 +661,14 @@ type SystemContext struct {
 	// If not "", overrides the temporary directory to use for storing big files
 	BigFilesTemporaryDir string
 
+	// === Policy decision service overrides ===
+	// If not "", a directory containing a CA certificate (ending with ".crt"),
+	// a client certificate (ending with ".cert") and a client certificate key
+	// (ending with ".key") used when contacting decision services of "remote" signature policy requirements.
+	PolicyDecisionServiceCertPath string
+	// If not "", the bearer token used to authenticate to decision services of "remote" signature policy requirements.
+	PolicyDecisionServiceBearerToken string
+
 	// === OCI.Transport overrides ===
 	// If not "", a directory containing a CA certificate (ending with ".crt"),
 	// a client certificate (ending with ".cert") and a client certificate key
@@ -644,12 +706,58 @@ type SystemContext struct {
 	DockerDisableDestSchema1MIMETypes bool
 	// If true, the physical pull source of docker transport images logged as info level
 	DockerLogMirrorChoice bool
+	// If not nil, called with the values of every registry response which reports a rate-limit budget
+	// (in RateLimit-Limit/RateLimit-Remaining, X-RateLimit-…, or RateLimit headers).
+	// It may be called concurrently from several goroutines, and should return quickly.
+	DockerRateLimitCallback func(DockerRateLimit)
+	// If not "", overrides the tag of sigstore signature attachments of a manifest: a fmt template containing exactly one %s,
+	// which is replaced by the hexadecimal value of the manifest digest (e.g. "sha256-%s.sig", the default for sha256 digests).
+	DockerSignatureAttachmentTagFormat string
+	// If not 0, the maximum number of referrers of a manifest which are fetched from the OCI referrers API,
+	// over all pages if the registry paginates the list; listing more referrers fails. The default is 10000.
+	DockerMaxReferrers int
+	// If not OptionalBoolUndefined, overrides the use-sigstore-attachments option of registries.d for all registries:
+	// whether sigstore signatures are read from (and written to) attachments, which allows verifying them in policy evaluation
+	// when pulling from registries without the signature extension API. Missing attachments are not an error.
+	DockerUseSigstoreAttachments OptionalBool
 	// Directory to use for OSTree temporary files
 	OSTreeTmpDirPath string
 	// If true, all blobs will have precomputed digests to ensure layers are not uploaded that already exist on the registry.
 	// Note that this requires writing blobs to temporary files, and takes more time than the default behavior,
 	// when the digest for a blob is unknown.
 	DockerRegistryPushPrecomputeDigests bool
+	// If not 0, the maximum number of concurrent blob uploads to a single registry, shared by all image destinations
+	// in this process which use the same value (regardless of which copy operation they are used by).
+	// This allows limiting the load on a rate-limited registry when copying many images concurrently.
+	DockerRegistryMaxParallelUploads int
+	// If true, blobs are uploaded to registries in chunks, and if an upload of a blob with a known digest fails after
+	// some chunks were accepted, a later upload of the same blob to the same repository continues from the last accepted
+	// chunk instead of starting over. This applies to uploads using the same ImageDestination, or, within a batch of copies
+	// sharing registry state (e.g. copy.Images), using the same registry credentials.
+	DockerRegistryResumableUploads bool
+	// If not 0, the minimum size of chunks uploaded with DockerRegistryResumableUploads; the registry may require larger chunks.
+	// The default is 8 MiB.
+	DockerRegistryMinUploadChunkSize int64
+	// If not 0, the number of times an upload of a blob interrupted by a network error is continued, in the same
+	// upload session, from the data accepted by the registry. This requires buffering the uploaded data in a temporary
+	// file, unless the stream passed to PutBlob implements io.ReaderAt and io.Seeker.
+	DockerMaxUploadRetries int
+	// If not 0, the maximum size of manifests accepted by registries; larger manifests are refused with ErrManifestTooLarge
+	// without contacting the registry. This allows consistent behavior with registries which don’t clearly report
+	// the reason for refusing a manifest.
+	DockerRegistryMaxManifestSize int64
+	// If DockerLowSpeedLimit and DockerLowSpeedTime are both set, reading a response body from a registry fails if
+	// less than DockerLowSpeedLimit bytes per second are received on average over DockerLowSpeedTime (e.g. when a server
+	// keeps a connection alive by sending data extremely slowly). Only time spent waiting for data from the server is
+	// counted, so transfers which are slow because the data is consumed slowly are not affected.
+	// Regardless of these settings, reading a response body fails as soon as the context of the operation is done.
+	DockerLowSpeedLimit int64
+	DockerLowSpeedTime  time.Duration
+	// If VerifyMirrorDigest is set, pulling a tagged image through a mirror first resolves the tag on the primary location
+	// of the registry (using a HEAD request), and mirrors which serve a manifest with a different digest (e.g. a stale one)
+	// are skipped. If the tag can't be resolved on the primary location, no mirror is used.
+	// Pulls by digest are not affected.
+	VerifyMirrorDigest bool
 
 	// === docker/daemon.Transport overrides ===
 	// A directory containing a CA certificate (ending with ".crt"),
@@ -710,4 +818,43 @@ type ProgressProperties struct {
 	// The additional offset which has been downloaded inside the last update
 	// interval. Will be reset after each ProgressEventRead event.
 	OffsetUpdate uint64
+
+	// The rate of reading the artifact from the source, in bytes per second, smoothed using an
+	// exponentially weighted moving average. Set in ProgressEventRead and ProgressEventDone events.
+	Rate float64
+
+	// The estimated time until the artifact is completely read, based on Rate and the artifact size.
+	// Zero if not known. Set in ProgressEventRead events.
+	ETA time.Duration
+
+	// The sum of the smoothed rates of all artifacts currently being copied by the same copy operation,
+	// in bytes per second. Set in ProgressEventRead and ProgressEventDone events.
+	OverallRate float64
+
+	// The estimated time until all artifacts currently being copied by the same copy operation are completely read,
+	// based on OverallRate. Zero if not known. Set in ProgressEventRead events.
+	OverallETA time.Duration
+
+	// The stage of the copy pipeline which limited the throughput of the artifact during the last update interval.
+	// Set in ProgressEventRead events.
+	Bottleneck ProgressBottleneck
 }
+
+// ProgressBottleneck identifies a stage of the copy pipeline which limits its throughput.
+type ProgressBottleneck uint
+
+const (
+	// ProgressBottleneckUnknown indicates that no stage was found to limit the throughput,
+	// e.g. because no data was transferred.
+	ProgressBottleneckUnknown ProgressBottleneck = iota
+
+	// ProgressBottleneckSourceRead indicates that the pipeline was mostly waiting for data from the source.
+	ProgressBottleneckSourceRead
+
+	// ProgressBottleneckProcessing indicates that the pipeline was mostly waiting for processing of the data
+	// (decompression, compression, decryption or encryption).
+	ProgressBottleneckProcessing
+
+	// ProgressBottleneckDestinationWrite indicates that the pipeline was mostly waiting for the destination to accept data.
+	ProgressBottleneckDestinationWrite
+)